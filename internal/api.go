@@ -0,0 +1,526 @@
+/**
+ * API - Driving the daemon from other programs
+ * The running daemon serves its operations (status, Google Drive sync,
+ * system updates, health, liveness, Notion sync, scheduled jobs, alerts,
+ * accepting config file changes, stopping) as JSON over a unix socket in
+ * the runtime directory that only its user can open; remote.go serves part
+ * of it over Tailscale. src/api has the types and a Go client.
+ */
+
+package daemira
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	systemupdate "github.com/ln64-git/daemira/src/features/system-update"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// errNotRunning answers an operation on a feature that isn't running
+var errNotRunning = errors.New("not running")
+
+// ServeAPI starts serving the API on utility.APISocketPath
+func (d *Daemira) ServeAPI() error {
+	path := utility.APISocketPath()
+	if _, err := utility.EnsureDir(utility.RuntimeDir()); err != nil {
+		return fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	// A socket nobody answers on was left by a daemon that died
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another daemon is serving the API on %s", path)
+	}
+	_ = os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+
+	server := &http.Server{
+		Handler:           d.apiHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	d.mu.Lock()
+	d.apiServer = server
+	d.mu.Unlock()
+
+	utility.Go("api", func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.logger.Error("API stopped: %v", err)
+		}
+	})
+	d.logger.Info("API listening on %s", path)
+	return nil
+}
+
+// apiHandler routes the API's endpoints
+func (d *Daemira) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", d.handleStatus)
+	mux.HandleFunc("GET /v1/health", d.handleHealth)
+	mux.HandleFunc("GET /v1/live", d.handleLive)
+	mux.HandleFunc("POST /v1/daemon/stop", d.handleStop)
+	mux.HandleFunc("GET /v1/gdrive", d.handleGDriveStatus)
+	mux.HandleFunc("POST /v1/gdrive/start", d.handleGDriveStart)
+	mux.HandleFunc("POST /v1/gdrive/stop", d.handleGDriveStop)
+	mux.HandleFunc("POST /v1/gdrive/sync", d.handleGDriveSync)
+	mux.HandleFunc("POST /v1/gdrive/resync", d.handleGDriveResync)
+	mux.HandleFunc("GET /v1/system/update", d.handleUpdateStatus)
+	mux.HandleFunc("POST /v1/system/update", d.handleUpdateRun)
+	mux.HandleFunc("GET /v1/notion", d.handleNotionStatus)
+	mux.HandleFunc("POST /v1/notion/sync", d.handleNotionSync)
+	mux.HandleFunc("GET /v1/jobs", d.handleJobs)
+	mux.HandleFunc("POST /v1/jobs/{id}/run", d.handleJobRun)
+	mux.HandleFunc("GET /v1/alerts", d.handleAlerts)
+	mux.HandleFunc("POST /v1/alerts/{id}/ack", d.handleAlertAck)
+	mux.HandleFunc("POST /v1/alerts/{id}/silence", d.handleAlertSilence)
+	mux.HandleFunc("POST /v1/security/integrity/accept", d.handleIntegrityAccept)
+	return mux
+}
+
+func (d *Daemira) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	started := d.started
+	d.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, api.Status{
+		PID:          os.Getpid(),
+		Started:      started,
+		GDrive:       d.gdriveStatus(),
+		SystemUpdate: d.updateStatus(),
+		NotionSync:   d.notionStatus(),
+	})
+}
+
+func (d *Daemira) handleHealth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	health := api.HealthStatus{DiskWarnings: []api.DiskWarning{}}
+
+	if stats, err := systemhealth.GetPerformanceManager().GetCPUStats(ctx); err == nil {
+		health.CPUUtilization = stats.Utilization
+		health.PowerProfile = string(stats.PowerProfile)
+	}
+	if stats, err := systemhealth.GetMemoryMonitor().GetMemoryStats(ctx); err == nil {
+		health.MemoryUsedGB = stats.UsedGB
+		health.MemoryTotalGB = stats.TotalGB
+		health.SwapUsedGB = stats.Swap.UsedGB
+	}
+	if firewall, err := systemhealth.GetSecurityMonitor().GetFirewallStatus(ctx); err == nil {
+		health.Firewall = firewall.Active
+	}
+	warnings, err := systemhealth.GetDiskMonitor().CheckLowSpace(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to check disk space: %w", err))
+		return
+	}
+	for _, warning := range warnings {
+		health.DiskWarnings = append(health.DiskWarnings, api.DiskWarning{
+			MountPoint:  warning.MountPoint,
+			Level:       warning.Level,
+			FreeGB:      warning.FreeGB,
+			PercentUsed: warning.PercentUsed,
+		})
+	}
+	writeJSON(w, http.StatusOK, health)
+}
+
+// handleLive answers 503 when a liveness check fails, for health checkers
+// that only look at the status
+func (d *Daemira) handleLive(w http.ResponseWriter, r *http.Request) {
+	liveness := d.Liveness()
+	live := api.Liveness{Alive: liveness.Alive, Checks: []api.LivenessCheck{}}
+	for _, check := range liveness.Checks {
+		live.Checks = append(live.Checks, api.LivenessCheck{Name: check.Name, Alive: check.Alive, Detail: check.Detail})
+	}
+	if !liveness.Alive {
+		live.Error = "daemon is hung: " + liveness.Failures()
+		writeJSON(w, http.StatusServiceUnavailable, live)
+		return
+	}
+	writeJSON(w, http.StatusOK, live)
+}
+
+// handleStop signals this process, so the daemon shuts down the same way
+// as on `daemira daemon stop`
+func (d *Daemira) handleStop(w http.ResponseWriter, r *http.Request) {
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, "Daemon stopping")
+}
+
+func (d *Daemira) handleGDriveStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.gdriveStatus())
+}
+
+func (d *Daemira) handleGDriveStart(w http.ResponseWriter, r *http.Request) {
+	if !d.GetConfig().GDriveEnabled {
+		writeError(w, http.StatusConflict, errors.New("Google Drive sync is disabled in config (gdrive.enabled = false)"))
+		return
+	}
+	if err := d.SyncGoogleDrive(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if d.GetGoogleDrive() == nil {
+		writeError(w, http.StatusConflict, errors.New("Google Drive sync doesn't run as root (rclone config is user-specific)"))
+		return
+	}
+	writeResult(w, "Google Drive sync started")
+}
+
+// handleGDriveStop waits for syncs in progress, interrupting them if the
+// client gives up
+func (d *Daemira) handleGDriveStop(w http.ResponseWriter, r *http.Request) {
+	gd, err := d.runningGoogleDrive()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err := gd.Shutdown(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, "Google Drive sync stopped")
+}
+
+func (d *Daemira) handleGDriveSync(w http.ResponseWriter, r *http.Request) {
+	gd, err := d.runningGoogleDrive()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		writeResult(w, gd.SyncAll())
+		return
+	}
+	if !d.syncsDirectory(dir) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("directory not found: %s", dir))
+		return
+	}
+	writeResult(w, gd.SyncDirectory(dir))
+}
+
+func (d *Daemira) handleGDriveResync(w http.ResponseWriter, r *http.Request) {
+	gd, err := d.runningGoogleDrive()
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	dir := r.URL.Query().Get("dir")
+	if !d.syncsDirectory(dir) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("directory not found: %s", dir))
+		return
+	}
+	if err := gd.ResyncDirectory(r.Context(), dir); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("resync failed: %w", err))
+		return
+	}
+	writeResult(w, fmt.Sprintf("Resync completed for %s. Cache rebuilt and deletions synced.", dir))
+}
+
+func (d *Daemira) handleUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.updateStatus())
+}
+
+// handleUpdateRun starts a system update; with wait=true it answers once
+// the update finished. A client giving up doesn't cancel the update.
+func (d *Daemira) handleUpdateRun(w http.ResponseWriter, r *http.Request) {
+	if !d.GetConfig().SystemUpdateEnabled {
+		writeError(w, http.StatusConflict, errors.New("system updates are disabled in config (system_update.enabled = false)"))
+		return
+	}
+	su := d.GetSystemUpdate()
+	if su == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("system update scheduler is %w", errNotRunning))
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		utility.Go("api-system-update", func() {
+			if err := su.RunUpdate(context.Background()); err != nil {
+				d.logger.Error("System update failed: %v", err)
+			}
+		})
+		writeJSON(w, http.StatusAccepted, api.Result{Message: "System update started. Check status with: daemira system status"})
+		return
+	}
+	if err := su.RunUpdate(context.Background()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, "System update completed")
+}
+
+func (d *Daemira) handleNotionStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.notionStatus())
+}
+
+func (d *Daemira) handleNotionSync(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	ns := d.notionSync
+	d.mu.RUnlock()
+	if ns == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("Notion sync is %w (set notion.sync_paths or notion.vault_path)", errNotRunning))
+		return
+	}
+	if err := ns.SyncAll(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, "Notion sync completed")
+}
+
+func (d *Daemira) handleJobs(w http.ResponseWriter, r *http.Request) {
+	infos := utility.GetScheduler().Jobs()
+	jobs := make([]api.Job, 0, len(infos))
+	for _, info := range infos {
+		jobs = append(jobs, api.Job{
+			ID:           info.ID,
+			Description:  info.Description,
+			Schedule:     info.Schedule,
+			Overridden:   info.Overridden,
+			Enabled:      info.Enabled,
+			Timer:        info.Timer,
+			Running:      info.Running,
+			NextRun:      info.NextRun,
+			LastRun:      info.LastRun,
+			LastDuration: info.LastDuration,
+			LastError:    info.LastError,
+			Runs:         info.Runs,
+		})
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// handleJobRun runs a job now; with wait=true it answers once the job
+// finished. A client giving up doesn't cancel the job.
+func (d *Daemira) handleJobRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	done, err := utility.GetScheduler().RunNow(id)
+	switch {
+	case errors.Is(err, utility.ErrJobRunning):
+		writeError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		writeJSON(w, http.StatusAccepted, api.Result{Message: fmt.Sprintf("Job %s started. Check it with: daemira jobs list", id)})
+		return
+	}
+	if err := <-done; err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeResult(w, fmt.Sprintf("Job %s completed", id))
+}
+
+func (d *Daemira) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := []api.Alert{}
+	for _, alert := range utility.GetAlerts().List() {
+		alerts = append(alerts, apiAlert(alert))
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func (d *Daemira) handleAlertAck(w http.ResponseWriter, r *http.Request) {
+	alert, err := utility.GetAlerts().Acknowledge(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeResult(w, fmt.Sprintf("Acknowledged %s; it won't be sent again unless it gets worse", alert.ID))
+}
+
+func (d *Daemira) handleAlertSilence(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("for"))
+	if err != nil || duration < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", r.URL.Query().Get("for")))
+		return
+	}
+	alert, err := utility.GetAlerts().Silence(r.PathValue("id"), duration)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if duration == 0 {
+		writeResult(w, fmt.Sprintf("%s is no longer silenced", alert.ID))
+		return
+	}
+	writeResult(w, fmt.Sprintf("Silenced %s until %s", alert.ID, alert.SilencedUntil.Local().Format("Jan 2 15:04")))
+}
+
+func (d *Daemira) handleIntegrityAccept(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	running := d.healthMonitor != nil
+	d.mu.RUnlock()
+	if !running {
+		writeError(w, http.StatusConflict, fmt.Errorf("health monitoring is %w", errNotRunning))
+		return
+	}
+
+	accepted, err := systemhealth.GetIntegrityMonitor().Accept(r.Context(), r.URL.Query()["path"])
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if len(accepted) == 1 {
+		writeResult(w, fmt.Sprintf("Accepted %s (%s)", accepted[0].Path, accepted[0].Kind))
+		return
+	}
+	writeResult(w, fmt.Sprintf("Accepted %d changed files", len(accepted)))
+}
+
+// apiAlert converts an alert for the API
+func apiAlert(alert utility.Alert) api.Alert {
+	return api.Alert{
+		ID:            alert.ID,
+		Severity:      alert.Severity,
+		Summary:       alert.Summary,
+		Detail:        alert.Detail,
+		Raised:        alert.Raised,
+		Acknowledged:  alert.Acknowledged,
+		SilencedUntil: alert.SilencedUntil,
+	}
+}
+
+// runningGoogleDrive returns Google Drive sync if it runs
+func (d *Daemira) runningGoogleDrive() (*utility.GoogleDrive, error) {
+	gd := d.GetGoogleDrive()
+	if gd == nil {
+		return nil, fmt.Errorf("Google Drive sync is %w", errNotRunning)
+	}
+	if running, _ := gd.GetStatus()["running"].(bool); !running {
+		return nil, fmt.Errorf("Google Drive sync is %w", errNotRunning)
+	}
+	return gd, nil
+}
+
+// syncsDirectory reports whether dir is one of the synced directories
+func (d *Daemira) syncsDirectory(dir string) bool {
+	for _, directory := range d.gdriveStatus().Directories {
+		if directory.Path == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Daemira) gdriveStatus() api.GDriveStatus {
+	status := api.GDriveStatus{
+		Enabled:     d.GetConfig().GDriveEnabled,
+		Directories: []api.DirectoryStatus{},
+	}
+	gd := d.GetGoogleDrive()
+	if gd == nil {
+		return status
+	}
+
+	gdStatus := gd.GetStatus()
+	status.Running, _ = gdStatus["running"].(bool)
+	status.QueueSize, _ = gdStatus["queueSize"].(int)
+	status.Paused, _ = gdStatus["paused"].(string)
+	if seconds, ok := gdStatus["syncInterval"].(int); ok {
+		status.SyncInterval = time.Duration(seconds) * time.Second
+	}
+	syncStates, _ := gdStatus["syncStates"].(map[string]interface{})
+	for path, value := range syncStates {
+		state, _ := value.(map[string]interface{})
+		directory := api.DirectoryStatus{Path: path}
+		directory.Status, _ = state["status"].(string)
+		directory.LastSync, _ = state["lastSyncTime"].(time.Time)
+		directory.Error, _ = state["errorMessage"].(string)
+		directory.RunLog, _ = state["runLog"].(string)
+		status.Directories = append(status.Directories, directory)
+	}
+	sort.Slice(status.Directories, func(i, j int) bool {
+		return status.Directories[i].Path < status.Directories[j].Path
+	})
+	return status
+}
+
+func (d *Daemira) updateStatus() api.UpdateStatus {
+	status := api.UpdateStatus{
+		Enabled: d.GetConfig().SystemUpdateEnabled,
+		History: []api.UpdateRun{},
+	}
+	su := d.GetSystemUpdate()
+	if su == nil {
+		return status
+	}
+
+	suStatus := su.GetStatus()
+	status.Running, _ = suStatus["running"].(bool)
+	if lastUpdate, ok := suStatus["lastUpdate"].(int64); ok {
+		status.LastUpdate = time.Unix(lastUpdate, 0)
+	}
+	if nextUpdate, ok := suStatus["nextUpdate"].(int64); ok {
+		status.NextUpdate = time.Unix(nextUpdate, 0)
+	}
+	history, _ := suStatus["history"].([]systemupdate.UpdateHistoryEntry)
+	for _, entry := range history {
+		status.History = append(status.History, api.UpdateRun{
+			Time:     entry.Timestamp,
+			Success:  entry.Success,
+			Duration: entry.Duration,
+			Error:    entry.Error,
+			RunLogs:  entry.RunLogs,
+		})
+	}
+	return status
+}
+
+func (d *Daemira) notionStatus() api.NotionStatus {
+	cfg := d.GetConfig()
+	d.mu.RLock()
+	ns := d.notionSync
+	d.mu.RUnlock()
+
+	status := api.NotionStatus{
+		Enabled: cfg.NotionEnabled,
+		Running: ns != nil,
+		Queued:  utility.GetNotionQueue().Len(),
+		Paths:   cfg.NotionSyncPaths,
+	}
+	if ns != nil {
+		status.Paused = ns.Paused()
+	}
+	return status
+}
+
+// writeResult answers an operation that succeeded
+func writeResult(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusOK, api.Result{Message: message})
+}
+
+// writeError answers a request that failed, with secrets masked
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, api.ErrorResponse{Error: utility.Redact(err.Error())})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
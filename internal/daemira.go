@@ -3,7 +3,33 @@
  *
  * Core orchestrator that launches internal features:
  * - Google Drive bidirectional sync
+ * - Notion sync of local notes
+ * - Update and health reports to a Notion database
  * - Automated system updates
+ * - restic/borg backups with retention and checks
+ * - btrfs/snapper snapshots of the home subvolume
+ * - Disk space, SMART, firewall, failed login and config file integrity
+ *   monitoring with alerts
+ * - Limits on the daemon's own CPU, memory, goroutines and open files
+ * - Status reports to a fleet endpoint
+ * - Per Wi-Fi network profiles (sync bandwidth, update pauses, power profile)
+ * - VPN detection, holding syncs while the VPN is down
+ * - USB device monitoring (unknown keyboard alerts, hooks) and backups to
+ *   known external drives when they are plugged in
+ * - Display profile auto-apply
+ * - Window rules
+ * - Workspace reassignment on monitor hotplug
+ * - Idle lock/DPMS/suspend policies
+ * - Session event hooks
+ * - Wallpaper rotation
+ * - Audio output auto-switching
+ * - Bluetooth favorite reconnection
+ * - Application usage tracking
+ * - Do-not-disturb expiry
+ * - Job scheduling (cron schedules, jitter, catch-up after suspend)
+ * - Suspend/resume detection
+ * - Config hot-reload
+ * - Local API for other programs, and for other machines over Tailscale
  */
 
 package daemira
@@ -11,12 +37,23 @@ package daemira
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ln64-git/daemira/src/config"
+	"github.com/ln64-git/daemira/src/features/backup"
+	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/devices"
+	"github.com/ln64-git/daemira/src/features/fleet"
+	"github.com/ln64-git/daemira/src/features/network"
+	notionsync "github.com/ln64-git/daemira/src/features/notion-sync"
+	"github.com/ln64-git/daemira/src/features/snapshots"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
 	systemupdate "github.com/ln64-git/daemira/src/features/system-update"
+	"github.com/ln64-git/daemira/src/features/wallpaper"
 	"github.com/ln64-git/daemira/src/utility"
 )
 
@@ -26,7 +63,28 @@ type Daemira struct {
 	config                 *config.Config
 	googleDrive            *utility.GoogleDrive
 	googleDriveAutoStarted bool
+	notionSync             *notionsync.NotionSync
+	notionReporter         *notionsync.Reporter
 	systemUpdate           *systemupdate.SystemUpdate
+	backup                 *backup.Backup
+	homeSnapshots          *snapshots.HomeSnapshots
+	fleetReporter          *fleet.Reporter
+	healthMonitor          *systemhealth.HealthMonitor
+	displayProfiles        *desktopmonitor.DisplayProfileManager
+	windowRules            *desktopmonitor.WindowRulesEngine
+	workspaceReassigner    *desktopmonitor.WorkspaceReassigner
+	idleManager            *desktopmonitor.IdleManager
+	sessionHooks           *desktopmonitor.SessionHooks
+	wallpaperRotator       *wallpaper.WallpaperRotator
+	usageTracker           *desktopmonitor.UsageTracker
+	powerBeforeNetwork     systemhealth.PowerProfile // restored when leaving a network that changed it
+	networkWatching        bool
+	vpnWatching            bool
+	configWatching         bool
+	waybarStop             chan struct{} // stops the Waybar status file's writer
+	apiServer              *http.Server
+	tailnetServer          *http.Server
+	started                time.Time
 	mu                     sync.RWMutex
 }
 
@@ -41,9 +99,7 @@ func NewDaemira(logger *utility.Logger, cfg *config.Config) *Daemira {
 		cfg, err = config.Load()
 		if err != nil {
 			logger.Warn("Failed to load config: %v, using defaults", err)
-			cfg = &config.Config{
-				RcloneRemoteName: "gdrive",
-			}
+			cfg = config.Default()
 		}
 	}
 
@@ -60,32 +116,218 @@ func NewDaemira(logger *utility.Logger, cfg *config.Config) *Daemira {
 // Start is the default function that chains KeepSystemUpdated and SyncGoogleDrive together
 func (d *Daemira) Start() error {
 	d.logger.Info("Starting Daemira services...")
+	d.mu.Lock()
+	d.started = time.Now()
+	d.mu.Unlock()
+
+	// Actions taken from here on are the daemon's own, not a CLI command's
+	utility.SetAuditInitiator(utility.InitiatorScheduler)
+	// Command timings are saved for `daemira diagnostics`
+	utility.GetMetrics().Persist()
+	// Sync times, update history and job runs are kept across restarts
+	utility.GetStateStore().Persist()
+
+	// Watch for do-not-disturb expiry (restores notifications, runs deferred work)
+	utility.GetDoNotDisturb().Start()
+
+	// Schedule overrides and disabled jobs apply before features add jobs
+	d.applyJobSettings()
+
+	// Jobs missed while the machine slept run (or are skipped) on resume
+	sleep := utility.GetSleepWatcher()
+	sleep.OnResume(utility.GetScheduler().Resumed)
+	sleep.Start()
+
+	// Warn when the daemon itself uses more than it should (a leak in a loop)
+	d.WatchResources()
 
 	// Start system updates
-	if err := d.KeepSystemUpdated(); err != nil {
-		return fmt.Errorf("failed to start system updates: %w", err)
+	if d.featureEnabled("System updates", d.config.SystemUpdateEnabled) {
+		if err := d.KeepSystemUpdated(); err != nil {
+			return fmt.Errorf("failed to start system updates: %w", err)
+		}
+	}
+
+	// Watch disk space, the firewall, failed logins and config files
+	if d.featureEnabled("Health monitoring", d.config.HealthEnabled) {
+		d.MonitorHealth()
+	}
+
+	// Hold syncs while the VPN is down, checked before the syncs start
+	if err := d.WatchVPN(); err != nil {
+		d.logger.Warn("VPN detection disabled: %v", err)
 	}
 
 	// Start Google Drive sync
-	if err := d.SyncGoogleDrive(); err != nil {
-		return fmt.Errorf("failed to start Google Drive sync: %w", err)
+	if d.featureEnabled("Google Drive sync", d.config.GDriveEnabled) {
+		if err := d.SyncGoogleDrive(); err != nil {
+			return fmt.Errorf("failed to start Google Drive sync: %w", err)
+		}
+	}
+
+	// Back up directories (non-fatal, a missing repository password shouldn't stop the daemon)
+	if d.featureEnabled("Backups", d.config.BackupEnabled) {
+		if err := d.BackUpDirectories(); err != nil {
+			d.logger.Warn("Backups disabled: %v", err)
+		}
+	}
+
+	// Snapshot the home subvolume (non-fatal, home may not be on btrfs)
+	if d.featureEnabled("Home snapshots", d.config.SnapshotsEnabled) {
+		if err := d.SnapshotHome(); err != nil {
+			d.logger.Warn("Home snapshots disabled: %v", err)
+		}
+	}
+
+	// Sync notes to Notion (non-fatal, a bad token shouldn't stop the daemon)
+	if d.featureEnabled("Notion sync", d.config.NotionEnabled) {
+		if err := d.SyncNotion(); err != nil {
+			d.logger.Warn("Notion sync disabled: %v", err)
+		}
+		if err := d.ReportToNotion(); err != nil {
+			d.logger.Warn("Notion reports disabled: %v", err)
+		}
+		if err := d.ReplayNotionQueue(); err != nil {
+			d.logger.Warn("Queued Notion writes won't be sent: %v", err)
+		}
+	}
+
+	// Report to the fleet endpoint (non-fatal, a missing secret shouldn't stop the daemon)
+	if d.featureEnabled("Fleet reports", d.config.FleetEnabled) {
+		if err := d.ReportToFleet(); err != nil {
+			d.logger.Warn("Fleet reports disabled: %v", err)
+		}
+	}
+
+	// Report USB devices (non-fatal, udev may be missing in containers)
+	if d.featureEnabled("USB monitoring", d.config.USBEnabled) {
+		if err := d.WatchUSB(); err != nil {
+			d.logger.Warn("USB monitoring disabled: %v", err)
+		} else if err := d.BackUpToDrives(); err != nil {
+			d.logger.Warn("Backups to external drives disabled: %v", err)
+		}
+	}
+
+	// Apply network profiles (non-fatal, NetworkManager may be missing)
+	if err := d.WatchNetwork(); err != nil {
+		d.logger.Warn("Network profiles disabled: %v", err)
 	}
 
+	// Desktop integration
+	if d.featureEnabled("Desktop integration", d.config.DesktopEnabled) {
+		d.startDesktop()
+	}
+
+	// Pick up config changes without a restart
+	d.WatchConfig()
+
+	// Keep the sync status where Waybar can read it
+	d.WriteWaybarStatus()
+
+	// Let other programs drive the daemon (non-fatal, the features run without it)
+	if err := d.ServeAPI(); err != nil {
+		d.logger.Warn("API disabled: %v", err)
+	}
+	// Serve it to the other machines in the tailnet too (non-fatal, Tailscale may be down)
+	if d.config.APITailnet {
+		if err := d.ServeTailnetAPI(); err != nil {
+			d.logger.Warn("Tailnet API disabled: %v", err)
+		}
+	}
+
+	// Tell systemd the daemon is up, and keep its watchdog fed while it isn't hung
+	d.watchLiveness()
+
 	d.logger.Info("Daemira services started successfully")
 	return nil
 }
 
+// applyJobSettings passes the job schedule overrides and disabled jobs to
+// the scheduler
+func (d *Daemira) applyJobSettings() {
+	scheduler := utility.GetScheduler()
+	if schedules, err := d.config.Schedules(); err == nil {
+		scheduler.SetOverrides(schedules)
+	}
+	scheduler.SetDisabled(d.config.JobsDisabled)
+	scheduler.SetCatchUp(d.config.JobsCatchUp)
+	d.applyTimerJobs()
+}
+
+// applyTimerJobs leaves the jobs whose systemd timer is enabled to systemd
+func (d *Daemira) applyTimerJobs() {
+	var timers []string
+	if d.config.JobsSystemdTimers {
+		timers = utility.TimerJobs()
+	}
+	utility.GetScheduler().SetTimerJobs(timers)
+}
+
+// featureEnabled logs a feature switched off in config and reports whether it is on
+func (d *Daemira) featureEnabled(name string, enabled bool) bool {
+	if !enabled {
+		d.logger.Info("%s disabled in config", name)
+	}
+	return enabled
+}
+
+// startDesktop starts the desktop session features; each is optional and
+// failures only disable that feature
+func (d *Daemira) startDesktop() {
+	// Auto-apply display profiles (desktop sessions only)
+	d.WatchDisplayProfiles()
+
+	// Enforce window rules (non-fatal, rules are optional)
+	if err := d.EnforceWindowRules(); err != nil {
+		d.logger.Warn("Window rules disabled: %v", err)
+	}
+
+	// Follow monitor hotplug with workspaces (non-fatal, optional)
+	if err := d.ReassignWorkspaces(); err != nil {
+		d.logger.Warn("Workspace reassignment disabled: %v", err)
+	}
+
+	// Apply idle policies (non-fatal, policies are optional)
+	if err := d.ManageIdle(); err != nil {
+		d.logger.Warn("Idle policies disabled: %v", err)
+	}
+
+	// Run session event hooks (non-fatal, hooks are optional)
+	if err := d.RunSessionHooks(); err != nil {
+		d.logger.Warn("Session hooks disabled: %v", err)
+	}
+
+	// Rotate wallpapers (desktop sessions only)
+	d.RotateWallpapers()
+
+	// Follow headphones/docks for audio output
+	d.SwitchAudioDevices()
+
+	// Reconnect favorite Bluetooth devices in the background
+	d.ReconnectBluetooth()
+
+	// Track application usage (non-fatal, tracking is optional)
+	if err := d.TrackUsage(); err != nil {
+		d.logger.Warn("Usage tracking disabled: %v", err)
+	}
+}
+
 // KeepSystemUpdated starts the system update scheduler
 func (d *Daemira) KeepSystemUpdated() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
 	if d.systemUpdate == nil {
+		interval := d.SystemUpdateInterval()
 		d.systemUpdate = systemupdate.NewSystemUpdate(d.logger, &systemupdate.SystemUpdateOptions{
-			Interval:  6 * time.Hour,
-			AutoStart: true,
+			Interval:      interval,
+			AutoStart:     true,
+			KeyringMaxAge: d.config.SystemUpdateKeyringMaxAge,
 		})
-		d.logger.Info("System update scheduler started (interval: 6 hours)")
+		// The regenerated GRUB entry must keep the expected kernel parameters
+		systemhealth.GetKernelMonitor().SetExpected(d.config.KernelParams)
+		d.systemUpdate.OnBootloaderUpdate(systemhealth.GetKernelMonitor().CheckNextBoot)
+		d.logger.Info("System update scheduler started (interval: %v)", interval)
 	} else {
 		d.logger.Info("System update scheduler already running")
 	}
@@ -93,14 +335,287 @@ func (d *Daemira) KeepSystemUpdated() error {
 	return nil
 }
 
-// SyncGoogleDrive starts Google Drive sync service
-func (d *Daemira) SyncGoogleDrive() error {
-	// Skip if running as root - rclone config is user-specific
-	if os.Geteuid() == 0 {
-		d.logger.Info("Skipping Google Drive sync (running as root - rclone config is user-specific)")
+// SystemUpdateInterval returns the configured update interval, default 6 hours
+func (d *Daemira) SystemUpdateInterval() time.Duration {
+	if d.config.SystemUpdateInterval <= 0 {
+		return 6 * time.Hour
+	}
+	return d.config.SystemUpdateInterval
+}
+
+// MonitorHealth starts periodic disk space, firewall, failed login, config
+// file, SSH key, boot time and kernel checks with the configured thresholds
+func (d *Daemira) MonitorHealth() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.healthMonitor != nil {
+		return
+	}
+
+	systemhealth.GetDiskMonitor().SetThresholds(d.config.DiskWarnFree.Bytes(), d.config.DiskCriticalFree.Bytes())
+	systemhealth.GetSecurityMonitor().SetLoginPolicy(d.LoginPolicy())
+	systemhealth.GetIntegrityMonitor().SetPaths(d.config.GetSecurityIntegrityPaths())
+	systemhealth.GetSSHMonitor().SetOptions(d.SSHOptions())
+	systemhealth.GetBootMonitor().SetRegression(d.config.BootRegression)
+	systemhealth.GetKernelMonitor().SetExpected(d.config.KernelParams)
+	d.healthMonitor = systemhealth.NewHealthMonitor(d.logger, &systemhealth.HealthMonitorOptions{
+		Interval: d.config.MonitorInterval,
+	})
+	d.healthMonitor.Start()
+}
+
+// SSHOptions returns what the SSH key check expects
+func (d *Daemira) SSHOptions() systemhealth.SSHOptions {
+	return systemhealth.SSHOptions{
+		AgentKeys: d.config.SecuritySSHAgentKeys,
+		MaxKeyAge: d.config.SecuritySSHKeyMaxAge,
+		CertWarn:  d.config.SecuritySSHCertWarn,
+	}
+}
+
+// LoginPolicy returns when failed logins are reported and blocked
+func (d *Daemira) LoginPolicy() systemhealth.LoginPolicy {
+	return systemhealth.LoginPolicy{
+		Threshold:     d.config.SecurityFailedLoginThreshold,
+		Window:        d.config.SecurityFailedLoginWindow,
+		Block:         d.config.SecurityBlock,
+		BlockDuration: d.config.SecurityBlockDuration,
+		Allowlist:     d.config.SecurityAllowlist,
+	}
+}
+
+// WatchResources samples the daemon's own resource usage every minute,
+// warning past the configured limits
+func (d *Daemira) WatchResources() {
+	monitor := utility.GetResourceMonitor()
+	monitor.SetLimits(d.ResourceLimits())
+	monitor.Start()
+}
+
+// ResourceLimits returns the configured limits on the daemon's own usage
+func (d *Daemira) ResourceLimits() utility.ResourceLimits {
+	return utility.ResourceLimits{
+		MaxCPUPercent: float64(d.config.DiagnosticsMaxCPU),
+		MaxRSS:        d.config.DiagnosticsMaxMemory.Bytes(),
+		MaxGoroutines: d.config.DiagnosticsMaxGoroutines,
+		MaxFDs:        d.config.DiagnosticsMaxOpenFiles,
+		HeapProfile:   d.config.DiagnosticsHeapProfile,
+	}
+}
+
+// WatchUSB reports USB devices coming and going
+func (d *Daemira) WatchUSB() error {
+	monitor := devices.GetUsbMonitor()
+	monitor.SetPolicy(d.USBPolicy())
+	return monitor.Start()
+}
+
+// BackUpToDrives backs up to the configured external drives when they are
+// plugged in
+func (d *Daemira) BackUpToDrives() error {
+	if len(d.config.USBDrives) == 0 {
+		return nil
+	}
+	options, err := d.DriveOptions()
+	if err != nil {
+		return err
+	}
+	drives := devices.GetDriveManager()
+	drives.SetOptions(options)
+	drives.Start()
+	return nil
+}
+
+// DriveOptions returns the external drives to back up to and what goes on them
+func (d *Daemira) DriveOptions() (devices.DriveOptions, error) {
+	rules, err := devices.ParseDriveRules(d.config.USBDrives)
+	if err != nil {
+		return devices.DriveOptions{}, err
+	}
+	return devices.DriveOptions{
+		Drives:      rules,
+		Directories: d.config.GetBackupDirectories(),
+		Excludes:    d.config.BackupExcludes,
+		NewBackup:   d.newBackupTo,
+	}, nil
+}
+
+// WatchNetwork applies the network profiles as the Wi-Fi network changes,
+// if any are configured. The caller must not hold mu: changes are applied
+// under it.
+func (d *Daemira) WatchNetwork() error {
+	d.mu.RLock()
+	rules, hook := d.config.NetworkProfiles, d.config.NetworkHook
+	d.mu.RUnlock()
+
+	if len(rules) == 0 && hook == "" {
+		return nil
+	}
+	profiles, err := network.ParseNetworkProfiles(rules)
+	if err != nil {
+		return err
+	}
+	monitor := network.GetNetworkMonitor()
+	if !monitor.IsAvailable() {
+		return fmt.Errorf("nmcli not found (network profiles need NetworkManager)")
+	}
+	monitor.SetProfiles(profiles, hook)
+
+	// Reloads start the monitor again, but the callback is registered once
+	d.mu.Lock()
+	register := !d.networkWatching
+	d.networkWatching = true
+	d.mu.Unlock()
+	if register {
+		monitor.OnChange(d.applyNetworkProfile)
+	}
+	return monitor.Start()
+}
+
+// applyNetworkProfile caps sync bandwidth, pauses updates and switches the
+// power profile as a network profile says, undoing what the last one did
+func (d *Daemira) applyNetworkProfile(current network.Network, profile *network.NetworkProfile) {
+	if profile == nil {
+		profile = &network.NetworkProfile{}
+	}
+
+	d.mu.Lock()
+	gd, su := d.googleDrive, d.systemUpdate
+	restore := d.powerBeforeNetwork
+	d.mu.Unlock()
+
+	if gd != nil {
+		gd.SetBandwidthLimit(profile.BandwidthLimit)
+	}
+	if su != nil {
+		if profile.PauseUpdates {
+			su.Pause("on network " + current.String())
+		} else {
+			su.Resume()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	pm := systemhealth.GetPerformanceManager()
+	switch {
+	case profile.PowerProfile != "":
+		if restore == "" {
+			if previous, err := pm.GetCurrentProfile(ctx); err == nil {
+				restore = previous
+			}
+		}
+		if err := pm.SetProfile(ctx, systemhealth.PowerProfile(profile.PowerProfile)); err != nil {
+			d.logger.Warn("Failed to switch the power profile for network %s: %v", current, err)
+		}
+	case restore != "":
+		if err := pm.SetProfile(ctx, restore); err != nil {
+			d.logger.Warn("Failed to restore the power profile: %v", err)
+		}
+		restore = ""
+	}
+
+	d.mu.Lock()
+	d.powerBeforeNetwork = restore
+	d.mu.Unlock()
+}
+
+// vpnPause is why syncs are held while no VPN is up
+const vpnPause = "no VPN up"
+
+// vpnRequired reports whether a sync (gdrive or notion) is held while no
+// VPN is up
+func (d *Daemira) vpnRequired(name string) bool {
+	for _, required := range d.config.VPNRequiredFor {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+// vpnDown reports whether a sync needing the VPN should be held now
+func (d *Daemira) vpnDown(name string) bool {
+	return d.vpnRequired(name) && !network.GetVPNWatcher().IsUp()
+}
+
+// WatchVPN holds the syncs in vpn.required_for while no VPN is up, if any
+// are listed. The caller must not hold mu: the first check runs the
+// callbacks, which take it.
+func (d *Daemira) WatchVPN() error {
+	d.mu.RLock()
+	names, required := d.config.VPNNames, d.config.VPNRequiredFor
+	d.mu.RUnlock()
+
+	watcher := network.GetVPNWatcher()
+	watcher.SetNames(names)
+	if len(required) == 0 {
+		if watcher.IsRunning() {
+			// Nothing needs the VPN any more: let the held syncs run
+			watcher.Stop()
+			d.applyVPN(true, network.VPNStatus{})
+		}
+		return nil
+	}
+
+	d.mu.Lock()
+	register := !d.vpnWatching
+	d.vpnWatching = true
+	d.mu.Unlock()
+	if register {
+		watcher.OnChange(d.applyVPN)
+	}
+	if watcher.IsRunning() {
+		go watcher.Check(context.Background())
 		return nil
 	}
+	watcher.Start()
+	return nil
+}
+
+// applyVPN pauses or resumes the syncs needing the VPN as it goes down or up
+func (d *Daemira) applyVPN(up bool, status network.VPNStatus) {
+	d.mu.RLock()
+	gd, ns := d.googleDrive, d.notionSync
+	required := d.config.VPNRequiredFor
+	d.mu.RUnlock()
+
+	if gd != nil {
+		if d.vpnDown("gdrive") {
+			gd.Pause(vpnPause)
+		} else {
+			gd.Resume()
+		}
+	}
+	if ns != nil {
+		if d.vpnDown("notion") {
+			ns.Pause(vpnPause)
+		} else {
+			ns.Resume()
+		}
+	}
+
+	alerts := utility.GetAlerts()
+	if up || len(required) == 0 {
+		alerts.Resolve("vpn-down")
+		return
+	}
+	alerts.Raise("vpn-down", utility.AlertWarning, "VPN down",
+		fmt.Sprintf("Holding %s sync until a VPN is up", strings.Join(required, " and ")))
+}
+
+// USBPolicy returns what happens when USB devices come and go
+func (d *Daemira) USBPolicy() devices.UsbPolicy {
+	return devices.UsbPolicy{
+		Notify:               d.config.USBNotify,
+		WarnUnknownKeyboards: d.config.USBWarnUnknownKeyboards,
+		Hook:                 d.config.USBHook,
+	}
+}
 
+// SyncGoogleDrive starts Google Drive sync service
+func (d *Daemira) SyncGoogleDrive() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -118,6 +633,17 @@ func (d *Daemira) SyncGoogleDrive() error {
 		remoteName = "gdrive"
 	}
 	gd := utility.NewGoogleDrive(d.logger, remoteName)
+	if len(d.config.RcloneExcludes) > 0 {
+		gd.SetExcludePatterns(d.config.RcloneExcludes)
+	}
+	// Syncs started on a capped network are capped too
+	if _, profile := network.GetNetworkMonitor().Current(); profile != nil {
+		gd.SetBandwidthLimit(profile.BandwidthLimit)
+	}
+	// Syncs needing the VPN wait for it
+	if d.vpnDown("gdrive") {
+		gd.Pause(vpnPause)
+	}
 
 	ctx := context.Background()
 	if err := gd.Start(ctx); err != nil {
@@ -130,6 +656,450 @@ func (d *Daemira) SyncGoogleDrive() error {
 	return nil
 }
 
+// BackupRetention returns the configured snapshot retention
+func (d *Daemira) BackupRetention() backup.Retention {
+	return backup.Retention{
+		Daily:   d.config.BackupKeepDaily,
+		Weekly:  d.config.BackupKeepWeekly,
+		Monthly: d.config.BackupKeepMonthly,
+	}
+}
+
+// NewBackup creates a backup of the configured directories to the
+// configured repository, resolving its password
+func (d *Daemira) NewBackup(ctx context.Context) (*backup.Backup, error) {
+	if d.config.BackupRepository == "" {
+		return nil, fmt.Errorf("no repository configured (set backup.repository)")
+	}
+	return d.newBackupTo(ctx, d.config.BackupRepository, "")
+}
+
+// newBackupTo creates a backup of the configured directories to a
+// repository, saving its status in a state store section ("" for the
+// configured repository's)
+func (d *Daemira) newBackupTo(ctx context.Context, repository, state string) (*backup.Backup, error) {
+	password, err := d.config.Secret(ctx, "backup.password")
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, fmt.Errorf("backup.password is not set")
+	}
+
+	return backup.NewBackup(d.logger, &backup.BackupOptions{
+		Tool:          d.config.BackupTool,
+		Repository:    repository,
+		Password:      password,
+		Directories:   d.config.GetBackupDirectories(),
+		Excludes:      d.config.BackupExcludes,
+		Interval:      d.config.BackupInterval,
+		CheckInterval: d.config.BackupCheckInterval,
+		Retention:     d.BackupRetention(),
+		State:         state,
+	})
+}
+
+// BackUpDirectories starts periodic backups if a repository is configured
+func (d *Daemira) BackUpDirectories() error {
+	if d.config.BackupRepository == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.backup != nil {
+		return nil
+	}
+
+	b, err := d.NewBackup(context.Background())
+	if err != nil {
+		return err
+	}
+	b.Start()
+	d.backup = b
+	return nil
+}
+
+// SnapshotRetention returns the configured home snapshot retention
+func (d *Daemira) SnapshotRetention() snapshots.Retention {
+	return snapshots.Retention{
+		Hourly: d.config.SnapshotsKeepHourly,
+		Daily:  d.config.SnapshotsKeepDaily,
+		Weekly: d.config.SnapshotsKeepWeekly,
+	}
+}
+
+// NewHomeSnapshots creates snapshots of the home subvolume with the
+// configured backend
+func (d *Daemira) NewHomeSnapshots(ctx context.Context) (*snapshots.HomeSnapshots, error) {
+	return snapshots.NewHomeSnapshots(ctx, d.logger, &snapshots.SnapshotOptions{
+		Backend:       d.config.SnapshotsBackend,
+		Subvolume:     d.config.SnapshotsSubvolume,
+		SnapperConfig: d.config.SnapshotsSnapperConfig,
+		Interval:      d.config.SnapshotsInterval,
+		Retention:     d.SnapshotRetention(),
+	})
+}
+
+// SnapshotHome starts periodic snapshots of the home subvolume
+func (d *Daemira) SnapshotHome() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.homeSnapshots != nil {
+		return nil
+	}
+
+	hs, err := d.NewHomeSnapshots(context.Background())
+	if err != nil {
+		return err
+	}
+	hs.Start()
+	d.homeSnapshots = hs
+	return nil
+}
+
+// NewNotionClient creates a Notion API client, resolving the configured token
+func (d *Daemira) NewNotionClient(ctx context.Context) (*utility.Notion, error) {
+	token, err := d.config.Secret(ctx, "notion.token")
+	if err != nil {
+		return nil, err
+	}
+
+	options := &utility.NotionOptions{}
+	switch d.config.NotionAttachments {
+	case "off":
+		options.NoAttachments = true
+	case "drive":
+		options.AttachmentLink = d.driveLinker()
+	}
+	return utility.NewNotion(token, d.logger, options)
+}
+
+// driveLinker returns a function giving public links to the Google Drive
+// copies of files in synced directories
+func (d *Daemira) driveLinker() func(ctx context.Context, path string) (string, error) {
+	var offline *utility.GoogleDrive
+	var once sync.Once
+	return func(ctx context.Context, path string) (string, error) {
+		if gd := d.GetGoogleDrive(); gd != nil {
+			return gd.Link(ctx, path)
+		}
+
+		// Not syncing in this process (e.g. the CLI); the default
+		// directories are the ones the daemon syncs
+		once.Do(func() {
+			remoteName := d.config.RcloneRemoteName
+			if remoteName == "" {
+				remoteName = "gdrive"
+			}
+			offline = utility.NewGoogleDrive(d.logger, remoteName)
+			_ = offline.SetupDefaultDirectories()
+		})
+		return offline.Link(ctx, path)
+	}
+}
+
+// NewNotionSync creates a Notion sync of the configured paths and vault,
+// resolving the token
+func (d *Daemira) NewNotionSync(ctx context.Context) (*notionsync.NotionSync, error) {
+	if len(d.config.NotionSyncPaths) == 0 && d.config.NotionVaultPath == "" {
+		return nil, fmt.Errorf("nothing to sync (set notion.sync_paths or notion.vault_path)")
+	}
+	targets, err := notionsync.ParseTargets(d.config.NotionSyncPaths, d.config.NotionPageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.NewNotionClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var vault *notionsync.Vault
+	if d.config.NotionVaultPath != "" {
+		if vault, err = notionsync.NewVault(d.logger, client, d.config.NotionVaultPath, d.config.NotionVaultDatabaseID); err != nil {
+			return nil, err
+		}
+	}
+
+	return notionsync.NewNotionSync(d.logger, client, targets, &notionsync.NotionSyncOptions{
+		Interval: d.config.NotionSyncInterval,
+		Vault:    vault,
+	}), nil
+}
+
+// SyncNotion starts syncing the configured paths and vault with Notion if
+// there are any
+func (d *Daemira) SyncNotion() error {
+	if len(d.config.NotionSyncPaths) == 0 && d.config.NotionVaultPath == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.notionSync != nil {
+		return nil
+	}
+
+	ns, err := d.NewNotionSync(context.Background())
+	if err != nil {
+		return err
+	}
+	if d.vpnDown("notion") {
+		ns.Pause(vpnPause)
+	}
+	ns.Start()
+	d.notionSync = ns
+	return nil
+}
+
+// ReplayNotionQueue sends the Notion writes queued while Notion couldn't be
+// reached, checking every minute while any wait
+func (d *Daemira) ReplayNotionQueue() error {
+	client, err := d.NewNotionClient(context.Background())
+	if err != nil {
+		return err
+	}
+	utility.GetNotionQueue().Start(client)
+	return nil
+}
+
+// WatchDisplayProfiles applies saved display profiles when a matching monitor set is connected
+func (d *Daemira) WatchDisplayProfiles() {
+	if !desktopmonitor.GetDisplayMonitor().IsAvailable() {
+		d.logger.Info("Skipping display profile watcher (no supported compositor detected)")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.displayProfiles == nil {
+		d.displayProfiles = desktopmonitor.GetDisplayProfileManager()
+		d.displayProfiles.Start(5 * time.Second)
+	}
+}
+
+// EnforceWindowRules starts the window rules engine if any rules are configured
+func (d *Daemira) EnforceWindowRules() error {
+	if len(d.config.DesktopWindowRules) == 0 {
+		return nil
+	}
+
+	rules, err := desktopmonitor.ParseWindowRules(d.config.DesktopWindowRules)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.windowRules != nil && d.windowRules.IsRunning() {
+		return nil
+	}
+
+	engine := desktopmonitor.NewWindowRulesEngine(d.logger, rules)
+	if err := engine.Start(); err != nil {
+		return err
+	}
+	d.windowRules = engine
+	return nil
+}
+
+// ReassignWorkspaces moves workspaces between outputs on monitor hotplug if enabled or rules are configured
+func (d *Daemira) ReassignWorkspaces() error {
+	if !d.config.DesktopHotplugReassign && len(d.config.DesktopWorkspaceOutputs) == 0 {
+		return nil
+	}
+
+	rules, err := desktopmonitor.ParseWorkspaceOutputRules(d.config.DesktopWorkspaceOutputs)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.workspaceReassigner != nil {
+		return nil
+	}
+
+	reassigner := desktopmonitor.NewWorkspaceReassigner(d.logger, rules)
+	if err := reassigner.Start(); err != nil {
+		return err
+	}
+	d.workspaceReassigner = reassigner
+	return nil
+}
+
+// IdlePolicy returns the configured idle policy
+func (d *Daemira) IdlePolicy() (desktopmonitor.IdlePolicy, error) {
+	return desktopmonitor.ParseIdlePolicy(
+		d.config.DesktopIdleLockAfter,
+		d.config.DesktopIdleDPMSAfter,
+		d.config.DesktopIdleSuspendAfter,
+	)
+}
+
+// ManageIdle starts the idle manager if any idle action is configured
+func (d *Daemira) ManageIdle() error {
+	policy, err := d.IdlePolicy()
+	if err != nil {
+		return err
+	}
+	if !policy.IsEnabled() {
+		return nil
+	}
+	if os.Getenv("XDG_SESSION_ID") == "" {
+		return fmt.Errorf("not running inside a login session")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.idleManager == nil {
+		d.idleManager = desktopmonitor.NewIdleManager(d.logger, policy)
+		d.idleManager.Start()
+	}
+	return nil
+}
+
+// SessionHooks returns the configured session event hooks
+func (d *Daemira) SessionHooks() map[desktopmonitor.SessionEvent]string {
+	return map[desktopmonitor.SessionEvent]string{
+		desktopmonitor.EventLock:            d.config.DesktopHookLock,
+		desktopmonitor.EventUnlock:          d.config.DesktopHookUnlock,
+		desktopmonitor.EventIdle:            d.config.DesktopHookIdle,
+		desktopmonitor.EventActive:          d.config.DesktopHookActive,
+		desktopmonitor.EventMonitorAdded:    d.config.DesktopHookMonitorAdded,
+		desktopmonitor.EventMonitorRemoved:  d.config.DesktopHookMonitorRemoved,
+		desktopmonitor.EventWorkspaceChange: d.config.DesktopHookWorkspaceChange,
+	}
+}
+
+// RunSessionHooks starts watching for desktop events if any hook is configured
+func (d *Daemira) RunSessionHooks() error {
+	hooks := desktopmonitor.NewSessionHooks(d.logger, d.SessionHooks())
+	if !hooks.IsConfigured() {
+		return nil
+	}
+	if os.Getenv("XDG_SESSION_ID") == "" {
+		return fmt.Errorf("not running inside a login session")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sessionHooks == nil {
+		d.sessionHooks = hooks
+		d.sessionHooks.Start()
+	}
+	return nil
+}
+
+// WallpaperOptions returns the wallpaper rotator options from config
+func (d *Daemira) WallpaperOptions() *wallpaper.WallpaperOptions {
+	interval, err := time.ParseDuration(d.config.WallpaperInterval)
+	if err != nil && d.config.WallpaperInterval != "" && d.config.WallpaperInterval != "0" {
+		d.logger.Warn("Invalid WALLPAPER_INTERVAL %q, rotating on light/dark changes only", d.config.WallpaperInterval)
+	}
+
+	return &wallpaper.WallpaperOptions{
+		Directory:      d.config.WallpaperDir,
+		LightDirectory: d.config.WallpaperLightDir,
+		DarkDirectory:  d.config.WallpaperDarkDir,
+		Interval:       interval,
+		Backend:        wallpaper.Backend(d.config.WallpaperBackend),
+		LightStart:     d.config.WallpaperLightStart,
+		DarkStart:      d.config.WallpaperDarkStart,
+	}
+}
+
+// RotateWallpapers starts the wallpaper rotator if a wallpaper directory is configured
+func (d *Daemira) RotateWallpapers() {
+	if os.Getenv("WAYLAND_DISPLAY") == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.wallpaperRotator != nil {
+		return
+	}
+
+	rotator := wallpaper.NewWallpaperRotator(d.logger, d.WallpaperOptions())
+	if !rotator.IsConfigured() {
+		return
+	}
+	rotator.Start()
+	d.wallpaperRotator = rotator
+}
+
+// SwitchAudioDevices starts audio output auto-switching if enabled
+func (d *Daemira) SwitchAudioDevices() {
+	if !d.config.AudioAutoSwitch {
+		return
+	}
+
+	am := desktopmonitor.GetAudioMonitor()
+	if !am.IsAvailable(context.Background()) {
+		d.logger.Info("Skipping audio auto-switch (no sound server reachable)")
+		return
+	}
+	am.StartAutoSwitch(d.config.AudioPreferredSinks)
+}
+
+// ReconnectBluetooth connects favorite Bluetooth devices, retrying for a few minutes while they come into range
+func (d *Daemira) ReconnectBluetooth() {
+	if len(d.config.BluetoothFavorites) == 0 {
+		return
+	}
+
+	utility.Go("bluetooth-reconnect", func() {
+		desktopmonitor.GetBluetoothMonitor().ReconnectFavorites(context.Background(), d.config.BluetoothFavorites, 10)
+	})
+}
+
+// UsageOptions returns the usage tracker options from config
+func (d *Daemira) UsageOptions() *desktopmonitor.UsageOptions {
+	return &desktopmonitor.UsageOptions{
+		Exclude:      d.config.UsageExclude,
+		RecordTitles: d.config.UsageRecordTitles,
+	}
+}
+
+// TrackUsage starts recording time spent per application if enabled
+func (d *Daemira) TrackUsage() error {
+	if !d.config.UsageTracking {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.usageTracker != nil {
+		return nil
+	}
+
+	tracker := desktopmonitor.NewUsageTracker(d.logger, d.UsageOptions())
+	if err := tracker.Start(); err != nil {
+		return err
+	}
+	d.usageTracker = tracker
+	return nil
+}
+
+// GetConfig returns the loaded configuration (for CLI access)
+func (d *Daemira) GetConfig() *config.Config {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.config
+}
+
 // GetGoogleDrive returns the GoogleDrive instance (for CLI access)
 func (d *Daemira) GetGoogleDrive() *utility.GoogleDrive {
 	d.mu.RLock()
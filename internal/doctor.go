@@ -0,0 +1,464 @@
+/**
+ * Doctor - self-diagnostics
+ * Checks what daemira needs outside itself: the programs it runs, root
+ * access through sudo and polkit, a valid config, the sockets it talks to
+ * and the services it syncs with. Every failed check says how to fix it;
+ * what only affects an optional or disabled feature is a warning.
+ */
+
+package daemira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/config"
+	"github.com/ln64-git/daemira/src/features/backup"
+	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/fleet"
+	"github.com/ln64-git/daemira/src/features/snapshots"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Outcomes of a check
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning" // an optional or disabled feature is affected
+	CheckFailed  = "failed"
+)
+
+// DoctorCheck is the outcome of one check
+type DoctorCheck struct {
+	Group  string // Dependencies, Privileges, Config, Sockets or Connectivity
+	Name   string
+	Status string // CheckOK, CheckWarning or CheckFailed
+	Detail string
+	Fix    string // what to do about a warning or failure
+}
+
+// doctorTool is a program daemira runs
+type doctorTool struct {
+	name     string
+	usedBy   string
+	needed   bool // whether a feature that is on fails without it
+	fix      string
+	optional bool // whether it is only needed in some setups (e.g. under Hyprland)
+}
+
+// socketTimeout is how long a socket has to accept a connection
+const socketTimeout = 2 * time.Second
+
+// Doctor runs every check, in groups
+func (d *Daemira) Doctor(ctx context.Context) []DoctorCheck {
+	var checks []DoctorCheck
+	checks = append(checks, d.checkDependencies()...)
+	checks = append(checks, d.checkPrivileges(ctx)...)
+	checks = append(checks, d.checkConfig(ctx)...)
+	checks = append(checks, d.checkSockets()...)
+	checks = append(checks, d.checkConnectivity(ctx)...)
+	return checks
+}
+
+// checkDependencies looks for the programs each feature runs
+func (d *Daemira) checkDependencies() []DoctorCheck {
+	hyprland := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != ""
+	backups := d.config.BackupEnabled && d.config.BackupRepository != ""
+	snapper := d.config.SnapshotsEnabled && d.config.SnapshotsBackend == snapshots.BackendSnapper
+	drives := d.config.USBEnabled && len(d.config.USBDrives) > 0
+	networkProfiles := len(d.config.NetworkProfiles) > 0 || d.config.NetworkHook != ""
+	vpn := len(d.config.VPNRequiredFor) > 0
+	tools := []doctorTool{
+		{name: "rclone", usedBy: "Google Drive sync", needed: d.config.GDriveEnabled, fix: "sudo pacman -S rclone"},
+		{name: "pacman", usedBy: "system updates", needed: d.config.SystemUpdateEnabled, fix: "System updates need Arch Linux or a derivative; elsewhere set system_update.enabled = false"},
+		{name: "yay", usedBy: "AUR updates", needed: d.config.SystemUpdateEnabled, fix: "git clone https://aur.archlinux.org/yay-bin.git && cd yay-bin && makepkg -si"},
+		{name: d.config.BackupTool, usedBy: "backups", needed: backups, fix: "sudo pacman -S " + d.config.BackupTool, optional: !backups},
+		{name: "btrfs", usedBy: "home snapshots", needed: d.config.SnapshotsEnabled, fix: "sudo pacman -S btrfs-progs", optional: !d.config.SnapshotsEnabled},
+		{name: "snapper", usedBy: "home snapshots with snapper", needed: snapper, fix: "sudo pacman -S snapper && sudo snapper -c home create-config /home", optional: !snapper},
+		{name: "rsync", usedBy: "rolling back raw btrfs snapshots and syncing to external drives", fix: "sudo pacman -S rsync", optional: !d.config.SnapshotsEnabled && !drives},
+		{name: "smartctl", usedBy: "SMART health checks", fix: "sudo pacman -S smartmontools"},
+		{name: "ssh-keygen", usedBy: "SSH key and certificate checks", fix: "sudo pacman -S openssh"},
+		{name: "powerprofilesctl", usedBy: "power profiles", fix: "sudo pacman -S power-profiles-daemon && sudo systemctl enable --now power-profiles-daemon"},
+		{name: "hyprctl", usedBy: "Hyprland desktop features", needed: d.config.DesktopEnabled && hyprland, fix: "hyprctl comes with Hyprland: sudo pacman -S hyprland", optional: !hyprland},
+		{name: "loginctl", usedBy: "session locking and idle actions", needed: d.config.DesktopEnabled, fix: "loginctl comes with systemd; daemira's desktop features need a systemd-logind session"},
+		{name: "nmcli", usedBy: "network profiles", needed: networkProfiles, fix: "sudo pacman -S networkmanager && sudo systemctl enable --now NetworkManager", optional: !networkProfiles},
+		{name: "ip", usedBy: "telling whether all traffic goes through the VPN", needed: vpn, fix: "sudo pacman -S iproute2", optional: !vpn},
+		{name: "tailscale", usedBy: "Tailscale VPN detection and the tailnet API", needed: d.config.APITailnet, fix: "sudo pacman -S tailscale && sudo systemctl enable --now tailscaled && sudo tailscale up", optional: !d.config.APITailnet},
+		{name: "udisksctl", usedBy: "mounting external drives to back up to", needed: drives, fix: "sudo pacman -S udisks2", optional: !drives},
+		{name: "udevadm", usedBy: "USB device monitoring", needed: d.config.USBEnabled, fix: "udevadm comes with systemd; elsewhere set usb.enabled = false", optional: !d.config.USBEnabled},
+		{name: "fwupdmgr", usedBy: "firmware updates", fix: "sudo pacman -S fwupd"},
+		{name: "gdbus", usedBy: "noticing suspend and resume at once (otherwise within 30s)", fix: "gdbus comes with GLib: sudo pacman -S glib2"},
+	}
+
+	var checks []DoctorCheck
+	for _, tool := range tools {
+		check := DoctorCheck{Group: "Dependencies", Name: tool.name}
+		path, err := exec.LookPath(tool.name)
+		switch {
+		case err == nil:
+			check.Status = CheckOK
+			check.Detail = path
+		case tool.optional:
+			check.Status = CheckOK
+			check.Detail = "not installed, only needed for " + tool.usedBy
+		default:
+			check.Status = CheckWarning
+			if tool.needed {
+				check.Status = CheckFailed
+			}
+			check.Detail = "not found; needed for " + tool.usedBy
+			check.Fix = tool.fix
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkPrivileges checks the root helper and sudo for system updates and
+// snapshots, and polkit for suspending and power profiles
+func (d *Daemira) checkPrivileges(ctx context.Context) []DoctorCheck {
+	var checks []DoctorCheck
+
+	privileges := utility.GetPrivilegeManager()
+	helper := DoctorCheck{Group: "Privileges", Name: "root helper", Status: CheckOK, Detail: "running; system updates, TRIM and DKMS go through it"}
+	helperRunning := false
+	if !utility.RootHelperInstalled() {
+		helper.Detail = "not installed; " + privileges.Route()
+	} else if err := utility.PingRootHelper(ctx); err != nil {
+		helper.Status = CheckFailed
+		helper.Detail = fmt.Sprintf("not answering: %v", err)
+		helper.Fix = "sudo systemctl restart " + utility.RootHelperUnit
+	} else {
+		helperRunning = true
+	}
+	checks = append(checks, helper)
+
+	sudo := DoctorCheck{Group: "Privileges", Name: "sudo", Status: CheckOK, Detail: "runs without a password"}
+	if err := privileges.Validate(ctx); err != nil {
+		sudo.Status = CheckWarning
+		sudo.Detail = fmt.Sprintf("system updates and home snapshots can't run as root: %v", err)
+		if helperRunning {
+			sudo.Detail = fmt.Sprintf("home snapshots can't run as root: %v", err)
+		}
+		if (d.config.SystemUpdateEnabled && !helperRunning) || d.config.SnapshotsEnabled {
+			sudo.Status = CheckFailed
+		}
+		sudo.Fix = sudoFix()
+	}
+	checks = append(checks, sudo)
+
+	polkit := DoctorCheck{Group: "Privileges", Name: "polkit", Status: CheckOK}
+	if backend, err := d.busctl(ctx, "get-property", "org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority", "org.freedesktop.PolicyKit1.Authority", "BackendName"); err != nil {
+		polkit.Status = CheckWarning
+		polkit.Detail = fmt.Sprintf("authority not reachable: %v", err)
+		polkit.Fix = "sudo pacman -S polkit; suspending, power profiles and session locks go through it"
+	} else {
+		polkit.Detail = "authority running (" + strings.Trim(strings.TrimPrefix(backend, "s "), `"`) + ")"
+	}
+	checks = append(checks, polkit)
+
+	if d.config.DesktopEnabled && d.config.DesktopIdleSuspendAfter != "" && d.config.DesktopIdleSuspendAfter != "0" {
+		suspend := DoctorCheck{Group: "Privileges", Name: "suspend", Status: CheckOK, Detail: "allowed without authentication"}
+		answer, err := d.busctl(ctx, "call", "org.freedesktop.login1", "/org/freedesktop/login1", "org.freedesktop.login1.Manager", "CanSuspend")
+		answer = strings.Trim(strings.TrimPrefix(answer, "s "), `"`)
+		if err != nil || answer != "yes" {
+			suspend.Status = CheckFailed
+			suspend.Detail = fmt.Sprintf("desktop.idle.suspend_after is set but logind answers %q to CanSuspend", answer)
+			if err != nil {
+				suspend.Detail = fmt.Sprintf("desktop.idle.suspend_after is set but logind can't be asked: %v", err)
+			}
+			suspend.Fix = "Allow org.freedesktop.login1.suspend for your user in a polkit rule under /etc/polkit-1/rules.d, or unset desktop.idle.suspend_after"
+		}
+		checks = append(checks, suspend)
+	}
+	return checks
+}
+
+// sudoFix explains how to let daemira run commands as root. Passwordless
+// sudo for the daemira binary alone wouldn't: the daemon runs pacman,
+// btrfs and the like through sudo, not itself, and a binary the user can
+// replace would hand root to anything running as them.
+func sudoFix() string {
+	return "Install the root helper (`daemira helper install`) for system updates, or run the daemon as root (`sudo daemira`); home snapshots need passwordless sudo for btrfs, snapper and rsync (`sudo visudo`)"
+}
+
+// busctl asks a system bus service for something and returns the answer
+func (d *Daemira) busctl(ctx context.Context, args ...string) (string, error) {
+	if _, err := exec.LookPath("busctl"); err != nil {
+		return "", fmt.Errorf("busctl not found")
+	}
+	result, err := utility.NewShell(d.logger).ExecuteArgs(ctx, "busctl", append([]string{"--system"}, args...), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", errors.New(strings.TrimSpace(result.Stderr))
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// checkConfig loads the config files afresh and resolves the secrets the
+// enabled features use
+func (d *Daemira) checkConfig(ctx context.Context) []DoctorCheck {
+	var checks []DoctorCheck
+
+	valid := DoctorCheck{Group: "Config", Name: "config files", Status: CheckOK}
+	cfg, err := config.Load()
+	if err != nil {
+		valid.Status = CheckFailed
+		valid.Detail = err.Error()
+		valid.Fix = "Fix the setting named above; `daemira config validate <file>` checks a file on its own"
+		return append(checks, valid)
+	}
+	files := config.Layers()
+	for idx, path := range files {
+		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, home+string(filepath.Separator)) {
+			files[idx] = "~" + strings.TrimPrefix(path, home)
+		}
+	}
+	valid.Detail = "valid (" + strings.Join(files, ", ") + ")"
+	if len(files) == 0 {
+		valid.Detail = "no config files; using defaults and environment variables"
+	}
+	checks = append(checks, valid)
+
+	for _, note := range cfg.Migrations() {
+		checks = append(checks, DoctorCheck{Group: "Config", Name: "migration", Status: CheckWarning, Detail: note, Fix: "daemira config migrate"})
+	}
+
+	if d.config.BackupEnabled && d.config.BackupRepository != "" {
+		password := DoctorCheck{Group: "Config", Name: "backup.password", Status: CheckOK, Detail: "resolved"}
+		if value, err := cfg.Secret(ctx, "backup.password"); err != nil || value == "" {
+			password.Status = CheckFailed
+			password.Detail = "not set"
+			if err != nil {
+				password.Detail = err.Error()
+			}
+			password.Fix = "Set backup.password (or BACKUP_PASSWORD) to the repository's password, or a keyring:, pass: or cmd: reference that yields it"
+		}
+		checks = append(checks, password)
+	}
+
+	if d.config.SnapshotsEnabled {
+		checks = append(checks, d.checkHomeSnapshots(ctx))
+	}
+
+	if d.config.FleetEnabled && d.config.FleetEndpoint != "" {
+		secret := DoctorCheck{Group: "Config", Name: "fleet.secret", Status: CheckOK, Detail: "resolved"}
+		if value, err := cfg.Secret(ctx, "fleet.secret"); err != nil || value == "" {
+			secret.Status = CheckFailed
+			secret.Detail = "not set"
+			if err != nil {
+				secret.Detail = err.Error()
+			}
+			secret.Fix = "Set fleet.secret (or FLEET_SECRET) to the secret your machines share, or a keyring:, pass: or cmd: reference that yields it"
+		}
+		checks = append(checks, secret)
+	}
+
+	if d.notionConfigured() {
+		token := DoctorCheck{Group: "Config", Name: "notion.token", Status: CheckOK, Detail: "resolved"}
+		if _, err := cfg.Secret(ctx, "notion.token"); err != nil {
+			token.Status = CheckFailed
+			token.Detail = err.Error()
+			token.Fix = "Set notion.token (or NOTION_TOKEN) to the integration's token, or a keyring:, pass: or cmd: reference that yields it"
+		}
+		checks = append(checks, token)
+	}
+	return checks
+}
+
+// checkHomeSnapshots checks that the configured backend can snapshot the
+// home subvolume
+func (d *Daemira) checkHomeSnapshots(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Group: "Config", Name: "home snapshots", Status: CheckOK}
+	hs, err := d.NewHomeSnapshots(ctx)
+	if err != nil {
+		check.Status = CheckFailed
+		check.Detail = err.Error()
+		check.Fix = "Set snapshots.subvolume to a btrfs subvolume, create a snapper config with `sudo snapper -c home create-config /home`, or set snapshots.enabled = false"
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s snapshots of %s", hs.Backend(), hs.Subvolume())
+	return check
+}
+
+// notionConfigured reports whether the Notion integration is on and has
+// something to do
+func (d *Daemira) notionConfigured() bool {
+	return d.config.NotionEnabled && (len(d.config.NotionSyncPaths) > 0 || d.config.NotionVaultPath != "" || d.config.NotionReportDatabaseID != "")
+}
+
+// checkSockets connects to the sockets daemira talks to
+func (d *Daemira) checkSockets() []DoctorCheck {
+	type socket struct {
+		name, path, usedBy, fix string
+		needed                  bool
+	}
+	sockets := []socket{
+		{"system bus", "/run/dbus/system_bus_socket", "suspend inhibitors, logind and polkit", "sudo systemctl enable --now dbus", true},
+		{"journal", "/run/systemd/journal/socket", "logging to the journal", "Logs go to files under " + utility.LogDir() + " instead", false},
+	}
+
+	var checks []DoctorCheck
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sessionBus := filepath.Join(runtimeDir, "bus")
+		if address, ok := strings.CutPrefix(os.Getenv("DBUS_SESSION_BUS_ADDRESS"), "unix:path="); ok {
+			sessionBus, _, _ = strings.Cut(address, ",")
+		}
+		sockets = append(sockets,
+			socket{"session bus", sessionBus, "desktop notifications", "Run daemira inside your desktop session, or as its systemd user service", false},
+			socket{"systemd user manager", filepath.Join(runtimeDir, "systemd", "private"), "the daemira user service", "loginctl enable-linger $USER, then log in again", false},
+		)
+	} else {
+		checks = append(checks, DoctorCheck{
+			Group:  "Sockets",
+			Name:   "user session",
+			Status: CheckWarning,
+			Detail: "XDG_RUNTIME_DIR is not set, so the session bus and the systemd user manager can't be found; needed for desktop notifications and the daemira user service",
+			Fix:    "Run daemira as your user inside a login session, not through su or sudo",
+		})
+	}
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+		backend := desktopmonitor.NewHyprlandBackend(d.logger, utility.NewShell(d.logger))
+		sockets = append(sockets, socket{"Hyprland events", backend.EventSocketPath(), "window rules and workspace reassignment", "Restart Hyprland; HYPRLAND_INSTANCE_SIGNATURE names an instance that is gone", d.config.DesktopEnabled})
+	}
+
+	for _, s := range sockets {
+		check := DoctorCheck{Group: "Sockets", Name: s.name, Status: CheckOK, Detail: s.path}
+		conn, err := net.DialTimeout("unix", s.path, socketTimeout)
+		if err == nil {
+			conn.Close()
+		} else {
+			check.Status = CheckWarning
+			if s.needed {
+				check.Status = CheckFailed
+			}
+			check.Detail = fmt.Sprintf("%s unreachable (%v); needed for %s", s.path, errors.Unwrap(err), s.usedBy)
+			check.Fix = s.fix
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkConnectivity reaches Google Drive, the backup repository and Notion
+// with the configured remote, password and token, and opens each Notion
+// page and database in the config
+func (d *Daemira) checkConnectivity(ctx context.Context) []DoctorCheck {
+	var checks []DoctorCheck
+
+	// Without rclone the dependency check has said all there is to say
+	if _, err := exec.LookPath("rclone"); err == nil && d.config.GDriveEnabled {
+		drive := DoctorCheck{Group: "Connectivity", Name: "Google Drive", Status: CheckOK, Detail: "remote " + d.config.RcloneRemoteName + ": reachable"}
+		if err := utility.NewGoogleDrive(d.logger, d.config.RcloneRemoteName).CheckConfig(ctx); err != nil {
+			drive.Status = CheckFailed
+			drive.Detail = err.Error()
+			drive.Fix = "Check your connection, then `rclone config reconnect " + d.config.RcloneRemoteName + ":` if the token expired"
+		}
+		checks = append(checks, drive)
+	}
+
+	if _, err := exec.LookPath(d.config.BackupTool); err == nil && d.config.BackupEnabled && d.config.BackupRepository != "" {
+		repository := DoctorCheck{Group: "Connectivity", Name: "backup repository", Status: CheckOK}
+		b, err := d.NewBackup(ctx)
+		var snapshots []backup.Snapshot
+		if err == nil {
+			snapshots, err = b.Snapshots(ctx)
+		}
+		switch {
+		case err != nil:
+			repository.Status = CheckFailed
+			repository.Detail = err.Error()
+			repository.Fix = "Check that " + d.config.BackupRepository + " is reachable (mounted, or the rclone remote works) and the password is right; create a new repository with `daemira backup init`"
+		case len(snapshots) == 0:
+			repository.Detail = d.config.BackupRepository + ": no snapshots yet"
+		default:
+			latest := snapshots[len(snapshots)-1]
+			repository.Detail = fmt.Sprintf("%s: %d snapshots, latest %s", d.config.BackupRepository, len(snapshots), latest.Time.Format("2006-01-02 15:04"))
+		}
+		checks = append(checks, repository)
+	}
+
+	if d.config.FleetEnabled && d.config.FleetEndpoint != "" {
+		endpoint := DoctorCheck{Group: "Connectivity", Name: "fleet endpoint", Status: CheckOK}
+		secret, _ := d.config.Secret(ctx, "fleet.secret")
+		if machines, err := fleet.Fetch(ctx, d.config.FleetEndpoint, secret); err != nil {
+			endpoint.Status = CheckFailed
+			endpoint.Detail = err.Error()
+			endpoint.Fix = "Check that fleet.endpoint accepts POSTed reports and answers GET with a JSON array of them"
+		} else {
+			endpoint.Detail = fmt.Sprintf("%d machines reporting", len(machines))
+		}
+		checks = append(checks, endpoint)
+	}
+
+	if !d.notionConfigured() {
+		return checks
+	}
+	notion := DoctorCheck{Group: "Connectivity", Name: "Notion", Status: CheckOK, Detail: "API reachable, token accepted"}
+	client, err := d.NewNotionClient(ctx)
+	if err == nil {
+		err = client.Ping(ctx)
+	}
+	if err != nil {
+		notion.Status = CheckFailed
+		notion.Detail = err.Error()
+		notion.Fix = notionFix(err)
+		return append(checks, notion)
+	}
+	checks = append(checks, notion)
+
+	type object struct{ name, id string }
+	var databases, pages []object
+	if id := d.config.NotionReportDatabaseID; id != "" {
+		databases = append(databases, object{"notion.report_database_id", id})
+	}
+	if id := d.config.NotionVaultDatabaseID; id != "" {
+		databases = append(databases, object{"notion.vault_database_id", id})
+	}
+	for idx, id := range d.config.NotionPageIDs {
+		pages = append(pages, object{fmt.Sprintf("notion.page_ids[%d]", idx), id})
+	}
+	access := func(o object, get func(context.Context, string) (*utility.PageObjectResponse, error)) {
+		check := DoctorCheck{Group: "Connectivity", Name: o.name, Status: CheckOK}
+		if found, err := get(ctx, o.id); err != nil {
+			check.Status = CheckFailed
+			check.Detail = err.Error()
+			check.Fix = notionFix(err)
+		} else {
+			check.Detail = fmt.Sprintf("%q shared with the integration", found.Title())
+		}
+		checks = append(checks, check)
+	}
+	for _, database := range databases {
+		access(database, client.GetDatabase)
+	}
+	for _, page := range pages {
+		access(page, client.GetPage)
+	}
+	return checks
+}
+
+// notionFix explains what to do about a Notion error
+func notionFix(err error) string {
+	var apiErr *utility.NotionAPIError
+	if !errors.As(err, &apiErr) {
+		return "Check your internet connection"
+	}
+	switch apiErr.Status {
+	case 401:
+		return "Set notion.token to a current token from https://www.notion.so/my-integrations"
+	case 403, 404:
+		return "Share the page or database with the integration (••• menu → Connections), and check the ID"
+	}
+	return "Try again later; Notion answered with an error"
+}
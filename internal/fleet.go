@@ -0,0 +1,115 @@
+package daemira
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ln64-git/daemira/src/features/backup"
+	"github.com/ln64-git/daemira/src/features/fleet"
+	"github.com/ln64-git/daemira/src/features/snapshots"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// NewFleetReporter creates a reporter for the configured fleet endpoint,
+// resolving the shared secret
+func (d *Daemira) NewFleetReporter(ctx context.Context) (*fleet.Reporter, error) {
+	if d.config.FleetEndpoint == "" {
+		return nil, fmt.Errorf("no endpoint configured (set fleet.endpoint)")
+	}
+	secret, err := d.config.Secret(ctx, "fleet.secret")
+	if err != nil {
+		return nil, err
+	}
+
+	return fleet.NewReporter(d.logger, &fleet.ReporterOptions{
+		Endpoint: d.config.FleetEndpoint,
+		Secret:   secret,
+		Machine:  d.config.FleetMachine,
+		Interval: d.config.FleetInterval,
+	}, d.FleetSummary)
+}
+
+// ReportToFleet sends this machine's status to the fleet endpoint
+// periodically if one is configured
+func (d *Daemira) ReportToFleet() error {
+	if d.config.FleetEndpoint == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.fleetReporter != nil {
+		return nil
+	}
+
+	reporter, err := d.NewFleetReporter(context.Background())
+	if err != nil {
+		return err
+	}
+	reporter.Start()
+	d.fleetReporter = reporter
+	return nil
+}
+
+// FleetSummary collects the state reported to the fleet endpoint
+func (d *Daemira) FleetSummary(ctx context.Context) fleet.Summary {
+	d.mu.RLock()
+	summary := fleet.Summary{DaemonStarted: d.started, Alerts: []fleet.Alert{}}
+	d.mu.RUnlock()
+
+	for _, alert := range utility.GetAlerts().List() {
+		summary.Alerts = append(summary.Alerts, fleet.Alert{
+			ID:       alert.ID,
+			Severity: alert.Severity,
+			Summary:  alert.Summary,
+			Known:    alert.Known(),
+		})
+	}
+
+	update := d.updateStatus()
+	summary.LastUpdate = update.LastUpdate
+	if n := len(update.History); n > 0 && !update.History[n-1].Success {
+		summary.UpdateError = update.History[n-1].Error
+		if summary.UpdateError == "" {
+			summary.UpdateError = "failed"
+		}
+	}
+
+	cfg := d.GetConfig()
+	if cfg.BackupEnabled && cfg.BackupRepository != "" {
+		status := backup.LoadStatus()
+		summary.LastBackup = status.LastSuccess
+		summary.BackupError = status.LastError
+	}
+	if cfg.SnapshotsEnabled {
+		status := snapshots.LoadStatus()
+		summary.LastSnapshot = status.LastSuccess
+		summary.SnapshotError = status.LastError
+	}
+
+	gdrive := d.gdriveStatus()
+	summary.SyncDirs = len(gdrive.Directories)
+	for _, directory := range gdrive.Directories {
+		if directory.Status == "error" {
+			summary.SyncErrors = append(summary.SyncErrors, directory.Path)
+		}
+	}
+
+	for _, job := range utility.GetScheduler().Jobs() {
+		if job.Enabled && job.LastError != "" {
+			summary.FailingJobs = append(summary.FailingJobs, job.ID)
+		}
+	}
+
+	if disks, err := systemhealth.GetDiskMonitor().GetAllDiskUsage(ctx); err == nil {
+		for _, disk := range disks {
+			summary.DiskUsedPct = max(summary.DiskUsedPct, disk.PercentUsed)
+		}
+	}
+	if memory, err := systemhealth.GetMemoryMonitor().GetMemoryStats(ctx); err == nil {
+		summary.MemoryUsedPct = memory.PercentUsed
+	}
+	return summary
+}
@@ -0,0 +1,56 @@
+/**
+ * Liveness - Telling systemd the daemon is up and not hung
+ * Once started the daemon reports READY=1 (for Type=notify), registers
+ * probes taking the locks its status and features depend on, and feeds
+ * systemd's watchdog only while those and the worker heartbeats pass. The
+ * same checks answer GET /v1/live.
+ */
+
+package daemira
+
+import "github.com/ln64-git/daemira/src/utility"
+
+// watchLiveness registers the daemon's probes, starts the watchdog and
+// tells systemd the daemon is ready
+func (d *Daemira) watchLiveness() {
+	watchdog := utility.GetWatchdog()
+	watchdog.AddProbe("daemon", func() error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return nil
+	})
+	watchdog.AddProbe("jobs", func() error {
+		utility.GetScheduler().Jobs()
+		return nil
+	})
+	watchdog.AddProbe("gdrive", func() error {
+		if gd := d.GetGoogleDrive(); gd != nil {
+			gd.GetStatus()
+		}
+		return nil
+	})
+	watchdog.AddProbe("system-update", func() error {
+		if su := d.GetSystemUpdate(); su != nil {
+			su.GetStatus()
+		}
+		return nil
+	})
+	watchdog.Start()
+
+	if sent, err := utility.SdNotify("READY=1\nSTATUS=Running"); err != nil {
+		d.logger.Warn("Failed to tell systemd the daemon is ready: %v", err)
+	} else if sent {
+		d.logger.Debug("Told systemd the daemon is ready")
+	}
+}
+
+// stopLiveness tells systemd the daemon is stopping and halts the watchdog
+func (d *Daemira) stopLiveness() {
+	_, _ = utility.SdNotify("STOPPING=1")
+	utility.GetWatchdog().Stop()
+}
+
+// Liveness runs the liveness checks
+func (d *Daemira) Liveness() utility.Liveness {
+	return utility.GetWatchdog().Check()
+}
@@ -0,0 +1,249 @@
+/**
+ * Config hot-reload
+ * The daemon re-reads its config on SIGHUP and when a config file changes.
+ * Settings a running service can pick up (exclude patterns, intervals,
+ * thresholds, preferred devices) apply immediately; the rest are logged as needing a
+ * restart. An invalid config is rejected and the current one kept.
+ */
+
+package daemira
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/config"
+	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/devices"
+	"github.com/ln64-git/daemira/src/features/network"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// configStamp identifies the current contents of the config files; it changes
+// when one is edited, created or removed
+func configStamp() string {
+	var stamp strings.Builder
+	for _, path := range config.Files() {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&stamp, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return stamp.String()
+}
+
+// WatchConfig reloads the config on SIGHUP and whenever a config file changes
+func (d *Daemira) WatchConfig() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.configWatching {
+		return
+	}
+	d.configWatching = true
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go utility.Supervise("config-watcher", func() {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+
+		last := configStamp()
+		for {
+			select {
+			case <-hangup:
+				d.logger.Info("Received SIGHUP, reloading config...")
+				last = configStamp()
+				d.ReloadConfig()
+			case <-ticker.C:
+				if stamp := configStamp(); stamp != last {
+					last = stamp
+					d.logger.Info("Config files changed, reloading config...")
+					d.ReloadConfig()
+				}
+			}
+		}
+	})
+	d.logger.Info("Watching config files for changes (send SIGHUP to reload now)")
+}
+
+// ReloadConfig re-reads the config and applies the settings that can change at
+// runtime. An invalid config is rejected and the current settings kept.
+func (d *Daemira) ReloadConfig() error {
+	next, err := config.Load()
+	if err != nil {
+		d.logger.Error("Rejected config reload, keeping current settings: %v", err)
+		return err
+	}
+	for _, note := range next.Migrations() {
+		d.logger.Info("%s", note)
+	}
+
+	d.mu.Lock()
+	current := d.config
+	changes := current.Diff(next)
+	d.config = current.WithReloadable(next)
+	d.mu.Unlock()
+
+	// Timers enabled or disabled since are picked up by any reload
+	d.mu.RLock()
+	d.applyTimerJobs()
+	d.mu.RUnlock()
+
+	if len(changes) == 0 {
+		d.logger.Info("Config reloaded, no changes")
+		return nil
+	}
+
+	applied := 0
+	var restart watcherRestarts
+	for _, change := range changes {
+		if !config.IsReloadable(change.Key) {
+			// Values are left out: restart-only settings include API tokens
+			d.logger.Warn("%s changed; restart daemira to apply it", change.Key)
+			continue
+		}
+		d.logger.Info("  %s", change)
+		d.applySetting(change.Key, &restart)
+		applied++
+	}
+	if restart.network {
+		if err := d.WatchNetwork(); err != nil {
+			d.logger.Warn("Network profiles disabled: %v", err)
+		}
+	}
+	if restart.vpn {
+		if err := d.WatchVPN(); err != nil {
+			d.logger.Warn("VPN detection disabled: %v", err)
+		}
+	}
+	d.logger.Info("Config reloaded: %d setting(s) applied, %d pending restart", applied, len(changes)-applied)
+	return nil
+}
+
+// watcherRestarts are the watchers a reload starts again once it no longer
+// holds mu: starting one runs its callbacks, which take mu
+type watcherRestarts struct {
+	network bool
+	vpn     bool
+}
+
+// applySetting pushes a reloaded setting to the service using it; settings
+// read on demand need nothing beyond the config swap, and watchers to start
+// again are noted in restart
+func (d *Daemira) applySetting(key string, restart *watcherRestarts) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	switch key {
+	case "LOG_LEVEL", "LOG_FORMAT", "LOG_COMPONENT_LEVELS", "SLOW_COMMAND_THRESHOLD":
+		d.config.ApplyLogging(d.logger)
+		d.config.ApplyLogging(utility.GetLogger())
+	case "RCLONE_EXCLUDES":
+		if d.googleDrive != nil {
+			d.googleDrive.SetExcludePatterns(d.config.RcloneExcludes)
+		}
+	case "SYSTEM_UPDATE_INTERVAL":
+		if d.systemUpdate != nil {
+			d.systemUpdate.SetInterval(d.SystemUpdateInterval())
+		}
+	case "SYSTEM_UPDATE_KEYRING_MAX_AGE":
+		if d.systemUpdate != nil {
+			d.systemUpdate.SetKeyringMaxAge(d.config.SystemUpdateKeyringMaxAge)
+		}
+	case "MONITOR_INTERVAL":
+		if d.healthMonitor != nil {
+			d.healthMonitor.SetInterval(d.config.MonitorInterval)
+		}
+	case "NOTION_SYNC_INTERVAL":
+		if d.notionSync != nil {
+			d.notionSync.SetInterval(d.config.NotionSyncInterval)
+		}
+	case "BACKUP_INTERVAL":
+		if d.backup != nil {
+			d.backup.SetInterval(d.config.BackupInterval)
+		}
+	case "BACKUP_CHECK_INTERVAL":
+		if d.backup != nil {
+			d.backup.SetCheckInterval(d.config.BackupCheckInterval)
+		}
+	case "BACKUP_EXCLUDES":
+		if d.backup != nil {
+			d.backup.SetExcludes(d.config.BackupExcludes)
+		}
+		if options, err := d.DriveOptions(); err == nil {
+			devices.GetDriveManager().SetOptions(options)
+		}
+	case "BACKUP_KEEP_DAILY", "BACKUP_KEEP_WEEKLY", "BACKUP_KEEP_MONTHLY":
+		if d.backup != nil {
+			d.backup.SetRetention(d.BackupRetention())
+		}
+	case "SNAPSHOTS_INTERVAL":
+		if d.homeSnapshots != nil {
+			d.homeSnapshots.SetInterval(d.config.SnapshotsInterval)
+		}
+	case "SNAPSHOTS_KEEP_HOURLY", "SNAPSHOTS_KEEP_DAILY", "SNAPSHOTS_KEEP_WEEKLY":
+		if d.homeSnapshots != nil {
+			d.homeSnapshots.SetRetention(d.SnapshotRetention())
+		}
+	case "FLEET_INTERVAL":
+		if d.fleetReporter != nil {
+			d.fleetReporter.SetInterval(d.config.FleetInterval)
+		}
+	case "DISK_WARN_FREE", "DISK_CRITICAL_FREE":
+		systemhealth.GetDiskMonitor().SetThresholds(d.config.DiskWarnFree.Bytes(), d.config.DiskCriticalFree.Bytes())
+	case "BOOT_REGRESSION":
+		systemhealth.GetBootMonitor().SetRegression(d.config.BootRegression)
+	case "KERNEL_PARAMS":
+		systemhealth.GetKernelMonitor().SetExpected(d.config.KernelParams)
+	case "SECURITY_FAILED_LOGIN_THRESHOLD", "SECURITY_FAILED_LOGIN_WINDOW", "SECURITY_BLOCK", "SECURITY_BLOCK_DURATION", "SECURITY_ALLOWLIST":
+		systemhealth.GetSecurityMonitor().SetLoginPolicy(d.LoginPolicy())
+	case "SECURITY_INTEGRITY_PATHS":
+		systemhealth.GetIntegrityMonitor().SetPaths(d.config.GetSecurityIntegrityPaths())
+	case "SECURITY_SSH_AGENT_KEYS", "SECURITY_SSH_KEY_MAX_AGE", "SECURITY_SSH_CERT_WARN":
+		systemhealth.GetSSHMonitor().SetOptions(d.SSHOptions())
+	case "DIAGNOSTICS_MAX_CPU", "DIAGNOSTICS_MAX_MEMORY", "DIAGNOSTICS_MAX_GOROUTINES", "DIAGNOSTICS_MAX_OPEN_FILES", "DIAGNOSTICS_HEAP_PROFILE":
+		utility.GetResourceMonitor().SetLimits(d.ResourceLimits())
+	case "USB_NOTIFY", "USB_WARN_UNKNOWN_KEYBOARDS", "USB_HOOK":
+		devices.GetUsbMonitor().SetPolicy(d.USBPolicy())
+	case "USB_DRIVES":
+		if options, err := d.DriveOptions(); err != nil {
+			d.logger.Warn("Backups to external drives unchanged: %v", err)
+		} else if d.config.USBEnabled {
+			drives := devices.GetDriveManager()
+			drives.SetOptions(options)
+			drives.Start()
+		}
+	case "NETWORK_PROFILES", "NETWORK_HOOK":
+		monitor := network.GetNetworkMonitor()
+		if profiles, err := network.ParseNetworkProfiles(d.config.NetworkProfiles); err != nil {
+			d.logger.Warn("Network profiles unchanged: %v", err)
+		} else if monitor.IsRunning() {
+			monitor.SetProfiles(profiles, d.config.NetworkHook)
+			go monitor.Check(context.Background())
+		} else {
+			restart.network = true
+		}
+	case "VPN_REQUIRED_FOR", "VPN_NAMES":
+		restart.vpn = true
+	case "AUDIO_PREFERRED_SINKS":
+		if d.config.AudioAutoSwitch {
+			desktopmonitor.GetAudioMonitor().SetPreferred(d.config.AudioPreferredSinks)
+		}
+	case "USAGE_EXCLUDE":
+		if d.usageTracker != nil {
+			d.usageTracker.SetExclude(d.config.UsageExclude)
+		}
+	case "JOB_SCHEDULES", "JOBS_DISABLED", "JOBS_CATCH_UP", "JOBS_SYSTEMD_TIMERS":
+		d.applyJobSettings()
+	}
+}
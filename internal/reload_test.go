@@ -0,0 +1,78 @@
+package daemira
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ln64-git/daemira/src/config"
+	"github.com/ln64-git/daemira/src/features/network"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// writeTestConfig writes the user config file and returns the config it loads to
+func writeTestConfig(t *testing.T, contents string) *config.Config {
+	t.Helper()
+	if _, err := utility.EnsureDir(utility.ConfigDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(utility.ConfigDir(), "config.toml"), []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() = %v", err)
+	}
+	return cfg
+}
+
+// reloadWithin reloads the config, failing the test if the reload or a
+// status read afterwards doesn't finish in time
+func reloadWithin(t *testing.T, d *Daemira, timeout time.Duration) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		err := d.ReloadConfig()
+		if err == nil {
+			d.mu.Lock()
+			d.mu.Unlock()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ReloadConfig() = %v", err)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("config reload didn't finish within %v (deadlock?)", timeout)
+	}
+}
+
+func TestReloadVPNRequiredFor(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	t.Cleanup(network.GetVPNWatcher().Stop)
+
+	d := NewDaemira(nil, writeTestConfig(t, "[vpn]\nnames = []\n"))
+
+	// Starting the watcher runs its first check, and the callbacks, during the reload
+	writeTestConfig(t, "[vpn]\nrequired_for = [\"gdrive\"]\n")
+	reloadWithin(t, d, 10*time.Second)
+	if !network.GetVPNWatcher().IsRunning() {
+		t.Error("VPN watcher not started by vpn.required_for")
+	}
+
+	writeTestConfig(t, "[vpn]\nrequired_for = [\"gdrive\"]\nnames = [\"wg0\"]\n")
+	reloadWithin(t, d, 10*time.Second)
+
+	// Nothing needing the VPN stops the watcher and lets the syncs run
+	writeTestConfig(t, "[vpn]\nnames = [\"wg0\"]\n")
+	reloadWithin(t, d, 10*time.Second)
+	if network.GetVPNWatcher().IsRunning() {
+		t.Error("VPN watcher still running with vpn.required_for empty")
+	}
+}
@@ -0,0 +1,104 @@
+/**
+ * Remote API - The API over the tailnet
+ * With api.tailnet on, the daemon also serves part of its API (status,
+ * health, jobs, alerts and triggering syncs) over HTTP on its Tailscale
+ * address, so `daemira --host <machine>` works from the other machines in
+ * the tailnet. Tailscale encrypts the traffic; requests must come from a
+ * tailnet address and carry api.key as a bearer token.
+ */
+
+package daemira
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/network"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// remoteEndpoints are the endpoints served over the tailnet; stopping the
+// daemon, running updates and accepting config changes stay local
+var remoteEndpoints = []string{
+	"GET /v1/status",
+	"GET /v1/health",
+	"GET /v1/live",
+	"GET /v1/gdrive",
+	"POST /v1/gdrive/sync",
+	"POST /v1/gdrive/resync",
+	"GET /v1/system/update",
+	"GET /v1/notion",
+	"POST /v1/notion/sync",
+	"GET /v1/jobs",
+	"POST /v1/jobs/{id}/run",
+	"GET /v1/alerts",
+	"POST /v1/alerts/{id}/ack",
+	"POST /v1/alerts/{id}/silence",
+}
+
+// ServeTailnetAPI serves the remote endpoints on the Tailscale address, on
+// the configured port
+func (d *Daemira) ServeTailnetAPI() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	key, err := d.config.Secret(ctx, "api.key")
+	if err != nil {
+		return err
+	}
+	address, err := network.TailscaleAddress(ctx, utility.NewShell(d.logger))
+	if err != nil {
+		return err
+	}
+
+	listenAddress := net.JoinHostPort(address, strconv.Itoa(d.config.Port))
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", listenAddress, err)
+	}
+
+	local := d.apiHandler()
+	mux := http.NewServeMux()
+	for _, pattern := range remoteEndpoints {
+		mux.Handle(pattern, local)
+	}
+	server := &http.Server{
+		Handler:           d.requireAPIKey(key, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	d.mu.Lock()
+	d.tailnetServer = server
+	d.mu.Unlock()
+
+	utility.Go("tailnet-api", func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.logger.Error("Tailnet API stopped: %v", err)
+		}
+	})
+	d.logger.Info("API listening on the tailnet at %s", listenAddress)
+	return nil
+}
+
+// requireAPIKey answers only requests from the tailnet carrying key
+func (d *Daemira) requireAPIKey(key string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !network.InTailnet(ip) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("only machines in the tailnet may use the API"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+			d.logger.Warn("Refused a tailnet API request from %s: wrong or missing API key", host)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("wrong or missing API key (api.key, or DAEMIRA_API_KEY)"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
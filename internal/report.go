@@ -0,0 +1,189 @@
+package daemira
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	notionsync "github.com/ln64-git/daemira/src/features/notion-sync"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	systemupdate "github.com/ln64-git/daemira/src/features/system-update"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// NewNotionReporter creates a reporter for the configured report database
+func (d *Daemira) NewNotionReporter(ctx context.Context) (*notionsync.Reporter, error) {
+	if d.config.NotionReportDatabaseID == "" {
+		return nil, fmt.Errorf("no report database (set notion.report_database_id)")
+	}
+	client, err := d.NewNotionClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return notionsync.NewReporter(d.logger, client, d.config.NotionReportDatabaseID, d.HealthReport), nil
+}
+
+// ReportToNotion sends update results and daily health summaries to the
+// report database if one is configured
+func (d *Daemira) ReportToNotion() error {
+	if d.config.NotionReportDatabaseID == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.notionReporter != nil {
+		return nil
+	}
+
+	reporter, err := d.NewNotionReporter(context.Background())
+	if err != nil {
+		return err
+	}
+	if d.systemUpdate != nil {
+		d.systemUpdate.OnUpdate(func(entry systemupdate.UpdateHistoryEntry) {
+			if err := reporter.Send(context.Background(), updateReport(entry)); err != nil {
+				d.logger.Warn("Failed to send update report to Notion: %v", err)
+			}
+		})
+	}
+	reporter.Start()
+	d.notionReporter = reporter
+	return nil
+}
+
+// updateReport describes a finished system update
+func updateReport(entry systemupdate.UpdateHistoryEntry) notionsync.Report {
+	report := notionsync.Report{
+		Kind:     notionsync.ReportUpdate,
+		Title:    "System update succeeded",
+		Time:     entry.Timestamp,
+		Status:   "OK",
+		Duration: entry.Duration,
+	}
+
+	var body strings.Builder
+	if !entry.Success {
+		report.Title = "System update failed"
+		report.Status = "Failed"
+		body.WriteString(fmt.Sprintf("**Error:** `%s`\n\n", entry.Error))
+	}
+	body.WriteString(fmt.Sprintf("Took %s.\n", entry.Duration.Round(time.Second)))
+	if len(entry.RunLogs) > 0 {
+		body.WriteString("\n## Step output\n\n")
+		for _, runLog := range entry.RunLogs {
+			body.WriteString(fmt.Sprintf("- `%s`\n", runLog))
+		}
+	}
+	report.Body = body.String()
+	return report
+}
+
+// HealthReport summarizes disk space, SMART health, the firewall and the
+// results of the last syncs
+func (d *Daemira) HealthReport(ctx context.Context) notionsync.Report {
+	status := "OK"
+	worse := func(level string) {
+		if status != "Failed" {
+			status = level
+		}
+	}
+	var body strings.Builder
+	disk := systemhealth.GetDiskMonitor()
+
+	body.WriteString("## Disks\n\n")
+	if disks, err := disk.GetAllDiskUsage(ctx); err != nil {
+		body.WriteString(fmt.Sprintf("Failed to read disk usage: `%v`\n", err))
+		worse("Warning")
+	} else {
+		body.WriteString("| Mount | Used | Free | Status |\n|---|---|---|---|\n")
+		for _, usage := range disks {
+			body.WriteString(fmt.Sprintf("| %s | %.0f%% | %.1f GB | %s |\n", usage.MountPoint, usage.PercentUsed, usage.FreeGB, usage.Status))
+			switch usage.Status {
+			case "critical":
+				worse("Failed")
+			case "warning":
+				worse("Warning")
+			}
+		}
+	}
+
+	body.WriteString("\n## SMART\n\n")
+	if smart, err := disk.GetAllSmartStatus(ctx); err != nil || len(smart) == 0 {
+		body.WriteString("No SMART data (smartctl missing or no disks readable)\n")
+	} else {
+		for _, drive := range smart {
+			result := "PASSED"
+			if !drive.Passed {
+				result = "FAILED"
+				worse("Failed")
+			}
+			body.WriteString(fmt.Sprintf("- %s: %s\n", drive.Device, result))
+		}
+	}
+
+	body.WriteString("\n## Firewall\n\n")
+	if firewall, err := systemhealth.GetSecurityMonitor().GetFirewallStatus(ctx); err != nil {
+		body.WriteString(fmt.Sprintf("Failed to check the firewall: `%v`\n", err))
+	} else {
+		body.WriteString(firewall.Summary() + "\n")
+		if firewall.Active == "" {
+			worse("Warning")
+		}
+	}
+
+	body.WriteString("\n## Sync\n\n")
+	d.mu.RLock()
+	gd := d.googleDrive
+	d.mu.RUnlock()
+	if gd == nil {
+		body.WriteString("- Google Drive: not running\n")
+	} else {
+		states, _ := gd.GetStatus()["syncStates"].(map[string]interface{})
+		paths := make([]string, 0, len(states))
+		for path := range states {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			state, _ := states[path].(map[string]interface{})
+			syncStatus, _ := state["status"].(string)
+			line := fmt.Sprintf("- Google Drive %s: %s", path, syncStatus)
+			if lastSync, ok := state["lastSyncTime"].(time.Time); ok && !lastSync.IsZero() {
+				line += ", last synced " + lastSync.Format("2006-01-02 15:04")
+			}
+			if message, _ := state["errorMessage"].(string); message != "" {
+				line += fmt.Sprintf(" (`%s`)", message)
+				worse("Warning")
+			}
+			body.WriteString(line + "\n")
+		}
+	}
+	if notionState, err := notionsync.LoadState(); err == nil {
+		paths := make([]string, 0, len(notionState.Targets))
+		for path := range notionState.Targets {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			target := notionState.Targets[path]
+			line := fmt.Sprintf("- Notion %s: %d file(s), last synced %s", target.Path, target.Files, target.LastSync.Format("2006-01-02 15:04"))
+			if target.LastError != "" {
+				line += fmt.Sprintf(" (`%s`)", target.LastError)
+				worse("Warning")
+			}
+			body.WriteString(line + "\n")
+		}
+	}
+
+	return notionsync.Report{
+		Kind:   notionsync.ReportHealth,
+		Title:  "Health " + time.Now().Format("2006-01-02"),
+		Time:   time.Now(),
+		Status: status,
+		Body:   utility.Redact(body.String()),
+	}
+}
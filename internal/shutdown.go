@@ -0,0 +1,165 @@
+/**
+ * Graceful shutdown
+ * On SIGINT or SIGTERM the daemon stops its schedulers and lets work in
+ * flight finish (or checkpoint) before it exits, instead of killing a
+ * bisync or an upgrade halfway.
+ */
+
+package daemira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/devices"
+	"github.com/ln64-git/daemira/src/features/network"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Shutdown stops every running feature. Schedulers and watchers stop at
+// once; Google Drive syncs, a system update, a backup, a snapshot and a
+// Notion sync in progress get until ctx is done to finish. The error names
+// the work that didn't.
+func (d *Daemira) Shutdown(ctx context.Context) error {
+	d.logger.Info("Stopping Daemira services...")
+	d.stopLiveness()
+
+	d.mu.Lock()
+	server, tailnetServer := d.apiServer, d.tailnetServer
+	d.apiServer, d.tailnetServer = nil, nil
+	gd := d.googleDrive
+	su := d.systemUpdate
+	ns := d.notionSync
+	bk := d.backup
+	hs := d.homeSnapshots
+	d.googleDrive = nil
+	d.systemUpdate = nil
+	d.notionSync = nil
+	d.backup = nil
+	d.homeSnapshots = nil
+	d.googleDriveAutoStarted = false
+	waybarStop := d.waybarStop
+	d.waybarStop = nil
+
+	// Nothing else is in flight in these; they only need to stop
+	utility.GetResourceMonitor().Stop()
+	if d.notionReporter != nil {
+		d.notionReporter.Stop()
+		d.notionReporter = nil
+	}
+	if d.healthMonitor != nil {
+		d.healthMonitor.Stop()
+		d.healthMonitor = nil
+	}
+	if d.fleetReporter != nil {
+		d.fleetReporter.Stop()
+		d.fleetReporter = nil
+	}
+	if d.displayProfiles != nil {
+		d.displayProfiles.Stop()
+		d.displayProfiles = nil
+	}
+	if d.windowRules != nil {
+		d.windowRules.Stop()
+		d.windowRules = nil
+	}
+	if d.workspaceReassigner != nil {
+		d.workspaceReassigner.Stop()
+		d.workspaceReassigner = nil
+	}
+	if d.idleManager != nil {
+		d.idleManager.Stop()
+		d.idleManager = nil
+	}
+	if d.sessionHooks != nil {
+		d.sessionHooks.Stop()
+		d.sessionHooks = nil
+	}
+	if d.wallpaperRotator != nil {
+		d.wallpaperRotator.Stop()
+		d.wallpaperRotator = nil
+	}
+	if d.usageTracker != nil {
+		d.usageTracker.Stop()
+		d.usageTracker = nil
+	}
+	d.mu.Unlock()
+
+	desktopmonitor.GetAudioMonitor().StopAutoSwitch()
+	devices.GetUsbMonitor().Stop()
+	network.GetNetworkMonitor().Stop()
+	network.GetVPNWatcher().Stop()
+	utility.GetNotionQueue().Stop()
+	utility.GetDoNotDisturb().Stop()
+	utility.GetScheduler().Stop()
+	utility.GetSleepWatcher().Stop()
+
+	// The syncs and the update finish side by side, sharing the deadline
+	var (
+		wg   sync.WaitGroup
+		errs []error
+		mu   sync.Mutex
+	)
+	finish := func(name string, shutdown func(context.Context) error) {
+		wg.Add(1)
+		utility.Go(name+"-shutdown", func() {
+			defer wg.Done()
+			if err := shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		})
+	}
+	if gd != nil {
+		finish("gdrive", gd.Shutdown)
+	}
+	if su != nil {
+		finish("system-update", su.Shutdown)
+	}
+	if ns != nil {
+		finish("notion-sync", ns.Shutdown)
+	}
+	if bk != nil {
+		finish("backup", bk.Shutdown)
+	}
+	if hs != nil {
+		finish("snapshots", hs.Shutdown)
+	}
+	// A backup to an external drive is cut short, so the drive gets unmounted
+	finish("usb-drives", devices.GetDriveManager().Shutdown)
+	if server != nil {
+		// No new requests; ones in flight (a resync, an update waited on) get the same deadline
+		finish("api", func(ctx context.Context) error {
+			if err := server.Shutdown(ctx); err != nil {
+				return fmt.Errorf("API requests interrupted: %w", err)
+			}
+			return nil
+		})
+	}
+	if tailnetServer != nil {
+		finish("tailnet-api", func(ctx context.Context) error {
+			if err := tailnetServer.Shutdown(ctx); err != nil {
+				return fmt.Errorf("tailnet API requests interrupted: %w", err)
+			}
+			return nil
+		})
+	}
+	wg.Wait()
+
+	// The bar shows the sync stopped rather than its last state
+	if waybarStop != nil {
+		close(waybarStop)
+		d.writeWaybar(nil)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		d.logger.Error("Daemira services stopped with work unfinished: %v", err)
+		return err
+	}
+	d.logger.Info("Daemira services stopped")
+	return nil
+}
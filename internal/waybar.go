@@ -0,0 +1,74 @@
+/**
+ * Waybar status file
+ * The daemon keeps the Google Drive sync's Waybar module (see
+ * src/api/waybar.go) in a file, rewritten when it changes, so a bar can
+ * read it with cat instead of asking the daemon every few seconds.
+ */
+
+package daemira
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// waybarPollInterval is how often the daemon checks the sync status for changes
+const waybarPollInterval = 2 * time.Second
+
+// WriteWaybarStatus keeps the sync's Waybar module in api.GDriveWaybarPath
+// until Shutdown
+func (d *Daemira) WriteWaybarStatus() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.waybarStop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	d.waybarStop = stop
+
+	go utility.Supervise("waybar-status", func() {
+		ticker := time.NewTicker(waybarPollInterval)
+		defer ticker.Stop()
+
+		var last []byte
+		for {
+			last = d.writeWaybar(last)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	d.logger.Debug("Writing the Google Drive sync's Waybar module to %s", api.GDriveWaybarPath())
+}
+
+// writeWaybar writes the sync's Waybar module unless it is still last, and
+// returns what the file holds
+func (d *Daemira) writeWaybar(last []byte) []byte {
+	data, err := json.Marshal(api.GDriveWaybar(d.gdriveStatus()))
+	if err != nil || string(data) == string(last) {
+		return last
+	}
+	if _, err := utility.EnsureDir(utility.RuntimeDir()); err != nil {
+		d.logger.Warn("Failed to create runtime directory: %v", err)
+		return last
+	}
+	// Renamed into place, so the bar never reads half a file
+	path := api.GDriveWaybarPath()
+	pending := path + ".tmp"
+	if err := os.WriteFile(pending, append(data, '\n'), 0644); err != nil {
+		d.logger.Warn("Failed to write %s: %v", path, err)
+		return last
+	}
+	if err := os.Rename(pending, path); err != nil {
+		d.logger.Warn("Failed to write %s: %v", path, err)
+		return last
+	}
+	return data
+}
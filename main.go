@@ -16,30 +16,18 @@ var (
 )
 
 func main() {
-	// Check if running as root
-	if os.Geteuid() == 0 {
-		logger = utility.NewLogger("cli", utility.INFO)
-		logger.Info("Running with root privileges")
-	} else {
-		logger = utility.NewLogger("cli", utility.INFO)
-		logger.Info("Running as user (system updates will require sudo)")
-	}
+	logger = utility.NewLogger("cli", utility.INFO)
 	defer logger.Close()
 
-	// Load config
-	cfg, err := config.Load()
-	if err != nil {
-		logger.Warn("Failed to load config: %v, using defaults", err)
-		cfg = &config.Config{
-			RcloneRemoteName: "gdrive",
-		}
+	// As a service, log to the journal with priorities and fields
+	if utility.UnderJournal() {
+		logger.SetMode("journal")
 	}
 
-	// Initialize daemon
-	daemon = daemira.NewDaemira(logger, cfg)
-
-	// Create CLI and commands
-	cliInstance := cli.NewCLI(daemon, logger)
+	// Create CLI and commands; the daemon is created once the command to
+	// run is known, which may print machine-readable output on stdout and
+	// send logs elsewhere
+	cliInstance := cli.NewCLI(logger, startDaemira)
 	rootCmd := cliInstance.CreateCommands()
 
 	// Execute
@@ -48,3 +36,25 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// startDaemira loads the config and creates the daemon
+func startDaemira() *daemira.Daemira {
+	logger.Info("Root access: %s", utility.GetPrivilegeManager().Route())
+
+	// Load config
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Warn("Failed to load config: %v, using defaults", err)
+		cfg = config.Default()
+	}
+	cfg.ApplyLogging(logger)
+	// Components created without a logger share the file logger
+	cfg.ApplyLogging(utility.GetLogger())
+	for _, note := range cfg.Migrations() {
+		logger.Info("%s", note)
+	}
+
+	// Initialize daemon
+	daemon = daemira.NewDaemira(logger, cfg)
+	return daemon
+}
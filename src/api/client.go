@@ -0,0 +1,306 @@
+/**
+ * API client - Driving a running daemon from Go
+ * The daemon serves its operations as JSON over a unix socket in the runtime
+ * directory (see internal/api.go), and with api.tailnet on over Tailscale;
+ * Client wraps each endpoint in a method.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Error is an error the daemon answered a request with
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Client talks to a running daemon over its API socket, or to one on
+// another machine over the tailnet
+type Client struct {
+	socket string // or the remote host
+	base   string // URL requests go to
+	key    string // sent to a remote daemon
+	http   *http.Client
+}
+
+// DefaultPort is the port remote daemons serve the API on unless the host
+// names one (the port setting)
+const DefaultPort = 3000
+
+// remote is where NewClient("") sends requests instead of the local
+// socket, set by UseRemote
+var remote struct {
+	host string
+	key  string
+}
+
+// UseRemote makes NewClient("") reach the daemon on host ("laptop" or
+// "laptop:3000") over the tailnet, sending key, as `daemira --host` does
+func UseRemote(host, key string) {
+	remote.host, remote.key = host, key
+}
+
+// Remote returns the host set by UseRemote, "" for the local daemon
+func Remote() string {
+	return remote.host
+}
+
+// NewRemoteClient creates a client for the daemon on host ("laptop" or
+// "laptop:3000") serving the API over the tailnet
+func NewRemoteClient(host, key string) *Client {
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, strconv.Itoa(DefaultPort))
+	}
+	return &Client{
+		socket: host,
+		base:   "http://" + address,
+		key:    key,
+		http:   &http.Client{},
+	}
+}
+
+// SocketPath returns the socket the daemon serves its API on
+func SocketPath() string {
+	return utility.APISocketPath()
+}
+
+// NewClient creates a client for the daemon listening on socket, or if
+// socket is empty on SocketPath or the host set by UseRemote
+func NewClient(socket string) *Client {
+	if socket == "" && remote.host != "" {
+		return NewRemoteClient(remote.host, remote.key)
+	}
+	if socket == "" {
+		socket = SocketPath()
+	}
+	var dialer net.Dialer
+	return &Client{
+		socket: socket,
+		// The host is ignored, every request goes to the socket
+		base: "http://daemira",
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Status returns the state of the daemon's features
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Health measures CPU, memory and disk health
+func (c *Client) Health(ctx context.Context) (*HealthStatus, error) {
+	var health HealthStatus
+	if err := c.do(ctx, http.MethodGet, "/v1/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Live runs the daemon's liveness checks; a hung daemon answers with an
+// *Error naming the checks that failed, or not at all until ctx is done
+func (c *Client) Live(ctx context.Context) (*Liveness, error) {
+	var liveness Liveness
+	if err := c.do(ctx, http.MethodGet, "/v1/live", nil, &liveness); err != nil {
+		return nil, err
+	}
+	return &liveness, nil
+}
+
+// Stop shuts the daemon down, letting work in flight finish
+func (c *Client) Stop(ctx context.Context) (*Result, error) {
+	return c.result(ctx, "/v1/daemon/stop", nil)
+}
+
+// GDriveStatus returns the state of Google Drive sync
+func (c *Client) GDriveStatus(ctx context.Context) (*GDriveStatus, error) {
+	var status GDriveStatus
+	if err := c.do(ctx, http.MethodGet, "/v1/gdrive", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StartGDrive starts Google Drive sync
+func (c *Client) StartGDrive(ctx context.Context) (*Result, error) {
+	return c.result(ctx, "/v1/gdrive/start", nil)
+}
+
+// StopGDrive stops Google Drive sync once syncs in progress finished;
+// cancelling ctx interrupts them
+func (c *Client) StopGDrive(ctx context.Context) (*Result, error) {
+	return c.result(ctx, "/v1/gdrive/stop", nil)
+}
+
+// SyncGDrive queues a directory, or every directory if dir is empty, for
+// an immediate sync
+func (c *Client) SyncGDrive(ctx context.Context, dir string) (*Result, error) {
+	query := url.Values{}
+	if dir != "" {
+		query.Set("dir", dir)
+	}
+	return c.result(ctx, "/v1/gdrive/sync", query)
+}
+
+// ResyncGDrive rebuilds a directory's bisync cache and syncs deletions,
+// returning once it is done
+func (c *Client) ResyncGDrive(ctx context.Context, dir string) (*Result, error) {
+	return c.result(ctx, "/v1/gdrive/resync", url.Values{"dir": {dir}})
+}
+
+// SystemUpdateStatus returns the state of the system update scheduler
+func (c *Client) SystemUpdateStatus(ctx context.Context) (*UpdateStatus, error) {
+	var status UpdateStatus
+	if err := c.do(ctx, http.MethodGet, "/v1/system/update", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// RunSystemUpdate starts a system update, and with wait returns only once
+// it finished. Cancelling ctx stops waiting, not the update.
+func (c *Client) RunSystemUpdate(ctx context.Context, wait bool) (*Result, error) {
+	query := url.Values{}
+	if wait {
+		query.Set("wait", "true")
+	}
+	return c.result(ctx, "/v1/system/update", query)
+}
+
+// NotionStatus returns the state of Notion sync
+func (c *Client) NotionStatus(ctx context.Context) (*NotionStatus, error) {
+	var status NotionStatus
+	if err := c.do(ctx, http.MethodGet, "/v1/notion", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SyncNotion syncs the configured paths and vault with Notion now,
+// returning once it is done
+func (c *Client) SyncNotion(ctx context.Context) (*Result, error) {
+	return c.result(ctx, "/v1/notion/sync", nil)
+}
+
+// Jobs returns the scheduled jobs
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	if err := c.do(ctx, http.MethodGet, "/v1/jobs", nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// RunJob runs a job now, disabled or not, and with wait returns only once
+// it finished. Cancelling ctx stops waiting, not the job.
+func (c *Client) RunJob(ctx context.Context, id string, wait bool) (*Result, error) {
+	query := url.Values{}
+	if wait {
+		query.Set("wait", "true")
+	}
+	return c.result(ctx, "/v1/jobs/"+url.PathEscape(id)+"/run", query)
+}
+
+// Alerts returns the active alerts
+func (c *Client) Alerts(ctx context.Context) ([]Alert, error) {
+	var alerts []Alert
+	if err := c.do(ctx, http.MethodGet, "/v1/alerts", nil, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// AckAlert acknowledges an alert, so it isn't sent again unless it gets worse
+func (c *Client) AckAlert(ctx context.Context, id string) (*Result, error) {
+	return c.result(ctx, "/v1/alerts/"+url.PathEscape(id)+"/ack", nil)
+}
+
+// SilenceAlert keeps an alert from being sent for duration; 0 ends the silence
+func (c *Client) SilenceAlert(ctx context.Context, id string, duration time.Duration) (*Result, error) {
+	query := url.Values{}
+	query.Set("for", duration.String())
+	return c.result(ctx, "/v1/alerts/"+url.PathEscape(id)+"/silence", query)
+}
+
+// AcceptIntegrity records the current state of the watched config files
+// that changed: those at or under paths, or all of them without any
+func (c *Client) AcceptIntegrity(ctx context.Context, paths []string) (*Result, error) {
+	query := url.Values{}
+	for _, path := range paths {
+		query.Add("path", path)
+	}
+	return c.result(ctx, "/v1/security/integrity/accept", query)
+}
+
+// result runs an operation answered with a Result
+func (c *Client) result(ctx context.Context, path string, query url.Values) (*Result, error) {
+	var result Result
+	if err := c.do(ctx, http.MethodPost, path, query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// do sends a request and decodes the answer into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, out interface{}) error {
+	endpoint := c.base + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the daemon at %s (is it running?): %w", c.socket, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var errResp ErrorResponse
+		if json.Unmarshal(body, &errResp) != nil || errResp.Error == "" {
+			errResp.Error = resp.Status
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: errResp.Error}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
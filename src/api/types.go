@@ -0,0 +1,129 @@
+package api
+
+import "time"
+
+// Status is the running daemon's state, as returned by GET /v1/status
+type Status struct {
+	PID          int          `json:"pid"`
+	Started      time.Time    `json:"started"`
+	GDrive       GDriveStatus `json:"gdrive"`
+	SystemUpdate UpdateStatus `json:"system_update"`
+	NotionSync   NotionStatus `json:"notion_sync"`
+}
+
+// GDriveStatus is the state of Google Drive sync
+type GDriveStatus struct {
+	Enabled      bool              `json:"enabled"`
+	Running      bool              `json:"running"`
+	QueueSize    int               `json:"queue_size"`
+	Paused       string            `json:"paused,omitempty"` // why syncs are held, e.g. no VPN up
+	SyncInterval time.Duration     `json:"sync_interval"`
+	Directories  []DirectoryStatus `json:"directories"`
+}
+
+// DirectoryStatus is the sync state of one directory
+type DirectoryStatus struct {
+	Path     string    `json:"path"`
+	Status   string    `json:"status"` // idle, syncing or error
+	LastSync time.Time `json:"last_sync"`
+	Error    string    `json:"error,omitempty"`
+	RunLog   string    `json:"run_log,omitempty"` // full output of the latest sync
+}
+
+// UpdateStatus is the state of the system update scheduler
+type UpdateStatus struct {
+	Enabled    bool        `json:"enabled"`
+	Running    bool        `json:"running"`
+	LastUpdate time.Time   `json:"last_update"`
+	NextUpdate time.Time   `json:"next_update"`
+	History    []UpdateRun `json:"history"`
+}
+
+// UpdateRun is one finished system update
+type UpdateRun struct {
+	Time     time.Time     `json:"time"`
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	RunLogs  []string      `json:"run_logs,omitempty"`
+}
+
+// NotionStatus is the state of Notion sync
+type NotionStatus struct {
+	Enabled bool     `json:"enabled"`
+	Running bool     `json:"running"`
+	Queued  int      `json:"queued"`           // writes waiting for Notion to answer again
+	Paused  string   `json:"paused,omitempty"` // why scheduled syncs are held, e.g. no VPN up
+	Paths   []string `json:"paths,omitempty"`
+}
+
+// HealthStatus is a snapshot of CPU, memory, disk and firewall health
+type HealthStatus struct {
+	CPUUtilization float64       `json:"cpu_utilization"`
+	PowerProfile   string        `json:"power_profile,omitempty"`
+	MemoryUsedGB   float64       `json:"memory_used_gb"`
+	MemoryTotalGB  float64       `json:"memory_total_gb"`
+	SwapUsedGB     float64       `json:"swap_used_gb"`
+	DiskWarnings   []DiskWarning `json:"disk_warnings"`
+	Firewall       string        `json:"firewall"` // the active firewall, empty if none
+}
+
+// DiskWarning is a filesystem running low on space
+type DiskWarning struct {
+	MountPoint  string  `json:"mount_point"`
+	Level       string  `json:"level"` // warning or critical
+	FreeGB      float64 `json:"free_gb"`
+	PercentUsed float64 `json:"percent_used"`
+}
+
+// Liveness tells whether the daemon is hung, as returned by GET /v1/live;
+// the status is 503 when it is
+type Liveness struct {
+	Alive  bool            `json:"alive"`
+	Checks []LivenessCheck `json:"checks"`
+	Error  string          `json:"error,omitempty"` // the failed checks
+}
+
+// LivenessCheck is a worker heartbeat or a lock probed
+type LivenessCheck struct {
+	Name   string `json:"name"`
+	Alive  bool   `json:"alive"`
+	Detail string `json:"detail"`
+}
+
+// Job is a scheduled job, as returned by GET /v1/jobs
+type Job struct {
+	ID           string        `json:"id"`
+	Description  string        `json:"description"`
+	Schedule     string        `json:"schedule"`   // e.g. "every 6h" or "0 4 * * *"
+	Overridden   bool          `json:"overridden"` // schedule set in jobs.schedules
+	Enabled      bool          `json:"enabled"`
+	Timer        bool          `json:"timer,omitempty"` // run by its systemd timer instead
+	Running      bool          `json:"running"`
+	NextRun      time.Time     `json:"next_run"` // zero while disabled
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	Runs         int           `json:"runs"` // kept across restarts
+}
+
+// Alert is an active problem, as returned by GET /v1/alerts
+type Alert struct {
+	ID            string    `json:"id"`
+	Severity      string    `json:"severity"` // warning or critical
+	Summary       string    `json:"summary"`
+	Detail        string    `json:"detail,omitempty"`
+	Raised        time.Time `json:"raised"`
+	Acknowledged  time.Time `json:"acknowledged"`
+	SilencedUntil time.Time `json:"silenced_until"`
+}
+
+// Result is the answer to an operation
+type Result struct {
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of a failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,108 @@
+/**
+ * Waybar - Sync status as a Waybar custom module
+ * Waybar's custom modules read {"text", "alt", "tooltip", "class"} JSON
+ * from a command (with "return-type": "json"). `daemira gdrive status
+ * --waybar` prints it, and the daemon keeps GDriveWaybarPath up to date,
+ * so a bar can show the sync without a script.
+ */
+
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Waybar module classes of the Google Drive sync, also its alt for format-icons
+const (
+	WaybarSynced   = "synced"
+	WaybarSyncing  = "syncing"
+	WaybarError    = "error"
+	WaybarPaused   = "paused"
+	WaybarStopped  = "stopped"
+	WaybarDisabled = "disabled"
+)
+
+// Waybar is the output of a Waybar custom module
+type Waybar struct {
+	Text    string `json:"text"`
+	Alt     string `json:"alt"`
+	Tooltip string `json:"tooltip"`
+	Class   string `json:"class"`
+}
+
+// GDriveWaybarPath returns the file the daemon keeps the sync's Waybar
+// module in ($XDG_RUNTIME_DIR/daemira/gdrive-waybar.json)
+func GDriveWaybarPath() string {
+	return filepath.Join(utility.RuntimeDir(), "gdrive-waybar.json")
+}
+
+// GDriveWaybar renders the state of Google Drive sync as a Waybar module:
+// errors first, then syncs running, paused and synced
+func GDriveWaybar(status GDriveStatus) Waybar {
+	switch {
+	case !status.Enabled:
+		return Waybar{Text: "–", Alt: WaybarDisabled, Class: WaybarDisabled, Tooltip: "Google Drive sync is disabled"}
+	case !status.Running:
+		return Waybar{Text: "–", Alt: WaybarStopped, Class: WaybarStopped, Tooltip: "Google Drive sync is not running"}
+	}
+
+	var syncing, failed int
+	lines := make([]string, 0, len(status.Directories)+2)
+	for _, directory := range status.Directories {
+		line := directory.Path + ": "
+		switch directory.Status {
+		case "syncing":
+			syncing++
+			line += "syncing"
+		case "error":
+			failed++
+			line += "failed"
+			if directory.Error != "" {
+				line += " (" + directory.Error + ")"
+			}
+		default:
+			if directory.LastSync.IsZero() {
+				line += "not synced yet"
+			} else {
+				line += "synced " + waybarTime(directory.LastSync)
+			}
+		}
+		lines = append(lines, line)
+	}
+	if status.QueueSize > 0 {
+		lines = append(lines, fmt.Sprintf("%d queued", status.QueueSize))
+	}
+
+	module := Waybar{Text: "✓", Class: WaybarSynced}
+	switch {
+	case failed > 0:
+		module = Waybar{Text: fmt.Sprintf("✗ %d", failed), Class: WaybarError}
+	case syncing > 0:
+		module = Waybar{Text: "↻", Class: WaybarSyncing}
+	case status.Paused != "":
+		module = Waybar{Text: "⏸", Class: WaybarPaused}
+	}
+	if status.Paused != "" {
+		lines = append([]string{"Paused: " + status.Paused}, lines...)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No directories synced")
+	}
+	module.Alt = module.Class
+	module.Tooltip = strings.Join(lines, "\n")
+	return module
+}
+
+// waybarTime writes when a directory last synced; the daemon rewrites the
+// file only on changes, so the time is absolute rather than an age
+func waybarTime(t time.Time) string {
+	if t.Format(time.DateOnly) == time.Now().Format(time.DateOnly) {
+		return "at " + t.Format("15:04")
+	}
+	return "on " + t.Format("Jan 2 15:04")
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createAlertsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "alerts",
+		Short:        "Problems found by the health checks (low disk space, failing SMART checks, no firewall)",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listAlerts()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List the active alerts, new and known",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listAlerts()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "ack <id>",
+		Short:             "Acknowledge an alert, so it isn't sent again unless it gets worse",
+		Args:              cobra.ExactArgs(1),
+		SilenceUsage:      true,
+		ValidArgsFunction: completeFirst(alertIDs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, err := api.NewClient("").AckAlert(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.Message)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "silence <id> [duration]",
+		Short: "Stop sending an alert for a while (24h by default; 0 ends the silence)",
+		Args:  cobra.RangeArgs(1, 2),
+		Example: "  daemira alerts silence disk-home 24h\n" +
+			"  daemira alerts silence smart-sda 0",
+		SilenceUsage:      true,
+		ValidArgsFunction: completeFirst(alertIDs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			duration := 24 * time.Hour
+			if len(args) == 2 {
+				if args[1] == "0" {
+					duration = 0
+				} else {
+					parsed, err := time.ParseDuration(args[1])
+					if err != nil || parsed < 0 {
+						return fmt.Errorf("invalid duration %q (e.g. 30m, 24h or 0)", args[1])
+					}
+					duration = parsed
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, err := api.NewClient("").SilenceAlert(ctx, args[0], duration)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.Message)
+			return nil
+		},
+	})
+
+	// All of them only talk to the daemon
+	allowRemote(append([]*cobra.Command{cmd}, cmd.Commands()...)...)
+
+	return cmd
+}
+
+// listAlerts prints the active alerts
+func listAlerts() error {
+	alerts, running := activeAlerts()
+	if !running && api.Remote() != "" {
+		return fmt.Errorf("the daemon on %s didn't answer", api.Remote())
+	}
+	if !running {
+		fmt.Print("Daemon not running; these are the alerts it last saw\n\n")
+	}
+	if len(alerts) == 0 {
+		fmt.Println("No alerts")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-9s %-22s %s\n", "ALERT", "SEVERITY", "STATE", "SUMMARY")
+	for _, alert := range alerts {
+		fmt.Printf("%-20s %-9s %-22s %s\n", alert.ID, alert.Severity, alertState(alert), alert.Summary)
+		if alert.Detail != "" {
+			fmt.Printf("%-20s %s\n", "", alert.Detail)
+		}
+	}
+	return nil
+}
+
+// activeAlerts returns the daemon's alerts and whether it answered; when it
+// doesn't, the alerts it saved last
+func activeAlerts() ([]api.Alert, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if alerts, err := api.NewClient("").Alerts(ctx); err == nil {
+		return alerts, true
+	}
+	// The alerts saved here are this machine's
+	if api.Remote() != "" {
+		return nil, false
+	}
+
+	var alerts []api.Alert
+	for _, alert := range utility.GetAlerts().List() {
+		alerts = append(alerts, api.Alert{
+			ID:            alert.ID,
+			Severity:      alert.Severity,
+			Summary:       alert.Summary,
+			Detail:        alert.Detail,
+			Raised:        alert.Raised,
+			Acknowledged:  alert.Acknowledged,
+			SilencedUntil: alert.SilencedUntil,
+		})
+	}
+	return alerts, false
+}
+
+// alertKnown reports whether an alert was acknowledged or is silenced
+func alertKnown(alert api.Alert) bool {
+	return !alert.Acknowledged.IsZero() || time.Now().Before(alert.SilencedUntil)
+}
+
+// alertState describes whether an alert is new, acknowledged or silenced
+func alertState(alert api.Alert) string {
+	switch {
+	case time.Now().Before(alert.SilencedUntil):
+		return fmt.Sprintf("silenced for %s", formatAge(time.Until(alert.SilencedUntil)))
+	case !alert.Acknowledged.IsZero():
+		return "acknowledged"
+	default:
+		return fmt.Sprintf("new, %s ago", formatAge(time.Since(alert.Raised)))
+	}
+}
+
+// alertsSummary describes the active alerts for `daemira status`, new ones
+// apart from those already known
+func alertsSummary() string {
+	alerts, _ := activeAlerts()
+	if len(alerts) == 0 {
+		return "Alerts: None\n"
+	}
+
+	var fresh, known []api.Alert
+	for _, alert := range alerts {
+		if alertKnown(alert) {
+			known = append(known, alert)
+		} else {
+			fresh = append(fresh, alert)
+		}
+	}
+	output := fmt.Sprintf("Alerts: %d new, %d known\n", len(fresh), len(known))
+	for _, alert := range append(fresh, known...) {
+		icon := "🟡"
+		if alert.Severity == utility.AlertCritical {
+			icon = "🔴"
+		}
+		output += fmt.Sprintf("  %s %s: %s (%s)\n", icon, alert.ID, alert.Summary, alertState(alert))
+	}
+	if len(fresh) > 0 {
+		output += "  Acknowledge with: daemira alerts ack <id>\n"
+	}
+	return output
+}
+
+// alertIDs lists the active alerts, with their summaries
+func alertIDs() []string {
+	alerts, _ := activeAlerts()
+	ids := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		ids = append(ids, alert.ID+"\t"+alert.Summary)
+	}
+	return ids
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/features/backup"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "backup",
+		Short:        "Backups of directories with restic or borg",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Print(c.backupStatus())
+			return nil
+		},
+	}
+
+	var watch watchOptions
+	statusCmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show the last backup and check, and when the next ones run",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return watch.show(cmd, func() (string, error) {
+				return c.backupStatus(), nil
+			})
+		},
+	}
+	addWatchFlags(statusCmd, &watch)
+	cmd.AddCommand(statusCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "init",
+		Short:        "Create the repository set in backup.repository",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := c.daemon.NewBackup(context.Background())
+			if err != nil {
+				return err
+			}
+			if err := b.Init(context.Background()); err != nil {
+				return err
+			}
+			fmt.Printf("Created %s repository %s\n", b.Tool(), c.daemon.GetConfig().BackupRepository)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "run",
+		Short:        "Back up now, then prune snapshots beyond the retention",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := c.daemon.NewBackup(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Backing up with %s...\n", b.Tool())
+			if err := b.Run(context.Background()); err != nil {
+				if log := b.GetStatus().RunLog; log != "" {
+					return fmt.Errorf("%w\nFull output: %s", err, log)
+				}
+				return err
+			}
+			status := b.GetStatus()
+			fmt.Printf("Backed up in %s: snapshot %s", formatDuration(status.LastDuration), status.LastSnapshot)
+			if status.Pruned > 0 {
+				fmt.Printf(", %d old snapshots pruned", status.Pruned)
+			}
+			fmt.Println()
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "check",
+		Short:        "Check the repository and a sample of its data",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := c.daemon.NewBackup(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Checking %s...\n", c.daemon.GetConfig().BackupRepository)
+			if err := b.Check(context.Background()); err != nil {
+				return err
+			}
+			fmt.Println("Repository is healthy")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List the snapshots in the repository",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := c.daemon.NewBackup(context.Background())
+			if err != nil {
+				return err
+			}
+			snapshots, err := b.Snapshots(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(snapshots) == 0 {
+				fmt.Println("No snapshots yet. Back up with: daemira backup run")
+				return nil
+			}
+			fmt.Printf("%-32s %-17s %-12s %s\n", "SNAPSHOT", "TIME", "HOST", "PATHS")
+			for _, snapshot := range snapshots {
+				paths := make([]string, len(snapshot.Paths))
+				for idx, path := range snapshot.Paths {
+					paths[idx] = shortenHome(path)
+				}
+				fmt.Printf("%-32s %-17s %-12s %s\n", snapshot.ID, snapshot.Time.Local().Format("2006-01-02 15:04"), snapshot.Host, strings.Join(paths, ", "))
+			}
+			return nil
+		},
+	})
+
+	var include []string
+	var force bool
+	restoreCmd := &cobra.Command{
+		Use:          "restore <snapshot> <path>",
+		Short:        "Restore a snapshot (or \"latest\") into a directory",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := c.daemon.NewBackup(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Restoring %s to %s...\n", args[0], args[1])
+			log, err := b.Restore(context.Background(), args[0], args[1], include, force)
+			if err != nil {
+				if log != "" {
+					return fmt.Errorf("%w\nFull output: %s", err, log)
+				}
+				return err
+			}
+			fmt.Printf("Restored %s to %s\n", args[0], args[1])
+			return nil
+		},
+	}
+	restoreCmd.Flags().StringArrayVar(&include, "include", nil, "Only restore this path of the snapshot (repeatable)")
+	restoreCmd.Flags().BoolVar(&force, "force", false, "Restore into a directory that isn't empty, overwriting its files")
+	cmd.AddCommand(restoreCmd)
+
+	return cmd
+}
+
+// backupStatus describes the last backup and check the daemon saved, and
+// its next runs when it is running
+func (c *CLI) backupStatus() string {
+	cfg := c.daemon.GetConfig()
+	if !cfg.BackupEnabled {
+		return "Backups: Disabled\n"
+	}
+	if cfg.BackupRepository == "" {
+		return "Backups: Not configured (set backup.repository and backup.password, then run daemira backup init)\n"
+	}
+
+	status := backup.LoadStatus()
+	output := "=== Backups ===\n\n"
+	output += fmt.Sprintf("Tool: %s\n", cfg.BackupTool)
+	output += fmt.Sprintf("Repository: %s\n", cfg.BackupRepository)
+	output += "Directories:\n"
+	for _, dir := range cfg.GetBackupDirectories() {
+		output += fmt.Sprintf("  %s\n", shortenHome(dir))
+	}
+	output += fmt.Sprintf("Retention: %s\n\n", backup.Retention{
+		Daily:   cfg.BackupKeepDaily,
+		Weekly:  cfg.BackupKeepWeekly,
+		Monthly: cfg.BackupKeepMonthly,
+	})
+
+	if status.LastRun.IsZero() {
+		output += "Last backup: Never\n"
+	} else {
+		outcome := "ok"
+		if status.LastError != "" {
+			outcome = "failed"
+		}
+		output += fmt.Sprintf("Last backup: %s ago, %s (%s)", formatAge(time.Since(status.LastRun)), outcome, formatDuration(status.LastDuration))
+		if status.LastSnapshot != "" {
+			output += ", snapshot " + status.LastSnapshot
+		}
+		output += "\n"
+		if status.LastError != "" {
+			output += fmt.Sprintf("  %s\n", status.LastError)
+			if !status.LastSuccess.IsZero() {
+				output += fmt.Sprintf("  Last successful backup: %s ago\n", formatAge(time.Since(status.LastSuccess)))
+			}
+		}
+		if status.RunLog != "" {
+			output += fmt.Sprintf("  Full output: %s\n", status.RunLog)
+		}
+	}
+	if status.LastCheck.IsZero() {
+		output += "Last check: Never\n"
+	} else if status.LastCheckError != "" {
+		output += fmt.Sprintf("Last check: %s ago, failed\n  %s\n", formatAge(time.Since(status.LastCheck)), status.LastCheckError)
+	} else {
+		output += fmt.Sprintf("Last check: %s ago, ok\n", formatAge(time.Since(status.LastCheck)))
+	}
+
+	// Next runs are the daemon's to know
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if jobs, err := api.NewClient("").Jobs(ctx); err == nil {
+		for _, job := range jobs {
+			var label string
+			switch job.ID {
+			case "backup":
+				label = "Next backup"
+			case "backup-check":
+				label = "Next check"
+			default:
+				continue
+			}
+			switch {
+			case job.Running:
+				output += fmt.Sprintf("%s: running now\n", label)
+			case !job.NextRun.IsZero():
+				output += fmt.Sprintf("%s: in %s\n", label, formatAge(time.Until(job.NextRun)))
+			}
+		}
+	} else {
+		output += "Daemon not running; no backups are scheduled\n"
+	}
+
+	return utility.Redact(output)
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createBootCmd() *cobra.Command {
+	var units, boots int
+	cmd := &cobra.Command{
+		Use:          "boot",
+		Short:        "Show how long the last boot took, the slowest units and the trend across boots",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printBootAnalysis(units, boots)
+		},
+	}
+	cmd.Flags().IntVarP(&units, "units", "n", 15, "Number of the slowest units to show")
+	cmd.Flags().IntVar(&boots, "boots", 10, "Number of recorded boots to show")
+	return cmd
+}
+
+// printBootAnalysis prints systemd-analyze's view of the current boot and
+// how it compares with the boots the daemon recorded
+func (c *CLI) printBootAnalysis(units, boots int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	bm := systemhealth.GetBootMonitor()
+	history := bm.History()
+
+	boot, err := bm.Analyze(ctx)
+	switch {
+	case errors.Is(err, systemhealth.ErrBootNotFinished):
+		fmt.Println("Boot: not finished yet (systemd is still starting units)")
+	case err != nil:
+		return err
+	default:
+		fmt.Printf("Boot: %s = %s\n", formatBootTotal(boot.Total), boot.Stages())
+		if !boot.Booted.IsZero() {
+			fmt.Printf("Booted: %s\n", formatTime(boot.Booted))
+		}
+		if len(history) == 0 || history[len(history)-1].ID != boot.ID {
+			history = append(history, boot)
+		}
+
+		blame := boot.Blame
+		if units > 0 && len(blame) > units {
+			blame = blame[:units]
+		}
+		if len(blame) > 0 {
+			fmt.Printf("\n%-9s %s\n", "TIME", "UNIT")
+			for _, unit := range blame {
+				fmt.Printf("%-9s %s\n", formatBootTotal(unit.Duration), unit.Name)
+			}
+		}
+	}
+
+	if len(history) < 2 {
+		fmt.Println("\nNo earlier boots recorded yet; the daemon records each boot once it finishes")
+		return nil
+	}
+	shown := history
+	if boots > 0 && len(shown) > boots {
+		shown = shown[len(shown)-boots:]
+	}
+	fmt.Printf("\n%-18s %-9s %s\n", "BOOTED", "TOTAL", "CHANGE")
+	offset := len(history) - len(shown)
+	for idx, past := range shown {
+		change := ""
+		if previous := offset + idx - 1; previous >= 0 {
+			delta := past.Total - history[previous].Total
+			sign := "+"
+			if delta < 0 {
+				sign, delta = "-", -delta
+			}
+			change = sign + formatBootTotal(delta)
+		}
+		booted := "unknown"
+		if !past.Booted.IsZero() {
+			booted = past.Booted.Format("2006-01-02 15:04")
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("%-18s %-9s %s", booted, formatBootTotal(past.Total), change), " "))
+	}
+
+	if regression, ok := systemhealth.FindBootRegression(history, c.daemon.GetConfig().BootRegression); ok {
+		fmt.Printf("\n⚠️  %s\n   %s\n", regression.Summary(), regression.Causes())
+	}
+	return nil
+}
+
+// formatBootTotal rounds a boot duration, e.g. "21.4s" or "1m12s"
+func formatBootTotal(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
@@ -2,16 +2,28 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	daemira "github.com/ln64-git/daemira/internal"
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/config"
 	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/dotfiles"
 	"github.com/ln64-git/daemira/src/features/installer"
+	"github.com/ln64-git/daemira/src/features/network"
+	notionsync "github.com/ln64-git/daemira/src/features/notion-sync"
 	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
 	systemupdate "github.com/ln64-git/daemira/src/features/system-update"
+	"github.com/ln64-git/daemira/src/features/wallpaper"
 	"github.com/ln64-git/daemira/src/utility"
 	"github.com/spf13/cobra"
 )
@@ -20,13 +32,15 @@ import (
 type CLI struct {
 	daemon *daemira.Daemira
 	logger *utility.Logger
+	start  func() *daemira.Daemira
 }
 
-// NewCLI creates a new CLI instance
-func NewCLI(daemon *daemira.Daemira, logger *utility.Logger) *CLI {
+// NewCLI creates a new CLI instance. start loads the config and creates the
+// daemon, once the command to run, and with it where logs go, is known.
+func NewCLI(logger *utility.Logger, start func() *daemira.Daemira) *CLI {
 	return &CLI{
-		daemon: daemon,
 		logger: logger,
+		start:  start,
 	}
 }
 
@@ -40,50 +54,126 @@ func (c *CLI) CreateCommands() *cobra.Command {
 			c.logger.Info("Daemira v%s", "0.1.0")
 			c.logger.Info("Starting daemon services...")
 
-			if err := c.daemon.Start(); err != nil {
-				c.logger.Error("Failed to start daemon: %v", err)
+			err := c.runDaemon(func() {
+				c.logger.Info("Daemon is running. Press Ctrl+C to stop.")
+				c.logger.Info("")
+				c.logger.Info("To check status, run in another terminal: ./bin/daemira status")
+				c.logger.Info("Or: ./bin/daemira gdrive status")
+				c.logger.Info("")
+			})
+			if err != nil {
+				c.logger.Error("%v", err)
 				os.Exit(1)
 			}
+		},
+	}
 
-			c.logger.Info("Daemon is running. Press Ctrl+C to stop.")
-			c.logger.Info("")
-			c.logger.Info("To check status, run in another terminal: ./bin/daemira status")
-			c.logger.Info("Or: ./bin/daemira gdrive status")
-			c.logger.Info("")
+	// Errors may quote command output holding a token
+	rootCmd.SetErr(utility.RedactWriter(os.Stderr))
 
-			// Keep process alive
-			select {}
-		},
+	// Commands allowing it can run against another machine's daemon
+	var host string
+	rootCmd.PersistentFlags().StringVar(&host, "host", "", "Run against the daemon on another machine in the tailnet (api.tailnet on there), e.g. laptop")
+	// Commands' own persistent hooks would replace this one
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if output := logOutput(cmd); output != nil {
+			c.logger.SetOutput(output)
+		}
+		c.daemon = c.start()
+		if host == "" {
+			return nil
+		}
+		return c.useRemote(cmd, host)
 	}
 
 	// Add subcommands
 	rootCmd.AddCommand(c.createStatusCmd())
+	rootCmd.AddCommand(c.createTopCmd())
+	rootCmd.AddCommand(c.createJobsCmd())
+	rootCmd.AddCommand(c.createGenerateTimersCmd())
+	rootCmd.AddCommand(c.createAlertsCmd())
+	rootCmd.AddCommand(c.createFleetCmd())
 	rootCmd.AddCommand(c.createDaemonCmd())
+	rootCmd.AddCommand(c.createHelperCmd())
 	rootCmd.AddCommand(c.createInstallCmd())
+	rootCmd.AddCommand(c.createDotfilesCmd())
 	rootCmd.AddCommand(c.createGDriveCmd())
+	rootCmd.AddCommand(c.createBackupCmd())
+	rootCmd.AddCommand(c.createSnapshotsCmd())
+	rootCmd.AddCommand(c.createNotionCmd())
 	rootCmd.AddCommand(c.createSystemCmd())
 	rootCmd.AddCommand(c.createStorageCmd())
 	rootCmd.AddCommand(c.createPerformanceCmd())
 	rootCmd.AddCommand(c.createMemoryCmd())
+	rootCmd.AddCommand(c.createSecurityCmd())
+	rootCmd.AddCommand(c.createUSBCmd())
+	rootCmd.AddCommand(c.createNetworkCmd())
 	rootCmd.AddCommand(c.createDesktopCmd())
+	rootCmd.AddCommand(c.createDNDCmd())
+	rootCmd.AddCommand(c.createConfigCmd())
+	rootCmd.AddCommand(c.createLogsCmd())
+	rootCmd.AddCommand(c.createDiagnosticsCmd())
+	rootCmd.AddCommand(c.createDoctorCmd())
+	rootCmd.AddCommand(c.createAuditCmd())
+
+	// Completion scripts are read from stdout
+	rootCmd.InitDefaultCompletionCmd()
+	if completionCmd, _, err := rootCmd.Find([]string{"completion"}); err == nil && completionCmd != rootCmd {
+		logTo(logsToStderr, completionCmd)
+	}
 
 	return rootCmd
 }
 
+// shutdownTimeout is how long work in flight gets to finish once the
+// daemon is asked to stop; the service's TimeoutStopSec leaves room for it
+const shutdownTimeout = 4 * time.Minute
+
+// runUntilSignal blocks until SIGINT or SIGTERM, then shuts the daemon down
+// gracefully; a second signal stops waiting for work in flight
+func (c *CLI) runUntilSignal() error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	sig := <-signals
+	c.logger.Info("Received %v, shutting down (send it again to stop at once)...", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-signals:
+			c.logger.Warn("Interrupting work in flight")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return c.daemon.Shutdown(ctx)
+}
+
 func (c *CLI) createStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	var watch watchOptions
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show comprehensive system status",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			status, err := c.getSystemStatus(ctx)
-			if err != nil {
-				return err
-			}
-			fmt.Println(status)
-			return nil
+			return watch.show(cmd, func() (string, error) {
+				getStatus := c.getSystemStatus
+				if api.Remote() != "" {
+					getStatus = c.getRemoteStatus
+				}
+				status, err := getStatus(context.Background())
+				if err != nil {
+					return "", err
+				}
+				return utility.Redact(status) + "\n", nil
+			})
 		},
 	}
+	addWatchFlags(cmd, &watch)
+	allowRemote(cmd)
+	return cmd
 }
 
 func (c *CLI) createDaemonCmd() *cobra.Command {
@@ -92,50 +182,196 @@ func (c *CLI) createDaemonCmd() *cobra.Command {
 		Short: "Daemon management commands",
 	}
 
-	cmd.AddCommand(&cobra.Command{
-		Use:   "start",
-		Short: "Start the daemon",
+	var foreground bool
+	startCmd := &cobra.Command{
+		Use:          "start",
+		Short:        "Start the daemon in the background",
+		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c.logger.Info("Starting Daemira daemon...")
-			if err := c.daemon.Start(); err != nil {
-				return err
+			if foreground {
+				c.logger.Info("Starting Daemira daemon...")
+				return c.runDaemon(func() {
+					c.logger.Info("Daemon mode: Running in foreground")
+					c.logger.Info("Press Ctrl+C to stop")
+				})
 			}
-			c.logger.Info("Daemon mode: Running in foreground")
-			c.logger.Info("Press Ctrl+C to stop")
-			select {}
+			return c.startDetached()
+		},
+	}
+	startCmd.Flags().BoolVarP(&foreground, "foreground", "f", false, "Run in the foreground until Ctrl+C")
+	cmd.AddCommand(startCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "stop",
+		Short:        "Stop the running daemon, letting work in flight finish",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.stopDaemon()
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "stop",
-		Short: "Stop the daemon",
+		Use:          "restart",
+		Short:        "Stop the running daemon and start it again in the background",
+		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			gd := c.daemon.GetGoogleDrive()
-			if gd != nil {
-				if err := gd.Stop(); err != nil {
-					return err
-				}
+			if err := c.stopDaemon(); err != nil {
+				return err
 			}
-			c.logger.Info("Daemon stopped")
-			return nil
+			return c.startDetached()
 		},
 	})
 
-	cmd.AddCommand(&cobra.Command{
+	var statusWatch watchOptions
+	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Check daemon status",
-		Run: func(cmd *cobra.Command, args []string) {
-			status := c.getGoogleDriveSyncStatus()
-			fmt.Println(status)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return statusWatch.show(cmd, func() (string, error) {
+				var output string
+				if pid := utility.DaemonPID(); pid != 0 {
+					output += fmt.Sprintf("Daemon: running (pid %d)\n", pid)
+					ctx, cancel := context.WithTimeout(context.Background(), liveTimeout)
+					if _, err := api.NewClient("").Live(ctx); err != nil {
+						output += fmt.Sprintf("Liveness: %v\n\n", err)
+					} else {
+						output += "Liveness: ok\n\n"
+					}
+					cancel()
+				} else {
+					output += "Daemon: not running\n\n"
+				}
+				return output + utility.Redact(c.getGoogleDriveSyncStatus(false)) + "\n", nil
+			})
+		},
+	}
+	addWatchFlags(statusCmd, &statusWatch)
+	cmd.AddCommand(statusCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "live",
+		Short:        "Run the daemon's liveness checks; exits with status 1 if it is hung",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), liveTimeout)
+			defer cancel()
+			liveness, err := api.NewClient("").Live(ctx)
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("daemon didn't answer within %v (hung?)", liveTimeout)
+				}
+				return err
+			}
+			for _, check := range liveness.Checks {
+				fmt.Printf("%-16s ok  %s\n", check.Name, check.Detail)
+			}
+			fmt.Println("Daemon is alive")
+			return nil
 		},
 	})
 
 	return cmd
 }
 
+// liveTimeout is how long the daemon gets to answer a liveness check,
+// longer than a probe may take
+const liveTimeout = 10 * time.Second
+
+// daemonStartTimeout is how long `daemon start` waits for the daemon it
+// detached to come up
+const daemonStartTimeout = 10 * time.Second
+
+// daemonStopTimeout is how long `daemon stop` waits for the daemon to exit,
+// a little longer than the daemon gives work in flight
+const daemonStopTimeout = shutdownTimeout + 30*time.Second
+
+// runDaemon runs the daemon in this process until it is signalled,
+// recording its PID for `daemon stop`; started is called once it runs
+func (c *CLI) runDaemon(started func()) error {
+	release, err := utility.WritePIDFile()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := c.daemon.Start(); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+	started()
+	return c.runUntilSignal()
+}
+
+// startDetached starts the daemon in the background and waits until it
+// has recorded its PID
+func (c *CLI) startDetached() error {
+	if pid := utility.DaemonPID(); pid != 0 {
+		return fmt.Errorf("daemira is already running (pid %d)", pid)
+	}
+
+	process, err := utility.Detach("daemon", "start", "--foreground")
+	if err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		_, _ = process.Wait()
+		close(exited)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(daemonStartTimeout)
+	for {
+		select {
+		case <-exited:
+			return fmt.Errorf("daemon exited while starting; see %s", utility.DaemonOutputPath())
+		case <-deadline:
+			return fmt.Errorf("daemon (pid %d) didn't start within %v; see %s", process.Pid, daemonStartTimeout, utility.DaemonOutputPath())
+		case <-ticker.C:
+			if utility.DaemonPID() == process.Pid {
+				fmt.Printf("Daemon started in the background (pid %d)\n", process.Pid)
+				fmt.Printf("Logs: daemira logs -f (output in %s)\n", utility.DaemonOutputPath())
+				return nil
+			}
+		}
+	}
+}
+
+// stopDaemon sends SIGTERM to the running daemon and waits for it to exit
+func (c *CLI) stopDaemon() error {
+	pid := utility.DaemonPID()
+	if pid == 0 {
+		fmt.Println("Daemon is not running")
+		return nil
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to signal daemon (pid %d): %w", pid, err)
+	}
+	fmt.Printf("Stopping daemon (pid %d), letting work in flight finish...\n", pid)
+
+	deadline := time.Now().Add(daemonStopTimeout)
+	for time.Now().Before(deadline) {
+		if utility.DaemonPID() != pid {
+			fmt.Println("Daemon stopped")
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("daemon (pid %d) still running after %v", pid, daemonStopTimeout)
+}
+
 func (c *CLI) createInstallCmd() *cobra.Command {
 	var noTUI bool
 	var stepID string
+	var manifestPath string
+	var profile string
+	var dryRun bool
+	var resume bool
+	var jobs int
+	var acceptScriptChanges bool
+	var unattended bool
+	var root string
 
 	cmd := &cobra.Command{
 		Use:   "install",
@@ -144,33 +380,292 @@ func (c *CLI) createInstallCmd() *cobra.Command {
 
 This will install:
   - DKMS (DankLinux)
-  - Hyprland config
-  - DMS config
+  - Dotfiles (Hyprland and DMS config)
   - Core packages
   - User applications
-  - System services`,
+  - Flatpak applications (Flathub)
+  - System services
+  - Daemira itself, as an enabled user service
+
+Package, application, Flatpak, service and group lists come from a YAML or TOML
+manifest (--manifest, or ~/.config/daemira/install.yaml|toml), falling
+back to the built-in one. Profiles (minimal, full, gaming) adjust the lists.
+
+--unattended runs without prompts for arch-chroot or a fresh VM: logs go to
+stderr, JSON progress lines to stdout, and the exit code gives the failure
+class (2 config, 3 unsupported system, 4 step failed, 5 incomplete,
+6 script verification). --root installs the system steps into another root.
+
+Steps that fail with a network error are retried with backoff. Per-step
+timeouts and retries can be set under "steps" in the manifest, and the
+summary tells timeouts, network and build failures apart.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				inst, err := installer.NewInstaller(c.logger, &installer.InstallerOptions{
+					UseTUI:       !noTUI,
+					ManifestPath: manifestPath,
+					Profile:      profile,
+					DryRun:       dryRun,
+					Resume:       resume,
+					Jobs:         jobs,
+
+					AcceptScriptChanges: acceptScriptChanges,
+					Unattended:          unattended,
+					Root:                root,
+				})
+				if err != nil {
+					c.logger.Error("Failed to create installer: %v", err)
+					return err
+				}
+
+				// Steps are bounded by their own timeouts (see "steps" in the manifest)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				if stepID != "" {
+					c.logger.Info("Running specific step: %s", stepID)
+					return inst.RunStep(ctx, stepID)
+				}
+
+				return inst.Run(ctx)
+			}()
+
+			// Automation tells failure classes apart by exit code
+			if err != nil && unattended {
+				c.logger.Error("Error: %v", err)
+				os.Exit(installer.ExitCode(err))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&noTUI, "no-tui", false, "Run installer in headless mode (no TUI)")
+	cmd.Flags().StringVar(&stepID, "step", "", "Run a specific installation step by ID")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be installed and changed without doing it")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Resume an interrupted install, retrying failed steps")
+	cmd.Flags().IntVarP(&jobs, "jobs", "j", 3, "Independent steps to run at once")
+	cmd.Flags().BoolVar(&acceptScriptChanges, "accept-script-changes", false, "Run remote install scripts that changed since they were last run")
+	cmd.Flags().BoolVar(&unattended, "unattended", false, "Run without prompts, printing JSON progress on stdout (for chroots and VMs)")
+	logFlagTo(logsToStderr, cmd, "unattended")
+	cmd.Flags().StringVar(&root, "root", "", "Install the system steps into this root (e.g. /mnt) instead of the running system")
+	cmd.PersistentFlags().StringVar(&manifestPath, "manifest", "", "Install manifest (YAML or TOML)")
+	cmd.PersistentFlags().StringVar(&profile, "profile", "", "Manifest profiles to install, comma-separated (default: detected from the chassis type)")
+	_ = cmd.RegisterFlagCompletionFunc("step", completeValues(c.installStepIDs))
+	_ = cmd.RegisterFlagCompletionFunc("profile", completeValues(installProfiles))
+
+	var rollbackDryRun, rollbackList bool
+	rollbackCmd := &cobra.Command{
+		Use:               "rollback [step-id]",
+		Short:             "Undo the changes made by a step, or by the whole install",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeFirst(c.installStepIDs),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			useTUI := !noTUI
-			inst, err := installer.NewInstaller(c.logger, useTUI)
+			inst, err := installer.NewInstaller(c.logger, &installer.InstallerOptions{
+				ManifestPath: manifestPath,
+				Profile:      profile,
+				DryRun:       rollbackDryRun,
+			})
 			if err != nil {
-				c.logger.Error("Failed to create installer: %v", err)
 				return err
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
+			if rollbackList {
+				journal, err := installer.LoadJournal()
+				if err != nil {
+					return err
+				}
+				fmt.Println(journal.FormatJournal(inst.ListSteps()))
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 			defer cancel()
 
-			if stepID != "" {
-				c.logger.Info("Running specific step: %s", stepID)
-				return inst.RunStep(ctx, stepID)
+			stepID := ""
+			if len(args) > 0 {
+				stepID = args[0]
+			}
+			return inst.Rollback(ctx, stepID)
+		},
+	}
+	rollbackCmd.Flags().BoolVar(&rollbackDryRun, "dry-run", false, "Show what would be undone without doing it")
+	rollbackCmd.Flags().BoolVar(&rollbackList, "list", false, "List the recorded changes")
+	cmd.AddCommand(rollbackCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "manifest",
+		Short: "Validate the install manifest and show what the profile installs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := installer.LoadManifest(manifestPath)
+			if err != nil {
+				return err
+			}
+			if err := manifest.Validate(); err != nil {
+				return err
+			}
+			selected, note := profile, ""
+			if selected == "" {
+				var chassis string
+				selected, chassis = manifest.DetectProfile()
+				note = fmt.Sprintf(" (detected %s chassis)", chassis)
+			}
+			resolved, err := manifest.Resolve(selected)
+			if err != nil {
+				return err
 			}
 
-			return inst.Run(ctx)
+			fmt.Printf("Profiles: %s\n", strings.Join(manifest.ProfileNames(), ", "))
+			fmt.Printf("Profile: %s%s\n", selected, note)
+			fmt.Println(resolved.Summary())
+			return nil
 		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createDotfilesCmd() *cobra.Command {
+	var manifestPath string
+	var message string
+	var noPush bool
+
+	// The dotfiles repositories are declared in the install manifest
+	manager := func() (*dotfiles.Manager, error) {
+		manifest, err := installer.LoadManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := manifest.Validate(); err != nil {
+			return nil, err
+		}
+		if len(manifest.Dotfiles) == 0 {
+			return nil, fmt.Errorf("no dotfiles configured in %s", manifest.Source)
+		}
+		return dotfiles.NewManager(c.logger, manifest.Dotfiles, nil), nil
 	}
 
-	cmd.Flags().BoolVar(&noTUI, "no-tui", false, "Run installer in headless mode (no TUI)")
-	cmd.Flags().StringVar(&stepID, "step", "", "Run a specific installation step by ID")
+	status := func(cmd *cobra.Command, args []string) error {
+		m, err := manager()
+		if err != nil {
+			return err
+		}
+		repos, err := m.Find(args)
+		if err != nil {
+			return err
+		}
+		for _, repo := range repos {
+			links, err := m.Links(repo)
+			if err != nil {
+				fmt.Printf("%s: %v\n", repo.Name, err)
+				continue
+			}
+			fmt.Println(m.FormatStatus(repo, links))
+		}
+		return nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "dotfiles",
+		Short: "Deploy and track dotfiles repositories",
+		Long: `Deploy and track dotfiles repositories.
+
+Repositories are declared under "dotfiles" in the install manifest. Each is
+cloned into ~/.local/share/daemira/dotfiles and its files are symlinked into
+the repository's target directory; files in the way are backed up first.`,
+		RunE: status,
+	}
+	cmd.PersistentFlags().StringVar(&manifestPath, "manifest", "", "Install manifest (YAML or TOML)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status [name...]",
+		Short: "Show which dotfiles are linked",
+		RunE:  status,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "deploy [name...]",
+		Short: "Clone or update dotfiles and link them into place",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			repos, err := m.Find(args)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			for _, repo := range repos {
+				changes, err := m.Deploy(ctx, repo)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s: %d changes\n", repo.Name, len(changes))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "diff [name...]",
+		Short: "Show local changes not yet committed to the dotfiles repositories",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			repos, err := m.Find(args)
+			if err != nil {
+				return err
+			}
+
+			for _, repo := range repos {
+				diff, err := m.Diff(context.Background(), repo)
+				if err != nil {
+					return err
+				}
+				if diff == "" {
+					fmt.Printf("%s: no local changes\n", repo.Name)
+					continue
+				}
+				fmt.Printf("=== %s ===\n%s", repo.Name, diff)
+			}
+			return nil
+		},
+	})
+
+	commitCmd := &cobra.Command{
+		Use:   "commit [name...]",
+		Short: "Commit local dotfiles changes and push them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			repos, err := m.Find(args)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			for _, repo := range repos {
+				committed, err := m.Commit(ctx, repo, message, !noPush)
+				if err != nil {
+					return err
+				}
+				if !committed {
+					fmt.Printf("%s: nothing to commit\n", repo.Name)
+				}
+			}
+			return nil
+		},
+	}
+	commitCmd.Flags().StringVarP(&message, "message", "m", "", "Commit message")
+	commitCmd.Flags().BoolVar(&noPush, "no-push", false, "Commit without pushing")
+	cmd.AddCommand(commitCmd)
 
 	return cmd
 }
@@ -190,7 +685,7 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 			}
 			fmt.Println("Google Drive sync started")
 			fmt.Println("\nPress Ctrl+C to stop")
-			select {}
+			return c.runUntilSignal()
 		},
 	})
 
@@ -210,19 +705,39 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 		},
 	})
 
-	cmd.AddCommand(&cobra.Command{
+	var verbose, waybar bool
+	var watch watchOptions
+	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show Google Drive sync status",
-		Run: func(cmd *cobra.Command, args []string) {
-			status := c.getGoogleDriveSyncStatus()
-			fmt.Println(status)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if waybar {
+				if watch.watch {
+					return fmt.Errorf("--waybar prints the status once; Waybar's interval repeats it")
+				}
+				return printGoogleDriveWaybar()
+			}
+			return watch.show(cmd, func() (string, error) {
+				return utility.Redact(c.getGoogleDriveSyncStatus(verbose)) + "\n", nil
+			})
 		},
-	})
-
-	cmd.AddCommand(&cobra.Command{
+	}
+	statusCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the latest log entries of each directory")
+	statusCmd.Flags().BoolVar(&waybar, "waybar", false, "Print the status as a Waybar custom module (JSON)")
+	logFlagTo(logsToStderr, statusCmd, "waybar")
+	addWatchFlags(statusCmd, &watch)
+	allowRemote(statusCmd)
+	cmd.AddCommand(statusCmd)
+
+	syncCmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Force sync all directories immediately",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if api.Remote() != "" {
+				return remoteResult(func(ctx context.Context, client *api.Client) (*api.Result, error) {
+					return client.SyncGDrive(ctx, "")
+				})
+			}
 			gd := c.daemon.GetGoogleDrive()
 			if gd == nil {
 				return fmt.Errorf("Google Drive sync is not running. Start it first with: daemira gdrive start")
@@ -231,13 +746,21 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 			fmt.Println(result)
 			return nil
 		},
-	})
-
-	cmd.AddCommand(&cobra.Command{
-		Use:   "sync-dir",
-		Short: "Force sync a specific directory immediately",
-		Args:  cobra.ExactArgs(1),
+	}
+	allowRemote(syncCmd)
+	cmd.AddCommand(syncCmd)
+
+	syncDirCmd := &cobra.Command{
+		Use:               "sync-dir",
+		Short:             "Force sync a specific directory immediately",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(c.syncedDirectories),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if api.Remote() != "" {
+				return remoteResult(func(ctx context.Context, client *api.Client) (*api.Result, error) {
+					return client.SyncGDrive(ctx, args[0])
+				})
+			}
 			gd := c.daemon.GetGoogleDrive()
 			if gd == nil {
 				return fmt.Errorf("Google Drive sync is not running. Start it first with: daemira gdrive start")
@@ -247,14 +770,22 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 			fmt.Println("\nThe sync will begin shortly. Check status with: daemira gdrive status")
 			return nil
 		},
-	})
-
-	cmd.AddCommand(&cobra.Command{
-		Use:   "resync-dir",
-		Short: "Force resync a specific directory (rebuilds cache and syncs deletions)",
-		Long:  "Use this when files were deleted locally and need to be deleted from Google Drive. This rebuilds the bisync cache and ensures deletions are synced.",
-		Args:  cobra.ExactArgs(1),
+	}
+	allowRemote(syncDirCmd)
+	cmd.AddCommand(syncDirCmd)
+
+	resyncDirCmd := &cobra.Command{
+		Use:               "resync-dir",
+		Short:             "Force resync a specific directory (rebuilds cache and syncs deletions)",
+		Long:              "Use this when files were deleted locally and need to be deleted from Google Drive. This rebuilds the bisync cache and ensures deletions are synced.",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(c.syncedDirectories),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if api.Remote() != "" {
+				return remoteResult(func(ctx context.Context, client *api.Client) (*api.Result, error) {
+					return client.ResyncGDrive(ctx, args[0])
+				})
+			}
 			gd := c.daemon.GetGoogleDrive()
 			if gd == nil {
 				return fmt.Errorf("Google Drive sync is not running. Start it first with: daemira gdrive start")
@@ -267,7 +798,9 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 			fmt.Println(result)
 			return nil
 		},
-	})
+	}
+	allowRemote(resyncDirCmd)
+	cmd.AddCommand(resyncDirCmd)
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "patterns",
@@ -306,43 +839,291 @@ func (c *CLI) createGDriveCmd() *cobra.Command {
 	return cmd
 }
 
-func (c *CLI) createSystemCmd() *cobra.Command {
+func (c *CLI) createNotionCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "system",
-		Short: "System update commands",
+		Use:   "notion",
+		Short: "Notion sync commands",
 	}
 
-	cmd.AddCommand(&cobra.Command{
-		Use:   "update",
-		Short: "Run system update immediately",
+	var statusWatch watchOptions
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show what is synced to Notion and when it last was",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			su := c.daemon.GetSystemUpdate()
-			if su == nil {
-				if err := c.daemon.KeepSystemUpdated(); err != nil {
-					return err
+			return statusWatch.show(cmd, func() (string, error) {
+				status, err := c.getNotionSyncStatus()
+				if err != nil {
+					return "", err
 				}
-				su = c.daemon.GetSystemUpdate()
+				return utility.Redact(status) + "\n", nil
+			})
+		},
+	}
+	addWatchFlags(statusCmd, &statusWatch)
+	cmd.AddCommand(statusCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sync",
+		Short: "Sync the configured paths to Notion now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ns, err := c.daemon.NewNotionSync(context.Background())
+			if err != nil {
+				return err
 			}
-			ctx := context.Background()
-			if err := su.RunUpdate(ctx); err != nil {
+			if err := ns.SyncAll(context.Background()); err != nil {
 				return err
 			}
-			fmt.Println("System update completed. Check logs for details.")
+			status, err := c.getNotionSyncStatus()
+			if err != nil {
+				return err
+			}
+			fmt.Println(utility.Redact(status))
 			return nil
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "status",
-		Short: "Show system update status",
-		Run: func(cmd *cobra.Command, args []string) {
-			status := c.getSystemUpdateStatus()
-			fmt.Println(status)
+		Use:   "resolve <note> <local|notion>",
+		Short: "Settle a vault conflict by keeping the local note or the Notion page",
+		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return []string{"local", "notion"}, cobra.ShellCompDirectiveNoFileComp
+			}
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			ns, err := c.daemon.NewNotionSync(ctx)
+			if err != nil {
+				return err
+			}
+			if ns.Vault() == nil {
+				return fmt.Errorf("no vault configured (set notion.vault_path and notion.vault_database_id)")
+			}
+			if err := ns.Vault().Resolve(ctx, args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Resolved %s, keeping the %s side\n", args[0], args[1])
+			return nil
 		},
 	})
 
-	return cmd
-}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "export <page-id> [path]",
+		Short: "Export a Notion page or database to Markdown files (default: notion.export_dir)",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := c.daemon.GetConfig().NotionExportDir
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			if dir == "" {
+				return fmt.Errorf("no export directory (set notion.export_dir or pass a path)")
+			}
+
+			ctx := context.Background()
+			client, err := c.daemon.NewNotionClient(ctx)
+			if err != nil {
+				return err
+			}
+			files, err := notionsync.Export(ctx, c.logger, client, args[0], dir)
+			for _, file := range files {
+				fmt.Println(file)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\nExported %d file(s)\n", len(files))
+			return nil
+		},
+	})
+
+	queueCmd := &cobra.Command{
+		Use:   "queue",
+		Short: "List Notion writes waiting for the network",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writes, err := utility.GetNotionQueue().Writes()
+			if err != nil {
+				return err
+			}
+			if len(writes) == 0 {
+				fmt.Println("No Notion writes queued")
+				return nil
+			}
+			fmt.Printf("%d Notion write(s) queued:\n\n", len(writes))
+			for _, write := range writes {
+				fmt.Printf("  %s  %s\n", write.Queued.Format("2006-01-02 15:04"), write.Summary())
+				if write.Attempts > 0 {
+					fmt.Printf("    %d failed attempt(s): %s\n", write.Attempts, write.LastError)
+				}
+			}
+			return nil
+		},
+	}
+	queueCmd.AddCommand(&cobra.Command{
+		Use:   "flush",
+		Short: "Send the queued Notion writes now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client, err := c.daemon.NewNotionClient(ctx)
+			if err != nil {
+				return err
+			}
+			queue := utility.GetNotionQueue()
+			sent, err := queue.Replay(ctx, client)
+			fmt.Printf("Sent %d queued Notion write(s), %d still waiting\n", sent, queue.Len())
+			return err
+		},
+	})
+	cmd.AddCommand(queueCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "report",
+		Short: "Send a health summary to the report database now",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			reporter, err := c.daemon.NewNotionReporter(ctx)
+			if err != nil {
+				return err
+			}
+			if err := reporter.ReportHealth(ctx); err != nil {
+				return err
+			}
+			fmt.Println("Health report sent to Notion")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// getNotionSyncStatus formats the configured Notion sync paths with the
+// outcome of their last sync
+func (c *CLI) getNotionSyncStatus() (string, error) {
+	cfg := c.daemon.GetConfig()
+	var output strings.Builder
+	output.WriteString("=== Notion Sync ===\n\n")
+
+	switch {
+	case !cfg.NotionEnabled:
+		output.WriteString("Disabled in config (notion.enabled)\n")
+		return output.String(), nil
+	case len(cfg.NotionSyncPaths) == 0 && cfg.NotionVaultPath == "":
+		output.WriteString("No paths configured (notion.sync_paths or notion.vault_path)\n")
+		return output.String(), nil
+	}
+
+	targets, err := notionsync.ParseTargets(cfg.NotionSyncPaths, cfg.NotionPageIDs)
+	if err != nil {
+		return "", err
+	}
+	state, err := notionsync.LoadState()
+	if err != nil {
+		return "", err
+	}
+
+	output.WriteString(fmt.Sprintf("Interval: %v\n", cfg.NotionSyncInterval))
+	output.WriteString(fmt.Sprintf("Last Run: %s\n\n", formatTime(state.LastRun)))
+	for _, target := range targets {
+		output.WriteString(fmt.Sprintf("%s -> %s\n", target.Path, target.PageID))
+		status := state.Targets[target.Path]
+		if status == nil || status.PageID != target.PageID {
+			output.WriteString("  Not synced yet\n")
+			continue
+		}
+		output.WriteString(fmt.Sprintf("  Last Sync: %s\n", formatTime(status.LastSync)))
+		output.WriteString(fmt.Sprintf("  Files:     %d (%d updated)\n", status.Files, status.Updated))
+		if status.LastError != "" {
+			output.WriteString(fmt.Sprintf("  Error:     %s\n", status.LastError))
+		}
+	}
+
+	if cfg.NotionVaultPath != "" {
+		vault, err := notionsync.NewVault(c.logger, nil, cfg.NotionVaultPath, cfg.NotionVaultDatabaseID)
+		if err != nil {
+			return "", err
+		}
+		vaultState, err := notionsync.LoadVaultState()
+		if err != nil {
+			return "", err
+		}
+
+		output.WriteString(fmt.Sprintf("\nVault: %s <-> %s\n", vault.Dir(), cfg.NotionVaultDatabaseID))
+		if vaultState.Dir != vault.Dir() || vaultState.DatabaseID != cfg.NotionVaultDatabaseID {
+			output.WriteString("  Not synced yet\n")
+			return output.String(), nil
+		}
+		output.WriteString(fmt.Sprintf("  Last Sync: %s\n", formatTime(vaultState.LastRun)))
+		output.WriteString(fmt.Sprintf("  Notes:     %d (%d sent to Notion, %d updated from Notion)\n", len(vaultState.Entries), vaultState.Pushed, vaultState.Pulled))
+		if vaultState.LastError != "" {
+			output.WriteString(fmt.Sprintf("  Error:     %s\n", vaultState.LastError))
+		}
+		if len(vaultState.Conflicts) > 0 {
+			paths := make([]string, 0, len(vaultState.Conflicts))
+			for path := range vaultState.Conflicts {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			output.WriteString(fmt.Sprintf("  Conflicts: %d (daemira notion resolve <note> local|notion)\n", len(paths)))
+			for _, path := range paths {
+				output.WriteString(fmt.Sprintf("    %s: %s\n", path, vaultState.Conflicts[path].Reason))
+			}
+		}
+	}
+	return output.String(), nil
+}
+
+func (c *CLI) createSystemCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "system",
+		Short: "System update and kernel commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "update",
+		Short: "Run system update immediately",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			su := c.daemon.GetSystemUpdate()
+			if su == nil {
+				if err := c.daemon.KeepSystemUpdated(); err != nil {
+					return err
+				}
+				su = c.daemon.GetSystemUpdate()
+			}
+			ctx := context.Background()
+			if err := su.RunUpdate(ctx); err != nil {
+				return err
+			}
+			fmt.Println("System update completed. Check logs for details.")
+			return nil
+		},
+	})
+
+	var statusWatch watchOptions
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show system update status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return statusWatch.show(cmd, func() (string, error) {
+				return utility.Redact(c.getSystemUpdateStatus()) + "\n", nil
+			})
+		},
+	}
+	addWatchFlags(statusCmd, &statusWatch)
+	cmd.AddCommand(statusCmd)
+	cmd.AddCommand(c.createKernelCmd())
+
+	return cmd
+}
+
+// diskMonitor returns the disk monitor with the configured free-space thresholds
+func (c *CLI) diskMonitor() *systemhealth.DiskMonitor {
+	cfg := c.daemon.GetConfig()
+	dm := systemhealth.GetDiskMonitor()
+	dm.SetThresholds(cfg.DiskWarnFree.Bytes(), cfg.DiskCriticalFree.Bytes())
+	return dm
+}
 
 func (c *CLI) createStorageCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -355,7 +1136,7 @@ func (c *CLI) createStorageCmd() *cobra.Command {
 		Short: "Show disk usage summary",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			dm := systemhealth.GetDiskMonitor()
+			dm := c.diskMonitor()
 			status, err := dm.GetDiskSummary(ctx)
 			if err != nil {
 				return err
@@ -370,7 +1151,7 @@ func (c *CLI) createStorageCmd() *cobra.Command {
 		Short: "Check for low disk space warnings",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			dm := systemhealth.GetDiskMonitor()
+			dm := c.diskMonitor()
 			warnings, err := dm.CheckLowSpace(ctx)
 			if err != nil {
 				return err
@@ -397,7 +1178,7 @@ func (c *CLI) createStorageCmd() *cobra.Command {
 		Short: "Show disk health (SMART) status",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			dm := systemhealth.GetDiskMonitor()
+			dm := c.diskMonitor()
 			statuses, err := dm.GetAllSmartStatus(ctx)
 			if err != nil {
 				return err
@@ -486,63 +1267,1109 @@ func (c *CLI) createPerformanceCmd() *cobra.Command {
 				}
 				output += "\n"
 			}
-			fmt.Println(output)
+			fmt.Println(output)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "suggest",
+		Short: "Suggest optimal power profile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			pm := systemhealth.GetPerformanceManager()
+			suggested, err := pm.SuggestProfile(ctx)
+			if err != nil {
+				return err
+			}
+			current, _ := pm.GetCurrentProfile(ctx)
+			output := fmt.Sprintf("Suggested power profile: %s\n", suggested)
+			if current != "" {
+				output += fmt.Sprintf("Current power profile: %s\n", current)
+				if current != suggested {
+					output += fmt.Sprintf("\nRecommendation: Switch to %s for better performance/efficiency", suggested)
+				} else {
+					output += "\n✓ Current profile is optimal"
+				}
+			}
+			fmt.Println(output)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set",
+		Short: "Set power profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			pm := systemhealth.GetPerformanceManager()
+			profile := systemhealth.PowerProfile(args[0])
+			if err := pm.SetProfile(ctx, profile); err != nil {
+				return fmt.Errorf("failed to set power profile to %s: %w", profile, err)
+			}
+			fmt.Printf("Power profile set to: %s\n", profile)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "cpu",
+		Short: "Show CPU statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			pm := systemhealth.GetPerformanceManager()
+			stats, err := pm.GetCPUStats(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(pm.FormatCPUStats(stats))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(c.createBootCmd())
+
+	return cmd
+}
+
+func (c *CLI) createMemoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "memory",
+		Short: "Memory monitoring commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Show memory statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			mm := systemhealth.GetMemoryMonitor()
+			stats, err := mm.GetMemoryStats(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(mm.FormatMemoryStats(stats))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "swappiness",
+		Short: "Check swappiness configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			mm := systemhealth.GetMemoryMonitor()
+			check, err := mm.CheckSwappiness(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(check["message"].(string))
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createDNDCmd() *cobra.Command {
+	dnd := utility.GetDoNotDisturb()
+	enable := func(duration time.Duration) error {
+		state, err := dnd.Enable(context.Background(), duration, c.daemon.GetConfig().DNDNotificationDaemon)
+		if err != nil {
+			return err
+		}
+		fmt.Println(dnd.FormatStatus(state))
+		return nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "dnd",
+		Short: "Do-not-disturb mode (silences notifications, defers maintenance)",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(dnd.FormatStatus(dnd.State()))
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "on",
+		Short: "Enable do-not-disturb until turned off",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return enable(0)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "for <duration>",
+		Short: "Enable do-not-disturb for a duration (e.g. 2h, 45m)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			duration, err := time.ParseDuration(args[0])
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("invalid duration: %s", args[0])
+			}
+			return enable(duration)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "off",
+		Short: "Disable do-not-disturb",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := dnd.Disable(context.Background()); err != nil {
+				return err
+			}
+			fmt.Println(dnd.FormatStatus(dnd.State()))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show do-not-disturb state",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(dnd.FormatStatus(dnd.State()))
+		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createConfigCmd() *cobra.Command {
+	var showSecrets bool
+
+	// Paths under the home directory are shortened to ~
+	shortPath := func(path string) string {
+		if homeDir, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, homeDir+"/") {
+			return "~" + strings.TrimPrefix(path, homeDir)
+		}
+		return path
+	}
+
+	list := func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		for _, setting := range config.Settings() {
+			fmt.Printf("%-32s %-40s (%s)\n", setting.Key, cfg.FormatValue(setting, showSecrets), shortPath(cfg.Source(setting)))
+		}
+		return nil
+	}
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "View, change and validate configuration",
+		RunE:  list,
+	}
+	cmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "Show tokens and API keys instead of masking them (get also resolves secret references)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Show the effective configuration and where each value comes from",
+		RunE:  list,
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "get <key>",
+		Short:             "Show one setting (e.g. gdrive.excludes or RCLONE_EXCLUDES)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(settingKeys),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			setting, ok := config.Lookup(args[0])
+			if !ok {
+				return fmt.Errorf("unknown setting %q (see `daemira config list`)", args[0])
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			if showSecrets && setting.Secret && cfg.Value(setting) != "" {
+				secret, err := cfg.Secret(context.Background(), setting.Key)
+				if err != nil {
+					return err
+				}
+				fmt.Println(secret)
+				return nil
+			}
+			fmt.Println(cfg.FormatValue(setting, showSecrets))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Save a setting to ~/.config/daemira/config.toml",
+		Long: `Save a setting to the user config file, creating it if needed. Lists are
+comma-separated (semicolon-separated for desktop.window_rules and
+desktop.workspace_outputs). The file is only replaced if the resulting
+configuration is valid; comments in it are not kept.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeSetting,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			setting, ok := config.Lookup(args[0])
+			if !ok {
+				return fmt.Errorf("unknown setting %q (see `daemira config list`)", args[0])
+			}
+			path, err := config.Set(setting.Key, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ Set %s in %s\n", setting.Key, shortPath(path))
+			if config.IsReloadable(setting.Env) {
+				fmt.Println("A running daemon applies it within a few seconds.")
+			} else {
+				fmt.Println("Restart the daemon to apply it.")
+			}
+			if os.Getenv(setting.Env) != "" {
+				fmt.Printf("Note: %s is set in the environment and overrides the file.\n", setting.Env)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate [file]",
+		Short: "Check the effective configuration, or a config file on its own",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if _, err := config.ValidateFile(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("✓ %s is valid\n", args[0])
+				return nil
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			files := config.Layers()
+			if len(files) == 0 {
+				fmt.Println("✓ No config files found; using defaults and environment variables")
+				return nil
+			}
+			for idx, path := range files {
+				files[idx] = shortPath(path)
+			}
+			fmt.Printf("✓ Configuration is valid (%s)\n", strings.Join(files, ", "))
+			if profiles := cfg.Profiles(); len(profiles) > 0 {
+				fmt.Printf("  Profiles for this machine: %s\n", strings.Join(profiles, ", "))
+			} else {
+				fmt.Printf("  No profiles for this machine (matching %s)\n", strings.Join(config.MachineNames(), ", "))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade config files and move settings from ./.env to config.toml",
+		Long: `Config files from older versions are upgraded whenever daemira loads
+them, keeping the previous file as <file>.v<version>.bak. This also moves the
+settings of a legacy .env in the current directory to
+~/.config/daemira/config.toml, if that does not exist yet.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, note := range config.Migrate() {
+				fmt.Println(note)
+			}
+			if _, err := os.Stat(config.LegacyFile); err == nil {
+				if _, err := os.Stat(config.UserFile()); os.IsNotExist(err) {
+					path, count, err := config.ImportLegacy()
+					if err != nil {
+						return err
+					}
+					fmt.Printf("✓ Moved %d settings from %s to %s; %s can be removed\n", count, config.LegacyFile, shortPath(path), config.LegacyFile)
+					return nil
+				}
+				fmt.Printf("Note: %s is still read, below %s; remove it once its settings are there\n", config.LegacyFile, shortPath(config.UserFile()))
+			}
+			fmt.Printf("✓ Config files are at version %d\n", config.Version)
+			return nil
+		},
+	})
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print a JSON schema of the config file for editors and documentation",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := config.SchemaJSON()
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		},
+	}
+	logTo(logsToStderr, schemaCmd)
+	cmd.AddCommand(schemaCmd)
+
+	return cmd
+}
+
+func (c *CLI) createLogsCmd() *cobra.Command {
+	var follow bool
+	var level string
+	var component string
+	var since string
+	var lines int
+	var source string
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show daemira's logs",
+		Long: `Show daemira's logs, from the user journal when it runs as a systemd
+service, otherwise from its log files (current and archived).
+
+Examples:
+  daemira logs -f --component gdrive
+  daemira logs --level warn --since 1h
+  daemira logs --since "2024-05-01 08:00" --lines 100`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := utility.LogFilter{Level: utility.DEBUG, Component: component}
+			if level != "" {
+				parsed, err := utility.ParseLogLevel(level)
+				if err != nil {
+					return err
+				}
+				filter.Level = parsed
+			}
+			if since != "" {
+				parsed, err := parseSince(since)
+				if err != nil {
+					return err
+				}
+				filter.Since = parsed
+			}
+			if lines < 0 {
+				return fmt.Errorf("invalid --lines: %d", lines)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			show := func(entry utility.LogEntry) {
+				fmt.Println(entry.String())
+			}
+
+			switch source {
+			case "auto":
+				if utility.JournalAvailable(ctx) {
+					return utility.ReadJournal(ctx, filter, lines, follow, show)
+				}
+			case "journal":
+				return utility.ReadJournal(ctx, filter, lines, follow, show)
+			case "files":
+			default:
+				return fmt.Errorf("invalid --source %q (must be auto, journal or files)", source)
+			}
+
+			if len(utility.LogFiles(utility.LogDir())) == 0 {
+				return fmt.Errorf("no logs in %s or the journal", utility.LogDir())
+			}
+			entries, err := utility.RecentLogFiles(filter, lines)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				show(entry)
+			}
+
+			if !follow {
+				return nil
+			}
+			return utility.FollowLogFile(ctx, filepath.Join(utility.LogDir(), "current.log"), func(entry utility.LogEntry) {
+				if filter.Match(entry) {
+					show(entry)
+				}
+			})
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing new entries")
+	cmd.Flags().StringVar(&level, "level", "", "Minimum level: debug, info, warn or error")
+	cmd.Flags().StringVar(&component, "component", "", "Only entries of one component (e.g. gdrive, system-update)")
+	cmd.Flags().StringVar(&since, "since", "", "Only entries since a duration ago (e.g. 1h, 30m) or a time (2006-01-02 [15:04[:05]])")
+	cmd.Flags().IntVarP(&lines, "lines", "n", 0, "Show only the last N entries (0 for all)")
+	cmd.Flags().StringVar(&source, "source", "auto", "Where to read logs: auto, journal or files")
+	logTo(logsToStderr, cmd)
+
+	return cmd
+}
+
+func (c *CLI) createDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check dependencies, sudo and polkit, config, sockets and connectivity, with fixes for each problem",
+		// Failed checks are the command's output, not a usage mistake
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+
+			icons := map[string]string{
+				daemira.CheckOK:      "✓",
+				daemira.CheckWarning: "⚠",
+				daemira.CheckFailed:  "✗",
+			}
+			output := ""
+			group := ""
+			failed, warnings := 0, 0
+			for _, check := range c.daemon.Doctor(ctx) {
+				if check.Group != group {
+					if group != "" {
+						output += "\n"
+					}
+					group = check.Group
+					output += group + ":\n"
+				}
+				output += fmt.Sprintf("  %s %s: %s\n", icons[check.Status], check.Name, check.Detail)
+				if check.Fix != "" {
+					output += fmt.Sprintf("      Fix: %s\n", check.Fix)
+				}
+				switch check.Status {
+				case daemira.CheckFailed:
+					failed++
+				case daemira.CheckWarning:
+					warnings++
+				}
+			}
+			fmt.Println(utility.Redact(output))
+
+			if failed > 0 {
+				return fmt.Errorf("%d check(s) failed, %d warning(s)", failed, warnings)
+			}
+			if warnings > 0 {
+				fmt.Printf("All required checks passed, %d warning(s)\n", warnings)
+			} else {
+				fmt.Println("All checks passed")
+			}
+			return nil
+		},
+	}
+}
+
+func (c *CLI) createDiagnosticsCmd() *cobra.Command {
+	var since string
+	var stacks bool
+
+	cmd := &cobra.Command{
+		Use:   "diagnostics",
+		Short: "Show recent crashes of background workers, errors by component, command timings and queues, and the daemon's resource usage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := parseSince(since)
+			if err != nil {
+				return err
+			}
+
+			crashes, err := utility.LoadCrashes()
+			if err != nil {
+				return err
+			}
+			output := fmt.Sprintf("Crashes since %s:\n", from.Format("2006-01-02 15:04"))
+			byWorker := make(map[string]int)
+			var workers []string
+			shown := 0
+			for _, crash := range crashes {
+				if crash.Time.Before(from) {
+					continue
+				}
+				if byWorker[crash.Worker] == 0 {
+					workers = append(workers, crash.Worker)
+				}
+				byWorker[crash.Worker]++
+				shown++
+
+				outcome := "restarted"
+				if !crash.Restarted {
+					outcome = "not restarted"
+				}
+				output += fmt.Sprintf("  ✗ %s %s (pid %d, %s): %s\n", crash.Time.Format("2006-01-02 15:04:05"), crash.Worker, crash.PID, outcome, crash.Panic)
+				if stacks {
+					for _, line := range strings.Split(strings.TrimSpace(crash.Stack), "\n") {
+						output += "      " + line + "\n"
+					}
+				}
+			}
+			if shown == 0 {
+				output += "  None\n"
+			} else {
+				output += "\n  By worker:\n"
+				for _, worker := range workers {
+					output += fmt.Sprintf("    %-28s %d\n", worker, byWorker[worker])
+				}
+			}
+
+			entries, err := utility.RecentLogs(context.Background(), utility.LogFilter{Level: utility.ERROR, Since: from}, 0)
+			if err != nil {
+				return err
+			}
+			output += fmt.Sprintf("\nErrors since %s:\n", from.Format("2006-01-02 15:04"))
+			counts := make(map[string]int)
+			latest := make(map[string]utility.LogEntry)
+			var components []string
+			for _, entry := range entries {
+				component := entry.Component
+				if component == "" {
+					component = "daemira"
+				}
+				if counts[component] == 0 {
+					components = append(components, component)
+				}
+				counts[component]++
+				latest[component] = entry
+			}
+			if len(components) == 0 {
+				output += "  None\n"
+			}
+			for _, component := range components {
+				message := strings.SplitN(latest[component].Message, "\n", 2)[0]
+				output += fmt.Sprintf("  %-20s %4d  last: %s %s\n", component, counts[component], latest[component].Time.Format("15:04:05"), message)
+			}
+
+			metrics, err := utility.LoadMetrics()
+			if err != nil {
+				return err
+			}
+			output += "\nCommands run by the daemon"
+			if metrics == nil || len(metrics.Timings) == 0 {
+				output += ":\n  None recorded\n"
+			} else {
+				output += fmt.Sprintf(" (pid %d, since %s), by total time:\n", metrics.PID, metrics.Started.Format("2006-01-02 15:04"))
+				names := make([]string, 0, len(metrics.Timings))
+				for name := range metrics.Timings {
+					names = append(names, name)
+				}
+				sort.Slice(names, func(a, b int) bool {
+					return metrics.Timings[names[a]].Total > metrics.Timings[names[b]].Total
+				})
+				output += fmt.Sprintf("  %-20s %6s %6s %10s %10s %10s\n", "COMMAND", "RUNS", "FAILED", "TOTAL", "AVERAGE", "MAX")
+				for _, name := range names {
+					timing := metrics.Timings[name]
+					output += fmt.Sprintf("  %-20s %6d %6d %10s %10s %10s\n", name, timing.Count, timing.Failures,
+						timing.Total.Round(time.Second), timing.Average().Round(time.Millisecond), timing.Max.Round(time.Millisecond))
+				}
+
+				output += fmt.Sprintf("\nCommand queues (as of %s):\n", metrics.Saved.Format("15:04:05"))
+				output += fmt.Sprintf("  %-10s %6s %8s %8s %6s %8s %10s\n", "LIMIT", "MAX", "RUNNING", "WAITING", "PEAK", "WAITED", "WAIT TIME")
+				for _, category := range []string{"all", "pacman", "rclone", "probe"} {
+					queue, ok := metrics.Queues[category]
+					if !ok {
+						continue
+					}
+					output += fmt.Sprintf("  %-10s %6d %8d %8d %6d %8d %10s\n", category, queue.Limit, queue.Running, queue.Waiting,
+						queue.PeakWaiting, queue.Waited, queue.WaitTime.Round(time.Millisecond))
+				}
+			}
+
+			output += c.resourceUsage(metrics)
+
+			fmt.Print(utility.Redact(output))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "24h", "Only crashes and errors since a duration ago (e.g. 24h) or a time (2006-01-02 [15:04])")
+	cmd.Flags().BoolVar(&stacks, "stacks", false, "Show the stack trace of each crash")
+
+	return cmd
+}
+
+// resourceUsage describes the daemon's own resource usage, its peaks and
+// the configured limits
+func (c *CLI) resourceUsage(metrics *utility.MetricsSnapshot) string {
+	output := "\nDaemon resource usage"
+	if metrics == nil || metrics.Usage.Sampled.IsZero() {
+		return output + ":\n  None recorded\n"
+	}
+
+	cfg := c.daemon.GetConfig()
+	limit := func(value int64, format func(int64) string) string {
+		if value <= 0 {
+			return "none"
+		}
+		return format(value)
+	}
+	count := func(n int64) string { return fmt.Sprintf("%d", n) }
+	percent := func(n int64) string { return fmt.Sprintf("%d%%", n) }
+
+	usage, peak := metrics.Usage, metrics.Peak
+	output += fmt.Sprintf(" (pid %d, as of %s, %s CPU time):\n", metrics.PID, usage.Sampled.Format("15:04:05"), usage.CPUTime.Round(10*time.Millisecond))
+	output += fmt.Sprintf("  %-12s %10s %10s %10s\n", "", "NOW", "PEAK", "LIMIT")
+	output += fmt.Sprintf("  %-12s %9.0f%% %9.0f%% %10s\n", "CPU", usage.CPUPercent, peak.CPUPercent, limit(int64(cfg.DiagnosticsMaxCPU), percent))
+	output += fmt.Sprintf("  %-12s %10s %10s %10s\n", "Memory", utility.FormatBytes(usage.RSS), utility.FormatBytes(peak.RSS), limit(cfg.DiagnosticsMaxMemory.Bytes(), utility.FormatBytes))
+	output += fmt.Sprintf("  %-12s %10d %10d %10s\n", "Goroutines", usage.Goroutines, peak.Goroutines, limit(int64(cfg.DiagnosticsMaxGoroutines), count))
+	output += fmt.Sprintf("  %-12s %10d %10d %10s\n", "Open files", usage.FDs, peak.FDs, limit(int64(cfg.DiagnosticsMaxOpenFiles), count))
+
+	if profiles := utility.HeapProfiles(); len(profiles) > 0 {
+		output += fmt.Sprintf("  Heap profiles: %d, latest %s (go tool pprof <file>)\n", len(profiles), shortenHome(profiles[0]))
+	}
+	return output
+}
+
+func (c *CLI) createAuditCmd() *cobra.Command {
+	var since, action, initiator string
+	var lines int
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the audit log of privileged and destructive actions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var from time.Time
+			if since != "" {
+				var err error
+				if from, err = parseSince(since); err != nil {
+					return err
+				}
+			}
+
+			entries, err := utility.ReadAudit()
+			if err != nil {
+				return err
+			}
+			var shown []utility.AuditEntry
+			for _, entry := range entries {
+				if entry.Time.Before(from) ||
+					(action != "" && entry.Action != action) ||
+					(initiator != "" && entry.Initiator != initiator) {
+					continue
+				}
+				shown = append(shown, entry)
+			}
+			if lines > 0 && len(shown) > lines {
+				shown = shown[len(shown)-lines:]
+			}
+
+			if len(shown) == 0 {
+				fmt.Println("No audited actions")
+				return nil
+			}
+			for _, entry := range shown {
+				line := fmt.Sprintf("%s %-9s %-8s %-13s %s", entry.Time.Format("2006-01-02 15:04:05"), entry.Initiator, entry.User, entry.Action, entry.Target)
+				if entry.Detail != "" {
+					line += " (" + entry.Detail + ")"
+				}
+				fmt.Println(line)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "Only actions since a duration ago (e.g. 24h) or a time (2006-01-02 [15:04])")
+	cmd.Flags().StringVar(&action, "action", "", "Only actions of a kind: sudo, privileged, service, power, power-profile, write, delete or remote-delete")
+	cmd.Flags().StringVar(&initiator, "initiator", "", "Only actions started by cli or scheduler")
+	cmd.Flags().IntVarP(&lines, "lines", "n", 50, "Show only the last N actions (0 for all)")
+
+	return cmd
+}
+
+func (c *CLI) createDesktopCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "desktop",
+		Short: "Desktop environment commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show desktop environment status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.GetFormattedStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "session",
+		Short: "Show session information",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.GetSessionStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "compositor",
+		Short: "Show compositor information",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.GetCompositorStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "displays",
+		Short: "Show display information",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.GetDisplayStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "lock",
+		Short: "Lock the session",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.LockSession(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "unlock",
+		Short: "Unlock the session",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			di := desktopmonitor.GetDesktopIntegration()
+			result, err := di.UnlockSession(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(c.createDisplayProfileCmd())
+	cmd.AddCommand(c.createWindowRulesCmd())
+	cmd.AddCommand(c.createWorkspaceOutputsCmd())
+	cmd.AddCommand(c.createIdleCmd())
+	cmd.AddCommand(c.createHooksCmd())
+	cmd.AddCommand(c.createWallpaperCmd())
+	cmd.AddCommand(c.createScreenshotCmd())
+	cmd.AddCommand(c.createRecordCmd())
+	cmd.AddCommand(c.createAudioCmd())
+	cmd.AddCommand(c.createBluetoothCmd())
+	cmd.AddCommand(c.createUsageCmd())
+
+	return cmd
+}
+
+func (c *CLI) createAudioCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audio",
+		Short: "Audio device commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List audio outputs and inputs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			am := desktopmonitor.GetAudioMonitor()
+			sinks, err := am.GetSinks(ctx)
+			if err != nil {
+				return err
+			}
+			sources, err := am.GetSources(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(am.FormatAudioDevices(sinks, sources))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set-default <sink>",
+		Short: "Set the default output (by index, name or description)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			sink, err := desktopmonitor.GetAudioMonitor().SetDefaultSink(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Default output: %s\n", sink.Description)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createBluetoothCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "bt",
+		Aliases: []string{"bluetooth"},
+		Short:   "Bluetooth device commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List paired devices with connection state and battery",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			bm := desktopmonitor.GetBluetoothMonitor()
+			devices, err := bm.GetDevices(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(bm.FormatDevices(devices))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "connect <device>",
+		Short: "Connect a paired device (by name or address)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			device, err := desktopmonitor.GetBluetoothMonitor().Connect(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Connected: %s [%s]\n", device.Name, device.Address)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "disconnect <device>",
+		Short: "Disconnect a device (by name or address)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			device, err := desktopmonitor.GetBluetoothMonitor().Disconnect(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Disconnected: %s [%s]\n", device.Name, device.Address)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createUsageCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "usage [today|week]",
+		Short:     "Show time spent per application",
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"today", "week"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			period := "today"
+			if len(args) > 0 {
+				period = args[0]
+			}
+
+			days, title := 1, "Usage today"
+			switch period {
+			case "today":
+			case "week":
+				days, title = 7, "Usage over the last 7 days"
+			default:
+				return fmt.Errorf("unknown period: %s (expected today or week)", period)
+			}
+
+			tracker := desktopmonitor.NewUsageTracker(c.logger, c.daemon.UsageOptions())
+			totals, sum, err := tracker.Report(days)
+			if err != nil {
+				return err
+			}
+			fmt.Println(tracker.FormatUsageReport(title, totals, sum))
+			if !c.daemon.GetConfig().UsageTracking {
+				fmt.Println("\nUsage tracking is disabled. Set usage.tracking = true in config.toml (or USAGE_TRACKING=true) to record usage.")
+			}
+			return nil
+		},
+	}
+}
+
+func (c *CLI) newScreenCapture() *desktopmonitor.ScreenCapture {
+	cfg := c.daemon.GetConfig()
+	return desktopmonitor.NewScreenCapture(c.logger, cfg.ScreenshotDir, cfg.RecordingDir)
+}
+
+func (c *CLI) createScreenshotCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:       "screenshot [full|region|window|output]",
+		Short:     "Take a screenshot",
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"full", "region", "window", "output"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			mode := desktopmonitor.CaptureFull
+			if len(args) > 0 {
+				mode = desktopmonitor.CaptureMode(args[0])
+			}
+
+			path, err := c.newScreenCapture().Screenshot(ctx, mode)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		},
+	}
+}
+
+func (c *CLI) createRecordCmd() *cobra.Command {
+	var audio bool
+
+	cmd := &cobra.Command{
+		Use:   "record",
+		Short: "Screen recording commands",
+	}
+
+	startCmd := &cobra.Command{
+		Use:       "start [full|region|window|output]",
+		Short:     "Start a screen recording",
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"full", "region", "window", "output"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			mode := desktopmonitor.CaptureFull
+			if len(args) > 0 {
+				mode = desktopmonitor.CaptureMode(args[0])
+			}
+
+			path, err := c.newScreenCapture().StartRecording(ctx, mode, audio)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Recording to %s\n", path)
+			fmt.Println("Run 'daemira desktop record stop' to finish.")
+			return nil
+		},
+	}
+	startCmd.Flags().BoolVar(&audio, "audio", false, "Record audio from the default source")
+	cmd.AddCommand(startCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stop",
+		Short: "Stop the active screen recording",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := c.newScreenCapture().StopRecording()
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show the active screen recording",
+		Run: func(cmd *cobra.Command, args []string) {
+			if pid, path, ok := c.newScreenCapture().ActiveRecording(); ok {
+				fmt.Printf("Recording to %s (pid %d)\n", path, pid)
+				return
+			}
+			fmt.Println("Not recording")
+		},
+	})
+
+	return cmd
+}
+
+func (c *CLI) createWallpaperCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wallpaper",
+		Short: "Wallpaper rotation commands",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status := wallpaper.NewWallpaperRotator(c.logger, c.daemon.WallpaperOptions()).GetStatus()
+			output := "Wallpaper:\n"
+			output += fmt.Sprintf("  Current: %v\n", status["current"])
+			output += fmt.Sprintf("  Directory: %v\n", status["directory"])
+			output += fmt.Sprintf("  Interval: %v\n", status["interval"])
+			output += fmt.Sprintf("  Backend: %v\n", status["backend"])
+			if schedule, ok := status["schedule"].(bool); ok && schedule {
+				dark, _ := status["dark"].(bool)
+				output += fmt.Sprintf("  Dark mode: %s\n", boolToYesNo(dark))
+			}
+			fmt.Print(output)
 			return nil
 		},
-	})
+	}
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "suggest",
-		Short: "Suggest optimal power profile",
+		Use:   "next",
+		Short: "Switch to the next wallpaper",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			pm := systemhealth.GetPerformanceManager()
-			suggested, err := pm.SuggestProfile(ctx)
+			path, err := wallpaper.NewWallpaperRotator(c.logger, c.daemon.WallpaperOptions()).Next(ctx)
 			if err != nil {
 				return err
 			}
-			current, _ := pm.GetCurrentProfile(ctx)
-			output := fmt.Sprintf("Suggested power profile: %s\n", suggested)
-			if current != "" {
-				output += fmt.Sprintf("Current power profile: %s\n", current)
-				if current != suggested {
-					output += fmt.Sprintf("\nRecommendation: Switch to %s for better performance/efficiency", suggested)
-				} else {
-					output += "\n✓ Current profile is optimal"
-				}
-			}
-			fmt.Println(output)
+			fmt.Printf("Wallpaper set to %s\n", path)
 			return nil
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "set",
-		Short: "Set power profile",
+		Use:   "set <path>",
+		Short: "Set a specific wallpaper",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			pm := systemhealth.GetPerformanceManager()
-			profile := systemhealth.PowerProfile(args[0])
-			if err := pm.SetProfile(ctx, profile); err != nil {
-				return fmt.Errorf("failed to set power profile to %s: %w", profile, err)
+			if err := wallpaper.NewWallpaperRotator(c.logger, c.daemon.WallpaperOptions()).Set(ctx, args[0]); err != nil {
+				return err
 			}
-			fmt.Printf("Power profile set to: %s\n", profile)
+			fmt.Printf("Wallpaper set to %s\n", args[0])
 			return nil
 		},
 	})
 
+	return cmd
+}
+
+func (c *CLI) createIdleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "idle",
+		Short: "Idle lock/DPMS/suspend policy commands",
+	}
+
 	cmd.AddCommand(&cobra.Command{
-		Use:   "cpu",
-		Short: "Show CPU statistics",
+		Use:   "status",
+		Short: "Show the idle policy and time until the next action",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			pm := systemhealth.GetPerformanceManager()
-			stats, err := pm.GetCPUStats(ctx)
+			policy, err := c.daemon.IdlePolicy()
 			if err != nil {
 				return err
 			}
-			fmt.Println(pm.FormatCPUStats(stats))
+
+			im := desktopmonitor.NewIdleManager(c.logger, policy)
+			status, err := im.GetStatus(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Println(im.FormatIdleStatus(status))
 			return nil
 		},
 	})
@@ -550,38 +2377,82 @@ func (c *CLI) createPerformanceCmd() *cobra.Command {
 	return cmd
 }
 
-func (c *CLI) createMemoryCmd() *cobra.Command {
+func (c *CLI) createHooksCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "memory",
-		Short: "Memory monitoring commands",
+		Use:   "hooks",
+		Short: "Show configured session event hooks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hooks := desktopmonitor.NewSessionHooks(c.logger, c.daemon.SessionHooks())
+			fmt.Println(hooks.FormatHooks())
+			return nil
+		},
 	}
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "stats",
-		Short: "Show memory statistics",
+		Use:               "run <event>",
+		Short:             "Run the hook for an event now (for testing)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(sessionEventNames),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			mm := systemhealth.GetMemoryMonitor()
-			stats, err := mm.GetMemoryStats(ctx)
+			event, err := desktopmonitor.ParseSessionEvent(args[0])
 			if err != nil {
 				return err
 			}
-			fmt.Println(mm.FormatMemoryStats(stats))
+
+			hooks := desktopmonitor.NewSessionHooks(c.logger, c.daemon.SessionHooks())
+			command, ok := hooks.Hooks()[event]
+			if !ok {
+				return fmt.Errorf("no hook configured for %s", event)
+			}
+			if err := hooks.Run(context.Background(), event, command, nil); err != nil {
+				return err
+			}
+			fmt.Printf("Hook for %s completed\n", event)
 			return nil
 		},
 	})
 
+	return cmd
+}
+
+func (c *CLI) createWindowRulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Show configured window rules",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := desktopmonitor.ParseWindowRules(c.daemon.GetConfig().DesktopWindowRules)
+			if err != nil {
+				return err
+			}
+			if len(rules) == 0 {
+				fmt.Println("No window rules configured. Set desktop.window_rules in config.toml (or DESKTOP_WINDOW_RULES).")
+				return nil
+			}
+
+			output := "Window Rules:\n"
+			for i, rule := range rules {
+				output += fmt.Sprintf("  %d. %s\n", i+1, rule.Raw)
+			}
+			fmt.Print(output)
+			return nil
+		},
+	}
+
 	cmd.AddCommand(&cobra.Command{
-		Use:   "swappiness",
-		Short: "Check swappiness configuration",
+		Use:   "apply",
+		Short: "Apply window rules to all open windows",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			mm := systemhealth.GetMemoryMonitor()
-			check, err := mm.CheckSwappiness(ctx)
+			rules, err := desktopmonitor.ParseWindowRules(c.daemon.GetConfig().DesktopWindowRules)
 			if err != nil {
 				return err
 			}
-			fmt.Println(check["message"].(string))
+
+			arranged, err := desktopmonitor.NewWindowRulesEngine(c.logger, rules).Arrange(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Applied window rules to %d windows\n", arranged)
 			return nil
 		},
 	})
@@ -589,98 +2460,139 @@ func (c *CLI) createMemoryCmd() *cobra.Command {
 	return cmd
 }
 
-func (c *CLI) createDesktopCmd() *cobra.Command {
+func (c *CLI) createWorkspaceOutputsCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "desktop",
-		Short: "Desktop environment commands",
-	}
-
-	cmd.AddCommand(&cobra.Command{
-		Use:   "status",
-		Short: "Show desktop environment status",
+		Use:   "workspaces",
+		Short: "Show workspace output rules used on monitor hotplug",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.GetFormattedStatus(ctx)
+			rules, err := desktopmonitor.ParseWorkspaceOutputRules(c.daemon.GetConfig().DesktopWorkspaceOutputs)
 			if err != nil {
 				return err
 			}
-			fmt.Println(result)
+			if len(rules) == 0 {
+				fmt.Println("No workspace output rules configured. Set desktop.workspace_outputs in config.toml (or DESKTOP_WORKSPACE_OUTPUTS).")
+				fmt.Println("Workspaces on disconnected outputs are still moved by `desktop workspaces reassign`.")
+				return nil
+			}
+
+			output := "Workspace Output Rules:\n"
+			for _, rule := range rules {
+				output += fmt.Sprintf("  %s -> %s\n", rule.Workspace, strings.Join(rule.Outputs, ", "))
+			}
+			fmt.Print(output)
 			return nil
 		},
-	})
+	}
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "session",
-		Short: "Show session information",
+		Use:   "reassign",
+		Short: "Move workspaces to their preferred connected outputs now",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.GetSessionStatus(ctx)
+			rules, err := desktopmonitor.ParseWorkspaceOutputRules(c.daemon.GetConfig().DesktopWorkspaceOutputs)
 			if err != nil {
 				return err
 			}
-			fmt.Println(result)
+
+			moves, err := desktopmonitor.NewWorkspaceReassigner(c.logger, rules).Reassign(ctx)
+			for _, move := range moves {
+				fmt.Printf("Moved workspace %s: %s -> %s\n", move.Workspace, move.From, move.To)
+			}
+			if err != nil {
+				return err
+			}
+			if len(moves) == 0 {
+				fmt.Println("All workspaces are already on their preferred outputs")
+			}
 			return nil
 		},
 	})
 
+	return cmd
+}
+
+func (c *CLI) createDisplayProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Save and apply monitor layouts",
+	}
+
 	cmd.AddCommand(&cobra.Command{
-		Use:   "compositor",
-		Short: "Show compositor information",
+		Use:   "save <name>",
+		Short: "Save the current monitor layout as a profile",
+		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.GetCompositorStatus(ctx)
+			profile, err := desktopmonitor.GetDisplayProfileManager().Save(ctx, args[0])
 			if err != nil {
 				return err
 			}
-			fmt.Println(result)
+			fmt.Printf("Saved display profile '%s' (%d outputs)\n", profile.Name, len(profile.Outputs))
 			return nil
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "displays",
-		Short: "Show display information",
+		Use:               "apply <name>",
+		Short:             "Apply a saved monitor layout",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(displayProfileNames),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.GetDisplayStatus(ctx)
-			if err != nil {
+			if err := desktopmonitor.GetDisplayProfileManager().Apply(ctx, args[0]); err != nil {
 				return err
 			}
-			fmt.Println(result)
+			fmt.Printf("Applied display profile '%s'\n", args[0])
 			return nil
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "lock",
-		Short: "Lock the session",
+		Use:   "list",
+		Short: "List saved display profiles",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.LockSession(ctx)
+			pm := desktopmonitor.GetDisplayProfileManager()
+			profiles, err := pm.List()
 			if err != nil {
 				return err
 			}
-			fmt.Println(result)
+			if len(profiles) == 0 {
+				fmt.Println("No display profiles saved. Use 'daemira desktop profile save <name>'.")
+				return nil
+			}
+
+			active := ""
+			if match, err := pm.MatchingProfile(ctx); err == nil && match != nil {
+				active = match.Name
+			}
+
+			output := "Display Profiles:\n"
+			for _, profile := range profiles {
+				marker := " "
+				if profile.Name == active {
+					marker = "*"
+				}
+				output += fmt.Sprintf("%s %s (auto-apply: %s)\n", marker, profile.Name, boolToYesNo(profile.AutoApply))
+				for _, o := range profile.Outputs {
+					output += fmt.Sprintf("    %s: %dx%d@%.2fHz at %d,%d scale %.2f\n", o.Name, o.Width, o.Height, o.RefreshRate, o.X, o.Y, o.Scale)
+				}
+			}
+			fmt.Print(output)
 			return nil
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "unlock",
-		Short: "Unlock the session",
+		Use:               "delete <name>",
+		Short:             "Delete a saved display profile",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFirst(displayProfileNames),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			di := desktopmonitor.GetDesktopIntegration()
-			result, err := di.UnlockSession(ctx)
-			if err != nil {
+			if err := desktopmonitor.GetDisplayProfileManager().Delete(args[0]); err != nil {
 				return err
 			}
-			fmt.Println(result)
+			fmt.Printf("Deleted display profile '%s'\n", args[0])
 			return nil
 		},
 	})
@@ -690,10 +2602,32 @@ func (c *CLI) createDesktopCmd() *cobra.Command {
 
 // Status formatting methods
 
-func (c *CLI) getGoogleDriveSyncStatus() string {
+func (c *CLI) getGoogleDriveSyncStatus(verbose bool) string {
+	if api.Remote() != "" {
+		status := daemonStatus()
+		switch {
+		case status == nil:
+			return fmt.Sprintf("The daemon on %s didn't answer.", api.Remote())
+		case !status.GDrive.Enabled:
+			return "Google Drive sync is disabled in config (gdrive.enabled = false)."
+		}
+		return c.formatGoogleDriveSyncStatus(status.GDrive, verbose)
+	}
+	if !c.daemon.GetConfig().GDriveEnabled {
+		return "Google Drive sync is disabled in config (gdrive.enabled = false)."
+	}
+
 	gd := c.daemon.GetGoogleDrive()
 	if gd == nil {
-		return "Google Drive sync is not initialized yet (may be starting in background)."
+		// Sync runs in the daemon, unless this process is the daemon
+		if status := daemonStatus(); status != nil {
+			return c.formatGoogleDriveSyncStatus(status.GDrive, verbose)
+		}
+		output := "Google Drive sync is not initialized yet (may be starting in background)."
+		if verbose {
+			output += "\n\n" + c.recentComponentLogs("gdrive", 10)
+		}
+		return output
 	}
 
 	status := gd.GetStatus()
@@ -743,7 +2677,11 @@ func (c *CLI) getGoogleDriveSyncStatus() string {
 					}
 				}
 				output += fmt.Sprintf("    %s %s\n", stateIcon, path)
-				output += fmt.Sprintf("       Status: %s\n", stateStatus)
+				if pid, ok := state["pid"].(int); ok && pid > 0 {
+					output += fmt.Sprintf("       Status: %s (rclone pid %d)\n", stateStatus, pid)
+				} else {
+					output += fmt.Sprintf("       Status: %s\n", stateStatus)
+				}
 
 				if lastSync, ok := state["lastSyncTime"].(time.Time); ok && !lastSync.IsZero() {
 					output += fmt.Sprintf("       Last sync: %s\n", formatTime(lastSync))
@@ -754,17 +2692,142 @@ func (c *CLI) getGoogleDriveSyncStatus() string {
 				if errMsg, ok := state["errorMessage"].(string); ok && errMsg != "" {
 					output += fmt.Sprintf("       Error: %s\n", errMsg)
 				}
+
+				if runLog, ok := state["runLog"].(string); ok && runLog != "" {
+					output += fmt.Sprintf("       Output: %s\n", runLog)
+				}
+
+				if entries, ok := state["recentLogs"].([]utility.LogEntry); ok && verbose && len(entries) > 0 {
+					output += "       Recent log:\n"
+					for _, entry := range entries {
+						output += fmt.Sprintf("         %s\n", entry.String())
+					}
+				}
+			}
+		}
+	}
+
+	return output
+}
+
+// formatGoogleDriveSyncStatus formats the sync state the daemon reported,
+// like getGoogleDriveSyncStatus does for sync in this process
+// printGoogleDriveWaybar prints the sync status as a Waybar custom module,
+// showing the sync stopped when the daemon doesn't answer
+func printGoogleDriveWaybar() error {
+	module := api.Waybar{Text: "–", Alt: api.WaybarStopped, Class: api.WaybarStopped, Tooltip: "The daemon isn't running"}
+	if status := daemonStatus(); status != nil {
+		module = api.GDriveWaybar(status.GDrive)
+	}
+	module.Tooltip = utility.Redact(module.Tooltip)
+	data, err := json.Marshal(module)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func (c *CLI) formatGoogleDriveSyncStatus(status api.GDriveStatus, verbose bool) string {
+	output := "Google Drive Sync Status:\n"
+	output += fmt.Sprintf("  Running: %s\n", boolToYesNo(status.Running))
+	if status.SyncInterval > 0 {
+		output += fmt.Sprintf("  Mode: periodic (every %v)\n", status.SyncInterval)
+	}
+	output += fmt.Sprintf("  Directories: %d\n", len(status.Directories))
+	output += fmt.Sprintf("  Queue Size: %d\n\n", status.QueueSize)
+
+	if len(status.Directories) > 0 {
+		output += "  Directory States:\n"
+		for _, directory := range status.Directories {
+			stateIcon := "✓"
+			switch directory.Status {
+			case "syncing":
+				stateIcon = "↻"
+			case "error":
+				stateIcon = "✗"
+			}
+			output += fmt.Sprintf("    %s %s\n", stateIcon, directory.Path)
+			output += fmt.Sprintf("       Status: %s\n", directory.Status)
+			if !directory.LastSync.IsZero() {
+				output += fmt.Sprintf("       Last sync: %s\n", formatTime(directory.LastSync))
+			} else {
+				output += "       Last sync: Never\n"
+			}
+			if directory.Error != "" {
+				output += fmt.Sprintf("       Error: %s\n", directory.Error)
+			}
+			if directory.RunLog != "" {
+				output += fmt.Sprintf("       Output: %s\n", directory.RunLog)
+			}
+		}
+	}
+
+	// The daemon keeps its log entries to itself, so read them from the logs
+	if verbose {
+		output += "\n" + c.recentComponentLogs("gdrive", 10)
+	}
+	return output
+}
+
+// formatSystemUpdateStatus formats the update state the daemon reported,
+// like getSystemUpdateStatus does for the scheduler in this process
+func formatSystemUpdateStatus(status api.UpdateStatus) string {
+	output := "System Update Status:\n"
+	output += fmt.Sprintf("  Running: %s\n", boolToYesNo(status.Running))
+	if status.LastUpdate.Unix() > 0 {
+		output += fmt.Sprintf("  Last Update: %s\n", formatTime(status.LastUpdate))
+	}
+	if status.NextUpdate.Unix() > 0 {
+		output += fmt.Sprintf("  Next Update: %s\n", formatTime(status.NextUpdate))
+	}
+
+	if len(status.History) > 0 {
+		output += "\n  Recent Updates:\n"
+		start := max(len(status.History)-5, 0)
+		for _, entry := range status.History[start:] {
+			success := "✓"
+			if !entry.Success {
+				success = "✗"
+			}
+			output += fmt.Sprintf("    %s %s (%.1fs)\n", success, formatTime(entry.Time), entry.Duration.Seconds())
+			if !entry.Success && len(entry.RunLogs) > 0 {
+				output += fmt.Sprintf("      Output: %s\n", entry.RunLogs[len(entry.RunLogs)-1])
 			}
 		}
 	}
+	return output
+}
 
+// recentComponentLogs formats the latest log entries of a component from the
+// journal or the log files, for when the daemon runs in another process
+func (c *CLI) recentComponentLogs(component string, n int) string {
+	entries, err := utility.RecentLogs(context.Background(), utility.LogFilter{Component: component}, n)
+	if err != nil {
+		return fmt.Sprintf("Could not read logs: %v\n", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("No %s log entries (see `daemira logs`).\n", component)
+	}
+	output := fmt.Sprintf("Recent %s log entries:\n", component)
+	for _, entry := range entries {
+		output += fmt.Sprintf("  %s\n", entry.String())
+	}
 	return output
 }
 
 func (c *CLI) getSystemUpdateStatus() string {
+	if !c.daemon.GetConfig().SystemUpdateEnabled {
+		return "System updates are disabled in config (system_update.enabled = false)."
+	}
+
 	su := c.daemon.GetSystemUpdate()
 	if su == nil {
-		return "System update scheduler is not initialized."
+		// Updates are scheduled in the daemon, unless this process is the daemon
+		if status := daemonStatus(); status != nil {
+			return formatSystemUpdateStatus(status.SystemUpdate) + c.keyringStatus()
+		}
+		return "System update scheduler is not initialized.\n" + c.keyringStatus()
 	}
 
 	status := su.GetStatus()
@@ -792,13 +2855,66 @@ func (c *CLI) getSystemUpdateStatus() string {
 				success = "✗"
 			}
 			output += fmt.Sprintf("    %s %s (%.1fs)\n", success, formatTime(entry.Timestamp), entry.Duration.Seconds())
+			if !entry.Success && len(entry.RunLogs) > 0 {
+				output += fmt.Sprintf("      Output: %s\n", entry.RunLogs[len(entry.RunLogs)-1])
+			}
+		}
+	}
+
+	return output + c.keyringStatus()
+}
+
+// keyringStatus describes pacman's keyring: the keyring packages, expired
+// keys and the trust database
+func (c *CLI) keyringStatus() string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	status, err := systemupdate.InspectKeyring(ctx, utility.NewShell(utility.GetLogger()), utility.GetPrivilegeManager())
+	if err != nil {
+		return fmt.Sprintf("\n  Keyring: Unable to check (%v)\n", err)
+	}
+
+	output := "\n  Keyring:\n"
+	for _, pkg := range status.Packages {
+		output += fmt.Sprintf("    %s %s", pkg.Name, pkg.Version)
+		if !pkg.BuildDate.IsZero() {
+			output += fmt.Sprintf(", built %s ago", formatAge(time.Since(pkg.BuildDate)))
+		}
+		if pkg.Outdated() {
+			output += fmt.Sprintf(" (%s available)", pkg.Available)
+		}
+		output += "\n"
+	}
+	switch {
+	case !status.TrustDBChecked:
+		output += "    Keys: Not checked (needs root or passwordless sudo)\n"
+	case len(status.Expired) > 0:
+		output += fmt.Sprintf("    Keys: %d expired, refreshed before the next update\n", len(status.Expired))
+		for idx, key := range status.Expired {
+			if idx == 5 {
+				output += fmt.Sprintf("      ... and %d more\n", len(status.Expired)-idx)
+				break
+			}
+			output += fmt.Sprintf("      %s (%s, expired %s)\n", key.UID, key.Fingerprint, key.Expired.Format("2006-01-02"))
 		}
+	default:
+		output += "    Keys: None expired\n"
+	}
+	if status.TrustDB != "" {
+		output += fmt.Sprintf("    Trust database: %s\n", status.TrustDB)
+	} else if status.TrustDBChecked {
+		output += "    Trust database: OK\n"
 	}
 
+	maxAge := c.daemon.GetConfig().SystemUpdateKeyringMaxAge
+	if problems := status.Problems(maxAge); len(problems) > 0 {
+		output += fmt.Sprintf("    ⚠️  Stale: %s\n", strings.Join(problems, "; "))
+	}
 	return output
 }
 
 func (c *CLI) getSystemStatus(ctx context.Context) (string, error) {
+	cfg := c.daemon.GetConfig()
 	output := "=== Daemira System Status ===\n\n"
 
 	// CPU & Performance
@@ -829,7 +2945,7 @@ func (c *CLI) getSystemStatus(ctx context.Context) (string, error) {
 	}
 
 	// Disk space warnings
-	dm := systemhealth.GetDiskMonitor()
+	dm := c.diskMonitor()
 	if warnings, err := dm.CheckLowSpace(ctx); err == nil {
 		if len(warnings) > 0 {
 			output += fmt.Sprintf("\n⚠️  Disk Warnings: %d\n", len(warnings))
@@ -847,10 +2963,46 @@ func (c *CLI) getSystemStatus(ctx context.Context) (string, error) {
 		output += "Disk Space: Unable to check\n"
 	}
 
-	// Google Drive status
+	// Firewall
+	if firewall, err := systemhealth.GetSecurityMonitor().GetFirewallStatus(ctx); err == nil {
+		if firewall.Active == "" {
+			output += fmt.Sprintf("⚠️  Firewall: %s (daemira security firewall enable)\n", firewall.Summary())
+		} else {
+			output += fmt.Sprintf("Firewall: %s\n", firewall.Summary())
+		}
+	} else {
+		output += "Firewall: Unable to check\n"
+	}
+
+	// VPN, and whether all traffic goes through it
+	if vpns, err := network.DetectVPNs(ctx, utility.NewShell(utility.GetLogger())); err == nil {
+		if len(vpns.Up(cfg.VPNNames)) == 0 && len(cfg.VPNRequiredFor) > 0 {
+			output += fmt.Sprintf("⚠️  VPN: %s (holding %s sync)\n", vpns.Summary(), strings.Join(cfg.VPNRequiredFor, " and "))
+		} else {
+			output += fmt.Sprintf("VPN: %s\n", vpns.Summary())
+		}
+	}
+
+	if !cfg.HealthEnabled {
+		output += "Health Monitoring: Disabled\n"
+	}
+
+	// Alerts, telling new problems from those already acknowledged
+	output += "\n" + alertsSummary()
+
+	// Google Drive status, from the daemon unless this process is the daemon
 	output += "\n"
 	gd := c.daemon.GetGoogleDrive()
-	if gd != nil {
+	su := c.daemon.GetSystemUpdate()
+	var daemon *api.Status
+	if gd == nil || su == nil {
+		daemon = daemonStatus()
+	}
+	if !cfg.GDriveEnabled {
+		output += "Google Drive: Disabled\n"
+	} else if gd == nil && daemon != nil {
+		output += fmt.Sprintf("Google Drive: %s (%d queued)%s\n", boolToRunningStopped(daemon.GDrive.Running), daemon.GDrive.QueueSize, pausedNote(daemon.GDrive.Paused))
+	} else if gd != nil {
 		gdStatus := gd.GetStatus()
 		running := false
 		if r, ok := gdStatus["running"].(bool); ok {
@@ -860,14 +3012,22 @@ func (c *CLI) getSystemStatus(ctx context.Context) (string, error) {
 		if q, ok := gdStatus["queueSize"].(int); ok {
 			queueSize = q
 		}
-		output += fmt.Sprintf("Google Drive: %s (%d queued)\n", boolToRunningStopped(running), queueSize)
+		paused, _ := gdStatus["paused"].(string)
+		output += fmt.Sprintf("Google Drive: %s (%d queued)%s\n", boolToRunningStopped(running), queueSize, pausedNote(paused))
 	} else {
 		output += "Google Drive: Not initialized\n"
 	}
 
 	// System Update status
-	su := c.daemon.GetSystemUpdate()
-	if su != nil {
+	if !cfg.SystemUpdateEnabled {
+		output += "System Update: Disabled\n"
+	} else if su == nil && daemon != nil {
+		if lastUpdate := daemon.SystemUpdate.LastUpdate; lastUpdate.Unix() > 0 {
+			output += fmt.Sprintf("System Update: Last %.1fh ago\n", time.Since(lastUpdate).Hours())
+		} else {
+			output += "System Update: Never run\n"
+		}
+	} else if su != nil {
 		suStatus := su.GetStatus()
 		if lastUpdate, ok := suStatus["lastUpdate"].(int64); ok && lastUpdate > 0 {
 			hoursSince := time.Since(time.Unix(lastUpdate, 0)).Hours()
@@ -879,14 +3039,46 @@ func (c *CLI) getSystemStatus(ctx context.Context) (string, error) {
 		output += "System Update: Not initialized\n"
 	}
 
+	// Notion status
+	switch {
+	case !cfg.NotionEnabled:
+		output += "Notion: Disabled\n"
+	case cfg.NotionToken == "":
+		output += "Notion: Not configured\n"
+	case daemon != nil && daemon.NotionSync.Paused != "":
+		output += "Notion: Configured" + pausedNote(daemon.NotionSync.Paused) + "\n"
+	default:
+		output += "Notion: Configured\n"
+	}
+
 	// Desktop Environment
 	di := desktopmonitor.GetDesktopIntegration()
-	if desktopSummary, err := di.GetDesktopSummary(ctx); err == nil {
+	if !cfg.DesktopEnabled {
+		output += "\nDesktop Integration: Disabled\n"
+	} else if desktopSummary, err := di.GetDesktopSummary(ctx); err == nil {
 		output += fmt.Sprintf("\nDesktop Environment:\n  %s\n", desktopSummary)
 	} else {
 		output += "\nDesktop Environment: Unable to query\n"
 	}
 
+	// Sleep/shutdown inhibitors (daemira holds these during syncs and updates)
+	if inhibitors, err := desktopmonitor.GetSessionMonitor().GetInhibitors(ctx); err == nil {
+		blocking := []desktopmonitor.Inhibitor{}
+		for _, inhibitor := range inhibitors {
+			if inhibitor.Mode == "block" && (strings.Contains(inhibitor.What, "sleep") || strings.Contains(inhibitor.What, "shutdown")) {
+				blocking = append(blocking, inhibitor)
+			}
+		}
+		if len(blocking) > 0 {
+			output += fmt.Sprintf("\nActive Inhibitors: %d\n", len(blocking))
+			for _, inhibitor := range blocking {
+				output += fmt.Sprintf("  %s (%s): %s\n", inhibitor.Who, inhibitor.What, inhibitor.Why)
+			}
+		} else {
+			output += "\nActive Inhibitors: None\n"
+		}
+	}
+
 	return output, nil
 }
 
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/config"
+	desktopmonitor "github.com/ln64-git/daemira/src/features/desktop-monitor"
+	"github.com/ln64-git/daemira/src/features/installer"
+	"github.com/spf13/cobra"
+)
+
+// Dynamic shell completion: candidates that depend on the machine, like the
+// synced directories or the install steps. Logs go to stderr while
+// completing (see logOutput), which the completion scripts discard.
+
+// completionFunc completes a command's arguments or a flag's value
+type completionFunc func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// completeFirst completes only the first argument, from candidates
+func completeFirst(candidates func() []string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return candidates(), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeAll completes every argument from candidates not given yet
+func completeAll(candidates func() []string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var remaining []string
+		for _, candidate := range candidates() {
+			given := false
+			for _, arg := range args {
+				given = given || arg == candidate
+			}
+			if !given {
+				remaining = append(remaining, candidate)
+			}
+		}
+		return remaining, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeValues completes a flag from candidates
+func completeValues(candidates func() []string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return candidates(), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// syncedDirectories lists the directories Google Drive sync handles, asking
+// the running daemon and falling back to the config
+func (c *CLI) syncedDirectories() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if status, err := api.NewClient("").GDriveStatus(ctx); err == nil && len(status.Directories) > 0 {
+		dirs := make([]string, 0, len(status.Directories))
+		for _, directory := range status.Directories {
+			dirs = append(dirs, directory.Path)
+		}
+		return dirs
+	}
+	return c.daemon.GetConfig().RcloneDirectories
+}
+
+// installStepIDs lists the IDs of the install steps, with their names as
+// descriptions
+func (c *CLI) installStepIDs() []string {
+	inst, err := installer.NewInstaller(c.logger, &installer.InstallerOptions{DryRun: true})
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, step := range inst.ListSteps() {
+		ids = append(ids, step.ID+"\t"+step.Name)
+	}
+	return ids
+}
+
+// installProfiles lists the profiles of the install manifest
+func installProfiles() []string {
+	manifest, err := installer.LoadManifest("")
+	if err != nil {
+		return nil
+	}
+	return manifest.ProfileNames()
+}
+
+// settingKeys lists every config setting, with its description
+func settingKeys() []string {
+	var keys []string
+	for _, setting := range config.Settings() {
+		keys = append(keys, setting.Key+"\t"+setting.Description)
+	}
+	return keys
+}
+
+// completeSetting completes a setting's key, then its value where the
+// setting only allows some
+func completeSetting(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return settingKeys(), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		if setting, ok := config.Lookup(args[0]); ok && len(setting.Enum) > 0 {
+			return setting.Enum, cobra.ShellCompDirectiveNoFileComp
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// displayProfileNames lists the saved monitor layouts
+func displayProfileNames() []string {
+	profiles, err := desktopmonitor.GetDisplayProfileManager().List()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// sessionEventNames lists the events session hooks can run on
+func sessionEventNames() []string {
+	names := make([]string, 0, len(desktopmonitor.SessionEvents))
+	for _, event := range desktopmonitor.SessionEvents {
+		names = append(names, string(event))
+	}
+	return names
+}
+
+// jobIDs lists the running daemon's jobs, with their descriptions
+func jobIDs() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	jobs, err := api.NewClient("").Jobs(ctx)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID+"\t"+job.Description)
+	}
+	return ids
+}
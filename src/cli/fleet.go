@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/fleet"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createFleetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "fleet",
+		Short:        "Status of every machine reporting to the fleet endpoint",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := c.fleetStatus()
+			if err != nil {
+				return err
+			}
+			fmt.Print(output)
+			return nil
+		},
+	}
+
+	var watch watchOptions
+	statusCmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show the latest report of each machine",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return watch.show(cmd, c.fleetStatus)
+		},
+	}
+	addWatchFlags(statusCmd, &watch)
+	cmd.AddCommand(statusCmd)
+
+	return cmd
+}
+
+// fleetStatus fetches every machine's report and describes them
+func (c *CLI) fleetStatus() (string, error) {
+	cfg := c.daemon.GetConfig()
+	if cfg.FleetEndpoint == "" {
+		return "Fleet reports: Not configured (set fleet.endpoint and fleet.secret)\n", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// Without the secret reports are still shown, marked unverified
+	secret, secretErr := cfg.Secret(ctx, "fleet.secret")
+	machines, err := fleet.Fetch(ctx, cfg.FleetEndpoint, secret)
+	if err != nil {
+		return "", err
+	}
+	if len(machines) == 0 {
+		return "No machines have reported yet\n", nil
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("%-20s %-13s %-12s %-10s %-10s %-10s %5s %5s\n", "MACHINE", "REPORTED", "STATE", "UPDATE", "BACKUP", "SNAPSHOT", "DISK", "MEM"))
+	var details []string
+	for _, machine := range machines {
+		state := "ok"
+		switch problems := machine.Problems(); {
+		case machine.Stale():
+			state = "offline"
+		case problems == 1:
+			state = "1 problem"
+		case problems > 1:
+			state = fmt.Sprintf("%d problems", problems)
+		}
+		name := machine.Machine
+		if !machine.Verified {
+			name += " (?)"
+		}
+		output.WriteString(fmt.Sprintf("%-20s %-13s %-12s %-10s %-10s %-10s %4.0f%% %4.0f%%\n",
+			name, formatAge(time.Since(machine.Reported))+" ago", state,
+			fleetAge(machine.LastUpdate, machine.UpdateError),
+			fleetAge(machine.LastBackup, machine.BackupError),
+			fleetAge(machine.LastSnapshot, machine.SnapshotError),
+			machine.DiskUsedPct, machine.MemoryUsedPct))
+		details = append(details, fleetProblems(machine)...)
+	}
+
+	if len(details) > 0 {
+		output.WriteString("\n")
+		for _, detail := range details {
+			output.WriteString(detail + "\n")
+		}
+	}
+	for _, machine := range machines {
+		if !machine.Verified {
+			output.WriteString("\n(?) Not signed with fleet.secret")
+			if secretErr != nil {
+				output.WriteString(fmt.Sprintf(" (%v)", secretErr))
+			}
+			output.WriteString("; don't trust what it says\n")
+			break
+		}
+	}
+	return utility.Redact(output.String()), nil
+}
+
+// fleetAge describes when something last succeeded, or that it failed
+func fleetAge(last time.Time, err string) string {
+	switch {
+	case err != "":
+		return "failed"
+	case last.IsZero() || last.Unix() <= 0:
+		return "-"
+	default:
+		return formatAge(time.Since(last)) + " ago"
+	}
+}
+
+// fleetProblems lists what needs looking at on a machine
+func fleetProblems(machine fleet.Machine) []string {
+	var problems []string
+	for _, alert := range machine.Alerts {
+		icon := "🟡"
+		if alert.Severity == utility.AlertCritical {
+			icon = "🔴"
+		}
+		known := ""
+		if alert.Known {
+			known = " (known)"
+		}
+		problems = append(problems, fmt.Sprintf("  %s %s: %s%s", icon, machine.Machine, alert.Summary, known))
+	}
+	for _, failure := range []struct{ what, err string }{
+		{"System update", machine.UpdateError},
+		{"Backup", machine.BackupError},
+		{"Snapshot", machine.SnapshotError},
+	} {
+		if failure.err != "" {
+			problems = append(problems, fmt.Sprintf("  ✗ %s: %s failed: %s", machine.Machine, failure.what, failure.err))
+		}
+	}
+	for _, dir := range machine.SyncErrors {
+		problems = append(problems, fmt.Sprintf("  ✗ %s: Sync of %s failed", machine.Machine, dir))
+	}
+	if len(machine.FailingJobs) > 0 {
+		problems = append(problems, fmt.Sprintf("  ✗ %s: Jobs failing: %s", machine.Machine, strings.Join(machine.FailingJobs, ", ")))
+	}
+	return problems
+}
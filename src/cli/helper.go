@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createHelperCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "helper",
+		Short: "Root helper running system updates, TRIM and DKMS for the daemon running as you",
+		Long: `The daemon runs as you; the root helper is an optional system service
+running the few commands that need root (the system update's, TRIM and
+DKMS) for the users it serves, instead of sudo. Other commands still go
+through sudo.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printHelperStatus()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "status",
+		Short:        "Show whether the root helper answers and the commands it runs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printHelperStatus()
+		},
+	})
+
+	var users []string
+	serveCmd := &cobra.Command{
+		Use:          "serve",
+		Short:        "Run the root helper (as root, from " + utility.RootHelperUnit + ")",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !utility.GetPrivilegeManager().IsRoot() {
+				return fmt.Errorf("the root helper runs as root; install it with: daemira helper install")
+			}
+			helper, err := utility.NewRootHelper(users)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return helper.Serve(ctx)
+		},
+	}
+	serveCmd.Flags().StringArrayVar(&users, "user", nil, "User the helper serves (repeatable)")
+	cmd.AddCommand(serveCmd)
+
+	execCmd := &cobra.Command{
+		Use:                "exec -- <command...>",
+		Short:              "Run a command through the root helper",
+		Hidden:             true,
+		Args:               cobra.MinimumNArgs(1),
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			code, err := utility.RunRootHelper(ctx, args, os.Stdout, os.Stderr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "daemira helper: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(code)
+			return nil
+		},
+	}
+	// It passes its command's output through untouched
+	logTo(logsDiscard, execCmd)
+	cmd.AddCommand(execCmd)
+
+	var binary string
+	installCmd := &cobra.Command{
+		Use:          "install",
+		Short:        "Install and start " + utility.RootHelperUnit + " for you",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if binary == "" {
+				self, err := os.Executable()
+				if err != nil {
+					return fmt.Errorf("failed to locate the daemira binary: %w", err)
+				}
+				if binary, err = filepath.EvalSymlinks(self); err != nil {
+					return fmt.Errorf("failed to locate the daemira binary: %w", err)
+				}
+			}
+			return installRootHelper(binary)
+		},
+	}
+	installCmd.Flags().StringVar(&binary, "binary", "", "daemira binary the helper runs, owned and writable only by root (default: this one)")
+	cmd.AddCommand(installCmd)
+
+	// Logs go to stderr, the journal as a service, beside the status it prints
+	logTo(logsToStderr, cmd)
+
+	return cmd
+}
+
+// printHelperStatus prints whether the root helper answers and what it runs
+func printHelperStatus() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !utility.RootHelperInstalled() {
+		fmt.Printf("Root helper: not installed (no %s); root commands go through sudo\n", utility.RootHelperSocket)
+		fmt.Println("Install it with: daemira helper install")
+	} else if err := utility.PingRootHelper(ctx); err != nil {
+		fmt.Printf("Root helper: not answering: %v\n", err)
+	} else {
+		fmt.Printf("Root helper: running (%s)\n", utility.RootHelperSocket)
+	}
+
+	fmt.Println("\nCommands it runs:")
+	for _, command := range utility.RootHelperCommands() {
+		fmt.Printf("  %s\n", command)
+	}
+	return nil
+}
+
+// checkHelperBinary refuses a binary only root may replace: it and every
+// directory above it must be root's and writable by no one else, or root
+// would run whatever their owner puts there
+func checkHelperBinary(binary string) error {
+	resolved, err := filepath.EvalSymlinks(binary)
+	if err != nil {
+		return fmt.Errorf("failed to locate %s: %w", binary, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to locate %s: %w", binary, err)
+	}
+	for path := resolved; ; path = filepath.Dir(path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != 0 {
+			return fmt.Errorf("%s isn't owned by root; install daemira system-wide (e.g. to /usr/local/bin) or pass --binary", path)
+		}
+		if info.Mode().Perm()&0022 != 0 {
+			return fmt.Errorf("%s is writable by others than root; install daemira system-wide (e.g. to /usr/local/bin) or pass --binary", path)
+		}
+		if path == filepath.Dir(path) {
+			return nil
+		}
+	}
+}
+
+// installRootHelper installs the helper's system unit for the current user
+// and starts it, through sudo
+func installRootHelper(binary string) error {
+	if err := checkHelperBinary(binary); err != nil {
+		return err
+	}
+	current, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	privileges := utility.GetPrivilegeManager()
+	if err := privileges.Authenticate(ctx); err != nil {
+		return fmt.Errorf("installing the root helper needs root: %w", err)
+	}
+
+	staged, err := os.CreateTemp("", "daemira-helper-*.service")
+	if err != nil {
+		return fmt.Errorf("failed to stage the unit: %w", err)
+	}
+	defer os.Remove(staged.Name())
+	if _, err := staged.WriteString(utility.RootHelperUnitFile(binary, []string{current.Username})); err != nil {
+		staged.Close()
+		return fmt.Errorf("failed to stage the unit: %w", err)
+	}
+	staged.Close()
+
+	unitPath := filepath.Join("/etc/systemd/system", utility.RootHelperUnit)
+	shell := utility.NewShell(utility.GetLogger())
+	for _, argv := range [][]string{
+		{"install", "-m", "644", staged.Name(), unitPath},
+		{"systemctl", "daemon-reload"},
+		{"systemctl", "enable", utility.RootHelperUnit},
+		{"systemctl", "restart", utility.RootHelperUnit},
+	} {
+		argv = privileges.Command(argv...)
+		result, err := shell.ExecuteArgs(ctx, argv[0], argv[1:], &utility.ExecOptions{Timeout: time.Minute})
+		if err != nil {
+			return fmt.Errorf("failed to run %s: %w", utility.CommandLine(argv...), err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%s: %s", utility.CommandLine(argv...), strings.TrimSpace(result.Stderr))
+		}
+	}
+	fmt.Printf("Installed %s, serving %s\n", unitPath, current.Username)
+
+	// The socket shows up once the service started
+	for range 20 {
+		if utility.RootHelperInstalled() {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return printHelperStatus()
+}
@@ -28,6 +28,21 @@ func boolToRunningStopped(b bool) string {
 	return "Stopped"
 }
 
+func boolToOkMissing(b bool) string {
+	if b {
+		return "ok"
+	}
+	return "MISSING"
+}
+
+// pausedNote describes why a sync is paused, "" if it isn't
+func pausedNote(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return " (paused: " + reason + ")"
+}
+
 func formatTime(t time.Time) string {
 	if t.IsZero() {
 		return "Never"
@@ -45,3 +60,16 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.1fh", d.Hours())
 }
 
+// parseSince parses a --since value: a duration ago (1h, 30m) or a local
+// date with an optional time
+func parseSince(value string) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (use a duration like 1h or a time like 2006-01-02 15:04)", value)
+}
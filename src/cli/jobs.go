@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createJobsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "jobs",
+		Short:        "Scheduled jobs of the running daemon (updates, syncs, checks, reports)",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listJobs()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List jobs with their schedules and last runs",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listJobs()
+		},
+	})
+
+	var background bool
+	runCmd := &cobra.Command{
+		Use:               "run <id>",
+		Short:             "Run a job now, even if it is disabled",
+		Args:              cobra.ExactArgs(1),
+		SilenceUsage:      true,
+		ValidArgsFunction: completeFirst(jobIDs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !background {
+				fmt.Printf("Running %s...\n", args[0])
+			}
+			result, err := api.NewClient("").RunJob(context.Background(), args[0], !background)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.Message)
+			return nil
+		},
+	}
+	runCmd.Flags().BoolVarP(&background, "background", "b", false, "Return once the job started instead of when it finished")
+	cmd.AddCommand(runCmd)
+
+	// All of them only talk to the daemon
+	allowRemote(append([]*cobra.Command{cmd}, cmd.Commands()...)...)
+
+	return cmd
+}
+
+// listJobs prints the daemon's jobs
+func listJobs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	jobs, err := api.NewClient("").Jobs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs scheduled. Features add their jobs when they start.")
+		return nil
+	}
+
+	fmt.Printf("%-16s %-24s %-14s %s\n", "JOB", "SCHEDULE", "NEXT RUN", "LAST RUN")
+	for _, job := range jobs {
+		schedule := job.Schedule
+		if job.Overridden {
+			// Set in jobs.schedules
+			schedule += " (custom)"
+		}
+
+		next := "in " + formatAge(time.Until(job.NextRun))
+		switch {
+		case job.Running:
+			next = "running"
+		case !job.Enabled:
+			next = "disabled"
+		case job.Timer:
+			next = "systemd timer"
+		case job.NextRun.IsZero():
+			next = "never"
+		case !job.NextRun.After(time.Now()):
+			next = "due"
+		}
+
+		last := "never"
+		if !job.LastRun.IsZero() {
+			outcome := "ok"
+			if job.LastError != "" {
+				outcome = "failed"
+			}
+			last = fmt.Sprintf("%s ago, %s (%s)", formatAge(time.Since(job.LastRun)), outcome, formatDuration(job.LastDuration))
+		}
+
+		fmt.Printf("%-16s %-24s %-14s %s\n", job.ID, schedule, next, last)
+		if job.LastError != "" {
+			fmt.Printf("%-16s %s\n", "", job.LastError)
+		}
+	}
+	return nil
+}
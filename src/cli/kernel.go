@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createKernelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "kernel",
+		Short:        "Check the kernel parameters in health.kernel_params and that CPU microcode is loaded",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printKernelStatus()
+		},
+	}
+}
+
+// printKernelStatus prints the expected kernel parameters, now and at the
+// next boot, and the microcode state
+func (c *CLI) printKernelStatus() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	km := systemhealth.GetKernelMonitor()
+	km.SetExpected(c.daemon.GetConfig().KernelParams)
+	status, err := km.Inspect(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Command line: %s\n", strings.Join(status.Cmdline, " "))
+	expected := km.Expected()
+	if len(expected) == 0 {
+		fmt.Println("\nNo kernel parameters expected (set health.kernel_params, e.g. [\"zswap.enabled=0\", \"mitigations=auto\"])")
+	} else {
+		fmt.Printf("\n%-28s %-8s %s\n", "PARAMETER", "RUNNING", "NEXT BOOT")
+		for _, param := range expected {
+			nextBoot := "unknown"
+			if status.NextBoot != nil {
+				nextBoot = boolToOkMissing(param.Matches(status.NextBoot))
+			}
+			fmt.Printf("%-28s %-8s %s\n", topTruncate(string(param), 28), boolToOkMissing(param.Matches(status.Cmdline)), nextBoot)
+		}
+		if status.NextBoot == nil {
+			fmt.Println("The next boot entry is unknown (no readable /boot/grub/grub.cfg)")
+		}
+	}
+
+	mc := status.Microcode
+	fmt.Println()
+	switch {
+	case mc.Package == "":
+		fmt.Printf("Microcode: not checked for this CPU (%s)\n", mc.Vendor)
+	case mc.Virtual:
+		fmt.Printf("Microcode: revision %s, loaded by the virtual machine's host\n", mc.Revision)
+	case mc.Early != "":
+		fmt.Printf("Microcode: %s loaded by the %s (revision %s)\n", mc.Package, mc.Early, mc.Revision)
+	default:
+		fmt.Printf("Microcode: revision %s\n", mc.Revision)
+	}
+	if problem := status.MicrocodeProblem(); problem != "" {
+		fmt.Printf("⚠️  %s\n", problem)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// logOutputAnnotation marks the commands, and flags, printing machine-readable
+// output on stdout; its value says where logs go instead
+const logOutputAnnotation = "log-output"
+
+// Where logs of commands marked with logOutputAnnotation go
+const (
+	logsToStderr = "stderr"
+	logsDiscard  = "discard"
+)
+
+// logTo sends the logs of cmds and their subcommands to output (logsToStderr
+// or logsDiscard); a subcommand can choose otherwise
+func logTo(output string, cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		if cmd.Annotations == nil {
+			cmd.Annotations = map[string]string{}
+		}
+		cmd.Annotations[logOutputAnnotation] = output
+	}
+}
+
+// logFlagTo sends cmd's logs to output when flag is given
+func logFlagTo(output string, cmd *cobra.Command, flag string) {
+	_ = cmd.Flags().SetAnnotation(flag, logOutputAnnotation, []string{output})
+}
+
+// logOutput returns where the logs of cmd, with its flags parsed, go, or nil
+// for stdout
+func logOutput(cmd *cobra.Command) io.Writer {
+	output := ""
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if values := flag.Annotations[logOutputAnnotation]; len(values) > 0 {
+			output = values[0]
+		}
+	})
+	for parent := cmd; output == "" && parent != nil; parent = parent.Parent() {
+		output = parent.Annotations[logOutputAnnotation]
+	}
+	// Cobra only adds the command completing arguments while executing, so
+	// it can't be marked; the shells read candidates from its stdout
+	if output == "" && (cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd) {
+		output = logsToStderr
+	}
+
+	switch output {
+	case logsToStderr:
+		return os.Stderr
+	case logsDiscard:
+		return io.Discard
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/network"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createNetworkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "network",
+		Short:        "The Wi-Fi network in use, its network profile and VPNs",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.networkStatus()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "status",
+		Short:        "Show the Wi-Fi network in use and the network profile applying to it",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.networkStatus()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "vpn",
+		Short:        "Show the VPNs found and whether all traffic goes through one",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.vpnStatus()
+		},
+	})
+
+	return cmd
+}
+
+// vpnStatus prints the VPNs found, where the default route goes and the
+// syncs held while no VPN is up
+func (c *CLI) vpnStatus() error {
+	cfg := c.daemon.GetConfig()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	status, err := network.DetectVPNs(ctx, utility.NewShell(utility.GetLogger()))
+	if err != nil {
+		return err
+	}
+
+	if len(status.VPNs) == 0 {
+		fmt.Println("No VPNs found (WireGuard, tun/tap or Tailscale)")
+	} else {
+		fmt.Printf("%-16s %-10s %-5s %s\n", "NAME", "KIND", "UP", "DETAIL")
+		for _, vpn := range status.VPNs {
+			var detail []string
+			if len(vpn.Addresses) > 0 {
+				detail = append(detail, strings.Join(vpn.Addresses, ", "))
+			}
+			if vpn.ExitNode != "" {
+				detail = append(detail, "exit node "+vpn.ExitNode)
+			}
+			fmt.Printf("%-16s %-10s %-5s %s\n", topTruncate(vpn.Name, 16), vpn.Kind, boolToYesNo(vpn.Up), strings.Join(detail, ", "))
+		}
+	}
+
+	route := status.DefaultRoute
+	if route == "" {
+		route = "none"
+	}
+	if status.FullTunnel() {
+		fmt.Printf("\nDefault route: %s (all traffic goes through the VPN)\n", route)
+	} else {
+		fmt.Printf("\nDefault route: %s (traffic leaves outside any VPN)\n", route)
+	}
+
+	if len(cfg.VPNRequiredFor) == 0 {
+		fmt.Println("No syncs wait for the VPN (set vpn.required_for, e.g. [\"gdrive\", \"notion\"])")
+		return nil
+	}
+	if len(status.Up(cfg.VPNNames)) == 0 {
+		fmt.Printf("Holding %s sync until a VPN is up\n", strings.Join(cfg.VPNRequiredFor, " and "))
+	} else {
+		fmt.Printf("%s sync run while the VPN is up\n", strings.Join(cfg.VPNRequiredFor, " and "))
+	}
+	return nil
+}
+
+// networkStatus prints the network in use and the configured profiles
+func (c *CLI) networkStatus() error {
+	cfg := c.daemon.GetConfig()
+	profiles, err := network.ParseNetworkProfiles(cfg.NetworkProfiles)
+	if err != nil {
+		return err
+	}
+
+	monitor := network.GetNetworkMonitor()
+	if !monitor.IsAvailable() {
+		return fmt.Errorf("nmcli not found (network profiles need NetworkManager)")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	current, err := monitor.Detect(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Network: %s\n", current)
+	if current.Device != "" {
+		fmt.Printf("Device:  %s\n", current.Device)
+	}
+	if profile := network.MatchProfile(profiles, current); profile != nil {
+		fmt.Printf("Profile: %s (%s)\n", profile.Name, profile.Effects())
+	} else {
+		fmt.Println("Profile: none")
+	}
+
+	if len(profiles) == 0 {
+		fmt.Println("\nNo network profiles configured (set network.profiles, e.g. \"name=hotspot metered=true pause_updates=true\")")
+		return nil
+	}
+	fmt.Printf("\n%-16s %-20s %-8s %s\n", "PROFILE", "SSID", "METERED", "EFFECTS")
+	for _, profile := range profiles {
+		ssid, metered := profile.SSID, profile.Metered
+		if ssid == "" {
+			ssid = "*"
+		}
+		if metered == "" {
+			metered = "any"
+		}
+		fmt.Printf("%-16s %-20s %-8s %s\n", topTruncate(profile.Name, 16), topTruncate(ssid, 20), metered, profile.Effects())
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/spf13/cobra"
+)
+
+// remoteAnnotation marks the commands that can run against another
+// machine's daemon with --host
+const remoteAnnotation = "remote"
+
+// allowRemote lets commands run with --host; they must reach the daemon
+// only through api.NewClient("")
+func allowRemote(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		if cmd.Annotations == nil {
+			cmd.Annotations = map[string]string{}
+		}
+		cmd.Annotations[remoteAnnotation] = "true"
+	}
+}
+
+// useRemote points the API client at the daemon on host, with the key from
+// DAEMIRA_API_KEY or api.key
+func (c *CLI) useRemote(cmd *cobra.Command, host string) error {
+	if cmd.Annotations[remoteAnnotation] == "" {
+		return fmt.Errorf("`%s` runs on this machine and can't be used with --host", cmd.CommandPath())
+	}
+
+	key := os.Getenv("DAEMIRA_API_KEY")
+	if key == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		secret, err := c.daemon.GetConfig().Secret(ctx, "api.key")
+		if err != nil {
+			return fmt.Errorf("no API key for %s: %w (or set DAEMIRA_API_KEY)", host, err)
+		}
+		key = secret
+	}
+	api.UseRemote(host, key)
+	return nil
+}
+
+// getRemoteStatus builds `daemira status` from the daemon on the --host
+// machine, which measures its own health
+func (c *CLI) getRemoteStatus(ctx context.Context) (string, error) {
+	host := api.Remote()
+	client := api.NewClient("")
+	status, err := client.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+	output := fmt.Sprintf("=== Daemira Status on %s ===\n\n", host)
+	output += fmt.Sprintf("Daemon: running for %s (pid %d)\n", formatAge(time.Since(status.Started)), status.PID)
+
+	if health, err := client.Health(ctx); err == nil {
+		output += fmt.Sprintf("CPU: %.1f%% utilized", health.CPUUtilization)
+		if health.PowerProfile != "" {
+			output += fmt.Sprintf(" (%s)", health.PowerProfile)
+		}
+		output += "\n"
+		output += fmt.Sprintf("Memory: %.1fGB / %.1fGB", health.MemoryUsedGB, health.MemoryTotalGB)
+		if health.SwapUsedGB > 0 {
+			output += fmt.Sprintf(" + %.1fGB swap", health.SwapUsedGB)
+		}
+		output += "\n"
+		if len(health.DiskWarnings) > 0 {
+			output += fmt.Sprintf("\n⚠️  Disk Warnings: %d\n", len(health.DiskWarnings))
+			for _, warning := range health.DiskWarnings {
+				icon := "🟡"
+				if warning.Level == "critical" {
+					icon = "🔴"
+				}
+				output += fmt.Sprintf("  %s %s: %.1fGB free\n", icon, warning.MountPoint, warning.FreeGB)
+			}
+		} else {
+			output += "Disk Space: All healthy\n"
+		}
+		if health.Firewall == "" {
+			output += "⚠️  Firewall: None active\n"
+		} else {
+			output += fmt.Sprintf("Firewall: %s\n", health.Firewall)
+		}
+	} else {
+		output += fmt.Sprintf("Health: Unable to check (%v)\n", err)
+	}
+
+	output += "\n" + alertsSummary() + "\n"
+
+	switch {
+	case !status.GDrive.Enabled:
+		output += "Google Drive: Disabled\n"
+	default:
+		output += fmt.Sprintf("Google Drive: %s (%d queued)%s\n", boolToRunningStopped(status.GDrive.Running), status.GDrive.QueueSize, pausedNote(status.GDrive.Paused))
+	}
+	switch {
+	case !status.SystemUpdate.Enabled:
+		output += "System Update: Disabled\n"
+	case status.SystemUpdate.LastUpdate.Unix() > 0:
+		output += fmt.Sprintf("System Update: Last %.1fh ago\n", time.Since(status.SystemUpdate.LastUpdate).Hours())
+	default:
+		output += "System Update: Never run\n"
+	}
+	switch {
+	case !status.NotionSync.Enabled:
+		output += "Notion: Disabled\n"
+	case status.NotionSync.Running:
+		output += fmt.Sprintf("Notion: Syncing %d path(s)%s\n", len(status.NotionSync.Paths), pausedNote(status.NotionSync.Paused))
+	default:
+		output += "Notion: Not syncing\n"
+	}
+	return output, nil
+}
+
+// remoteResult runs an operation on the --host daemon and prints its answer
+func remoteResult(run func(ctx context.Context, client *api.Client) (*api.Result, error)) error {
+	result, err := run(context.Background(), api.NewClient(""))
+	if err != nil {
+		return err
+	}
+	fmt.Println(result.Message)
+	return nil
+}
@@ -0,0 +1,563 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	systemhealth "github.com/ln64-git/daemira/src/features/system-health"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createSecurityCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "security",
+		Short:        "Firewall status and management, failed logins, blocked addresses and SSH keys",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printSecurityStatus()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "status",
+		Short:        "Show the firewall, the failed logins within security.failed_login_window and the SSH keys and agent",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printSecurityStatus()
+		},
+	})
+
+	var since string
+	logins := &cobra.Command{
+		Use:          "logins",
+		Short:        "Show failed SSH logins and sudo passwords by source",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := parseSince(since)
+			if err != nil {
+				return err
+			}
+			return c.printFailedLogins(from)
+		},
+	}
+	logins.Flags().StringVar(&since, "since", "24h", "Only failed logins since a duration ago (e.g. 24h) or a time (2006-01-02 [15:04])")
+	cmd.AddCommand(logins)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "blocked",
+		Short:        "List the addresses dropped after repeated failed logins",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+				return fmt.Errorf("listing blocked addresses needs root: %w", err)
+			}
+			blocked, err := systemhealth.GetSecurityMonitor().Blocked(ctx)
+			if err != nil {
+				return err
+			}
+			if len(blocked) == 0 {
+				fmt.Println("No addresses blocked")
+				return nil
+			}
+			fmt.Printf("%-40s %s\n", "ADDRESS", "EXPIRES IN")
+			for _, address := range blocked {
+				fmt.Printf("%-40s %s\n", address.Address, formatAge(address.Expires))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "block <address> [duration]",
+		Short: "Drop an address with nftables for a while (security.block_duration by default)",
+		Args:  cobra.RangeArgs(1, 2),
+		Example: "  daemira security block 203.0.113.7\n" +
+			"  daemira security block 2001:db8::7 168h",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			duration := c.daemon.GetConfig().SecurityBlockDuration
+			if len(args) == 2 {
+				parsed, err := time.ParseDuration(args[1])
+				if err != nil || parsed <= 0 {
+					return fmt.Errorf("invalid duration %q (e.g. 30m or 24h)", args[1])
+				}
+				duration = parsed
+			}
+			if duration <= 0 {
+				duration = systemhealth.DefaultBlockDuration
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+				return fmt.Errorf("blocking needs root: %w", err)
+			}
+			if err := systemhealth.GetSecurityMonitor().Block(ctx, args[0], duration); err != nil {
+				return err
+			}
+			fmt.Printf("Blocked %s for %s\n", args[0], formatAge(duration))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "unblock <address>",
+		Short:             "Stop dropping a blocked address",
+		Args:              cobra.ExactArgs(1),
+		SilenceUsage:      true,
+		ValidArgsFunction: completeFirst(blockedAddresses),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+				return fmt.Errorf("unblocking needs root: %w", err)
+			}
+			if err := systemhealth.GetSecurityMonitor().Unblock(ctx, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Unblocked %s\n", args[0])
+			return nil
+		},
+	})
+
+	firewall := &cobra.Command{
+		Use:          "firewall",
+		Short:        "Firewall status and management",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printFirewallStatus()
+		},
+	}
+	firewall.AddCommand(&cobra.Command{
+		Use:          "status",
+		Short:        "Show the installed firewalls and the active one",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printFirewallStatus()
+		},
+	})
+	firewall.AddCommand(&cobra.Command{
+		Use:   "enable",
+		Short: "Enable the installed firewall with a default ruleset",
+		Long: "Enable firewalld, ufw or nftables, the first one installed, unless a firewall is active.\n" +
+			"Incoming connections are dropped except replies, ping and DHCPv6, and SSH while an\n" +
+			"SSH server runs; outgoing connections are allowed. firewalld uses its public zone;\n" +
+			"for nftables /etc/nftables.conf is replaced, keeping the old file next to it.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			sm := systemhealth.GetSecurityMonitor()
+			status, err := sm.GetFirewallStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if status.Active != "" {
+				fmt.Printf("Firewall already enabled: %s\n", status.Summary())
+				return nil
+			}
+			if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+				return fmt.Errorf("enabling the firewall needs root: %w", err)
+			}
+
+			status, log, err := sm.EnableFirewall(ctx)
+			if err != nil {
+				if log != "" {
+					err = fmt.Errorf("%w\nFull output: %s", err, log)
+				}
+				return err
+			}
+			fmt.Printf("Firewall enabled: %s\n", status.Summary())
+			return nil
+		},
+	})
+	cmd.AddCommand(firewall)
+	cmd.AddCommand(c.createIntegrityCmd())
+
+	var fix, all bool
+	scanHome := &cobra.Command{
+		Use:          "scan-home [dir]",
+		Short:        "Find files in the home directory with the wrong owner, writable by anyone, or dangling symlinks",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := ""
+			if len(args) > 0 {
+				root = args[0]
+			}
+			return scanHomeDir(root, fix, all)
+		},
+	}
+	scanHome.Flags().BoolVar(&fix, "fix", false, "Give the files back to the home directory's owner and remove write access for others")
+	scanHome.Flags().BoolVarP(&all, "all", "a", false, "List every file found instead of the first 20 of each kind")
+	cmd.AddCommand(scanHome)
+
+	return cmd
+}
+
+// homeScanShown is how many files of each kind scan-home lists without --all
+const homeScanShown = 20
+
+// scanHomeDir prints what a scan of the home directory (or root) found and
+// with fix puts owners and modes back
+func scanHomeDir(root string, fix, all bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	scan, err := systemhealth.ScanHome(ctx, root)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scanned %d files in %s (%s)\n", scan.Scanned, scan.Root, formatDuration(scan.Duration))
+
+	kinds := []struct{ kind, title string }{
+		{systemhealth.HomeWrongOwner, "Not owned by " + scan.Owner()},
+		{systemhealth.HomeWorldWritable, "Writable by anyone"},
+		{systemhealth.HomeDanglingLink, "Dangling symlinks"},
+	}
+	for _, kind := range kinds {
+		count := scan.Count(kind.kind)
+		if count == 0 {
+			continue
+		}
+		fmt.Printf("\n%s (%d):\n", kind.title, count)
+		shown := 0
+		for _, finding := range scan.Findings {
+			if finding.Kind != kind.kind {
+				continue
+			}
+			if !all && shown == homeScanShown {
+				fmt.Printf("  ... and %d more (--all lists them)\n", count-shown)
+				break
+			}
+			fmt.Printf("  %s  %s\n", finding.Path, finding.Describe())
+			shown++
+		}
+	}
+	if len(scan.Unreadable) > 0 {
+		fmt.Printf("\nCouldn't read %d directories, e.g. %s\n", len(scan.Unreadable), scan.Unreadable[0])
+	}
+	if len(scan.Findings) == 0 {
+		fmt.Println("\nNo problems found")
+		return nil
+	}
+
+	fixable := scan.Count(systemhealth.HomeWrongOwner) + scan.Count(systemhealth.HomeWorldWritable)
+	if !fix {
+		if fixable > 0 {
+			fmt.Println("\nRun with --fix to give the files back and remove write access for others")
+		}
+		return nil
+	}
+	if fixable == 0 {
+		fmt.Println("\nNothing to fix; remove the dangling symlinks you no longer need yourself")
+		return nil
+	}
+	if scan.Count(systemhealth.HomeWrongOwner) > 0 {
+		if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+			return fmt.Errorf("giving files back needs root: %w", err)
+		}
+	}
+	fixed, err := systemhealth.FixHome(ctx, scan)
+	fmt.Printf("\nFixed %d of %d files\n", fixed, fixable)
+	if err != nil {
+		return err
+	}
+	if scan.Count(systemhealth.HomeDanglingLink) > 0 {
+		fmt.Println("Dangling symlinks were left alone; remove those you no longer need yourself")
+	}
+	return nil
+}
+
+// createIntegrityCmd creates the commands reviewing changes to the watched
+// config files
+func (c *CLI) createIntegrityCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "integrity",
+		Short:        "Changes to watched config files made outside daemira",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printIntegrityStatus()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "status",
+		Short:        "Show the watched paths and the changes the daemon's last check found",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.printIntegrityStatus()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "diff [path...]",
+		Short:             "Show how changed files differ from their recorded content",
+		SilenceUsage:      true,
+		ValidArgsFunction: completeAll(changedIntegrityPaths),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths := args
+			if len(paths) == 0 {
+				paths = changedIntegrityPaths()
+			}
+			if len(paths) == 0 {
+				fmt.Println("No changed files")
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			im := systemhealth.GetIntegrityMonitor()
+			for _, path := range paths {
+				diff, err := im.Diff(ctx, path)
+				if errors.Is(err, utility.ErrNeedsPassword) {
+					if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+						return fmt.Errorf("reading %s needs root: %w", path, err)
+					}
+					diff, err = im.Diff(ctx, path)
+				}
+				if err != nil {
+					return err
+				}
+				if diff == "" {
+					diff = fmt.Sprintf("%s: content unchanged\n", path)
+				}
+				fmt.Print(diff)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "accept [path...]",
+		Short:             "Record the current state of changed files (all of them without a path)",
+		SilenceUsage:      true,
+		ValidArgsFunction: completeAll(changedIntegrityPaths),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			result, err := api.NewClient("").AcceptIntegrity(ctx, args)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.Message)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// printIntegrityStatus prints the watched paths and the changes found by
+// the daemon's last check
+func (c *CLI) printIntegrityStatus() error {
+	status := systemhealth.GetIntegrityMonitor().Status()
+	fmt.Println("Watched:")
+	for _, path := range c.daemon.GetConfig().GetSecurityIntegrityPaths() {
+		fmt.Printf("  %s\n", path)
+	}
+	if status.Checked.IsZero() {
+		fmt.Println("\nNot checked yet; the daemon checks every 15 minutes")
+		return nil
+	}
+	fmt.Printf("\n%d files recorded, checked %s ago\n", status.Files, formatAge(time.Since(status.Checked)))
+	for _, path := range status.Unreadable {
+		fmt.Printf("Not checked: %s needs root and sudo asks for a password\n", path)
+	}
+
+	if len(status.Changes) == 0 {
+		fmt.Println("No changes outside daemira")
+		return nil
+	}
+	fmt.Printf("\nChanged outside daemira:\n")
+	for _, change := range status.Changes {
+		line := fmt.Sprintf("  %-9s %s", change.Kind, change.Path)
+		if change.Detail != "" && change.Detail != "content" {
+			line += " (" + change.Detail + ")"
+		}
+		fmt.Printf("%s, %s ago\n", line, formatAge(time.Since(change.Detected)))
+	}
+	fmt.Println("\nReview with 'daemira security integrity diff', then 'daemira security integrity accept'")
+	return nil
+}
+
+// changedIntegrityPaths lists the files the daemon's last check found changed
+func changedIntegrityPaths() []string {
+	var paths []string
+	for _, change := range systemhealth.GetIntegrityMonitor().Status().Changes {
+		paths = append(paths, change.Path)
+	}
+	return paths
+}
+
+// printSecurityStatus prints the firewall, the failed logins within the
+// configured window and the SSH keys
+func (c *CLI) printSecurityStatus() error {
+	if err := printFirewallStatus(); err != nil {
+		return err
+	}
+	fmt.Println()
+	window := c.daemon.GetConfig().SecurityFailedLoginWindow
+	if window <= 0 {
+		window = systemhealth.DefaultFailedLoginWindow
+	}
+	if err := c.printFailedLogins(time.Now().Add(-window)); err != nil {
+		return err
+	}
+	fmt.Println()
+	return c.printSSHStatus()
+}
+
+// printSSHStatus prints the keys in ~/.ssh, the agent and the certificates,
+// marking what needs attention
+func (c *CLI) printSSHStatus() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	monitor := systemhealth.GetSSHMonitor()
+	monitor.SetOptions(c.daemon.SSHOptions())
+	options := monitor.Options()
+	status, err := monitor.Inspect(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("SSH keys in %s:\n", status.Dir)
+	if len(status.Keys) == 0 {
+		fmt.Println("  None")
+	} else {
+		fmt.Printf("  %-20s %-12s %-10s %-10s %-6s %s\n", "KEY", "TYPE", "PASSPHRASE", "AGE", "AGENT", "FINGERPRINT")
+		for _, key := range status.Keys {
+			keyType := key.Type
+			if key.Bits > 0 {
+				keyType = fmt.Sprintf("%s %d", key.Type, key.Bits)
+			}
+			passphrase := "yes"
+			if !key.Encrypted {
+				passphrase = "NONE"
+			}
+			age := time.Since(key.Modified)
+			marker := " "
+			if !key.Encrypted || key.Weak() != "" || (options.MaxKeyAge > 0 && age > options.MaxKeyAge) {
+				marker = "!"
+			}
+			fmt.Printf("%s %-20s %-12s %-10s %-10s %-6s %s\n", marker, topTruncate(key.Name(), 20), keyType, passphrase,
+				formatAge(age), boolToYesNo(key.InAgent), key.Fingerprint)
+			if weak := key.Weak(); weak != "" {
+				fmt.Printf("    %s\n", weak)
+			}
+		}
+	}
+	if unencrypted := status.Unencrypted(); len(unencrypted) > 0 {
+		fmt.Printf("  %d key(s) without a passphrase; add one with: ssh-keygen -p -f <key>\n", len(unencrypted))
+	}
+	for _, problem := range status.Permissions {
+		fmt.Printf("  ! %s\n", problem)
+	}
+
+	switch {
+	case status.Agent.Socket == "":
+		fmt.Println("Agent: none found (SSH_AUTH_SOCK is unset)")
+	case !status.Agent.Running:
+		fmt.Printf("Agent: not answering on %s\n", status.Agent.Socket)
+	default:
+		fmt.Printf("Agent: %d identities loaded (%s)\n", len(status.Agent.Identities), status.Agent.Socket)
+	}
+	if len(status.Agent.Missing) > 0 {
+		fmt.Printf("  ! Not loaded: %s (ssh-add)\n", strings.Join(status.Agent.Missing, ", "))
+	}
+
+	for _, cert := range status.Certificates {
+		validity := "valid forever"
+		switch {
+		case cert.ValidBefore.IsZero():
+		case time.Now().After(cert.ValidBefore):
+			validity = fmt.Sprintf("! expired %s ago", formatAge(time.Since(cert.ValidBefore)))
+		case time.Until(cert.ValidBefore) < options.CertWarn:
+			validity = fmt.Sprintf("! expires in %s", formatAge(time.Until(cert.ValidBefore)))
+		default:
+			validity = "valid until " + cert.ValidBefore.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("Certificate %s (%s): %s\n", filepath.Base(cert.Path), cert.KeyID, validity)
+	}
+	return nil
+}
+
+// printFailedLogins prints the failed logins since a time by source,
+// marking those over the threshold
+func (c *CLI) printFailedLogins(since time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	logins, err := systemhealth.GetSecurityMonitor().ScanFailedLogins(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	cfg := c.daemon.GetConfig()
+	fmt.Printf("Failed logins since %s:\n", since.Format("2006-01-02 15:04"))
+	if len(logins) == 0 {
+		fmt.Println("  None")
+		return nil
+	}
+	fmt.Printf("  %-40s %-5s %8s %-9s %s\n", "SOURCE", "VIA", "ATTEMPTS", "LAST", "USERS")
+	for _, login := range logins {
+		marker := " "
+		if cfg.SecurityFailedLoginThreshold > 0 && login.Attempts >= cfg.SecurityFailedLoginThreshold {
+			marker = "!"
+		}
+		fmt.Printf("%s %-40s %-5s %8d %-9s %s\n", marker, login.Source, login.Service, login.Attempts,
+			formatAge(time.Since(login.Last))+" ago", topTruncate(strings.Join(login.Users, ", "), 40))
+	}
+	if cfg.SecurityFailedLoginThreshold > 0 {
+		fmt.Printf("\n! %d or more attempts within %v raise an alert", cfg.SecurityFailedLoginThreshold, cfg.SecurityFailedLoginWindow)
+		if cfg.SecurityBlock {
+			fmt.Print(" and block the address")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// blockedAddresses lists the blocked addresses, when sudo needs no password
+func blockedAddresses() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	blocked, _ := systemhealth.GetSecurityMonitor().Blocked(ctx)
+	addresses := make([]string, 0, len(blocked))
+	for _, address := range blocked {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
+
+// printFirewallStatus prints the installed firewalls and the active one
+func printFirewallStatus() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	status, err := systemhealth.GetSecurityMonitor().GetFirewallStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Firewall: %s\n", status.Summary())
+	if status.Active == "" {
+		fmt.Println("  Incoming connections aren't filtered")
+		if len(status.Installed) == 0 {
+			fmt.Println("  Install ufw, firewalld or nftables, then run: daemira security firewall enable")
+		} else {
+			fmt.Println("  Enable it with: daemira security firewall enable")
+		}
+	} else if len(status.Installed) > 1 {
+		fmt.Printf("  Installed: %s\n", strings.Join(status.Installed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/features/snapshots"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createSnapshotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "snapshots",
+		Short:        "Btrfs snapshots of the home subvolume",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Print(c.snapshotsStatus())
+			return nil
+		},
+	}
+
+	var watch watchOptions
+	statusCmd := &cobra.Command{
+		Use:          "status",
+		Short:        "Show the last snapshot and when the next one is taken",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return watch.show(cmd, func() (string, error) {
+				return c.snapshotsStatus(), nil
+			})
+		},
+	}
+	addWatchFlags(statusCmd, &watch)
+	cmd.AddCommand(statusCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List the snapshots of the home subvolume",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hs, err := c.daemon.NewHomeSnapshots(context.Background())
+			if err != nil {
+				return err
+			}
+			list, err := hs.List(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Printf("No snapshots of %s yet. Take one with: daemira snapshots create\n", hs.Subvolume())
+				return nil
+			}
+			fmt.Printf("%-32s %-17s %-10s %s\n", "SNAPSHOT", "TIME", "KIND", "DESCRIPTION")
+			for _, snapshot := range list {
+				kind := snapshot.Kind
+				if kind == "" {
+					kind = "-"
+				}
+				fmt.Printf("%-32s %-17s %-10s %s\n", snapshot.ID, snapshot.Time.Local().Format("2006-01-02 15:04"), kind, snapshot.Description)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "create",
+		Short:        "Take a snapshot now, which pruning leaves alone",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hs, err := c.daemon.NewHomeSnapshots(context.Background())
+			if err != nil {
+				return err
+			}
+			snapshot, err := hs.Create(context.Background())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Took snapshot %s of %s\n", snapshot.ID, hs.Subvolume())
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rollback <snapshot> [path]",
+		Short: "Return the home subvolume, or a path in it, to a snapshot",
+		Long: "Return the home subvolume, or a file or directory in it, to how it was in a snapshot.\n" +
+			"Files changed or added since are replaced or removed. A snapshot of the current\n" +
+			"state is taken first, so the rollback can itself be rolled back.",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hs, err := c.daemon.NewHomeSnapshots(context.Background())
+			if err != nil {
+				return err
+			}
+			var path string
+			if len(args) == 2 {
+				path = args[1]
+			}
+			target := path
+			if target == "" {
+				target = hs.Subvolume()
+			}
+			fmt.Printf("Rolling back %s to snapshot %s...\n", target, args[0])
+			undo, log, err := hs.Rollback(context.Background(), args[0], path)
+			if err != nil {
+				if log != "" {
+					err = fmt.Errorf("%w\nFull output: %s", err, log)
+				}
+				if undo.ID != "" {
+					err = fmt.Errorf("%w\nThe state before the rollback is snapshot %s", err, undo.ID)
+				}
+				return err
+			}
+			fmt.Printf("Rolled back %s to snapshot %s\n", target, args[0])
+			fmt.Printf("Undo with: daemira snapshots rollback %s", undo.ID)
+			if path != "" {
+				fmt.Printf(" %s", path)
+			}
+			fmt.Println()
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// snapshotsStatus describes the last snapshot the daemon saved, and its
+// next one when it is running
+func (c *CLI) snapshotsStatus() string {
+	cfg := c.daemon.GetConfig()
+	if !cfg.SnapshotsEnabled {
+		return "Home snapshots: Disabled (set snapshots.enabled = true)\n"
+	}
+
+	status := snapshots.LoadStatus()
+	output := "=== Home Snapshots ===\n\n"
+	if status.Backend != "" {
+		output += fmt.Sprintf("Backend: %s\n", status.Backend)
+		output += fmt.Sprintf("Subvolume: %s\n", status.Subvolume)
+	} else {
+		output += fmt.Sprintf("Backend: %s\n", cfg.SnapshotsBackend)
+	}
+	output += fmt.Sprintf("Retention: %s\n\n", snapshots.Retention{
+		Hourly: cfg.SnapshotsKeepHourly,
+		Daily:  cfg.SnapshotsKeepDaily,
+		Weekly: cfg.SnapshotsKeepWeekly,
+	})
+
+	if status.LastRun.IsZero() {
+		output += "Last snapshot: Never\n"
+	} else if status.LastError != "" {
+		output += fmt.Sprintf("Last snapshot: %s ago, failed\n  %s\n", formatAge(time.Since(status.LastRun)), status.LastError)
+		if !status.LastSuccess.IsZero() {
+			output += fmt.Sprintf("  Last successful snapshot: %s ago\n", formatAge(time.Since(status.LastSuccess)))
+		}
+	} else {
+		output += fmt.Sprintf("Last snapshot: %s ago, %s", formatAge(time.Since(status.LastRun)), status.LastSnapshot)
+		if status.Pruned > 0 {
+			output += fmt.Sprintf(" (%d old snapshots pruned)", status.Pruned)
+		}
+		output += "\n"
+	}
+
+	// The next snapshot is the daemon's to know
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if jobs, err := api.NewClient("").Jobs(ctx); err == nil {
+		for _, job := range jobs {
+			if job.ID != "snapshot" {
+				continue
+			}
+			switch {
+			case job.Running:
+				output += "Next snapshot: taking one now\n"
+			case !job.NextRun.IsZero():
+				output += fmt.Sprintf("Next snapshot: in %s\n", formatAge(time.Until(job.NextRun)))
+			}
+		}
+	} else {
+		output += "Daemon not running; no snapshots are scheduled\n"
+	}
+
+	return output
+}
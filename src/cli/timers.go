@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+// defaultTimerJobs are the jobs generate-timers writes units for unless told which
+var defaultTimerJobs = []string{"gdrive-sync", "system-update", "health-check"}
+
+// timerJob is a job as generate-timers writes it
+type timerJob struct {
+	description string
+	schedule    utility.Schedule
+}
+
+func (c *CLI) createGenerateTimersCmd() *cobra.Command {
+	var install bool
+	var binary string
+	cmd := &cobra.Command{
+		Use:   "generate-timers [job...]",
+		Short: "Write systemd timers running the Google Drive sync, system update and health check jobs",
+		Long: `Write a systemd user service and timer per job, for running them on
+systemd's schedule instead of the daemon's. Each service runs the job in
+the daemon with ` + "`daemira jobs run <id>`" + `, on the job's schedule (or its
+jobs.schedules override). Without jobs, writes gdrive-sync, system-update
+and health-check.
+
+Once a timer is enabled, the daemon leaves its job to systemd after the
+next config reload (unless jobs.systemd_timers is off).`,
+		SilenceUsage:      true,
+		ValidArgsFunction: completeAll(jobIDs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = defaultTimerJobs
+			}
+			if binary == "" {
+				self, err := os.Executable()
+				if err != nil {
+					return fmt.Errorf("failed to locate the daemira binary: %w", err)
+				}
+				if binary, err = filepath.EvalSymlinks(self); err != nil {
+					return fmt.Errorf("failed to locate the daemira binary: %w", err)
+				}
+			}
+			return c.generateTimers(args, binary, install)
+		},
+	}
+	cmd.Flags().BoolVar(&install, "install", false, "Write the units to ~/.config/systemd/user instead of printing them")
+	cmd.Flags().StringVar(&binary, "binary", "", "daemira binary the services run (default: this one)")
+	return cmd
+}
+
+// generateTimers prints or installs the units of the jobs
+func (c *CLI) generateTimers(ids []string, binary string, install bool) error {
+	jobs, err := c.timerJobs(ids)
+	if err != nil {
+		return err
+	}
+
+	dir := utility.UserUnitDir()
+	if install {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	timers := make([]string, 0, len(ids))
+	for _, id := range ids {
+		service, timer, err := utility.TimerUnits(binary, id, jobs[id].description, jobs[id].schedule)
+		if err != nil {
+			return err
+		}
+		units := []struct{ name, content string }{
+			{utility.TimerServiceName(id), service},
+			{utility.TimerUnitName(id), timer},
+		}
+		for _, unit := range units {
+			if !install {
+				fmt.Printf("# %s\n%s\n", unit.name, unit.content)
+				continue
+			}
+			path := filepath.Join(dir, unit.name)
+			if err := os.WriteFile(path, []byte(unit.content), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			fmt.Printf("Wrote %s\n", path)
+		}
+		timers = append(timers, utility.TimerUnitName(id))
+	}
+	if !install {
+		return nil
+	}
+
+	fmt.Println("\nEnable the timers, then reload the daemon so it leaves these jobs to them:")
+	fmt.Println("  systemctl --user daemon-reload")
+	fmt.Printf("  systemctl --user enable --now %s\n", strings.Join(timers, " "))
+	fmt.Println("  systemctl --user reload daemira")
+	if !c.daemon.GetConfig().JobsSystemdTimers {
+		fmt.Println("\njobs.systemd_timers is off, so the daemon keeps running them too; turn it on with:")
+		fmt.Println("  daemira config set jobs.systemd_timers true")
+	}
+	return nil
+}
+
+// timerJobs looks up the description and schedule of each job: the
+// jobs.schedules override, the default of the jobs generate-timers knows, or
+// the running daemon's
+func (c *CLI) timerJobs(ids []string) (map[string]timerJob, error) {
+	cfg := c.daemon.GetConfig()
+	jobs := map[string]timerJob{
+		"gdrive-sync":   {"Sync every Google Drive directory", utility.Every(utility.PeriodicSyncDelayMS * time.Millisecond)},
+		"system-update": {"Update the system", utility.Every(c.daemon.SystemUpdateInterval())},
+		"health-check":  {"Check free disk space", utility.Every(cfg.MonitorInterval)},
+	}
+
+	var running []api.Job
+	for _, id := range ids {
+		if _, ok := jobs[id]; ok {
+			continue
+		}
+		if running == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			var err error
+			running, err = api.NewClient("").Jobs(ctx)
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("unknown job %s; start the daemon to look it up: %w", id, err)
+			}
+		}
+		for _, job := range running {
+			if job.ID != id {
+				continue
+			}
+			// Daemon schedules read e.g. "every 6h" or "0 4 * * *"
+			schedule, err := utility.ParseSchedule(strings.TrimPrefix(job.Schedule, "every "))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id, err)
+			}
+			jobs[id] = timerJob{job.Description, schedule}
+		}
+		if _, ok := jobs[id]; !ok {
+			return nil, fmt.Errorf("unknown job %q (see `daemira jobs list`)", id)
+		}
+	}
+
+	schedules, err := cfg.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	for id, schedule := range schedules {
+		if job, ok := jobs[id]; ok {
+			job.schedule = schedule
+			jobs[id] = job
+		}
+	}
+	return jobs, nil
+}
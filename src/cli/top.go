@@ -0,0 +1,371 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+// ANSI sequences used by `daemira top`
+const (
+	topAltScreenOn  = "\033[?1049h"
+	topAltScreenOff = "\033[?1049l"
+	topHideCursor   = "\033[?25l"
+	topShowCursor   = "\033[?25h"
+	topHome         = "\033[H"
+	topClearLine    = "\033[K"
+	topClearBelow   = "\033[J"
+	topReset        = "\033[0m"
+	topBold         = "\033[1m"
+	topDim          = "\033[2m"
+	topRed          = "\033[31m"
+	topGreen        = "\033[32m"
+	topYellow       = "\033[33m"
+)
+
+// topSnapshot is what `daemira top` shows, as fetched from the daemon
+type topSnapshot struct {
+	status  *api.Status
+	health  *api.HealthStatus
+	err     error
+	fetched time.Time
+}
+
+func (c *CLI) createTopCmd() *cobra.Command {
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:          "top",
+		Short:        "Live dashboard of sync, health and update state of the running daemon",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !utility.IsTerminal(os.Stdin) || !utility.IsTerminal(os.Stdout) {
+				return fmt.Errorf("daemira top needs a terminal; use `daemira status` instead")
+			}
+			if interval < 500*time.Millisecond {
+				interval = 500 * time.Millisecond
+			}
+
+			client := api.NewClient("")
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := client.Status(ctx); err != nil {
+				return fmt.Errorf("%w\nStart it with: daemira daemon start", err)
+			}
+			return runTop(client, interval)
+		},
+	}
+	cmd.Flags().DurationVarP(&interval, "interval", "i", 2*time.Second, "Time between refreshes")
+	allowRemote(cmd)
+
+	return cmd
+}
+
+// runTop shows the dashboard until q is pressed
+func runTop(client *api.Client, interval time.Duration) error {
+	state, err := utility.MakeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, topAltScreenOn+topHideCursor)
+	defer func() {
+		fmt.Fprint(os.Stdout, topShowCursor+topAltScreenOff)
+		utility.RestoreTerminal(os.Stdin, state)
+	}()
+
+	keys := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	// Fetching runs beside the key loop, so a slow health check doesn't
+	// hold up quitting
+	snapshots := make(chan topSnapshot, 1)
+	refresh := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	utility.Go("top-fetch", func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case snapshots <- fetchTopSnapshot(client, interval):
+			case <-stop:
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-refresh:
+			case <-stop:
+				return
+			}
+		}
+	})
+
+	var snapshot topSnapshot
+	message := ""
+	messages := make(chan string, 4)
+	// act runs an operation in the background and shows its answer
+	act := func(name string, operation func(ctx context.Context) (*api.Result, error)) {
+		message = name + "..."
+		utility.Go("top-action", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			result, err := operation(ctx)
+			if err != nil {
+				messages <- topRed + err.Error() + topReset
+			} else {
+				messages <- result.Message
+			}
+			select {
+			case refresh <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	renderTop(snapshot, message)
+	for {
+		select {
+		case snapshot = <-snapshots:
+		case message = <-messages:
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch key {
+			case "q", "\x1b", "\x03":
+				return nil
+			case "r":
+				select {
+				case refresh <- struct{}{}:
+				default:
+				}
+			case "s":
+				act("Queueing Google Drive sync", func(ctx context.Context) (*api.Result, error) {
+					return client.SyncGDrive(ctx, "")
+				})
+			case "u":
+				act("Starting system update", func(ctx context.Context) (*api.Result, error) {
+					return client.RunSystemUpdate(ctx, false)
+				})
+			case "n":
+				act("Syncing Notion", client.SyncNotion)
+			}
+		}
+		renderTop(snapshot, message)
+	}
+}
+
+// fetchTopSnapshot asks the daemon for its state and health
+func fetchTopSnapshot(client *api.Client, interval time.Duration) topSnapshot {
+	ctx, cancel := context.WithTimeout(context.Background(), max(interval, 5*time.Second))
+	defer cancel()
+
+	snapshot := topSnapshot{fetched: time.Now()}
+	snapshot.status, snapshot.err = client.Status(ctx)
+	if snapshot.err == nil {
+		snapshot.health, snapshot.err = client.Health(ctx)
+	}
+	return snapshot
+}
+
+// renderTop redraws the dashboard
+func renderTop(snapshot topSnapshot, message string) {
+	width, height := utility.TerminalSize(os.Stdout)
+	var lines []string
+	section := func(title string) {
+		lines = append(lines, "", topBold+title+topReset)
+	}
+
+	title := " Daemira"
+	if status := snapshot.status; status != nil {
+		title += fmt.Sprintf(" · pid %d · up %s", status.PID, formatAge(time.Since(status.Started)))
+	}
+	if !snapshot.fetched.IsZero() {
+		title += " · " + snapshot.fetched.Format("15:04:05")
+	}
+	lines = append(lines, topBold+topTruncate(title, width)+topReset, strings.Repeat("─", width))
+
+	switch {
+	case snapshot.status == nil && snapshot.err == nil:
+		lines = append(lines, " Loading...")
+	case snapshot.err != nil:
+		lines = append(lines, topRed+topTruncate(" "+snapshot.err.Error(), width)+topReset)
+	}
+
+	if status := snapshot.status; status != nil {
+		gd := status.GDrive
+		section(" Google Drive")
+		switch {
+		case !gd.Enabled:
+			lines = append(lines, topDim+"   Disabled"+topReset)
+		case !gd.Running:
+			lines = append(lines, topYellow+"   Stopped"+topReset)
+		default:
+			lines = append(lines, fmt.Sprintf("   Running · %d queued · every %s", gd.QueueSize, gd.SyncInterval))
+		}
+		for _, directory := range gd.Directories {
+			icon, color := "✓", topGreen
+			switch directory.Status {
+			case "syncing":
+				icon, color = "↻", topYellow
+			case "error":
+				icon, color = "✗", topRed
+			}
+			last := "never synced"
+			if !directory.LastSync.IsZero() {
+				last = formatAge(time.Since(directory.LastSync)) + " ago"
+			}
+			line := fmt.Sprintf("   %s%s%s %-24s %s", color, icon, topReset, shortenHome(directory.Path), last)
+			if directory.Error != "" {
+				line += topRed + " · " + directory.Error + topReset
+			}
+			lines = append(lines, topTruncate(line, width))
+		}
+
+		su := status.SystemUpdate
+		section(" System Update")
+		switch {
+		case !su.Enabled:
+			lines = append(lines, topDim+"   Disabled"+topReset)
+		case su.LastUpdate.IsZero():
+			lines = append(lines, "   Never run")
+		default:
+			line := fmt.Sprintf("   Last %s ago", formatAge(time.Since(su.LastUpdate)))
+			if len(su.History) > 0 {
+				last := su.History[len(su.History)-1]
+				if last.Success {
+					line += topGreen + " ✓" + topReset + fmt.Sprintf(" (%s)", formatDuration(last.Duration))
+				} else {
+					line += topRed + " ✗ " + last.Error + topReset
+				}
+			}
+			if !su.NextUpdate.IsZero() {
+				line += fmt.Sprintf(" · next in %s", formatAge(time.Until(su.NextUpdate)))
+			}
+			lines = append(lines, topTruncate(line, width))
+		}
+
+		ns := status.NotionSync
+		section(" Notion")
+		switch {
+		case !ns.Enabled:
+			lines = append(lines, topDim+"   Disabled"+topReset)
+		case !ns.Running:
+			lines = append(lines, fmt.Sprintf("   Not syncing · %d writes queued", ns.Queued))
+		default:
+			lines = append(lines, fmt.Sprintf("   Syncing %d paths · %d writes queued", len(ns.Paths), ns.Queued))
+		}
+	}
+
+	if health := snapshot.health; health != nil {
+		section(" Health")
+		cpu := fmt.Sprintf("   CPU %.0f%%", health.CPUUtilization)
+		if health.PowerProfile != "" {
+			cpu += " (" + health.PowerProfile + ")"
+		}
+		memory := fmt.Sprintf(" · Memory %.1f / %.1f GB", health.MemoryUsedGB, health.MemoryTotalGB)
+		if health.SwapUsedGB > 0 {
+			memory += fmt.Sprintf(" + %.1f GB swap", health.SwapUsedGB)
+		}
+		lines = append(lines, topTruncate(cpu+memory, width))
+		if len(health.DiskWarnings) == 0 {
+			lines = append(lines, "   Disk space: all healthy")
+		}
+		for _, warning := range health.DiskWarnings {
+			color := topYellow
+			if warning.Level == "critical" {
+				color = topRed
+			}
+			lines = append(lines, topTruncate(fmt.Sprintf("   %s⚠%s %s: %.1f GB free (%.0f%% used)", color, topReset, warning.MountPoint, warning.FreeGB, warning.PercentUsed), width))
+		}
+	}
+
+	// The footer sits at the bottom, the sections are cut to fit above it
+	footer := []string{strings.Repeat("─", width), topTruncate(" s sync drive · u update · n sync notion · r refresh · q quit", width)}
+	if message != "" {
+		footer = append([]string{topTruncate(" "+message, width)}, footer...)
+	}
+	if room := height - len(footer); len(lines) > room {
+		lines = lines[:max(room, 0)]
+	}
+	for len(lines)+len(footer) < height {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+
+	var b strings.Builder
+	b.WriteString(topHome)
+	for idx, line := range lines {
+		b.WriteString(line + topClearLine)
+		if idx < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString(topClearBelow)
+	fmt.Fprint(os.Stdout, b.String())
+}
+
+// formatAge formats a duration for the dashboard, e.g. 45s, 12m or 3h20m
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return d.String()
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// shortenHome writes paths under the home directory with ~
+func shortenHome(path string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join("~", rel)
+		}
+	}
+	return path
+}
+
+// topTruncate cuts a line to the terminal width, not counting escape
+// sequences, and ends any color it cut off
+func topTruncate(s string, width int) string {
+	visible := 0
+	for idx := 0; idx < len(s); {
+		if s[idx] == '\033' {
+			end := strings.IndexAny(s[idx:], "ABCDHJKmhl")
+			if end < 0 {
+				break
+			}
+			idx += end + 1
+			continue
+		}
+		if visible == width {
+			return s[:idx] + topReset
+		}
+		_, size := utf8.DecodeRuneInString(s[idx:])
+		idx += size
+		visible++
+	}
+	return s
+}
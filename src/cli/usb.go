@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/devices"
+	"github.com/spf13/cobra"
+)
+
+func (c *CLI) createUSBCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "usb",
+		Short:        "Connected USB devices",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.listUSB()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List connected USB devices, marking ones never seen before",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.listUSB()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "seen",
+		Short:        "List every USB device the daemon has seen",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seen := devices.GetUsbMonitor().Seen()
+			if len(seen) == 0 {
+				fmt.Println("No USB devices seen yet (the daemon records them)")
+				return nil
+			}
+			fmt.Printf("%-10s %-32s %-18s %-13s %s\n", "ID", "NAME", "KINDS", "LAST SEEN", "FIRST SEEN")
+			for _, device := range seen {
+				fmt.Printf("%-10s %-32s %-18s %-13s %s\n", device.ID, topTruncate(device.Name(), 32),
+					strings.Join(device.Kinds, ","), formatAge(time.Since(device.LastSeen))+" ago", device.FirstSeen.Format("2006-01-02"))
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "drives",
+		Short:        "Show the external drives backed up to when plugged in",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.showDrives()
+		},
+	})
+
+	return cmd
+}
+
+// showDrives prints the configured external drives and their last backups
+func (c *CLI) showDrives() error {
+	options, err := c.daemon.DriveOptions()
+	if err != nil {
+		return err
+	}
+	if len(options.Drives) == 0 {
+		fmt.Println("No external drives configured (set usb.drives, e.g. \"uuid=1234-ABCD mode=backup\")")
+		return nil
+	}
+
+	drives := devices.GetDriveManager()
+	drives.SetOptions(options)
+	fmt.Printf("%-38s %-16s %-7s %-13s %s\n", "UUID", "NAME", "MODE", "LAST RUN", "RESULT")
+	var logs []string
+	for _, status := range drives.Status() {
+		lastRun, result := "never", "-"
+		switch {
+		case status.Running:
+			result = "running"
+		case status.LastRun.IsZero():
+		case status.LastError != "":
+			result = "failed: " + status.LastError
+			if status.RunLog != "" {
+				logs = append(logs, status.RunLog)
+			}
+		default:
+			result = "ok in " + formatDuration(status.LastDuration)
+			if status.LastSnapshot != "" {
+				result += " (snapshot " + status.LastSnapshot + ")"
+			}
+		}
+		if !status.LastRun.IsZero() {
+			lastRun = formatAge(time.Since(status.LastRun)) + " ago"
+		}
+		fmt.Printf("%-38s %-16s %-7s %-13s %s\n", status.UUID, topTruncate(status.Name, 16), status.Mode, lastRun, result)
+	}
+	for _, log := range logs {
+		fmt.Printf("\nSee %s\n", log)
+	}
+	return nil
+}
+
+// listUSB prints the connected USB devices
+func (c *CLI) listUSB() error {
+	connected, err := devices.ListUsbDevices()
+	if err != nil {
+		return err
+	}
+	if len(connected) == 0 {
+		fmt.Println("No USB devices connected")
+		return nil
+	}
+
+	monitor := devices.GetUsbMonitor()
+	fmt.Printf("%-10s %-8s %-32s %-18s %s\n", "ID", "PORT", "NAME", "KINDS", "SERIAL")
+	unknown := 0
+	for _, device := range connected {
+		name := device.Name()
+		if !monitor.IsKnown(device) {
+			name += " (new)"
+			unknown++
+		}
+		fmt.Printf("%-10s %-8s %-32s %-18s %s\n", device.ID, device.Port, topTruncate(name, 32), strings.Join(device.Kinds, ","), device.Serial)
+	}
+	if unknown > 0 && len(monitor.Seen()) > 0 {
+		fmt.Printf("\n%d device(s) not seen by the daemon before\n", unknown)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/api"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/cobra"
+)
+
+// watchOptions are the --watch and --interval flags of the status commands
+type watchOptions struct {
+	watch    bool
+	interval time.Duration
+}
+
+// addWatchFlags adds --watch and --interval to a status command
+func addWatchFlags(cmd *cobra.Command, opts *watchOptions) {
+	cmd.Flags().BoolVarP(&opts.watch, "watch", "w", false, "Repaint the status until Ctrl+C")
+	cmd.Flags().DurationVarP(&opts.interval, "interval", "i", 2*time.Second, "Time between repaints with --watch")
+}
+
+// show prints what render returns once, or with --watch repaints it every
+// interval until Ctrl+C
+func (o *watchOptions) show(cmd *cobra.Command, render func() (string, error)) error {
+	if !o.watch {
+		output, err := render()
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
+	}
+
+	if !utility.IsTerminal(os.Stdout) {
+		return fmt.Errorf("--watch needs a terminal")
+	}
+	interval := max(o.interval, 500*time.Millisecond)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	fmt.Fprint(os.Stdout, topAltScreenOn+topHideCursor)
+	defer fmt.Fprint(os.Stdout, topShowCursor+topAltScreenOff)
+
+	title := fmt.Sprintf("Every %v: %s", interval, cmd.CommandPath())
+	for {
+		// Rendering runs beside the signal wait, so a slow status doesn't
+		// hold up quitting
+		outputs := make(chan string, 1)
+		utility.Go("watch-render", func() {
+			output, err := render()
+			if err != nil {
+				output = topRed + err.Error() + topReset + "\n"
+			}
+			outputs <- output
+		})
+
+		select {
+		case output := <-outputs:
+			paintWatch(title, output)
+		case <-signals:
+			return nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// paintWatch redraws the screen with a title line over output, cut to the
+// terminal size
+func paintWatch(title, output string) {
+	width, height := utility.TerminalSize(os.Stdout)
+	clock := time.Now().Format("15:04:05")
+
+	var screen strings.Builder
+	screen.WriteString(topHome)
+	header := topBold + title + topReset
+	if gap := width - len(title) - len(clock); gap > 0 {
+		header += strings.Repeat(" ", gap) + topDim + clock + topReset
+	}
+	screen.WriteString(topTruncate(header, width) + topClearLine + "\n" + topClearLine + "\n")
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if room := height - 2; len(lines) > room {
+		lines = lines[:max(room, 0)]
+	}
+	for i, line := range lines {
+		screen.WriteString(topTruncate(line, width) + topClearLine)
+		if i < len(lines)-1 {
+			screen.WriteString("\n")
+		}
+	}
+	screen.WriteString(topClearBelow)
+	fmt.Fprint(os.Stdout, screen.String())
+}
+
+// daemonStatus asks the running daemon for the state of its features, or
+// returns nil when it doesn't answer
+func daemonStatus() *api.Status {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	status, err := api.NewClient("").Status(ctx)
+	if err != nil {
+		return nil
+	}
+	return status
+}
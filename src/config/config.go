@@ -2,9 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/ln64-git/daemira/src/utility"
 	"github.com/spf13/viper"
 )
 
@@ -30,83 +35,356 @@ const (
 // Config holds the application configuration
 type Config struct {
 	// Environment
-	Environment Environment `mapstructure:"NODE_ENV"`
-	Port        int         `mapstructure:"PORT"`
+	Environment Environment `mapstructure:"NODE_ENV" key:"environment" enum:"development,production,test" desc:"Runtime environment"`
+	Port        int         `mapstructure:"PORT" key:"port" desc:"Port the API is served on over the tailnet (api.tailnet); locally it uses a unix socket"`
+
+	// Remote API
+	APITailnet bool   `mapstructure:"API_TAILNET" key:"api.tailnet" desc:"Also serve the API on this machine's Tailscale address, for daemira --host from the other machines"`
+	APIKey     string `mapstructure:"API_KEY" key:"api.key" secret:"true" desc:"Key remote clients must send to the tailnet API (and --host sends), or a keyring:, pass: or cmd: reference"`
 
 	// Logging
-	LogLevel LogLevel `mapstructure:"LOG_LEVEL"`
+	LogLevel             LogLevel      `mapstructure:"LOG_LEVEL" key:"log_level" enum:"debug,info,warn,error" desc:"Minimum level of log messages"`
+	LogFormat            string        `mapstructure:"LOG_FORMAT" key:"log_format" enum:"text,json" desc:"Log line format; json writes one object per line with its fields"`
+	LogComponentLevels   []string      `mapstructure:"LOG_COMPONENT_LEVELS" key:"log_component_levels" desc:"Levels for single components overriding log_level, such as \"gdrive=debug\""`
+	SlowCommandThreshold time.Duration `mapstructure:"SLOW_COMMAND_THRESHOLD" key:"slow_command_threshold" desc:"Commands taking longer are logged with their full invocation, e.g. 10s; 0 disables"`
 
 	// Google Drive / rclone
-	RcloneRemoteName string   `mapstructure:"RCLONE_REMOTE_NAME"`
-	RcloneDirectories []string `mapstructure:"RCLONE_DIRECTORIES"`
-	RcloneExcludes    []string `mapstructure:"RCLONE_EXCLUDES"`
+	GDriveEnabled     bool     `mapstructure:"GDRIVE_ENABLED" key:"gdrive.enabled" desc:"Sync directories to Google Drive with rclone"`
+	RcloneRemoteName  string   `mapstructure:"RCLONE_REMOTE_NAME" key:"gdrive.remote" desc:"rclone remote to sync to"`
+	RcloneDirectories []string `mapstructure:"RCLONE_DIRECTORIES" key:"gdrive.directories" desc:"Directories to sync (default: Documents, Pictures, Videos, Music, .config and Source in the home directory)"`
+	RcloneExcludes    []string `mapstructure:"RCLONE_EXCLUDES" key:"gdrive.excludes" desc:"rclone filter patterns excluded from sync, added to the built-in ones"`
 
 	// Notion Integration
-	NotionToken      string   `mapstructure:"NOTION_TOKEN"`
-	NotionDatabaseID string   `mapstructure:"NOTION_DATABASE_ID"`
-	NotionPageIDs    []string `mapstructure:"NOTION_PAGE_IDS"`
+	NotionEnabled          bool          `mapstructure:"NOTION_ENABLED" key:"notion.enabled" desc:"Enable the Notion integration"`
+	NotionToken            string        `mapstructure:"NOTION_TOKEN" key:"notion.token" secret:"true" desc:"Notion integration token, or a keyring:, pass: or cmd: reference"`
+	NotionDatabaseID       string        `mapstructure:"NOTION_DATABASE_ID" key:"notion.database_id" desc:"Notion database to use"`
+	NotionPageIDs          []string      `mapstructure:"NOTION_PAGE_IDS" key:"notion.page_ids" desc:"Notion pages to use"`
+	NotionSyncPaths        []string      `mapstructure:"NOTION_SYNC_PATHS" key:"notion.sync_paths" desc:"Files and directories synced to the page at the same position in notion.page_ids"`
+	NotionSyncInterval     time.Duration `mapstructure:"NOTION_SYNC_INTERVAL" key:"notion.sync_interval" desc:"Time between Notion syncs, e.g. 15m"`
+	NotionExportDir        string        `mapstructure:"NOTION_EXPORT_DIR" key:"notion.export_dir" desc:"Directory Notion pages are exported to as Markdown unless a path is given"`
+	NotionReportDatabaseID string        `mapstructure:"NOTION_REPORT_DATABASE_ID" key:"notion.report_database_id" desc:"Notion database that gets a row after each system update and a daily health summary; empty disables"`
+	NotionVaultPath        string        `mapstructure:"NOTION_VAULT_PATH" key:"notion.vault_path" desc:"Folder of Markdown notes synced both ways with notion.vault_database_id"`
+	NotionVaultDatabaseID  string        `mapstructure:"NOTION_VAULT_DATABASE_ID" key:"notion.vault_database_id" desc:"Notion database holding a page per note of notion.vault_path"`
+	NotionAttachments      string        `mapstructure:"NOTION_ATTACHMENTS" key:"notion.attachments" desc:"Images and PDFs in synced notes: upload (to Notion), drive (link the copy in a synced Google Drive folder, else upload) or off"`
 
 	// AI Providers
-	OpenAIAPIKey string `mapstructure:"OPENAI_API_KEY"`
-	GeminiAPIKey string `mapstructure:"GEMINI_API_KEY"`
-	GrokAPIKey   string `mapstructure:"GROK_API_KEY"`
+	OpenAIAPIKey string `mapstructure:"OPENAI_API_KEY" key:"ai.openai_api_key" secret:"true" desc:"OpenAI API key, or a keyring:, pass: or cmd: reference"`
+	GeminiAPIKey string `mapstructure:"GEMINI_API_KEY" key:"ai.gemini_api_key" secret:"true" desc:"Gemini API key, or a keyring:, pass: or cmd: reference"`
+	GrokAPIKey   string `mapstructure:"GROK_API_KEY" key:"ai.grok_api_key" secret:"true" desc:"Grok API key, or a keyring:, pass: or cmd: reference"`
 
 	// System Update
-	SystemUpdateInterval string `mapstructure:"SYSTEM_UPDATE_INTERVAL"`
-	SystemUpdateAuto     bool   `mapstructure:"SYSTEM_UPDATE_AUTO"`
+	SystemUpdateEnabled       bool          `mapstructure:"SYSTEM_UPDATE_ENABLED" key:"system_update.enabled" desc:"Run scheduled system updates"`
+	SystemUpdateInterval      time.Duration `mapstructure:"SYSTEM_UPDATE_INTERVAL" key:"system_update.interval" desc:"Time between system updates, e.g. 6h"`
+	SystemUpdateAuto          bool          `mapstructure:"SYSTEM_UPDATE_AUTO" key:"system_update.auto" desc:"Install updates without asking"`
+	SystemUpdateKeyringMaxAge time.Duration `mapstructure:"SYSTEM_UPDATE_KEYRING_MAX_AGE" key:"system_update.keyring_max_age" desc:"Keyring packages (archlinux-keyring) built longer ago are reported as stale, e.g. 2160h; 0 only compares them with the sync database"`
+
+	// Backups
+	BackupEnabled       bool          `mapstructure:"BACKUP_ENABLED" key:"backup.enabled" desc:"Back up directories with restic or borg once backup.repository is set"`
+	BackupTool          string        `mapstructure:"BACKUP_TOOL" key:"backup.tool" enum:"restic,borg" desc:"Backup program"`
+	BackupRepository    string        `mapstructure:"BACKUP_REPOSITORY" key:"backup.repository" desc:"Repository to back up to: a local path (e.g. a mounted disk), or with restic an rclone remote such as rclone:gdrive:backups"`
+	BackupPassword      string        `mapstructure:"BACKUP_PASSWORD" key:"backup.password" secret:"true" desc:"Repository password, or a keyring:, pass: or cmd: reference"`
+	BackupDirectories   []string      `mapstructure:"BACKUP_DIRECTORIES" key:"backup.directories" desc:"Directories to back up (default: the Google Drive directories)"`
+	BackupExcludes      []string      `mapstructure:"BACKUP_EXCLUDES" key:"backup.excludes" desc:"Patterns left out of backups, such as \"**/node_modules\"; directories with a CACHEDIR.TAG always are"`
+	BackupInterval      time.Duration `mapstructure:"BACKUP_INTERVAL" key:"backup.interval" desc:"Time between backups, e.g. 24h"`
+	BackupCheckInterval time.Duration `mapstructure:"BACKUP_CHECK_INTERVAL" key:"backup.check_interval" desc:"Time between checks of the repository and a sample of its data, e.g. 168h"`
+	BackupKeepDaily     int           `mapstructure:"BACKUP_KEEP_DAILY" key:"backup.keep_daily" desc:"Daily snapshots kept when pruning; with all keep settings 0 nothing is pruned"`
+	BackupKeepWeekly    int           `mapstructure:"BACKUP_KEEP_WEEKLY" key:"backup.keep_weekly" desc:"Weekly snapshots kept when pruning"`
+	BackupKeepMonthly   int           `mapstructure:"BACKUP_KEEP_MONTHLY" key:"backup.keep_monthly" desc:"Monthly snapshots kept when pruning"`
+
+	// Home Snapshots
+	SnapshotsEnabled       bool          `mapstructure:"SNAPSHOTS_ENABLED" key:"snapshots.enabled" desc:"Take periodic btrfs snapshots of the home subvolume"`
+	SnapshotsBackend       string        `mapstructure:"SNAPSHOTS_BACKEND" key:"snapshots.backend" enum:"auto,snapper,btrfs" desc:"Snapshot program: snapper with snapshots.snapper_config, btrfs for raw subvolume snapshots, or auto for snapper when it has the config"`
+	SnapshotsSubvolume     string        `mapstructure:"SNAPSHOTS_SUBVOLUME" key:"snapshots.subvolume" desc:"Subvolume snapshotted with raw btrfs; snapshots go to .snapshots inside it"`
+	SnapshotsSnapperConfig string        `mapstructure:"SNAPSHOTS_SNAPPER_CONFIG" key:"snapshots.snapper_config" desc:"snapper config of the home subvolume"`
+	SnapshotsInterval      time.Duration `mapstructure:"SNAPSHOTS_INTERVAL" key:"snapshots.interval" desc:"Time between snapshots, e.g. 1h"`
+	SnapshotsKeepHourly    int           `mapstructure:"SNAPSHOTS_KEEP_HOURLY" key:"snapshots.keep_hourly" desc:"Hourly snapshots kept when pruning; with all keep settings 0 nothing is pruned"`
+	SnapshotsKeepDaily     int           `mapstructure:"SNAPSHOTS_KEEP_DAILY" key:"snapshots.keep_daily" desc:"Daily snapshots kept when pruning"`
+	SnapshotsKeepWeekly    int           `mapstructure:"SNAPSHOTS_KEEP_WEEKLY" key:"snapshots.keep_weekly" desc:"Weekly snapshots kept when pruning"`
+
+	// Fleet Reports
+	FleetEnabled  bool          `mapstructure:"FLEET_ENABLED" key:"fleet.enabled" desc:"Report this machine's status to fleet.endpoint once it is set"`
+	FleetEndpoint string        `mapstructure:"FLEET_ENDPOINT" key:"fleet.endpoint" desc:"URL the status is POSTed to, answering GET with every machine's latest report"`
+	FleetSecret   string        `mapstructure:"FLEET_SECRET" key:"fleet.secret" secret:"true" desc:"Secret shared by the machines to sign reports, or a keyring:, pass: or cmd: reference"`
+	FleetMachine  string        `mapstructure:"FLEET_MACHINE" key:"fleet.machine" desc:"Name this machine reports under (default: the hostname)"`
+	FleetInterval time.Duration `mapstructure:"FLEET_INTERVAL" key:"fleet.interval" desc:"Time between reports, e.g. 15m"`
 
 	// Health Monitoring
-	MonitorInterval string `mapstructure:"MONITOR_INTERVAL"`
+	HealthEnabled    bool          `mapstructure:"HEALTH_ENABLED" key:"health.enabled" desc:"Monitor disk space, SMART health, the firewall and failed logins while the daemon runs"`
+	MonitorInterval  time.Duration `mapstructure:"MONITOR_INTERVAL" key:"health.monitor_interval" desc:"Time between health checks, e.g. 60s"`
+	DiskWarnFree     Size          `mapstructure:"DISK_WARN_FREE" key:"health.disk_warn_free" desc:"Free space below which a disk is reported as a warning, e.g. 200G"`
+	DiskCriticalFree Size          `mapstructure:"DISK_CRITICAL_FREE" key:"health.disk_critical_free" desc:"Free space below which a disk is reported as critical, e.g. 100G"`
+	KernelParams     []string      `mapstructure:"KERNEL_PARAMS" key:"health.kernel_params" desc:"Kernel parameters expected on the command line and in the GRUB entry: name=value, name (set to anything) or !name (not set), e.g. zswap.enabled=0, mitigations=auto"`
+	BootRegression   int           `mapstructure:"BOOT_REGRESSION" key:"health.boot_regression" desc:"Percent a boot may take longer than the usual one (the median of the 5 before it) before it is reported; 0 disables"`
+
+	// Failed logins (SSH and sudo) and blocking their sources
+	SecurityFailedLoginThreshold int           `mapstructure:"SECURITY_FAILED_LOGIN_THRESHOLD" key:"security.failed_login_threshold" desc:"Failed logins from one source within the window that raise an alert; 0 disables the check"`
+	SecurityFailedLoginWindow    time.Duration `mapstructure:"SECURITY_FAILED_LOGIN_WINDOW" key:"security.failed_login_window" desc:"Time failed logins are counted over, e.g. 1h"`
+	SecurityBlock                bool          `mapstructure:"SECURITY_BLOCK" key:"security.block" desc:"Drop addresses over the threshold with nftables for security.block_duration"`
+	SecurityBlockDuration        time.Duration `mapstructure:"SECURITY_BLOCK_DURATION" key:"security.block_duration" desc:"How long an address stays blocked, e.g. 24h"`
+	SecurityAllowlist            []string      `mapstructure:"SECURITY_ALLOWLIST" key:"security.allowlist" desc:"Addresses and CIDR ranges never blocked, the tailnet and private LAN ranges by default; loopback never is"`
+
+	// Watched config files
+	SecurityIntegrityPaths []string `mapstructure:"SECURITY_INTEGRITY_PATHS" key:"security.integrity_paths" desc:"Files and directories whose checksums are recorded, alerting when something other than daemira changes them (default: /etc/sudoers.d, the daemira unit and ~/.config/hypr)"`
+
+	// SSH keys and agent
+	SecuritySSHAgentKeys []string      `mapstructure:"SECURITY_SSH_AGENT_KEYS" key:"security.ssh_agent_keys" desc:"Keys expected in the SSH agent, by file in ~/.ssh (id_ed25519) or fingerprint (SHA256:...); alerts when the agent lacks one"`
+	SecuritySSHKeyMaxAge time.Duration `mapstructure:"SECURITY_SSH_KEY_MAX_AGE" key:"security.ssh_key_max_age" desc:"SSH keys older than this are reported for rotation, e.g. 17520h (two years); 0 disables"`
+	SecuritySSHCertWarn  time.Duration `mapstructure:"SECURITY_SSH_CERT_WARN" key:"security.ssh_cert_warn" desc:"How long before an SSH certificate in ~/.ssh expires it is reported, e.g. 168h"`
+
+	// Daemon resource limits (0 disables a limit)
+	DiagnosticsMaxCPU        int  `mapstructure:"DIAGNOSTICS_MAX_CPU" key:"diagnostics.max_cpu" desc:"CPU use of the daemon itself, in percent of one core over a minute, above which it warns"`
+	DiagnosticsMaxMemory     Size `mapstructure:"DIAGNOSTICS_MAX_MEMORY" key:"diagnostics.max_memory" desc:"Resident memory of the daemon above which it warns, e.g. 512M"`
+	DiagnosticsMaxGoroutines int  `mapstructure:"DIAGNOSTICS_MAX_GOROUTINES" key:"diagnostics.max_goroutines" desc:"Goroutines of the daemon above which it warns"`
+	DiagnosticsMaxOpenFiles  int  `mapstructure:"DIAGNOSTICS_MAX_OPEN_FILES" key:"diagnostics.max_open_files" desc:"Open file descriptors of the daemon above which it warns"`
+	DiagnosticsHeapProfile   bool `mapstructure:"DIAGNOSTICS_HEAP_PROFILE" key:"diagnostics.heap_profile" desc:"Write a heap profile to the state directory when a limit is first exceeded"`
+
+	// Desktop (display profiles, window rules, idle, hooks, wallpaper, audio, Bluetooth, usage)
+	DesktopEnabled          bool     `mapstructure:"DESKTOP_ENABLED" key:"desktop.enabled" desc:"Start the desktop session features (display profiles, window rules, idle actions, hooks, wallpaper, audio, Bluetooth and usage tracking)"`
+	DesktopWindowRules      []string `mapstructure:"DESKTOP_WINDOW_RULES" key:"desktop.window_rules" desc:"Window rules such as \"class=^firefox$ workspace=2\"; class and title are regular expressions"`
+	DesktopIdleLockAfter    string   `mapstructure:"DESKTOP_IDLE_LOCK_AFTER" key:"desktop.idle.lock_after" desc:"Idle time before locking the session, e.g. 10m; empty or 0 disables"`
+	DesktopIdleDPMSAfter    string   `mapstructure:"DESKTOP_IDLE_DPMS_AFTER" key:"desktop.idle.dpms_after" desc:"Idle time before turning displays off; empty or 0 disables"`
+	DesktopIdleSuspendAfter string   `mapstructure:"DESKTOP_IDLE_SUSPEND_AFTER" key:"desktop.idle.suspend_after" desc:"Idle time before suspending; empty or 0 disables"`
+
+	// Workspace reassignment on monitor hotplug
+	DesktopHotplugReassign  bool     `mapstructure:"DESKTOP_HOTPLUG_REASSIGN" key:"desktop.hotplug_reassign" desc:"Move workspaces between outputs when monitors are plugged in or removed"`
+	DesktopWorkspaceOutputs []string `mapstructure:"DESKTOP_WORKSPACE_OUTPUTS" key:"desktop.workspace_outputs" desc:"Preferred outputs per workspace, such as \"workspace=1 outputs=DP-1,eDP-1\""`
+
+	// Session hooks (shell commands run on desktop events)
+	DesktopHookLock            string `mapstructure:"DESKTOP_HOOK_LOCK" key:"desktop.hooks.lock" shell:"true" desc:"Shell command run when the session locks"`
+	DesktopHookUnlock          string `mapstructure:"DESKTOP_HOOK_UNLOCK" key:"desktop.hooks.unlock" shell:"true" desc:"Shell command run when the session unlocks"`
+	DesktopHookIdle            string `mapstructure:"DESKTOP_HOOK_IDLE" key:"desktop.hooks.idle" shell:"true" desc:"Shell command run when the session becomes idle"`
+	DesktopHookActive          string `mapstructure:"DESKTOP_HOOK_ACTIVE" key:"desktop.hooks.active" shell:"true" desc:"Shell command run when the session becomes active again"`
+	DesktopHookMonitorAdded    string `mapstructure:"DESKTOP_HOOK_MONITOR_ADDED" key:"desktop.hooks.monitor_added" shell:"true" desc:"Shell command run when a monitor is connected (DAEMIRA_MONITOR names it)"`
+	DesktopHookMonitorRemoved  string `mapstructure:"DESKTOP_HOOK_MONITOR_REMOVED" key:"desktop.hooks.monitor_removed" shell:"true" desc:"Shell command run when a monitor is disconnected (DAEMIRA_MONITOR names it)"`
+	DesktopHookWorkspaceChange string `mapstructure:"DESKTOP_HOOK_WORKSPACE_CHANGE" key:"desktop.hooks.workspace_change" shell:"true" desc:"Shell command run when the workspace changes (DAEMIRA_WORKSPACE, DAEMIRA_PREVIOUS_WORKSPACE)"`
+
+	// Wallpaper
+	WallpaperDir        string `mapstructure:"WALLPAPER_DIR" key:"wallpaper.dir" desc:"Directory of wallpapers to rotate through"`
+	WallpaperLightDir   string `mapstructure:"WALLPAPER_LIGHT_DIR" key:"wallpaper.light_dir" desc:"Wallpapers used during the day; also switches the GTK color scheme"`
+	WallpaperDarkDir    string `mapstructure:"WALLPAPER_DARK_DIR" key:"wallpaper.dark_dir" desc:"Wallpapers used at night; also switches the GTK color scheme"`
+	WallpaperInterval   string `mapstructure:"WALLPAPER_INTERVAL" key:"wallpaper.interval" desc:"Time between wallpaper changes, e.g. 30m"`
+	WallpaperBackend    string `mapstructure:"WALLPAPER_BACKEND" key:"wallpaper.backend" enum:"auto,swww,hyprpaper,swaybg" desc:"Wallpaper tool; auto picks the running one"`
+	WallpaperLightStart string `mapstructure:"WALLPAPER_LIGHT_START" key:"wallpaper.light_start" desc:"Time of day the light set starts, e.g. 07:00"`
+	WallpaperDarkStart  string `mapstructure:"WALLPAPER_DARK_START" key:"wallpaper.dark_start" desc:"Time of day the dark set starts, e.g. 19:00"`
+
+	// Screen capture
+	ScreenshotDir string `mapstructure:"SCREENSHOT_DIR" key:"capture.screenshot_dir" desc:"Where screenshots are saved (default: ~/Pictures/Screenshots)"`
+	RecordingDir  string `mapstructure:"RECORDING_DIR" key:"capture.recording_dir" desc:"Where screen recordings are saved (default: ~/Videos/Recordings)"`
+
+	// Audio
+	AudioAutoSwitch     bool     `mapstructure:"AUDIO_AUTO_SWITCH" key:"audio.auto_switch" desc:"Switch audio output when headphones or docks connect"`
+	AudioPreferredSinks []string `mapstructure:"AUDIO_PREFERRED_SINKS" key:"audio.preferred_sinks" desc:"Sink names or description substrings, highest priority first"`
+
+	// Bluetooth
+	BluetoothFavorites []string `mapstructure:"BLUETOOTH_FAVORITES" key:"bluetooth.favorites" desc:"Bluetooth devices to reconnect at session start (names or MAC addresses)"`
+
+	// USB devices
+	USBEnabled              bool     `mapstructure:"USB_ENABLED" key:"usb.enabled" desc:"Watch USB devices being connected and disconnected"`
+	USBNotify               bool     `mapstructure:"USB_NOTIFY" key:"usb.notify" desc:"Send a desktop notification when storage or input devices connect"`
+	USBWarnUnknownKeyboards bool     `mapstructure:"USB_WARN_UNKNOWN_KEYBOARDS" key:"usb.warn_unknown_keyboards" desc:"Alert when a keyboard never connected before appears"`
+	USBHook                 string   `mapstructure:"USB_HOOK" key:"usb.hook" shell:"true" desc:"Shell command run when USB devices or drive partitions come and go (DAEMIRA_USB_ACTION, DAEMIRA_USB_ID, DAEMIRA_USB_KINDS, DAEMIRA_USB_DEVNAME, ...)"`
+	USBDrives               []string `mapstructure:"USB_DRIVES" key:"usb.drives" desc:"External drives backed up to when plugged in, such as \"uuid=1234-ABCD mode=backup path=daemira\" (mode backup or sync)"`
+
+	// Network profiles
+	NetworkProfiles []string `mapstructure:"NETWORK_PROFILES" key:"network.profiles" desc:"Policies per Wi-Fi network, first match wins, such as \"ssid=Office bwlimit=2M\" or \"name=hotspot metered=true pause_updates=true power=power-saver\""`
+	NetworkHook     string   `mapstructure:"NETWORK_HOOK" key:"network.hook" shell:"true" desc:"Shell command run when the Wi-Fi network changes (DAEMIRA_NETWORK_SSID, DAEMIRA_NETWORK_PREVIOUS_SSID, DAEMIRA_NETWORK_PROFILE, DAEMIRA_NETWORK_METERED)"`
+
+	// VPN
+	VPNRequiredFor []string `mapstructure:"VPN_REQUIRED_FOR" key:"vpn.required_for" desc:"Syncs held while no VPN is up (gdrive, notion)"`
+	VPNNames       []string `mapstructure:"VPN_NAMES" key:"vpn.names" desc:"VPNs that count as up, by interface name or kind (wireguard, tun, tailscale); any if empty"`
+
+	// Application usage tracking
+	UsageTracking     bool     `mapstructure:"USAGE_TRACKING" key:"usage.tracking" desc:"Record time spent per focused application, stored locally"`
+	UsageExclude      []string `mapstructure:"USAGE_EXCLUDE" key:"usage.exclude" desc:"Application classes never recorded (case-insensitive substrings)"`
+	UsageRecordTitles bool     `mapstructure:"USAGE_RECORD_TITLES" key:"usage.record_titles" desc:"Also record window titles"`
+
+	// Do not disturb
+	DNDNotificationDaemon string `mapstructure:"DND_NOTIFICATION_DAEMON" key:"dnd.notification_daemon" enum:"auto,swaync,mako,none" desc:"Notification daemon switched along with do not disturb"`
+
+	// Scheduled jobs
+	JobSchedules      []string `mapstructure:"JOB_SCHEDULES" key:"jobs.schedules" desc:"Schedules overriding a job's own, such as \"system-update=0 4 * * *\" or \"gdrive-sync=@every 10m\""`
+	JobsDisabled      []string `mapstructure:"JOBS_DISABLED" key:"jobs.disabled" desc:"Jobs that don't run on their schedule; they still run with daemira jobs run"`
+	JobsCatchUp       bool     `mapstructure:"JOBS_CATCH_UP" key:"jobs.catch_up" desc:"Run jobs missed while the machine was suspended shortly after it resumes, instead of at their next time"`
+	JobsSystemdTimers bool     `mapstructure:"JOBS_SYSTEMD_TIMERS" key:"jobs.systemd_timers" desc:"Leave jobs whose timer from daemira generate-timers is enabled to systemd instead of running them on their schedule"`
+
+	// Where each setting came from, by environment variable name
+	sources map[string]string
+
+	// Config file profiles matching this machine
+	profiles []string
+
+	// What Migrate did while loading
+	migrations []string
 }
 
-// Load reads configuration from environment variables and .env file
+// Load reads configuration from the config files and environment variables.
+// Later layers override earlier ones: defaults, ./.env (legacy),
+// /etc/daemira/config.toml, ~/.config/daemira/config.toml, then environment
+// variables. Config files from older versions are upgraded first.
 func Load() (*Config, error) {
-	v := viper.New()
+	notes := Migrate()
+	if _, err := os.Stat(LegacyFile); err == nil {
+		if _, err := os.Stat(UserFile()); os.IsNotExist(err) {
+			notes = append(notes, fmt.Sprintf("Reading settings from %s; run `daemira config migrate` to move them to %s", LegacyFile, UserFile()))
+		}
+	}
+	cfg, err := load(Layers(), true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.migrations = notes
+	return cfg, nil
+}
+
+// Default returns the configuration made of the defaults alone, for when
+// loading fails
+func Default() *Config {
+	cfg, err := load(nil, false)
+	if err != nil {
+		// Only reachable if the defaults themselves are invalid
+		return &Config{RcloneRemoteName: "gdrive"}
+	}
+	return cfg
+}
 
-	// Set config file
-	v.SetConfigFile(".env")
-	v.SetConfigType("env")
+// load reads files (lowest precedence first) over the defaults, then the
+// environment if env is set
+func load(files []string, env bool) (*Config, error) {
+	v := viper.New()
+	sources := make(map[string]string)
 
 	// Set defaults
 	setDefaults(v)
+	for key := range defaults {
+		sources[key] = SourceDefault
+	}
 
-	// Read from .env file if it exists
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("failed to read config file: %w", err)
+	// Merge the config files, lowest precedence first
+	values := make(map[string]interface{})
+	active := make(map[string]bool)
+	for _, path := range files {
+		layer, err := readLayer(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range layer.values {
+			values[key] = value
+			sources[key] = layer.sources[key]
+		}
+		for profile := range layer.profiles {
+			active[profile] = true
 		}
-		// .env file not found, continue with environment variables only
+	}
+	if err := v.MergeConfigMap(values); err != nil {
+		return nil, fmt.Errorf("failed to merge config files: %w", err)
 	}
 
-	// Environment variables override .env file
-	v.AutomaticEnv()
+	// Environment variables override config files
+	if env {
+		v.AutomaticEnv()
+		for _, setting := range Settings() {
+			// Bound explicitly, since AutomaticEnv only covers keys viper already has
+			if err := v.BindEnv(setting.Env); err != nil {
+				return nil, fmt.Errorf("failed to read environment: %w", err)
+			}
+			if os.Getenv(setting.Env) != "" {
+				sources[setting.Env] = SourceEnv
+			}
+		}
+	}
 
 	// Parse configuration
 	cfg := &Config{}
-	if err := v.Unmarshal(cfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	if err := v.Unmarshal(cfg, viper.DecodeHook(decodeHook())); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %s", decodeError(err))
 	}
 
 	// Parse comma-separated lists
 	cfg.parseCommaSeparatedFields(v)
+	cfg.sources = sources
+	for profile := range active {
+		cfg.profiles = append(cfg.profiles, profile)
+	}
+	sort.Strings(cfg.profiles)
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	// Mask tokens and API keys wherever they would be printed
+	for _, setting := range Settings() {
+		if value, _ := cfg.Value(setting).(string); setting.Secret && !IsSecretRef(value) {
+			utility.RegisterSecret(value)
+		}
+	}
+
 	return cfg, nil
 }
 
+// defaults are the configuration values used when nothing else sets them
+var defaults = map[string]interface{}{
+	"NODE_ENV":                        "development",
+	"PORT":                            3000,
+	"LOG_LEVEL":                       "info",
+	"LOG_FORMAT":                      utility.FormatText,
+	"SLOW_COMMAND_THRESHOLD":          "10s",
+	"GDRIVE_ENABLED":                  true,
+	"SYSTEM_UPDATE_ENABLED":           true,
+	"HEALTH_ENABLED":                  true,
+	"DESKTOP_ENABLED":                 true,
+	"NOTION_ENABLED":                  true,
+	"NOTION_SYNC_INTERVAL":            "15m",
+	"NOTION_EXPORT_DIR":               "~/Documents/Notion",
+	"NOTION_ATTACHMENTS":              "upload",
+	"RCLONE_REMOTE_NAME":              "gdrive",
+	"SYSTEM_UPDATE_INTERVAL":          "6h",
+	"SYSTEM_UPDATE_AUTO":              false,
+	"SYSTEM_UPDATE_KEYRING_MAX_AGE":   "2160h",
+	"MONITOR_INTERVAL":                "60s",
+	"BACKUP_ENABLED":                  true,
+	"BACKUP_TOOL":                     "restic",
+	"BACKUP_INTERVAL":                 "24h",
+	"BACKUP_CHECK_INTERVAL":           "168h",
+	"BACKUP_KEEP_DAILY":               7,
+	"BACKUP_KEEP_WEEKLY":              4,
+	"BACKUP_KEEP_MONTHLY":             6,
+	"SNAPSHOTS_ENABLED":               false,
+	"SNAPSHOTS_BACKEND":               "auto",
+	"SNAPSHOTS_SUBVOLUME":             "/home",
+	"SNAPSHOTS_SNAPPER_CONFIG":        "home",
+	"SNAPSHOTS_INTERVAL":              "1h",
+	"SNAPSHOTS_KEEP_HOURLY":           24,
+	"SNAPSHOTS_KEEP_DAILY":            7,
+	"SNAPSHOTS_KEEP_WEEKLY":           4,
+	"FLEET_ENABLED":                   true,
+	"FLEET_INTERVAL":                  "15m",
+	"DISK_WARN_FREE":                  "200G",
+	"DISK_CRITICAL_FREE":              "100G",
+	"BOOT_REGRESSION":                 25,
+	"SECURITY_FAILED_LOGIN_THRESHOLD": 10,
+	"SECURITY_FAILED_LOGIN_WINDOW":    "1h",
+	"SECURITY_BLOCK_DURATION":         "24h",
+	"SECURITY_ALLOWLIST":              "100.64.0.0/10, 10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, fc00::/7, fe80::/10",
+	"SECURITY_SSH_CERT_WARN":          "168h",
+	"DIAGNOSTICS_MAX_CPU":             50,
+	"USB_ENABLED":                     true,
+	"USB_WARN_UNKNOWN_KEYBOARDS":      true,
+	"DIAGNOSTICS_MAX_MEMORY":          "512M",
+	"DIAGNOSTICS_MAX_GOROUTINES":      2000,
+	"DIAGNOSTICS_MAX_OPEN_FILES":      512,
+	"WALLPAPER_INTERVAL":              "30m",
+	"WALLPAPER_BACKEND":               "auto",
+	"DND_NOTIFICATION_DAEMON":         "auto",
+	"JOBS_CATCH_UP":                   true,
+	"JOBS_SYSTEMD_TIMERS":             true,
+}
+
 // setDefaults sets default configuration values
 func setDefaults(v *viper.Viper) {
-	v.SetDefault("NODE_ENV", "development")
-	v.SetDefault("PORT", 3000)
-	v.SetDefault("LOG_LEVEL", "info")
-	v.SetDefault("RCLONE_REMOTE_NAME", "gdrive")
-	v.SetDefault("SYSTEM_UPDATE_INTERVAL", "6h")
-	v.SetDefault("SYSTEM_UPDATE_AUTO", false)
-	v.SetDefault("MONITOR_INTERVAL", "60s")
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
 }
 
 // parseCommaSeparatedFields parses comma-separated string fields into slices
@@ -121,15 +399,111 @@ func (c *Config) parseCommaSeparatedFields(v *viper.Viper) {
 		c.RcloneExcludes = splitAndTrim(excludes)
 	}
 
+	// Parse backed up directories and backup excludes
+	if dirs := v.GetString("BACKUP_DIRECTORIES"); dirs != "" {
+		c.BackupDirectories = splitAndTrim(dirs)
+	}
+	if excludes := v.GetString("BACKUP_EXCLUDES"); excludes != "" {
+		c.BackupExcludes = splitAndTrim(excludes)
+	}
+
 	// Parse Notion page IDs
 	if pageIDs := v.GetString("NOTION_PAGE_IDS"); pageIDs != "" {
 		c.NotionPageIDs = splitAndTrim(pageIDs)
 	}
+
+	// Parse paths synced to Notion
+	if paths := v.GetString("NOTION_SYNC_PATHS"); paths != "" {
+		c.NotionSyncPaths = splitAndTrim(paths)
+	}
+
+	// Parse preferred audio sinks
+	if sinks := v.GetString("AUDIO_PREFERRED_SINKS"); sinks != "" {
+		c.AudioPreferredSinks = splitAndTrim(sinks)
+	}
+
+	// Parse favorite Bluetooth devices
+	if favorites := v.GetString("BLUETOOTH_FAVORITES"); favorites != "" {
+		c.BluetoothFavorites = splitAndTrim(favorites)
+	}
+
+	// Parse per-component log levels
+	if levels := v.GetString("LOG_COMPONENT_LEVELS"); levels != "" {
+		c.LogComponentLevels = splitAndTrim(levels)
+	}
+
+	// Parse applications excluded from usage tracking
+	if exclude := v.GetString("USAGE_EXCLUDE"); exclude != "" {
+		c.UsageExclude = splitAndTrim(exclude)
+	}
+
+	// Parse window rules (semicolon-separated, since patterns may contain commas)
+	if rules := v.GetString("DESKTOP_WINDOW_RULES"); rules != "" {
+		c.DesktopWindowRules = splitAndTrimOn(rules, ";")
+	}
+
+	// Parse workspace output rules (semicolon-separated, since output lists use commas)
+	if rules := v.GetString("DESKTOP_WORKSPACE_OUTPUTS"); rules != "" {
+		c.DesktopWorkspaceOutputs = splitAndTrimOn(rules, ";")
+	}
+
+	// Parse external drives (semicolon-separated, like the other rules)
+	if drives := v.GetString("USB_DRIVES"); drives != "" {
+		c.USBDrives = splitAndTrimOn(drives, ";")
+	}
+
+	// Parse network profiles (semicolon-separated, like the other rules)
+	if profiles := v.GetString("NETWORK_PROFILES"); profiles != "" {
+		c.NetworkProfiles = splitAndTrimOn(profiles, ";")
+	}
+
+	// Parse the VPN settings
+	if required := v.GetString("VPN_REQUIRED_FOR"); required != "" {
+		c.VPNRequiredFor = splitAndTrim(required)
+	}
+	if names := v.GetString("VPN_NAMES"); names != "" {
+		c.VPNNames = splitAndTrim(names)
+	}
+
+	// Parse job schedules (semicolon-separated, since cron fields use commas)
+	if schedules := v.GetString("JOB_SCHEDULES"); schedules != "" {
+		c.JobSchedules = splitAndTrimOn(schedules, ";")
+	}
+
+	// Parse watched config files
+	if paths := v.GetString("SECURITY_INTEGRITY_PATHS"); paths != "" {
+		c.SecurityIntegrityPaths = splitAndTrim(paths)
+	}
+
+	// Parse addresses never blocked
+	if allowlist := v.GetString("SECURITY_ALLOWLIST"); allowlist != "" {
+		c.SecurityAllowlist = splitAndTrim(allowlist)
+	}
+
+	// Parse expected kernel parameters
+	if params := v.GetString("KERNEL_PARAMS"); params != "" {
+		c.KernelParams = splitAndTrim(params)
+	}
+
+	// Parse keys expected in the SSH agent
+	if keys := v.GetString("SECURITY_SSH_AGENT_KEYS"); keys != "" {
+		c.SecuritySSHAgentKeys = splitAndTrim(keys)
+	}
+
+	// Parse disabled jobs
+	if disabled := v.GetString("JOBS_DISABLED"); disabled != "" {
+		c.JobsDisabled = splitAndTrim(disabled)
+	}
 }
 
 // splitAndTrim splits a comma-separated string and trims whitespace
 func splitAndTrim(s string) []string {
-	parts := strings.Split(s, ",")
+	return splitAndTrimOn(s, ",")
+}
+
+// splitAndTrimOn splits a string on sep and trims whitespace
+func splitAndTrimOn(s, sep string) []string {
+	parts := strings.Split(s, sep)
 	result := make([]string, 0, len(parts))
 	for _, part := range parts {
 		if trimmed := strings.TrimSpace(part); trimmed != "" {
@@ -157,14 +531,196 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid log level: %s (must be debug, info, warn, or error)", c.LogLevel)
 	}
 
+	// Validate log format and component levels
+	if c.LogFormat != utility.FormatText && c.LogFormat != utility.FormatJSON {
+		return fmt.Errorf("invalid log format: %s (must be text or json)", c.LogFormat)
+	}
+	if _, err := c.ComponentLevels(); err != nil {
+		return err
+	}
+
+	// Validate job schedules
+	if _, err := c.Schedules(); err != nil {
+		return err
+	}
+
 	// Validate port
 	if c.Port < 1 || c.Port > 65535 {
 		return fmt.Errorf("invalid port: %d (must be between 1 and 65535)", c.Port)
 	}
 
+	// Validate secret references (they are only looked up when used)
+	if err := c.validateSecretRefs(); err != nil {
+		return err
+	}
+
+	// Validate intervals (parsed while loading)
+	if c.SystemUpdateInterval <= 0 {
+		return fmt.Errorf("invalid system_update.interval: %v (must be positive)", c.SystemUpdateInterval)
+	}
+	if c.SystemUpdateKeyringMaxAge < 0 {
+		return fmt.Errorf("invalid system_update.keyring_max_age: %v (must not be negative)", c.SystemUpdateKeyringMaxAge)
+	}
+	if c.MonitorInterval <= 0 {
+		return fmt.Errorf("invalid health.monitor_interval: %v (must be positive)", c.MonitorInterval)
+	}
+	if c.NotionSyncInterval <= 0 {
+		return fmt.Errorf("invalid notion.sync_interval: %v (must be positive)", c.NotionSyncInterval)
+	}
+	if c.BackupInterval <= 0 {
+		return fmt.Errorf("invalid backup.interval: %v (must be positive)", c.BackupInterval)
+	}
+	if c.BackupCheckInterval <= 0 {
+		return fmt.Errorf("invalid backup.check_interval: %v (must be positive)", c.BackupCheckInterval)
+	}
+	if c.SnapshotsInterval <= 0 {
+		return fmt.Errorf("invalid snapshots.interval: %v (must be positive)", c.SnapshotsInterval)
+	}
+	if c.FleetInterval <= 0 {
+		return fmt.Errorf("invalid fleet.interval: %v (must be positive)", c.FleetInterval)
+	}
+	if c.SlowCommandThreshold < 0 {
+		return fmt.Errorf("invalid slow_command_threshold: %v (must not be negative)", c.SlowCommandThreshold)
+	}
+
+	// Validate Notion sync paths, each of which needs a page
+	if len(c.NotionSyncPaths) > 0 && len(c.NotionSyncPaths) != len(c.NotionPageIDs) {
+		return fmt.Errorf("notion.sync_paths has %d entries but notion.page_ids has %d (each path syncs to the page at its position)", len(c.NotionSyncPaths), len(c.NotionPageIDs))
+	}
+	switch c.NotionAttachments {
+	case "upload", "drive", "off":
+	default:
+		return fmt.Errorf("invalid notion.attachments: %q (must be upload, drive or off)", c.NotionAttachments)
+	}
+	if (c.NotionVaultPath == "") != (c.NotionVaultDatabaseID == "") {
+		return fmt.Errorf("notion.vault_path and notion.vault_database_id must be set together")
+	}
+
+	// Validate backups
+	switch c.BackupTool {
+	case "restic", "borg":
+	default:
+		return fmt.Errorf("invalid backup.tool: %q (must be restic or borg)", c.BackupTool)
+	}
+	if c.BackupTool == "borg" && strings.HasPrefix(c.BackupRepository, "rclone:") {
+		return fmt.Errorf("backup.repository %q is an rclone remote, which only restic can write to (set backup.tool = \"restic\")", c.BackupRepository)
+	}
+	if c.BackupKeepDaily < 0 || c.BackupKeepWeekly < 0 || c.BackupKeepMonthly < 0 {
+		return fmt.Errorf("backup.keep_daily, backup.keep_weekly and backup.keep_monthly must not be negative")
+	}
+
+	// Validate home snapshots
+	switch c.SnapshotsBackend {
+	case "auto", "snapper", "btrfs":
+	default:
+		return fmt.Errorf("invalid snapshots.backend: %q (must be auto, snapper or btrfs)", c.SnapshotsBackend)
+	}
+	if c.SnapshotsKeepHourly < 0 || c.SnapshotsKeepDaily < 0 || c.SnapshotsKeepWeekly < 0 {
+		return fmt.Errorf("snapshots.keep_hourly, snapshots.keep_daily and snapshots.keep_weekly must not be negative")
+	}
+
+	// Validate disk space thresholds
+	if c.DiskCriticalFree > c.DiskWarnFree {
+		return fmt.Errorf("health.disk_critical_free (%v) must not exceed health.disk_warn_free (%v)", c.DiskCriticalFree, c.DiskWarnFree)
+	}
+
+	// Validate the failed login check
+	if c.SecurityFailedLoginThreshold < 0 {
+		return fmt.Errorf("security.failed_login_threshold must not be negative (0 disables the check)")
+	}
+	for _, entry := range c.SecurityAllowlist {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid security.allowlist entry %q (must be an address or a CIDR range)", entry)
+		}
+	}
+
+	// The tailnet API is only served to clients holding the key
+	if c.APITailnet && c.APIKey == "" {
+		return fmt.Errorf("api.tailnet needs api.key (the key remote clients send)")
+	}
+
+	// Validate the syncs gated on a VPN
+	for _, name := range c.VPNRequiredFor {
+		if name != "gdrive" && name != "notion" {
+			return fmt.Errorf("invalid vpn.required_for entry %q (must be gdrive or notion)", name)
+		}
+	}
+
+	if c.BootRegression < 0 {
+		return fmt.Errorf("invalid health.boot_regression: %d (must not be negative, 0 disables)", c.BootRegression)
+	}
+
+	if c.SecuritySSHKeyMaxAge < 0 || c.SecuritySSHCertWarn < 0 {
+		return fmt.Errorf("security.ssh_key_max_age and security.ssh_cert_warn must not be negative")
+	}
+
+	// Validate daemon resource limits
+	if c.DiagnosticsMaxCPU < 0 || c.DiagnosticsMaxGoroutines < 0 || c.DiagnosticsMaxOpenFiles < 0 {
+		return fmt.Errorf("diagnostics.max_cpu, diagnostics.max_goroutines and diagnostics.max_open_files must not be negative (0 disables a limit)")
+	}
+
 	return nil
 }
 
+// Profiles returns the config file profiles applied on this machine
+func (c *Config) Profiles() []string {
+	return c.profiles
+}
+
+// Migrations returns what upgrading older config files did while loading
+func (c *Config) Migrations() []string {
+	return c.migrations
+}
+
+// ComponentLevels parses the per-component log levels ("gdrive=debug")
+func (c *Config) ComponentLevels() (map[string]utility.LogLevel, error) {
+	levels := make(map[string]utility.LogLevel, len(c.LogComponentLevels))
+	for _, entry := range c.LogComponentLevels {
+		component, name, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(component) == "" {
+			return nil, fmt.Errorf("invalid log_component_levels entry %q (expected component=level)", entry)
+		}
+		level, err := utility.ParseLogLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log_component_levels entry %q: %w", entry, err)
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
+}
+
+// Schedules parses the job schedule overrides ("system-update=0 4 * * *")
+func (c *Config) Schedules() (map[string]utility.Schedule, error) {
+	schedules := make(map[string]utility.Schedule, len(c.JobSchedules))
+	for _, entry := range c.JobSchedules {
+		job, spec, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(job) == "" {
+			return nil, fmt.Errorf("invalid jobs.schedules entry %q (expected job=schedule)", entry)
+		}
+		schedule, err := utility.ParseSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jobs.schedules entry %q: %w", entry, err)
+		}
+		schedules[strings.TrimSpace(job)] = schedule
+	}
+	return schedules, nil
+}
+
+// ApplyLogging sets the logger's level, per-component levels and format,
+// and the threshold for logging slow commands
+func (c *Config) ApplyLogging(logger *utility.Logger) {
+	utility.SetSlowCommandThreshold(c.SlowCommandThreshold)
+	if level, err := utility.ParseLogLevel(string(c.LogLevel)); err == nil {
+		logger.SetLevel(level)
+	}
+	if levels, err := c.ComponentLevels(); err == nil {
+		logger.SetComponentLevels(levels)
+	}
+	if c.LogFormat != "" {
+		logger.SetFormat(c.LogFormat)
+	}
+}
+
 // IsDevelopment returns true if running in development mode
 func (c *Config) IsDevelopment() bool {
 	return c.Environment == Development
@@ -202,6 +758,37 @@ func (c *Config) GetRcloneDirectories() []string {
 	}
 }
 
+// GetSecurityIntegrityPaths returns the files and directories whose
+// checksums are watched, with ~ expanded
+func (c *Config) GetSecurityIntegrityPaths() []string {
+	if len(c.SecurityIntegrityPaths) == 0 {
+		configHome := filepath.Dir(utility.ConfigDir())
+		return []string{
+			"/etc/sudoers.d",
+			filepath.Join(configHome, "systemd", "user", "daemira.service"),
+			filepath.Join(configHome, "hypr"),
+		}
+	}
+	homeDir, _ := os.UserHomeDir()
+	paths := make([]string, 0, len(c.SecurityIntegrityPaths))
+	for _, path := range c.SecurityIntegrityPaths {
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			path = homeDir + path[1:]
+		}
+		paths = append(paths, filepath.Clean(path))
+	}
+	return paths
+}
+
+// GetBackupDirectories returns the directories to back up, by default the
+// ones synced to Google Drive
+func (c *Config) GetBackupDirectories() []string {
+	if len(c.BackupDirectories) > 0 {
+		return c.BackupDirectories
+	}
+	return c.GetRcloneDirectories()
+}
+
 // GetRcloneExcludes returns the rclone exclude patterns or defaults
 func (c *Config) GetRcloneExcludes() []string {
 	if len(c.RcloneExcludes) > 0 {
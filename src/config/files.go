@@ -0,0 +1,329 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/viper"
+)
+
+// LegacyFile is the .env file read from the working directory, below the
+// config files in precedence
+const LegacyFile = ".env"
+
+// SystemDir holds the system-wide config file
+const SystemDir = "/etc/daemira"
+
+// profilesKey is the config file table holding per-machine profiles, e.g.
+// [profiles.laptop.gdrive]
+const profilesKey = "profiles"
+
+// includeKey is the config file setting listing more config files to read,
+// e.g. include = ["conf.d/*.toml"]
+const includeKey = "include"
+
+// machineIDFiles hold the machine ID a profile can be named after
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// configNames are the config file names tried in each directory, first found wins
+var configNames = []string{"config.toml", "config.yaml", "config.yml"}
+
+// Files returns every config file Load looks for, lowest precedence first:
+// ./.env, then /etc/daemira/config.toml, then ~/.config/daemira/config.toml
+// (each directory also accepts config.yaml or config.yml), followed by the
+// files the existing ones include
+func Files() []string {
+	files := []string{LegacyFile}
+	for _, dir := range []string{SystemDir, utility.ConfigDir()} {
+		for _, name := range configNames {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	for _, path := range Layers() {
+		files = append(files, included(path, nil)...)
+	}
+	return files
+}
+
+// Layers returns the config files that exist, lowest precedence first
+func Layers() []string {
+	var found []string
+	if _, err := os.Stat(LegacyFile); err == nil {
+		found = append(found, LegacyFile)
+	}
+	for _, dir := range []string{SystemDir, utility.ConfigDir()} {
+		for _, name := range configNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				found = append(found, path)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// layer holds the values of one config file and the files it includes,
+// keyed by environment variable
+type layer struct {
+	values   map[string]interface{}
+	sources  map[string]string // file, and profile if any, each value came from
+	profiles map[string]bool   // profiles that matched this machine
+}
+
+// readLayer reads one config file. Unknown keys are an error in config
+// files; .env files may hold other variables and only known ones are taken.
+func readLayer(path string) (*layer, error) {
+	l := &layer{
+		values:   make(map[string]interface{}),
+		sources:  make(map[string]string),
+		profiles: make(map[string]bool),
+	}
+	if err := l.read(path, nil); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// read merges a config file into the layer: its top level, then the files
+// it includes, then its profiles matching this machine. parents are the
+// files including it.
+func (l *layer) read(path string, parents []string) error {
+	if slices.Contains(parents, path) {
+		return fmt.Errorf("%s includes itself (via %s)", path, strings.Join(parents, " -> "))
+	}
+
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	legacy := filepath.Ext(path) == ".env"
+	if legacy {
+		fv.SetConfigType("env")
+	}
+	if err := fv.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// Files Migrate could not rewrite are upgraded as they are read
+	if !legacy && fv.GetInt(versionKey) != Version {
+		tree := fv.AllSettings()
+		if _, err := upgrade(path, fv.GetInt(versionKey), tree); err != nil {
+			return err
+		}
+		fv = viper.New()
+		if err := fv.MergeConfigMap(tree); err != nil {
+			return fmt.Errorf("failed to upgrade %s: %w", path, err)
+		}
+	}
+
+	settings := make(map[string]Setting)
+	known := make(map[string]bool)
+	for _, setting := range Settings() {
+		settings[setting.Key] = setting
+		known[setting.Env] = true
+	}
+
+	// set stores a value, expanding ${VAR} in config files (viper already
+	// expands variables in .env files)
+	set := func(setting Setting, value interface{}, source string) error {
+		if !legacy {
+			expanded, err := interpolate(setting, value)
+			if err != nil {
+				return fmt.Errorf("%s in %s: %w", setting.Key, source, err)
+			}
+			value = expanded
+		}
+		l.values[setting.Env] = value
+		l.sources[setting.Env] = source
+		return nil
+	}
+
+	for _, key := range fv.AllKeys() {
+		if legacy {
+			if env := strings.ToUpper(key); known[env] {
+				l.values[env] = fv.Get(key)
+				l.sources[env] = path
+			}
+			continue
+		}
+		if key == versionKey || key == includeKey || strings.HasPrefix(key, profilesKey+".") {
+			continue
+		}
+		setting, ok := settings[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %s", key, path)
+		}
+		if err := set(setting, fv.Get(key), path); err != nil {
+			return err
+		}
+	}
+	if legacy {
+		return nil
+	}
+
+	// Included files override the top level of the file including them
+	files, err := includedFiles(path, fv.Get(includeKey))
+	if err != nil {
+		return err
+	}
+	chain := append(slices.Clone(parents), path)
+	for _, file := range files {
+		if err := l.read(file, chain); err != nil {
+			return err
+		}
+	}
+
+	if !fv.IsSet(profilesKey) {
+		return nil
+	}
+
+	// Every profile is checked, so a typo shows up on all machines
+	sections, ok := fv.Get(profilesKey).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s in %s must be a table of profiles", profilesKey, path)
+	}
+	overrides := make(map[string]map[string]interface{})
+	for name, section := range sections {
+		if strings.Contains(name, ".") {
+			// Dotted keys would not survive `config set`
+			return fmt.Errorf("profile %q in %s: use the short hostname (no dots)", name, path)
+		}
+		table, ok := section.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("profile %q in %s must be a table", name, path)
+		}
+		overrides[name] = make(map[string]interface{})
+		for key, value := range flatten("", table) {
+			if _, ok := settings[key]; !ok {
+				return fmt.Errorf("unknown setting %q in profile %q in %s", key, name, path)
+			}
+			overrides[name][key] = value
+		}
+	}
+
+	// Profiles matching this machine override the rest of the file, the
+	// machine ID over the hostname
+	for _, name := range MachineNames() {
+		for key, value := range overrides[name] {
+			if err := set(settings[key], value, fmt.Sprintf("%s, profile %s", path, name)); err != nil {
+				return err
+			}
+			l.profiles[name] = true
+		}
+	}
+	return nil
+}
+
+// includedFiles expands the include patterns of the config file at path.
+// Patterns may start with ~ and use ${VAR}; relative ones are relative to
+// the file. A pattern without wildcards must name an existing file.
+func includedFiles(path string, include interface{}) ([]string, error) {
+	var patterns []string
+	switch v := include.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s in %s must be a list of paths", includeKey, path)
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, fmt.Errorf("%s in %s must be a list of paths", includeKey, path)
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		pattern, err := expandVariables(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s in %s: %w", includeKey, path, err)
+		}
+		if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get home directory: %w", err)
+			}
+			pattern = filepath.Join(homeDir, strings.TrimPrefix(pattern, "~"))
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q in %s: %w", includeKey, pattern, path, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("%s included from %s does not exist", pattern, path)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// included returns the files a config file includes, recursively, skipping
+// any it cannot read; the reload watcher also watches these
+func included(path string, parents []string) []string {
+	if filepath.Ext(path) == ".env" || slices.Contains(parents, path) {
+		return nil
+	}
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	if err := fv.ReadInConfig(); err != nil {
+		return nil
+	}
+	files, err := includedFiles(path, fv.Get(includeKey))
+	if err != nil {
+		return nil
+	}
+	var all []string
+	chain := append(slices.Clone(parents), path)
+	for _, file := range files {
+		all = append(all, file)
+		all = append(all, included(file, chain)...)
+	}
+	return all
+}
+
+// flatten turns nested tables into dotted keys
+func flatten(prefix string, table map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for key, value := range table {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			for nestedKey, nestedValue := range flatten(key, nested) {
+				flat[nestedKey] = nestedValue
+			}
+			continue
+		}
+		flat[key] = value
+	}
+	return flat
+}
+
+// MachineNames returns the profile names that match this machine, lowest
+// precedence first: the short hostname and the machine ID
+func MachineNames() []string {
+	var names []string
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		short, _, _ := strings.Cut(strings.ToLower(hostname), ".")
+		names = append(names, short)
+	}
+	for _, path := range machineIDFiles {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				names = append(names, id)
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches ${NAME}; a bare $NAME is left alone, since rules
+// and patterns use $ themselves
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate expands ${NAME} in a config file value of the setting. Shell
+// commands and cmd: secret references are left to the shell.
+func interpolate(setting Setting, value interface{}) (interface{}, error) {
+	if setting.Shell {
+		return value, nil
+	}
+	switch v := value.(type) {
+	case string:
+		if setting.Secret && strings.HasPrefix(v, cmdPrefix) {
+			return v, nil
+		}
+		return expandVariables(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for idx, item := range v {
+			expanded, err := interpolate(setting, item)
+			if err != nil {
+				return nil, err
+			}
+			items[idx] = expanded
+		}
+		return items, nil
+	}
+	return value, nil
+}
+
+// expandVariables replaces ${NAME} with the variable's value; an unset
+// variable is an error rather than silently empty
+func expandVariables(s string) (string, error) {
+	var missing string
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[2 : len(match)-1]
+		if value, ok := lookupVariable(name); ok {
+			return value
+		}
+		if missing == "" {
+			missing = name
+		}
+		return match
+	})
+	if missing != "" {
+		return "", fmt.Errorf("${%s} is not set", missing)
+	}
+	return expanded, nil
+}
+
+// lookupVariable looks up an environment variable. HOME and HOSTNAME fall
+// back to the user's home directory and the hostname, which services and
+// non-interactive shells often lack.
+func lookupVariable(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	switch name {
+	case "HOME":
+		if current, err := user.Current(); err == nil && current.HomeDir != "" {
+			return current.HomeDir, true
+		}
+	case "HOSTNAME":
+		if hostname, err := os.Hostname(); err == nil {
+			return hostname, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Version is the config file format of this release; files without a
+// version are version 0 and are upgraded when read
+const Version = 1
+
+// versionKey is the config file setting holding its format version
+const versionKey = "version"
+
+// migration upgrades the settings of a config file to its version and
+// describes each change
+type migration struct {
+	version int
+	apply   func(tree map[string]interface{}) []string
+}
+
+// migrations in version order
+var migrations = []migration{
+	{version: 1, apply: migrateEnvNames},
+}
+
+// migrateEnvNames moves settings written with their environment variable
+// name, as in .env (RCLONE_REMOTE_NAME = "gdrive"), to their key
+func migrateEnvNames(tree map[string]interface{}) []string {
+	var changes []string
+	for _, setting := range Settings() {
+		name := strings.ToLower(setting.Env)
+		value, ok := tree[name]
+		if !ok || name == setting.Key {
+			continue
+		}
+		delete(tree, name)
+		if _, exists := lookupPath(tree, setting.Key); exists {
+			changes = append(changes, fmt.Sprintf("removed %s, %s is already set", setting.Env, setting.Key))
+			continue
+		}
+		setPath(tree, setting.Key, value)
+		changes = append(changes, fmt.Sprintf("renamed %s to %s", setting.Env, setting.Key))
+	}
+	return changes
+}
+
+// upgrade applies the migrations newer than version to a config file's
+// settings
+func upgrade(path string, version int, tree map[string]interface{}) ([]string, error) {
+	if version > Version {
+		return nil, fmt.Errorf("%s is config version %d; this daemira only understands up to %d", path, version, Version)
+	}
+	var changes []string
+	for _, m := range migrations {
+		if m.version > version {
+			changes = append(changes, m.apply(tree)...)
+		}
+	}
+	tree[versionKey] = Version
+	return changes, nil
+}
+
+// Migrate upgrades config files older than Version in place, keeping the
+// previous file as <file>.v<version>.bak, and returns what it did. Files it
+// cannot write are still upgraded whenever they are read.
+func Migrate() []string {
+	var notes []string
+	for _, layer := range Layers() {
+		if filepath.Ext(layer) == ".env" {
+			continue
+		}
+		for _, path := range append([]string{layer}, included(layer, nil)...) {
+			changes, err := migrateFile(path)
+			if err != nil {
+				notes = append(notes, fmt.Sprintf("Could not upgrade %s, upgrading it in memory: %v", path, err))
+				continue
+			}
+			notes = append(notes, changes...)
+		}
+	}
+	return notes
+}
+
+// migrateFile upgrades one config file if it is older than Version
+func migrateFile(path string) ([]string, error) {
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	if err := fv.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	version := fv.GetInt(versionKey)
+	if version >= Version {
+		// A newer file is reported when it is read
+		return nil, nil
+	}
+	tree := fv.AllSettings()
+	changes, err := upgrade(path, version, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	if len(changes) == 0 {
+		// Only the version is new, so keep the file and its comments
+		if err := os.WriteFile(path, withVersion(path, data), info.Mode().Perm()); err != nil {
+			return nil, fmt.Errorf("failed to save %s: %w", path, err)
+		}
+	} else if err := writeTree(path, tree, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+
+	notes := []string{fmt.Sprintf("Upgraded %s to config version %d (previous file kept as %s)", path, Version, backup)}
+	for _, change := range changes {
+		notes = append(notes, fmt.Sprintf("%s: %s", filepath.Base(path), change))
+	}
+	return notes, nil
+}
+
+// ImportLegacy moves the settings of ./.env to the user's config file, which
+// must not exist yet, and returns the file written and the settings moved.
+// The .env file is left in place.
+func ImportLegacy() (string, int, error) {
+	path := UserFile()
+	if _, err := os.Stat(path); err == nil {
+		return "", 0, fmt.Errorf("%s already exists; move the settings from %s by hand", path, LegacyFile)
+	}
+
+	fv := viper.New()
+	fv.SetConfigFile(LegacyFile)
+	fv.SetConfigType("env")
+	if err := fv.ReadInConfig(); err != nil {
+		return "", 0, fmt.Errorf("failed to read %s: %w", LegacyFile, err)
+	}
+
+	tree := map[string]interface{}{versionKey: Version}
+	count := 0
+	for _, setting := range Settings() {
+		raw := fv.GetString(strings.ToLower(setting.Env))
+		if raw == "" {
+			continue
+		}
+		value, err := setting.Parse(raw)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s in %s: %w", setting.Env, LegacyFile, err)
+		}
+		setPath(tree, setting.Key, value)
+		count++
+	}
+	if count == 0 {
+		return "", 0, fmt.Errorf("no daemira settings in %s", LegacyFile)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, fmt.Errorf("failed to create config directory: %w", err)
+	}
+	// .env files often hold tokens
+	if err := writeTree(path, tree, 0600); err != nil {
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+// withVersion adds the version setting after the leading comments of a
+// config file
+func withVersion(path string, data []byte) []byte {
+	line := fmt.Sprintf("%s = %d\n", versionKey, Version)
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		line = fmt.Sprintf("%s: %d\n", versionKey, Version)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	idx := 0
+	for idx < len(lines) {
+		trimmed := strings.TrimSpace(lines[idx])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && trimmed != "---" {
+			break
+		}
+		idx++
+	}
+	header := strings.Join(lines[:idx], "")
+	if header != "" && !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	return []byte(header + line + strings.Join(lines[idx:], ""))
+}
+
+// writeTree replaces a config file with settings, writing a temporary file
+// next to it first
+func writeTree(path string, tree map[string]interface{}, perm os.FileMode) error {
+	out := viper.New()
+	if err := out.MergeConfigMap(tree); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	pending := filepath.Join(filepath.Dir(path), ".pending-"+filepath.Base(path))
+	if err := out.WriteConfigAs(pending); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pending, err)
+	}
+	defer os.Remove(pending)
+	if err := os.Chmod(pending, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", pending, err)
+	}
+	if err := os.Rename(pending, path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+// lookupPath finds a dotted key in nested tables
+func lookupPath(tree map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := tree[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		tree = next
+	}
+	value, ok := tree[parts[len(parts)-1]]
+	return value, ok
+}
+
+// setPath stores a value under a dotted key, creating tables as needed
+func setPath(tree map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := tree[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			tree[part] = next
+		}
+		tree = next
+	}
+	tree[parts[len(parts)-1]] = value
+}
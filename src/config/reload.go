@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// reloadable lists the settings a running daemon applies without restarting
+var reloadable = map[string]bool{
+	"LOG_LEVEL":                       true,
+	"LOG_FORMAT":                      true,
+	"LOG_COMPONENT_LEVELS":            true,
+	"SLOW_COMMAND_THRESHOLD":          true,
+	"RCLONE_EXCLUDES":                 true,
+	"SYSTEM_UPDATE_INTERVAL":          true,
+	"SYSTEM_UPDATE_KEYRING_MAX_AGE":   true,
+	"MONITOR_INTERVAL":                true,
+	"NOTION_SYNC_INTERVAL":            true,
+	"BACKUP_EXCLUDES":                 true,
+	"BACKUP_INTERVAL":                 true,
+	"BACKUP_CHECK_INTERVAL":           true,
+	"BACKUP_KEEP_DAILY":               true,
+	"BACKUP_KEEP_WEEKLY":              true,
+	"BACKUP_KEEP_MONTHLY":             true,
+	"SNAPSHOTS_INTERVAL":              true,
+	"SNAPSHOTS_KEEP_HOURLY":           true,
+	"SNAPSHOTS_KEEP_DAILY":            true,
+	"SNAPSHOTS_KEEP_WEEKLY":           true,
+	"FLEET_INTERVAL":                  true,
+	"DISK_WARN_FREE":                  true,
+	"DISK_CRITICAL_FREE":              true,
+	"BOOT_REGRESSION":                 true,
+	"KERNEL_PARAMS":                   true,
+	"SECURITY_FAILED_LOGIN_THRESHOLD": true,
+	"SECURITY_FAILED_LOGIN_WINDOW":    true,
+	"SECURITY_BLOCK":                  true,
+	"SECURITY_BLOCK_DURATION":         true,
+	"SECURITY_ALLOWLIST":              true,
+	"SECURITY_INTEGRITY_PATHS":        true,
+	"SECURITY_SSH_AGENT_KEYS":         true,
+	"SECURITY_SSH_KEY_MAX_AGE":        true,
+	"SECURITY_SSH_CERT_WARN":          true,
+	"DIAGNOSTICS_MAX_CPU":             true,
+	"DIAGNOSTICS_MAX_MEMORY":          true,
+	"DIAGNOSTICS_MAX_GOROUTINES":      true,
+	"DIAGNOSTICS_MAX_OPEN_FILES":      true,
+	"DIAGNOSTICS_HEAP_PROFILE":        true,
+	"AUDIO_PREFERRED_SINKS":           true,
+	"USB_NOTIFY":                      true,
+	"USB_WARN_UNKNOWN_KEYBOARDS":      true,
+	"USB_HOOK":                        true,
+	"USB_DRIVES":                      true,
+	"NETWORK_PROFILES":                true,
+	"NETWORK_HOOK":                    true,
+	"VPN_REQUIRED_FOR":                true,
+	"VPN_NAMES":                       true,
+	"USAGE_EXCLUDE":                   true,
+	"DND_NOTIFICATION_DAEMON":         true,
+	"JOB_SCHEDULES":                   true,
+	"JOBS_DISABLED":                   true,
+	"JOBS_CATCH_UP":                   true,
+	"JOBS_SYSTEMD_TIMERS":             true,
+}
+
+// IsReloadable reports whether a setting can change while the daemon runs
+func IsReloadable(key string) bool {
+	return reloadable[key]
+}
+
+// Change is a setting whose value differs between two configs
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// String formats the change as "KEY: old -> new"
+func (ch Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", ch.Key, formatValue(ch.Old), formatValue(ch.New))
+}
+
+// formatValue renders a config value for logs
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case time.Duration:
+		return formatDuration(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// Diff returns the settings that differ in other, in declaration order
+func (c *Config) Diff(other *Config) []Change {
+	var changes []Change
+	oldValue := reflect.ValueOf(c).Elem()
+	newValue := reflect.ValueOf(other).Elem()
+	for idx := 0; idx < oldValue.NumField(); idx++ {
+		key := oldValue.Type().Field(idx).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		before, after := oldValue.Field(idx).Interface(), newValue.Field(idx).Interface()
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, Change{Key: key, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// WithReloadable returns a copy of c carrying the reloadable settings of
+// other; everything else keeps its current value until the next start
+func (c *Config) WithReloadable(other *Config) *Config {
+	merged := *c
+	target := reflect.ValueOf(&merged).Elem()
+	source := reflect.ValueOf(other).Elem()
+	for idx := 0; idx < target.NumField(); idx++ {
+		if reloadable[target.Type().Field(idx).Tag.Get("mapstructure")] {
+			target.Field(idx).Set(source.Field(idx))
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Patterns of the string forms of durations and sizes, as accepted while loading
+const (
+	durationPattern = `^\s*([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+\s*$`
+	sizePattern     = `^\s*[0-9]+(\.[0-9]+)?\s*([KMGTkmgt]([iI]?[bB])?|[bB])?\s*$`
+)
+
+// Schema returns a JSON schema (draft 2020-12) for the config file, built
+// from the settings so it always matches what Load accepts
+func Schema() map[string]interface{} {
+	root := schemaObject()
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "Daemira configuration"
+	root["description"] = "~/.config/daemira/config.toml or /etc/daemira/config.toml; every setting can be overridden by its environment variable"
+
+	for _, setting := range Settings() {
+		parent := root
+		parts := strings.Split(setting.Key, ".")
+		for _, section := range parts[:len(parts)-1] {
+			properties := parent["properties"].(map[string]interface{})
+			child, ok := properties[section].(map[string]interface{})
+			if !ok {
+				child = schemaObject()
+				properties[section] = child
+			}
+			parent = child
+		}
+		parent["properties"].(map[string]interface{})[parts[len(parts)-1]] = setting.schema()
+	}
+
+	// A profile holds the same settings, for one machine
+	profile := schemaObject()
+	for key, value := range root["properties"].(map[string]interface{}) {
+		profile["properties"].(map[string]interface{})[key] = value
+	}
+	root["properties"].(map[string]interface{})[profilesKey] = map[string]interface{}{
+		"type":                 "object",
+		"description":          "Settings for one machine, named after its hostname or machine ID, overriding the rest of the file",
+		"additionalProperties": profile,
+	}
+	root["properties"].(map[string]interface{})[versionKey] = map[string]interface{}{
+		"type":        "integer",
+		"minimum":     0,
+		"maximum":     Version,
+		"description": "Config file format version; older files are upgraded when read, keeping a backup",
+	}
+	root["properties"].(map[string]interface{})[includeKey] = map[string]interface{}{
+		"type":        []string{"array", "string"},
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "More config files to read, overriding this one; glob patterns, relative to this file or starting with ~",
+	}
+	return root
+}
+
+// SchemaJSON returns the schema as indented JSON
+func SchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaObject returns an empty section; unknown keys are an error when loading
+func schemaObject() map[string]interface{} {
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           make(map[string]interface{}),
+		"additionalProperties": false,
+	}
+}
+
+// schema describes the setting's type, default and meaning
+func (s Setting) schema() map[string]interface{} {
+	property := make(map[string]interface{})
+	switch t := reflect.TypeOf(Config{}).Field(s.field).Type; {
+	case t == reflect.TypeOf(time.Duration(0)):
+		property["type"] = "string"
+		property["pattern"] = durationPattern
+	case t == reflect.TypeOf(Size(0)):
+		// A plain number is bytes
+		property["type"] = []string{"string", "integer"}
+		property["pattern"] = sizePattern
+	case t.Kind() == reflect.Bool:
+		property["type"] = "boolean"
+	case t.Kind() == reflect.Int:
+		property["type"] = "integer"
+	case t.Kind() == reflect.Slice:
+		// A string is split like the environment variable
+		property["type"] = []string{"array", "string"}
+		property["items"] = map[string]interface{}{"type": "string"}
+	default:
+		property["type"] = "string"
+	}
+
+	if len(s.Enum) > 0 {
+		property["enum"] = s.Enum
+	}
+	if value, ok := defaults[s.Env]; ok {
+		property["default"] = value
+	}
+	if s.Secret {
+		property["writeOnly"] = true
+	}
+
+	description := s.Description
+	if description != "" {
+		description += ". "
+	}
+	property["description"] = description + "Environment variable: " + s.Env
+	return property
+}
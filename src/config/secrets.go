@@ -0,0 +1,164 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Secret reference prefixes. A secret setting holding one of these is
+// resolved when first used instead of being stored in plain text:
+//
+//	keyring:notion-token                  secret-tool lookup service daemira account notion-token
+//	keyring:service=notion account=work   secret-tool lookup service notion account work
+//	pass:api/notion                       first line of `pass show api/notion`
+//	cmd:bw get password notion            output of any command
+const (
+	keyringPrefix = "keyring:"
+	passPrefix    = "pass:"
+	cmdPrefix     = "cmd:"
+)
+
+// secretTimeout bounds a secret lookup; pass may wait for a pinentry
+const secretTimeout = 2 * time.Minute
+
+var (
+	secretCache   = make(map[string]string)
+	secretCacheMu sync.Mutex
+)
+
+// IsSecretRef reports whether value refers to a secret stored elsewhere
+func IsSecretRef(value string) bool {
+	for _, prefix := range []string{keyringPrefix, passPrefix, cmdPrefix} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretCommand returns the command that looks up a secret reference
+func secretCommand(ref string) (string, []string, error) {
+	switch {
+	case strings.HasPrefix(ref, keyringPrefix):
+		fields := strings.Fields(strings.TrimPrefix(ref, keyringPrefix))
+		if len(fields) == 0 {
+			return "", nil, fmt.Errorf("empty keyring reference")
+		}
+		args := []string{"lookup"}
+		if len(fields) == 1 && !strings.Contains(fields[0], "=") {
+			args = append(args, "service", "daemira", "account", fields[0])
+		} else {
+			for _, field := range fields {
+				attribute, value, ok := strings.Cut(field, "=")
+				if !ok || attribute == "" || value == "" {
+					return "", nil, fmt.Errorf("invalid keyring attribute %q (expected attribute=value)", field)
+				}
+				args = append(args, attribute, value)
+			}
+		}
+		return "secret-tool", args, nil
+	case strings.HasPrefix(ref, passPrefix):
+		name := strings.TrimSpace(strings.TrimPrefix(ref, passPrefix))
+		if name == "" {
+			return "", nil, fmt.Errorf("empty pass reference")
+		}
+		return "pass", []string{"show", name}, nil
+	case strings.HasPrefix(ref, cmdPrefix):
+		command := strings.TrimSpace(strings.TrimPrefix(ref, cmdPrefix))
+		if command == "" {
+			return "", nil, fmt.Errorf("empty command reference")
+		}
+		return "sh", []string{"-c", command}, nil
+	}
+	return "", nil, fmt.Errorf("not a secret reference")
+}
+
+// ResolveSecret returns the secret value refers to, looking it up on first
+// use and caching it for the life of the process. Plain values are returned
+// unchanged. Neither the secret nor the lookup's output appears in errors.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+
+	// Lookups run one at a time so a locked keyring or gpg-agent prompts once
+	secretCacheMu.Lock()
+	defer secretCacheMu.Unlock()
+	if secret, ok := secretCache[value]; ok {
+		return secret, nil
+	}
+
+	name, args, err := secretCommand(value)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+	lookup := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	lookup.Stdout = &stdout
+	lookup.Stderr = &stderr
+	if err := lookup.Run(); err != nil {
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = err.Error()
+		}
+		return "", fmt.Errorf("failed to look up secret %s: %s", name, firstLine(reason))
+	}
+
+	secret := strings.TrimRight(stdout.String(), "\r\n")
+	if !strings.HasPrefix(value, cmdPrefix) {
+		// pass keeps extra fields after the first line; secret-tool prints one line
+		secret = firstLine(secret)
+	}
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", name)
+	}
+	secretCache[value] = secret
+	utility.RegisterSecret(secret)
+	return secret, nil
+}
+
+// firstLine returns s up to its first newline
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimRight(line, "\r")
+}
+
+// Secret resolves a secret setting (e.g. "notion.token" or "NOTION_TOKEN")
+func (c *Config) Secret(ctx context.Context, name string) (string, error) {
+	setting, ok := Lookup(name)
+	if !ok || !setting.Secret {
+		return "", fmt.Errorf("%q is not a secret setting", name)
+	}
+	value, _ := c.Value(setting).(string)
+	if value == "" {
+		return "", fmt.Errorf("%s is not set", setting.Key)
+	}
+	secret, err := ResolveSecret(ctx, value)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", setting.Key, err)
+	}
+	return secret, nil
+}
+
+// validateSecretRefs checks the syntax of secret references without running them
+func (c *Config) validateSecretRefs() error {
+	for _, setting := range Settings() {
+		value, _ := c.Value(setting).(string)
+		if !setting.Secret || !IsSecretRef(value) {
+			continue
+		}
+		if _, _, err := secretCommand(value); err != nil {
+			return fmt.Errorf("invalid secret reference for %s: %w", setting.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/viper"
+)
+
+// Setting sources besides config file paths
+const (
+	SourceDefault = "default"
+	SourceEnv     = "environment"
+	SourceUnset   = "unset"
+)
+
+// semicolonLists are list settings separated by semicolons, since their items contain commas
+var semicolonLists = map[string]bool{
+	"DESKTOP_WINDOW_RULES":      true,
+	"DESKTOP_WORKSPACE_OUTPUTS": true,
+	"JOB_SCHEDULES":             true,
+}
+
+// Setting describes one configuration setting
+type Setting struct {
+	Key         string   // dotted key in config files, e.g. "gdrive.excludes"
+	Env         string   // environment variable and legacy .env name, e.g. "RCLONE_EXCLUDES"
+	Secret      bool     // hidden unless asked for
+	Shell       bool     // a shell command, so ${VAR} is left to the shell
+	Description string   // one-line description
+	Enum        []string // allowed values, if limited
+	field       int
+}
+
+// Settings returns every setting in declaration order
+func Settings() []Setting {
+	var settings []Setting
+	t := reflect.TypeOf(Config{})
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if key := field.Tag.Get("key"); key != "" {
+			setting := Setting{
+				Key:         key,
+				Env:         field.Tag.Get("mapstructure"),
+				Secret:      field.Tag.Get("secret") == "true",
+				Shell:       field.Tag.Get("shell") == "true",
+				Description: field.Tag.Get("desc"),
+				field:       idx,
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				setting.Enum = strings.Split(enum, ",")
+			}
+			settings = append(settings, setting)
+		}
+	}
+	return settings
+}
+
+// Lookup finds a setting by config file key or environment variable name
+func Lookup(name string) (Setting, bool) {
+	for _, setting := range Settings() {
+		if strings.EqualFold(name, setting.Key) || strings.EqualFold(name, setting.Env) {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Parse converts a command-line value to the setting's type; lists are
+// comma-separated (semicolon-separated for rule lists)
+func (s Setting) Parse(raw string) (interface{}, error) {
+	switch reflect.TypeOf(Config{}).Field(s.field).Type.Kind() {
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s expects true or false, got %q", s.Key, raw)
+		}
+		return value, nil
+	case reflect.Int:
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s expects a number, got %q", s.Key, raw)
+		}
+		return value, nil
+	case reflect.Slice:
+		if semicolonLists[s.Env] {
+			return splitAndTrimOn(raw, ";"), nil
+		}
+		return splitAndTrim(raw), nil
+	}
+	return raw, nil
+}
+
+// Value returns the value of a setting
+func (c *Config) Value(s Setting) interface{} {
+	return reflect.ValueOf(c).Elem().Field(s.field).Interface()
+}
+
+// FormatValue renders the value of a setting for display; secrets are masked
+// unless reveal is set, while secret references are shown as they are
+func (c *Config) FormatValue(s Setting, reveal bool) string {
+	value := c.Value(s)
+	if ref, _ := value.(string); s.Secret && !reveal && ref != "" && !IsSecretRef(ref) {
+		return "********"
+	}
+	return formatValue(value)
+}
+
+// Source returns where a setting's value came from: a config file path,
+// SourceEnv, SourceDefault or SourceUnset
+func (c *Config) Source(s Setting) string {
+	if source, ok := c.sources[s.Env]; ok {
+		return source
+	}
+	return SourceUnset
+}
+
+// UserFile returns the user's config file, which may not exist yet
+func UserFile() string {
+	dir := utility.ConfigDir()
+	for _, name := range configNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, configNames[0])
+}
+
+// Set stores a setting in the user's config file and returns the file
+// written. The file is only replaced when the resulting config is valid.
+// Comments in the file are not kept.
+func Set(name, raw string) (string, error) {
+	setting, ok := Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("unknown setting %q", name)
+	}
+	value, err := setting.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	path := UserFile()
+	fv := viper.New()
+	fv.SetConfigFile(path)
+	// The file may hold tokens, so a new one is only for the user
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if err := fv.ReadInConfig(); err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	} else {
+		fv.Set(versionKey, Version)
+	}
+	fv.Set(setting.Key, value)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	pending := filepath.Join(filepath.Dir(path), ".pending-"+filepath.Base(path))
+	if err := fv.WriteConfigAs(pending); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", pending, err)
+	}
+	defer os.Remove(pending)
+	// Written with viper's 0644, or a stale pending file's mode
+	if err := os.Chmod(pending, mode); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", pending, err)
+	}
+
+	// Check the result with the other layers before it replaces the file
+	files := make([]string, 0, len(configNames)+2)
+	for _, layer := range Layers() {
+		if layer != path {
+			files = append(files, layer)
+		}
+	}
+	if _, err := load(append(files, pending), true); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(pending, path); err != nil {
+		return "", fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// ValidateFile checks a config file on its own, over the defaults and
+// without the environment, e.g. before copying it to another machine
+func ValidateFile(path string) (*Config, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return load([]string{path}, false)
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetKeepsFileMode(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// A new file is only for the user
+	path, err := Set("notion.token", "secret_token")
+	if err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("new config file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// An existing file keeps its mode
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Set("backup.interval", "12h"); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("config file mode after Set = %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), ".pending-"+filepath.Base(path))); !os.IsNotExist(err) {
+		t.Errorf("pending file left behind: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// Size is a byte size, written like 512M, 10G or 1.5T (binary units; a
+// plain number is bytes)
+type Size int64
+
+// sizeUnits are the multipliers of the size suffixes
+var sizeUnits = map[string]float64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a size such as "10G", "512MiB" or "1.5T"
+func ParseSize(s string) (Size, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "IB"), "B")
+	number := strings.TrimRight(value, "KMGT")
+	unit := value[len(number):]
+	multiplier, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512M, 10G or 1.5T)", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512M, 10G or 1.5T)", s)
+	}
+	return Size(n * multiplier), nil
+}
+
+// String formats the size with the largest unit that keeps it readable
+func (s Size) String() string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if float64(s) >= sizeUnits[unit] {
+			return strconv.FormatFloat(float64(s)/sizeUnits[unit], 'f', -1, 64) + unit
+		}
+	}
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// Bytes returns the size in bytes
+func (s Size) Bytes() int64 {
+	return int64(s)
+}
+
+// formatDuration formats a duration without trailing zero units ("6h", not "6h0m0s")
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// decodeError flattens mapstructure's multi-line error list to one line
+func decodeError(err error) string {
+	var problems []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "decoding failed") {
+			problems = append(problems, line)
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// decodeHook converts config strings to durations, sizes and lists while
+// unmarshaling, with errors that say what was expected
+func decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			if from.Kind() != reflect.String {
+				return data, nil
+			}
+			switch to {
+			case reflect.TypeOf(time.Duration(0)):
+				d, err := time.ParseDuration(strings.TrimSpace(data.(string)))
+				if err != nil {
+					return nil, fmt.Errorf("invalid duration %q (expected e.g. 90s, 30m or 6h)", data)
+				}
+				return d, nil
+			case reflect.TypeOf(Size(0)):
+				return ParseSize(data.(string))
+			}
+			return data, nil
+		},
+		mapstructure.StringToSliceHookFunc(","),
+	)
+}
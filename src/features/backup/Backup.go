@@ -0,0 +1,463 @@
+/**
+ * Backup
+ * Snapshots the configured directories with restic or borg (see Tools.go)
+ * to a local disk or, with restic, an rclone remote, alongside Google Drive
+ * sync: sync keeps the latest version, snapshots keep the history. Each
+ * backup is followed by pruning to the retention policy, and the repository
+ * is checked on a separate, slower schedule. The outcome of the last backup
+ * and check is kept in the state store for `daemira backup status`.
+ */
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Defaults unless configured otherwise
+const (
+	DefaultInterval      = 24 * time.Hour
+	DefaultCheckInterval = 7 * 24 * time.Hour
+)
+
+// Scheduler jobs
+const (
+	backupJob      = "backup"
+	backupCheckJob = "backup-check"
+)
+
+// backupState is the state store section keeping the last runs
+const backupState = "backup"
+
+// BackupOptions configures backups
+type BackupOptions struct {
+	Tool          string // restic (default) or borg
+	Repository    string // local path, or for restic e.g. rclone:gdrive:backups
+	Password      string
+	Directories   []string
+	Excludes      []string
+	Interval      time.Duration // Default: 24 hours
+	CheckInterval time.Duration // Default: 7 days
+	Retention     Retention
+	State         string // state store section the outcome is saved in; Default: "backup"
+}
+
+// Status is the outcome of the last backup and check
+type Status struct {
+	Tool           string        `json:"tool"`
+	Repository     string        `json:"repository"`
+	Directories    []string      `json:"directories"`
+	Running        bool          `json:"running"`
+	LastRun        time.Time     `json:"lastRun"`
+	LastDuration   time.Duration `json:"lastDuration"`
+	LastSnapshot   string        `json:"lastSnapshot,omitempty"`
+	LastSuccess    time.Time     `json:"lastSuccess"`
+	LastError      string        `json:"lastError,omitempty"`
+	Pruned         int           `json:"pruned"` // snapshots removed after the last backup
+	RunLog         string        `json:"runLog,omitempty"`
+	LastCheck      time.Time     `json:"lastCheck"`
+	LastCheckError string        `json:"lastCheckError,omitempty"`
+	CheckRunLog    string        `json:"checkRunLog,omitempty"`
+	NextBackup     time.Time     `json:"nextBackup"`
+	NextCheck      time.Time     `json:"nextCheck"`
+	Retention      string        `json:"retention"` // e.g. "7 daily, 4 weekly"
+}
+
+// LoadStatus returns the outcome of the last backup and check the daemon
+// saved, without needing the repository's password
+func LoadStatus() Status {
+	return loadStatus(backupState)
+}
+
+// loadStatus returns the outcome saved in a state store section
+func loadStatus(section string) Status {
+	var status Status
+	utility.GetStateStore().Load(section, &status)
+	status.Running = false
+	return status
+}
+
+// Backup snapshots directories to a repository periodically
+type Backup struct {
+	logger        *utility.Logger
+	tool          Tool
+	repository    string
+	directories   []string
+	excludes      []string
+	interval      time.Duration
+	checkInterval time.Duration
+	retention     Retention
+	state         string
+	status        Status
+	isRunning     bool
+	runMu         sync.Mutex // held while a backup, check or restore runs
+	mu            sync.Mutex
+}
+
+// NewBackup creates a Backup of options.Directories to options.Repository
+func NewBackup(logger *utility.Logger, options *BackupOptions) (*Backup, error) {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	if options == nil || options.Repository == "" {
+		return nil, fmt.Errorf("no repository configured (set backup.repository)")
+	}
+
+	tool, err := newTool(options.Tool, options.Repository, options.Password, utility.NewShell(logger))
+	if err != nil {
+		return nil, err
+	}
+
+	directories := make([]string, 0, len(options.Directories))
+	for _, dir := range options.Directories {
+		if strings.HasPrefix(dir, "~") {
+			home, _ := os.UserHomeDir()
+			dir = filepath.Join(home, dir[1:])
+		}
+		directories = append(directories, filepath.Clean(dir))
+	}
+
+	b := &Backup{
+		logger:        logger.With("backup"),
+		tool:          tool,
+		repository:    options.Repository,
+		directories:   directories,
+		excludes:      options.Excludes,
+		interval:      DefaultInterval,
+		checkInterval: DefaultCheckInterval,
+		retention:     options.Retention,
+		state:         backupState,
+	}
+	if options.State != "" {
+		b.state = options.State
+	}
+	if options.Interval > 0 {
+		b.interval = options.Interval
+	}
+	if options.CheckInterval > 0 {
+		b.checkInterval = options.CheckInterval
+	}
+	b.status = loadStatus(b.state)
+	return b, nil
+}
+
+// Tool returns the backup program in use
+func (b *Backup) Tool() string {
+	return b.tool.Name()
+}
+
+// Start backs up now (unless a backup is still recent) and then every
+// interval, and checks the repository every check interval
+func (b *Backup) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.isRunning {
+		b.logger.Warn("Backups already running")
+		return
+	}
+
+	b.isRunning = true
+	b.logger.Info("Starting %s backups of %d directories to %s (interval: %v)", b.tool.Name(), len(b.directories), b.repository, b.interval)
+
+	scheduler := utility.GetScheduler()
+	scheduler.Add(utility.Job{
+		ID:          backupJob,
+		Description: "Back up directories with " + b.tool.Name(),
+		Schedule:    utility.Every(b.interval),
+		Jitter:      10 * time.Minute,
+		RunAtStart:  true,
+		Run:         b.Run,
+	})
+	scheduler.Add(utility.Job{
+		ID:          backupCheckJob,
+		Description: "Check the backup repository",
+		Schedule:    utility.Every(b.checkInterval),
+		Jitter:      30 * time.Minute,
+		Run:         b.Check,
+	})
+}
+
+// Stop halts the periodic backups and checks
+func (b *Backup) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.isRunning {
+		return
+	}
+
+	b.isRunning = false
+	utility.GetScheduler().Remove(backupJob)
+	utility.GetScheduler().Remove(backupCheckJob)
+	b.logger.Info("Backups stopped")
+}
+
+// Shutdown halts the periodic backups and waits, until ctx is done, for a
+// backup or check in progress to finish
+func (b *Backup) Shutdown(ctx context.Context) error {
+	b.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		b.runMu.Lock()
+		b.runMu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("backup still running: %w", ctx.Err())
+	}
+}
+
+// SetInterval changes the backup interval of a running scheduler
+func (b *Backup) SetInterval(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if interval <= 0 || interval == b.interval {
+		return
+	}
+
+	b.interval = interval
+	if b.isRunning {
+		utility.GetScheduler().Reschedule(backupJob, utility.Every(interval))
+	}
+	b.logger.Info("Backup interval changed to %v", interval)
+}
+
+// SetCheckInterval changes how often a running scheduler checks the repository
+func (b *Backup) SetCheckInterval(interval time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if interval <= 0 || interval == b.checkInterval {
+		return
+	}
+
+	b.checkInterval = interval
+	if b.isRunning {
+		utility.GetScheduler().Reschedule(backupCheckJob, utility.Every(interval))
+	}
+	b.logger.Info("Backup check interval changed to %v", interval)
+}
+
+// SetExcludes replaces the patterns left out of the next backups
+func (b *Backup) SetExcludes(excludes []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.excludes = excludes
+}
+
+// SetRetention changes what pruning keeps after the next backups
+func (b *Backup) SetRetention(retention Retention) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.retention = retention
+}
+
+// Init creates the repository
+func (b *Backup) Init(ctx context.Context) error {
+	b.runMu.Lock()
+	defer b.runMu.Unlock()
+
+	b.logger.Info("Initializing %s repository %s", b.tool.Name(), b.repository)
+	if err := b.tool.Init(ctx, nil); err != nil {
+		return fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	return nil
+}
+
+// Run backs up the directories now, then prunes snapshots beyond the
+// retention
+func (b *Backup) Run(ctx context.Context) error {
+	b.runMu.Lock()
+	defer b.runMu.Unlock()
+
+	b.mu.Lock()
+	excludes := append([]string(nil), b.excludes...)
+	retention := b.retention
+	b.status.Running = true
+	b.mu.Unlock()
+
+	// Directories that don't exist (e.g. an unmounted disk) are left out
+	var paths []string
+	for _, dir := range b.directories {
+		if _, err := os.Stat(dir); err != nil {
+			b.logger.Warn("Not backing up %s: %v", dir, err)
+			continue
+		}
+		paths = append(paths, dir)
+	}
+
+	start := time.Now()
+	snapshot, pruned, err := b.backUp(ctx, paths, excludes, retention)
+
+	b.mu.Lock()
+	b.status.Running = false
+	b.status.LastRun = start
+	b.status.LastDuration = time.Since(start)
+	b.status.Pruned = pruned
+	b.status.LastError = ""
+	if snapshot != "" {
+		b.status.LastSnapshot = snapshot
+	}
+	if err != nil {
+		b.status.LastError = err.Error()
+	} else {
+		b.status.LastSuccess = start
+	}
+	saved := b.status
+	b.mu.Unlock()
+	utility.GetStateStore().Save(b.state, saved)
+
+	if err != nil {
+		b.logger.Error("Backup failed: %v", err)
+		return err
+	}
+	b.logger.Info("Backed up %d directories in %s (snapshot %s)", len(paths), time.Since(start).Round(time.Second), snapshot)
+	return nil
+}
+
+// backUp runs the backup and pruning of Run
+func (b *Backup) backUp(ctx context.Context, paths, excludes []string, retention Retention) (snapshot string, pruned int, err error) {
+	if len(paths) == 0 {
+		return "", 0, fmt.Errorf("none of the directories to back up exist")
+	}
+
+	// Keep the machine from suspending mid-backup
+	lock, lockErr := utility.AcquireInhibitor(b.logger, "sleep:shutdown", "Backing up with "+b.tool.Name())
+	if lockErr != nil {
+		b.logger.Debug("Backing up without inhibitor lock: %v", lockErr)
+	}
+	defer lock.Release()
+
+	run, logErr := utility.NewRunLog("backup", b.tool.Name())
+	if logErr != nil {
+		b.logger.Debug("Backing up without run log: %v", logErr)
+	}
+	defer run.Close()
+	b.mu.Lock()
+	b.status.RunLog = run.Path()
+	b.mu.Unlock()
+
+	b.logger.Info("Backing up %s to %s...", strings.Join(paths, ", "), b.repository)
+	if snapshot, err = b.tool.Backup(ctx, paths, excludes, run); err != nil {
+		return "", 0, fmt.Errorf("backup failed: %w", err)
+	}
+
+	if !retention.IsSet() {
+		return snapshot, 0, nil
+	}
+	if pruned, err = b.tool.Prune(ctx, retention, run); err != nil {
+		return snapshot, pruned, fmt.Errorf("pruning old snapshots failed: %w", err)
+	}
+	if pruned > 0 {
+		b.logger.Info("Pruned %d snapshots beyond the retention (%s)", pruned, retention)
+		utility.Audit(utility.AuditDelete, b.repository, fmt.Sprintf("%d %s snapshots pruned beyond the retention (%s)", pruned, b.tool.Name(), retention))
+	}
+	return snapshot, pruned, nil
+}
+
+// Check verifies the repository and a sample of its data
+func (b *Backup) Check(ctx context.Context) error {
+	b.runMu.Lock()
+	defer b.runMu.Unlock()
+
+	run, err := utility.NewRunLog("backup", "check")
+	if err != nil {
+		b.logger.Debug("Checking without run log: %v", err)
+	}
+	defer run.Close()
+
+	b.logger.Info("Checking %s repository %s...", b.tool.Name(), b.repository)
+	start := time.Now()
+	err = b.tool.Check(ctx, run)
+
+	b.mu.Lock()
+	b.status.LastCheck = start
+	b.status.LastCheckError = ""
+	b.status.CheckRunLog = run.Path()
+	if err != nil {
+		b.status.LastCheckError = err.Error()
+	}
+	saved := b.status
+	b.mu.Unlock()
+	utility.GetStateStore().Save(b.state, saved)
+
+	if err != nil {
+		b.logger.Error("Backup repository check failed: %v (see %s)", err, run.Path())
+		return fmt.Errorf("repository check failed: %w", err)
+	}
+	b.logger.Info("Backup repository is healthy")
+	return nil
+}
+
+// Snapshots lists the snapshots in the repository, oldest first
+func (b *Backup) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	snapshots, err := b.tool.Snapshots(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// Restore extracts a snapshot ("latest" for the newest) into target, only
+// the paths in include if any are given. target must be empty unless
+// overwrite is set, so a restore can't mix with live files by accident.
+func (b *Backup) Restore(ctx context.Context, snapshot, target string, include []string, overwrite bool) (string, error) {
+	b.runMu.Lock()
+	defer b.runMu.Unlock()
+
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	if entries, err := os.ReadDir(target); err == nil && len(entries) > 0 && !overwrite {
+		return "", fmt.Errorf("%s is not empty; restore into an empty directory, or overwrite its files with --force", target)
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	run, err := utility.NewRunLog("backup", "restore "+snapshot)
+	if err != nil {
+		b.logger.Debug("Restoring without run log: %v", err)
+	}
+	defer run.Close()
+
+	b.logger.Info("Restoring snapshot %s to %s...", snapshot, target)
+	if err := b.tool.Restore(ctx, snapshot, target, include, run); err != nil {
+		return run.Path(), fmt.Errorf("restore failed: %w", err)
+	}
+	b.logger.Info("Restored snapshot %s to %s", snapshot, target)
+	return run.Path(), nil
+}
+
+// GetStatus returns the outcome of the last backup and check, and when the
+// next ones run
+func (b *Backup) GetStatus() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := b.status
+	status.Tool = b.tool.Name()
+	status.Repository = b.repository
+	status.Directories = b.directories
+	status.Retention = b.retention.String()
+	scheduler := utility.GetScheduler()
+	status.NextBackup = scheduler.NextRun(backupJob)
+	status.NextCheck = scheduler.NextRun(backupCheckJob)
+	return status
+}
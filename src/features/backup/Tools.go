@@ -0,0 +1,413 @@
+/**
+ * Backup tools - restic and borg behind one interface
+ * Both take the repository and its password from the environment
+ * (RESTIC_REPOSITORY/RESTIC_PASSWORD, BORG_REPO/BORG_PASSPHRASE), so neither
+ * shows up in process listings. Snapshots daemira makes are marked (a
+ * restic tag, a borg archive name) and only those are pruned.
+ */
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Backup tool names
+const (
+	ToolRestic = "restic"
+	ToolBorg   = "borg"
+)
+
+// snapshotTag marks the snapshots daemira makes
+const snapshotTag = "daemira"
+
+// listTimeout bounds listing snapshots and their files, which waits for
+// the repository lock and may go over the network
+const listTimeout = 10 * time.Minute
+
+// Snapshot is a backup in the repository
+type Snapshot struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Host  string    `json:"host,omitempty"`
+	Paths []string  `json:"paths,omitempty"`
+}
+
+// Retention is how many snapshots pruning keeps; 0 keeps none of that kind,
+// and with all three 0 nothing is pruned
+type Retention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// IsSet reports whether the retention prunes anything
+func (r Retention) IsSet() bool {
+	return r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0
+}
+
+// String describes the retention, e.g. "7 daily, 4 weekly, 6 monthly"
+func (r Retention) String() string {
+	if !r.IsSet() {
+		return "keep all"
+	}
+	var parts []string
+	for _, keep := range []struct {
+		name  string
+		count int
+	}{{"daily", r.Daily}, {"weekly", r.Weekly}, {"monthly", r.Monthly}} {
+		if keep.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", keep.count, keep.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keepArgs returns the --keep-* flags both tools take
+func (r Retention) keepArgs() []string {
+	var args []string
+	for _, keep := range []struct {
+		flag  string
+		count int
+	}{{"--keep-daily", r.Daily}, {"--keep-weekly", r.Weekly}, {"--keep-monthly", r.Monthly}} {
+		if keep.count > 0 {
+			args = append(args, keep.flag, strconv.Itoa(keep.count))
+		}
+	}
+	return args
+}
+
+// Tool is implemented by each supported backup program
+type Tool interface {
+	// Name returns the program, e.g. "restic"
+	Name() string
+
+	// Init creates the repository
+	Init(ctx context.Context, run *utility.RunLog) error
+
+	// Backup snapshots paths and returns the new snapshot's ID
+	Backup(ctx context.Context, paths, excludes []string, run *utility.RunLog) (string, error)
+
+	// Prune removes daemira's snapshots beyond the retention and returns
+	// how many it removed
+	Prune(ctx context.Context, retention Retention, run *utility.RunLog) (int, error)
+
+	// Check verifies the repository and a sample of its data
+	Check(ctx context.Context, run *utility.RunLog) error
+
+	// Snapshots lists the snapshots, oldest first
+	Snapshots(ctx context.Context) ([]Snapshot, error)
+
+	// Restore extracts a snapshot ("latest" for the newest) into target,
+	// only the paths in include if any are given
+	Restore(ctx context.Context, snapshot, target string, include []string, run *utility.RunLog) error
+}
+
+// newTool returns the tool named name for repository
+func newTool(name, repository, password string, runner utility.CommandRunner) (Tool, error) {
+	switch name {
+	case ToolRestic, "":
+		return &restic{toolRunner{program: ToolRestic, runner: runner, env: map[string]string{
+			"RESTIC_REPOSITORY": repository,
+			"RESTIC_PASSWORD":   password,
+		}}}, nil
+	case ToolBorg:
+		if strings.HasPrefix(repository, "rclone:") {
+			return nil, fmt.Errorf("borg can't write to an rclone remote (%s); use restic, or a local path or ssh:// repository", repository)
+		}
+		return &borg{toolRunner{program: ToolBorg, runner: runner, env: map[string]string{
+			"BORG_REPO":       repository,
+			"BORG_PASSPHRASE": password,
+		}}}, nil
+	}
+	return nil, fmt.Errorf("unknown backup tool %q (must be restic or borg)", name)
+}
+
+// toolRunner runs a backup program against the repository
+type toolRunner struct {
+	program string
+	runner  utility.CommandRunner
+	env     map[string]string
+}
+
+// run runs the program, writing its output to the run log. Exit codes in
+// warnings mean the run went through with some files left out; they are
+// reported in the run log, not as errors.
+func (t *toolRunner) run(ctx context.Context, run *utility.RunLog, args []string, workDir string, warnings ...int) (*utility.Result, error) {
+	run.Println("$ " + utility.CommandLine(append([]string{t.program}, args...)...))
+	result, err := t.runner.ExecuteArgs(ctx, t.program, args, &utility.ExecOptions{
+		// A first backup or a check of a large repository takes hours; ctx
+		// is what stops it
+		Timeout: -1,
+		Env:     t.env,
+		WorkDir: workDir,
+		// Every line is in the run log; the result only needs the errors near the end
+		MaxOutputBytes: 256 << 10,
+		StdoutCallback: run.Println,
+		StderrCallback: run.Println,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", t.program, err)
+	}
+	if result.ExitCode != 0 {
+		for _, code := range warnings {
+			if result.ExitCode == code {
+				run.Println(fmt.Sprintf("%s finished with warnings (exit code %d)", t.program, code))
+				return result, nil
+			}
+		}
+		return result, fmt.Errorf("%s %s failed (exit code %d): %s", t.program, args[0], result.ExitCode, lastLine(result))
+	}
+	return result, nil
+}
+
+// output runs a listing command and returns all of its output
+func (t *toolRunner) output(ctx context.Context, args []string) (string, error) {
+	result, err := t.runner.ExecuteArgs(ctx, t.program, args, &utility.ExecOptions{
+		Timeout:        listTimeout,
+		Env:            t.env,
+		MaxOutputBytes: -1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", t.program, err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("%s %s failed (exit code %d): %s", t.program, args[0], result.ExitCode, lastLine(result))
+	}
+	return result.Stdout, nil
+}
+
+// lastLine returns the last line of a result's error output, or of its output
+func lastLine(result *utility.Result) string {
+	output := strings.TrimSpace(result.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(result.Stdout)
+	}
+	if idx := strings.LastIndex(output, "\n"); idx >= 0 {
+		output = output[idx+1:]
+	}
+	return output
+}
+
+// restic backs up with restic
+type restic struct {
+	toolRunner
+}
+
+var (
+	// resticSnapshotPattern finds the ID of the snapshot a backup saved
+	resticSnapshotPattern = regexp.MustCompile(`snapshot ([0-9a-f]+) saved`)
+	// resticRemovePattern finds how many snapshots forget removes
+	resticRemovePattern = regexp.MustCompile(`remove (\d+) snapshots?`)
+)
+
+func (r *restic) Name() string { return ToolRestic }
+
+func (r *restic) Init(ctx context.Context, run *utility.RunLog) error {
+	_, err := r.run(ctx, run, []string{"init"}, "")
+	return err
+}
+
+func (r *restic) Backup(ctx context.Context, paths, excludes []string, run *utility.RunLog) (string, error) {
+	args := []string{"backup", "--tag", snapshotTag, "--exclude-caches"}
+	for _, pattern := range excludes {
+		args = append(args, "--exclude", pattern)
+	}
+	args = append(args, paths...)
+
+	// Exit code 3: files that couldn't be read were left out of the snapshot
+	result, err := r.run(ctx, run, args, "", 3)
+	if err != nil {
+		return "", err
+	}
+	if match := resticSnapshotPattern.FindStringSubmatch(result.Stdout); match != nil {
+		return match[1], nil
+	}
+	return "", nil
+}
+
+func (r *restic) Prune(ctx context.Context, retention Retention, run *utility.RunLog) (int, error) {
+	args := append([]string{"forget", "--tag", snapshotTag, "--prune"}, retention.keepArgs()...)
+	result, err := r.run(ctx, run, args, "")
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, match := range resticRemovePattern.FindAllStringSubmatch(result.Stdout, -1) {
+		count, _ := strconv.Atoi(match[1])
+		removed += count
+	}
+	return removed, nil
+}
+
+func (r *restic) Check(ctx context.Context, run *utility.RunLog) error {
+	_, err := r.run(ctx, run, []string{"check", "--read-data-subset", "5%"}, "")
+	return err
+}
+
+func (r *restic) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	output, err := r.output(ctx, []string{"snapshots", "--json"})
+	if err != nil {
+		return nil, err
+	}
+	var listed []struct {
+		ShortID  string    `json:"short_id"`
+		Time     time.Time `json:"time"`
+		Hostname string    `json:"hostname"`
+		Paths    []string  `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, fmt.Errorf("failed to parse restic snapshots: %w", err)
+	}
+	snapshots := make([]Snapshot, 0, len(listed))
+	for _, snapshot := range listed {
+		snapshots = append(snapshots, Snapshot{ID: snapshot.ShortID, Time: snapshot.Time, Host: snapshot.Hostname, Paths: snapshot.Paths})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (r *restic) Restore(ctx context.Context, snapshot, target string, include []string, run *utility.RunLog) error {
+	args := []string{"restore", snapshot, "--target", target}
+	for _, path := range include {
+		args = append(args, "--include", path)
+	}
+	_, err := r.run(ctx, run, args, "")
+	return err
+}
+
+// borg backs up with borg
+type borg struct {
+	toolRunner
+}
+
+// borgArchivePattern matches the archives daemira makes; hosts share a
+// repository without pruning each other's archives
+func borgArchivePattern(host string) string {
+	return host + "-" + snapshotTag + "-*"
+}
+
+var (
+	// borgPrunedPattern finds an archive prune removed
+	borgPrunedPattern = regexp.MustCompile(`(?m)^Pruning archive`)
+	// borgStylePattern finds the style prefix of an exclude pattern, e.g. "re:"
+	borgStylePattern = regexp.MustCompile(`^[a-z]{2}:`)
+)
+
+func (b *borg) Name() string { return ToolBorg }
+
+func (b *borg) Init(ctx context.Context, run *utility.RunLog) error {
+	_, err := b.run(ctx, run, []string{"init", "--encryption", "repokey-blake2"}, "")
+	return err
+}
+
+func (b *borg) Backup(ctx context.Context, paths, excludes []string, run *utility.RunLog) (string, error) {
+	host, _ := os.Hostname()
+	archive := fmt.Sprintf("%s-%s-%s", host, snapshotTag, time.Now().Format("2006-01-02T15:04:05"))
+	args := []string{"create", "--stats", "--exclude-caches"}
+	for _, pattern := range excludes {
+		// Shell-style patterns, as restic takes them, unless a style is given
+		if !borgStylePattern.MatchString(pattern) {
+			pattern = "sh:" + pattern
+		}
+		args = append(args, "--exclude", pattern)
+	}
+	args = append(args, "::"+archive)
+	args = append(args, paths...)
+
+	// Exit code 1: files changed or couldn't be read while backing up
+	if _, err := b.run(ctx, run, args, "", 1); err != nil {
+		return "", err
+	}
+	return archive, nil
+}
+
+func (b *borg) Prune(ctx context.Context, retention Retention, run *utility.RunLog) (int, error) {
+	host, _ := os.Hostname()
+	args := append([]string{"prune", "--list", "--glob-archives", borgArchivePattern(host)}, retention.keepArgs()...)
+	result, err := b.run(ctx, run, args, "")
+	if err != nil {
+		return 0, err
+	}
+	// borg lists what it prunes on stderr
+	removed := len(borgPrunedPattern.FindAllString(result.Stderr+"\n"+result.Stdout, -1))
+	if removed > 0 {
+		// Pruned archives only free space once the repository is compacted
+		if _, err := b.run(ctx, run, []string{"compact"}, ""); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func (b *borg) Check(ctx context.Context, run *utility.RunLog) error {
+	_, err := b.run(ctx, run, []string{"check"}, "")
+	return err
+}
+
+func (b *borg) Snapshots(ctx context.Context) ([]Snapshot, error) {
+	output, err := b.output(ctx, []string{"list", "--json"})
+	if err != nil {
+		return nil, err
+	}
+	var listed struct {
+		Archives []struct {
+			Name  string `json:"name"`
+			Start string `json:"start"`
+		} `json:"archives"`
+	}
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, fmt.Errorf("failed to parse borg archives: %w", err)
+	}
+	snapshots := make([]Snapshot, 0, len(listed.Archives))
+	for _, archive := range listed.Archives {
+		// borg gives local times without a zone, e.g. 2024-05-01T03:00:12.000000
+		started, _ := time.ParseInLocation("2006-01-02T15:04:05.999999", archive.Start, time.Local)
+		snapshot := Snapshot{ID: archive.Name, Time: started}
+		if host, _, ok := strings.Cut(archive.Name, "-"+snapshotTag+"-"); ok {
+			snapshot.Host = host
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (b *borg) Restore(ctx context.Context, snapshot, target string, include []string, run *utility.RunLog) error {
+	if snapshot == "latest" {
+		snapshots, err := b.Snapshots(ctx)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			return fmt.Errorf("the repository has no archives")
+		}
+		snapshot = snapshots[len(snapshots)-1].ID
+	}
+
+	// borg extracts into the working directory, and stores paths without
+	// the leading slash
+	args := []string{"extract", "::" + snapshot}
+	for _, path := range include {
+		args = append(args, strings.TrimPrefix(path, "/"))
+	}
+	_, err := b.run(ctx, run, args, target)
+	return err
+}
+
+// sortSnapshots orders snapshots oldest first
+func sortSnapshots(snapshots []Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+}
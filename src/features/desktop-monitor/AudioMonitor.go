@@ -0,0 +1,359 @@
+/**
+ * Audio monitor - sinks, sources and default device switching via pactl
+ *
+ * Works with PulseAudio and PipeWire (pipewire-pulse). When auto-switching is
+ * enabled, the default sink follows the preferred device list, or moves to a
+ * newly connected USB/Bluetooth device (headphones, dock) if no list is set.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// pactlDevice is an entry in `pactl --format=json list sinks|sources`
+type pactlDevice struct {
+	Index       int    `json:"index"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Mute        bool   `json:"mute"`
+	Volume      map[string]struct {
+		ValuePercent string `json:"value_percent"`
+	} `json:"volume"`
+	Properties map[string]interface{} `json:"properties"`
+	Ports      []struct {
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		Availability string `json:"availability"`
+	} `json:"ports"`
+	ActivePort string `json:"active_port"`
+}
+
+// AudioMonitor monitors audio devices
+type AudioMonitor struct {
+	logger    *utility.Logger
+	shell     *utility.Shell
+	preferred []string
+	lastSinks map[string]bool
+	isRunning bool
+	stopChan  chan struct{}
+	ticker    *time.Ticker
+	mu        sync.Mutex
+}
+
+var (
+	audioMonitorInstance *AudioMonitor
+	audioMonitorOnce     sync.Once
+)
+
+// GetAudioMonitor returns the singleton AudioMonitor instance
+func GetAudioMonitor() *AudioMonitor {
+	audioMonitorOnce.Do(func() {
+		audioMonitorInstance = &AudioMonitor{
+			logger: utility.GetLogger().With("audio"),
+			shell:  utility.NewShell(utility.GetLogger()),
+		}
+	})
+	return audioMonitorInstance
+}
+
+// IsAvailable checks if pactl can reach a sound server
+func (am *AudioMonitor) IsAvailable(ctx context.Context) bool {
+	result, err := am.shell.Execute(ctx, "pactl info", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	return err == nil && result.ExitCode == 0
+}
+
+// pactl runs a pactl command and returns stdout
+func (am *AudioMonitor) pactl(ctx context.Context, args string) (string, error) {
+	result, err := am.shell.Execute(ctx, "pactl "+args, &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return "", fmt.Errorf("pactl %s failed: %w", args, err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("pactl %s failed: %s", args, result.Stderr)
+	}
+	return result.Stdout, nil
+}
+
+// listDevices lists sinks or sources
+func (am *AudioMonitor) listDevices(ctx context.Context, kind string) ([]AudioDevice, error) {
+	output, err := am.pactl(ctx, fmt.Sprintf("--format=json list %ss", kind))
+	if err != nil {
+		return []AudioDevice{}, err
+	}
+
+	var raw []pactlDevice
+	if err := json.Unmarshal([]byte(output), &raw); err != nil {
+		return []AudioDevice{}, fmt.Errorf("failed to parse pactl output: %w", err)
+	}
+
+	defaultName, _ := am.pactl(ctx, fmt.Sprintf("get-default-%s", kind))
+	defaultName = strings.TrimSpace(defaultName)
+
+	devices := make([]AudioDevice, 0, len(raw))
+	for _, d := range raw {
+		// Skip sink monitors in the source list
+		if kind == "source" && strings.HasSuffix(d.Name, ".monitor") {
+			continue
+		}
+
+		device := AudioDevice{
+			Index:       d.Index,
+			Name:        d.Name,
+			Description: d.Description,
+			Kind:        kind,
+			Muted:       d.Mute,
+			IsDefault:   d.Name == defaultName,
+			ActivePort:  d.ActivePort,
+		}
+		if bus, ok := d.Properties["device.bus"].(string); ok {
+			device.Bus = bus
+		}
+
+		// Average the channel volumes
+		total, channels := 0, 0
+		for _, channel := range d.Volume {
+			if percent, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(channel.ValuePercent), "%")); err == nil {
+				total += percent
+				channels++
+			}
+		}
+		if channels > 0 {
+			device.VolumePercent = total / channels
+		}
+
+		for _, port := range d.Ports {
+			if port.Availability != "not available" {
+				device.Ports = append(device.Ports, port.Name)
+			}
+		}
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Index < devices[j].Index
+	})
+	return devices, nil
+}
+
+// GetSinks lists output devices
+func (am *AudioMonitor) GetSinks(ctx context.Context) ([]AudioDevice, error) {
+	return am.listDevices(ctx, "sink")
+}
+
+// GetSources lists input devices
+func (am *AudioMonitor) GetSources(ctx context.Context) ([]AudioDevice, error) {
+	return am.listDevices(ctx, "source")
+}
+
+// findDevice resolves a sink by index, exact name, or description/name substring
+func findDevice(devices []AudioDevice, query string) (*AudioDevice, error) {
+	for i := range devices {
+		if devices[i].Name == query || strconv.Itoa(devices[i].Index) == query {
+			return &devices[i], nil
+		}
+	}
+
+	var matches []*AudioDevice
+	lower := strings.ToLower(query)
+	for i := range devices {
+		if strings.Contains(strings.ToLower(devices[i].Description), lower) || strings.Contains(strings.ToLower(devices[i].Name), lower) {
+			matches = append(matches, &devices[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no device matching %q", query)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%q matches %d devices, be more specific", query, len(matches))
+}
+
+// SetDefaultSink makes a sink the default and moves playing streams to it
+func (am *AudioMonitor) SetDefaultSink(ctx context.Context, query string) (*AudioDevice, error) {
+	sinks, err := am.GetSinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := findDevice(sinks, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := am.pactl(ctx, fmt.Sprintf("set-default-sink '%s'", sink.Name)); err != nil {
+		return nil, err
+	}
+
+	// Move existing streams so playback follows the new default
+	if inputs, err := am.pactl(ctx, "list short sink-inputs"); err == nil {
+		for _, line := range strings.Split(inputs, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			if _, err := am.pactl(ctx, fmt.Sprintf("move-sink-input %s '%s'", fields[0], sink.Name)); err != nil {
+				am.logger.Debug("Failed to move stream %s: %v", fields[0], err)
+			}
+		}
+	}
+
+	am.logger.Info("Default audio output set to %s", sink.Description)
+	return sink, nil
+}
+
+// StartAutoSwitch polls sinks and switches the default when preferred or external devices appear
+func (am *AudioMonitor) StartAutoSwitch(preferred []string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if am.isRunning {
+		am.logger.Warn("Audio auto-switch already running")
+		return
+	}
+
+	am.preferred = preferred
+	am.isRunning = true
+	am.stopChan = make(chan struct{})
+	am.ticker = time.NewTicker(5 * time.Second)
+	am.logger.Info("Starting audio auto-switch (preferred: %s)", strings.Join(preferred, ", "))
+
+	go utility.Supervise("audio-monitor", func() {
+		for {
+			select {
+			case <-am.ticker.C:
+				am.checkSinks(context.Background())
+			case <-am.stopChan:
+				return
+			}
+		}
+	})
+}
+
+// SetPreferred replaces the preferred device list used by auto-switching
+func (am *AudioMonitor) SetPreferred(preferred []string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.preferred = preferred
+	am.logger.Info("Preferred audio outputs: %s", strings.Join(preferred, ", "))
+}
+
+// StopAutoSwitch halts the auto-switch poller
+func (am *AudioMonitor) StopAutoSwitch() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if !am.isRunning {
+		return
+	}
+
+	am.isRunning = false
+	am.ticker.Stop()
+	close(am.stopChan)
+}
+
+// checkSinks switches the default sink when the set of sinks changes
+func (am *AudioMonitor) checkSinks(ctx context.Context) {
+	sinks, err := am.GetSinks(ctx)
+	if err != nil {
+		return
+	}
+
+	current := make(map[string]bool, len(sinks))
+	var added []AudioDevice
+	var defaultSink *AudioDevice
+	am.mu.Lock()
+	first := am.lastSinks == nil
+	for i, sink := range sinks {
+		current[sink.Name] = true
+		if !first && !am.lastSinks[sink.Name] {
+			added = append(added, sink)
+		}
+		if sink.IsDefault {
+			defaultSink = &sinks[i]
+		}
+	}
+	am.lastSinks = current
+	preferred := am.preferred
+	am.mu.Unlock()
+
+	if first || len(added) == 0 {
+		return
+	}
+
+	target := am.pickSink(sinks, added, preferred)
+	if target == nil || (defaultSink != nil && defaultSink.Name == target.Name) {
+		return
+	}
+
+	am.logger.Info("Audio device connected, switching output to %s", target.Description)
+	if _, err := am.SetDefaultSink(ctx, target.Name); err != nil {
+		am.logger.Error("Failed to switch audio output: %v", err)
+	}
+}
+
+// pickSink chooses the best sink: the highest-priority preferred one, else a newly added external device
+func (am *AudioMonitor) pickSink(sinks, added []AudioDevice, preferred []string) *AudioDevice {
+	for _, want := range preferred {
+		if sink, err := findDevice(sinks, want); err == nil {
+			return sink
+		}
+	}
+	if len(preferred) > 0 {
+		return nil
+	}
+
+	for i := range added {
+		if added[i].Bus == "usb" || added[i].Bus == "bluetooth" {
+			return &added[i]
+		}
+	}
+	return nil
+}
+
+// FormatAudioDevices formats sinks and sources for display
+func (am *AudioMonitor) FormatAudioDevices(sinks, sources []AudioDevice) string {
+	formatList := func(title string, devices []AudioDevice) []string {
+		lines := []string{title}
+		if len(devices) == 0 {
+			return append(lines, "  (none)")
+		}
+		for _, d := range devices {
+			marker := " "
+			if d.IsDefault {
+				marker = "*"
+			}
+			muted := ""
+			if d.Muted {
+				muted = " [muted]"
+			}
+			bus := ""
+			if d.Bus != "" {
+				bus = fmt.Sprintf(" (%s)", d.Bus)
+			}
+			lines = append(lines, fmt.Sprintf("%s %d. %s%s - %d%%%s", marker, d.Index, d.Description, bus, d.VolumePercent, muted))
+			lines = append(lines, fmt.Sprintf("      %s", d.Name))
+		}
+		return lines
+	}
+
+	lines := formatList("Outputs (sinks):", sinks)
+	lines = append(lines, "")
+	lines = append(lines, formatList("Inputs (sources):", sources)...)
+	return strings.Join(lines, "\n")
+}
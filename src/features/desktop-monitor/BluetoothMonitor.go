@@ -0,0 +1,251 @@
+/**
+ * Bluetooth monitor - paired devices, battery levels and quick connect via bluetoothctl
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// BluetoothMonitor monitors Bluetooth devices
+type BluetoothMonitor struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+	mu     sync.Mutex
+}
+
+var (
+	bluetoothMonitorInstance *BluetoothMonitor
+	bluetoothMonitorOnce     sync.Once
+
+	// bluetoothDeviceLine matches "Device AA:BB:CC:DD:EE:FF Name"
+	bluetoothDeviceLine = regexp.MustCompile(`^Device\s+([0-9A-Fa-f:]{17})\s+(.*)$`)
+	// bluetoothBattery matches "Battery Percentage: 0x5a (90)"
+	bluetoothBattery = regexp.MustCompile(`\((\d+)\)`)
+)
+
+// GetBluetoothMonitor returns the singleton BluetoothMonitor instance
+func GetBluetoothMonitor() *BluetoothMonitor {
+	bluetoothMonitorOnce.Do(func() {
+		bluetoothMonitorInstance = &BluetoothMonitor{
+			logger: utility.GetLogger().With("bluetooth"),
+			shell:  utility.NewShell(utility.GetLogger()),
+		}
+	})
+	return bluetoothMonitorInstance
+}
+
+// bluetoothctl runs a bluetoothctl command and returns stdout
+func (bm *BluetoothMonitor) bluetoothctl(ctx context.Context, args string, timeout time.Duration) (string, error) {
+	result, err := bm.shell.Execute(ctx, "bluetoothctl "+args, &utility.ExecOptions{
+		Timeout: timeout,
+	})
+	if err != nil {
+		return "", fmt.Errorf("bluetoothctl %s failed: %w", args, err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("bluetoothctl %s failed: %s", args, strings.TrimSpace(result.Stdout+" "+result.Stderr))
+	}
+	return result.Stdout, nil
+}
+
+// IsPowered checks if the default adapter is present and powered on
+func (bm *BluetoothMonitor) IsPowered(ctx context.Context) bool {
+	output, err := bm.bluetoothctl(ctx, "show", 5*time.Second)
+	return err == nil && strings.Contains(output, "Powered: yes")
+}
+
+// GetDevices lists paired devices with their connection state and battery level
+func (bm *BluetoothMonitor) GetDevices(ctx context.Context) ([]BluetoothDevice, error) {
+	output, err := bm.bluetoothctl(ctx, "devices Paired", 5*time.Second)
+	if err != nil || strings.TrimSpace(output) == "" {
+		// bluetoothctl < 5.65 only has paired-devices
+		output, err = bm.bluetoothctl(ctx, "paired-devices", 5*time.Second)
+		if err != nil {
+			return []BluetoothDevice{}, err
+		}
+	}
+
+	devices := []BluetoothDevice{}
+	for _, line := range strings.Split(output, "\n") {
+		matches := bluetoothDeviceLine.FindStringSubmatch(strings.TrimSpace(line))
+		if len(matches) != 3 {
+			continue
+		}
+
+		device, err := bm.GetDeviceInfo(ctx, matches[1])
+		if err != nil {
+			device = &BluetoothDevice{Address: matches[1], Name: matches[2], Paired: true, Battery: -1}
+		}
+		devices = append(devices, *device)
+	}
+	return devices, nil
+}
+
+// GetDeviceInfo reads the state of a single device
+func (bm *BluetoothMonitor) GetDeviceInfo(ctx context.Context, address string) (*BluetoothDevice, error) {
+	output, err := bm.bluetoothctl(ctx, "info "+address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	device := &BluetoothDevice{Address: address, Battery: -1}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "Name":
+			device.Name = value
+		case "Icon":
+			device.Icon = value
+		case "Paired":
+			device.Paired = value == "yes"
+		case "Trusted":
+			device.Trusted = value == "yes"
+		case "Connected":
+			device.Connected = value == "yes"
+		case "Battery Percentage":
+			if matches := bluetoothBattery.FindStringSubmatch(value); len(matches) == 2 {
+				device.Battery, _ = strconv.Atoi(matches[1])
+			}
+		}
+	}
+	return device, nil
+}
+
+// findDevice resolves a paired device by address or (partial, case-insensitive) name
+func (bm *BluetoothMonitor) findDevice(ctx context.Context, query string) (*BluetoothDevice, error) {
+	devices, err := bm.GetDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*BluetoothDevice
+	lower := strings.ToLower(query)
+	for i := range devices {
+		if strings.EqualFold(devices[i].Address, query) || strings.EqualFold(devices[i].Name, query) {
+			return &devices[i], nil
+		}
+		if strings.Contains(strings.ToLower(devices[i].Name), lower) {
+			matches = append(matches, &devices[i])
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no paired device matching %q", query)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%q matches %d devices, be more specific", query, len(matches))
+}
+
+// Connect connects to a paired device by address or name
+func (bm *BluetoothMonitor) Connect(ctx context.Context, query string) (*BluetoothDevice, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	device, err := bm.findDevice(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if device.Connected {
+		return device, nil
+	}
+
+	output, err := bm.bluetoothctl(ctx, "connect "+device.Address, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(output, "Connection successful") {
+		return nil, fmt.Errorf("failed to connect to %s", device.Name)
+	}
+
+	device.Connected = true
+	bm.logger.Info("Connected to Bluetooth device %s", device.Name)
+	return device, nil
+}
+
+// Disconnect disconnects a device by address or name
+func (bm *BluetoothMonitor) Disconnect(ctx context.Context, query string) (*BluetoothDevice, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	device, err := bm.findDevice(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := bm.bluetoothctl(ctx, "disconnect "+device.Address, 15*time.Second); err != nil {
+		return nil, err
+	}
+
+	device.Connected = false
+	bm.logger.Info("Disconnected Bluetooth device %s", device.Name)
+	return device, nil
+}
+
+// ReconnectFavorites connects favorite devices that are not yet connected, retrying while they come into range
+func (bm *BluetoothMonitor) ReconnectFavorites(ctx context.Context, favorites []string, attempts int) {
+	pending := append([]string(nil), favorites...)
+
+	for attempt := 1; attempt <= attempts && len(pending) > 0; attempt++ {
+		if bm.IsPowered(ctx) {
+			remaining := []string{}
+			for _, favorite := range pending {
+				if _, err := bm.Connect(ctx, favorite); err != nil {
+					bm.logger.Debug("Reconnect %s (attempt %d/%d): %v", favorite, attempt, attempts, err)
+					remaining = append(remaining, favorite)
+				}
+			}
+			pending = remaining
+		}
+		if len(pending) == 0 {
+			return
+		}
+
+		select {
+		case <-time.After(30 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if len(pending) > 0 {
+		bm.logger.Info("Could not reconnect Bluetooth devices: %s", strings.Join(pending, ", "))
+	}
+}
+
+// FormatDevices formats devices for display
+func (bm *BluetoothMonitor) FormatDevices(devices []BluetoothDevice) string {
+	if len(devices) == 0 {
+		return "No paired Bluetooth devices"
+	}
+
+	lines := []string{"Bluetooth Devices:"}
+	for _, d := range devices {
+		state := "disconnected"
+		if d.Connected {
+			state = "connected"
+		}
+		line := fmt.Sprintf("  %s [%s] - %s", d.Name, d.Address, state)
+		if d.Battery >= 0 {
+			line += fmt.Sprintf(", battery %d%%", d.Battery)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,109 @@
+/**
+ * Compositor backend - abstraction over compositor IPC (hyprctl, swaymsg, niri msg)
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"os"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// CompositorBackend is implemented by each supported compositor
+type CompositorBackend interface {
+	// Type returns the compositor type handled by this backend
+	Type() CompositorType
+
+	// IsAvailable checks if the compositor is running in this session
+	IsAvailable() bool
+
+	// GetCompositorInfo gets compositor name and version information
+	GetCompositorInfo(ctx context.Context) (*CompositorInfo, error)
+
+	// GetWorkspaces gets all workspaces
+	GetWorkspaces(ctx context.Context) ([]WorkspaceInfo, error)
+
+	// GetWindows gets all windows
+	GetWindows(ctx context.Context) ([]WindowInfo, error)
+
+	// GetActiveWindow gets the focused window, or nil if none
+	GetActiveWindow(ctx context.Context) (*WindowInfo, error)
+
+	// GetMonitors gets all outputs
+	GetMonitors(ctx context.Context) ([]MonitorInfo, error)
+}
+
+// detectCompositorType detects the running compositor from its IPC environment variables
+func detectCompositorType() CompositorType {
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+		return CompositorTypeHyprland
+	}
+	if os.Getenv("NIRI_SOCKET") != "" {
+		return CompositorTypeNiri
+	}
+	if os.Getenv("SWAYSOCK") != "" {
+		return CompositorTypeSway
+	}
+	if os.Getenv("I3SOCK") != "" {
+		return CompositorTypeI3
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return CompositorTypeWayland
+	}
+	return CompositorTypeUnknown
+}
+
+// newCompositorBackend returns the backend for the detected compositor.
+// Unknown Wayland compositors fall back to the generic Wayland backend;
+// returns nil outside of a graphical session.
+func newCompositorBackend(logger *utility.Logger, shell *utility.Shell) CompositorBackend {
+	switch detectCompositorType() {
+	case CompositorTypeHyprland:
+		return NewHyprlandBackend(logger, shell)
+	case CompositorTypeNiri:
+		return NewNiriBackend(logger, shell)
+	case CompositorTypeSway:
+		return NewSwayBackend(logger, shell, false)
+	case CompositorTypeI3:
+		return NewSwayBackend(logger, shell, true)
+	default:
+		wayland := NewWaylandBackend(logger, shell)
+		if wayland.IsAvailable() {
+			return wayland
+		}
+		return nil
+	}
+}
+
+// OutputConfigurator is implemented by backends that can reconfigure outputs at runtime
+type OutputConfigurator interface {
+	// ConfigureOutput applies mode, position, scale and transform to a single output
+	ConfigureOutput(ctx context.Context, layout OutputLayout) error
+}
+
+// WindowEventSource is implemented by backends that can stream window-open events
+type WindowEventSource interface {
+	// SubscribeWindowEvents calls handler for every newly opened window until ctx is cancelled
+	SubscribeWindowEvents(ctx context.Context, handler func(WindowInfo)) error
+}
+
+// WindowDispatcher is implemented by backends that can move and float windows
+type WindowDispatcher interface {
+	// MoveWindowToWorkspace moves a window to the named workspace without following it
+	MoveWindowToWorkspace(ctx context.Context, window WindowInfo, workspace string) error
+
+	// SetWindowFloating toggles a window between floating and tiled
+	SetWindowFloating(ctx context.Context, window WindowInfo, floating bool) error
+}
+
+// WorkspaceMover is implemented by backends that can move workspaces between outputs
+type WorkspaceMover interface {
+	MoveWorkspaceToOutput(ctx context.Context, workspace WorkspaceInfo, output string) error
+}
+
+// PowerController is implemented by backends that can power outputs on and off (DPMS)
+type PowerController interface {
+	SetOutputsPower(ctx context.Context, on bool) error
+}
@@ -1,27 +1,25 @@
 /**
- * Compositor monitor - monitors Hyprland compositor state
+ * Compositor monitor - monitors compositor state (Hyprland, Sway, i3, niri)
  */
 
 package desktopmonitor
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/ln64-git/daemira/src/utility"
 )
 
-// CompositorMonitor monitors Hyprland compositor state
+// CompositorMonitor monitors compositor state through the detected backend
 type CompositorMonitor struct {
-	logger *utility.Logger
-	shell  *utility.Shell
-	mu     sync.RWMutex
+	logger  *utility.Logger
+	shell   *utility.Shell
+	backend CompositorBackend
+	mu      sync.RWMutex
 }
 
 var (
@@ -32,17 +30,25 @@ var (
 // GetCompositorMonitor returns the singleton CompositorMonitor instance
 func GetCompositorMonitor() *CompositorMonitor {
 	compositorMonitorOnce.Do(func() {
+		logger := utility.GetLogger()
+		shell := utility.NewShell(logger)
 		compositorMonitorInstance = &CompositorMonitor{
-			logger: utility.GetLogger(),
-			shell:  utility.NewShell(utility.GetLogger()),
+			logger:  logger,
+			shell:   shell,
+			backend: newCompositorBackend(logger, shell),
 		}
 	})
 	return compositorMonitorInstance
 }
 
-// IsAvailable checks if Hyprland is available
+// Backend returns the active compositor backend, or nil if the compositor is unsupported
+func (cm *CompositorMonitor) Backend() CompositorBackend {
+	return cm.backend
+}
+
+// IsAvailable checks if a supported compositor is available
 func (cm *CompositorMonitor) IsAvailable() bool {
-	return os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != ""
+	return cm.backend != nil && cm.backend.IsAvailable()
 }
 
 // GetCompositorInfo gets compositor information
@@ -55,63 +61,7 @@ func (cm *CompositorMonitor) GetCompositorInfo(ctx context.Context) (*Compositor
 		}, nil
 	}
 
-	result, err := cm.shell.Execute(ctx, "hyprctl version -j", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-
-	if err != nil || result.ExitCode != 0 {
-		cm.logger.Error("hyprctl version failed: %v", err)
-		return &CompositorInfo{
-			Name:      "Hyprland",
-			Version:   "unknown",
-			Available: false,
-		}, nil
-	}
-
-	var versionData map[string]interface{}
-	if err := json.Unmarshal([]byte(result.Stdout), &versionData); err != nil {
-		cm.logger.Error("Error parsing version JSON: %v", err)
-		return &CompositorInfo{
-			Name:      "Hyprland",
-			Version:   "unknown",
-			Available: false,
-		}, nil
-	}
-
-	version := "unknown"
-	if tag, ok := versionData["tag"].(string); ok && tag != "" {
-		version = tag
-	} else if commit, ok := versionData["commit"].(string); ok && commit != "" {
-		if len(commit) > 7 {
-			version = commit[:7]
-		} else {
-			version = commit
-		}
-	}
-
-	branch := ""
-	if b, ok := versionData["branch"].(string); ok {
-		branch = b
-	}
-
-	commit := ""
-	if c, ok := versionData["commit"].(string); ok {
-		commit = c
-	}
-
-	buildDate := ""
-	if d, ok := versionData["date"].(string); ok {
-		buildDate = d
-	}
-
-	return &CompositorInfo{
-		Name:      "Hyprland",
-		Version:   version,
-		Available: true,
-		Branch:    branch,
-		Commit:    commit,
-		BuildDate: buildDate,
-	}, nil
+	return cm.backend.GetCompositorInfo(ctx)
 }
 
 // GetWorkspaces gets all workspaces
@@ -120,22 +70,7 @@ func (cm *CompositorMonitor) GetWorkspaces(ctx context.Context) ([]WorkspaceInfo
 		return []WorkspaceInfo{}, nil
 	}
 
-	result, err := cm.shell.Execute(ctx, "hyprctl workspaces -j", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-
-	if err != nil || result.ExitCode != 0 {
-		cm.logger.Error("hyprctl workspaces failed: %v", err)
-		return []WorkspaceInfo{}, err
-	}
-
-	var workspaces []WorkspaceInfo
-	if err := json.Unmarshal([]byte(result.Stdout), &workspaces); err != nil {
-		cm.logger.Error("Error parsing workspaces JSON: %v", err)
-		return []WorkspaceInfo{}, err
-	}
-
-	return workspaces, nil
+	return cm.backend.GetWorkspaces(ctx)
 }
 
 // GetActiveWindow gets the active window
@@ -144,24 +79,7 @@ func (cm *CompositorMonitor) GetActiveWindow(ctx context.Context) (*WindowInfo,
 		return nil, nil
 	}
 
-	result, err := cm.shell.Execute(ctx, "hyprctl activewindow -j", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-
-	if err != nil || result.ExitCode != 0 {
-		return nil, nil
-	}
-
-	var window WindowInfo
-	if err := json.Unmarshal([]byte(result.Stdout), &window); err != nil {
-		return nil, nil
-	}
-
-	if window.Address == "" || window.Address == "0x" {
-		return nil, nil
-	}
-
-	return &window, nil
+	return cm.backend.GetActiveWindow(ctx)
 }
 
 // GetWindows gets all windows
@@ -170,22 +88,7 @@ func (cm *CompositorMonitor) GetWindows(ctx context.Context) ([]WindowInfo, erro
 		return []WindowInfo{}, nil
 	}
 
-	result, err := cm.shell.Execute(ctx, "hyprctl clients -j", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-
-	if err != nil || result.ExitCode != 0 {
-		cm.logger.Error("hyprctl clients failed: %v", err)
-		return []WindowInfo{}, err
-	}
-
-	var windows []WindowInfo
-	if err := json.Unmarshal([]byte(result.Stdout), &windows); err != nil {
-		cm.logger.Error("Error parsing windows JSON: %v", err)
-		return []WindowInfo{}, err
-	}
-
-	return windows, nil
+	return cm.backend.GetWindows(ctx)
 }
 
 // GetWindowCount gets the number of windows
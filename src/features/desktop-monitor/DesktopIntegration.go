@@ -32,7 +32,7 @@ var (
 func GetDesktopIntegration() *DesktopIntegration {
 	desktopIntegrationOnce.Do(func() {
 		desktopIntegrationInstance = &DesktopIntegration{
-			logger:            utility.GetLogger(),
+			logger:            utility.GetLogger().With("desktop"),
 			sessionMonitor:    GetSessionMonitor(),
 			compositorMonitor: GetCompositorMonitor(),
 			displayMonitor:    GetDisplayMonitor(),
@@ -43,19 +43,7 @@ func GetDesktopIntegration() *DesktopIntegration {
 
 // DetectCompositor detects the compositor type
 func (di *DesktopIntegration) DetectCompositor() CompositorType {
-	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
-		return CompositorTypeHyprland
-	}
-	if os.Getenv("NIRI_SOCKET") != "" {
-		return CompositorTypeNiri
-	}
-	if os.Getenv("SWAYSOCK") != "" {
-		return CompositorTypeSway
-	}
-	if os.Getenv("I3SOCK") != "" {
-		return CompositorTypeI3
-	}
-	return CompositorTypeUnknown
+	return detectCompositorType()
 }
 
 // IsDesktopMonitoringAvailable checks if desktop monitoring is available
@@ -6,21 +6,19 @@ package desktopmonitor
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/ln64-git/daemira/src/utility"
 )
 
 // DisplayMonitor monitors display/monitor information
 type DisplayMonitor struct {
-	logger *utility.Logger
-	shell  *utility.Shell
-	mu     sync.RWMutex
+	logger  *utility.Logger
+	shell   *utility.Shell
+	backend CompositorBackend
+	mu      sync.RWMutex
 }
 
 var (
@@ -31,17 +29,20 @@ var (
 // GetDisplayMonitor returns the singleton DisplayMonitor instance
 func GetDisplayMonitor() *DisplayMonitor {
 	displayMonitorOnce.Do(func() {
+		logger := utility.GetLogger()
+		shell := utility.NewShell(logger)
 		displayMonitorInstance = &DisplayMonitor{
-			logger: utility.GetLogger(),
-			shell:  utility.NewShell(utility.GetLogger()),
+			logger:  logger,
+			shell:   shell,
+			backend: newCompositorBackend(logger, shell),
 		}
 	})
 	return displayMonitorInstance
 }
 
-// IsAvailable checks if Hyprland is available
+// IsAvailable checks if a supported compositor is available
 func (dm *DisplayMonitor) IsAvailable() bool {
-	return os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != ""
+	return dm.backend != nil && dm.backend.IsAvailable()
 }
 
 // GetMonitors gets all monitors
@@ -50,22 +51,7 @@ func (dm *DisplayMonitor) GetMonitors(ctx context.Context) ([]MonitorInfo, error
 		return []MonitorInfo{}, nil
 	}
 
-	result, err := dm.shell.Execute(ctx, "hyprctl monitors -j", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-
-	if err != nil || result.ExitCode != 0 {
-		dm.logger.Error("hyprctl monitors failed: %v", err)
-		return []MonitorInfo{}, err
-	}
-
-	var monitors []MonitorInfo
-	if err := json.Unmarshal([]byte(result.Stdout), &monitors); err != nil {
-		dm.logger.Error("Error parsing monitors JSON: %v", err)
-		return []MonitorInfo{}, err
-	}
-
-	return monitors, nil
+	return dm.backend.GetMonitors(ctx)
 }
 
 // GetPrimaryMonitor gets the primary/active monitor
@@ -0,0 +1,398 @@
+/**
+ * Display profiles - save and reapply monitor layouts
+ *
+ * Profiles are stored in $XDG_CONFIG_HOME/daemira/display-profiles.json.
+ * Monitors are identified by make/model/serial so a profile still matches
+ * when connector names change between docks. When the watcher is running,
+ * a profile is applied automatically as soon as its monitor set is connected
+ * (e.g. "docked" vs "undocked").
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// OutputLayout is the saved configuration of a single monitor
+type OutputLayout struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Make        string  `json:"make,omitempty"`
+	Model       string  `json:"model,omitempty"`
+	Serial      string  `json:"serial,omitempty"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	RefreshRate float64 `json:"refresh_rate"`
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Scale       float64 `json:"scale"`
+	Transform   int     `json:"transform"`
+}
+
+// DisplayProfile is a named set of monitor layouts
+type DisplayProfile struct {
+	Name      string         `json:"name"`
+	Outputs   []OutputLayout `json:"outputs"`
+	AutoApply bool           `json:"auto_apply"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// DisplayProfileManager saves, applies and auto-applies display profiles
+type DisplayProfileManager struct {
+	logger        *utility.Logger
+	display       *DisplayMonitor
+	path          string
+	lastSignature string
+	isRunning     bool
+	stopChan      chan struct{}
+	ticker        *time.Ticker
+	mu            sync.Mutex
+}
+
+var (
+	displayProfileManagerInstance *DisplayProfileManager
+	displayProfileManagerOnce     sync.Once
+)
+
+// GetDisplayProfileManager returns the singleton DisplayProfileManager instance
+func GetDisplayProfileManager() *DisplayProfileManager {
+	displayProfileManagerOnce.Do(func() {
+		displayProfileManagerInstance = &DisplayProfileManager{
+			logger:  utility.GetLogger().With("display-profiles"),
+			display: GetDisplayMonitor(),
+			path:    filepath.Join(utility.ConfigDir(), "display-profiles.json"),
+		}
+	})
+	return displayProfileManagerInstance
+}
+
+// outputIdentity returns a stable identifier for a monitor
+func outputIdentity(name, manufacturer, model, serial string) string {
+	if manufacturer == "" && model == "" && serial == "" {
+		return name
+	}
+	return strings.Join([]string{manufacturer, model, serial}, "|")
+}
+
+// signature returns a sorted key describing a set of monitors
+func signature(identities []string) string {
+	sorted := append([]string(nil), identities...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ";")
+}
+
+// monitorSignature returns the signature of the currently connected monitors
+func monitorSignature(monitors []MonitorInfo) string {
+	identities := make([]string, 0, len(monitors))
+	for _, m := range monitors {
+		identities = append(identities, outputIdentity(m.Name, m.Make, m.Model, m.Serial))
+	}
+	return signature(identities)
+}
+
+// Signature returns the monitor set signature this profile matches
+func (p *DisplayProfile) Signature() string {
+	identities := make([]string, 0, len(p.Outputs))
+	for _, o := range p.Outputs {
+		identities = append(identities, outputIdentity(o.Name, o.Make, o.Model, o.Serial))
+	}
+	return signature(identities)
+}
+
+// load reads all profiles from disk
+func (pm *DisplayProfileManager) load() (map[string]*DisplayProfile, error) {
+	profiles := make(map[string]*DisplayProfile)
+
+	data, err := os.ReadFile(pm.path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read display profiles: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse display profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// store writes all profiles to disk
+func (pm *DisplayProfileManager) store(profiles map[string]*DisplayProfile) error {
+	if _, err := utility.EnsureDir(filepath.Dir(pm.path)); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode display profiles: %w", err)
+	}
+
+	if err := os.WriteFile(pm.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write display profiles: %w", err)
+	}
+	return nil
+}
+
+// Save captures the current monitor layout under the given name
+func (pm *DisplayProfileManager) Save(ctx context.Context, name string) (*DisplayProfile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("profile name is required")
+	}
+	if !pm.display.IsAvailable() {
+		return nil, fmt.Errorf("no supported compositor detected")
+	}
+
+	monitors, err := pm.display.GetMonitors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read monitors: %w", err)
+	}
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no monitors detected")
+	}
+
+	profile := &DisplayProfile{
+		Name:      name,
+		Outputs:   make([]OutputLayout, 0, len(monitors)),
+		AutoApply: true,
+		CreatedAt: time.Now(),
+	}
+	for _, m := range monitors {
+		profile.Outputs = append(profile.Outputs, OutputLayout{
+			Name:        m.Name,
+			Description: m.Description,
+			Make:        m.Make,
+			Model:       m.Model,
+			Serial:      m.Serial,
+			Width:       m.Width,
+			Height:      m.Height,
+			RefreshRate: m.RefreshRate,
+			X:           m.X,
+			Y:           m.Y,
+			Scale:       m.Scale,
+			Transform:   m.Transform,
+		})
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	profiles, err := pm.load()
+	if err != nil {
+		return nil, err
+	}
+	profiles[name] = profile
+	if err := pm.store(profiles); err != nil {
+		return nil, err
+	}
+
+	pm.lastSignature = profile.Signature()
+	pm.logger.Info("Saved display profile %q (%d outputs)", name, len(profile.Outputs))
+	return profile, nil
+}
+
+// Apply reconfigures the connected monitors according to the named profile
+func (pm *DisplayProfileManager) Apply(ctx context.Context, name string) error {
+	pm.mu.Lock()
+	profiles, err := pm.load()
+	pm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("display profile %q not found", name)
+	}
+	return pm.applyProfile(ctx, profile)
+}
+
+// applyProfile configures each output of the profile that is currently connected
+func (pm *DisplayProfileManager) applyProfile(ctx context.Context, profile *DisplayProfile) error {
+	if !pm.display.IsAvailable() {
+		return fmt.Errorf("no supported compositor detected")
+	}
+
+	configurator, ok := pm.display.backend.(OutputConfigurator)
+	if !ok {
+		return fmt.Errorf("%s does not support applying display profiles", pm.display.backend.Type())
+	}
+
+	monitors, err := pm.display.GetMonitors(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read monitors: %w", err)
+	}
+
+	// Connector names can differ between docks, so resolve them by identity
+	connected := make(map[string]string)
+	for _, m := range monitors {
+		connected[outputIdentity(m.Name, m.Make, m.Model, m.Serial)] = m.Name
+	}
+
+	applied := 0
+	var errors []string
+	for _, layout := range profile.Outputs {
+		name, ok := connected[outputIdentity(layout.Name, layout.Make, layout.Model, layout.Serial)]
+		if !ok {
+			pm.logger.Debug("Display profile %q: output %s not connected, skipping", profile.Name, layout.Name)
+			continue
+		}
+
+		layout.Name = name
+		if err := configurator.ConfigureOutput(ctx, layout); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		applied++
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to apply display profile %q: %s", profile.Name, strings.Join(errors, "; "))
+	}
+
+	pm.logger.Info("Applied display profile %q (%d outputs)", profile.Name, applied)
+	return nil
+}
+
+// List returns all saved profiles sorted by name
+func (pm *DisplayProfileManager) List() ([]*DisplayProfile, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	profiles, err := pm.load()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*DisplayProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// Delete removes a saved profile
+func (pm *DisplayProfileManager) Delete(name string) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	profiles, err := pm.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles[name]; !ok {
+		return fmt.Errorf("display profile %q not found", name)
+	}
+
+	delete(profiles, name)
+	return pm.store(profiles)
+}
+
+// MatchingProfile returns the auto-apply profile for the connected monitor set, if any
+func (pm *DisplayProfileManager) MatchingProfile(ctx context.Context) (*DisplayProfile, error) {
+	monitors, err := pm.display.GetMonitors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := pm.List()
+	if err != nil {
+		return nil, err
+	}
+
+	current := monitorSignature(monitors)
+	for _, profile := range profiles {
+		if profile.AutoApply && profile.Signature() == current {
+			return profile, nil
+		}
+	}
+	return nil, nil
+}
+
+// Start polls the connected monitors and applies the matching profile when they change
+func (pm *DisplayProfileManager) Start(interval time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.isRunning {
+		pm.logger.Warn("Display profile watcher already running")
+		return
+	}
+
+	pm.isRunning = true
+	pm.stopChan = make(chan struct{})
+	pm.ticker = time.NewTicker(interval)
+	pm.logger.Info("Starting display profile watcher (interval: %v)", interval)
+
+	go utility.Supervise("display-profiles", func() {
+		for {
+			select {
+			case <-pm.ticker.C:
+				pm.checkMonitorSet(context.Background())
+			case <-pm.stopChan:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts the watcher
+func (pm *DisplayProfileManager) Stop() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if !pm.isRunning {
+		return
+	}
+
+	pm.isRunning = false
+	pm.ticker.Stop()
+	close(pm.stopChan)
+	pm.logger.Info("Display profile watcher stopped")
+}
+
+// checkMonitorSet applies the matching profile if the monitor set changed since the last check
+func (pm *DisplayProfileManager) checkMonitorSet(ctx context.Context) {
+	monitors, err := pm.display.GetMonitors(ctx)
+	if err != nil || len(monitors) == 0 {
+		return
+	}
+
+	current := monitorSignature(monitors)
+	pm.mu.Lock()
+	changed := current != pm.lastSignature
+	pm.lastSignature = current
+	pm.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	profile, err := pm.MatchingProfile(ctx)
+	if err != nil {
+		pm.logger.Error("Failed to match display profile: %v", err)
+		return
+	}
+	if profile == nil {
+		pm.logger.Debug("Monitor set changed, no matching display profile")
+		return
+	}
+
+	pm.logger.Info("Monitor set changed, applying display profile %q", profile.Name)
+	if err := pm.applyProfile(ctx, profile); err != nil {
+		pm.logger.Error("%v", err)
+	}
+}
@@ -0,0 +1,304 @@
+/**
+ * Hyprland backend - queries Hyprland state via hyprctl
+ */
+
+package desktopmonitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// HyprlandBackend implements CompositorBackend using hyprctl
+type HyprlandBackend struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+}
+
+// NewHyprlandBackend creates a new Hyprland backend
+func NewHyprlandBackend(logger *utility.Logger, shell *utility.Shell) *HyprlandBackend {
+	return &HyprlandBackend{
+		logger: logger,
+		shell:  shell,
+	}
+}
+
+// Type returns the compositor type
+func (hb *HyprlandBackend) Type() CompositorType {
+	return CompositorTypeHyprland
+}
+
+// IsAvailable checks if Hyprland is available
+func (hb *HyprlandBackend) IsAvailable() bool {
+	return os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != ""
+}
+
+// GetCompositorInfo gets compositor information
+func (hb *HyprlandBackend) GetCompositorInfo(ctx context.Context) (*CompositorInfo, error) {
+	result, err := hb.shell.Execute(ctx, "hyprctl version -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	if err != nil || result.ExitCode != 0 {
+		hb.logger.Error("hyprctl version failed: %v", err)
+		return &CompositorInfo{
+			Name:      "Hyprland",
+			Version:   "unknown",
+			Available: false,
+		}, nil
+	}
+
+	var versionData map[string]interface{}
+	if err := json.Unmarshal([]byte(result.Stdout), &versionData); err != nil {
+		hb.logger.Error("Error parsing version JSON: %v", err)
+		return &CompositorInfo{
+			Name:      "Hyprland",
+			Version:   "unknown",
+			Available: false,
+		}, nil
+	}
+
+	version := "unknown"
+	if tag, ok := versionData["tag"].(string); ok && tag != "" {
+		version = tag
+	} else if commit, ok := versionData["commit"].(string); ok && commit != "" {
+		if len(commit) > 7 {
+			version = commit[:7]
+		} else {
+			version = commit
+		}
+	}
+
+	branch := ""
+	if b, ok := versionData["branch"].(string); ok {
+		branch = b
+	}
+
+	commit := ""
+	if c, ok := versionData["commit"].(string); ok {
+		commit = c
+	}
+
+	buildDate := ""
+	if d, ok := versionData["date"].(string); ok {
+		buildDate = d
+	}
+
+	return &CompositorInfo{
+		Name:      "Hyprland",
+		Version:   version,
+		Available: true,
+		Branch:    branch,
+		Commit:    commit,
+		BuildDate: buildDate,
+	}, nil
+}
+
+// GetWorkspaces gets all workspaces
+func (hb *HyprlandBackend) GetWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	result, err := hb.shell.Execute(ctx, "hyprctl workspaces -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	if err != nil || result.ExitCode != 0 {
+		hb.logger.Error("hyprctl workspaces failed: %v", err)
+		return []WorkspaceInfo{}, err
+	}
+
+	var workspaces []WorkspaceInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &workspaces); err != nil {
+		hb.logger.Error("Error parsing workspaces JSON: %v", err)
+		return []WorkspaceInfo{}, err
+	}
+
+	return workspaces, nil
+}
+
+// GetActiveWindow gets the active window
+func (hb *HyprlandBackend) GetActiveWindow(ctx context.Context) (*WindowInfo, error) {
+	result, err := hb.shell.Execute(ctx, "hyprctl activewindow -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	if err != nil || result.ExitCode != 0 {
+		return nil, nil
+	}
+
+	var window WindowInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &window); err != nil {
+		return nil, nil
+	}
+
+	if window.Address == "" || window.Address == "0x" {
+		return nil, nil
+	}
+
+	return &window, nil
+}
+
+// GetWindows gets all windows
+func (hb *HyprlandBackend) GetWindows(ctx context.Context) ([]WindowInfo, error) {
+	result, err := hb.shell.Execute(ctx, "hyprctl clients -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	if err != nil || result.ExitCode != 0 {
+		hb.logger.Error("hyprctl clients failed: %v", err)
+		return []WindowInfo{}, err
+	}
+
+	var windows []WindowInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &windows); err != nil {
+		hb.logger.Error("Error parsing windows JSON: %v", err)
+		return []WindowInfo{}, err
+	}
+
+	return windows, nil
+}
+
+// GetMonitors gets all monitors
+func (hb *HyprlandBackend) GetMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	result, err := hb.shell.Execute(ctx, "hyprctl monitors -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	if err != nil || result.ExitCode != 0 {
+		hb.logger.Error("hyprctl monitors failed: %v", err)
+		return []MonitorInfo{}, err
+	}
+
+	var monitors []MonitorInfo
+	if err := json.Unmarshal([]byte(result.Stdout), &monitors); err != nil {
+		hb.logger.Error("Error parsing monitors JSON: %v", err)
+		return []MonitorInfo{}, err
+	}
+
+	return monitors, nil
+}
+
+// ConfigureOutput applies an output layout via `hyprctl keyword monitor`
+func (hb *HyprlandBackend) ConfigureOutput(ctx context.Context, layout OutputLayout) error {
+	rule := fmt.Sprintf("%s,%dx%d@%.2f,%dx%d,%.2f,transform,%d",
+		layout.Name, layout.Width, layout.Height, layout.RefreshRate, layout.X, layout.Y, layout.Scale, layout.Transform)
+
+	result, err := hb.shell.Execute(ctx, fmt.Sprintf("hyprctl keyword monitor '%s'", rule), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("hyprctl keyword monitor failed: %w", err)
+	}
+	if result.ExitCode != 0 || strings.Contains(result.Stdout, "error") {
+		return fmt.Errorf("hyprctl keyword monitor rejected %s: %s %s", rule, result.Stdout, result.Stderr)
+	}
+	return nil
+}
+
+// EventSocketPath returns the path of Hyprland's event socket (.socket2.sock)
+func (hb *HyprlandBackend) EventSocketPath() string {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		path := filepath.Join(runtimeDir, "hypr", signature, ".socket2.sock")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	// Hyprland < 0.40 kept its sockets in /tmp
+	return filepath.Join("/tmp", "hypr", signature, ".socket2.sock")
+}
+
+// SubscribeWindowEvents listens for openwindow events on the Hyprland event socket
+func (hb *HyprlandBackend) SubscribeWindowEvents(ctx context.Context, handler func(WindowInfo)) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", hb.EventSocketPath())
+	if err != nil {
+		return fmt.Errorf("failed to connect to Hyprland event socket: %w", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		// openwindow>>ADDRESS,WORKSPACENAME,CLASS,TITLE
+		event, data, ok := strings.Cut(scanner.Text(), ">>")
+		if !ok || event != "openwindow" {
+			continue
+		}
+
+		fields := strings.SplitN(data, ",", 4)
+		if len(fields) < 4 {
+			continue
+		}
+
+		window := WindowInfo{
+			Address: "0x" + fields[0],
+			Class:   fields[2],
+			Title:   fields[3],
+			Mapped:  true,
+		}
+		window.Workspace.Name = fields[1]
+		handler(window)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("hyprland event socket read failed: %w", err)
+	}
+	return fmt.Errorf("hyprland event socket closed")
+}
+
+// dispatch runs a hyprctl dispatcher
+func (hb *HyprlandBackend) dispatch(ctx context.Context, dispatcher, args string) error {
+	result, err := hb.shell.Execute(ctx, fmt.Sprintf("hyprctl dispatch %s '%s'", dispatcher, args), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("hyprctl dispatch %s failed: %w", dispatcher, err)
+	}
+	if result.ExitCode != 0 || strings.TrimSpace(result.Stdout) != "ok" {
+		return fmt.Errorf("hyprctl dispatch %s %s failed: %s %s", dispatcher, args, result.Stdout, result.Stderr)
+	}
+	return nil
+}
+
+// MoveWindowToWorkspace moves a window to a workspace via movetoworkspacesilent
+func (hb *HyprlandBackend) MoveWindowToWorkspace(ctx context.Context, window WindowInfo, workspace string) error {
+	return hb.dispatch(ctx, "movetoworkspacesilent", fmt.Sprintf("%s,address:%s", workspace, window.Address))
+}
+
+// SetWindowFloating floats or tiles a window via setfloating/settiled
+func (hb *HyprlandBackend) SetWindowFloating(ctx context.Context, window WindowInfo, floating bool) error {
+	dispatcher := "settiled"
+	if floating {
+		dispatcher = "setfloating"
+	}
+	return hb.dispatch(ctx, dispatcher, "address:"+window.Address)
+}
+
+// MoveWorkspaceToOutput moves a workspace via moveworkspacetomonitor
+func (hb *HyprlandBackend) MoveWorkspaceToOutput(ctx context.Context, workspace WorkspaceInfo, output string) error {
+	return hb.dispatch(ctx, "moveworkspacetomonitor", fmt.Sprintf("%d %s", workspace.ID, output))
+}
+
+// SetOutputsPower turns all monitors on or off via the dpms dispatcher
+func (hb *HyprlandBackend) SetOutputsPower(ctx context.Context, on bool) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	return hb.dispatch(ctx, "dpms", state)
+}
@@ -0,0 +1,359 @@
+/**
+ * Idle manager - lock, DPMS off and suspend after configurable idle periods
+ *
+ * Idle time comes from logind's IdleHint/IdleSinceHint, which is set by the
+ * session's idle daemon (hypridle, swayidle, ...). Actions are skipped while
+ * an idle/sleep inhibitor lock is held (video players, presentations, ...).
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// IdlePolicy configures idle actions; a zero duration disables the action
+type IdlePolicy struct {
+	LockAfter    time.Duration
+	DPMSAfter    time.Duration
+	SuspendAfter time.Duration
+}
+
+// IdleAction is an action taken after an idle period
+type IdleAction string
+
+const (
+	IdleActionLock    IdleAction = "lock"
+	IdleActionDPMS    IdleAction = "dpms-off"
+	IdleActionSuspend IdleAction = "suspend"
+)
+
+// IdleStatus describes the current idle state and the next pending action
+type IdleStatus struct {
+	Policy           IdlePolicy
+	Running          bool
+	Idle             bool
+	IdleFor          time.Duration
+	Inhibitors       []Inhibitor
+	NextAction       IdleAction
+	TimeToNextAction time.Duration
+	Performed        []IdleAction
+}
+
+// ParseIdlePolicy parses duration strings ("10m", "1h"); empty or "0" disables an action
+func ParseIdlePolicy(lockAfter, dpmsAfter, suspendAfter string) (IdlePolicy, error) {
+	var policy IdlePolicy
+	fields := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"lock", lockAfter, &policy.LockAfter},
+		{"dpms", dpmsAfter, &policy.DPMSAfter},
+		{"suspend", suspendAfter, &policy.SuspendAfter},
+	}
+
+	for _, field := range fields {
+		if field.value == "" || field.value == "0" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid idle %s timeout %q: %w", field.name, field.value, err)
+		}
+		*field.dest = d
+	}
+	return policy, nil
+}
+
+// IsEnabled returns true if any idle action is configured
+func (p IdlePolicy) IsEnabled() bool {
+	return p.LockAfter > 0 || p.DPMSAfter > 0 || p.SuspendAfter > 0
+}
+
+// idleStep is an enabled action and the idle time after which it fires
+type idleStep struct {
+	action IdleAction
+	after  time.Duration
+}
+
+// steps returns the enabled actions in the order they fire
+func (p IdlePolicy) steps() []idleStep {
+	steps := []idleStep{}
+	for _, step := range []idleStep{
+		{IdleActionLock, p.LockAfter},
+		{IdleActionDPMS, p.DPMSAfter},
+		{IdleActionSuspend, p.SuspendAfter},
+	} {
+		if step.after > 0 {
+			steps = append(steps, step)
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].after < steps[j].after
+	})
+	return steps
+}
+
+// IdleManager applies the idle policy to the current session
+type IdleManager struct {
+	logger     *utility.Logger
+	shell      *utility.Shell
+	session    *SessionMonitor
+	compositor *CompositorMonitor
+	policy     IdlePolicy
+	performed  map[IdleAction]bool
+	isRunning  bool
+	stopChan   chan struct{}
+	ticker     *time.Ticker
+	mu         sync.Mutex
+}
+
+// NewIdleManager creates a new idle manager
+func NewIdleManager(logger *utility.Logger, policy IdlePolicy) *IdleManager {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	return &IdleManager{
+		logger:     logger.With("idle"),
+		shell:      utility.NewShell(logger),
+		session:    GetSessionMonitor(),
+		compositor: GetCompositorMonitor(),
+		policy:     policy,
+		performed:  make(map[IdleAction]bool),
+	}
+}
+
+// Start checks the idle state periodically and runs due actions
+func (im *IdleManager) Start() {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if im.isRunning {
+		im.logger.Warn("Idle manager already running")
+		return
+	}
+
+	im.isRunning = true
+	im.stopChan = make(chan struct{})
+	im.ticker = time.NewTicker(15 * time.Second)
+	im.logger.Info("Starting idle manager (lock: %v, dpms: %v, suspend: %v)",
+		im.policy.LockAfter, im.policy.DPMSAfter, im.policy.SuspendAfter)
+
+	go utility.Supervise("idle-manager", func() {
+		for {
+			select {
+			case <-im.ticker.C:
+				im.check(context.Background())
+			case <-im.stopChan:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts the idle manager
+func (im *IdleManager) Stop() {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if !im.isRunning {
+		return
+	}
+
+	im.isRunning = false
+	im.ticker.Stop()
+	close(im.stopChan)
+	im.logger.Info("Idle manager stopped")
+}
+
+// isInhibited returns true if an inhibitor blocks idle or sleep
+func isInhibited(inhibitors []Inhibitor, what string) bool {
+	for _, inhibitor := range inhibitors {
+		if inhibitor.Mode == "block" && strings.Contains(inhibitor.What, what) {
+			return true
+		}
+	}
+	return false
+}
+
+// check runs any actions that are due for the current idle period
+func (im *IdleManager) check(ctx context.Context) {
+	idleFor, err := im.session.GetIdleDuration(ctx)
+	if err != nil {
+		im.logger.Debug("Idle check failed: %v", err)
+		return
+	}
+
+	im.mu.Lock()
+	if idleFor == 0 {
+		// Activity resumed: restore outputs and start a new idle period
+		restoreDPMS := im.performed[IdleActionDPMS]
+		im.performed = make(map[IdleAction]bool)
+		im.mu.Unlock()
+
+		if restoreDPMS {
+			im.setOutputsPower(ctx, true)
+		}
+		return
+	}
+	im.mu.Unlock()
+
+	inhibitors, err := im.session.GetInhibitors(ctx)
+	if err != nil {
+		im.logger.Debug("Failed to list inhibitors: %v", err)
+	}
+
+	for _, step := range im.policy.steps() {
+		im.mu.Lock()
+		done := im.performed[step.action]
+		im.mu.Unlock()
+		if done || idleFor < step.after {
+			continue
+		}
+
+		what := "idle"
+		if step.action == IdleActionSuspend {
+			what = "sleep"
+		}
+		if isInhibited(inhibitors, what) {
+			im.logger.Debug("Idle action %s skipped: %s inhibited", step.action, what)
+			continue
+		}
+
+		im.logger.Info("Session idle for %v, running idle action: %s", idleFor.Round(time.Second), step.action)
+		if err := im.perform(ctx, step.action); err != nil {
+			im.logger.Error("Idle action %s failed: %v", step.action, err)
+		}
+
+		im.mu.Lock()
+		im.performed[step.action] = true
+		im.mu.Unlock()
+	}
+}
+
+// perform runs a single idle action
+func (im *IdleManager) perform(ctx context.Context, action IdleAction) error {
+	switch action {
+	case IdleActionLock:
+		return im.session.LockSession(ctx)
+	case IdleActionDPMS:
+		return im.setOutputsPower(ctx, false)
+	case IdleActionSuspend:
+		result, err := im.shell.Execute(ctx, "systemctl suspend", &utility.ExecOptions{
+			Timeout: 10 * time.Second,
+		})
+		if err != nil || result.ExitCode != 0 {
+			return fmt.Errorf("systemctl suspend failed: %v", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown idle action: %s", action)
+}
+
+// setOutputsPower powers outputs on or off via the compositor backend
+func (im *IdleManager) setOutputsPower(ctx context.Context, on bool) error {
+	if !im.compositor.IsAvailable() {
+		return fmt.Errorf("no supported compositor detected")
+	}
+	controller, ok := im.compositor.Backend().(PowerController)
+	if !ok {
+		return fmt.Errorf("%s does not support DPMS control", im.compositor.Backend().Type())
+	}
+	if err := controller.SetOutputsPower(ctx, on); err != nil {
+		im.logger.Error("Failed to set output power: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetStatus returns the active policy and time until the next idle action
+func (im *IdleManager) GetStatus(ctx context.Context) (*IdleStatus, error) {
+	idleFor, err := im.session.GetIdleDuration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inhibitors, _ := im.session.GetInhibitors(ctx)
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	status := &IdleStatus{
+		Policy:     im.policy,
+		Running:    im.isRunning,
+		Idle:       idleFor > 0,
+		IdleFor:    idleFor,
+		Inhibitors: inhibitors,
+	}
+	for _, step := range im.policy.steps() {
+		if im.performed[step.action] {
+			status.Performed = append(status.Performed, step.action)
+			continue
+		}
+		if status.NextAction == "" {
+			status.NextAction = step.action
+			status.TimeToNextAction = step.after - idleFor
+			if status.TimeToNextAction < 0 {
+				status.TimeToNextAction = 0
+			}
+		}
+	}
+	return status, nil
+}
+
+// FormatIdleStatus formats idle status for display
+func (im *IdleManager) FormatIdleStatus(status *IdleStatus) string {
+	formatTimeout := func(d time.Duration) string {
+		if d == 0 {
+			return "disabled"
+		}
+		return d.String()
+	}
+
+	lines := []string{
+		"Idle Policy:",
+		fmt.Sprintf("  Lock after: %s", formatTimeout(status.Policy.LockAfter)),
+		fmt.Sprintf("  DPMS off after: %s", formatTimeout(status.Policy.DPMSAfter)),
+		fmt.Sprintf("  Suspend after: %s", formatTimeout(status.Policy.SuspendAfter)),
+		"",
+		"Idle State:",
+		fmt.Sprintf("  Idle: %s", boolToYesNo(status.Idle)),
+	}
+
+	if status.Idle {
+		lines = append(lines, fmt.Sprintf("  Idle for: %s", status.IdleFor.Round(time.Second)))
+	}
+	if len(status.Performed) > 0 {
+		performed := make([]string, 0, len(status.Performed))
+		for _, action := range status.Performed {
+			performed = append(performed, string(action))
+		}
+		lines = append(lines, fmt.Sprintf("  Performed: %s", strings.Join(performed, ", ")))
+	}
+	if status.NextAction != "" {
+		lines = append(lines, fmt.Sprintf("  Next action: %s in %s", status.NextAction, status.TimeToNextAction.Round(time.Second)))
+	}
+
+	blocking := []string{}
+	for _, inhibitor := range status.Inhibitors {
+		if inhibitor.Mode == "block" && (strings.Contains(inhibitor.What, "idle") || strings.Contains(inhibitor.What, "sleep")) {
+			blocking = append(blocking, fmt.Sprintf("%s (%s: %s)", inhibitor.Who, inhibitor.What, inhibitor.Why))
+		}
+	}
+	if len(blocking) > 0 {
+		lines = append(lines, "", "Inhibited by:")
+		for _, b := range blocking {
+			lines = append(lines, "  - "+b)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,384 @@
+/**
+ * Niri backend - queries niri state via `niri msg --json`
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// NiriBackend implements CompositorBackend using niri msg
+type NiriBackend struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+}
+
+// niriVersion is the reply to `niri msg --json version`
+type niriVersion struct {
+	CLI        string `json:"cli"`
+	Compositor string `json:"compositor"`
+}
+
+// niriWorkspace is an entry in the reply to `niri msg --json workspaces`
+type niriWorkspace struct {
+	ID             int     `json:"id"`
+	Idx            int     `json:"idx"`
+	Name           *string `json:"name"`
+	Output         *string `json:"output"`
+	IsActive       bool    `json:"is_active"`
+	IsFocused      bool    `json:"is_focused"`
+	ActiveWindowID *int    `json:"active_window_id"`
+}
+
+// niriWindow is an entry in the reply to `niri msg --json windows`
+type niriWindow struct {
+	ID          int     `json:"id"`
+	Title       *string `json:"title"`
+	AppID       *string `json:"app_id"`
+	PID         *int    `json:"pid"`
+	WorkspaceID *int    `json:"workspace_id"`
+	IsFocused   bool    `json:"is_focused"`
+	IsFloating  bool    `json:"is_floating"`
+}
+
+// niriOutput is a value in the reply to `niri msg --json outputs`
+type niriOutput struct {
+	Name   string  `json:"name"`
+	Make   string  `json:"make"`
+	Model  string  `json:"model"`
+	Serial *string `json:"serial"`
+	Modes  []struct {
+		Width       int `json:"width"`
+		Height      int `json:"height"`
+		RefreshRate int `json:"refresh_rate"` // mHz
+	} `json:"modes"`
+	CurrentMode *int `json:"current_mode"`
+	VRREnabled  bool `json:"vrr_enabled"`
+	Logical     *struct {
+		X         int     `json:"x"`
+		Y         int     `json:"y"`
+		Scale     float64 `json:"scale"`
+		Transform string  `json:"transform"`
+	} `json:"logical"`
+}
+
+// NewNiriBackend creates a new niri backend
+func NewNiriBackend(logger *utility.Logger, shell *utility.Shell) *NiriBackend {
+	return &NiriBackend{
+		logger: logger,
+		shell:  shell,
+	}
+}
+
+// Type returns the compositor type
+func (nb *NiriBackend) Type() CompositorType {
+	return CompositorTypeNiri
+}
+
+// IsAvailable checks if niri is available
+func (nb *NiriBackend) IsAvailable() bool {
+	return os.Getenv("NIRI_SOCKET") != ""
+}
+
+// query runs a niri msg request and unmarshals the JSON reply
+func (nb *NiriBackend) query(ctx context.Context, request string, target interface{}) error {
+	command := fmt.Sprintf("niri msg --json %s", request)
+	result, err := nb.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", command, result.ExitCode, result.Stderr)
+	}
+
+	if err := json.Unmarshal([]byte(result.Stdout), target); err != nil {
+		return fmt.Errorf("failed to parse niri %s reply: %w", request, err)
+	}
+	return nil
+}
+
+// GetCompositorInfo gets compositor information
+func (nb *NiriBackend) GetCompositorInfo(ctx context.Context) (*CompositorInfo, error) {
+	var version niriVersion
+	if err := nb.query(ctx, "version", &version); err != nil {
+		nb.logger.Error("niri version failed: %v", err)
+		return &CompositorInfo{
+			Name:      "niri",
+			Version:   "unknown",
+			Available: false,
+		}, nil
+	}
+
+	// Version strings look like "niri 0.1.10 (commit abc1234)"
+	versionStr := strings.TrimSpace(strings.TrimPrefix(version.Compositor, "niri"))
+	commit := ""
+	if idx := strings.Index(versionStr, "("); idx >= 0 {
+		commit = strings.Trim(strings.TrimPrefix(versionStr[idx:], "(commit"), " ()")
+		versionStr = strings.TrimSpace(versionStr[:idx])
+	}
+	if versionStr == "" {
+		versionStr = "unknown"
+	}
+
+	return &CompositorInfo{
+		Name:      "niri",
+		Version:   versionStr,
+		Available: true,
+		Commit:    commit,
+	}, nil
+}
+
+// GetWorkspaces gets all workspaces
+func (nb *NiriBackend) GetWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	var niriWorkspaces []niriWorkspace
+	if err := nb.query(ctx, "workspaces", &niriWorkspaces); err != nil {
+		nb.logger.Error("niri workspaces failed: %v", err)
+		return []WorkspaceInfo{}, err
+	}
+
+	windows, _ := nb.GetWindows(ctx)
+	windowsByWorkspace := make(map[int][]WindowInfo)
+	for _, window := range windows {
+		windowsByWorkspace[window.Workspace.ID] = append(windowsByWorkspace[window.Workspace.ID], window)
+	}
+
+	workspaces := make([]WorkspaceInfo, 0, len(niriWorkspaces))
+	for _, ws := range niriWorkspaces {
+		info := WorkspaceInfo{
+			ID:      ws.ID,
+			Name:    nb.workspaceName(ws),
+			Windows: len(windowsByWorkspace[ws.ID]),
+		}
+		if ws.Output != nil {
+			info.Monitor = *ws.Output
+		}
+		if ws.ActiveWindowID != nil {
+			info.LastWindow = fmt.Sprintf("%d", *ws.ActiveWindowID)
+			for _, window := range windowsByWorkspace[ws.ID] {
+				if window.Address == info.LastWindow {
+					info.LastWindowTitle = window.Title
+				}
+			}
+		}
+		workspaces = append(workspaces, info)
+	}
+
+	return workspaces, nil
+}
+
+// workspaceName returns the workspace name, falling back to its index on the output
+func (nb *NiriBackend) workspaceName(ws niriWorkspace) string {
+	if ws.Name != nil && *ws.Name != "" {
+		return *ws.Name
+	}
+	return fmt.Sprintf("%d", ws.Idx)
+}
+
+// GetWindows gets all windows
+func (nb *NiriBackend) GetWindows(ctx context.Context) ([]WindowInfo, error) {
+	var niriWindows []niriWindow
+	if err := nb.query(ctx, "windows", &niriWindows); err != nil {
+		nb.logger.Error("niri windows failed: %v", err)
+		return []WindowInfo{}, err
+	}
+
+	var niriWorkspaces []niriWorkspace
+	workspaceNames := make(map[int]string)
+	if err := nb.query(ctx, "workspaces", &niriWorkspaces); err == nil {
+		for _, ws := range niriWorkspaces {
+			workspaceNames[ws.ID] = nb.workspaceName(ws)
+		}
+	}
+
+	windows := make([]WindowInfo, 0, len(niriWindows))
+	for _, w := range niriWindows {
+		windows = append(windows, nb.toWindowInfo(w, workspaceNames))
+	}
+
+	return windows, nil
+}
+
+// toWindowInfo converts a niri window to WindowInfo
+func (nb *NiriBackend) toWindowInfo(w niriWindow, workspaceNames map[int]string) WindowInfo {
+	window := WindowInfo{
+		Address:    fmt.Sprintf("%d", w.ID),
+		Floating:   w.IsFloating,
+		Fullscreen: false,
+		Mapped:     true,
+		Focused:    w.IsFocused,
+	}
+	if w.Title != nil {
+		window.Title = *w.Title
+	}
+	if w.AppID != nil {
+		window.Class = *w.AppID
+	}
+	if w.PID != nil {
+		window.PID = *w.PID
+	}
+	if w.WorkspaceID != nil {
+		window.Workspace.ID = *w.WorkspaceID
+		window.Workspace.Name = workspaceNames[*w.WorkspaceID]
+	}
+	return window
+}
+
+// GetActiveWindow gets the active window
+func (nb *NiriBackend) GetActiveWindow(ctx context.Context) (*WindowInfo, error) {
+	var focused *niriWindow
+	if err := nb.query(ctx, "focused-window", &focused); err != nil || focused == nil {
+		return nil, nil
+	}
+
+	window := nb.toWindowInfo(*focused, map[int]string{})
+	return &window, nil
+}
+
+// GetMonitors gets all outputs
+func (nb *NiriBackend) GetMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	var outputs map[string]niriOutput
+	if err := nb.query(ctx, "outputs", &outputs); err != nil {
+		nb.logger.Error("niri outputs failed: %v", err)
+		return []MonitorInfo{}, err
+	}
+
+	var niriWorkspaces []niriWorkspace
+	activeWorkspaces := make(map[string]niriWorkspace)
+	if err := nb.query(ctx, "workspaces", &niriWorkspaces); err == nil {
+		for _, ws := range niriWorkspaces {
+			if ws.IsActive && ws.Output != nil {
+				activeWorkspaces[*ws.Output] = ws
+			}
+		}
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	monitors := make([]MonitorInfo, 0, len(outputs))
+	for i, name := range names {
+		output := outputs[name]
+		if output.Logical == nil {
+			// Output is disabled
+			continue
+		}
+
+		monitor := MonitorInfo{
+			ID:         i,
+			Name:       output.Name,
+			Make:       output.Make,
+			Model:      output.Model,
+			X:          output.Logical.X,
+			Y:          output.Logical.Y,
+			Scale:      output.Logical.Scale,
+			Transform:  niriTransformToInt(output.Logical.Transform),
+			VRR:        output.VRREnabled,
+			DPMSStatus: true,
+		}
+		if output.Serial != nil {
+			monitor.Serial = *output.Serial
+		}
+		monitor.Description = strings.TrimSpace(fmt.Sprintf("%s %s %s", monitor.Make, monitor.Model, monitor.Serial))
+		if output.CurrentMode != nil && *output.CurrentMode < len(output.Modes) {
+			mode := output.Modes[*output.CurrentMode]
+			monitor.Width = mode.Width
+			monitor.Height = mode.Height
+			monitor.RefreshRate = float64(mode.RefreshRate) / 1000
+		}
+		if ws, ok := activeWorkspaces[name]; ok {
+			monitor.ActiveWorkspace.ID = ws.ID
+			monitor.ActiveWorkspace.Name = nb.workspaceName(ws)
+		}
+
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
+
+// niriTransformToInt maps niri transform names to Hyprland-style transform numbers
+func niriTransformToInt(transform string) int {
+	switch strings.ToLower(transform) {
+	case "90":
+		return 1
+	case "180":
+		return 2
+	case "270":
+		return 3
+	case "flipped":
+		return 4
+	case "flipped90":
+		return 5
+	case "flipped180":
+		return 6
+	case "flipped270":
+		return 7
+	default:
+		return 0
+	}
+}
+
+// ConfigureOutput applies an output layout via `niri msg output`
+func (nb *NiriBackend) ConfigureOutput(ctx context.Context, layout OutputLayout) error {
+	commands := []string{
+		fmt.Sprintf("niri msg output '%s' on", layout.Name),
+		fmt.Sprintf("niri msg output '%s' mode %dx%d@%.3f", layout.Name, layout.Width, layout.Height, layout.RefreshRate),
+		fmt.Sprintf("niri msg output '%s' position set %d %d", layout.Name, layout.X, layout.Y),
+		fmt.Sprintf("niri msg output '%s' scale %.2f", layout.Name, layout.Scale),
+		fmt.Sprintf("niri msg output '%s' transform %s", layout.Name, transformName(layout.Transform)),
+	}
+
+	result, err := nb.shell.Execute(ctx, strings.Join(commands, " && "), &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("niri msg output failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("niri msg output failed for %s: %s", layout.Name, result.Stderr)
+	}
+	return nil
+}
+
+// MoveWorkspaceToOutput moves a workspace, referenced by name or index, to another monitor
+func (nb *NiriBackend) MoveWorkspaceToOutput(ctx context.Context, workspace WorkspaceInfo, output string) error {
+	result, err := nb.shell.Execute(ctx, fmt.Sprintf("niri msg action move-workspace-to-monitor --reference '%s' '%s'", workspace.Name, output), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("niri move-workspace-to-monitor failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("niri move-workspace-to-monitor failed: %s", result.Stderr)
+	}
+	return nil
+}
+
+// SetOutputsPower turns all monitors off; niri powers them back on at the next input event
+func (nb *NiriBackend) SetOutputsPower(ctx context.Context, on bool) error {
+	if on {
+		return nil
+	}
+
+	result, err := nb.shell.Execute(ctx, "niri msg action power-off-monitors", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("niri power-off-monitors failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+/**
+ * Screen capture - screenshots (grim/slurp) and recordings (wf-recorder)
+ *
+ * Recordings run detached so `record start` and `record stop` can be called
+ * from separate CLI invocations; the recorder PID and output path are kept in
+ * the runtime directory.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// CaptureMode selects what to capture
+type CaptureMode string
+
+const (
+	CaptureFull   CaptureMode = "full"
+	CaptureRegion CaptureMode = "region"
+	CaptureWindow CaptureMode = "window"
+	CaptureOutput CaptureMode = "output"
+)
+
+// ScreenCapture takes screenshots and screen recordings
+type ScreenCapture struct {
+	logger        *utility.Logger
+	shell         *utility.Shell
+	compositor    *CompositorMonitor
+	display       *DisplayMonitor
+	screenshotDir string
+	recordingDir  string
+	stateDir      string
+}
+
+// NewScreenCapture creates a new ScreenCapture; empty directories default to ~/Pictures/Screenshots and ~/Videos/Recordings
+func NewScreenCapture(logger *utility.Logger, screenshotDir, recordingDir string) *ScreenCapture {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	if screenshotDir == "" {
+		screenshotDir = filepath.Join(homeDir, "Pictures", "Screenshots")
+	}
+	if recordingDir == "" {
+		recordingDir = filepath.Join(homeDir, "Videos", "Recordings")
+	}
+
+	return &ScreenCapture{
+		logger:        logger.With("screen-capture"),
+		shell:         utility.NewShell(logger),
+		compositor:    GetCompositorMonitor(),
+		display:       GetDisplayMonitor(),
+		screenshotDir: screenshotDir,
+		recordingDir:  recordingDir,
+		stateDir:      utility.RuntimeDir(),
+	}
+}
+
+// captureArgs returns the grim/wf-recorder arguments selecting the capture area
+func (sc *ScreenCapture) captureArgs(ctx context.Context, mode CaptureMode) (string, error) {
+	switch mode {
+	case CaptureFull, "":
+		return "", nil
+
+	case CaptureRegion:
+		result, err := sc.shell.Execute(ctx, "slurp", &utility.ExecOptions{
+			Timeout: 2 * time.Minute,
+		})
+		if err != nil {
+			return "", fmt.Errorf("slurp failed: %w", err)
+		}
+		if result.ExitCode != 0 || result.Stdout == "" {
+			return "", fmt.Errorf("region selection cancelled")
+		}
+		return fmt.Sprintf("-g '%s'", result.Stdout), nil
+
+	case CaptureWindow:
+		window, err := sc.compositor.GetActiveWindow(ctx)
+		if err != nil || window == nil {
+			return "", fmt.Errorf("no active window")
+		}
+		if window.Size[0] == 0 || window.Size[1] == 0 {
+			return "", fmt.Errorf("window geometry not available on this compositor")
+		}
+		return fmt.Sprintf("-g '%d,%d %dx%d'", window.At[0], window.At[1], window.Size[0], window.Size[1]), nil
+
+	case CaptureOutput:
+		monitors, err := sc.display.GetMonitors(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, m := range monitors {
+			if m.Focused {
+				return fmt.Sprintf("-o '%s'", m.Name), nil
+			}
+		}
+		if len(monitors) > 0 {
+			return fmt.Sprintf("-o '%s'", monitors[0].Name), nil
+		}
+		return "", fmt.Errorf("no outputs found")
+	}
+
+	return "", fmt.Errorf("unknown capture mode: %s (expected full, region, window or output)", mode)
+}
+
+// outputPath returns a timestamped file path in dir
+func outputPath(dir, prefix, ext string) (string, error) {
+	if _, err := utility.EnsureDir(dir); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	name := fmt.Sprintf("%s_%s.%s", prefix, time.Now().Format("2006-01-02_15-04-05"), ext)
+	return filepath.Join(dir, name), nil
+}
+
+// Screenshot captures the screen and returns the image path
+func (sc *ScreenCapture) Screenshot(ctx context.Context, mode CaptureMode) (string, error) {
+	area, err := sc.captureArgs(ctx, mode)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := outputPath(sc.screenshotDir, "Screenshot", "png")
+	if err != nil {
+		return "", err
+	}
+
+	result, err := sc.shell.Execute(ctx, fmt.Sprintf("grim %s '%s'", area, path), &utility.ExecOptions{
+		Timeout: 15 * time.Second,
+	})
+	if err != nil {
+		return "", fmt.Errorf("grim failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("grim failed: %s", result.Stderr)
+	}
+
+	// Also copy to the clipboard when wl-copy is available
+	sc.shell.Execute(ctx, fmt.Sprintf("command -v wl-copy >/dev/null && wl-copy --type image/png < '%s'", path), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+
+	sc.logger.Info("Screenshot saved to %s", path)
+	utility.GetNotifier().Notify("Screenshot saved", path, utility.UrgencyLow)
+	return path, nil
+}
+
+// recordingState returns the PID and output file paths of the active recording
+func (sc *ScreenCapture) recordingState() (pidFile, pathFile string) {
+	return filepath.Join(sc.stateDir, "recording.pid"), filepath.Join(sc.stateDir, "recording.path")
+}
+
+// ActiveRecording returns the PID and output path of the running recording, if any
+func (sc *ScreenCapture) ActiveRecording() (int, string, bool) {
+	pidFile, pathFile := sc.recordingState()
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, "", false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || syscall.Kill(pid, 0) != nil {
+		return 0, "", false
+	}
+	path, _ := os.ReadFile(pathFile)
+	return pid, strings.TrimSpace(string(path)), true
+}
+
+// StartRecording launches wf-recorder in the background and returns the output path
+func (sc *ScreenCapture) StartRecording(ctx context.Context, mode CaptureMode, audio bool) (string, error) {
+	if _, path, ok := sc.ActiveRecording(); ok {
+		return "", fmt.Errorf("already recording to %s", path)
+	}
+	if _, err := exec.LookPath("wf-recorder"); err != nil {
+		return "", fmt.Errorf("wf-recorder not found: %w", err)
+	}
+
+	area, err := sc.captureArgs(ctx, mode)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := outputPath(sc.recordingDir, "Recording", "mp4")
+	if err != nil {
+		return "", err
+	}
+
+	command := fmt.Sprintf("exec wf-recorder %s -f '%s'", area, path)
+	if audio {
+		command += " --audio"
+	}
+
+	cmd := exec.Command("bash", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start wf-recorder: %w", err)
+	}
+
+	pidFile, pathFile := sc.recordingState()
+	if _, err := utility.EnsureDir(sc.stateDir); err != nil {
+		cmd.Process.Kill()
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
+	os.WriteFile(pathFile, []byte(path), 0644)
+	cmd.Process.Release()
+
+	sc.logger.Info("Recording started: %s", path)
+	utility.GetNotifier().Notify("Recording started", path, utility.UrgencyLow)
+	return path, nil
+}
+
+// StopRecording stops the active recording and returns the output path
+func (sc *ScreenCapture) StopRecording() (string, error) {
+	pid, path, ok := sc.ActiveRecording()
+	if !ok {
+		return "", fmt.Errorf("no recording in progress")
+	}
+
+	// wf-recorder finalizes the file on SIGINT
+	if err := syscall.Kill(pid, syscall.SIGINT); err != nil {
+		return "", fmt.Errorf("failed to stop recording: %w", err)
+	}
+	for i := 0; i < 100 && syscall.Kill(pid, 0) == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pidFile, pathFile := sc.recordingState()
+	os.Remove(pidFile)
+	os.Remove(pathFile)
+
+	sc.logger.Info("Recording saved to %s", path)
+	utility.GetNotifier().Notify("Recording saved", path, utility.UrgencyNormal)
+	return path, nil
+}
@@ -0,0 +1,292 @@
+/**
+ * Session hooks - run user shell commands on desktop events
+ *
+ * Lock/idle state comes from logind, monitors and the focused workspace from
+ * the compositor. Hooks receive event details in DAEMIRA_* environment
+ * variables and run in the background so a slow hook never delays others.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// SessionEvent is a desktop event that can trigger a hook
+type SessionEvent string
+
+const (
+	EventLock            SessionEvent = "lock"
+	EventUnlock          SessionEvent = "unlock"
+	EventIdle            SessionEvent = "idle"
+	EventActive          SessionEvent = "active"
+	EventMonitorAdded    SessionEvent = "monitor-added"
+	EventMonitorRemoved  SessionEvent = "monitor-removed"
+	EventWorkspaceChange SessionEvent = "workspace-change"
+)
+
+// SessionEvents lists all supported events
+var SessionEvents = []SessionEvent{
+	EventLock,
+	EventUnlock,
+	EventIdle,
+	EventActive,
+	EventMonitorAdded,
+	EventMonitorRemoved,
+	EventWorkspaceChange,
+}
+
+// ParseSessionEvent validates an event name
+func ParseSessionEvent(name string) (SessionEvent, error) {
+	for _, event := range SessionEvents {
+		if string(event) == name {
+			return event, nil
+		}
+	}
+	names := make([]string, 0, len(SessionEvents))
+	for _, event := range SessionEvents {
+		names = append(names, string(event))
+	}
+	return "", fmt.Errorf("unknown session event %q (expected one of: %s)", name, strings.Join(names, ", "))
+}
+
+// sessionState is a snapshot used to detect events between polls
+type sessionState struct {
+	locked    bool
+	idle      bool
+	monitors  map[string]bool
+	workspace string
+}
+
+// SessionHooks runs configured commands when desktop events occur
+type SessionHooks struct {
+	logger     *utility.Logger
+	shell      *utility.Shell
+	session    *SessionMonitor
+	display    *DisplayMonitor
+	compositor *CompositorMonitor
+	hooks      map[SessionEvent]string
+	last       *sessionState
+	isRunning  bool
+	stopChan   chan struct{}
+	ticker     *time.Ticker
+	mu         sync.Mutex
+}
+
+// NewSessionHooks creates a new SessionHooks instance; events without a command are ignored
+func NewSessionHooks(logger *utility.Logger, hooks map[SessionEvent]string) *SessionHooks {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	configured := make(map[SessionEvent]string)
+	for event, command := range hooks {
+		if strings.TrimSpace(command) != "" {
+			configured[event] = command
+		}
+	}
+
+	return &SessionHooks{
+		logger:     logger.With("hooks"),
+		shell:      utility.NewShell(logger),
+		session:    GetSessionMonitor(),
+		display:    GetDisplayMonitor(),
+		compositor: GetCompositorMonitor(),
+		hooks:      configured,
+	}
+}
+
+// IsConfigured returns true if at least one hook is set
+func (sh *SessionHooks) IsConfigured() bool {
+	return len(sh.hooks) > 0
+}
+
+// Hooks returns the configured hooks
+func (sh *SessionHooks) Hooks() map[SessionEvent]string {
+	return sh.hooks
+}
+
+// Start polls the session for events every 2 seconds
+func (sh *SessionHooks) Start() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.isRunning {
+		sh.logger.Warn("Session hooks already running")
+		return
+	}
+
+	sh.isRunning = true
+	sh.stopChan = make(chan struct{})
+	sh.ticker = time.NewTicker(2 * time.Second)
+	sh.logger.Info("Starting session hooks (%d configured)", len(sh.hooks))
+
+	go utility.Supervise("session-hooks", func() {
+		for {
+			select {
+			case <-sh.ticker.C:
+				sh.poll(context.Background())
+			case <-sh.stopChan:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts event polling
+func (sh *SessionHooks) Stop() {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !sh.isRunning {
+		return
+	}
+
+	sh.isRunning = false
+	sh.ticker.Stop()
+	close(sh.stopChan)
+	sh.logger.Info("Session hooks stopped")
+}
+
+// snapshot reads the current session state
+func (sh *SessionHooks) snapshot(ctx context.Context) *sessionState {
+	state := &sessionState{monitors: make(map[string]bool)}
+
+	if info, err := sh.session.GetSessionInfo(ctx); err == nil {
+		state.locked = info.Locked
+		state.idle = info.Idle
+	}
+
+	if sh.display.IsAvailable() {
+		if monitors, err := sh.display.GetMonitors(ctx); err == nil {
+			for _, m := range monitors {
+				state.monitors[m.Name] = true
+				if m.Focused {
+					state.workspace = m.ActiveWorkspace.Name
+					if state.workspace == "" {
+						state.workspace = strconv.Itoa(m.ActiveWorkspace.ID)
+					}
+				}
+			}
+		}
+	}
+	return state
+}
+
+// poll compares the session state with the last poll and fires hooks for changes
+func (sh *SessionHooks) poll(ctx context.Context) {
+	current := sh.snapshot(ctx)
+
+	sh.mu.Lock()
+	last := sh.last
+	sh.last = current
+	sh.mu.Unlock()
+
+	if last == nil {
+		return
+	}
+
+	if current.locked != last.locked {
+		if current.locked {
+			sh.Fire(ctx, EventLock, nil)
+		} else {
+			sh.Fire(ctx, EventUnlock, nil)
+		}
+	}
+	if current.idle != last.idle {
+		if current.idle {
+			sh.Fire(ctx, EventIdle, nil)
+		} else {
+			sh.Fire(ctx, EventActive, nil)
+		}
+	}
+
+	// An empty monitor list means the query failed, not that everything was unplugged
+	if len(current.monitors) > 0 && len(last.monitors) > 0 {
+		for _, name := range sortedKeys(current.monitors) {
+			if !last.monitors[name] {
+				sh.Fire(ctx, EventMonitorAdded, map[string]string{"DAEMIRA_MONITOR": name})
+			}
+		}
+		for _, name := range sortedKeys(last.monitors) {
+			if !current.monitors[name] {
+				sh.Fire(ctx, EventMonitorRemoved, map[string]string{"DAEMIRA_MONITOR": name})
+			}
+		}
+	}
+
+	if current.workspace != "" && last.workspace != "" && current.workspace != last.workspace {
+		sh.Fire(ctx, EventWorkspaceChange, map[string]string{
+			"DAEMIRA_WORKSPACE":          current.workspace,
+			"DAEMIRA_PREVIOUS_WORKSPACE": last.workspace,
+		})
+	}
+}
+
+// sortedKeys returns map keys in a stable order
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Fire runs the hook for an event in the background, if one is configured
+func (sh *SessionHooks) Fire(ctx context.Context, event SessionEvent, env map[string]string) {
+	command, ok := sh.hooks[event]
+	if !ok {
+		sh.logger.Debug("Session event: %s", event)
+		return
+	}
+
+	utility.Go("session-hook", func() {
+		if err := sh.Run(ctx, event, command, env); err != nil {
+			sh.logger.Warn("%v", err)
+		}
+	})
+}
+
+// Run executes a hook command and waits for it to finish
+func (sh *SessionHooks) Run(ctx context.Context, event SessionEvent, command string, env map[string]string) error {
+	vars := map[string]string{"DAEMIRA_EVENT": string(event)}
+	for key, value := range env {
+		vars[key] = value
+	}
+
+	sh.logger.Info("Session event %s: running hook", event)
+	result, err := sh.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: time.Minute,
+		Env:     vars,
+	})
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", event, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s hook exited with code %d: %s", event, result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	sh.logger.Debug("%s hook completed in %v", event, result.Duration)
+	return nil
+}
+
+// FormatHooks formats the configured hooks for display
+func (sh *SessionHooks) FormatHooks() string {
+	lines := []string{"Session Hooks:"}
+	for _, event := range SessionEvents {
+		command, ok := sh.hooks[event]
+		if !ok {
+			command = "(none)"
+		}
+		lines = append(lines, fmt.Sprintf("  %-17s %s", string(event)+":", command))
+	}
+	return strings.Join(lines, "\n")
+}
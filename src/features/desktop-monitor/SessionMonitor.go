@@ -6,6 +6,7 @@ package desktopmonitor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
@@ -33,7 +34,7 @@ var (
 func GetSessionMonitor() *SessionMonitor {
 	sessionMonitorOnce.Do(func() {
 		sessionMonitorInstance = &SessionMonitor{
-			logger: utility.GetLogger(),
+			logger: utility.GetLogger().With("session"),
 			shell:  utility.NewShell(utility.GetLogger()),
 		}
 	})
@@ -123,6 +124,14 @@ func (sm *SessionMonitor) parseLoginctlOutput(output string) *SessionInfo {
 		display = os.Getenv("DISPLAY")
 	}
 
+	// IdleSinceHint is in microseconds since the epoch
+	var idleSince time.Time
+	if idle {
+		if us, err := strconv.ParseInt(props["IdleSinceHint"], 10, 64); err == nil && us > 0 {
+			idleSince = time.UnixMicro(us)
+		}
+	}
+
 	return &SessionInfo{
 		SessionID: sessionID,
 		User:      user,
@@ -134,6 +143,7 @@ func (sm *SessionMonitor) parseLoginctlOutput(output string) *SessionInfo {
 		Locked:    locked,
 		VT:        vt,
 		Display:   display,
+		IdleSince: idleSince,
 	}
 }
 
@@ -188,6 +198,62 @@ func (sm *SessionMonitor) GetIdleStatus(ctx context.Context) (bool, error) {
 	return info.Idle, nil
 }
 
+// GetIdleDuration returns how long the session has been idle (0 if active)
+func (sm *SessionMonitor) GetIdleDuration(ctx context.Context) (time.Duration, error) {
+	info, err := sm.GetSessionInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Idle || info.IdleSince.IsZero() {
+		return 0, nil
+	}
+	return time.Since(info.IdleSince), nil
+}
+
+// GetInhibitors lists active logind inhibitor locks
+func (sm *SessionMonitor) GetInhibitors(ctx context.Context) ([]Inhibitor, error) {
+	result, err := sm.shell.Execute(ctx, "busctl --json=short call org.freedesktop.login1 /org/freedesktop/login1 org.freedesktop.login1.Manager ListInhibitors", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inhibitors: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to list inhibitors: %s", result.Stderr)
+	}
+
+	// Reply signature is a(ssssuu): what, who, why, mode, uid, pid
+	var reply struct {
+		Data [][][]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &reply); err != nil {
+		return nil, fmt.Errorf("failed to parse inhibitors: %w", err)
+	}
+
+	inhibitors := []Inhibitor{}
+	if len(reply.Data) == 0 {
+		return inhibitors, nil
+	}
+	for _, entry := range reply.Data[0] {
+		if len(entry) != 6 {
+			continue
+		}
+		inhibitor := Inhibitor{}
+		inhibitor.What, _ = entry[0].(string)
+		inhibitor.Who, _ = entry[1].(string)
+		inhibitor.Why, _ = entry[2].(string)
+		inhibitor.Mode, _ = entry[3].(string)
+		if uid, ok := entry[4].(float64); ok {
+			inhibitor.UID = int(uid)
+		}
+		if pid, ok := entry[5].(float64); ok {
+			inhibitor.PID = int(pid)
+		}
+		inhibitors = append(inhibitors, inhibitor)
+	}
+	return inhibitors, nil
+}
+
 // LockSession locks the current session
 func (sm *SessionMonitor) LockSession(ctx context.Context) error {
 	sessionID := os.Getenv("XDG_SESSION_ID")
@@ -0,0 +1,533 @@
+/**
+ * Sway backend - queries sway (or i3) state via the i3 IPC protocol (swaymsg / i3-msg)
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// SwayBackend implements CompositorBackend using swaymsg or i3-msg
+type SwayBackend struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+	i3     bool
+}
+
+// swayVersion is the reply to get_version
+type swayVersion struct {
+	HumanReadable string `json:"human_readable"`
+	Major         int    `json:"major"`
+	Minor         int    `json:"minor"`
+	Patch         int    `json:"patch"`
+}
+
+// swayWorkspace is an entry in the reply to get_workspaces
+type swayWorkspace struct {
+	Num     int    `json:"num"`
+	Name    string `json:"name"`
+	Focused bool   `json:"focused"`
+	Visible bool   `json:"visible"`
+	Output  string `json:"output"`
+}
+
+// swayRect is a node or output geometry
+type swayRect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// swayNode is a node in the reply to get_tree
+type swayNode struct {
+	ID               int64      `json:"id"`
+	Name             string     `json:"name"`
+	Type             string     `json:"type"`
+	Num              int        `json:"num"`
+	Focused          bool       `json:"focused"`
+	PID              int        `json:"pid"`
+	AppID            string     `json:"app_id"`
+	FullscreenMode   int        `json:"fullscreen_mode"`
+	Visible          bool       `json:"visible"`
+	Rect             swayRect   `json:"rect"`
+	Nodes            []swayNode `json:"nodes"`
+	FloatingNodes    []swayNode `json:"floating_nodes"`
+	WindowProperties *struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+}
+
+// swayOutput is an entry in the reply to get_outputs
+type swayOutput struct {
+	Name             string   `json:"name"`
+	Make             string   `json:"make"`
+	Model            string   `json:"model"`
+	Serial           string   `json:"serial"`
+	Active           bool     `json:"active"`
+	Focused          bool     `json:"focused"`
+	DPMS             bool     `json:"dpms"`
+	Power            *bool    `json:"power"`
+	Scale            float64  `json:"scale"`
+	Transform        string   `json:"transform"`
+	AdaptiveSync     string   `json:"adaptive_sync_status"`
+	CurrentWorkspace string   `json:"current_workspace"`
+	Rect             swayRect `json:"rect"`
+	CurrentMode      *struct {
+		Width   int `json:"width"`
+		Height  int `json:"height"`
+		Refresh int `json:"refresh"` // mHz
+	} `json:"current_mode"`
+}
+
+// NewSwayBackend creates a new sway backend; set i3 to talk to i3 via i3-msg instead
+func NewSwayBackend(logger *utility.Logger, shell *utility.Shell, i3 bool) *SwayBackend {
+	return &SwayBackend{
+		logger: logger,
+		shell:  shell,
+		i3:     i3,
+	}
+}
+
+// Type returns the compositor type
+func (sb *SwayBackend) Type() CompositorType {
+	if sb.i3 {
+		return CompositorTypeI3
+	}
+	return CompositorTypeSway
+}
+
+// IsAvailable checks if sway/i3 is available
+func (sb *SwayBackend) IsAvailable() bool {
+	if sb.i3 {
+		return os.Getenv("I3SOCK") != ""
+	}
+	return os.Getenv("SWAYSOCK") != ""
+}
+
+// displayName returns the human readable compositor name
+func (sb *SwayBackend) displayName() string {
+	if sb.i3 {
+		return "i3"
+	}
+	return "Sway"
+}
+
+// query runs an IPC message and unmarshals the JSON reply
+func (sb *SwayBackend) query(ctx context.Context, messageType string, target interface{}) error {
+	command := fmt.Sprintf("swaymsg -r -t %s", messageType)
+	if sb.i3 {
+		command = fmt.Sprintf("i3-msg -t %s", messageType)
+	}
+
+	result, err := sb.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s exited with code %d: %s", command, result.ExitCode, result.Stderr)
+	}
+
+	if err := json.Unmarshal([]byte(result.Stdout), target); err != nil {
+		return fmt.Errorf("failed to parse %s reply: %w", messageType, err)
+	}
+	return nil
+}
+
+// GetCompositorInfo gets compositor information
+func (sb *SwayBackend) GetCompositorInfo(ctx context.Context) (*CompositorInfo, error) {
+	var version swayVersion
+	if err := sb.query(ctx, "get_version", &version); err != nil {
+		sb.logger.Error("%s get_version failed: %v", sb.displayName(), err)
+		return &CompositorInfo{
+			Name:      sb.displayName(),
+			Version:   "unknown",
+			Available: false,
+		}, nil
+	}
+
+	versionStr := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+	if version.Major == 0 && version.Minor == 0 && version.HumanReadable != "" {
+		versionStr = version.HumanReadable
+	}
+
+	return &CompositorInfo{
+		Name:      sb.displayName(),
+		Version:   versionStr,
+		Available: true,
+	}, nil
+}
+
+// GetWorkspaces gets all workspaces
+func (sb *SwayBackend) GetWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	var swayWorkspaces []swayWorkspace
+	if err := sb.query(ctx, "get_workspaces", &swayWorkspaces); err != nil {
+		sb.logger.Error("%s get_workspaces failed: %v", sb.displayName(), err)
+		return []WorkspaceInfo{}, err
+	}
+
+	// Window counts come from the tree
+	var tree swayNode
+	windowsByWorkspace := make(map[string][]WindowInfo)
+	if err := sb.query(ctx, "get_tree", &tree); err == nil {
+		for _, window := range sb.collectWindows(&tree, "", 0) {
+			windowsByWorkspace[window.Workspace.Name] = append(windowsByWorkspace[window.Workspace.Name], window)
+		}
+	}
+
+	workspaces := make([]WorkspaceInfo, 0, len(swayWorkspaces))
+	for _, ws := range swayWorkspaces {
+		info := WorkspaceInfo{
+			ID:      ws.Num,
+			Name:    ws.Name,
+			Monitor: ws.Output,
+		}
+		windows := windowsByWorkspace[ws.Name]
+		info.Windows = len(windows)
+		for _, window := range windows {
+			if fullscreen, ok := window.Fullscreen.(bool); ok && fullscreen {
+				info.HasFullscreen = true
+			}
+			info.LastWindow = window.Address
+			info.LastWindowTitle = window.Title
+		}
+		workspaces = append(workspaces, info)
+	}
+
+	return workspaces, nil
+}
+
+// GetWindows gets all windows
+func (sb *SwayBackend) GetWindows(ctx context.Context) ([]WindowInfo, error) {
+	var tree swayNode
+	if err := sb.query(ctx, "get_tree", &tree); err != nil {
+		sb.logger.Error("%s get_tree failed: %v", sb.displayName(), err)
+		return []WindowInfo{}, err
+	}
+	return sb.collectWindows(&tree, "", 0), nil
+}
+
+// GetActiveWindow gets the active window
+func (sb *SwayBackend) GetActiveWindow(ctx context.Context) (*WindowInfo, error) {
+	var tree swayNode
+	if err := sb.query(ctx, "get_tree", &tree); err != nil {
+		return nil, nil
+	}
+
+	for _, window := range sb.collectWindows(&tree, "", 0) {
+		if window.Focused {
+			w := window
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+// collectWindows walks the layout tree and returns all leaf windows
+func (sb *SwayBackend) collectWindows(node *swayNode, workspaceName string, workspaceNum int) []WindowInfo {
+	var windows []WindowInfo
+
+	if node.Type == "workspace" {
+		workspaceName = node.Name
+		workspaceNum = node.Num
+	}
+
+	isLeaf := len(node.Nodes) == 0 && len(node.FloatingNodes) == 0
+	if isLeaf && (node.Type == "con" || node.Type == "floating_con") && (node.PID > 0 || node.WindowProperties != nil) {
+		class := node.AppID
+		if class == "" && node.WindowProperties != nil {
+			class = node.WindowProperties.Class
+		}
+
+		window := WindowInfo{
+			Address:    fmt.Sprintf("%d", node.ID),
+			Title:      node.Name,
+			Class:      class,
+			PID:        node.PID,
+			Floating:   node.Type == "floating_con",
+			Fullscreen: node.FullscreenMode != 0,
+			Mapped:     true,
+			Hidden:     workspaceName == "__i3_scratch",
+			Focused:    node.Focused,
+			At:         [2]int{node.Rect.X, node.Rect.Y},
+			Size:       [2]int{node.Rect.Width, node.Rect.Height},
+		}
+		window.Workspace.ID = workspaceNum
+		window.Workspace.Name = workspaceName
+		windows = append(windows, window)
+	}
+
+	for i := range node.Nodes {
+		windows = append(windows, sb.collectWindows(&node.Nodes[i], workspaceName, workspaceNum)...)
+	}
+	for i := range node.FloatingNodes {
+		windows = append(windows, sb.collectWindows(&node.FloatingNodes[i], workspaceName, workspaceNum)...)
+	}
+
+	return windows
+}
+
+// GetMonitors gets all outputs
+func (sb *SwayBackend) GetMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	var outputs []swayOutput
+	if err := sb.query(ctx, "get_outputs", &outputs); err != nil {
+		sb.logger.Error("%s get_outputs failed: %v", sb.displayName(), err)
+		return []MonitorInfo{}, err
+	}
+
+	monitors := make([]MonitorInfo, 0, len(outputs))
+	for i, output := range outputs {
+		if !output.Active {
+			continue
+		}
+
+		monitor := MonitorInfo{
+			ID:          i,
+			Name:        output.Name,
+			Description: fmt.Sprintf("%s %s %s", output.Make, output.Model, output.Serial),
+			Make:        output.Make,
+			Model:       output.Model,
+			Serial:      output.Serial,
+			X:           output.Rect.X,
+			Y:           output.Rect.Y,
+			Scale:       output.Scale,
+			Transform:   swayTransformToInt(output.Transform),
+			VRR:         output.AdaptiveSync == "enabled",
+			DPMSStatus:  output.DPMS,
+			Focused:     output.Focused,
+		}
+		if output.Power != nil {
+			monitor.DPMSStatus = *output.Power
+		}
+		if monitor.Scale == 0 {
+			monitor.Scale = 1
+		}
+		if output.CurrentMode != nil {
+			monitor.Width = output.CurrentMode.Width
+			monitor.Height = output.CurrentMode.Height
+			monitor.RefreshRate = float64(output.CurrentMode.Refresh) / 1000
+		} else {
+			monitor.Width = output.Rect.Width
+			monitor.Height = output.Rect.Height
+		}
+		monitor.ActiveWorkspace.Name = output.CurrentWorkspace
+		fmt.Sscanf(output.CurrentWorkspace, "%d", &monitor.ActiveWorkspace.ID)
+
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
+
+// swayTransformToInt maps sway transform names to Hyprland-style transform numbers
+func swayTransformToInt(transform string) int {
+	switch transform {
+	case "90":
+		return 1
+	case "180":
+		return 2
+	case "270":
+		return 3
+	case "flipped":
+		return 4
+	case "flipped-90":
+		return 5
+	case "flipped-180":
+		return 6
+	case "flipped-270":
+		return 7
+	default:
+		return 0
+	}
+}
+
+// ConfigureOutput applies an output layout via the `output` IPC command
+func (sb *SwayBackend) ConfigureOutput(ctx context.Context, layout OutputLayout) error {
+	if sb.i3 {
+		return fmt.Errorf("i3 does not support runtime output configuration, use xrandr")
+	}
+
+	command := fmt.Sprintf("swaymsg output '%s' enable mode %dx%d@%.3fHz position %d %d scale %.2f transform %s",
+		layout.Name, layout.Width, layout.Height, layout.RefreshRate, layout.X, layout.Y, layout.Scale, transformName(layout.Transform))
+
+	result, err := sb.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("swaymsg output failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("swaymsg output failed for %s: %s", layout.Name, result.Stderr)
+	}
+	return nil
+}
+
+// transformName maps Hyprland-style transform numbers to sway/niri transform names
+func transformName(transform int) string {
+	names := []string{"normal", "90", "180", "270", "flipped", "flipped-90", "flipped-180", "flipped-270"}
+	if transform < 0 || transform >= len(names) {
+		return "normal"
+	}
+	return names[transform]
+}
+
+// i3 IPC message types used for event subscriptions
+const (
+	swayIPCMagic           = "i3-ipc"
+	swayIPCSubscribe       = 2
+	swayIPCWindowEventType = 0x80000003
+)
+
+// writeIPCMessage writes a single i3 IPC message
+func writeIPCMessage(w io.Writer, messageType uint32, payload []byte) error {
+	header := make([]byte, len(swayIPCMagic)+8)
+	copy(header, swayIPCMagic)
+	binary.LittleEndian.PutUint32(header[len(swayIPCMagic):], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[len(swayIPCMagic)+4:], messageType)
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readIPCMessage reads a single i3 IPC message
+func readIPCMessage(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, len(swayIPCMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(swayIPCMagic)]) != swayIPCMagic {
+		return 0, nil, fmt.Errorf("invalid IPC magic %q", header[:len(swayIPCMagic)])
+	}
+
+	length := binary.LittleEndian.Uint32(header[len(swayIPCMagic):])
+	messageType := binary.LittleEndian.Uint32(header[len(swayIPCMagic)+4:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return messageType, payload, nil
+}
+
+// SubscribeWindowEvents subscribes to window::new events over the IPC socket
+func (sb *SwayBackend) SubscribeWindowEvents(ctx context.Context, handler func(WindowInfo)) error {
+	socketPath := os.Getenv("SWAYSOCK")
+	if sb.i3 {
+		socketPath = os.Getenv("I3SOCK")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s IPC socket: %w", sb.displayName(), err)
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := writeIPCMessage(conn, swayIPCSubscribe, []byte(`["window"]`)); err != nil {
+		return fmt.Errorf("failed to subscribe to window events: %w", err)
+	}
+
+	for {
+		messageType, payload, err := readIPCMessage(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%s IPC read failed: %w", sb.displayName(), err)
+		}
+		if messageType != swayIPCWindowEventType {
+			continue
+		}
+
+		var event struct {
+			Change    string   `json:"change"`
+			Container swayNode `json:"container"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil || event.Change != "new" {
+			continue
+		}
+
+		for _, window := range sb.collectWindows(&event.Container, "", 0) {
+			handler(window)
+		}
+	}
+}
+
+// command runs a sway/i3 command
+func (sb *SwayBackend) command(ctx context.Context, command string) error {
+	tool := "swaymsg"
+	if sb.i3 {
+		tool = "i3-msg"
+	}
+
+	result, err := sb.shell.Execute(ctx, fmt.Sprintf("%s \"%s\"", tool, command), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", tool, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s %s failed: %s %s", tool, command, result.Stdout, result.Stderr)
+	}
+	return nil
+}
+
+// MoveWindowToWorkspace moves a container to a workspace
+func (sb *SwayBackend) MoveWindowToWorkspace(ctx context.Context, window WindowInfo, workspace string) error {
+	return sb.command(ctx, fmt.Sprintf("[con_id=%s] move container to workspace %s", window.Address, workspace))
+}
+
+// SetWindowFloating floats or tiles a container
+func (sb *SwayBackend) SetWindowFloating(ctx context.Context, window WindowInfo, floating bool) error {
+	state := "disable"
+	if floating {
+		state = "enable"
+	}
+	return sb.command(ctx, fmt.Sprintf("[con_id=%s] floating %s", window.Address, state))
+}
+
+// MoveWorkspaceToOutput moves a workspace by selecting it through its windows,
+// which avoids switching focus (empty workspaces have nothing to move)
+func (sb *SwayBackend) MoveWorkspaceToOutput(ctx context.Context, workspace WorkspaceInfo, output string) error {
+	if workspace.Windows == 0 {
+		return nil
+	}
+	return sb.command(ctx, fmt.Sprintf("[workspace=^%s$] move workspace to output %s", regexp.QuoteMeta(workspace.Name), output))
+}
+
+// SetOutputsPower turns all outputs on or off
+func (sb *SwayBackend) SetOutputsPower(ctx context.Context, on bool) error {
+	state := "off"
+	if on {
+		state = "on"
+	}
+
+	if sb.i3 {
+		result, err := sb.shell.Execute(ctx, fmt.Sprintf("xset dpms force %s", state), &utility.ExecOptions{
+			Timeout: 5 * time.Second,
+		})
+		if err != nil || result.ExitCode != 0 {
+			return fmt.Errorf("xset dpms force %s failed: %v", state, err)
+		}
+		return nil
+	}
+	return sb.command(ctx, fmt.Sprintf("output * power %s", state))
+}
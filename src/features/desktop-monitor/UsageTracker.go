@@ -0,0 +1,364 @@
+/**
+ * Usage tracker - time spent per application, from the focused window
+ *
+ * The focused window is sampled every few seconds while the session is
+ * active (not idle or locked) and accumulated into one JSON file per day in
+ * $XDG_STATE_HOME/daemira/usage. Window titles are only kept when enabled,
+ * and excluded applications are never recorded.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// AppUsage is the time spent in one application
+type AppUsage struct {
+	Seconds float64            `json:"seconds"`
+	Titles  map[string]float64 `json:"titles,omitempty"`
+}
+
+// UsageDay is the usage recorded on one day
+type UsageDay struct {
+	Date string               `json:"date"`
+	Apps map[string]*AppUsage `json:"apps"`
+}
+
+// AppTotal is an application's total in a usage report
+type AppTotal struct {
+	App       string
+	Duration  time.Duration
+	TopTitles []string
+}
+
+// UsageOptions configures the usage tracker
+type UsageOptions struct {
+	Exclude      []string      // application classes (case-insensitive substrings) never recorded
+	RecordTitles bool          // also keep time per window title
+	Interval     time.Duration // sampling interval, default 5s
+}
+
+// UsageTracker records time spent per application
+type UsageTracker struct {
+	logger     *utility.Logger
+	session    *SessionMonitor
+	compositor *CompositorMonitor
+	options    UsageOptions
+	dir        string
+	today      *UsageDay
+	dirty      bool
+	isRunning  bool
+	stopChan   chan struct{}
+	ticker     *time.Ticker
+	mu         sync.Mutex
+}
+
+// NewUsageTracker creates a new UsageTracker instance
+func NewUsageTracker(logger *utility.Logger, options *UsageOptions) *UsageTracker {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	opts := UsageOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+
+	return &UsageTracker{
+		logger:     logger.With("usage"),
+		session:    GetSessionMonitor(),
+		compositor: GetCompositorMonitor(),
+		options:    opts,
+		dir:        filepath.Join(utility.StateDir(), "usage"),
+	}
+}
+
+// Start samples the focused window every interval and saves once a minute
+func (ut *UsageTracker) Start() error {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	if ut.isRunning {
+		ut.logger.Warn("Usage tracker already running")
+		return nil
+	}
+	if !ut.compositor.IsAvailable() {
+		return fmt.Errorf("no supported compositor detected")
+	}
+
+	ut.isRunning = true
+	ut.stopChan = make(chan struct{})
+	ut.ticker = time.NewTicker(ut.options.Interval)
+	ut.logger.Info("Starting usage tracker (interval: %v)", ut.options.Interval)
+
+	go utility.Supervise("usage-tracker", func() {
+		lastFlush := time.Now()
+		for {
+			select {
+			case now := <-ut.ticker.C:
+				ut.sample(context.Background(), now)
+				if now.Sub(lastFlush) >= time.Minute {
+					if err := ut.flush(); err != nil {
+						ut.logger.Warn("Failed to save usage: %v", err)
+					}
+					lastFlush = now
+				}
+			case <-ut.stopChan:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop halts the tracker and saves pending usage
+func (ut *UsageTracker) Stop() {
+	ut.mu.Lock()
+	if !ut.isRunning {
+		ut.mu.Unlock()
+		return
+	}
+	ut.isRunning = false
+	ut.ticker.Stop()
+	close(ut.stopChan)
+	ut.mu.Unlock()
+
+	if err := ut.flush(); err != nil {
+		ut.logger.Warn("Failed to save usage: %v", err)
+	}
+	ut.logger.Info("Usage tracker stopped")
+}
+
+// SetExclude replaces the applications never recorded
+func (ut *UsageTracker) SetExclude(exclude []string) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	ut.options.Exclude = exclude
+	ut.logger.Info("Usage tracking exclusions updated (%d)", len(exclude))
+}
+
+// IsExcluded returns true if an application must not be recorded
+func (ut *UsageTracker) IsExcluded(class string) bool {
+	ut.mu.Lock()
+	exclude := ut.options.Exclude
+	ut.mu.Unlock()
+
+	lower := strings.ToLower(class)
+	for _, pattern := range exclude {
+		if pattern != "" && strings.Contains(lower, strings.ToLower(pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sample adds one interval to the focused application
+func (ut *UsageTracker) sample(ctx context.Context, now time.Time) {
+	if info, err := ut.session.GetSessionInfo(ctx); err == nil && (info.Idle || info.Locked) {
+		return
+	}
+
+	window, err := ut.compositor.GetActiveWindow(ctx)
+	if err != nil || window == nil || window.Class == "" || ut.IsExcluded(window.Class) {
+		return
+	}
+
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	date := now.Format("2006-01-02")
+	if ut.today == nil || ut.today.Date != date {
+		if ut.today != nil && ut.dirty {
+			// Day rolled over: save yesterday before starting a new file
+			if err := ut.store(ut.today); err != nil {
+				ut.logger.Warn("Failed to save usage: %v", err)
+			}
+		}
+		day, err := ut.LoadDay(date)
+		if err != nil {
+			ut.logger.Warn("Failed to load usage for %s: %v", date, err)
+			day = &UsageDay{Date: date, Apps: make(map[string]*AppUsage)}
+		}
+		ut.today = day
+	}
+
+	app, ok := ut.today.Apps[window.Class]
+	if !ok {
+		app = &AppUsage{}
+		ut.today.Apps[window.Class] = app
+	}
+	seconds := ut.options.Interval.Seconds()
+	app.Seconds += seconds
+	if ut.options.RecordTitles && window.Title != "" {
+		if app.Titles == nil {
+			app.Titles = make(map[string]float64)
+		}
+		app.Titles[window.Title] += seconds
+	}
+	ut.dirty = true
+}
+
+// flush writes today's usage to disk if it changed
+func (ut *UsageTracker) flush() error {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	if ut.today == nil || !ut.dirty {
+		return nil
+	}
+	if err := ut.store(ut.today); err != nil {
+		return err
+	}
+	ut.dirty = false
+	return nil
+}
+
+// dayPath returns the file holding a day's usage
+func (ut *UsageTracker) dayPath(date string) string {
+	return filepath.Join(ut.dir, date+".json")
+}
+
+// LoadDay reads the usage recorded on a date (YYYY-MM-DD)
+func (ut *UsageTracker) LoadDay(date string) (*UsageDay, error) {
+	day := &UsageDay{Date: date, Apps: make(map[string]*AppUsage)}
+
+	data, err := os.ReadFile(ut.dayPath(date))
+	if os.IsNotExist(err) {
+		return day, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage: %w", err)
+	}
+	if err := json.Unmarshal(data, day); err != nil {
+		return nil, fmt.Errorf("failed to parse usage: %w", err)
+	}
+	if day.Apps == nil {
+		day.Apps = make(map[string]*AppUsage)
+	}
+	return day, nil
+}
+
+// store writes a day's usage atomically so readers never see a partial file
+func (ut *UsageTracker) store(day *UsageDay) error {
+	if _, err := utility.EnsureDir(ut.dir); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(day, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage: %w", err)
+	}
+
+	path := ut.dayPath(day.Date)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write usage: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write usage: %w", err)
+	}
+	return nil
+}
+
+// Report totals usage over the given number of days ending today, longest first
+func (ut *UsageTracker) Report(days int) ([]AppTotal, time.Duration, error) {
+	if days < 1 {
+		days = 1
+	}
+
+	apps := make(map[string]*AppUsage)
+	now := time.Now()
+	for i := 0; i < days; i++ {
+		day, err := ut.LoadDay(now.AddDate(0, 0, -i).Format("2006-01-02"))
+		if err != nil {
+			return nil, 0, err
+		}
+		for name, usage := range day.Apps {
+			if ut.IsExcluded(name) {
+				continue
+			}
+			total, ok := apps[name]
+			if !ok {
+				total = &AppUsage{Titles: make(map[string]float64)}
+				apps[name] = total
+			}
+			total.Seconds += usage.Seconds
+			for title, seconds := range usage.Titles {
+				total.Titles[title] += seconds
+			}
+		}
+	}
+
+	totals := make([]AppTotal, 0, len(apps))
+	var sum time.Duration
+	for name, usage := range apps {
+		titles := make([]string, 0, len(usage.Titles))
+		for title := range usage.Titles {
+			titles = append(titles, title)
+		}
+		sort.Slice(titles, func(i, j int) bool {
+			return usage.Titles[titles[i]] > usage.Titles[titles[j]]
+		})
+		if len(titles) > 3 {
+			titles = titles[:3]
+		}
+
+		duration := time.Duration(usage.Seconds * float64(time.Second))
+		sum += duration
+		totals = append(totals, AppTotal{App: name, Duration: duration, TopTitles: titles})
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Duration != totals[j].Duration {
+			return totals[i].Duration > totals[j].Duration
+		}
+		return totals[i].App < totals[j].App
+	})
+	return totals, sum, nil
+}
+
+// formatUsageDuration formats a duration as "2h 05m" or "12m"
+func formatUsageDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh %02dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// FormatUsageReport formats a usage report for display
+func (ut *UsageTracker) FormatUsageReport(title string, totals []AppTotal, sum time.Duration) string {
+	if len(totals) == 0 {
+		return fmt.Sprintf("%s:\n  No usage recorded", title)
+	}
+
+	lines := []string{fmt.Sprintf("%s (total %s):", title, formatUsageDuration(sum))}
+	for _, total := range totals {
+		percent := 0.0
+		if sum > 0 {
+			percent = float64(total.Duration) / float64(sum) * 100
+		}
+		lines = append(lines, fmt.Sprintf("  %-24s %8s  %5.1f%%", total.App, formatUsageDuration(total.Duration), percent))
+		for _, t := range total.TopTitles {
+			lines = append(lines, fmt.Sprintf("      %s", t))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
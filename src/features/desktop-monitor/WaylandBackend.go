@@ -0,0 +1,291 @@
+/**
+ * Generic Wayland backend - display information for compositors without a dedicated backend
+ *
+ * Outputs are read from, in order of preference:
+ * - wlr-randr --json (wlr-output-management, most wlroots compositors)
+ * - kscreen-doctor -j (KDE Plasma)
+ * - /sys/class/drm connector state (works everywhere, including GNOME)
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// WaylandBackend implements CompositorBackend for unsupported Wayland compositors
+type WaylandBackend struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+}
+
+// wlrRandrOutput is an entry in the reply to `wlr-randr --json`
+type wlrRandrOutput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Make        string `json:"make"`
+	Model       string `json:"model"`
+	Serial      string `json:"serial"`
+	Enabled     bool   `json:"enabled"`
+	Modes       []struct {
+		Width   int     `json:"width"`
+		Height  int     `json:"height"`
+		Refresh float64 `json:"refresh"`
+		Current bool    `json:"current"`
+	} `json:"modes"`
+	Position struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	} `json:"position"`
+	Transform    string  `json:"transform"`
+	Scale        float64 `json:"scale"`
+	AdaptiveSync bool    `json:"adaptive_sync"`
+}
+
+// kscreenOutput is an entry in the reply to `kscreen-doctor -j`
+type kscreenOutput struct {
+	Name          string  `json:"name"`
+	Enabled       bool    `json:"enabled"`
+	Connected     bool    `json:"connected"`
+	Scale         float64 `json:"scale"`
+	Rotation      int     `json:"rotation"`
+	CurrentModeID string  `json:"currentModeId"`
+	Pos           struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	} `json:"pos"`
+	Modes []struct {
+		ID          string  `json:"id"`
+		RefreshRate float64 `json:"refreshRate"`
+		Size        struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"size"`
+	} `json:"modes"`
+}
+
+// NewWaylandBackend creates a new generic Wayland backend
+func NewWaylandBackend(logger *utility.Logger, shell *utility.Shell) *WaylandBackend {
+	return &WaylandBackend{
+		logger: logger,
+		shell:  shell,
+	}
+}
+
+// Type returns the compositor type
+func (wb *WaylandBackend) Type() CompositorType {
+	return CompositorTypeWayland
+}
+
+// IsAvailable checks if a Wayland session is running
+func (wb *WaylandBackend) IsAvailable() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != "" || strings.EqualFold(os.Getenv("XDG_SESSION_TYPE"), "wayland")
+}
+
+// GetCompositorInfo reports the desktop name from the session environment
+func (wb *WaylandBackend) GetCompositorInfo(ctx context.Context) (*CompositorInfo, error) {
+	name := os.Getenv("XDG_CURRENT_DESKTOP")
+	if name == "" {
+		name = os.Getenv("XDG_SESSION_DESKTOP")
+	}
+	if name == "" {
+		name = "Wayland"
+	}
+
+	return &CompositorInfo{
+		Name:      name,
+		Version:   "unknown",
+		Available: true,
+	}, nil
+}
+
+// GetWorkspaces is not supported without compositor IPC
+func (wb *WaylandBackend) GetWorkspaces(ctx context.Context) ([]WorkspaceInfo, error) {
+	return []WorkspaceInfo{}, nil
+}
+
+// GetWindows is not supported without compositor IPC
+func (wb *WaylandBackend) GetWindows(ctx context.Context) ([]WindowInfo, error) {
+	return []WindowInfo{}, nil
+}
+
+// GetActiveWindow is not supported without compositor IPC
+func (wb *WaylandBackend) GetActiveWindow(ctx context.Context) (*WindowInfo, error) {
+	return nil, nil
+}
+
+// GetMonitors gets all outputs using the first source that works
+func (wb *WaylandBackend) GetMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	monitors, err := wb.getWlrRandrMonitors(ctx)
+	if err == nil {
+		return monitors, nil
+	}
+	wb.logger.Debug("wlr-randr unavailable: %v", err)
+
+	monitors, err = wb.getKScreenMonitors(ctx)
+	if err == nil {
+		return monitors, nil
+	}
+	wb.logger.Debug("kscreen-doctor unavailable: %v", err)
+
+	return wb.getDRMMonitors()
+}
+
+// getWlrRandrMonitors reads outputs via wlr-output-management
+func (wb *WaylandBackend) getWlrRandrMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	result, err := wb.shell.Execute(ctx, "wlr-randr --json", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("wlr-randr exited with code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	var outputs []wlrRandrOutput
+	if err := json.Unmarshal([]byte(result.Stdout), &outputs); err != nil {
+		return nil, fmt.Errorf("failed to parse wlr-randr output: %w", err)
+	}
+
+	monitors := make([]MonitorInfo, 0, len(outputs))
+	for i, output := range outputs {
+		if !output.Enabled {
+			continue
+		}
+
+		monitor := MonitorInfo{
+			ID:          i,
+			Name:        output.Name,
+			Description: output.Description,
+			Make:        output.Make,
+			Model:       output.Model,
+			Serial:      output.Serial,
+			X:           output.Position.X,
+			Y:           output.Position.Y,
+			Scale:       output.Scale,
+			Transform:   swayTransformToInt(output.Transform),
+			VRR:         output.AdaptiveSync,
+			DPMSStatus:  true,
+		}
+		for _, mode := range output.Modes {
+			if mode.Current {
+				monitor.Width = mode.Width
+				monitor.Height = mode.Height
+				monitor.RefreshRate = mode.Refresh
+			}
+		}
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
+
+// getKScreenMonitors reads outputs from KDE's kscreen
+func (wb *WaylandBackend) getKScreenMonitors(ctx context.Context) ([]MonitorInfo, error) {
+	result, err := wb.shell.Execute(ctx, "kscreen-doctor -j", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("kscreen-doctor exited with code %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	var reply struct {
+		Outputs []kscreenOutput `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &reply); err != nil {
+		return nil, fmt.Errorf("failed to parse kscreen-doctor output: %w", err)
+	}
+
+	monitors := make([]MonitorInfo, 0, len(reply.Outputs))
+	for i, output := range reply.Outputs {
+		if !output.Enabled || !output.Connected {
+			continue
+		}
+
+		monitor := MonitorInfo{
+			ID:         i,
+			Name:       output.Name,
+			X:          output.Pos.X,
+			Y:          output.Pos.Y,
+			Scale:      output.Scale,
+			DPMSStatus: true,
+		}
+		// kscreen rotation is a bitmask: 1=none, 2=left, 4=inverted, 8=right
+		switch output.Rotation {
+		case 2:
+			monitor.Transform = 1
+		case 4:
+			monitor.Transform = 2
+		case 8:
+			monitor.Transform = 3
+		}
+		for _, mode := range output.Modes {
+			if mode.ID == output.CurrentModeID {
+				monitor.Width = mode.Size.Width
+				monitor.Height = mode.Size.Height
+				monitor.RefreshRate = mode.RefreshRate
+			}
+		}
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
+
+// getDRMMonitors reads connected outputs from DRM connector state in sysfs
+func (wb *WaylandBackend) getDRMMonitors() ([]MonitorInfo, error) {
+	connectors, err := filepath.Glob("/sys/class/drm/card*-*")
+	if err != nil {
+		return []MonitorInfo{}, err
+	}
+	sort.Strings(connectors)
+
+	monitors := []MonitorInfo{}
+	for _, connector := range connectors {
+		status, err := os.ReadFile(filepath.Join(connector, "status"))
+		if err != nil || strings.TrimSpace(string(status)) != "connected" {
+			continue
+		}
+
+		// card1-eDP-1 -> eDP-1
+		name := filepath.Base(connector)
+		if idx := strings.Index(name, "-"); idx >= 0 {
+			name = name[idx+1:]
+		}
+
+		monitor := MonitorInfo{
+			ID:    len(monitors),
+			Name:  name,
+			Scale: 1,
+		}
+
+		if enabled, err := os.ReadFile(filepath.Join(connector, "enabled")); err == nil {
+			monitor.DPMSStatus = strings.TrimSpace(string(enabled)) == "enabled"
+		}
+
+		// The first listed mode is the preferred one
+		if modes, err := os.ReadFile(filepath.Join(connector, "modes")); err == nil {
+			lines := strings.Split(strings.TrimSpace(string(modes)), "\n")
+			if len(lines) > 0 {
+				fmt.Sscanf(lines[0], "%dx%d", &monitor.Width, &monitor.Height)
+			}
+		}
+
+		monitors = append(monitors, monitor)
+	}
+
+	return monitors, nil
+}
@@ -0,0 +1,284 @@
+/**
+ * Window rules - dynamic window placement driven by config
+ *
+ * Rules are written as space-separated key=value pairs, e.g.
+ *
+ *   class=^firefox$ workspace=2
+ *   class=pavucontrol floating=true
+ *   title=Picture-in-Picture monitor=HDMI-A-1
+ *
+ * Matchers (class, title) are regular expressions; use \s for spaces.
+ * Actions are workspace, monitor (moves to the monitor's active workspace)
+ * and floating. Rules are enforced whenever a window opens, and can be
+ * applied to all existing windows with Arrange.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// WindowRule matches windows by class/title and places them
+type WindowRule struct {
+	Raw       string
+	Class     *regexp.Regexp
+	Title     *regexp.Regexp
+	Workspace string
+	Monitor   string
+	Floating  *bool
+}
+
+// ParseWindowRule parses a single "key=value key=value" rule
+func ParseWindowRule(rule string) (*WindowRule, error) {
+	wr := &WindowRule{Raw: strings.TrimSpace(rule)}
+
+	for _, field := range strings.Fields(rule) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid window rule field %q (expected key=value)", field)
+		}
+
+		switch strings.ToLower(key) {
+		case "class":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid class pattern %q: %w", value, err)
+			}
+			wr.Class = re
+		case "title":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid title pattern %q: %w", value, err)
+			}
+			wr.Title = re
+		case "workspace":
+			wr.Workspace = value
+		case "monitor":
+			wr.Monitor = value
+		case "floating":
+			floating, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid floating value %q: %w", value, err)
+			}
+			wr.Floating = &floating
+		default:
+			return nil, fmt.Errorf("unknown window rule key %q", key)
+		}
+	}
+
+	if wr.Class == nil && wr.Title == nil {
+		return nil, fmt.Errorf("window rule %q needs a class or title matcher", wr.Raw)
+	}
+	if wr.Workspace == "" && wr.Monitor == "" && wr.Floating == nil {
+		return nil, fmt.Errorf("window rule %q has no action (workspace, monitor or floating)", wr.Raw)
+	}
+
+	return wr, nil
+}
+
+// ParseWindowRules parses a list of rules, returning the first error encountered
+func ParseWindowRules(rules []string) ([]*WindowRule, error) {
+	parsed := make([]*WindowRule, 0, len(rules))
+	for _, rule := range rules {
+		wr, err := ParseWindowRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, wr)
+	}
+	return parsed, nil
+}
+
+// Matches checks whether the rule applies to a window
+func (wr *WindowRule) Matches(window WindowInfo) bool {
+	if wr.Class != nil && !wr.Class.MatchString(window.Class) {
+		return false
+	}
+	if wr.Title != nil && !wr.Title.MatchString(window.Title) {
+		return false
+	}
+	return true
+}
+
+// WindowRulesEngine enforces window rules on window-open events
+type WindowRulesEngine struct {
+	logger     *utility.Logger
+	compositor *CompositorMonitor
+	rules      []*WindowRule
+	isRunning  bool
+	cancel     context.CancelFunc
+	mu         sync.Mutex
+}
+
+// NewWindowRulesEngine creates a new window rules engine
+func NewWindowRulesEngine(logger *utility.Logger, rules []*WindowRule) *WindowRulesEngine {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	return &WindowRulesEngine{
+		logger:     logger.With("window-rules"),
+		compositor: GetCompositorMonitor(),
+		rules:      rules,
+	}
+}
+
+// Rules returns the configured rules
+func (we *WindowRulesEngine) Rules() []*WindowRule {
+	return we.rules
+}
+
+// dispatcher returns the backend's window dispatcher, if supported
+func (we *WindowRulesEngine) dispatcher() (WindowDispatcher, error) {
+	if !we.compositor.IsAvailable() {
+		return nil, fmt.Errorf("no supported compositor detected")
+	}
+	dispatcher, ok := we.compositor.Backend().(WindowDispatcher)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support window rules", we.compositor.Backend().Type())
+	}
+	return dispatcher, nil
+}
+
+// Start subscribes to window events and enforces rules until Stop is called
+func (we *WindowRulesEngine) Start() error {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	if we.isRunning {
+		we.logger.Warn("Window rules engine already running")
+		return nil
+	}
+
+	if _, err := we.dispatcher(); err != nil {
+		return err
+	}
+	source, ok := we.compositor.Backend().(WindowEventSource)
+	if !ok {
+		return fmt.Errorf("%s does not provide window events", we.compositor.Backend().Type())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	we.cancel = cancel
+	we.isRunning = true
+	we.logger.Info("Starting window rules engine (%d rules)", len(we.rules))
+
+	go utility.Supervise("window-rules", func() {
+		for {
+			err := source.SubscribeWindowEvents(ctx, func(window WindowInfo) {
+				we.applyRules(ctx, window)
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			we.logger.Warn("Window event stream ended: %v (reconnecting in 5s)", err)
+
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// Stop halts the engine
+func (we *WindowRulesEngine) Stop() {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	if !we.isRunning {
+		return
+	}
+
+	we.isRunning = false
+	we.cancel()
+	we.logger.Info("Window rules engine stopped")
+}
+
+// IsRunning reports whether the engine is listening for window events
+func (we *WindowRulesEngine) IsRunning() bool {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	return we.isRunning
+}
+
+// Arrange applies the rules to every existing window and returns the number of windows moved
+func (we *WindowRulesEngine) Arrange(ctx context.Context) (int, error) {
+	if _, err := we.dispatcher(); err != nil {
+		return 0, err
+	}
+
+	windows, err := we.compositor.GetWindows(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list windows: %w", err)
+	}
+
+	arranged := 0
+	for _, window := range windows {
+		if we.applyRules(ctx, window) {
+			arranged++
+		}
+	}
+	return arranged, nil
+}
+
+// applyRules applies the first matching rule to a window and reports whether one matched
+func (we *WindowRulesEngine) applyRules(ctx context.Context, window WindowInfo) bool {
+	dispatcher, err := we.dispatcher()
+	if err != nil {
+		return false
+	}
+
+	for _, rule := range we.rules {
+		if !rule.Matches(window) {
+			continue
+		}
+
+		we.logger.Debug("Window rule %q matched %s (%s)", rule.Raw, window.Class, window.Title)
+
+		workspace := rule.Workspace
+		if workspace == "" && rule.Monitor != "" {
+			workspace = we.monitorWorkspace(ctx, rule.Monitor)
+		}
+		if workspace != "" && workspace != window.Workspace.Name {
+			if err := dispatcher.MoveWindowToWorkspace(ctx, window, workspace); err != nil {
+				we.logger.Error("Window rule %q: %v", rule.Raw, err)
+			}
+		}
+
+		if rule.Floating != nil && *rule.Floating != window.Floating {
+			if err := dispatcher.SetWindowFloating(ctx, window, *rule.Floating); err != nil {
+				we.logger.Error("Window rule %q: %v", rule.Raw, err)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// monitorWorkspace returns the name of the active workspace on a monitor
+func (we *WindowRulesEngine) monitorWorkspace(ctx context.Context, monitorName string) string {
+	monitors, err := GetDisplayMonitor().GetMonitors(ctx)
+	if err != nil {
+		return ""
+	}
+	for _, m := range monitors {
+		if m.Name == monitorName {
+			return m.ActiveWorkspace.Name
+		}
+	}
+	we.logger.Warn("Window rule target monitor %s not connected", monitorName)
+	return ""
+}
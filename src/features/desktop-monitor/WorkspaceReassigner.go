@@ -0,0 +1,288 @@
+/**
+ * Workspace reassigner - move workspaces between outputs on monitor hotplug
+ *
+ * Rules pin workspaces to outputs in order of preference, e.g.
+ *
+ *   workspace=1 outputs=DP-1,eDP-1
+ *   workspace=web outputs=Dell
+ *
+ * Outputs match by connector name or by a substring of the monitor
+ * description (make/model), which survives connector renames between docks.
+ * Whenever the set of connected monitors changes, each workspace moves to
+ * its first connected preferred output, and workspaces left on a vanished
+ * output move to the focused one so no windows are lost after undocking.
+ */
+
+package desktopmonitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// WorkspaceOutputRule pins a workspace to outputs in order of preference
+type WorkspaceOutputRule struct {
+	Raw       string
+	Workspace string
+	Outputs   []string
+}
+
+// ParseWorkspaceOutputRule parses a single "workspace=X outputs=A,B" rule
+func ParseWorkspaceOutputRule(rule string) (*WorkspaceOutputRule, error) {
+	wr := &WorkspaceOutputRule{Raw: strings.TrimSpace(rule)}
+
+	for _, field := range strings.Fields(rule) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid workspace rule field %q (expected key=value)", field)
+		}
+
+		switch strings.ToLower(key) {
+		case "workspace":
+			wr.Workspace = value
+		case "outputs", "output":
+			for _, output := range strings.Split(value, ",") {
+				if output = strings.TrimSpace(output); output != "" {
+					wr.Outputs = append(wr.Outputs, output)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown workspace rule key %q", key)
+		}
+	}
+
+	if wr.Workspace == "" || len(wr.Outputs) == 0 {
+		return nil, fmt.Errorf("workspace rule %q needs a workspace and at least one output", wr.Raw)
+	}
+	return wr, nil
+}
+
+// ParseWorkspaceOutputRules parses a list of rules, returning the first error encountered
+func ParseWorkspaceOutputRules(rules []string) ([]*WorkspaceOutputRule, error) {
+	parsed := make([]*WorkspaceOutputRule, 0, len(rules))
+	for _, rule := range rules {
+		wr, err := ParseWorkspaceOutputRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, wr)
+	}
+	return parsed, nil
+}
+
+// matchesWorkspace checks whether the rule applies to a workspace (by name or number)
+func (wr *WorkspaceOutputRule) matchesWorkspace(ws WorkspaceInfo) bool {
+	return wr.Workspace == ws.Name || wr.Workspace == strconv.Itoa(ws.ID)
+}
+
+// WorkspaceMove is a workspace moved by the reassigner
+type WorkspaceMove struct {
+	Workspace string
+	From      string
+	To        string
+}
+
+// WorkspaceReassigner moves workspaces to the right outputs when monitors change
+type WorkspaceReassigner struct {
+	logger        *utility.Logger
+	compositor    *CompositorMonitor
+	display       *DisplayMonitor
+	rules         []*WorkspaceOutputRule
+	lastSignature string
+	isRunning     bool
+	stopChan      chan struct{}
+	ticker        *time.Ticker
+	mu            sync.Mutex
+}
+
+// NewWorkspaceReassigner creates a new WorkspaceReassigner instance
+func NewWorkspaceReassigner(logger *utility.Logger, rules []*WorkspaceOutputRule) *WorkspaceReassigner {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	return &WorkspaceReassigner{
+		logger:     logger.With("workspaces"),
+		compositor: GetCompositorMonitor(),
+		display:    GetDisplayMonitor(),
+		rules:      rules,
+	}
+}
+
+// mover returns the backend's WorkspaceMover implementation
+func (wr *WorkspaceReassigner) mover() (WorkspaceMover, error) {
+	if !wr.compositor.IsAvailable() {
+		return nil, fmt.Errorf("no supported compositor detected")
+	}
+	mover, ok := wr.compositor.Backend().(WorkspaceMover)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support moving workspaces between outputs", wr.compositor.Backend().Type())
+	}
+	return mover, nil
+}
+
+// Start checks for monitor changes every 3 seconds
+func (wr *WorkspaceReassigner) Start() error {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.isRunning {
+		wr.logger.Warn("Workspace reassigner already running")
+		return nil
+	}
+	if _, err := wr.mover(); err != nil {
+		return err
+	}
+
+	wr.isRunning = true
+	wr.stopChan = make(chan struct{})
+	wr.ticker = time.NewTicker(3 * time.Second)
+	wr.logger.Info("Starting workspace reassigner (%d rules)", len(wr.rules))
+
+	go utility.Supervise("workspace-reassigner", func() {
+		for {
+			select {
+			case <-wr.ticker.C:
+				wr.check(context.Background())
+			case <-wr.stopChan:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop halts the reassigner
+func (wr *WorkspaceReassigner) Stop() {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if !wr.isRunning {
+		return
+	}
+
+	wr.isRunning = false
+	wr.ticker.Stop()
+	close(wr.stopChan)
+	wr.logger.Info("Workspace reassigner stopped")
+}
+
+// check reassigns workspaces when the connected monitor set changes
+func (wr *WorkspaceReassigner) check(ctx context.Context) {
+	monitors, err := wr.display.GetMonitors(ctx)
+	if err != nil || len(monitors) == 0 {
+		return
+	}
+
+	sig := monitorSignature(monitors)
+	wr.mu.Lock()
+	changed := wr.lastSignature != "" && wr.lastSignature != sig
+	wr.lastSignature = sig
+	wr.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	// Give the compositor a moment to finish its own rearrangement
+	time.Sleep(time.Second)
+	moves, err := wr.Reassign(ctx)
+	if err != nil {
+		wr.logger.Error("Failed to reassign workspaces: %v", err)
+		return
+	}
+	for _, move := range moves {
+		wr.logger.Info("Moved workspace %s from %s to %s", move.Workspace, move.From, move.To)
+	}
+}
+
+// resolveOutput finds a connected monitor by connector name or description substring
+func resolveOutput(monitors []MonitorInfo, want string) string {
+	lower := strings.ToLower(want)
+	for _, m := range monitors {
+		if m.Name == want {
+			return m.Name
+		}
+	}
+	for _, m := range monitors {
+		if strings.Contains(strings.ToLower(m.Description), lower) {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// targetOutput returns where a workspace belongs, or "" if it should stay put
+func (wr *WorkspaceReassigner) targetOutput(ws WorkspaceInfo, monitors []MonitorInfo, fallback string) string {
+	for _, rule := range wr.rules {
+		if !rule.matchesWorkspace(ws) {
+			continue
+		}
+		for _, want := range rule.Outputs {
+			if output := resolveOutput(monitors, want); output != "" {
+				return output
+			}
+		}
+		break
+	}
+
+	// Orphaned: its output is gone
+	if ws.Monitor != "" && resolveOutput(monitors, ws.Monitor) == "" {
+		return fallback
+	}
+	return ""
+}
+
+// Reassign moves every workspace to its preferred connected output and rescues orphans
+func (wr *WorkspaceReassigner) Reassign(ctx context.Context) ([]WorkspaceMove, error) {
+	mover, err := wr.mover()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors, err := wr.display.GetMonitors(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read monitors: %w", err)
+	}
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no monitors detected")
+	}
+	workspaces, err := wr.compositor.GetWorkspaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspaces: %w", err)
+	}
+
+	fallback := monitors[0].Name
+	for _, m := range monitors {
+		if m.Focused {
+			fallback = m.Name
+			break
+		}
+	}
+
+	moves := []WorkspaceMove{}
+	var errs []string
+	for _, ws := range workspaces {
+		target := wr.targetOutput(ws, monitors, fallback)
+		if target == "" || target == ws.Monitor {
+			continue
+		}
+
+		if err := mover.MoveWorkspaceToOutput(ctx, ws, target); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", ws.Name, err))
+			continue
+		}
+		moves = append(moves, WorkspaceMove{Workspace: ws.Name, From: ws.Monitor, To: target})
+	}
+
+	if len(errs) > 0 {
+		return moves, fmt.Errorf("failed to move workspaces: %s", strings.Join(errs, "; "))
+	}
+	return moves, nil
+}
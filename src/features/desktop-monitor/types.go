@@ -4,6 +4,8 @@
 
 package desktopmonitor
 
+import "time"
+
 // SessionInfo represents session information
 type SessionInfo struct {
 	SessionID string
@@ -16,6 +18,17 @@ type SessionInfo struct {
 	Locked    bool
 	VT        int
 	Display   string
+	IdleSince time.Time // zero unless idle
+}
+
+// Inhibitor represents a systemd-logind inhibitor lock
+type Inhibitor struct {
+	What string // colon-separated: idle, sleep, shutdown, handle-lid-switch, ...
+	Who  string
+	Why  string
+	Mode string // 'block' | 'delay'
+	UID  int
+	PID  int
 }
 
 // CompositorInfo represents compositor information
@@ -56,6 +69,9 @@ type WindowInfo struct {
 	Mapped     bool
 	Hidden     bool
 	Pinned     bool
+	Focused    bool
+	At         [2]int // top-left position in the global layout
+	Size       [2]int
 }
 
 // MonitorInfo represents monitor information
@@ -79,6 +95,32 @@ type MonitorInfo struct {
 	Transform  int
 	VRR        bool
 	DPMSStatus bool
+	Focused    bool
+}
+
+// AudioDevice represents an audio sink or source
+type AudioDevice struct {
+	Index         int
+	Name          string
+	Description   string
+	Kind          string // 'sink' | 'source'
+	Bus           string // 'pci' | 'usb' | 'bluetooth' | ...
+	VolumePercent int
+	Muted         bool
+	IsDefault     bool
+	ActivePort    string
+	Ports         []string
+}
+
+// BluetoothDevice represents a paired Bluetooth device
+type BluetoothDevice struct {
+	Address   string
+	Name      string
+	Icon      string // 'audio-headset' | 'input-mouse' | ...
+	Paired    bool
+	Trusted   bool
+	Connected bool
+	Battery   int // percent, -1 if not reported
 }
 
 // DesktopStatus represents complete desktop status
@@ -98,5 +140,6 @@ const (
 	CompositorTypeSway     CompositorType = "sway"
 	CompositorTypeNiri     CompositorType = "niri"
 	CompositorTypeI3       CompositorType = "i3"
+	CompositorTypeWayland  CompositorType = "wayland" // generic fallback
 	CompositorTypeUnknown  CompositorType = "unknown"
 )
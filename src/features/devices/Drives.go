@@ -0,0 +1,492 @@
+/**
+ * External drives
+ * Backs up to (or syncs to) known external drives when they are plugged in:
+ * a drive's partition, matched by filesystem UUID, is mounted with
+ * udisksctl, the backup directories are backed up to a restic/borg
+ * repository on it or mirrored onto it with rsync, and it is unmounted so it
+ * can be unplugged. Each step is sent as a notification. An offline copy
+ * next to Google Drive sync.
+ */
+
+package devices
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/backup"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Drive modes
+const (
+	DriveBackup = "backup" // restic/borg snapshots in a repository on the drive
+	DriveSync   = "sync"   // an rsync mirror of the directories on the drive
+)
+
+// DefaultDrivePath is where on a drive its backup or mirror goes
+const DefaultDrivePath = "daemira"
+
+// drivesState is the state store section keeping the last run per drive
+const drivesState = "usb-drives"
+
+// driveBackupState is the state store section the drive backups' own status goes to
+const driveBackupState = "usb-drive-backup"
+
+// driveTimeout bounds one backup or sync to a drive
+const driveTimeout = 6 * time.Hour
+
+// unmountTimeout bounds unmounting a drive, which first writes out what is
+// still cached for it
+const unmountTimeout = 2 * time.Minute
+
+// DriveRule is an external drive to back up to when it is plugged in
+type DriveRule struct {
+	UUID        string // filesystem UUID of the partition
+	Name        string // shown in notifications; the filesystem label by default
+	Mode        string // DriveBackup or DriveSync
+	Path        string // directory on the drive; Default: "daemira"
+	KeepMounted bool   // leave the drive mounted when done
+}
+
+// driveRuleFieldRegex matches the key=value fields of a drive rule
+var driveRuleFieldRegex = regexp.MustCompile(`(\w+)=(\S+)`)
+
+// ParseDriveRule parses a rule such as "uuid=1234-ABCD mode=sync path=mirror"
+func ParseDriveRule(rule string) (*DriveRule, error) {
+	dr := &DriveRule{Mode: DriveBackup, Path: DefaultDrivePath}
+	for _, match := range driveRuleFieldRegex.FindAllStringSubmatch(rule, -1) {
+		key, value := match[1], match[2]
+		switch key {
+		case "uuid":
+			dr.UUID = value
+		case "name":
+			dr.Name = value
+		case "mode":
+			if value != DriveBackup && value != DriveSync {
+				return nil, fmt.Errorf("drive rule %q: mode must be %s or %s", rule, DriveBackup, DriveSync)
+			}
+			dr.Mode = value
+		case "path":
+			dr.Path = strings.Trim(value, "/")
+		case "keep_mounted":
+			dr.KeepMounted = value == "true"
+		default:
+			return nil, fmt.Errorf("drive rule %q: unknown field %q", rule, key)
+		}
+	}
+	if dr.UUID == "" {
+		return nil, fmt.Errorf("drive rule %q has no uuid", rule)
+	}
+	if dr.Path == "" || strings.Contains(dr.Path, "..") {
+		return nil, fmt.Errorf("drive rule %q: path must be a directory inside the drive", rule)
+	}
+	return dr, nil
+}
+
+// ParseDriveRules parses several drive rules
+func ParseDriveRules(rules []string) ([]*DriveRule, error) {
+	parsed := make([]*DriveRule, 0, len(rules))
+	for _, rule := range rules {
+		dr, err := ParseDriveRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, dr)
+	}
+	return parsed, nil
+}
+
+// DriveOptions configures the drive backups
+type DriveOptions struct {
+	Drives      []*DriveRule
+	Directories []string // backed up or mirrored
+	Excludes    []string
+	// NewBackup creates a backup to the repository on a drive; backup mode
+	// needs it, as the repository password is the configured one
+	NewBackup func(ctx context.Context, repository, state string) (*backup.Backup, error)
+}
+
+// DriveStatus is the outcome of the last backup to a drive
+type DriveStatus struct {
+	UUID         string        `json:"uuid"`
+	Name         string        `json:"name"`
+	Mode         string        `json:"mode"`
+	Running      bool          `json:"running"`
+	LastRun      time.Time     `json:"lastRun"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastSuccess  time.Time     `json:"lastSuccess"`
+	LastError    string        `json:"lastError,omitempty"`
+	LastSnapshot string        `json:"lastSnapshot,omitempty"`
+	RunLog       string        `json:"runLog,omitempty"`
+}
+
+// DriveManager backs up to known drives as they are plugged in
+type DriveManager struct {
+	logger     *utility.Logger
+	shell      *utility.Shell
+	options    DriveOptions
+	status     map[string]*DriveStatus // by UUID
+	registered bool
+	cancel     map[string]context.CancelFunc // runs in progress, by UUID
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+var (
+	driveManagerInstance *DriveManager
+	driveManagerOnce     sync.Once
+)
+
+// GetDriveManager returns the singleton DriveManager instance
+func GetDriveManager() *DriveManager {
+	driveManagerOnce.Do(func() {
+		dm := &DriveManager{
+			logger: utility.GetLogger().With("usb-drives"),
+			shell:  utility.NewShell(utility.GetLogger()),
+			cancel: make(map[string]context.CancelFunc),
+		}
+		utility.GetStateStore().Load(drivesState, &dm.status)
+		if dm.status == nil {
+			dm.status = make(map[string]*DriveStatus)
+		}
+		for _, status := range dm.status {
+			status.Running = false
+		}
+		driveManagerInstance = dm
+	})
+	return driveManagerInstance
+}
+
+// SetOptions changes the drives and what is backed up to them
+func (dm *DriveManager) SetOptions(options DriveOptions) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.options = options
+}
+
+// Start backs up to the known drives plugged in from now on
+func (dm *DriveManager) Start() {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if dm.registered {
+		return
+	}
+	dm.registered = true
+	GetUsbMonitor().OnEvent(dm.handle)
+	dm.logger.Info("Backing up to %d external drives when they are plugged in", len(dm.options.Drives))
+}
+
+// Shutdown cancels backups to drives in progress and waits, until ctx is
+// done, for them to unmount
+func (dm *DriveManager) Shutdown(ctx context.Context) error {
+	dm.mu.Lock()
+	for _, cancel := range dm.cancel {
+		cancel()
+	}
+	dm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		dm.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("drive backup still running: %w", ctx.Err())
+	}
+}
+
+// Status returns the outcome of the last backup to each configured drive
+func (dm *DriveManager) Status() []DriveStatus {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	statuses := make([]DriveStatus, 0, len(dm.options.Drives))
+	for _, rule := range dm.options.Drives {
+		status := DriveStatus{UUID: rule.UUID, Name: rule.Name, Mode: rule.Mode}
+		if saved, ok := dm.status[rule.UUID]; ok {
+			status = *saved
+			status.Mode = rule.Mode
+		}
+		statuses = append(statuses, status)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].LastRun.After(statuses[j].LastRun) })
+	return statuses
+}
+
+// handle starts a backup when the partition of a known drive connects
+func (dm *DriveManager) handle(event UsbEvent) {
+	if event.Partition == nil || event.Partition.UUID == "" {
+		return
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	var rule *DriveRule
+	for _, dr := range dm.options.Drives {
+		if strings.EqualFold(dr.UUID, event.Partition.UUID) {
+			rule = dr
+		}
+	}
+	if rule == nil {
+		return
+	}
+	if event.Action == ActionRemove {
+		if cancel, ok := dm.cancel[rule.UUID]; ok {
+			dm.logger.Warn("Drive %s was unplugged during its %s", dm.name(rule, event.Partition), rule.Mode)
+			cancel()
+		}
+		return
+	}
+	if _, ok := dm.cancel[rule.UUID]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), driveTimeout)
+	dm.cancel[rule.UUID] = cancel
+	dm.wg.Add(1)
+	partition := *event.Partition
+	options := dm.options
+	utility.Go("usb-drive", func() {
+		defer dm.wg.Done()
+		defer func() {
+			cancel()
+			dm.mu.Lock()
+			delete(dm.cancel, rule.UUID)
+			dm.mu.Unlock()
+		}()
+		dm.run(ctx, rule, partition, options)
+	})
+}
+
+// run mounts a drive, backs up to it and unmounts it, notifying each step
+func (dm *DriveManager) run(ctx context.Context, rule *DriveRule, partition UsbPartition, options DriveOptions) {
+	name := dm.name(rule, &partition)
+	notifier := utility.GetNotifier()
+	start := time.Now()
+	dm.saveStatus(rule, name, func(status *DriveStatus) { status.Running = true })
+
+	// Keep the machine from suspending mid-backup
+	lock, err := utility.AcquireInhibitor(dm.logger, "sleep:shutdown", "Backing up to "+name)
+	if err != nil {
+		dm.logger.Debug("Backing up without inhibitor lock: %v", err)
+	}
+	defer lock.Release()
+
+	run, err := utility.NewRunLog("usb-drives", name)
+	if err != nil {
+		dm.logger.Debug("Backing up without run log: %v", err)
+	}
+	defer run.Close()
+
+	mountpoint, err := dm.mount(ctx, partition.DevName)
+	if err != nil {
+		dm.finish(rule, name, start, "", run, fmt.Errorf("failed to mount %s: %w", partition.DevName, err))
+		return
+	}
+	dm.logger.Info("Drive %s mounted at %s, starting %s", name, mountpoint, rule.Mode)
+
+	snapshot, err := dm.backUp(ctx, rule, name, filepath.Join(mountpoint, rule.Path), options, run)
+
+	// Unmount even when the backup failed, so the drive can be unplugged
+	if !rule.KeepMounted {
+		if unmountErr := dm.unmount(partition.DevName); unmountErr != nil {
+			dm.logger.Warn("Failed to unmount %s: %v", name, unmountErr)
+			notifier.Notify("Unmount "+name+" before unplugging it", unmountErr.Error(), utility.UrgencyNormal)
+		}
+	}
+	dm.finish(rule, name, start, snapshot, run, err)
+}
+
+// backUp backs up or mirrors the directories to target on a mounted drive
+func (dm *DriveManager) backUp(ctx context.Context, rule *DriveRule, name, target string, options DriveOptions, run *utility.RunLog) (string, error) {
+	notifier := utility.GetNotifier()
+	if rule.Mode == DriveSync {
+		return "", dm.mirror(ctx, name, target, options, run)
+	}
+
+	if options.NewBackup == nil {
+		return "", fmt.Errorf("backups are not set up (set backup.password)")
+	}
+	b, err := options.NewBackup(ctx, target, driveBackupState)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(target, "config")); os.IsNotExist(err) {
+		dm.logger.Info("Creating a %s repository on %s", b.Tool(), name)
+		if err := b.Init(ctx); err != nil {
+			return "", err
+		}
+	}
+	notifier.Notify("Backing up to "+name, fmt.Sprintf("%d directories with %s; leave the drive plugged in", len(options.Directories), b.Tool()), utility.UrgencyLow)
+	run.Println(fmt.Sprintf("Backing up to %s with %s", target, b.Tool()))
+	if err := b.Run(ctx); err != nil {
+		return "", err
+	}
+	return b.GetStatus().LastSnapshot, nil
+}
+
+// mirror copies each directory onto the drive with rsync, removing files
+// deleted since the last mirror
+func (dm *DriveManager) mirror(ctx context.Context, name, target string, options DriveOptions, run *utility.RunLog) error {
+	notifier := utility.GetNotifier()
+	for idx, dir := range options.Directories {
+		if _, err := os.Stat(dir); err != nil {
+			dm.logger.Warn("Not syncing %s: %v", dir, err)
+			continue
+		}
+		dest := filepath.Join(target, strings.TrimPrefix(filepath.Clean(dir), "/"))
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dest, err)
+		}
+
+		notifier.Notify(fmt.Sprintf("Syncing to %s (%d/%d)", name, idx+1, len(options.Directories)), dir, utility.UrgencyLow)
+		args := []string{"-a", "--delete"}
+		for _, exclude := range options.Excludes {
+			args = append(args, "--exclude", exclude)
+		}
+		args = append(args, dir+"/", dest+"/")
+
+		run.Println("$ " + utility.CommandLine(append([]string{"rsync"}, args...)...))
+		result, err := dm.shell.ExecuteArgs(ctx, "rsync", args, &utility.ExecOptions{
+			Timeout:        driveTimeout,
+			MaxOutputBytes: 256 << 10,
+			StdoutCallback: run.Println,
+			StderrCallback: run.Println,
+		})
+		if err != nil {
+			return fmt.Errorf("rsync failed: %w", err)
+		}
+		// 24: files vanished while copying, which the next sync picks up
+		if result.ExitCode != 0 && result.ExitCode != 24 {
+			return fmt.Errorf("rsync of %s failed (exit code %d): %s", dir, result.ExitCode, strings.TrimSpace(result.Stderr))
+		}
+	}
+	return nil
+}
+
+// finish records and announces the outcome of a run
+func (dm *DriveManager) finish(rule *DriveRule, name string, start time.Time, snapshot string, run *utility.RunLog, err error) {
+	duration := time.Since(start).Round(time.Second)
+	dm.saveStatus(rule, name, func(status *DriveStatus) {
+		status.Running = false
+		status.LastRun = start
+		status.LastDuration = duration
+		status.LastError = ""
+		status.RunLog = run.Path()
+		if snapshot != "" {
+			status.LastSnapshot = snapshot
+		}
+		if err != nil {
+			status.LastError = err.Error()
+		} else {
+			status.LastSuccess = start
+		}
+	})
+
+	notifier := utility.GetNotifier()
+	if err != nil {
+		dm.logger.Error("%s to %s failed: %v", driveAction(rule.Mode), name, err)
+		notifier.Notify(fmt.Sprintf("%s to %s failed", driveAction(rule.Mode), name), err.Error(), utility.UrgencyNormal)
+		return
+	}
+	dm.logger.Info("%s to %s done in %s", driveAction(rule.Mode), name, duration)
+	body := "Safe to unplug"
+	if rule.KeepMounted {
+		body = "The drive stays mounted"
+	}
+	notifier.Notify(fmt.Sprintf("%s to %s done in %s", driveAction(rule.Mode), name, duration), body, utility.UrgencyNormal)
+}
+
+// saveStatus changes and saves the status of a drive
+func (dm *DriveManager) saveStatus(rule *DriveRule, name string, change func(status *DriveStatus)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	status, ok := dm.status[rule.UUID]
+	if !ok {
+		status = &DriveStatus{UUID: rule.UUID}
+		dm.status[rule.UUID] = status
+	}
+	status.Name = name
+	status.Mode = rule.Mode
+	change(status)
+	utility.GetStateStore().Save(drivesState, dm.status)
+}
+
+// mount mounts a partition with udisksctl, unless it already is (by an
+// automounter), and returns where
+func (dm *DriveManager) mount(ctx context.Context, devName string) (string, error) {
+	if mountpoint := dm.mountpoint(ctx, devName); mountpoint != "" {
+		return mountpoint, nil
+	}
+
+	result, err := dm.shell.ExecuteArgs(ctx, "udisksctl", []string{"mount", "--block-device", devName, "--no-user-interaction"}, &utility.ExecOptions{
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		return "", err
+	}
+	// An automounter may have got there first
+	if mountpoint := dm.mountpoint(ctx, devName); mountpoint != "" {
+		return mountpoint, nil
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+	return "", fmt.Errorf("udisksctl didn't mount it: %s", strings.TrimSpace(result.Stdout))
+}
+
+// mountpoint returns where a partition is mounted, or ""
+func (dm *DriveManager) mountpoint(ctx context.Context, devName string) string {
+	result, err := dm.shell.ExecuteArgs(ctx, "findmnt", []string{"--noheadings", "--first-only", "--output", "TARGET", "--source", devName}, &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil || result.ExitCode != 0 {
+		return ""
+	}
+	return strings.TrimSpace(result.Stdout)
+}
+
+// unmount unmounts a partition, flushing what was written to it
+func (dm *DriveManager) unmount(devName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), unmountTimeout)
+	defer cancel()
+
+	result, err := dm.shell.ExecuteArgs(ctx, "udisksctl", []string{"unmount", "--block-device", devName, "--no-user-interaction"}, &utility.ExecOptions{
+		Timeout: unmountTimeout,
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// name describes a drive for people: its rule's name, label or UUID
+func (dm *DriveManager) name(rule *DriveRule, partition *UsbPartition) string {
+	return firstNonEmpty(rule.Name, partition.Label, rule.UUID)
+}
+
+// driveAction names what a mode does, for messages
+func driveAction(mode string) string {
+	if mode == DriveSync {
+		return "Sync"
+	}
+	return "Backup"
+}
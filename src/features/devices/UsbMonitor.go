@@ -0,0 +1,568 @@
+/**
+ * USB monitor
+ * Follows udev (`udevadm monitor`) for USB devices and the partitions of
+ * USB drives being connected and disconnected, and reports them with their
+ * vendor and product. Devices are remembered, so a keyboard never seen
+ * before (keystroke injection devices pose as keyboards) can raise an
+ * alert. A hook command runs on every event with the details in DAEMIRA_USB_*
+ * environment variables, e.g. to mount drives somewhere fixed, and other
+ * features can register callbacks.
+ */
+
+package devices
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// USB device kinds, from the classes of their interfaces
+const (
+	KindStorage  = "storage"
+	KindKeyboard = "keyboard"
+	KindMouse    = "mouse"
+	KindHID      = "hid" // other input devices
+	KindAudio    = "audio"
+	KindVideo    = "video"
+	KindWireless = "wireless" // Bluetooth adapters and the like
+	KindHub      = "hub"
+	KindOther    = "other"
+)
+
+// USB event actions
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+)
+
+// usbState is the state store section keeping the devices seen
+const usbState = "usb"
+
+// usbRestartDelay is how long to wait before following udev again
+const usbRestartDelay = 30 * time.Second
+
+// sysfsRoot is where the kernel lists devices
+const sysfsRoot = "/sys"
+
+// UsbDevice is a connected USB device
+type UsbDevice struct {
+	ID      string   `json:"id"` // vendor:product, e.g. "046d:c52b"
+	Serial  string   `json:"serial,omitempty"`
+	Vendor  string   `json:"vendor,omitempty"`
+	Product string   `json:"product,omitempty"`
+	Kinds   []string `json:"kinds"`
+	Port    string   `json:"-"` // bus and port, e.g. "1-2.4"
+}
+
+// Key identifies a device across connections: its ID and serial number
+func (d UsbDevice) Key() string {
+	if d.Serial == "" {
+		return d.ID
+	}
+	return d.ID + ":" + d.Serial
+}
+
+// Name describes a device for people, e.g. "Logitech USB Receiver"
+func (d UsbDevice) Name() string {
+	name := strings.TrimSpace(d.Vendor + " " + d.Product)
+	if name == "" {
+		return d.ID
+	}
+	return name
+}
+
+// Is reports whether a device is of a kind
+func (d UsbDevice) Is(kind string) bool {
+	for _, k := range d.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// UsbPartition is a partition of a USB drive
+type UsbPartition struct {
+	DevName string // e.g. /dev/sdb1
+	UUID    string
+	Label   string
+	FSType  string
+}
+
+// UsbEvent is a device or a partition connected or disconnected
+type UsbEvent struct {
+	Action    string // ActionAdd or ActionRemove
+	Device    UsbDevice
+	Partition *UsbPartition // set for a partition of a drive
+	Known     bool          // the device was connected before
+}
+
+// UsbPolicy decides what happens when devices come and go
+type UsbPolicy struct {
+	Notify               bool   // send a desktop notification for storage and input devices
+	WarnUnknownKeyboards bool   // alert when a keyboard never seen before connects
+	Hook                 string // shell command run on every event
+}
+
+// SeenDevice is a device connected at some point
+type SeenDevice struct {
+	UsbDevice
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UsbMonitor follows USB devices
+type UsbMonitor struct {
+	logger    *utility.Logger
+	shell     *utility.Shell
+	policy    UsbPolicy
+	seen      map[string]*SeenDevice // by Key
+	connected map[string]UsbDevice   // by sysfs path, to describe removed devices
+	callbacks []func(UsbEvent)
+	monitor   *exec.Cmd
+	isRunning bool
+	stopChan  chan struct{}
+	mu        sync.Mutex
+}
+
+var (
+	usbMonitorInstance *UsbMonitor
+	usbMonitorOnce     sync.Once
+)
+
+// GetUsbMonitor returns the singleton UsbMonitor instance
+func GetUsbMonitor() *UsbMonitor {
+	usbMonitorOnce.Do(func() {
+		um := &UsbMonitor{
+			logger:    utility.GetLogger().With("usb"),
+			shell:     utility.NewShell(utility.GetLogger()),
+			connected: make(map[string]UsbDevice),
+		}
+		utility.GetStateStore().Load(usbState, &um.seen)
+		usbMonitorInstance = um
+	})
+	return usbMonitorInstance
+}
+
+// IsAvailable reports whether udev can be followed
+func (um *UsbMonitor) IsAvailable() bool {
+	_, err := exec.LookPath("udevadm")
+	return err == nil
+}
+
+// SetPolicy changes what happens when devices come and go
+func (um *UsbMonitor) SetPolicy(policy UsbPolicy) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.policy = policy
+}
+
+// OnEvent registers a callback run for every event
+func (um *UsbMonitor) OnEvent(callback func(UsbEvent)) {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	um.callbacks = append(um.callbacks, callback)
+}
+
+// Start follows udev until Stop. Devices connected now are remembered; on
+// the first start they are all taken as known.
+func (um *UsbMonitor) Start() error {
+	if !um.IsAvailable() {
+		return fmt.Errorf("udevadm not found")
+	}
+
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if um.isRunning {
+		return nil
+	}
+	um.isRunning = true
+	um.stopChan = make(chan struct{})
+	stop := um.stopChan
+
+	devices, err := ListUsbDevices()
+	if err != nil {
+		um.logger.Warn("Failed to list USB devices: %v", err)
+	}
+	first := um.seen == nil
+	if first {
+		um.seen = make(map[string]*SeenDevice)
+	}
+	for _, device := range devices {
+		um.connected[device.Port] = device
+		if !first && um.seen[device.Key()] == nil {
+			um.logger.Info("USB device connected while the daemon was stopped: %s (%s)", device.Name(), device.ID)
+		}
+		um.remember(device)
+	}
+	um.save()
+	um.logger.Info("Watching USB devices (%d connected)", len(devices))
+
+	go utility.Supervise("usb-monitor", func() {
+		for {
+			if err := um.follow(); err != nil {
+				um.logger.Debug("Following udev failed: %v", err)
+			}
+			// udevadm exits when stopped; follow again after a while otherwise
+			select {
+			case <-stop:
+				return
+			case <-time.After(usbRestartDelay):
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops following udev
+func (um *UsbMonitor) Stop() {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	if !um.isRunning {
+		return
+	}
+	um.isRunning = false
+	close(um.stopChan)
+	if um.monitor != nil && um.monitor.Process != nil {
+		um.monitor.Process.Kill()
+	}
+}
+
+// Seen returns the devices connected at some point, most recent first
+func (um *UsbMonitor) Seen() []SeenDevice {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+
+	seen := make([]SeenDevice, 0, len(um.seen))
+	for _, device := range um.seen {
+		seen = append(seen, *device)
+	}
+	sort.Slice(seen, func(i, j int) bool { return seen[i].LastSeen.After(seen[j].LastSeen) })
+	return seen
+}
+
+// IsKnown reports whether a device was connected before
+func (um *UsbMonitor) IsKnown(device UsbDevice) bool {
+	um.mu.Lock()
+	defer um.mu.Unlock()
+	return um.seen[device.Key()] != nil
+}
+
+// follow reads udev events until udevadm exits
+func (um *UsbMonitor) follow() error {
+	cmd := exec.Command("udevadm", "monitor", "--udev", "--property",
+		"--subsystem-match=usb/usb_device", "--subsystem-match=block/partition")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	um.mu.Lock()
+	if !um.isRunning {
+		um.mu.Unlock()
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		um.mu.Unlock()
+		return err
+	}
+	um.monitor = cmd
+	um.mu.Unlock()
+
+	// Each event is a header line, KEY=value lines and a blank line
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(properties) > 0 {
+				um.handle(properties)
+				properties = make(map[string]string)
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			properties[key] = value
+		}
+	}
+	return cmd.Wait()
+}
+
+// handle turns a udev event into a UsbEvent
+func (um *UsbMonitor) handle(properties map[string]string) {
+	action := properties["ACTION"]
+	if action != ActionAdd && action != ActionRemove {
+		return
+	}
+
+	var event UsbEvent
+	switch properties["SUBSYSTEM"] {
+	case "usb":
+		port := filepath.Base(properties["DEVPATH"])
+		um.mu.Lock()
+		device, ok := um.connected[port]
+		um.mu.Unlock()
+		if action == ActionAdd || !ok {
+			device = deviceFromProperties(properties)
+			device.Port = port
+			if sysfs, err := readUsbDevice(filepath.Join(sysfsRoot, properties["DEVPATH"])); err == nil {
+				device = sysfs
+			}
+		}
+		event = UsbEvent{Action: action, Device: device}
+	case "block":
+		if properties["ID_BUS"] != "usb" {
+			return
+		}
+		event = UsbEvent{
+			Action: action,
+			Device: deviceFromProperties(properties),
+			Partition: &UsbPartition{
+				DevName: properties["DEVNAME"],
+				UUID:    properties["ID_FS_UUID"],
+				Label:   properties["ID_FS_LABEL"],
+				FSType:  properties["ID_FS_TYPE"],
+			},
+		}
+		event.Device.Kinds = []string{KindStorage}
+	default:
+		return
+	}
+	if event.Device.ID == "" || event.Device.Is(KindHub) {
+		return
+	}
+	um.Report(event)
+}
+
+// Report logs an event, remembers its device and applies the policy
+func (um *UsbMonitor) Report(event UsbEvent) {
+	um.mu.Lock()
+	event.Known = um.seen[event.Device.Key()] != nil
+	if event.Partition == nil {
+		if event.Action == ActionAdd {
+			um.connected[event.Device.Port] = event.Device
+			um.remember(event.Device)
+			um.save()
+		} else {
+			delete(um.connected, event.Device.Port)
+		}
+	}
+	policy := um.policy
+	callbacks := append([]func(UsbEvent){}, um.callbacks...)
+	um.mu.Unlock()
+
+	device := event.Device
+	alertID := "usb-keyboard-" + strings.ReplaceAll(device.ID, ":", "-")
+	switch {
+	case event.Partition != nil && event.Action == ActionAdd:
+		um.logger.Info("USB drive partition connected: %s %s (%s, UUID %s)", event.Partition.DevName, event.Partition.Label, event.Partition.FSType, event.Partition.UUID)
+	case event.Partition != nil:
+		um.logger.Info("USB drive partition disconnected: %s", event.Partition.DevName)
+	case event.Action == ActionAdd:
+		um.logger.Info("USB device connected: %s (%s, %s)", device.Name(), device.ID, strings.Join(device.Kinds, ", "))
+		if policy.WarnUnknownKeyboards && device.Is(KindKeyboard) && !event.Known {
+			um.logger.Warn("A keyboard never seen before connected: %s (%s)", device.Name(), device.ID)
+			utility.GetAlerts().Raise(alertID, utility.AlertWarning, "Unknown keyboard connected: "+device.Name(),
+				fmt.Sprintf("USB device %s on port %s types like a keyboard. Unplug it unless you connected it.", device.ID, device.Port))
+		} else if policy.Notify && (device.Is(KindStorage) || device.Is(KindKeyboard) || device.Is(KindMouse) || device.Is(KindHID)) {
+			utility.GetNotifier().Notify("USB device connected", fmt.Sprintf("%s (%s)", device.Name(), strings.Join(device.Kinds, ", ")), utility.UrgencyLow)
+		}
+	default:
+		um.logger.Info("USB device disconnected: %s (%s)", device.Name(), device.ID)
+		utility.GetAlerts().Resolve(alertID)
+	}
+
+	if policy.Hook != "" {
+		utility.Go("usb-hook", func() {
+			if err := um.runHook(policy.Hook, event); err != nil {
+				um.logger.Warn("%v", err)
+			}
+		})
+	}
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
+
+// runHook runs the hook command for an event
+func (um *UsbMonitor) runHook(command string, event UsbEvent) error {
+	vars := map[string]string{
+		"DAEMIRA_USB_ACTION":  event.Action,
+		"DAEMIRA_USB_ID":      event.Device.ID,
+		"DAEMIRA_USB_SERIAL":  event.Device.Serial,
+		"DAEMIRA_USB_VENDOR":  event.Device.Vendor,
+		"DAEMIRA_USB_PRODUCT": event.Device.Product,
+		"DAEMIRA_USB_KINDS":   strings.Join(event.Device.Kinds, ","),
+		"DAEMIRA_USB_KNOWN":   fmt.Sprintf("%v", event.Known),
+	}
+	if event.Partition != nil {
+		vars["DAEMIRA_USB_DEVNAME"] = event.Partition.DevName
+		vars["DAEMIRA_USB_UUID"] = event.Partition.UUID
+		vars["DAEMIRA_USB_LABEL"] = event.Partition.Label
+		vars["DAEMIRA_USB_FSTYPE"] = event.Partition.FSType
+	}
+
+	result, err := um.shell.Execute(context.Background(), command, &utility.ExecOptions{
+		Timeout: time.Minute,
+		Env:     vars,
+	})
+	if err != nil {
+		return fmt.Errorf("USB hook failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("USB hook exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// remember records a device as seen now; the caller holds mu
+func (um *UsbMonitor) remember(device UsbDevice) {
+	now := time.Now()
+	seen, ok := um.seen[device.Key()]
+	if !ok {
+		seen = &SeenDevice{FirstSeen: now}
+		um.seen[device.Key()] = seen
+	}
+	seen.UsbDevice = device
+	seen.LastSeen = now
+}
+
+// save writes the devices seen; the caller holds mu
+func (um *UsbMonitor) save() {
+	utility.GetStateStore().Save(usbState, um.seen)
+}
+
+// ListUsbDevices returns the connected USB devices, hubs left out
+func ListUsbDevices() ([]UsbDevice, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysfsRoot, "bus", "usb", "devices", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var devices []UsbDevice
+	for _, dir := range dirs {
+		// Interfaces are named like "1-2:1.0", devices "1-2"; root hubs "usb1"
+		if strings.Contains(filepath.Base(dir), ":") {
+			continue
+		}
+		device, err := readUsbDevice(dir)
+		if err != nil || device.Is(KindHub) {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Port < devices[j].Port })
+	return devices, nil
+}
+
+// readUsbDevice describes the device in a sysfs directory
+func readUsbDevice(dir string) (UsbDevice, error) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	vendorID, productID := read("idVendor"), read("idProduct")
+	if vendorID == "" || productID == "" {
+		return UsbDevice{}, fmt.Errorf("%s is not a USB device", dir)
+	}
+	device := UsbDevice{
+		ID:      vendorID + ":" + productID,
+		Serial:  read("serial"),
+		Vendor:  read("manufacturer"),
+		Product: read("product"),
+		Port:    filepath.Base(dir),
+	}
+
+	var interfaces []string
+	if class := read("bDeviceClass"); class == "09" {
+		interfaces = append(interfaces, "090000")
+	}
+	ifaces, _ := filepath.Glob(filepath.Join(dir, device.Port+":*"))
+	for _, iface := range ifaces {
+		class, _ := os.ReadFile(filepath.Join(iface, "bInterfaceClass"))
+		subclass, _ := os.ReadFile(filepath.Join(iface, "bInterfaceSubClass"))
+		protocol, _ := os.ReadFile(filepath.Join(iface, "bInterfaceProtocol"))
+		interfaces = append(interfaces, strings.TrimSpace(string(class))+strings.TrimSpace(string(subclass))+strings.TrimSpace(string(protocol)))
+	}
+	device.Kinds = usbKinds(interfaces)
+	return device, nil
+}
+
+// deviceFromProperties describes the device of a udev event
+func deviceFromProperties(properties map[string]string) UsbDevice {
+	device := UsbDevice{Serial: properties["ID_SERIAL_SHORT"]}
+	if properties["ID_VENDOR_ID"] != "" {
+		device.ID = properties["ID_VENDOR_ID"] + ":" + properties["ID_MODEL_ID"]
+	}
+	device.Vendor = firstNonEmpty(properties["ID_VENDOR_FROM_DATABASE"], strings.ReplaceAll(properties["ID_VENDOR"], "_", " "))
+	device.Product = firstNonEmpty(properties["ID_MODEL_FROM_DATABASE"], strings.ReplaceAll(properties["ID_MODEL"], "_", " "))
+	// e.g. ":030101:030102:"
+	device.Kinds = usbKinds(strings.FieldsFunc(properties["ID_USB_INTERFACES"], func(r rune) bool { return r == ':' }))
+	return device
+}
+
+// usbKinds returns the kinds of a device from the class, subclass and
+// protocol of its interfaces, each as six hex digits
+func usbKinds(interfaces []string) []string {
+	var kinds []string
+	add := func(kind string) {
+		for _, k := range kinds {
+			if k == kind {
+				return
+			}
+		}
+		kinds = append(kinds, kind)
+	}
+	for _, iface := range interfaces {
+		if len(iface) < 2 {
+			continue
+		}
+		switch class := strings.ToLower(iface[:2]); {
+		case class == "08":
+			add(KindStorage)
+		case class == "03" && strings.HasSuffix(iface, "0101"):
+			add(KindKeyboard)
+		case class == "03" && strings.HasSuffix(iface, "0102"):
+			add(KindMouse)
+		case class == "03":
+			add(KindHID)
+		case class == "01":
+			add(KindAudio)
+		case class == "0e":
+			add(KindVideo)
+		case class == "e0":
+			add(KindWireless)
+		case class == "09":
+			add(KindHub)
+		}
+	}
+	if len(kinds) == 0 {
+		kinds = append(kinds, KindOther)
+	}
+	return kinds
+}
+
+// firstNonEmpty returns the first of the values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
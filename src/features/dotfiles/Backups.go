@@ -0,0 +1,184 @@
+/**
+ * Config backups
+ * Files replaced while deploying are committed to a local git repository
+ * ($XDG_STATE_HOME/daemira/config-backups) instead of being moved to a new
+ * timestamped directory each run. Every file keeps a stable path in the
+ * repository, so repeated runs add commits rather than directories, and
+ * `git log -p` shows how a config changed between backups.
+ */
+
+package dotfiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// BackupFile is a file or directory to back up and where it goes in the repository
+type BackupFile struct {
+	Source string // absolute path of the file being replaced
+	Path   string // path inside the backup repository
+}
+
+// backupRefPattern matches a backup reference, "<commit>:<path>"
+var backupRefPattern = regexp.MustCompile(`^[0-9a-f]{40}:.+$`)
+
+// IsBackupRef reports whether s refers to a file in the backup repository
+func IsBackupRef(s string) bool {
+	return backupRefPattern.MatchString(s)
+}
+
+// BackupRepo stores replaced configs in a local git repository
+type BackupRepo struct {
+	logger *utility.Logger
+	shell  *utility.Shell
+	dir    string
+}
+
+// NewBackupRepo creates a new BackupRepo
+func NewBackupRepo(logger *utility.Logger) *BackupRepo {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	return &BackupRepo{
+		logger: logger,
+		shell:  utility.NewShell(logger),
+		dir:    filepath.Join(utility.StateDir(), "config-backups"),
+	}
+}
+
+// Dir returns the backup repository location
+func (b *BackupRepo) Dir() string {
+	return b.dir
+}
+
+// git runs a git command in the backup repository
+func (b *BackupRepo) git(ctx context.Context, args string) (*utility.Result, error) {
+	result, err := b.shell.Execute(ctx, "git "+args, &utility.ExecOptions{
+		Timeout: time.Minute,
+		WorkDir: b.dir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w", args, err)
+	}
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("git %s failed: %s", args, strings.TrimSpace(result.Stderr))
+	}
+	return result, nil
+}
+
+// init creates the repository on first use
+func (b *BackupRepo) init(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(b.dir, ".git")); err == nil {
+		return nil
+	}
+	if _, err := utility.EnsureDir(b.dir); err != nil {
+		return fmt.Errorf("failed to create backup repository: %w", err)
+	}
+	for _, args := range []string{"init -q", "config user.name daemira", "config user.email daemira@localhost"} {
+		if _, err := b.git(ctx, args); err != nil {
+			return err
+		}
+	}
+	b.logger.Info("Created config backup repository %s", b.dir)
+	return nil
+}
+
+// Save copies files into the repository and commits them, returning a
+// reference per file for Restore. Files identical to their last backup
+// still get a reference, to the commit that already holds them.
+func (b *BackupRepo) Save(ctx context.Context, files []BackupFile, message string) ([]string, error) {
+	if err := b.init(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		dest := filepath.Join(b.dir, file.Path)
+		if err := os.RemoveAll(dest); err != nil {
+			return nil, fmt.Errorf("failed to replace backup of %s: %w", file.Source, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		result, err := b.shell.Execute(ctx, fmt.Sprintf("cp -a %s %s", utility.ShellQuote(file.Source), utility.ShellQuote(dest)), nil)
+		if err != nil || result.ExitCode != 0 {
+			return nil, fmt.Errorf("failed to back up %s", file.Source)
+		}
+		if _, err := b.git(ctx, "add -A -- "+utility.ShellQuote(file.Path)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Nothing to commit means every file matches its last backup
+	status, err := b.git(ctx, "status --porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(status.Stdout) != "" {
+		if _, err := b.git(ctx, "commit -q -m "+utility.ShellQuote(message)); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := b.git(ctx, "rev-parse HEAD")
+	if err != nil {
+		return nil, err
+	}
+	commit := strings.TrimSpace(result.Stdout)
+
+	refs := make([]string, len(files))
+	for idx, file := range files {
+		refs[idx] = commit + ":" + file.Path
+	}
+	return refs, nil
+}
+
+// Restore writes the backed up file or directory ref to target, replacing
+// whatever is there
+func (b *BackupRepo) Restore(ctx context.Context, ref, target string) error {
+	if !IsBackupRef(ref) {
+		return fmt.Errorf("invalid backup reference %q", ref)
+	}
+	commit, path, _ := strings.Cut(ref, ":")
+
+	tmp, err := os.MkdirTemp(filepath.Dir(b.dir), "restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	result, err := b.shell.Execute(ctx, fmt.Sprintf("set -o pipefail; git archive %s -- %s | tar -x -C %s", commit, utility.ShellQuote(path), utility.ShellQuote(tmp)), &utility.ExecOptions{
+		Timeout: time.Minute,
+		WorkDir: b.dir,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", ref, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to read backup %s: %s", ref, strings.TrimSpace(result.Stderr))
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", target, err)
+		}
+		utility.Audit(utility.AuditDelete, target, "replaced by backup "+ref)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+	}
+	result, err = b.shell.Execute(ctx, fmt.Sprintf("cp -a %s %s", utility.ShellQuote(filepath.Join(tmp, path)), utility.ShellQuote(target)), nil)
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to restore %s", target)
+	}
+	utility.Audit(utility.AuditWrite, target, "restored from backup "+ref)
+	b.logger.Info("Restored %s from backup %s", target, commit[:12])
+	return nil
+}
@@ -0,0 +1,562 @@
+/**
+ * Dotfiles manager
+ * Clones dotfiles repositories into $XDG_DATA_HOME/daemira/dotfiles and
+ * deploys them stow-style: every file in a repo is symlinked into the repo's
+ * target directory, and anything already in the way is committed to the
+ * config backup repository (see Backups.go) first.
+ *
+ * Because deployed files are symlinks, edits land directly in the repo's
+ * working tree and show up in `git status`. Programs that save by replacing
+ * the file break the link instead; those files are reported as drift and
+ * adopted back into the repo on commit.
+ */
+
+package dotfiles
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Repo is a dotfiles repository and where it is deployed
+type Repo struct {
+	Name     string `mapstructure:"name"`
+	URL      string `mapstructure:"repo"`
+	Branch   string `mapstructure:"branch"`   // default: the remote's default branch
+	Target   string `mapstructure:"target"`   // directory the files are linked into, default ~
+	Optional bool   `mapstructure:"optional"` // failures are reported but do not fail the install
+}
+
+// repoNamePattern matches names usable as a directory
+var repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate checks that the repo can be cloned and deployed
+func (r Repo) Validate() error {
+	if !repoNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("invalid dotfiles name %q", r.Name)
+	}
+	if r.URL == "" {
+		return fmt.Errorf("dotfiles %s has no repo", r.Name)
+	}
+	return nil
+}
+
+// LinkState describes a deployed file
+type LinkState int
+
+const (
+	Linked    LinkState = iota // target is a symlink to the repo file
+	Missing                    // nothing at the target
+	Identical                  // a regular file with the same content
+	Differs                    // a regular file with different content
+	Blocked                    // a directory or a symlink pointing elsewhere
+)
+
+func (s LinkState) String() string {
+	switch s {
+	case Linked:
+		return "linked"
+	case Missing:
+		return "missing"
+	case Identical:
+		return "identical"
+	case Differs:
+		return "differs"
+	case Blocked:
+		return "blocked"
+	default:
+		return "unknown"
+	}
+}
+
+// Link is one repo file and its deployed location
+type Link struct {
+	Rel    string // path relative to the repo root
+	Source string
+	Target string
+	State  LinkState
+}
+
+// Change is a change made while deploying
+type Change struct {
+	Kind   string // 'link' | 'backup'
+	Target string
+	Backup string // backup reference of the previous file (see BackupRepo.Restore), for 'backup'
+}
+
+// Options configures the manager
+type Options struct {
+	// Allow is asked before every change; returning false skips it (used for dry runs)
+	Allow func(kind, description string) bool
+}
+
+// Manager clones, deploys and tracks dotfiles repositories
+type Manager struct {
+	logger  *utility.Logger
+	shell   *utility.Shell
+	repos   []Repo
+	dir     string
+	allow   func(kind, description string) bool
+	backups *BackupRepo
+}
+
+// defaultIgnore are repo-root entries that are never deployed
+var defaultIgnore = []string{".git", ".gitignore", ".gitmodules", ".dotfilesignore", "README*", "LICENSE*"}
+
+// NewManager creates a new dotfiles Manager
+func NewManager(logger *utility.Logger, repos []Repo, options *Options) *Manager {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	m := &Manager{
+		logger: logger.With("dotfiles"),
+		shell:  utility.NewShell(logger),
+		repos:  repos,
+		dir:    filepath.Join(utility.DataDir(), "dotfiles"),
+		allow:  func(kind, description string) bool { return true },
+
+		backups: NewBackupRepo(logger),
+	}
+	if options != nil && options.Allow != nil {
+		m.allow = options.Allow
+	}
+	return m
+}
+
+// Repos returns the configured repositories
+func (m *Manager) Repos() []Repo {
+	return m.repos
+}
+
+// Find returns the repositories with the given names, or all of them when none are given
+func (m *Manager) Find(names []string) ([]Repo, error) {
+	if len(names) == 0 {
+		return m.repos, nil
+	}
+
+	found := []Repo{}
+	for _, name := range names {
+		match := false
+		for _, repo := range m.repos {
+			if repo.Name == name {
+				found = append(found, repo)
+				match = true
+				break
+			}
+		}
+		if !match {
+			return nil, fmt.Errorf("unknown dotfiles %q", name)
+		}
+	}
+	return found, nil
+}
+
+// RepoDir returns where a repository is cloned
+func (m *Manager) RepoDir(repo Repo) string {
+	return filepath.Join(m.dir, repo.Name)
+}
+
+// TargetDir returns the directory a repository is deployed into
+func (m *Manager) TargetDir(repo Repo) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	target := repo.Target
+	switch {
+	case target == "" || target == "~":
+		return homeDir, nil
+	case strings.HasPrefix(target, "~/"):
+		return filepath.Join(homeDir, target[2:]), nil
+	case filepath.IsAbs(target):
+		return filepath.Clean(target), nil
+	default:
+		return filepath.Join(homeDir, target), nil
+	}
+}
+
+// git runs a git command in a repository
+func (m *Manager) git(ctx context.Context, repo Repo, args string, timeout time.Duration) (*utility.Result, error) {
+	result, err := m.shell.Execute(ctx, "git "+args, &utility.ExecOptions{
+		Timeout: timeout,
+		WorkDir: m.RepoDir(repo),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w", args, err)
+	}
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("git %s failed: %s", args, strings.TrimSpace(result.Stderr))
+	}
+	return result, nil
+}
+
+// isCloned reports whether a repository has been cloned
+func (m *Manager) isCloned(repo Repo) bool {
+	_, err := os.Stat(filepath.Join(m.RepoDir(repo), ".git"))
+	return err == nil
+}
+
+// Sync clones a repository, or fast-forwards it if already cloned
+func (m *Manager) Sync(ctx context.Context, repo Repo) error {
+	dir := m.RepoDir(repo)
+
+	if m.isCloned(repo) {
+		if !m.allow("command", fmt.Sprintf("git -C %s pull --ff-only", dir)) {
+			return nil
+		}
+		m.logger.Info("Updating dotfiles %s...", repo.Name)
+		before, _ := m.git(ctx, repo, "rev-parse HEAD", 10*time.Second)
+		if _, err := m.git(ctx, repo, "pull --ff-only", 2*time.Minute); err != nil {
+			return err
+		}
+		if before != nil {
+			m.auditPulled(ctx, repo, strings.TrimSpace(before.Stdout))
+		}
+		return nil
+	}
+
+	command := "git clone"
+	if repo.Branch != "" {
+		command += " --branch " + utility.ShellQuote(repo.Branch)
+	}
+	command += fmt.Sprintf(" %s %s", utility.ShellQuote(repo.URL), utility.ShellQuote(dir))
+	if !m.allow("command", command) {
+		return nil
+	}
+
+	if _, err := utility.EnsureDir(m.dir); err != nil {
+		return fmt.Errorf("failed to create dotfiles directory: %w", err)
+	}
+	m.logger.Info("Cloning dotfiles %s from %s...", repo.Name, repo.URL)
+	result, err := m.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: 5 * time.Minute,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %w", repo.URL, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to clone %s: %s", repo.URL, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// auditPulled records the deployed files a pull changed since a commit, as
+// linked files change along with the repository
+func (m *Manager) auditPulled(ctx context.Context, repo Repo, since string) {
+	result, err := m.git(ctx, repo, "diff --name-only "+utility.ShellQuote(since)+" HEAD", 30*time.Second)
+	if err != nil {
+		return
+	}
+	targetDir, err := m.TargetDir(repo)
+	if err != nil {
+		return
+	}
+	patterns := m.ignorePatterns(repo)
+	for _, rel := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		if rel != "" && !ignored(rel, patterns) {
+			utility.Audit(utility.AuditWrite, filepath.Join(targetDir, rel), "updated by a pull of dotfiles "+repo.Name)
+		}
+	}
+}
+
+// ignorePatterns returns the root-level patterns excluded from deployment
+func (m *Manager) ignorePatterns(repo Repo) []string {
+	patterns := append([]string{}, defaultIgnore...)
+
+	f, err := os.Open(filepath.Join(m.RepoDir(repo), ".dotfilesignore"))
+	if err != nil {
+		return patterns
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, strings.TrimSuffix(line, "/"))
+		}
+	}
+	return patterns
+}
+
+// ignored reports whether a repo-relative path matches an ignore pattern
+func ignored(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		// Patterns match the whole relative path, so plain names only apply at the root
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Links lists every deployable file in a repository and the state of its target
+func (m *Manager) Links(repo Repo) ([]Link, error) {
+	root := m.RepoDir(repo)
+	if !m.isCloned(repo) {
+		return nil, fmt.Errorf("dotfiles %s is not cloned (run 'daemira dotfiles deploy %s')", repo.Name, repo.Name)
+	}
+	targetDir, err := m.TargetDir(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := m.ignorePatterns(repo)
+	links := []Link{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel == "." {
+			return nil
+		}
+		if ignored(rel, patterns) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		link := Link{Rel: rel, Source: path, Target: filepath.Join(targetDir, rel)}
+		link.State = linkState(link)
+		links = append(links, link)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dotfiles %s: %w", repo.Name, err)
+	}
+	return links, nil
+}
+
+// linkState inspects the target of a link
+func linkState(link Link) LinkState {
+	info, err := os.Lstat(link.Target)
+	if err != nil {
+		return Missing
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if dest, err := os.Readlink(link.Target); err == nil && dest == link.Source {
+			return Linked
+		}
+		return Blocked
+	}
+	if !info.Mode().IsRegular() {
+		return Blocked
+	}
+
+	source, err1 := os.ReadFile(link.Source)
+	target, err2 := os.ReadFile(link.Target)
+	if err1 == nil && err2 == nil && bytes.Equal(source, target) {
+		return Identical
+	}
+	return Differs
+}
+
+// Deploy clones or updates a repository and links its files into place,
+// backing up anything in the way
+func (m *Manager) Deploy(ctx context.Context, repo Repo) ([]Change, error) {
+	if err := m.Sync(ctx, repo); err != nil {
+		return nil, err
+	}
+	if !m.isCloned(repo) {
+		// Dry run before the first clone: there is nothing to inspect yet
+		targetDir, _ := m.TargetDir(repo)
+		m.allow("file", fmt.Sprintf("link files from %s into %s", m.RepoDir(repo), targetDir))
+		return nil, nil
+	}
+
+	links, err := m.Links(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Back up everything in the way in one commit before touching any of it
+	var replace, create []Link
+	for _, link := range links {
+		switch link.State {
+		case Linked:
+		case Identical, Differs, Blocked:
+			if m.allow("file", fmt.Sprintf("back up %s to %s and link it", link.Target, m.backups.Dir())) {
+				replace = append(replace, link)
+			}
+		default:
+			if m.allow("file", fmt.Sprintf("link %s -> %s", link.Target, link.Source)) {
+				create = append(create, link)
+			}
+		}
+	}
+
+	changes := []Change{}
+	if len(replace) > 0 {
+		files := make([]BackupFile, len(replace))
+		for idx, link := range replace {
+			files[idx] = BackupFile{Source: link.Target, Path: filepath.Join("dotfiles", repo.Name, link.Rel)}
+		}
+		refs, err := m.backups.Save(ctx, files, fmt.Sprintf("Back up before deploying dotfiles %s on %s", repo.Name, hostname()))
+		if err != nil {
+			return nil, err
+		}
+		for idx, link := range replace {
+			if err := os.RemoveAll(link.Target); err != nil {
+				return changes, fmt.Errorf("failed to replace %s: %w", link.Target, err)
+			}
+			utility.Audit(utility.AuditDelete, link.Target, fmt.Sprintf("replaced by a link into dotfiles %s, backed up as %s", repo.Name, refs[idx]))
+			m.logger.Info("Backed up %s", link.Target)
+			changes = append(changes, Change{Kind: "backup", Target: link.Target, Backup: refs[idx]})
+		}
+	}
+
+	for _, link := range append(replace, create...) {
+		if err := os.MkdirAll(filepath.Dir(link.Target), 0755); err != nil {
+			return changes, fmt.Errorf("failed to create %s: %w", filepath.Dir(link.Target), err)
+		}
+		if err := os.Symlink(link.Source, link.Target); err != nil {
+			return changes, fmt.Errorf("failed to link %s: %w", link.Target, err)
+		}
+		utility.Audit(utility.AuditWrite, link.Target, "linked into dotfiles "+repo.Name)
+		changes = append(changes, Change{Kind: "link", Target: link.Target})
+	}
+
+	m.logger.Info("Deployed dotfiles %s (%d files, %d changes)", repo.Name, len(links), len(changes))
+	return changes, nil
+}
+
+// Diff describes local drift: uncommitted edits in the repository and deployed
+// files that were replaced with a different copy
+func (m *Manager) Diff(ctx context.Context, repo Repo) (string, error) {
+	links, err := m.Links(repo)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	result, err := m.git(ctx, repo, "status --short", 30*time.Second)
+	if err != nil {
+		return "", err
+	}
+	if status := strings.TrimRight(result.Stdout, "\n"); status != "" {
+		diff, err := m.git(ctx, repo, "diff", 30*time.Second)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "Uncommitted changes:\n%s\n%s", status, diff.Stdout)
+	}
+
+	for _, link := range links {
+		switch link.State {
+		case Differs:
+			result, err := m.shell.Execute(ctx, fmt.Sprintf("diff -u %s %s", utility.ShellQuote(link.Source), utility.ShellQuote(link.Target)), nil)
+			if err != nil {
+				return "", fmt.Errorf("failed to diff %s: %w", link.Target, err)
+			}
+			fmt.Fprintf(&b, "Replaced: %s\n%s", link.Target, result.Stdout)
+		case Missing, Blocked:
+			fmt.Fprintf(&b, "Not deployed (%s): %s\n", link.State, link.Target)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// Commit adopts replaced files back into the repository, commits every local
+// change and optionally pushes it
+func (m *Manager) Commit(ctx context.Context, repo Repo, message string, push bool) (bool, error) {
+	links, err := m.Links(repo)
+	if err != nil {
+		return false, err
+	}
+
+	for _, link := range links {
+		if link.State != Differs {
+			continue
+		}
+		data, err := os.ReadFile(link.Target)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", link.Target, err)
+		}
+		if err := os.WriteFile(link.Source, data, 0644); err != nil {
+			return false, fmt.Errorf("failed to adopt %s: %w", link.Target, err)
+		}
+		if err := os.Remove(link.Target); err != nil {
+			return false, fmt.Errorf("failed to relink %s: %w", link.Target, err)
+		}
+		if err := os.Symlink(link.Source, link.Target); err != nil {
+			return false, fmt.Errorf("failed to relink %s: %w", link.Target, err)
+		}
+		m.logger.Info("Adopted %s", link.Target)
+	}
+
+	status, err := m.git(ctx, repo, "status --porcelain", 30*time.Second)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status.Stdout) == "" {
+		return false, nil
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Update %s from %s", repo.Name, hostname())
+	}
+	if _, err := m.git(ctx, repo, "add -A", 30*time.Second); err != nil {
+		return false, err
+	}
+	if _, err := m.git(ctx, repo, "commit -m "+utility.ShellQuote(message), 30*time.Second); err != nil {
+		return false, err
+	}
+	m.logger.Info("Committed dotfiles %s", repo.Name)
+
+	if push {
+		if _, err := m.git(ctx, repo, "push", 2*time.Minute); err != nil {
+			return true, err
+		}
+		m.logger.Info("Pushed dotfiles %s", repo.Name)
+	}
+	return true, nil
+}
+
+// hostname returns the machine name for default commit messages
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown host"
+	}
+	return name
+}
+
+// FormatStatus formats the deployment state of a repository for display
+func (m *Manager) FormatStatus(repo Repo, links []Link) string {
+	targetDir, _ := m.TargetDir(repo)
+	counts := make(map[LinkState]int)
+	for _, link := range links {
+		counts[link.State]++
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s (%s -> %s):", repo.Name, repo.URL, targetDir),
+		fmt.Sprintf("  %d files: %d linked, %d missing, %d differ, %d blocked",
+			len(links), counts[Linked], counts[Missing]+counts[Identical], counts[Differs], counts[Blocked]),
+	}
+	for _, link := range links {
+		if link.State != Linked {
+			lines = append(lines, fmt.Sprintf("  %-9s %s", link.State, link.Target))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,343 @@
+/**
+ * Fleet reporting
+ * Periodically POSTs a summary of this machine's state (alerts, the last
+ * system update, backup and snapshot, sync errors, failing jobs) to a
+ * user-run HTTP endpoint, signed with a secret the machines share, so one
+ * `daemira fleet status` shows every machine. The endpoint only has to keep
+ * the latest report of each machine and answer GET with all of them as a
+ * JSON array; signatures are checked by whoever reads the reports.
+ */
+
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// DefaultInterval is the time between reports unless configured otherwise
+const DefaultInterval = 15 * time.Minute
+
+// fleetReportJob is the scheduler job sending reports
+const fleetReportJob = "fleet-report"
+
+// requestTimeout is how long the endpoint gets to answer
+const requestTimeout = 30 * time.Second
+
+// Summary is a machine's state as reported to the fleet endpoint
+type Summary struct {
+	Machine       string    `json:"machine"`
+	Reported      time.Time `json:"reported"`
+	Interval      string    `json:"interval"` // time until the next report, e.g. "15m0s"
+	DaemonStarted time.Time `json:"daemon_started"`
+	Alerts        []Alert   `json:"alerts"`
+	LastUpdate    time.Time `json:"last_update"`
+	UpdateError   string    `json:"update_error,omitempty"`
+	LastBackup    time.Time `json:"last_backup"`
+	BackupError   string    `json:"backup_error,omitempty"`
+	LastSnapshot  time.Time `json:"last_snapshot"`
+	SnapshotError string    `json:"snapshot_error,omitempty"`
+	SyncDirs      int       `json:"sync_dirs"`
+	SyncErrors    []string  `json:"sync_errors,omitempty"` // directories whose last sync failed
+	FailingJobs   []string  `json:"failing_jobs,omitempty"`
+	DiskUsedPct   float64   `json:"disk_used_pct"` // fullest disk
+	MemoryUsedPct float64   `json:"memory_used_pct"`
+}
+
+// Alert is an active alert of a machine
+type Alert struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Known    bool   `json:"known"` // acknowledged or silenced
+}
+
+// Problems counts what needs looking at: new alerts, failures and sync errors
+func (s Summary) Problems() int {
+	problems := len(s.SyncErrors) + len(s.FailingJobs)
+	for _, alert := range s.Alerts {
+		if !alert.Known {
+			problems++
+		}
+	}
+	for _, err := range []string{s.UpdateError, s.BackupError, s.SnapshotError} {
+		if err != "" {
+			problems++
+		}
+	}
+	return problems
+}
+
+// Stale reports whether the machine missed its next two reports, so it is
+// off or its daemon stopped
+func (s Summary) Stale() bool {
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil || interval <= 0 {
+		interval = DefaultInterval
+	}
+	return time.Since(s.Reported) > 2*interval+time.Minute
+}
+
+// Report is a signed summary, as posted to the endpoint and listed by it
+type Report struct {
+	Summary   json.RawMessage `json:"summary"`
+	Signature string          `json:"signature"` // hex HMAC-SHA256 of summary with the shared secret
+}
+
+// Machine is a report read back from the endpoint
+type Machine struct {
+	Summary
+	Verified bool // signed with the shared secret
+}
+
+// Sign returns the signature of a summary's JSON
+func Sign(secret string, summary []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(summary)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a report was signed with secret. The summary is
+// compacted first, as an endpoint that stores reports re-encoded may have
+// added whitespace.
+func (r Report) Verify(secret string) bool {
+	signature, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return false
+	}
+	var summary bytes.Buffer
+	if err := json.Compact(&summary, r.Summary); err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(summary.Bytes())
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// MachineName returns the name a machine reports under: name if set,
+// otherwise its hostname
+func MachineName(name string) string {
+	if name != "" {
+		return name
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "unknown"
+}
+
+// ReporterOptions configures fleet reports
+type ReporterOptions struct {
+	Endpoint string // URL reports are POSTed to
+	Secret   string // shared secret reports are signed with
+	Machine  string // Default: the hostname
+	Interval time.Duration
+}
+
+// Reporter sends this machine's summary to the fleet endpoint
+type Reporter struct {
+	logger    *utility.Logger
+	endpoint  string
+	secret    string
+	machine   string
+	interval  time.Duration
+	summary   func(ctx context.Context) Summary
+	client    *http.Client
+	isRunning bool
+	mu        sync.Mutex
+}
+
+// NewReporter creates a Reporter; summary collects the machine's state
+func NewReporter(logger *utility.Logger, options *ReporterOptions, summary func(ctx context.Context) Summary) (*Reporter, error) {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	if options == nil || options.Endpoint == "" {
+		return nil, fmt.Errorf("no endpoint configured (set fleet.endpoint)")
+	}
+	if err := checkEndpoint(options.Endpoint); err != nil {
+		return nil, err
+	}
+	if options.Secret == "" {
+		return nil, fmt.Errorf("fleet.secret is not set")
+	}
+
+	r := &Reporter{
+		logger:   logger.With("fleet"),
+		endpoint: options.Endpoint,
+		secret:   options.Secret,
+		machine:  MachineName(options.Machine),
+		interval: DefaultInterval,
+		summary:  summary,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+	if options.Interval > 0 {
+		r.interval = options.Interval
+	}
+	return r, nil
+}
+
+// Start reports now and then every interval
+func (r *Reporter) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isRunning {
+		return
+	}
+
+	r.isRunning = true
+	r.logger.Info("Reporting as %s to %s every %v", r.machine, redactURL(r.endpoint), r.interval)
+
+	utility.GetScheduler().Add(utility.Job{
+		ID:          fleetReportJob,
+		Description: "Send this machine's status to the fleet endpoint",
+		Schedule:    utility.Every(r.interval),
+		Jitter:      time.Minute,
+		RunAtStart:  true,
+		Run:         r.Send,
+	})
+}
+
+// Stop halts the reports
+func (r *Reporter) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isRunning {
+		return
+	}
+
+	r.isRunning = false
+	utility.GetScheduler().Remove(fleetReportJob)
+	r.logger.Info("Fleet reports stopped")
+}
+
+// SetInterval changes the time between reports
+func (r *Reporter) SetInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if interval <= 0 || interval == r.interval {
+		return
+	}
+
+	r.interval = interval
+	if r.isRunning {
+		utility.GetScheduler().Reschedule(fleetReportJob, utility.Every(interval))
+	}
+	r.logger.Info("Fleet report interval changed to %v", interval)
+}
+
+// Send reports the machine's state now
+func (r *Reporter) Send(ctx context.Context) error {
+	r.mu.Lock()
+	interval := r.interval
+	r.mu.Unlock()
+
+	summary := r.summary(ctx)
+	summary.Machine = r.machine
+	summary.Reported = time.Now().UTC()
+	summary.Interval = interval.String()
+
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+	body, err := json.Marshal(Report{Summary: payload, Signature: Sign(r.secret, payload)})
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Daemira-Machine", r.machine)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", redactURL(r.endpoint), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", redactURL(r.endpoint), resp.Status, bytes.TrimSpace(detail))
+	}
+	r.logger.Debug("Reported %d problems to %s", summary.Problems(), redactURL(r.endpoint))
+	return nil
+}
+
+// Fetch reads every machine's latest report from the endpoint, checking
+// their signatures, sorted by machine name
+func Fetch(ctx context.Context, endpoint, secret string) ([]Machine, error) {
+	if err := checkEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{Timeout: requestTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s: %w", redactURL(endpoint), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s answered %s", redactURL(endpoint), resp.Status)
+	}
+
+	var reports []Report
+	if err := json.NewDecoder(resp.Body).Decode(&reports); err != nil {
+		return nil, fmt.Errorf("failed to parse the reports (the endpoint should answer GET with a JSON array of them): %w", err)
+	}
+
+	machines := make([]Machine, 0, len(reports))
+	for _, report := range reports {
+		var machine Machine
+		if err := json.Unmarshal(report.Summary, &machine.Summary); err != nil {
+			continue
+		}
+		machine.Verified = secret != "" && report.Verify(secret)
+		machines = append(machines, machine)
+	}
+	sort.Slice(machines, func(i, j int) bool { return machines[i].Machine < machines[j].Machine })
+	return machines, nil
+}
+
+// checkEndpoint checks that an endpoint is an http(s) URL
+func checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid fleet.endpoint %q (must be an http or https URL)", endpoint)
+	}
+	return nil
+}
+
+// redactURL leaves credentials and query tokens out of an endpoint for logs
+func redactURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
@@ -5,27 +5,65 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/ln64-git/daemira/src/features/dotfiles"
 	"github.com/ln64-git/daemira/src/utility"
 )
 
+// archDependencies declares which steps must complete before a step starts
+var archDependencies = map[string][]string{
+	"dkms-install":    {"system-check"},
+	"dotfiles":        {"system-check"},
+	"core-packages":   {"system-check"},
+	"hardware":        {"system-check"},
+	"aur-helper":      {"core-packages"}, // needs base-devel and git
+	"user-apps":       {"aur-helper"},
+	"flatpak":         {"core-packages"},              // provides flatpak
+	"enable-services": {"core-packages", "user-apps"}, // units ship with the packages
+	"user-groups":     {"core-packages", "user-apps"}, // e.g. docker creates its group
+	"shell-config":    {"core-packages"},              // fish and starship
+	"daemira-service": {"core-packages"},              // the daemon drives the installed tools
+	"reboot-prompt":   {"dkms-install", "dotfiles", "hardware", "flatpak", "enable-services", "user-groups", "shell-config", "daemira-service"},
+}
+
+// pacmanSteps install packages; pacman locks its database, so they never overlap
+var pacmanSteps = map[string]bool{
+	"dkms-install":  true,
+	"core-packages": true,
+	"hardware":      true,
+	"aur-helper":    true,
+	"user-apps":     true,
+}
+
 // getArchSteps returns the installation steps for Arch Linux
 func (i *Installer) getArchSteps() []*InstallStep {
-	return []*InstallStep{
+	steps := []*InstallStep{
 		i.createSystemCheckStep(),
 		i.createDKMSInstallStep(),
-		i.createHyprlandConfigStep(),
-		i.createDMSConfigStep(),
+		i.createDotfilesStep(),
 		i.createCorePackagesStep(),
+		i.createHardwareStep(),
 		i.createAURHelperStep(),
 		i.createUserAppsStep(),
+		i.createFlatpakStep(),
 		i.createServicesStep(),
 		i.createUserGroupsStep(),
 		i.createShellConfigStep(),
+		i.createDaemonStep(),
 		i.createRebootPromptStep(),
 	}
+
+	for _, step := range steps {
+		step.DependsOn = archDependencies[step.ID]
+		if pacmanSteps[step.ID] {
+			step.Locks = []string{"pacman"}
+		}
+	}
+	return steps
 }
 
 // createSystemCheckStep creates the system check step
@@ -41,18 +79,22 @@ func (i *Installer) createSystemCheckStep() *InstallStep {
 				return fmt.Errorf("failed to get current user: %w", err)
 			}
 
-			if currentUser.Uid == "0" {
+			// Installing into another root only runs system steps, which need root anyway
+			if currentUser.Uid == "0" && !installer.targetsRoot() {
 				return fmt.Errorf("this script should not be run as root")
 			}
 
 			installer.logger.Info("✓ Running as user: %s", currentUser.Username)
 
 			// Check if on Arch Linux
-			if _, err := os.Stat("/etc/arch-release"); err != nil {
+			if _, err := os.Stat(installer.rootPath("/etc/arch-release")); err != nil {
 				return fmt.Errorf("this installer is designed for Arch Linux only")
 			}
 
 			installer.logger.Info("✓ Arch Linux detected")
+			if installer.targetsRoot() {
+				installer.logger.Info("✓ Installing into %s", installer.root)
+			}
 
 			return nil
 		},
@@ -75,13 +117,11 @@ func (i *Installer) createDKMSInstallStep() *InstallStep {
 
 			installer.logger.Info("Installing DKMS from install.danklinux.com...")
 
-			// Download and execute install script
-			result, err = installer.shell.Execute(ctx, "curl -fsSL https://install.danklinux.com | sh", &utility.ExecOptions{
+			// Download, verify and execute the install script
+			if err := installer.runRemoteScript(ctx, "dkms", &utility.ExecOptions{
 				Timeout: 5 * time.Minute,
-			})
-
-			if err != nil || result.ExitCode != 0 {
-				return fmt.Errorf("DKMS installation failed: %v\nStderr: %s", err, result.Stderr)
+			}); err != nil {
+				return fmt.Errorf("DKMS installation failed: %w", err)
 			}
 
 			installer.logger.Info("DKMS installed successfully")
@@ -97,88 +137,47 @@ func (i *Installer) createDKMSInstallStep() *InstallStep {
 	return step
 }
 
-// createHyprlandConfigStep creates the Hyprland config step
-func (i *Installer) createHyprlandConfigStep() *InstallStep {
+// createDotfilesStep creates the dotfiles deployment step
+func (i *Installer) createDotfilesStep() *InstallStep {
 	return NewInstallStep(
-		"hyprland-config",
-		"Hyprland Configuration",
-		"Cloning Hyprland config from ln64-git/hypr",
+		"dotfiles",
+		"Dotfiles",
+		"Linking dotfiles (Hyprland, DMS, ...) into place",
 		func(ctx context.Context, installer *Installer) error {
-			homeDir, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get home directory: %w", err)
-			}
+			manager := installer.dotfilesManager(ctx)
 
-			hyprConfigDir := fmt.Sprintf("%s/.config/hypr", homeDir)
-
-			// Backup existing config if it exists
-			if _, err := os.Stat(hyprConfigDir); err == nil {
-				timestamp := time.Now().Format("20060102_150405")
-				backupDir := fmt.Sprintf("%s.backup.%s", hyprConfigDir, timestamp)
-				installer.logger.Info("Backing up existing config to: %s", backupDir)
-
-				if err := os.Rename(hyprConfigDir, backupDir); err != nil {
-					return fmt.Errorf("failed to backup existing config: %w", err)
+			for _, repo := range manager.Repos() {
+				changes, err := manager.Deploy(ctx, repo)
+				for _, change := range changes {
+					installer.journal(ctx, change.Kind, change.Target, change.Backup)
+				}
+				if err != nil {
+					if repo.Optional {
+						installer.logger.Warn("Failed to deploy dotfiles %s: %v", repo.Name, err)
+						installer.logger.Warn("You may need to set it up manually")
+						continue
+					}
+					return fmt.Errorf("failed to deploy dotfiles %s: %w", repo.Name, err)
 				}
 			}
 
-			// Clone the config
-			installer.logger.Info("Cloning Hyprland config...")
-			result, err := installer.shell.Execute(ctx, fmt.Sprintf("git clone https://github.com/ln64-git/hypr %s", hyprConfigDir), &utility.ExecOptions{
-				Timeout: 2 * time.Minute,
-			})
-
-			if err != nil || result.ExitCode != 0 {
-				return fmt.Errorf("failed to clone Hyprland config: %v\nStderr: %s", err, result.Stderr)
-			}
-
-			installer.logger.Info("Hyprland config installed")
+			installer.logger.Info("Dotfiles deployed")
 			return nil
 		},
 	)
 }
 
-// createDMSConfigStep creates the DMS config step
-func (i *Installer) createDMSConfigStep() *InstallStep {
-	return NewInstallStep(
-		"dms-config",
-		"DMS Configuration",
-		"Cloning DMS config from ln64-git/dkms-config",
-		func(ctx context.Context, installer *Installer) error {
-			homeDir, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get home directory: %w", err)
-			}
-
-			dmsConfigDir := fmt.Sprintf("%s/.config/DankMaterialShell", homeDir)
-
-			// Backup existing config if it exists
-			if _, err := os.Stat(dmsConfigDir); err == nil {
-				timestamp := time.Now().Format("20060102_150405")
-				backupDir := fmt.Sprintf("%s.backup.%s", dmsConfigDir, timestamp)
-				installer.logger.Info("Backing up existing config to: %s", backupDir)
-
-				if err := os.Rename(dmsConfigDir, backupDir); err != nil {
-					return fmt.Errorf("failed to backup existing config: %w", err)
-				}
-			}
-
-			// Clone the config
-			installer.logger.Info("Cloning DMS config...")
-			result, err := installer.shell.Execute(ctx, fmt.Sprintf("git clone https://github.com/ln64-git/dkms-config %s", dmsConfigDir), &utility.ExecOptions{
-				Timeout: 2 * time.Minute,
-			})
-
-			if err != nil || result.ExitCode != 0 {
-				installer.logger.Warn("Failed to clone DMS config: %v", err)
-				installer.logger.Warn("You may need to set it up manually")
-				return nil // Don't fail the installation
+// dotfilesManager returns a dotfiles manager for the manifest that honors dry-run mode
+func (i *Installer) dotfilesManager(ctx context.Context) *dotfiles.Manager {
+	return dotfiles.NewManager(i.logger, i.manifest.Dotfiles, &dotfiles.Options{
+		Allow: func(kind, description string) bool {
+			if i.dryRun {
+				i.record(ctx, kind, description)
+				return false
 			}
-
-			installer.logger.Info("DMS config installed")
-			return nil
+			return true
 		},
-	)
+	})
 }
 
 // createCorePackagesStep creates the core packages installation step
@@ -188,35 +187,8 @@ func (i *Installer) createCorePackagesStep() *InstallStep {
 		"Core Packages",
 		"Installing core system packages",
 		func(ctx context.Context, installer *Installer) error {
-			corePackages := []string{
-				"base-devel", "git", "curl", "wget",
-				"hyprland", "xdg-desktop-portal-hyprland", "qt5-wayland", "qt6-wayland",
-				"pipewire", "pipewire-alsa", "pipewire-pulse", "pipewire-jack", "wireplumber", "alsa-utils",
-				"bluez", "bluez-utils", "blueman",
-				"networkmanager", "nm-connection-editor",
-				"foot", "fish", "starship", "btop", "fastfetch",
-				"ttf-dejavu", "ttf-liberation", "noto-fonts", "noto-fonts-emoji",
-				"adobe-source-han-sans-cn-fonts", "adobe-source-han-sans-jp-fonts", "adobe-source-han-sans-kr-fonts",
-				"nautilus", "thunar",
-				"p7zip", "unrar", "unzip", "zip",
-			}
-
-			installer.logger.Info("Installing %d core packages...", len(corePackages))
-
-			for _, pkg := range corePackages {
-				// Check if already installed
-				result, _ := installer.shell.QuickExec(fmt.Sprintf("pacman -Q %s", pkg))
-				if result != nil && result.ExitCode == 0 {
-					installer.logger.Debug("%s already installed", pkg)
-					continue
-				}
-
-				installer.logger.Info("Installing %s...", pkg)
-				result, err := installer.shell.ExecWithSudo(fmt.Sprintf("pacman -S --noconfirm %s", pkg))
-				if err != nil || result.ExitCode != 0 {
-					installer.logger.Warn("Failed to install %s: %v", pkg, err)
-					// Continue with other packages
-				}
+			if err := installer.installPackages(ctx, "pacman", installer.manifest.Packages); err != nil {
+				return err
 			}
 
 			installer.logger.Info("Core packages installation complete")
@@ -225,6 +197,34 @@ func (i *Installer) createCorePackagesStep() *InstallStep {
 	)
 }
 
+// createHardwareStep creates the microcode and GPU driver installation step
+func (i *Installer) createHardwareStep() *InstallStep {
+	return NewInstallStep(
+		"hardware",
+		"Hardware Drivers",
+		"Installing CPU microcode and GPU drivers",
+		func(ctx context.Context, installer *Installer) error {
+			choice := ResolveHardware(installer.manifest.Hardware)
+			installer.logger.Info("%s", choice.Description)
+			if len(choice.Packages) == 0 {
+				installer.logger.Info("No hardware packages needed")
+				return nil
+			}
+			installer.logger.Info("Hardware packages: %s", strings.Join(choice.Packages, " "))
+
+			if err := installer.installPackages(ctx, "pacman", choice.Packages); err != nil {
+				return err
+			}
+
+			if _, ok := microcodePackages[choice.CPU]; ok {
+				installer.logger.Info("Microcode is loaded by the bootloader; make sure its entry includes the ucode image")
+			}
+			installer.logger.Info("Hardware drivers installation complete")
+			return nil
+		},
+	)
+}
+
 // createAURHelperStep creates the AUR helper (yay) installation step
 func (i *Installer) createAURHelperStep() *InstallStep {
 	step := NewInstallStep(
@@ -235,16 +235,22 @@ func (i *Installer) createAURHelperStep() *InstallStep {
 			installer.logger.Info("Installing yay AUR helper...")
 
 			// Clone yay repository
-			result, err := installer.shell.Execute(ctx, "cd /tmp && git clone https://aur.archlinux.org/yay.git && cd yay && makepkg -si --noconfirm", &utility.ExecOptions{
+			result, err := installer.execChange(ctx, "cd /tmp && git clone https://aur.archlinux.org/yay.git && cd yay && makepkg -si --noconfirm", &utility.ExecOptions{
 				Timeout: 5 * time.Minute,
+				// In the TUI, makepkg runs on a terminal so its colored output streams as usual
+				PTY:     installer.outputHook != nil,
+				Prompts: packagePrompts,
 			})
 
 			if err != nil || result.ExitCode != 0 {
-				return fmt.Errorf("failed to install yay: %v\nStderr: %s", err, result.Stderr)
+				// On a terminal stderr arrives with stdout
+				return fmt.Errorf("failed to install yay: %v\nOutput: %s", err, lastLines(plainText(result.Stdout+"\n"+result.Stderr), 10))
 			}
 
+			installer.journal(ctx, JournalPackage, "yay", "")
+
 			// Cleanup
-			installer.shell.QuickExec("rm -rf /tmp/yay")
+			installer.execChange(ctx, "rm -rf /tmp/yay", nil)
 
 			installer.logger.Info("yay installed successfully")
 			return nil
@@ -266,32 +272,102 @@ func (i *Installer) createUserAppsStep() *InstallStep {
 		"User Applications",
 		"Installing user applications",
 		func(ctx context.Context, installer *Installer) error {
-			userApps := []string{
-				"discord", "firefox", "google-chrome",
-				"spotify", "obs-studio", "steam",
-				"obsidian", "vscode",
-				"github-cli", "docker", "docker-compose",
-				"gparted", "baobab",
+			if err := installer.installPackages(ctx, "yay", installer.manifest.Apps); err != nil {
+				return err
 			}
 
-			installer.logger.Info("Installing %d user applications...", len(userApps))
+			installer.logger.Info("User applications installation complete")
+			return nil
+		},
+	)
+}
+
+// flathubRepo is the Flathub remote definition
+const flathubRepo = "https://dl.flathub.org/repo/flathub.flatpakrepo"
 
-			for _, app := range userApps {
-				installer.logger.Info("Installing %s...", app)
-				result, err := installer.shell.Execute(ctx, fmt.Sprintf("yay -S --noconfirm %s", app), &utility.ExecOptions{
-					Timeout: 10 * time.Minute,
+// createFlatpakStep creates the Flatpak applications installation step
+func (i *Installer) createFlatpakStep() *InstallStep {
+	step := NewInstallStep(
+		"flatpak",
+		"Flatpak Applications",
+		"Installing Flatpak applications from Flathub",
+		func(ctx context.Context, installer *Installer) error {
+			result, _ := installer.shell.Execute(ctx, "flatpak remotes --system --columns=name", nil)
+			if result == nil || result.ExitCode != 0 || !slices.Contains(strings.Fields(result.Stdout), "flathub") {
+				installer.logger.Info("Enabling Flathub...")
+				result, err := installer.execChange(ctx, "flatpak remote-add --system --if-not-exists flathub "+flathubRepo, &utility.ExecOptions{
+					Timeout: 2 * time.Minute,
+					UseSudo: true,
 				})
+				if err != nil {
+					return fmt.Errorf("failed to enable Flathub: %w", err)
+				}
+				if result.ExitCode != 0 {
+					return fmt.Errorf("failed to enable Flathub: %s", strings.TrimSpace(result.Stderr))
+				}
+			}
 
-				if err != nil || result.ExitCode != 0 {
-					installer.logger.Warn("Failed to install %s, skipping...", app)
+			// flatpak itself may not be installed yet in a dry run
+			installed := make(map[string]bool)
+			result, err := installer.shell.Execute(ctx, "flatpak list --system --app --columns=application", nil)
+			if err != nil || result.ExitCode != 0 {
+				if !installer.dryRun {
+					return fmt.Errorf("failed to list installed Flatpak apps")
+				}
+			} else {
+				for _, app := range strings.Fields(result.Stdout) {
+					installed[app] = true
+				}
+			}
+
+			// Install one app at a time so each gets its own result
+			results := make(map[string]string)
+			var failed []string
+			for _, app := range installer.manifest.Flatpaks {
+				if installed[app] {
+					results[app] = "already installed"
 					continue
 				}
+
+				installer.logger.Info("Installing %s...", app)
+				result, err := installer.execChange(ctx, "flatpak install --system --noninteractive -y flathub "+app, &utility.ExecOptions{
+					Timeout: 20 * time.Minute,
+					UseSudo: true,
+				})
+				switch {
+				case err != nil:
+					results[app] = err.Error()
+					failed = append(failed, app)
+				case result.ExitCode != 0:
+					results[app] = strings.TrimSpace(result.Stderr)
+					failed = append(failed, app)
+				default:
+					results[app] = "installed"
+					installer.journal(ctx, JournalFlatpak, app, "")
+				}
 			}
 
-			installer.logger.Info("User applications installation complete")
+			for _, app := range installer.manifest.Flatpaks {
+				if slices.Contains(failed, app) {
+					installer.logger.Warn("✗ %s: %s", app, results[app])
+				} else {
+					installer.logger.Info("✓ %s: %s", app, results[app])
+				}
+			}
+			if len(failed) > 0 {
+				installer.logger.Warn("%d of %d Flatpak apps could not be installed: %s", len(failed), len(installer.manifest.Flatpaks), strings.Join(failed, " "))
+			}
+
+			installer.logger.Info("Flatpak applications installation complete")
 			return nil
 		},
 	)
+
+	step.Skip = func(installer *Installer) bool {
+		return len(installer.manifest.Flatpaks) == 0
+	}
+
+	return step
 }
 
 // createServicesStep creates the services enablement step
@@ -301,14 +377,23 @@ func (i *Installer) createServicesStep() *InstallStep {
 		"Enable Services",
 		"Enabling system services",
 		func(ctx context.Context, installer *Installer) error {
-			services := []string{"NetworkManager", "bluetooth", "docker"}
+			services := installer.manifest.Services
 
 			for _, service := range services {
+				// Only record services this step enabled, so rollback leaves the rest alone
+				result, _ := installer.shell.QuickExec(fmt.Sprintf("%s is-enabled %s", installer.systemctlCommand(), service))
+				if result != nil && result.ExitCode == 0 {
+					installer.logger.Debug("%s already enabled", service)
+					continue
+				}
+
 				installer.logger.Info("Enabling %s...", service)
-				result, err := installer.shell.ExecWithSudo(fmt.Sprintf("systemctl enable %s", service))
+				result, err := installer.execChange(ctx, fmt.Sprintf("%s enable %s", installer.systemctlCommand(), service), &utility.ExecOptions{UseSudo: true})
 				if err != nil || result.ExitCode != 0 {
 					installer.logger.Warn("Failed to enable %s", service)
+					continue
 				}
+				installer.journal(ctx, JournalService, service, "")
 			}
 
 			installer.logger.Info("Services enabled")
@@ -325,7 +410,7 @@ func (i *Installer) createUserGroupsStep() *InstallStep {
 		"Adding user to required groups",
 		func(ctx context.Context, installer *Installer) error {
 			currentUser, _ := user.Current()
-			groups := []string{"docker", "audio", "video", "input"}
+			groups := installer.manifest.Groups
 
 			for _, group := range groups {
 				// Check if user is already in group
@@ -336,10 +421,12 @@ func (i *Installer) createUserGroupsStep() *InstallStep {
 				}
 
 				installer.logger.Info("Adding user to %s group...", group)
-				result, err := installer.shell.ExecWithSudo(fmt.Sprintf("usermod -aG %s %s", group, currentUser.Username))
+				result, err := installer.execChange(ctx, fmt.Sprintf("usermod -aG %s %s", group, currentUser.Username), &utility.ExecOptions{UseSudo: true})
 				if err != nil || result.ExitCode != 0 {
 					installer.logger.Warn("Failed to add user to %s group", group)
+					continue
 				}
+				installer.journal(ctx, JournalGroup, group, "")
 			}
 
 			installer.logger.Info("User groups configured")
@@ -364,9 +451,19 @@ func (i *Installer) createShellConfigStep() *InstallStep {
 			currentShell := os.Getenv("SHELL")
 			if !strings.Contains(currentShell, "fish") {
 				installer.logger.Info("Setting fish as default shell...")
-				result, err := installer.shell.QuickExec("chsh -s /usr/bin/fish")
+				command, opts := "chsh -s /usr/bin/fish", (*utility.ExecOptions)(nil)
+				if installer.unattended {
+					// chsh asks for the user's password; sudo can change it without asking
+					if currentUser, err := user.Current(); err == nil {
+						command = "chsh -s /usr/bin/fish " + utility.ShellQuote(currentUser.Username)
+						opts = &utility.ExecOptions{UseSudo: true}
+					}
+				}
+				result, err := installer.execChange(ctx, command, opts)
 				if err != nil || result.ExitCode != 0 {
 					installer.logger.Warn("Failed to set fish as default shell")
+				} else if currentShell != "" {
+					installer.journal(ctx, JournalShell, "/usr/bin/fish", currentShell)
 				}
 			}
 
@@ -374,15 +471,16 @@ func (i *Installer) createShellConfigStep() *InstallStep {
 			starshipConfig := fmt.Sprintf("%s/.config/starship.toml", homeDir)
 			if _, err := os.Stat(starshipConfig); os.IsNotExist(err) {
 				installer.logger.Info("Setting up Starship with Pure preset...")
-				result, err := installer.shell.Execute(ctx, fmt.Sprintf("starship preset pure-preset > %s", starshipConfig), nil)
+				result, err := installer.execChange(ctx, fmt.Sprintf("starship preset pure-preset > %s", starshipConfig), nil)
 				if err != nil || result.ExitCode != 0 {
 					installer.logger.Warn("Failed to configure Starship")
+				} else {
+					installer.journal(ctx, JournalFile, starshipConfig, "")
 				}
 			}
 
 			// Configure fish to use starship
 			fishConfig := fmt.Sprintf("%s/.config/fish/config.fish", homeDir)
-			os.MkdirAll(fmt.Sprintf("%s/.config/fish", homeDir), 0755)
 
 			// Check if starship is already configured
 			if content, err := os.ReadFile(fishConfig); err == nil {
@@ -393,6 +491,14 @@ func (i *Installer) createShellConfigStep() *InstallStep {
 			}
 
 			installer.logger.Info("Adding Starship to Fish config...")
+			if !installer.changeFile(ctx, fmt.Sprintf("append starship init to %s", fishConfig)) {
+				return nil
+			}
+			backup, err := installer.backupFile(ctx, fishConfig)
+			if err != nil {
+				return err
+			}
+			os.MkdirAll(fmt.Sprintf("%s/.config/fish", homeDir), 0755)
 			f, err := os.OpenFile(fishConfig, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
 				return fmt.Errorf("failed to open fish config: %w", err)
@@ -401,6 +507,7 @@ func (i *Installer) createShellConfigStep() *InstallStep {
 
 			f.WriteString("\n# Initialize Starship prompt\n")
 			f.WriteString("starship init fish | source\n")
+			installer.journal(ctx, JournalFile, fishConfig, backup)
 
 			installer.logger.Info("Shell configuration complete")
 			return nil
@@ -408,6 +515,23 @@ func (i *Installer) createShellConfigStep() *InstallStep {
 	)
 }
 
+// createDaemonStep creates the step installing daemira itself as a user service
+func (i *Installer) createDaemonStep() *InstallStep {
+	return NewInstallStep(
+		"daemira-service",
+		"Daemira Service",
+		"Installing daemira and enabling its user service",
+		func(ctx context.Context, installer *Installer) error {
+			if err := installer.deployDaemon(ctx); err != nil {
+				return err
+			}
+
+			installer.logger.Info("Daemira is installed and running")
+			return nil
+		},
+	)
+}
+
 // createRebootPromptStep creates the reboot prompt step
 func (i *Installer) createRebootPromptStep() *InstallStep {
 	return NewInstallStep(
@@ -430,6 +554,189 @@ func (i *Installer) createRebootPromptStep() *InstallStep {
 	)
 }
 
+var (
+	// progressPattern matches pacman/yay transaction progress, e.g. "( 3/12) installing git"
+	progressPattern = regexp.MustCompile(`^\(\s*(\d+)/(\d+)\) (installing|upgrading|reinstalling|downgrading) (\S+)`)
+	// targetNotFoundPattern matches packages pacman/yay could not find
+	targetNotFoundPattern = regexp.MustCompile(`target not found: (\S+)`)
+)
+
+// packagePrompts answers what pacman, yay and makepkg ask on a terminal:
+// confirmations and yay's menus take their default, and a password prompt
+// is interrupted rather than left waiting, since nobody can type into it
+var packagePrompts = []utility.PromptAnswer{
+	{Pattern: regexp.MustCompile(`\[[Yy]/[Nn]\]\s*$`), Answer: "\n"},
+	{Pattern: regexp.MustCompile(`^==>\s*$`), Answer: "\n"},
+	{Pattern: regexp.MustCompile(`(?i)password( for \S+)?:\s*$`), Answer: "\x03"},
+}
+
+// installedPackages returns the names of all installed packages (repo and AUR)
+func (i *Installer) installedPackages(ctx context.Context) (map[string]bool, error) {
+	result, err := i.shell.Execute(ctx, i.pacmanCommand()+" -Qq", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installed packages: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to query installed packages: %s", result.Stderr)
+	}
+
+	installed := make(map[string]bool)
+	for _, name := range strings.Fields(result.Stdout) {
+		installed[name] = true
+	}
+	return installed, nil
+}
+
+// missingPackages returns the packages that are not installed, in manifest order
+func missingPackages(installed map[string]bool, packages []string) []string {
+	missing := []string{}
+	for _, pkg := range packages {
+		if !installed[pkg] {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing
+}
+
+// installPackages installs the missing packages in a single pacman or yay
+// transaction. Unknown packages abort a transaction, so they are dropped and
+// the install retried once; anything still missing afterwards is reported.
+func (i *Installer) installPackages(ctx context.Context, tool string, packages []string) error {
+	if tool != "pacman" && i.targetsRoot() {
+		return fmt.Errorf("%s cannot install into another root", tool)
+	}
+
+	installed, err := i.installedPackages(ctx)
+	if err != nil {
+		return err
+	}
+
+	missing := missingPackages(installed, packages)
+	if len(missing) == 0 {
+		i.logger.Info("All %d packages already installed", len(packages))
+		return nil
+	}
+	i.logger.Info("Installing %d of %d packages with %s...", len(missing), len(packages), tool)
+
+	opts := &utility.ExecOptions{
+		Timeout: 30 * time.Minute,
+		UseSudo: tool == "pacman",
+		// In the TUI, pacman and yay run on a terminal so their colored output and
+		// progress stream as usual
+		PTY:     i.outputHook != nil,
+		Prompts: packagePrompts,
+		StdoutCallback: func(line string) {
+			if m := progressPattern.FindStringSubmatch(strings.TrimSpace(plainText(line))); m != nil {
+				i.logger.Info("[%s/%s] %s %s", m[1], m[2], m[3], m[4])
+			}
+		},
+	}
+	if tool == "yay" {
+		// AUR builds are slow
+		opts.Timeout = 60 * time.Minute
+	}
+	if !i.dryRun {
+		// Downloads and builds print a lot: all of it goes to a run log, the
+		// result keeps its start and end
+		run, err := utility.NewRunLog("installer", tool)
+		if err != nil {
+			i.logger.Debug("Installing without run log: %v", err)
+		}
+		run.Close()
+		opts.OutputFile = run.Path()
+	}
+
+	command := tool
+	if tool == "pacman" {
+		command = i.pacmanCommand()
+	}
+
+	var failure error
+	requested := missing
+	for attempt := 0; attempt < 2 && len(missing) > 0; attempt++ {
+		result, err := i.execChange(ctx, fmt.Sprintf("%s -S --needed --noconfirm %s", command, strings.Join(missing, " ")), opts)
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", tool, err)
+		}
+		if result.ExitCode == 0 {
+			break
+		}
+
+		notFound := make(map[string]bool)
+		for _, m := range targetNotFoundPattern.FindAllStringSubmatch(plainText(result.Stdout+result.Stderr), -1) {
+			notFound[m[1]] = true
+		}
+		if len(notFound) == 0 {
+			// Keep the end of the output: it says whether a download or a build failed
+			failure = fmt.Errorf("%s exited with code %d: %s", tool, result.ExitCode, lastLines(plainText(result.Stdout+"\n"+result.Stderr), 10))
+			if opts.OutputFile != "" {
+				i.logger.Warn("%v (full output in %s)", failure, opts.OutputFile)
+			} else {
+				i.logger.Warn("%v", failure)
+			}
+			break
+		}
+
+		remaining := []string{}
+		for _, pkg := range missing {
+			if notFound[pkg] {
+				i.logger.Warn("Package %s not found, skipping...", pkg)
+			} else {
+				remaining = append(remaining, pkg)
+			}
+		}
+		missing = remaining
+	}
+
+	if i.dryRun {
+		return nil
+	}
+
+	// Report what is still missing
+	if installed, err = i.installedPackages(ctx); err != nil {
+		return err
+	}
+	for _, pkg := range requested {
+		if installed[pkg] {
+			i.journal(ctx, JournalPackage, pkg, "")
+		}
+	}
+	if failed := missingPackages(installed, packages); len(failed) > 0 {
+		i.logger.Warn("%d packages could not be installed: %s", len(failed), strings.Join(failed, " "))
+		if failure != nil {
+			return failure
+		}
+	}
+	return nil
+}
+
+// lastLines returns the last n non-empty lines of output
+func lastLines(output string, n int) string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// plainText strips what a terminal would not show from command output:
+// control sequences and progress redrawn over by a carriage return
+func plainText(output string) string {
+	lines := strings.Split(output, "\n")
+	for idx, line := range lines {
+		if pos := strings.LastIndex(line, "\r"); pos >= 0 {
+			line = line[pos+1:]
+		}
+		lines[idx] = escapePattern.ReplaceAllString(line, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
 // getFedoraSteps returns the installation steps for Fedora (placeholder)
 func (i *Installer) getFedoraSteps() []*InstallStep {
 	return []*InstallStep{
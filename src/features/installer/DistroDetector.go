@@ -3,6 +3,7 @@ package installer
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -34,10 +35,16 @@ func (d Distro) String() string {
 
 // DetectDistro detects the current Linux distribution
 func DetectDistro() (Distro, error) {
+	return DetectDistroAt("/")
+}
+
+// DetectDistroAt detects the distribution installed under root
+func DetectDistroAt(root string) (Distro, error) {
 	// Read /etc/os-release
-	data, err := os.ReadFile("/etc/os-release")
+	path := filepath.Join(root, "etc/os-release")
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return Unknown, fmt.Errorf("failed to read /etc/os-release: %w", err)
+		return Unknown, fmt.Errorf("failed to read %s: %w", path, err)
 	}
 
 	content := string(data)
@@ -0,0 +1,138 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// validateGraph checks that dependencies exist and do not form a cycle
+func validateGraph(steps []*InstallStep) error {
+	byID := make(map[string]*InstallStep, len(steps))
+	for _, step := range steps {
+		byID[step.ID] = step
+	}
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("step '%s' depends on unknown step '%s'", step.ID, dep)
+			}
+		}
+	}
+
+	// Depth-first search; a step met again while still on the path closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(steps))
+	var visit func(step *InstallStep, path []string) error
+	visit = func(step *InstallStep, path []string) error {
+		switch marks[step.ID] {
+		case visiting:
+			return fmt.Errorf("step dependency cycle: %s", strings.Join(append(path, step.ID), " -> "))
+		case visited:
+			return nil
+		}
+		marks[step.ID] = visiting
+		for _, dep := range step.DependsOn {
+			if err := visit(byID[dep], append(path, step.ID)); err != nil {
+				return err
+			}
+		}
+		marks[step.ID] = visited
+		return nil
+	}
+	for _, step := range steps {
+		if err := visit(step, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGraph calls run for every step once its dependencies have completed,
+// running up to i.jobs steps at once. Steps sharing a lock never overlap.
+// A step whose dependency failed is left pending (and reported) so --resume
+// picks it up once the dependency is fixed.
+func (i *Installer) runGraph(ctx context.Context, run func(ctx context.Context, idx int, step *InstallStep)) {
+	byID := make(map[string]*InstallStep, len(i.steps))
+	for _, step := range i.steps {
+		byID[step.ID] = step
+	}
+
+	finished := make(map[string]bool)
+	started := make(map[string]bool)
+	held := make(map[string]bool)
+	done := make(chan *InstallStep)
+	running := 0
+
+	for {
+		// Start every ready step; blocking a step may block its dependents, so repeat until stable
+		for progress := true; progress; {
+			progress = false
+			for idx, step := range i.steps {
+				if started[step.ID] {
+					continue
+				}
+
+				ready, blockedBy := true, ""
+				for _, dep := range step.DependsOn {
+					if !finished[dep] {
+						ready = false
+						break
+					}
+					if !byID[dep].completed() && blockedBy == "" {
+						blockedBy = dep
+					}
+				}
+				if !ready {
+					continue
+				}
+				if blockedBy != "" {
+					i.logger.Warn("Not running %s: %s did not complete", step.Name, byID[blockedBy].Name)
+					started[step.ID] = true
+					finished[step.ID] = true
+					progress = true
+					continue
+				}
+
+				if ctx.Err() != nil || running >= i.jobs || holdsAny(held, step.Locks) {
+					continue
+				}
+
+				started[step.ID] = true
+				running++
+				for _, lock := range step.Locks {
+					held[lock] = true
+				}
+				go func(idx int, step *InstallStep) {
+					run(ctx, idx, step)
+					done <- step
+				}(idx, step)
+			}
+		}
+
+		if running == 0 {
+			return
+		}
+
+		step := <-done
+		running--
+		finished[step.ID] = true
+		for _, lock := range step.Locks {
+			delete(held, lock)
+		}
+	}
+}
+
+// holdsAny reports whether any of the locks is taken
+func holdsAny(held map[string]bool, locks []string) bool {
+	for _, lock := range locks {
+		if held[lock] {
+			return true
+		}
+	}
+	return false
+}
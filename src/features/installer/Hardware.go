@@ -0,0 +1,170 @@
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CPU and GPU vendors the installer knows drivers for
+const (
+	VendorIntel  = "intel"
+	VendorAMD    = "amd"
+	VendorNvidia = "nvidia"
+	VendorNone   = "none"
+	VendorAuto   = "auto"
+)
+
+// pciVendors maps PCI vendor IDs to GPU vendors
+var pciVendors = map[string]string{
+	"0x8086": VendorIntel,
+	"0x1002": VendorAMD,
+	"0x10de": VendorNvidia,
+}
+
+// microcodePackages are installed per CPU vendor
+var microcodePackages = map[string][]string{
+	VendorIntel: {"intel-ucode"},
+	VendorAMD:   {"amd-ucode"},
+}
+
+// gpuPackages are installed per GPU vendor
+var gpuPackages = map[string][]string{
+	VendorIntel:  {"mesa", "vulkan-intel", "intel-media-driver"},
+	VendorAMD:    {"mesa", "vulkan-radeon", "libva-mesa-driver"},
+	VendorNvidia: {"nvidia-dkms", "nvidia-utils", "linux-headers"},
+}
+
+// Chassis types used to pick a machine profile
+const (
+	ChassisLaptop  = "laptop"
+	ChassisDesktop = "desktop"
+	ChassisServer  = "server"
+	ChassisUnknown = "unknown"
+)
+
+// dmiChassisTypes maps SMBIOS chassis type numbers to chassis types
+var dmiChassisTypes = map[string]string{
+	"8": ChassisLaptop, "9": ChassisLaptop, "10": ChassisLaptop, "14": ChassisLaptop,
+	"30": ChassisLaptop, "31": ChassisLaptop, "32": ChassisLaptop,
+	"3": ChassisDesktop, "4": ChassisDesktop, "5": ChassisDesktop, "6": ChassisDesktop,
+	"7": ChassisDesktop, "13": ChassisDesktop, "15": ChassisDesktop, "16": ChassisDesktop,
+	"35": ChassisDesktop, "36": ChassisDesktop,
+	"17": ChassisServer, "23": ChassisServer, "28": ChassisServer, "29": ChassisServer,
+}
+
+// DetectChassis returns the machine's chassis type from DMI, treating any
+// machine with a battery as a laptop when DMI is inconclusive
+func DetectChassis() string {
+	if data, err := os.ReadFile("/sys/class/dmi/id/chassis_type"); err == nil {
+		if chassis, ok := dmiChassisTypes[strings.TrimSpace(string(data))]; ok {
+			return chassis
+		}
+	}
+	if batteries, _ := filepath.Glob("/sys/class/power_supply/BAT*"); len(batteries) > 0 {
+		return ChassisLaptop
+	}
+	return ChassisUnknown
+}
+
+// HardwareChoice is the detected (or overridden) hardware and the packages it needs
+type HardwareChoice struct {
+	CPU         string
+	CPUSource   string // 'detected' | 'manifest'
+	GPUs        []string
+	GPUSource   string
+	Packages    []string
+	Description string
+}
+
+// detectCPUVendor reads the CPU vendor from /proc/cpuinfo
+func detectCPUVendor() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return VendorNone
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "vendor_id" {
+			continue
+		}
+		switch strings.TrimSpace(value) {
+		case "GenuineIntel":
+			return VendorIntel
+		case "AuthenticAMD":
+			return VendorAMD
+		}
+		return VendorNone
+	}
+	return VendorNone
+}
+
+// detectGPUVendors lists the vendors of display controllers on the PCI bus
+func detectGPUVendors() []string {
+	devices, _ := filepath.Glob("/sys/bus/pci/devices/*")
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		class, err := os.ReadFile(filepath.Join(device, "class"))
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(class)), "0x03") {
+			continue
+		}
+		vendorID, err := os.ReadFile(filepath.Join(device, "vendor"))
+		if err != nil {
+			continue
+		}
+		if vendor, ok := pciVendors[strings.TrimSpace(string(vendorID))]; ok {
+			seen[vendor] = true
+		}
+	}
+
+	vendors := make([]string, 0, len(seen))
+	for vendor := range seen {
+		vendors = append(vendors, vendor)
+	}
+	sort.Strings(vendors)
+	return vendors
+}
+
+// ResolveHardware decides which microcode and GPU packages to install, using
+// the manifest's choice where given and detection otherwise
+func ResolveHardware(hw ManifestHardware) HardwareChoice {
+	choice := HardwareChoice{CPU: hw.CPU, CPUSource: "manifest", GPUs: hw.GPU, GPUSource: "manifest"}
+	if choice.CPU == "" || choice.CPU == VendorAuto {
+		choice.CPU = detectCPUVendor()
+		choice.CPUSource = "detected"
+	}
+	if len(choice.GPUs) == 0 || (len(choice.GPUs) == 1 && choice.GPUs[0] == VendorAuto) {
+		choice.GPUs = detectGPUVendors()
+		choice.GPUSource = "detected"
+	}
+
+	seen := make(map[string]bool)
+	add := func(pkgs []string) {
+		for _, pkg := range pkgs {
+			if !seen[pkg] {
+				seen[pkg] = true
+				choice.Packages = append(choice.Packages, pkg)
+			}
+		}
+	}
+	add(microcodePackages[choice.CPU])
+	gpus := []string{}
+	for _, gpu := range choice.GPUs {
+		if gpu != VendorNone {
+			add(gpuPackages[gpu])
+			gpus = append(gpus, gpu)
+		}
+	}
+	if len(gpus) == 0 {
+		gpus = []string{VendorNone}
+	}
+
+	choice.Description = fmt.Sprintf("CPU: %s (%s), GPU: %s (%s)", choice.CPU, choice.CPUSource, strings.Join(gpus, ", "), choice.GPUSource)
+	return choice
+}
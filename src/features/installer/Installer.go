@@ -3,45 +3,175 @@ package installer
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ln64-git/daemira/src/utility"
 )
 
+// InstallerOptions configures the installer
+type InstallerOptions struct {
+	UseTUI       bool
+	ManifestPath string // YAML/TOML manifest; empty searches the config directory
+	Profile      string // manifest profile, default "full"
+	DryRun       bool   // report what would change without changing anything
+	Resume       bool   // continue the last install, skipping steps that already succeeded
+	Jobs         int    // steps run at once when their dependencies allow, default 3
+
+	AcceptScriptChanges bool // run remote scripts that changed since they were last run
+
+	// Unattended runs without prompts or TUI, for arch-chroot and fresh VMs:
+	// logs go to stderr and JSON progress lines to stdout
+	Unattended bool
+	Root       string // install into this root instead of the running system
+}
+
+// PlannedAction is a change recorded instead of performed in dry-run mode
+type PlannedAction struct {
+	Step   string
+	Kind   string // 'command' | 'file'
+	Detail string
+}
+
 // Installer manages the system installation process
 type Installer struct {
-	distro  Distro
-	steps   []*InstallStep
-	logger  *utility.Logger
-	shell   *utility.Shell
-	useTUI  bool
-	dryRun  bool
+	distro   Distro
+	steps    []*InstallStep
+	manifest *Manifest
+	logger   *utility.Logger
+	shell    *utility.Shell
+	useTUI   bool
+	dryRun   bool
+	plan     []PlannedAction
+	jobs     int
+	profile  string
+	resume   bool
+	state    *InstallState
+	undo     *Journal
+
+	// acceptScriptChanges runs remote scripts that changed since they were last run
+	acceptScriptChanges bool
+	// unattended never prompts; events receives its JSON progress lines
+	unattended bool
+	events     io.Writer
+	// root is the system being installed into; "" is the running system
+	root string
+
+	// outputHook receives command output lines (used by the TUI)
+	outputHook func(line string)
+	// mu guards plan, state and undo, which steps running in parallel share
+	mu sync.Mutex
+}
+
+// stepKey is the context key holding the ID of the step making a change
+type stepKey struct{}
+
+// withStep tags a context with the step it runs
+func withStep(ctx context.Context, stepID string) context.Context {
+	return context.WithValue(ctx, stepKey{}, stepID)
+}
+
+// stepFromContext returns the step a context runs, or "" outside a step
+func stepFromContext(ctx context.Context) string {
+	stepID, _ := ctx.Value(stepKey{}).(string)
+	return stepID
 }
 
 // NewInstaller creates a new installer instance
-func NewInstaller(logger *utility.Logger, useTUI bool) (*Installer, error) {
-	// Detect distribution
-	distro, err := DetectDistro()
+func NewInstaller(logger *utility.Logger, options *InstallerOptions) (*Installer, error) {
+	opts := InstallerOptions{}
+	if options != nil {
+		opts = *options
+	}
+
+	// Resuming reuses the manifest and profile of the interrupted run
+	var state *InstallState
+	if opts.Resume {
+		var err error
+		state, err = LoadInstallState()
+		if err != nil {
+			return nil, classify(ExitConfig, err)
+		}
+		if opts.ManifestPath == "" && state.Manifest != DefaultManifest().Source {
+			opts.ManifestPath = state.Manifest
+		}
+		if opts.Profile == "" {
+			opts.Profile = state.Profile
+		}
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = 3
+	}
+
+	// Load and validate the manifest before touching anything
+	manifest, err := LoadManifest(opts.ManifestPath)
+	if err != nil {
+		return nil, classify(ExitConfig, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, classify(ExitConfig, err)
+	}
+	if opts.Profile == "" {
+		var chassis string
+		opts.Profile, chassis = manifest.DetectProfile()
+		logger.Info("Detected %s chassis, using the %s profile", chassis, opts.Profile)
+	}
+	resolved, err := manifest.Resolve(opts.Profile)
+	if err != nil {
+		return nil, classify(ExitConfig, err)
+	}
+
+	root := ""
+	if opts.Root != "" {
+		if root, err = filepath.Abs(opts.Root); err != nil {
+			return nil, classify(ExitConfig, fmt.Errorf("invalid root %s: %w", opts.Root, err))
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, classify(ExitConfig, fmt.Errorf("root %s is not a directory", opts.Root))
+		}
+	}
+
+	// Detect distribution (of the target root, if there is one)
+	distro, err := DetectDistroAt(filepath.Join("/", root))
 	if err != nil {
-		return nil, fmt.Errorf("failed to detect distribution: %w", err)
+		return nil, classify(ExitUnsupported, fmt.Errorf("failed to detect distribution: %w", err))
 	}
 
 	if !IsSupported(distro) {
-		return nil, fmt.Errorf("distribution '%s' is not supported yet", distro)
+		return nil, classify(ExitUnsupported, fmt.Errorf("distribution '%s' is not supported yet", distro))
 	}
 
 	shell := utility.NewShell(logger)
 
 	installer := &Installer{
-		distro: distro,
-		logger: logger,
-		shell:  shell,
-		useTUI: useTUI,
-		dryRun: false,
+		distro:   distro,
+		manifest: resolved,
+		logger:   logger,
+		shell:    shell,
+		useTUI:   opts.UseTUI && !opts.Unattended,
+		dryRun:   opts.DryRun,
+		jobs:     opts.Jobs,
+		profile:  opts.Profile,
+		resume:   opts.Resume,
+		state:    state,
+
+		acceptScriptChanges: opts.AcceptScriptChanges,
+		unattended:          opts.Unattended,
+		root:                root,
+	}
+	if opts.Unattended {
+		installer.events = os.Stdout
 	}
 
 	// Initialize steps based on distro
 	installer.initializeSteps()
+	installer.applySkipSteps()
+	installer.applyRoot()
+	installer.checkStepSettings()
 
 	return installer, nil
 }
@@ -60,44 +190,146 @@ func (i *Installer) initializeSteps() {
 	}
 }
 
-// Run executes all installation steps
+// applySkipSteps marks the steps the profile turns off as skipped
+func (i *Installer) applySkipSteps() {
+	skip := make(map[string]bool)
+	for _, id := range i.manifest.SkipSteps {
+		skip[id] = true
+	}
+	for _, step := range i.steps {
+		if skip[step.ID] {
+			step.Skip = func(*Installer) bool { return true }
+			delete(skip, step.ID)
+		}
+	}
+	for id := range skip {
+		i.logger.Warn("Profile skips unknown step '%s'", id)
+	}
+}
+
+// checkStepSettings warns about manifest step settings for steps that do not exist
+func (i *Installer) checkStepSettings() {
+	known := make(map[string]bool, len(i.steps))
+	for _, step := range i.steps {
+		known[step.ID] = true
+	}
+	for id := range i.manifest.Steps {
+		if !known[id] {
+			i.logger.Warn("Manifest configures unknown step '%s'", id)
+		}
+	}
+}
+
+// Run executes all installation steps, interactively when a terminal is attached
 func (i *Installer) Run(ctx context.Context) error {
 	i.logger.Info("===========================================")
 	i.logger.Info("  Daemira Installer")
 	i.logger.Info("  Distribution: %s", i.distro)
-	i.logger.Info("  Steps: %d", len(i.steps))
+	i.logger.Info("  Manifest: %s (profile: %s)", i.manifest.Source, i.profile)
+	if i.resume {
+		i.logger.Info("  Resuming install started %s", i.state.StartedAt.Format("2006-01-02 15:04"))
+	}
+	if i.dryRun {
+		i.logger.Info("  Mode: dry run (nothing will be changed)")
+	}
+	if i.unattended {
+		i.logger.Info("  Mode: unattended (JSON progress on stdout)")
+	}
+	if i.targetsRoot() {
+		i.logger.Info("  Root: %s (per-user steps are skipped)", i.root)
+	}
+	i.logger.Info("  Steps: %d (up to %d at once)", len(i.steps), i.jobs)
 	i.logger.Info("===========================================")
 	i.logger.Info("")
 
+	if i.state == nil {
+		i.state = newInstallState(i.distro, i.manifest.Source, i.profile)
+	}
+	if err := validateGraph(i.steps); err != nil {
+		return classify(ExitConfig, err)
+	}
+
+	if i.useTUI && utility.IsTerminal(os.Stdin) && utility.IsTerminal(os.Stdout) {
+		return i.runTUI(ctx)
+	}
+
 	startTime := time.Now()
-	var failedSteps []*InstallStep
-	var skippedSteps []*InstallStep
-	var successSteps []*InstallStep
+	i.emit(ProgressEvent{Event: "start", Total: len(i.steps)})
 
-	// Execute each step
-	for idx, step := range i.steps {
+	// Execute the steps as their dependencies complete
+	i.runGraph(ctx, func(ctx context.Context, idx int, step *InstallStep) {
 		i.logger.Info("Step %d/%d: %s", idx+1, len(i.steps), step.Name)
+		i.emit(ProgressEvent{Event: "step_start", Step: step.ID, Name: step.Name, Index: idx + 1, Total: len(i.steps)})
+		stepStart := time.Now()
+		defer func() { i.emitStepEnd(idx, step, time.Since(stepStart)) }()
 
-		if err := step.Run(ctx, i); err != nil {
-			failedSteps = append(failedSteps, step)
-
-			// Ask user if they want to continue on error
-			i.logger.Warn("Step failed. Continue with remaining steps? (y/N)")
-			// For now, continue automatically
-			// In TUI mode, this would be interactive
-			continue
+		if i.resume && i.state.IsDone(step.ID) {
+			step.Status = Success
+			i.logger.Info("[%s] %s - Already completed", step.Status.Icon(), step.Name)
+			return
 		}
 
-		if step.Status == Skipped {
-			skippedSteps = append(skippedSteps, step)
-		} else if step.Status == Success {
-			successSteps = append(successSteps, step)
+		if err := i.runStep(ctx, step); err != nil {
+			// Keep going; the failed steps are retried by --resume
+			i.logger.Warn("Step %s failed, continuing with the steps that do not depend on it", step.Name)
 		}
+	})
+
+	return i.finish(time.Since(startTime))
+}
+
+// runStep executes one step under its timeout and retry policy and records its result
+func (i *Installer) runStep(ctx context.Context, step *InstallStep) error {
+	err := i.runWithPolicy(ctx, step)
+	i.saveProgress(step)
+	return err
+}
 
-		i.logger.Info("")
+// finish prints the summary and marks the install completed if nothing failed
+func (i *Installer) finish(duration time.Duration) error {
+	err := i.summarize(duration)
+
+	summary := ProgressEvent{Event: "summary", Total: len(i.steps), Duration: duration.Seconds()}
+	for _, step := range i.steps {
+		switch step.Status {
+		case Failed:
+			summary.Failed = append(summary.Failed, step.ID)
+			if summary.Failures == nil {
+				summary.Failures = make(map[string]string)
+			}
+			summary.Failures[step.ID] = step.Failure
+		case Pending:
+			summary.NotRun = append(summary.NotRun, step.ID)
+		}
+	}
+	code := ExitCode(err)
+	summary.ExitCode = &code
+	if err != nil {
+		summary.Error = err.Error()
 	}
+	i.emit(summary)
+
+	return err
+}
 
-	duration := time.Since(startTime)
+// summarize logs the results and returns an error classified by the worst failure
+func (i *Installer) summarize(duration time.Duration) error {
+	var failedSteps []*InstallStep
+	var skipped, successful, notRun int
+	failures := make(map[string]int)
+	for _, step := range i.steps {
+		switch step.Status {
+		case Success:
+			successful++
+		case Skipped:
+			skipped++
+		case Failed:
+			failedSteps = append(failedSteps, step)
+			failures[step.Failure]++
+		case Pending:
+			notRun++
+		}
+	}
 
 	// Print summary
 	i.logger.Info("")
@@ -106,9 +338,22 @@ func (i *Installer) Run(ctx context.Context) error {
 	i.logger.Info("===========================================")
 	i.logger.Info("Duration: %v", duration)
 	i.logger.Info("Total Steps: %d", len(i.steps))
-	i.logger.Info("✓ Successful: %d", len(successSteps))
-	i.logger.Info("⊘ Skipped: %d", len(skippedSteps))
-	i.logger.Info("✗ Failed: %d", len(failedSteps))
+	i.logger.Info("✓ Successful: %d", successful)
+	i.logger.Info("⊘ Skipped: %d", skipped)
+	if len(failedSteps) > 0 {
+		classes := []string{}
+		for _, class := range []string{FailureTimeout, FailureNetwork, FailureBuild, FailureOther} {
+			if failures[class] > 0 {
+				classes = append(classes, fmt.Sprintf("%d %s", failures[class], class))
+			}
+		}
+		i.logger.Info("✗ Failed: %d (%s)", len(failedSteps), strings.Join(classes, ", "))
+	} else {
+		i.logger.Info("✗ Failed: 0")
+	}
+	if notRun > 0 {
+		i.logger.Info("⏳ Not run: %d", notRun)
+	}
 
 	if len(failedSteps) > 0 {
 		i.logger.Error("")
@@ -116,7 +361,26 @@ func (i *Installer) Run(ctx context.Context) error {
 		for _, step := range failedSteps {
 			i.logger.Error("  - %s", step.Summary())
 		}
-		return fmt.Errorf("%d steps failed", len(failedSteps))
+		if !i.dryRun {
+			i.logger.Error("")
+			i.logger.Error("Fix the problem and run 'daemira install --resume' to retry the failed steps")
+		}
+		return classify(failureClass(failedSteps), fmt.Errorf("%d steps failed", len(failedSteps)))
+	}
+
+	if i.dryRun {
+		i.printPlan()
+		return nil
+	}
+
+	if notRun > 0 {
+		i.logger.Warn("Installation interrupted; run 'daemira install --resume' to continue")
+		return classify(ExitIncomplete, fmt.Errorf("%d steps not run", notRun))
+	}
+
+	i.state.Completed = true
+	if err := i.state.save(); err != nil {
+		i.logger.Warn("Failed to save install state: %v", err)
 	}
 
 	i.logger.Info("")
@@ -133,14 +397,144 @@ func (i *Installer) Run(ctx context.Context) error {
 	return nil
 }
 
+// failureClass picks the exit code for a set of failed steps: an unsupported
+// system first, then a script that failed verification, then any step failure
+func failureClass(failed []*InstallStep) int {
+	code := ExitStepFailed
+	for _, step := range failed {
+		if step.ID == "system-check" {
+			return ExitUnsupported
+		}
+		if ExitCode(step.Error) == ExitVerify {
+			code = ExitVerify
+		}
+	}
+	return code
+}
+
 // RunStep executes a specific step by ID
 func (i *Installer) RunStep(ctx context.Context, stepID string) error {
 	for _, step := range i.steps {
 		if step.ID == stepID {
-			return step.Run(ctx, i)
+			// Record the result in the existing install state so --resume sees it
+			if i.state == nil {
+				if state, err := LoadInstallState(); err == nil {
+					i.state = state
+				} else {
+					i.state = newInstallState(i.distro, i.manifest.Source, i.profile)
+				}
+			}
+
+			if err := i.runStep(ctx, step); err != nil {
+				return classify(failureClass([]*InstallStep{step}), err)
+			}
+			if i.dryRun {
+				i.printPlan()
+			}
+			return nil
 		}
 	}
-	return fmt.Errorf("step '%s' not found", stepID)
+	return classify(ExitConfig, fmt.Errorf("step '%s' not found", stepID))
+}
+
+// saveProgress persists a finished step so an interrupted install can be resumed
+func (i *Installer) saveProgress(step *InstallStep) {
+	if i.dryRun {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.state.record(step)
+	if err := i.state.save(); err != nil {
+		i.logger.Warn("Failed to save install state: %v", err)
+	}
+}
+
+// record adds an action to the dry-run plan
+func (i *Installer) record(ctx context.Context, kind, detail string) {
+	i.mu.Lock()
+	i.plan = append(i.plan, PlannedAction{Step: stepFromContext(ctx), Kind: kind, Detail: detail})
+	i.mu.Unlock()
+	i.logger.Info("  [dry-run] would %s: %s", map[string]string{"command": "run", "file": "change"}[kind], detail)
+}
+
+// execChange runs a command that modifies the system; in dry-run mode it is only recorded.
+// Read-only checks should use the shell directly so the plan reflects the real system.
+func (i *Installer) execChange(ctx context.Context, command string, opts *utility.ExecOptions) (*utility.Result, error) {
+	if i.dryRun {
+		display := command
+		if opts != nil && opts.UseSudo {
+			display = "sudo " + command
+		}
+		i.record(ctx, "command", display)
+		return &utility.Result{Command: command}, nil
+	}
+
+	// A step timeout from the manifest replaces the command's own
+	if timeout := i.commandTimeout(ctx, 0); timeout > 0 {
+		limited := utility.ExecOptions{}
+		if opts != nil {
+			limited = *opts
+		}
+		limited.Timeout = timeout
+		opts = &limited
+	}
+
+	if i.outputHook != nil {
+		hooked := utility.ExecOptions{}
+		if opts != nil {
+			hooked = *opts
+		}
+		stdout, stderr := hooked.StdoutCallback, hooked.StderrCallback
+		hooked.StdoutCallback = func(line string) {
+			i.outputHook(line)
+			if stdout != nil {
+				stdout(line)
+			}
+		}
+		hooked.StderrCallback = func(line string) {
+			i.outputHook(line)
+			if stderr != nil {
+				stderr(line)
+			}
+		}
+		opts = &hooked
+	}
+	return i.shell.Execute(ctx, command, opts)
+}
+
+// changeFile reports whether a file change should be made; in dry-run mode it is recorded and skipped
+func (i *Installer) changeFile(ctx context.Context, description string) bool {
+	if i.dryRun {
+		i.record(ctx, "file", description)
+		return false
+	}
+	return true
+}
+
+// printPlan logs every recorded action grouped by step
+func (i *Installer) printPlan() {
+	i.logger.Info("")
+	i.logger.Info("===========================================")
+	i.logger.Info("  Dry Run Plan (%d changes)", len(i.plan))
+	i.logger.Info("===========================================")
+
+	step := ""
+	for _, action := range i.plan {
+		if action.Step != step {
+			step = action.Step
+			i.logger.Info("%s:", step)
+		}
+		i.logger.Info("  %-7s %s", action.Kind, action.Detail)
+	}
+	if len(i.plan) == 0 {
+		i.logger.Info("Nothing to do")
+	}
+}
+
+// GetPlan returns the actions recorded in dry-run mode
+func (i *Installer) GetPlan() []PlannedAction {
+	return i.plan
 }
 
 // ListSteps returns all installation steps
@@ -148,6 +542,11 @@ func (i *Installer) ListSteps() []*InstallStep {
 	return i.steps
 }
 
+// GetManifest returns the resolved manifest
+func (i *Installer) GetManifest() *Manifest {
+	return i.manifest
+}
+
 // GetDistro returns the detected distribution
 func (i *Installer) GetDistro() Distro {
 	return i.distro
@@ -0,0 +1,373 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/features/dotfiles"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Journal entry kinds
+const (
+	JournalPackage = "package" // package installed (Target is the package name)
+	JournalService = "service" // systemd unit enabled
+	JournalGroup   = "group"   // user added to a group
+	JournalLink    = "link"    // symlink created
+	JournalBackup  = "backup"  // Target replaced; Backup is its reference in the config backup repository
+	JournalFile    = "file"    // file created or modified; Backup refers to the original if there was one
+	JournalShell   = "shell"   // login shell changed; Backup holds the previous shell
+	JournalFlatpak = "flatpak" // Flatpak app installed from Flathub
+
+	JournalSystemFile  = "system-file"  // root-owned file installed with sudo; Backup holds the original if there was one
+	JournalUserService = "user-service" // systemd user unit enabled
+)
+
+// JournalEntry is one change made by a step
+type JournalEntry struct {
+	Kind   string    `json:"kind"`
+	Target string    `json:"target"`
+	Backup string    `json:"backup,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Journal records what each step changed so it can be rolled back
+type Journal struct {
+	Steps map[string][]JournalEntry `json:"steps"`
+}
+
+// journalPath returns the undo journal location
+func journalPath() string {
+	return filepath.Join(utility.StateDir(), "install-journal.json")
+}
+
+// LoadJournal reads the undo journal, returning an empty one if none exists
+func LoadJournal() (*Journal, error) {
+	journal := &Journal{Steps: make(map[string][]JournalEntry)}
+
+	data, err := os.ReadFile(journalPath())
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install journal: %w", err)
+	}
+	if err := json.Unmarshal(data, journal); err != nil {
+		return nil, fmt.Errorf("failed to parse install journal: %w", err)
+	}
+	if journal.Steps == nil {
+		journal.Steps = make(map[string][]JournalEntry)
+	}
+	return journal, nil
+}
+
+// save writes the journal to disk
+func (j *Journal) save() error {
+	return writeStateFile(journalPath(), j)
+}
+
+// journal records a change made by the current step; nothing is recorded in dry-run mode
+func (i *Installer) journal(ctx context.Context, kind, target, backup string) {
+	if i.dryRun {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.undo == nil {
+		journal, err := LoadJournal()
+		if err != nil {
+			i.logger.Warn("Failed to load install journal: %v", err)
+			journal = &Journal{Steps: make(map[string][]JournalEntry)}
+		}
+		i.undo = journal
+	}
+
+	stepID := stepFromContext(ctx)
+	i.undo.Steps[stepID] = append(i.undo.Steps[stepID], JournalEntry{
+		Kind:   kind,
+		Target: target,
+		Backup: backup,
+		Time:   time.Now(),
+	})
+	if err := i.undo.save(); err != nil {
+		i.logger.Warn("Failed to save install journal: %v", err)
+	}
+}
+
+// backupFile commits a file about to be modified to the config backup
+// repository, returning its backup reference, or "" if it does not exist yet
+func (i *Installer) backupFile(ctx context.Context, path string) (string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	refs, err := dotfiles.NewBackupRepo(i.logger).Save(ctx, []dotfiles.BackupFile{
+		{Source: path, Path: filepath.Join("installer", path)},
+	}, fmt.Sprintf("Back up %s before the %s step", path, stepFromContext(ctx)))
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return refs[0], nil
+}
+
+// Rollback reverses the changes recorded for a step, or for every step
+// (latest first) when stepID is empty
+func (i *Installer) Rollback(ctx context.Context, stepID string) error {
+	journal, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	i.undo = journal
+
+	var stepIDs []string
+	if stepID != "" {
+		if len(journal.Steps[stepID]) == 0 {
+			return fmt.Errorf("nothing recorded for step '%s'", stepID)
+		}
+		stepIDs = []string{stepID}
+	} else {
+		for idx := len(i.steps) - 1; idx >= 0; idx-- {
+			if len(journal.Steps[i.steps[idx].ID]) > 0 {
+				stepIDs = append(stepIDs, i.steps[idx].ID)
+			}
+		}
+		if len(stepIDs) == 0 {
+			return fmt.Errorf("nothing to roll back")
+		}
+	}
+
+	state, _ := LoadInstallState()
+	var failed []string
+	for _, id := range stepIDs {
+		i.logger.Info("Rolling back %s (%d changes)...", id, len(journal.Steps[id]))
+
+		remaining := i.rollbackEntries(withStep(ctx, id), journal.Steps[id])
+		if i.dryRun {
+			continue
+		}
+
+		if len(remaining) > 0 {
+			journal.Steps[id] = remaining
+			failed = append(failed, id)
+		} else {
+			delete(journal.Steps, id)
+		}
+		if err := journal.save(); err != nil {
+			i.logger.Warn("Failed to save install journal: %v", err)
+		}
+
+		// A rolled back step runs again on --resume
+		if state != nil {
+			delete(state.Steps, id)
+			state.Completed = false
+			if err := state.save(); err != nil {
+				i.logger.Warn("Failed to save install state: %v", err)
+			}
+		}
+	}
+
+	if i.dryRun {
+		i.printPlan()
+		return nil
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not fully roll back: %s", strings.Join(failed, ", "))
+	}
+	i.logger.Info("Rollback complete")
+	return nil
+}
+
+// rollbackEntries undoes journal entries, latest first, and returns the ones
+// that could not be undone. Packages are removed last, in one transaction, so
+// services are disabled while their unit files still exist.
+func (i *Installer) rollbackEntries(ctx context.Context, entries []JournalEntry) []JournalEntry {
+	var remaining, packages []JournalEntry
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		entry := entries[idx]
+		if entry.Kind == JournalPackage {
+			packages = append(packages, entry)
+			continue
+		}
+		if err := i.undoEntry(ctx, entry); err != nil {
+			i.logger.Warn("Failed to undo %s %s: %v", entry.Kind, entry.Target, err)
+			remaining = append([]JournalEntry{entry}, remaining...)
+		}
+	}
+
+	if len(packages) == 0 {
+		return remaining
+	}
+
+	installed, err := i.installedPackages(ctx)
+	if err != nil {
+		i.logger.Warn("%v", err)
+		return append(remaining, packages...)
+	}
+	names := []string{}
+	for _, entry := range packages {
+		if installed[entry.Target] {
+			names = append(names, entry.Target)
+		}
+	}
+	if len(names) == 0 {
+		return remaining
+	}
+
+	i.logger.Info("Removing %d packages...", len(names))
+	result, err := i.execChange(ctx, i.pacmanCommand()+" -Rs --noconfirm "+strings.Join(names, " "), &utility.ExecOptions{
+		Timeout: 10 * time.Minute,
+		UseSudo: true,
+	})
+	if err != nil {
+		i.logger.Warn("Failed to remove packages: %v", err)
+		return append(remaining, packages...)
+	}
+	if result.ExitCode != 0 {
+		i.logger.Warn("Failed to remove packages (they may be required by other packages): %s", strings.TrimSpace(result.Stderr))
+		return append(remaining, packages...)
+	}
+	return remaining
+}
+
+// undoEntry reverses a single change
+func (i *Installer) undoEntry(ctx context.Context, entry JournalEntry) error {
+	run := func(command string, sudo bool) error {
+		result, err := i.execChange(ctx, command, &utility.ExecOptions{UseSudo: sudo})
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+		}
+		return nil
+	}
+
+	switch entry.Kind {
+	case JournalService:
+		i.logger.Info("Disabling %s...", entry.Target)
+		return run(i.systemctlCommand()+" disable "+utility.ShellQuote(entry.Target), true)
+
+	case JournalGroup:
+		currentUser, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("failed to get current user: %w", err)
+		}
+		i.logger.Info("Removing user from %s group...", entry.Target)
+		return run(fmt.Sprintf("gpasswd -d %s %s", utility.ShellQuote(currentUser.Username), utility.ShellQuote(entry.Target)), true)
+
+	case JournalUserService:
+		i.logger.Info("Disabling user unit %s...", entry.Target)
+		return run("systemctl --user disable --now "+utility.ShellQuote(entry.Target), false)
+
+	case JournalSystemFile:
+		if entry.Backup == "" {
+			i.logger.Info("Removing %s", entry.Target)
+			return run("rm -f "+utility.ShellQuote(entry.Target), true)
+		}
+		i.logger.Info("Restoring %s", entry.Target)
+		return run(fmt.Sprintf("cp -p %s %s", utility.ShellQuote(entry.Backup), utility.ShellQuote(entry.Target)), true)
+
+	case JournalFlatpak:
+		i.logger.Info("Uninstalling %s...", entry.Target)
+		return run("flatpak uninstall --system --noninteractive -y "+utility.ShellQuote(entry.Target), true)
+
+	case JournalShell:
+		i.logger.Info("Restoring login shell %s...", entry.Backup)
+		return run("chsh -s "+utility.ShellQuote(entry.Backup), false)
+
+	case JournalLink:
+		info, err := os.Lstat(entry.Target)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return nil // already gone or replaced by the user
+		}
+		if !i.changeFile(ctx, fmt.Sprintf("remove link %s", entry.Target)) {
+			return nil
+		}
+		if err := os.Remove(entry.Target); err != nil {
+			return err
+		}
+		utility.Audit(utility.AuditDelete, entry.Target, "link removed by install rollback")
+		return nil
+
+	case JournalBackup:
+		if _, err := os.Lstat(entry.Target); err == nil {
+			return fmt.Errorf("%s exists, not overwriting it with %s", entry.Target, entry.Backup)
+		}
+		if !i.changeFile(ctx, fmt.Sprintf("restore %s from %s", entry.Target, entry.Backup)) {
+			return nil
+		}
+		if dotfiles.IsBackupRef(entry.Backup) {
+			return dotfiles.NewBackupRepo(i.logger).Restore(ctx, entry.Backup, entry.Target)
+		}
+		// Older journals point at a timestamped backup directory
+		if err := os.MkdirAll(filepath.Dir(entry.Target), 0755); err != nil {
+			return err
+		}
+		i.logger.Info("Restoring %s", entry.Target)
+		return os.Rename(entry.Backup, entry.Target)
+
+	case JournalFile:
+		if entry.Backup == "" {
+			if !i.changeFile(ctx, fmt.Sprintf("remove %s", entry.Target)) {
+				return nil
+			}
+			i.logger.Info("Removing %s", entry.Target)
+			if err := os.Remove(entry.Target); err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			utility.Audit(utility.AuditDelete, entry.Target, "file removed by install rollback")
+			return nil
+		}
+		if !i.changeFile(ctx, fmt.Sprintf("restore %s from %s", entry.Target, entry.Backup)) {
+			return nil
+		}
+		if dotfiles.IsBackupRef(entry.Backup) {
+			return dotfiles.NewBackupRepo(i.logger).Restore(ctx, entry.Backup, entry.Target)
+		}
+		data, err := os.ReadFile(entry.Backup)
+		if err != nil {
+			return err
+		}
+		i.logger.Info("Restoring %s", entry.Target)
+		if err := os.WriteFile(entry.Target, data, 0644); err != nil {
+			return err
+		}
+		utility.Audit(utility.AuditWrite, entry.Target, "restored by install rollback")
+		return nil
+	}
+
+	return fmt.Errorf("unknown journal entry kind %q", entry.Kind)
+}
+
+// FormatJournal formats the recorded changes for display
+func (j *Journal) FormatJournal(steps []*InstallStep) string {
+	lines := []string{}
+	for _, step := range steps {
+		entries := j.Steps[step.ID]
+		if len(entries) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s (%d changes):", step.ID, len(entries)))
+		for _, entry := range entries {
+			line := fmt.Sprintf("  %-8s %s", entry.Kind, entry.Target)
+			if entry.Backup != "" {
+				line += fmt.Sprintf(" (was %s)", entry.Backup)
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return "No recorded changes"
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,442 @@
+package installer
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ln64-git/daemira/src/features/dotfiles"
+	"github.com/ln64-git/daemira/src/utility"
+	"github.com/spf13/viper"
+)
+
+// DefaultProfile is the profile used when none is requested
+const DefaultProfile = "full"
+
+// ManifestProfile adjusts the base manifest lists
+type ManifestProfile struct {
+	Description string   `mapstructure:"description"`
+	Packages    []string `mapstructure:"packages"` // extra pacman packages
+	Apps        []string `mapstructure:"apps"`     // extra AUR/user applications
+	Flatpaks    []string `mapstructure:"flatpaks"` // extra Flathub applications
+	Services    []string `mapstructure:"services"`
+	Groups      []string `mapstructure:"groups"`
+	Exclude     []string `mapstructure:"exclude"`    // removed from any list
+	SkipSteps   []string `mapstructure:"skip_steps"` // installer steps not run
+	Chassis     []string `mapstructure:"chassis"`    // chassis types (laptop, desktop, server) that select this profile
+}
+
+// ManifestHardware overrides hardware detection
+type ManifestHardware struct {
+	CPU string   `mapstructure:"cpu"` // auto (default), intel, amd or none
+	GPU []string `mapstructure:"gpu"` // auto (default), or any of intel, amd, nvidia; none for no drivers
+}
+
+// Manifest declares what the installer sets up
+type Manifest struct {
+	Packages  []string                   `mapstructure:"packages"` // pacman packages
+	Apps      []string                   `mapstructure:"apps"`     // AUR/user applications (yay)
+	Flatpaks  []string                   `mapstructure:"flatpaks"` // Flathub application IDs
+	Services  []string                   `mapstructure:"services"` // systemd units to enable
+	Groups    []string                   `mapstructure:"groups"`   // groups to add the user to
+	Dotfiles  []dotfiles.Repo            `mapstructure:"dotfiles"` // repositories linked into place
+	Hardware  ManifestHardware           `mapstructure:"hardware"` // microcode and GPU driver selection
+	Scripts   map[string]RemoteScript    `mapstructure:"scripts"`  // remote install scripts and how to verify them
+	Daemon    ManifestDaemon             `mapstructure:"daemon"`   // where daemira installs itself
+	Steps     map[string]ManifestStep    `mapstructure:"steps"`    // per-step timeout and retry settings
+	SkipSteps []string                   `mapstructure:"-"`        // set by Resolve from the profiles
+	Profiles  map[string]ManifestProfile `mapstructure:"profiles"`
+	Source    string                     `mapstructure:"-"`
+}
+
+// DefaultManifest returns the built-in manifest
+func DefaultManifest() *Manifest {
+	return &Manifest{
+		Packages: []string{
+			"base-devel", "git", "curl", "wget",
+			"hyprland", "xdg-desktop-portal-hyprland", "qt5-wayland", "qt6-wayland",
+			"pipewire", "pipewire-alsa", "pipewire-pulse", "pipewire-jack", "wireplumber", "alsa-utils",
+			"bluez", "bluez-utils", "blueman",
+			"networkmanager", "nm-connection-editor",
+			"foot", "fish", "starship", "btop", "fastfetch",
+			"ttf-dejavu", "ttf-liberation", "noto-fonts", "noto-fonts-emoji",
+			"adobe-source-han-sans-cn-fonts", "adobe-source-han-sans-jp-fonts", "adobe-source-han-sans-kr-fonts",
+			"nautilus", "thunar",
+			"p7zip", "unrar", "unzip", "zip",
+		},
+		Apps: []string{
+			"firefox", "google-chrome", "steam",
+			"obsidian", "vscode",
+			"github-cli", "docker", "docker-compose",
+			"gparted", "baobab",
+		},
+		// Better maintained on Flathub than in the AUR
+		Flatpaks: []string{"com.spotify.Client", "com.discordapp.Discord", "com.obsproject.Studio"},
+		Services: []string{"NetworkManager", "bluetooth", "docker"},
+		Groups:   []string{"docker", "audio", "video", "input"},
+		Dotfiles: []dotfiles.Repo{
+			{Name: "hypr", URL: "https://github.com/ln64-git/hypr", Target: "~/.config/hypr"},
+			{Name: "dms", URL: "https://github.com/ln64-git/dkms-config", Target: "~/.config/DankMaterialShell", Optional: true},
+		},
+		Scripts: map[string]RemoteScript{
+			"dkms": {URL: "https://install.danklinux.com"},
+		},
+		Profiles: map[string]ManifestProfile{
+			"full": {
+				Description: "Everything in the base manifest",
+			},
+			"minimal": {
+				Description: "Desktop and core tools only, no user applications",
+				Exclude: []string{
+					"google-chrome", "steam", "obsidian", "vscode", "docker", "docker-compose", "gparted", "baobab",
+					"com.spotify.Client", "com.discordapp.Discord", "com.obsproject.Studio",
+					"adobe-source-han-sans-cn-fonts", "adobe-source-han-sans-jp-fonts", "adobe-source-han-sans-kr-fonts",
+				},
+			},
+			"gaming": {
+				Description: "Full install plus gaming tools",
+				Packages:    []string{"gamemode", "lib32-gamemode", "mangohud", "lib32-mangohud"},
+				Apps:        []string{"lutris", "protonup-qt"},
+			},
+			"laptop": {
+				Description: "Full install plus power management and brightness tools",
+				Packages:    []string{"tlp", "tlp-rdw", "brightnessctl", "acpi"},
+				Services:    []string{"tlp"},
+				Chassis:     []string{ChassisLaptop},
+			},
+			"desktop": {
+				Description: "Full install",
+				Chassis:     []string{ChassisDesktop},
+			},
+			"server": {
+				Description: "Headless: no Hyprland, desktop packages or user applications",
+				Exclude: []string{
+					"hyprland", "xdg-desktop-portal-hyprland", "qt5-wayland", "qt6-wayland",
+					"pipewire", "pipewire-alsa", "pipewire-pulse", "pipewire-jack", "wireplumber", "alsa-utils",
+					"bluez", "bluez-utils", "blueman", "nm-connection-editor", "foot",
+					"ttf-dejavu", "ttf-liberation", "noto-fonts", "noto-fonts-emoji",
+					"adobe-source-han-sans-cn-fonts", "adobe-source-han-sans-jp-fonts", "adobe-source-han-sans-kr-fonts",
+					"nautilus", "thunar",
+					"firefox", "google-chrome", "steam", "obsidian", "vscode", "gparted", "baobab",
+					"com.spotify.Client", "com.discordapp.Discord", "com.obsproject.Studio",
+					"bluetooth", "audio", "video", "input",
+				},
+				SkipSteps: []string{"dkms-install", "dotfiles"},
+				Chassis:   []string{ChassisServer},
+			},
+		},
+		Source: "built-in",
+	}
+}
+
+// manifestPaths are the locations searched for a user manifest
+func manifestPaths() []string {
+	dir := utility.ConfigDir()
+	return []string{
+		filepath.Join(dir, "install.yaml"),
+		filepath.Join(dir, "install.yml"),
+		filepath.Join(dir, "install.toml"),
+	}
+}
+
+// LoadManifest reads a YAML or TOML manifest; an empty path searches the config
+// directory and falls back to the built-in manifest
+func LoadManifest(path string) (*Manifest, error) {
+	if path == "" {
+		for _, candidate := range manifestPaths() {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return DefaultManifest(), nil
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v.SetConfigType("yaml")
+	case ".toml":
+		v.SetConfigType("toml")
+	default:
+		return nil, fmt.Errorf("unsupported manifest format %q (expected .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	manifest := &Manifest{}
+	if err := v.Unmarshal(manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	manifest.Source = path
+	return manifest, nil
+}
+
+var (
+	// packageNamePattern matches valid pacman/AUR package names
+	packageNamePattern = regexp.MustCompile(`^[a-z0-9@_+][a-z0-9@._+-]*$`)
+	// unitNamePattern matches systemd unit names (with or without suffix)
+	unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+$`)
+	// groupNamePattern matches POSIX group names
+	groupNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+	// flatpakIDPattern matches Flatpak application IDs (reverse DNS, at least three parts)
+	flatpakIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(\.[A-Za-z0-9_-]+){2,}$`)
+)
+
+// Validate checks names and profiles, reporting every problem found
+func (m *Manifest) Validate() error {
+	var problems []string
+	check := func(kind string, names []string, pattern *regexp.Regexp) {
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if !pattern.MatchString(name) {
+				problems = append(problems, fmt.Sprintf("invalid %s name %q", kind, name))
+			}
+			if seen[name] {
+				problems = append(problems, fmt.Sprintf("duplicate %s %q", kind, name))
+			}
+			seen[name] = true
+		}
+	}
+
+	check("package", m.Packages, packageNamePattern)
+	check("app", m.Apps, packageNamePattern)
+	check("flatpak", m.Flatpaks, flatpakIDPattern)
+	check("service", m.Services, unitNamePattern)
+	check("group", m.Groups, groupNamePattern)
+
+	switch m.Hardware.CPU {
+	case "", VendorAuto, VendorIntel, VendorAMD, VendorNone:
+	default:
+		problems = append(problems, fmt.Sprintf("invalid hardware cpu %q (expected auto, intel, amd or none)", m.Hardware.CPU))
+	}
+	for _, gpu := range m.Hardware.GPU {
+		switch gpu {
+		case VendorAuto, VendorIntel, VendorAMD, VendorNvidia, VendorNone:
+		default:
+			problems = append(problems, fmt.Sprintf("invalid hardware gpu %q (expected auto, intel, amd, nvidia or none)", gpu))
+		}
+	}
+
+	if path := m.Daemon.Path; path != "" && !filepath.IsAbs(path) && !strings.HasPrefix(path, "~/") {
+		problems = append(problems, fmt.Sprintf("invalid daemon path %q (expected an absolute or ~/ path)", path))
+	}
+
+	for id, step := range m.Steps {
+		if err := step.Validate(id); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for name, script := range m.Scripts {
+		if err := script.Validate(name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	seenDotfiles := make(map[string]bool)
+	for _, repo := range m.Dotfiles {
+		if err := repo.Validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if seenDotfiles[repo.Name] {
+			problems = append(problems, fmt.Sprintf("duplicate dotfiles %q", repo.Name))
+		}
+		seenDotfiles[repo.Name] = true
+	}
+
+	for name, profile := range m.Profiles {
+		prefix := "profile " + name + ": "
+		for _, pkg := range append(append([]string{}, profile.Packages...), profile.Apps...) {
+			if !packageNamePattern.MatchString(pkg) {
+				problems = append(problems, fmt.Sprintf("%sinvalid package name %q", prefix, pkg))
+			}
+		}
+		for _, app := range profile.Flatpaks {
+			if !flatpakIDPattern.MatchString(app) {
+				problems = append(problems, fmt.Sprintf("%sinvalid flatpak id %q", prefix, app))
+			}
+		}
+		for _, service := range profile.Services {
+			if !unitNamePattern.MatchString(service) {
+				problems = append(problems, fmt.Sprintf("%sinvalid service name %q", prefix, service))
+			}
+		}
+		for _, group := range profile.Groups {
+			if !groupNamePattern.MatchString(group) {
+				problems = append(problems, fmt.Sprintf("%sinvalid group name %q", prefix, group))
+			}
+		}
+		for _, chassis := range profile.Chassis {
+			if chassis != ChassisLaptop && chassis != ChassisDesktop && chassis != ChassisServer {
+				problems = append(problems, fmt.Sprintf("%sinvalid chassis %q (expected laptop, desktop or server)", prefix, chassis))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid manifest %s:\n  - %s", m.Source, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// ProfileNames returns the defined profile names, sorted
+func (m *Manifest) ProfileNames() []string {
+	names := make([]string, 0, len(m.Profiles))
+	for name := range m.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve applies profiles to the base lists and returns the resulting manifest.
+// Several profiles can be combined with commas (e.g. "laptop,gaming"); they
+// apply in order.
+func (m *Manifest) Resolve(profile string) (*Manifest, error) {
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	resolved := &Manifest{
+		Packages: m.Packages,
+		Apps:     m.Apps,
+		Flatpaks: m.Flatpaks,
+		Services: m.Services,
+		Groups:   m.Groups,
+		Dotfiles: m.Dotfiles,
+		Hardware: m.Hardware,
+		Scripts:  m.scripts(),
+		Daemon:   m.Daemon,
+		Steps:    m.Steps,
+		Source:   m.Source,
+	}
+
+	skipSteps := make(map[string]bool)
+	for _, name := range strings.Split(profile, ",") {
+		name = strings.TrimSpace(name)
+		p, ok := m.Profiles[name]
+		if !ok {
+			// The default profile is the base lists unless a manifest redefines it
+			if name != DefaultProfile {
+				return nil, fmt.Errorf("unknown install profile %q (available: %s)", name, strings.Join(m.ProfileNames(), ", "))
+			}
+		}
+
+		exclude := make(map[string]bool, len(p.Exclude))
+		for _, name := range p.Exclude {
+			exclude[name] = true
+		}
+		merge := func(base, extra []string) []string {
+			seen := make(map[string]bool)
+			result := []string{}
+			for _, name := range append(append([]string{}, base...), extra...) {
+				if !exclude[name] && !seen[name] {
+					seen[name] = true
+					result = append(result, name)
+				}
+			}
+			return result
+		}
+
+		resolved.Packages = merge(resolved.Packages, p.Packages)
+		resolved.Apps = merge(resolved.Apps, p.Apps)
+		resolved.Flatpaks = merge(resolved.Flatpaks, p.Flatpaks)
+		resolved.Services = merge(resolved.Services, p.Services)
+		resolved.Groups = merge(resolved.Groups, p.Groups)
+		for _, step := range p.SkipSteps {
+			if !skipSteps[step] {
+				skipSteps[step] = true
+				resolved.SkipSteps = append(resolved.SkipSteps, step)
+			}
+		}
+	}
+
+	// Flatpak apps need flatpak itself, which core-packages installs
+	if len(resolved.Flatpaks) > 0 && !slices.Contains(resolved.Packages, "flatpak") {
+		resolved.Packages = append(resolved.Packages, "flatpak")
+	}
+
+	return resolved, nil
+}
+
+// DetectProfile picks the profile for this machine's chassis type, falling
+// back to the default profile; it also returns the detected chassis
+func (m *Manifest) DetectProfile() (string, string) {
+	chassis := DetectChassis()
+	for _, name := range m.ProfileNames() {
+		for _, c := range m.Profiles[name].Chassis {
+			if c == chassis {
+				return name, chassis
+			}
+		}
+	}
+	return DefaultProfile, chassis
+}
+
+// scripts returns the manifest's scripts on top of the built-in ones, so a
+// manifest only needs to list a script to pin it
+func (m *Manifest) scripts() map[string]RemoteScript {
+	scripts := make(map[string]RemoteScript)
+	for name, script := range DefaultManifest().Scripts {
+		scripts[name] = script
+	}
+	for name, script := range m.Scripts {
+		scripts[name] = script
+	}
+	return scripts
+}
+
+// Summary describes the resolved manifest for display
+func (m *Manifest) Summary() string {
+	lines := []string{
+		fmt.Sprintf("Manifest: %s", m.Source),
+		fmt.Sprintf("  Packages (%d): %s", len(m.Packages), strings.Join(m.Packages, " ")),
+		fmt.Sprintf("  Apps (%d): %s", len(m.Apps), strings.Join(m.Apps, " ")),
+		fmt.Sprintf("  Flatpaks (%d): %s", len(m.Flatpaks), strings.Join(m.Flatpaks, " ")),
+		fmt.Sprintf("  Services (%d): %s", len(m.Services), strings.Join(m.Services, " ")),
+		fmt.Sprintf("  Groups (%d): %s", len(m.Groups), strings.Join(m.Groups, " ")),
+	}
+	if len(m.SkipSteps) > 0 {
+		lines = append(lines, fmt.Sprintf("  Skipped steps: %s", strings.Join(m.SkipSteps, " ")))
+	}
+	hardware := ResolveHardware(m.Hardware)
+	lines = append(lines, fmt.Sprintf("  Hardware: %s -> %s", hardware.Description, strings.Join(hardware.Packages, " ")))
+	for _, id := range slices.Sorted(maps.Keys(m.Steps)) {
+		p := m.Steps[id]
+		settings := []string{}
+		if p.Timeout != "" {
+			settings = append(settings, "timeout "+p.Timeout)
+		}
+		if p.Retries != nil {
+			settings = append(settings, fmt.Sprintf("%d network retries", *p.Retries))
+		}
+		if p.RetryDelay != "" {
+			settings = append(settings, "retry delay "+p.RetryDelay)
+		}
+		lines = append(lines, fmt.Sprintf("  Step %s: %s", id, strings.Join(settings, ", ")))
+	}
+	daemonPath := m.Daemon.Path
+	if daemonPath == "" {
+		daemonPath = DefaultDaemonPath
+	}
+	lines = append(lines, fmt.Sprintf("  Daemon: %s (user unit %s)", daemonPath, daemonUnit))
+	for _, repo := range m.Dotfiles {
+		target := repo.Target
+		if target == "" {
+			target = "~"
+		}
+		lines = append(lines, fmt.Sprintf("  Dotfiles %s: %s -> %s", repo.Name, repo.URL, target))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,141 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Failure classes reported for failed steps
+const (
+	FailureTimeout = "timeout" // the step or one of its commands ran out of time
+	FailureNetwork = "network" // a download or remote lookup failed; retried automatically
+	FailureBuild   = "build"   // a package failed to build (makepkg, AUR)
+	FailureOther   = "error"
+)
+
+// Default retry policy for network failures
+const (
+	defaultRetries    = 2
+	defaultRetryDelay = 15 * time.Second
+)
+
+// ManifestStep tunes how one step runs
+type ManifestStep struct {
+	Timeout    string `mapstructure:"timeout"`     // e.g. "2h"; also lifts the step's own command timeouts
+	Retries    *int   `mapstructure:"retries"`     // retries after network failures, default 2
+	RetryDelay string `mapstructure:"retry_delay"` // wait before the first retry, doubled after each; default 15s
+}
+
+// Validate checks the step settings
+func (s ManifestStep) Validate(id string) error {
+	for name, value := range map[string]string{"timeout": s.Timeout, "retry_delay": s.RetryDelay} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("step %s has an invalid %s %q (expected a duration such as 90m)", id, name, value)
+		}
+	}
+	if s.Retries != nil && *s.Retries < 0 {
+		return fmt.Errorf("step %s has negative retries", id)
+	}
+	return nil
+}
+
+// stepPolicy is the resolved timeout and retry settings of a step
+type stepPolicy struct {
+	timeout    time.Duration // 0 keeps the step's own command timeouts
+	retries    int
+	retryDelay time.Duration
+}
+
+// policy returns the manifest's settings for a step, with defaults filled in
+// (Validate has already rejected unparsable values)
+func (i *Installer) policy(stepID string) stepPolicy {
+	p := stepPolicy{retries: defaultRetries, retryDelay: defaultRetryDelay}
+	settings, ok := i.manifest.Steps[stepID]
+	if !ok {
+		return p
+	}
+	if d, err := time.ParseDuration(settings.Timeout); err == nil {
+		p.timeout = d
+	}
+	if settings.Retries != nil {
+		p.retries = *settings.Retries
+	}
+	if d, err := time.ParseDuration(settings.RetryDelay); err == nil {
+		p.retryDelay = d
+	}
+	return p
+}
+
+var (
+	// networkFailurePattern matches output of commands that failed to reach the network
+	networkFailurePattern = regexp.MustCompile(`(?i)could not resolve|temporary failure in name resolution|failed retrieving file|failed to connect|connection (timed out|refused|reset)|network is unreachable|operation timed out|unable to access|could not read from remote repository|early eof|ssl_error|tls handshake|curl: \((6|7|28|35|52|56)\)|error: failed to synchronize`)
+	// buildFailurePattern matches output of failed package builds
+	buildFailurePattern = regexp.MustCompile(`(?i)==> error:|a failure occurred in (build|package|check|prepare)\(\)|failed to build|error making:|compilation terminated`)
+)
+
+// classifyFailure sorts a step error into a failure class
+func classifyFailure(err error) string {
+	if err == nil {
+		return ""
+	}
+	message := err.Error()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || strings.Contains(message, "timed out after"):
+		return FailureTimeout
+	case networkFailurePattern.MatchString(message):
+		return FailureNetwork
+	case buildFailurePattern.MatchString(message):
+		return FailureBuild
+	}
+	return FailureOther
+}
+
+// runWithPolicy runs a step under its timeout, retrying network failures with
+// exponential backoff
+func (i *Installer) runWithPolicy(ctx context.Context, step *InstallStep) error {
+	p := i.policy(step.ID)
+	for attempt := 0; ; attempt++ {
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		}
+		err := step.Run(withStep(stepCtx, step.ID), i)
+		if err != nil && stepCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("%w (step timeout %v)", err, p.timeout)
+			step.Error = fmt.Errorf("%w (step timeout %v)", step.Error, p.timeout)
+		}
+		cancel()
+
+		step.Failure = classifyFailure(step.Error)
+		if err == nil || step.Failure != FailureNetwork || attempt >= p.retries || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.retryDelay << attempt
+		i.logger.Warn("%s failed with a network error, retrying in %v (retry %d of %d)", step.Name, delay, attempt+1, p.retries)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		step.Status = Pending
+		step.Error = nil
+		step.Failure = ""
+	}
+}
+
+// commandTimeout returns the timeout for a long-running command in the
+// current step: the step's configured timeout if it has one, else fallback
+func (i *Installer) commandTimeout(ctx context.Context, fallback time.Duration) time.Duration {
+	if p := i.policy(stepFromContext(ctx)); p.timeout > 0 {
+		return p.timeout
+	}
+	return fallback
+}
@@ -0,0 +1,212 @@
+package installer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// RemoteScript is an install script fetched from the network and verified before it runs
+type RemoteScript struct {
+	URL       string `mapstructure:"url"`
+	SHA256    string `mapstructure:"sha256"`    // pinned checksum; the script must match it
+	Signature string `mapstructure:"signature"` // URL of a detached GPG signature
+	Key       string `mapstructure:"key"`       // required signing key fingerprint
+}
+
+// sha256Pattern matches a hex SHA-256 digest
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Validate checks the script definition
+func (s RemoteScript) Validate(name string) error {
+	if !strings.HasPrefix(s.URL, "https://") {
+		return fmt.Errorf("script %s must be fetched over https", name)
+	}
+	if s.SHA256 != "" && !sha256Pattern.MatchString(s.SHA256) {
+		return fmt.Errorf("script %s has an invalid sha256 %q", name, s.SHA256)
+	}
+	if s.Key != "" && s.Signature == "" {
+		return fmt.Errorf("script %s has a key but no signature", name)
+	}
+	return nil
+}
+
+// approvedScriptPath is where the last executed copy of a script is kept
+func approvedScriptPath(name string) string {
+	return filepath.Join(utility.StateDir(), "scripts", name+".sh")
+}
+
+// fileSHA256 returns the hex SHA-256 of data
+func fileSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// runRemoteScript downloads a script, verifies it and only then runs it with sh.
+// Without a pinned checksum or signature the script is trusted on first use:
+// any later change is shown as a diff and refused unless changes are accepted.
+func (i *Installer) runRemoteScript(ctx context.Context, name string, opts *utility.ExecOptions) error {
+	script, ok := i.manifest.Scripts[name]
+	if !ok {
+		return fmt.Errorf("no script %q in the manifest", name)
+	}
+
+	dir, err := utility.EnsureDir(filepath.Join(utility.CacheDir(), "scripts"))
+	if err != nil {
+		return fmt.Errorf("failed to create script directory: %w", err)
+	}
+	path := filepath.Join(dir, name+".sh")
+
+	i.logger.Info("Downloading %s...", script.URL)
+	result, err := i.shell.Execute(ctx, fmt.Sprintf("curl -fsSL -o %s %s", utility.ShellQuote(path), utility.ShellQuote(script.URL)), &utility.ExecOptions{
+		Timeout: 2 * time.Minute,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", script.URL, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to download %s: %s", script.URL, strings.TrimSpace(result.Stderr))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read downloaded script: %w", err)
+	}
+	sum := fileSHA256(data)
+	i.logger.Info("Script %s: %d bytes, sha256 %s", name, len(data), sum)
+
+	if err := i.verifyScript(ctx, name, script, path, data, sum); err != nil {
+		return classify(ExitVerify, err)
+	}
+
+	result, err = i.execChange(ctx, "sh "+utility.ShellQuote(path), opts)
+	if err != nil {
+		return fmt.Errorf("script %s failed: %w", name, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("script %s failed: %s", name, strings.TrimSpace(result.Stderr))
+	}
+
+	if !i.dryRun {
+		approved := approvedScriptPath(name)
+		if _, err := utility.EnsureDir(filepath.Dir(approved)); err == nil {
+			if err := os.WriteFile(approved, data, 0644); err != nil {
+				i.logger.Warn("Failed to record approved script: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyScript checks a downloaded script against its pin, signature or the last approved copy
+func (i *Installer) verifyScript(ctx context.Context, name string, script RemoteScript, path string, data []byte, sum string) error {
+	if script.SHA256 != "" {
+		if !strings.EqualFold(script.SHA256, sum) {
+			i.showScriptChange(ctx, name, path)
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, script.SHA256, sum)
+		}
+		i.logger.Info("✓ Checksum matches pinned sha256")
+	}
+
+	if script.Signature != "" {
+		if err := i.verifySignature(ctx, name, script, path); err != nil {
+			return err
+		}
+	}
+
+	if script.SHA256 != "" || script.Signature != "" {
+		return nil
+	}
+
+	// Trust on first use
+	approved, err := os.ReadFile(approvedScriptPath(name))
+	if os.IsNotExist(err) {
+		i.logger.Warn("No checksum pinned for %s; trusting it on first use (pin it with sha256: %s)", name, sum)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read approved script: %w", err)
+	}
+	if fileSHA256(approved) == sum {
+		i.logger.Info("✓ Script unchanged since it was last run")
+		return nil
+	}
+
+	i.showScriptChange(ctx, name, path)
+	if !i.acceptScriptChanges {
+		return fmt.Errorf("script %s changed since it was last run; review the diff and rerun with --accept-script-changes, or pin its sha256 in the manifest", name)
+	}
+	i.logger.Warn("Running changed script %s (changes accepted)", name)
+	return nil
+}
+
+// verifySignature checks a detached GPG signature, and the signing key if one is required
+func (i *Installer) verifySignature(ctx context.Context, name string, script RemoteScript, path string) error {
+	sigPath := path + ".sig"
+	result, err := i.shell.Execute(ctx, fmt.Sprintf("curl -fsSL -o %s %s", utility.ShellQuote(sigPath), utility.ShellQuote(script.Signature)), &utility.ExecOptions{
+		Timeout: time.Minute,
+	})
+	if err != nil || result.ExitCode != 0 {
+		return fmt.Errorf("failed to download signature for %s", name)
+	}
+
+	result, err = i.shell.Execute(ctx, fmt.Sprintf("gpg --batch --status-fd 1 --verify %s %s", utility.ShellQuote(sigPath), utility.ShellQuote(path)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to verify signature for %s: %w", name, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("bad signature for %s: %s", name, strings.TrimSpace(result.Stderr))
+	}
+
+	if script.Key != "" {
+		want := strings.ToUpper(strings.ReplaceAll(script.Key, " ", ""))
+		match := false
+		for _, line := range strings.Split(result.Stdout, "\n") {
+			// [GNUPG:] VALIDSIG <fingerprint> ... <primary key fingerprint>
+			fields := strings.Fields(line)
+			if len(fields) > 2 && fields[1] == "VALIDSIG" {
+				for _, field := range fields[2:] {
+					if strings.ToUpper(field) == want {
+						match = true
+					}
+				}
+			}
+		}
+		if !match {
+			return fmt.Errorf("signature for %s was not made by key %s", name, script.Key)
+		}
+	}
+
+	i.logger.Info("✓ Signature verified")
+	return nil
+}
+
+// showScriptChange logs a diff between the last approved script and the download
+func (i *Installer) showScriptChange(ctx context.Context, name, path string) {
+	approved := approvedScriptPath(name)
+	if _, err := os.Stat(approved); err != nil {
+		return
+	}
+
+	result, err := i.shell.Execute(ctx, fmt.Sprintf("diff -u %s %s", utility.ShellQuote(approved), utility.ShellQuote(path)), nil)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(result.Stdout, "\n"), "\n")
+	i.logger.Warn("Script %s changed since it was last run (%d diff lines):", name, len(lines))
+	for idx, line := range lines {
+		if idx == 200 {
+			i.logger.Warn("  ... %d more lines", len(lines)-idx)
+			break
+		}
+		i.logger.Warn("  %s", line)
+	}
+}
@@ -0,0 +1,325 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// DefaultDaemonPath is where the daemira binary is installed unless the manifest says otherwise
+const DefaultDaemonPath = "/usr/local/bin/daemira"
+
+// daemonUnit is the user service that keeps daemira running
+const daemonUnit = "daemira.service"
+
+// ManifestDaemon configures how daemira installs itself
+type ManifestDaemon struct {
+	Path string `mapstructure:"path"` // binary location, e.g. ~/.local/bin/daemira; default /usr/local/bin/daemira
+}
+
+// daemonPath returns the configured binary location with ~ expanded
+func (m *Manifest) daemonPath() (string, error) {
+	path := m.Daemon.Path
+	if path == "" {
+		path = DefaultDaemonPath
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+	}
+	return path, nil
+}
+
+// daemonUnitFile renders the user unit running the binary at path
+func daemonUnitFile(path string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Daemira personal system daemon
+After=network-online.target
+
+[Service]
+# daemira reports when it is up, and pings the watchdog while it isn't hung;
+# a hung daemon is killed and restarted
+Type=notify
+NotifyAccess=main
+WatchdogSec=2min
+ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
+WorkingDirectory=%s
+Restart=on-failure
+RestartSec=10
+# daemira stops its own syncs and updates on SIGTERM, letting them finish
+KillMode=mixed
+TimeoutStopSec=5min
+
+[Install]
+WantedBy=default.target
+`, path, utility.StateDir())
+}
+
+// sudoersCommands are the daemira subcommands the sudoers drop-in lets run
+// as root without a password
+var sudoersCommands = []string{"system update"}
+
+// daemonSudoers renders the sudoers drop-in letting username run the
+// binary's sudoersCommands as root without a password
+func daemonSudoers(username, path string) string {
+	commands := make([]string, len(sudoersCommands))
+	for i, command := range sudoersCommands {
+		commands[i] = path + " " + command
+	}
+	return fmt.Sprintf("# Passwordless sudo for daemira\n# Generated by daemira install\n%s ALL=(root) NOPASSWD: %s\n", username, strings.Join(commands, ", "))
+}
+
+// sudoersSafe checks that only root can replace the binary at path, which
+// passwordless sudo for it would otherwise hand root to: the file and every
+// directory above it must be root's and not writable by anyone else
+func sudoersSafe(path string) error {
+	if isUserPath(path) {
+		return fmt.Errorf("%s is in your home directory", path)
+	}
+	for dir := path; ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("can't read the owner of %s", dir)
+		}
+		if stat.Uid != 0 {
+			return fmt.Errorf("%s isn't owned by root", dir)
+		}
+		if info.Mode().Perm()&0022 != 0 {
+			return fmt.Errorf("%s is writable by others than root (%s)", dir, info.Mode().Perm())
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// isUserPath reports whether path is inside the user's home, where no sudo is needed
+func isUserPath(path string) bool {
+	homeDir, err := os.UserHomeDir()
+	return err == nil && strings.HasPrefix(path, homeDir+string(filepath.Separator))
+}
+
+// userManagerRunning reports whether a systemd user manager is reachable
+func userManagerRunning() bool {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(runtimeDir, "systemd", "private"))
+	return err == nil
+}
+
+// stageFile writes generated content to a temporary file for installFile
+func stageFile(name, content string) (string, error) {
+	dir, err := utility.EnsureDir(filepath.Join(utility.CacheDir(), "install"))
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// installFile copies src to path with mode unless path already has the same
+// content, using sudo outside the home directory. A replaced file is backed up
+// and the change journaled. It reports whether the file changed.
+func (i *Installer) installFile(ctx context.Context, src, path string, mode os.FileMode) (bool, error) {
+	sudo := !isUserPath(path)
+	run := func(command string, change bool) (*utility.Result, error) {
+		opts := &utility.ExecOptions{UseSudo: sudo, Timeout: time.Minute}
+		if change {
+			return i.execChange(ctx, command, opts)
+		}
+		// Reading root-only files (e.g. sudoers.d) needs sudo, which a dry run avoids
+		if i.dryRun {
+			opts.UseSudo = false
+		}
+		return i.shell.Execute(ctx, command, opts)
+	}
+
+	quoted := utility.ShellQuote(path)
+	if result, err := run(fmt.Sprintf("cmp -s %s %s", utility.ShellQuote(src), quoted), false); err == nil && result.ExitCode == 0 {
+		i.logger.Debug("%s is up to date", path)
+		return false, nil
+	}
+
+	// Keep the file being replaced; root-owned files stay out of the user's backup repository
+	backup := ""
+	if !sudo && !i.dryRun {
+		var err error
+		if backup, err = i.backupFile(ctx, path); err != nil {
+			return false, err
+		}
+	} else if result, err := run("test -e "+quoted, false); err == nil && result.ExitCode == 0 && !i.dryRun {
+		dir, err := utility.EnsureDir(filepath.Join(utility.StateDir(), "install-backup", time.Now().Format("20060102_150405")))
+		if err != nil {
+			return false, fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		backup = filepath.Join(dir, strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "_"))
+		result, err := run(fmt.Sprintf("cp -p %s %s", quoted, utility.ShellQuote(backup)), false)
+		if err != nil || result.ExitCode != 0 {
+			return false, fmt.Errorf("failed to back up %s", path)
+		}
+	}
+
+	result, err := run(fmt.Sprintf("install -D -m %o %s %s", mode, utility.ShellQuote(src), quoted), true)
+	if err != nil {
+		return false, fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return false, fmt.Errorf("failed to install %s: %s", path, strings.TrimSpace(result.Stderr))
+	}
+
+	kind := JournalFile
+	if sudo {
+		kind = JournalSystemFile
+	}
+	i.journal(ctx, kind, path, backup)
+	utility.Audit(utility.AuditWrite, path, "installed by the "+stepFromContext(ctx)+" step")
+	return true, nil
+}
+
+// installSudoers checks the sudoers drop-in for the binary at path with
+// visudo, then installs it to sudoersPath
+func (i *Installer) installSudoers(ctx context.Context, username, path, sudoersPath string) error {
+	// The sudoers drop-in is checked before it goes anywhere near /etc/sudoers.d
+	sudoers, err := stageFile("sudoers", daemonSudoers(username, path))
+	if err != nil {
+		return err
+	}
+	result, err := i.shell.Execute(ctx, "visudo -c -f "+utility.ShellQuote(sudoers), nil)
+	if err != nil {
+		return fmt.Errorf("failed to check sudoers drop-in: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("generated sudoers drop-in is invalid: %s", strings.TrimSpace(result.Stdout+result.Stderr))
+	}
+	_, err = i.installFile(ctx, sudoers, sudoersPath, 0440)
+	return err
+}
+
+// deployDaemon installs the running binary, its user unit and, when only
+// root can replace the binary, its sudoers drop-in, then enables the unit
+// (restarting it when anything changed)
+func (i *Installer) deployDaemon(ctx context.Context) error {
+	path, err := i.manifest.daemonPath()
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the daemira binary: %w", err)
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return fmt.Errorf("failed to locate the daemira binary: %w", err)
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	i.logger.Info("Installing daemira to %s...", path)
+	binaryChanged, err := i.installFile(ctx, self, path, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Passwordless sudo for a binary the user can replace is root for
+	// anything running as the user
+	sudoersPath := "/etc/sudoers.d/daemira-" + currentUser.Username
+	if err := sudoersSafe(path); err != nil && !(i.dryRun && errors.Is(err, os.ErrNotExist)) {
+		i.logger.Warn("Not writing %s: %v, so anything running as you could replace it; install daemira to %s for passwordless `sudo daemira system update` (and remove %s if an earlier install wrote one)",
+			sudoersPath, err, DefaultDaemonPath, sudoersPath)
+	} else if err := i.installSudoers(ctx, currentUser.Username, path, sudoersPath); err != nil {
+		return err
+	}
+
+	unitPath := filepath.Join(filepath.Dir(utility.ConfigDir()), "systemd", "user", daemonUnit)
+	unit, err := stageFile(daemonUnit, daemonUnitFile(path))
+	if err != nil {
+		return err
+	}
+	unitChanged, err := i.installFile(ctx, unit, unitPath, 0644)
+	if err != nil {
+		return err
+	}
+	if !i.dryRun {
+		if _, err := utility.EnsureDir(utility.StateDir()); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+	}
+
+	systemctl := func(args string) error {
+		result, err := i.execChange(ctx, "systemctl --user "+args, &utility.ExecOptions{Timeout: time.Minute})
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+		}
+		return nil
+	}
+
+	// Without a user session (e.g. in arch-chroot) enable by linking the unit
+	// the way systemctl would; it starts on the next login
+	if !userManagerRunning() {
+		link := filepath.Join(filepath.Dir(unitPath), "default.target.wants", daemonUnit)
+		if _, err := os.Lstat(link); err == nil {
+			i.logger.Info("%s already enabled; no user session to restart it in", daemonUnit)
+			return nil
+		}
+		if !i.changeFile(ctx, fmt.Sprintf("link %s -> %s", link, unitPath)) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return fmt.Errorf("failed to enable %s: %w", daemonUnit, err)
+		}
+		if err := os.Symlink(unitPath, link); err != nil {
+			return fmt.Errorf("failed to enable %s: %w", daemonUnit, err)
+		}
+		i.journal(ctx, JournalLink, link, "")
+		i.logger.Info("Enabled %s; it starts with the next user session", daemonUnit)
+		return nil
+	}
+
+	if unitChanged {
+		if err := systemctl("daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload user units: %w", err)
+		}
+	}
+
+	result, _ := i.shell.QuickExec("systemctl --user is-enabled " + daemonUnit)
+	if result == nil || result.ExitCode != 0 {
+		i.logger.Info("Enabling %s...", daemonUnit)
+		if err := systemctl("enable --now " + daemonUnit); err != nil {
+			return fmt.Errorf("failed to enable %s: %w", daemonUnit, err)
+		}
+		i.journal(ctx, JournalUserService, daemonUnit, "")
+	} else if binaryChanged || unitChanged {
+		i.logger.Info("Restarting %s...", daemonUnit)
+		if err := systemctl("restart " + daemonUnit); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", daemonUnit, err)
+		}
+	} else {
+		i.logger.Info("%s already enabled and up to date", daemonUnit)
+	}
+	return nil
+}
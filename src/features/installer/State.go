@@ -0,0 +1,110 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// StepRecord is the persisted result of one step
+type StepRecord struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Failure    string    `json:"failure,omitempty"` // failure class
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// InstallState is the persisted progress of an install, used by --resume
+type InstallState struct {
+	StartedAt time.Time             `json:"started_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Distro    string                `json:"distro"`
+	Manifest  string                `json:"manifest"`
+	Profile   string                `json:"profile"`
+	Completed bool                  `json:"completed"`
+	Steps     map[string]StepRecord `json:"steps"`
+}
+
+// statePath returns the install state file location
+func statePath() string {
+	return filepath.Join(utility.StateDir(), "install-state.json")
+}
+
+// newInstallState starts a fresh state for this run
+func newInstallState(distro Distro, manifest, profile string) *InstallState {
+	return &InstallState{
+		StartedAt: time.Now(),
+		Distro:    distro.String(),
+		Manifest:  manifest,
+		Profile:   profile,
+		Steps:     make(map[string]StepRecord),
+	}
+}
+
+// LoadInstallState reads the state of the last install
+func LoadInstallState() (*InstallState, error) {
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no previous install to resume")
+		}
+		return nil, fmt.Errorf("failed to read install state: %w", err)
+	}
+
+	state := &InstallState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse install state: %w", err)
+	}
+	if state.Steps == nil {
+		state.Steps = make(map[string]StepRecord)
+	}
+	return state, nil
+}
+
+// save writes the state to disk
+func (s *InstallState) save() error {
+	s.UpdatedAt = time.Now()
+	return writeStateFile(statePath(), s)
+}
+
+// writeStateFile writes JSON atomically into the state directory
+func writeStateFile(path string, v interface{}) error {
+	if _, err := utility.EnsureDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// record stores a finished step
+func (s *InstallState) record(step *InstallStep) {
+	record := StepRecord{
+		Status:     step.Status.String(),
+		FinishedAt: time.Now(),
+	}
+	if step.Error != nil {
+		record.Error = step.Error.Error()
+		record.Failure = step.Failure
+	}
+	s.Steps[step.ID] = record
+}
+
+// IsDone reports whether a step already succeeded (or was skipped) in a previous run
+func (s *InstallState) IsDone(stepID string) bool {
+	record, ok := s.Steps[stepID]
+	return ok && (record.Status == Success.String() || record.Status == Skipped.String())
+}
@@ -63,8 +63,11 @@ type InstallStep struct {
 	Description string
 	Status      StepStatus
 	Error       error
+	Failure     string // failure class of Error, e.g. 'network' (see classifyFailure)
 	Execute     func(ctx context.Context, installer *Installer) error
 	Skip        func(installer *Installer) bool
+	DependsOn   []string // steps that must complete first
+	Locks       []string // resources held while running, e.g. the pacman database
 }
 
 // NewInstallStep creates a new installation step
@@ -107,9 +110,17 @@ func (s *InstallStep) Run(ctx context.Context, installer *Installer) error {
 	return nil
 }
 
+// completed reports whether the step finished in a way its dependents can build on
+func (s *InstallStep) completed() bool {
+	return s.Status == Success || s.Status == Warning || s.Status == Skipped
+}
+
 // Summary returns a summary string for the step
 func (s *InstallStep) Summary() string {
 	if s.Error != nil {
+		if s.Failure != "" {
+			return fmt.Sprintf("[%s] %s - %s, %s (Error: %v)", s.Status.Icon(), s.Name, s.Status.String(), s.Failure, s.Error)
+		}
 		return fmt.Sprintf("[%s] %s - %s (Error: %v)", s.Status.Icon(), s.Name, s.Status.String(), s.Error)
 	}
 	return fmt.Sprintf("[%s] %s - %s", s.Status.Icon(), s.Name, s.Status.String())
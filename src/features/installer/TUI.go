@@ -0,0 +1,531 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// maxOutputLines is how much command output the TUI keeps for scrolling
+const maxOutputLines = 1000
+
+// renderInterval is how often the screen is redrawn while steps run
+const renderInterval = 100 * time.Millisecond
+
+// ANSI colors used by the TUI
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiDim     = "\033[2m"
+	ansiRed     = "\033[31m"
+	ansiGreen   = "\033[32m"
+	ansiYellow  = "\033[33m"
+	ansiCyan    = "\033[36m"
+	ansiReverse = "\033[7m"
+)
+
+// escapePattern matches terminal control sequences in command output
+var escapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// tuiMode is the screen the TUI is showing
+type tuiMode int
+
+const (
+	modeSelect tuiMode = iota
+	modeRunning
+	modePrompt
+	modeSummary
+)
+
+// outputLine is a line in the output pane; level -1 is command output
+type outputLine struct {
+	level utility.LogLevel
+	text  string
+}
+
+// Messages the TUI gets besides key presses and window sizes
+type (
+	tickMsg      struct{} // time to redraw the elapsed time and output
+	stepsDoneMsg struct{} // every selected step ran
+)
+
+// tui is the interactive installer front end, a bubbletea model. The steps
+// run in a command of their own, so output and prompts from them go through
+// mu.
+type tui struct {
+	installer *Installer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	answers   chan string
+	selected  []bool
+	cursor    int
+	width     int
+	height    int
+	mode      tuiMode
+	started   bool
+	current   int
+	output    []outputLine
+	scroll    int    // lines scrolled up from the bottom of the output
+	prompt    string // name of the failed step being asked about
+	aborted   bool
+	startTime time.Time
+	askMu     sync.Mutex
+	mu        sync.Mutex
+}
+
+// runTUI runs the installer interactively: pick steps, watch them run, and
+// decide what to do when one fails
+func (i *Installer) runTUI(ctx context.Context) error {
+	if !i.dryRun {
+		// Cache sudo credentials before the terminal goes raw, since commands
+		// run by the TUI cannot prompt for a password
+		if err := utility.GetPrivilegeManager().Authenticate(ctx); err != nil {
+			return fmt.Errorf("failed to authenticate with sudo: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t := &tui{
+		installer: i,
+		ctx:       ctx,
+		cancel:    cancel,
+		answers:   make(chan string, 1),
+		selected:  make([]bool, len(i.steps)),
+		width:     80,
+		height:    24,
+		current:   -1,
+	}
+	for idx, step := range i.steps {
+		// Steps finished by a previous run start deselected when resuming
+		t.selected[idx] = !(i.resume && i.state.IsDone(step.ID))
+	}
+
+	// Log lines would garble the screen; they go to the output pane instead
+	i.logger.SetSink(t.appendLog)
+	i.outputHook = t.appendOutput
+	_, err := tea.NewProgram(t, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	i.logger.SetSink(nil)
+	i.outputHook = nil
+	if !t.started {
+		if err != nil {
+			return fmt.Errorf("installer TUI failed: %w", err)
+		}
+		i.logger.Info("Installation cancelled")
+		return nil
+	}
+
+	err = i.finish(time.Since(t.startTime))
+	if t.aborted {
+		return fmt.Errorf("installation aborted")
+	}
+	return err
+}
+
+// Init starts on the step list
+func (t *tui) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles key presses, resizes and the running steps' progress
+func (t *tui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// A terminal without a size keeps the 80x24 default
+		if msg.Width > 0 && msg.Height > 0 {
+			t.mu.Lock()
+			t.width, t.height = msg.Width, msg.Height
+			t.mu.Unlock()
+		}
+	case tickMsg:
+		if t.currentMode() != modeSummary {
+			return t, tick()
+		}
+	case stepsDoneMsg:
+		t.setMode(modeSummary)
+	case tea.KeyMsg:
+		switch t.currentMode() {
+		case modeSelect:
+			return t, t.handleSelectKey(msg.String())
+		case modeSummary:
+			return t, tea.Quit
+		default:
+			t.handleRunningKey(msg.String())
+		}
+	}
+	return t, nil
+}
+
+// tick asks for the next redraw while steps run
+func tick() tea.Cmd {
+	return tea.Tick(renderInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+// handleSelectKey moves through and toggles the step list, and starts or
+// cancels the install
+func (t *tui) handleSelectKey(key string) tea.Cmd {
+	switch key {
+	case "up", "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "down", "j":
+		if t.cursor < len(t.selected)-1 {
+			t.cursor++
+		}
+	case " ":
+		t.selected[t.cursor] = !t.selected[t.cursor]
+	case "a":
+		all := true
+		for _, selected := range t.selected {
+			all = all && selected
+		}
+		for idx := range t.selected {
+			t.selected[idx] = !all
+		}
+	case "enter":
+		t.started = true
+		t.startTime = time.Now()
+		t.setMode(modeRunning)
+		return tea.Batch(t.run, tick())
+	case "q", "esc", "ctrl+c":
+		return tea.Quit
+	}
+	return nil
+}
+
+// run executes the selected steps, as a bubbletea command
+func (t *tui) run() tea.Msg {
+	// Keep the sudo timestamp fresh for long installs
+	if !t.installer.dryRun {
+		stopKeepAlive := utility.GetPrivilegeManager().KeepAlive(t.ctx)
+		defer stopKeepAlive()
+	}
+	t.runSteps(t.ctx, t.cancel)
+	return stepsDoneMsg{}
+}
+
+// runSteps runs the selected steps as their dependencies complete, asking
+// what to do when one fails
+func (t *tui) runSteps(ctx context.Context, cancel context.CancelFunc) {
+	i := t.installer
+	i.runGraph(ctx, func(ctx context.Context, idx int, step *InstallStep) {
+		t.mu.Lock()
+		t.current = idx
+		t.mu.Unlock()
+
+		if !t.selected[idx] {
+			if i.resume && i.state.IsDone(step.ID) {
+				step.Status = Success
+			} else {
+				step.Status = Skipped
+			}
+			return
+		}
+
+		for {
+			i.logger.Info("Step %d/%d: %s", idx+1, len(i.steps), step.Name)
+			if err := i.runStep(ctx, step); err == nil || ctx.Err() != nil {
+				return
+			}
+
+			switch t.ask(ctx, step) {
+			case "r":
+				step.Status = Pending
+				step.Error = nil
+				continue
+			case "s":
+				// The failure stays in the install state so --resume retries it
+				step.Status = Skipped
+			default:
+				t.mu.Lock()
+				t.aborted = true
+				t.mu.Unlock()
+				cancel()
+			}
+			return
+		}
+	})
+}
+
+// ask shows the retry/skip/abort prompt for a failed step and waits for the
+// answer; prompts from steps running in parallel take turns
+func (t *tui) ask(ctx context.Context, step *InstallStep) string {
+	t.askMu.Lock()
+	defer t.askMu.Unlock()
+
+	t.mu.Lock()
+	t.mode = modePrompt
+	t.prompt = step.Name
+	t.mu.Unlock()
+
+	answer := "a"
+	select {
+	case answer = <-t.answers:
+	case <-ctx.Done():
+	}
+	t.setMode(modeRunning)
+	return answer
+}
+
+// handleRunningKey scrolls the output, answers prompts and handles Ctrl+C
+func (t *tui) handleRunningKey(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	page := max(t.height/2, 1)
+	switch key {
+	case "up", "k":
+		t.scroll++
+	case "down", "j":
+		t.scroll--
+	case "pgup":
+		t.scroll += page
+	case "pgdown":
+		t.scroll -= page
+	case "G", "g":
+		t.scroll = 0
+	case "ctrl+c":
+		t.aborted = true
+		t.cancel()
+		if t.mode == modePrompt {
+			t.mode = modeRunning
+			t.answers <- "a"
+		}
+	case "r", "s", "a":
+		if t.mode == modePrompt {
+			t.mode = modeRunning
+			t.answers <- key
+		}
+	}
+	t.scroll = max(0, min(t.scroll, len(t.output)-1))
+}
+
+// currentMode returns the screen being shown
+func (t *tui) currentMode() tuiMode {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.mode
+}
+
+// setMode switches the screen
+func (t *tui) setMode(mode tuiMode) {
+	t.mu.Lock()
+	t.mode = mode
+	t.mu.Unlock()
+}
+
+// appendLog is the logger sink while the TUI is active
+func (t *tui) appendLog(level utility.LogLevel, message string) {
+	if level == utility.DEBUG {
+		return
+	}
+	t.append(outputLine{level: level, text: message})
+}
+
+// appendOutput receives command output lines
+func (t *tui) appendOutput(line string) {
+	// Progress bars redraw with \r; only the final state is worth keeping
+	if idx := strings.LastIndex(line, "\r"); idx >= 0 {
+		line = line[idx+1:]
+	}
+	// Colors are kept; cursor movement and the like would garble the pane
+	line = escapePattern.ReplaceAllStringFunc(line, func(seq string) string {
+		if strings.HasSuffix(seq, "m") {
+			return seq
+		}
+		return ""
+	})
+	t.append(outputLine{level: -1, text: line})
+}
+
+// append adds a line to the output pane, keeping the view still when scrolled up
+func (t *tui) append(line outputLine) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.output = append(t.output, line)
+	if len(t.output) > maxOutputLines {
+		t.output = t.output[len(t.output)-maxOutputLines:]
+	}
+	if t.scroll > 0 {
+		t.scroll = min(t.scroll+1, len(t.output)-1)
+	}
+}
+
+// truncate cuts s to width runes
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	if width == 1 {
+		return string(runes[:1])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// truncateVisible cuts s to width visible runes, keeping the color
+// sequences in it without counting them
+func truncateVisible(s string, width int) string {
+	if utf8.RuneCountInString(escapePattern.ReplaceAllString(s, "")) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	visible := 0
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "\x1b") {
+			if loc := escapePattern.FindStringIndex(s); loc != nil && loc[0] == 0 {
+				b.WriteString(s[:loc[1]])
+				s = s[loc[1]:]
+				continue
+			}
+		}
+		if visible == width-1 {
+			b.WriteString("…" + ansiReset)
+			break
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		b.WriteRune(r)
+		visible++
+		s = s[size:]
+	}
+	return b.String()
+}
+
+// statusColor returns the color for a step status
+func statusColor(status StepStatus) string {
+	switch status {
+	case Success:
+		return ansiGreen
+	case Running:
+		return ansiCyan
+	case Warning, Skipped:
+		return ansiYellow
+	case Failed:
+		return ansiRed
+	default:
+		return ansiDim
+	}
+}
+
+// View draws the whole screen
+func (t *tui) View() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := t.installer
+	width, height := t.width, t.height
+	var lines []string
+
+	title := fmt.Sprintf(" Daemira Installer · %s · profile %s", i.distro, i.profile)
+	if i.dryRun {
+		title += " · dry run"
+	}
+	lines = append(lines, ansiBold+truncate(title, width)+ansiReset, strings.Repeat("─", width))
+
+	// Step list, windowed around the cursor or running step when it does not fit
+	focus := t.cursor
+	if t.mode != modeSelect {
+		focus = max(t.current, 0)
+	}
+	listHeight := len(i.steps)
+	if t.mode != modeSelect && t.mode != modeSummary {
+		listHeight = min(listHeight, max(height/3, 3))
+	} else {
+		listHeight = min(listHeight, max(height-6, 1))
+	}
+	first := max(0, min(focus-listHeight/2, len(i.steps)-listHeight))
+
+	for idx := first; idx < first+listHeight && idx < len(i.steps); idx++ {
+		step := i.steps[idx]
+		var line string
+		if t.mode == modeSelect {
+			box := "[ ]"
+			if t.selected[idx] {
+				box = "[x]"
+			}
+			line = truncate(fmt.Sprintf(" %s %s - %s", box, step.Name, step.Description), width)
+			if idx == t.cursor {
+				line = ansiReverse + line + ansiReset
+			}
+		} else {
+			text := fmt.Sprintf(" %s %s", step.Status.Icon(), step.Name)
+			if step.Error != nil {
+				text += fmt.Sprintf(" - %v", step.Error)
+			}
+			line = statusColor(step.Status) + truncate(text, width) + ansiReset
+		}
+		lines = append(lines, line)
+	}
+
+	var footer string
+	switch t.mode {
+	case modeSelect:
+		footer = " ↑/↓ move · space toggle · a toggle all · enter start · q cancel"
+	case modeRunning:
+		footer = fmt.Sprintf(" %s elapsed · ↑/↓ PgUp/PgDn scroll · g follow · Ctrl+C abort", time.Since(t.startTime).Round(time.Second))
+	case modePrompt:
+		footer = ansiRed + fmt.Sprintf(" %s failed: [r]etry · [s]kip · [a]bort", t.prompt) + ansiReset
+	case modeSummary:
+		var successful, skipped, failed int
+		for _, step := range i.steps {
+			switch step.Status {
+			case Success:
+				successful++
+			case Skipped:
+				skipped++
+			case Failed:
+				failed++
+			}
+		}
+		footer = fmt.Sprintf(" ✓ %d successful · ⊘ %d skipped · ✗ %d failed · %s · press any key to exit",
+			successful, skipped, failed, time.Since(t.startTime).Round(time.Second))
+	}
+
+	// Output pane fills the remaining space
+	if t.mode != modeSelect {
+		paneHeight := height - len(lines) - 3
+		if paneHeight > 0 {
+			header := "─ Output "
+			if t.scroll > 0 {
+				header += fmt.Sprintf("(scrolled %d) ", t.scroll)
+			}
+			lines = append(lines, ansiDim+header+strings.Repeat("─", max(width-utf8.RuneCountInString(header), 0))+ansiReset)
+
+			end := len(t.output) - t.scroll
+			start := max(end-paneHeight, 0)
+			for _, out := range t.output[start:end] {
+				text := truncateVisible(out.text, width)
+				switch out.level {
+				case utility.WARN:
+					text = ansiYellow + text + ansiReset
+				case utility.ERROR:
+					text = ansiRed + text + ansiReset
+				case -1:
+					text = ansiDim + text + ansiReset
+				}
+				lines = append(lines, text)
+			}
+			for n := end - start; n < paneHeight; n++ {
+				lines = append(lines, "")
+			}
+		}
+	}
+
+	lines = append(lines, strings.Repeat("─", width), footer)
+	return strings.Join(lines[:min(len(lines), height)], "\n")
+}
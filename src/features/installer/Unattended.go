@@ -0,0 +1,163 @@
+package installer
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Exit codes of an unattended install, one per failure class
+const (
+	ExitOK          = 0
+	ExitFailure     = 1 // unexpected error
+	ExitConfig      = 2 // invalid options or manifest
+	ExitUnsupported = 3 // distribution or target system not supported
+	ExitStepFailed  = 4 // one or more steps failed
+	ExitIncomplete  = 5 // interrupted or timed out before every step ran
+	ExitVerify      = 6 // a remote script failed verification
+)
+
+// InstallError is an installer error tagged with its failure class
+type InstallError struct {
+	Code int
+	Err  error
+}
+
+func (e *InstallError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InstallError) Unwrap() error {
+	return e.Err
+}
+
+// classify tags err with an exit code unless it already carries one
+func classify(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var installErr *InstallError
+	if errors.As(err, &installErr) {
+		return err
+	}
+	return &InstallError{Code: code, Err: err}
+}
+
+// ExitCode returns the process exit code for an install error
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var installErr *InstallError
+	if errors.As(err, &installErr) {
+		return installErr.Code
+	}
+	return ExitFailure
+}
+
+// hostSteps act on the invoking user's home and session, or use tools that
+// cannot target another root, so they do not run against one
+var hostSteps = map[string]bool{
+	"dkms-install":    true,
+	"dotfiles":        true,
+	"aur-helper":      true,
+	"user-apps":       true,
+	"flatpak":         true,
+	"user-groups":     true,
+	"shell-config":    true,
+	"daemira-service": true,
+}
+
+// ProgressEvent is one line of machine-readable progress in unattended mode
+type ProgressEvent struct {
+	Event    string            `json:"event"` // 'start' | 'step_start' | 'step_end' | 'summary'
+	Time     time.Time         `json:"time"`
+	Step     string            `json:"step,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Index    int               `json:"index,omitempty"` // 1-based
+	Total    int               `json:"total,omitempty"`
+	Status   string            `json:"status,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Duration float64           `json:"duration_seconds,omitempty"`
+	Failure  string            `json:"failure,omitempty"` // failure class: timeout, network, build or error
+	Failed   []string          `json:"failed,omitempty"`
+	Failures map[string]string `json:"failures,omitempty"` // failure class per failed step
+	NotRun   []string          `json:"not_run,omitempty"`
+	ExitCode *int              `json:"exit_code,omitempty"`
+}
+
+// emit writes a progress event as a JSON line; it does nothing unless unattended
+func (i *Installer) emit(event ProgressEvent) {
+	if i.events == nil {
+		return
+	}
+	event.Time = time.Now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := json.NewEncoder(i.events).Encode(event); err != nil {
+		i.logger.Warn("Failed to write progress event: %v", err)
+	}
+}
+
+// emitStepEnd reports a finished step
+func (i *Installer) emitStepEnd(idx int, step *InstallStep, duration time.Duration) {
+	event := ProgressEvent{
+		Event:    "step_end",
+		Step:     step.ID,
+		Name:     step.Name,
+		Index:    idx + 1,
+		Total:    len(i.steps),
+		Status:   step.Status.String(),
+		Duration: duration.Seconds(),
+	}
+	if step.Error != nil {
+		event.Error = step.Error.Error()
+		event.Failure = step.Failure
+	}
+	i.emit(event)
+}
+
+// targetsRoot reports whether the install goes into another root than the running system
+func (i *Installer) targetsRoot() bool {
+	return i.root != "" && i.root != "/"
+}
+
+// rootPath returns path inside the target root
+func (i *Installer) rootPath(path string) string {
+	if !i.targetsRoot() {
+		return path
+	}
+	return filepath.Join(i.root, path)
+}
+
+// pacmanCommand returns pacman with the target root applied
+func (i *Installer) pacmanCommand() string {
+	if !i.targetsRoot() {
+		return "pacman"
+	}
+	return "pacman --root " + utility.ShellQuote(i.root)
+}
+
+// systemctlCommand returns systemctl with the target root applied
+func (i *Installer) systemctlCommand() string {
+	if !i.targetsRoot() {
+		return "systemctl"
+	}
+	return "systemctl --root=" + utility.ShellQuote(i.root)
+}
+
+// applyRoot skips the host-only steps when installing into another root
+func (i *Installer) applyRoot() {
+	if !i.targetsRoot() {
+		return
+	}
+	for _, step := range i.steps {
+		if hostSteps[step.ID] {
+			step.Skip = func(*Installer) bool { return true }
+		}
+	}
+}
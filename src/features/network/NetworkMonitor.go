@@ -0,0 +1,389 @@
+/**
+ * Network monitor
+ * Follows the Wi-Fi network in use (through NetworkManager's nmcli) and
+ * applies the first network profile matching it: a profile matches networks
+ * by SSID and whether NetworkManager considers them metered (phone hotspots
+ * usually are), and sets what daemira does there, such as capping sync
+ * bandwidth, pausing scheduled updates or switching the power profile. The
+ * daemon applies the settings through a callback; a hook command runs on
+ * every change.
+ */
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// networkCheckInterval is how often the network in use is looked up
+const networkCheckInterval = 30 * time.Second
+
+// Network is the Wi-Fi network in use
+type Network struct {
+	SSID    string // "" when not on Wi-Fi
+	Device  string
+	Metered bool
+}
+
+// String describes a network for logs, e.g. "HomeNet (metered)"
+func (n Network) String() string {
+	name := n.SSID
+	if name == "" {
+		name = "no Wi-Fi"
+	}
+	if n.Metered {
+		name += " (metered)"
+	}
+	return name
+}
+
+// NetworkProfile is what daemira does while on matching networks
+type NetworkProfile struct {
+	Name           string // for logs and hooks; the SSID pattern by default
+	SSID           string // glob pattern; "" matches every network
+	Metered        string // "true" or "false" to match on it, "" for either
+	BandwidthLimit string // rclone --bwlimit for Google Drive sync
+	PauseUpdates   bool   // defer scheduled system updates
+	PowerProfile   string // power-profiles-daemon profile to switch to
+}
+
+// Matches reports whether a profile applies to a network
+func (p *NetworkProfile) Matches(network Network) bool {
+	if p.SSID != "" {
+		if network.SSID == "" {
+			return false
+		}
+		if ok, err := path.Match(p.SSID, network.SSID); err != nil || !ok {
+			return false
+		}
+	}
+	if p.Metered != "" && p.Metered != fmt.Sprint(network.Metered) {
+		return false
+	}
+	return true
+}
+
+// Effects lists what a profile changes, e.g. "sync capped at 1M, updates paused"
+func (p *NetworkProfile) Effects() string {
+	var effects []string
+	if p.BandwidthLimit != "" {
+		effects = append(effects, "sync capped at "+p.BandwidthLimit)
+	}
+	if p.PauseUpdates {
+		effects = append(effects, "updates paused")
+	}
+	if p.PowerProfile != "" {
+		effects = append(effects, "power profile "+p.PowerProfile)
+	}
+	if len(effects) == 0 {
+		return "nothing"
+	}
+	return strings.Join(effects, ", ")
+}
+
+// networkProfileFieldRegex matches the key=value fields of a profile;
+// values with spaces are quoted, e.g. ssid="Office WiFi"
+var networkProfileFieldRegex = regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`)
+
+// ParseNetworkProfile parses a profile such as
+// "name=hotspot metered=true bwlimit=500K pause_updates=true power=power-saver"
+func ParseNetworkProfile(rule string) (*NetworkProfile, error) {
+	profile := &NetworkProfile{}
+	for _, match := range networkProfileFieldRegex.FindAllStringSubmatch(rule, -1) {
+		key, value := match[1], strings.Trim(match[2], `"`)
+		switch key {
+		case "name":
+			profile.Name = value
+		case "ssid":
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("network profile %q: invalid ssid pattern: %w", rule, err)
+			}
+			profile.SSID = value
+		case "metered":
+			if value != "true" && value != "false" {
+				return nil, fmt.Errorf("network profile %q: metered must be true or false", rule)
+			}
+			profile.Metered = value
+		case "bwlimit":
+			profile.BandwidthLimit = value
+		case "pause_updates":
+			profile.PauseUpdates = value == "true"
+		case "power":
+			if value != "performance" && value != "balanced" && value != "power-saver" {
+				return nil, fmt.Errorf("network profile %q: power must be performance, balanced or power-saver", rule)
+			}
+			profile.PowerProfile = value
+		default:
+			return nil, fmt.Errorf("network profile %q: unknown field %q", rule, key)
+		}
+	}
+	if profile.Name == "" {
+		profile.Name = profile.SSID
+	}
+	if profile.Name == "" {
+		return nil, fmt.Errorf("network profile %q needs a name or an ssid", rule)
+	}
+	return profile, nil
+}
+
+// ParseNetworkProfiles parses several network profiles
+func ParseNetworkProfiles(rules []string) ([]*NetworkProfile, error) {
+	profiles := make([]*NetworkProfile, 0, len(rules))
+	for _, rule := range rules {
+		profile, err := ParseNetworkProfile(rule)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// MatchProfile returns the first profile applying to a network, or nil
+func MatchProfile(profiles []*NetworkProfile, network Network) *NetworkProfile {
+	for _, profile := range profiles {
+		if profile.Matches(network) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// NetworkMonitor applies network profiles as the network changes
+type NetworkMonitor struct {
+	logger    *utility.Logger
+	shell     *utility.Shell
+	profiles  []*NetworkProfile
+	hook      string
+	callbacks []func(Network, *NetworkProfile)
+	network   Network
+	profile   *NetworkProfile
+	checked   bool // network and profile hold what was last applied
+	onResume  bool // a check on resume is registered
+	isRunning bool
+	stopChan  chan struct{}
+	ticker    *time.Ticker
+	checkMu   sync.Mutex // held while a check runs
+	mu        sync.Mutex
+}
+
+var (
+	networkMonitorInstance *NetworkMonitor
+	networkMonitorOnce     sync.Once
+)
+
+// GetNetworkMonitor returns the singleton NetworkMonitor instance
+func GetNetworkMonitor() *NetworkMonitor {
+	networkMonitorOnce.Do(func() {
+		networkMonitorInstance = &NetworkMonitor{
+			logger: utility.GetLogger().With("network"),
+			shell:  utility.NewShell(utility.GetLogger()),
+		}
+	})
+	return networkMonitorInstance
+}
+
+// IsAvailable reports whether NetworkManager can be asked
+func (nm *NetworkMonitor) IsAvailable() bool {
+	_, err := exec.LookPath("nmcli")
+	return err == nil
+}
+
+// SetProfiles replaces the profiles and hook, applying them at the next check
+func (nm *NetworkMonitor) SetProfiles(profiles []*NetworkProfile, hook string) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	nm.profiles = profiles
+	nm.hook = hook
+	nm.checked = false
+}
+
+// OnChange registers a callback run with the network and its profile (nil
+// for none) when either changes
+func (nm *NetworkMonitor) OnChange(callback func(Network, *NetworkProfile)) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.callbacks = append(nm.callbacks, callback)
+}
+
+// IsRunning reports whether the network is being watched
+func (nm *NetworkMonitor) IsRunning() bool {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return nm.isRunning
+}
+
+// Current returns the network and profile last applied
+func (nm *NetworkMonitor) Current() (Network, *NetworkProfile) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return nm.network, nm.profile
+}
+
+// Start applies the profile of the network in use now, then checks every
+// 30 seconds and on resume
+func (nm *NetworkMonitor) Start() error {
+	if !nm.IsAvailable() {
+		return fmt.Errorf("nmcli not found (network profiles need NetworkManager)")
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if nm.isRunning {
+		return nil
+	}
+	nm.isRunning = true
+	nm.stopChan = make(chan struct{})
+	nm.ticker = time.NewTicker(networkCheckInterval)
+	nm.logger.Info("Watching the network (%d profiles)", len(nm.profiles))
+
+	if !nm.onResume {
+		nm.onResume = true
+		utility.GetSleepWatcher().OnResume(func(time.Duration) {
+			// Wi-Fi takes a moment to reconnect after resume
+			time.AfterFunc(10*time.Second, func() { nm.Check(context.Background()) })
+		})
+	}
+	ticker, stop := nm.ticker, nm.stopChan
+	go utility.Supervise("network-monitor", func() {
+		nm.Check(context.Background())
+		for {
+			select {
+			case <-ticker.C:
+				nm.Check(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops checking the network
+func (nm *NetworkMonitor) Stop() {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if !nm.isRunning {
+		return
+	}
+	nm.isRunning = false
+	nm.ticker.Stop()
+	close(nm.stopChan)
+}
+
+// Check looks up the network and applies its profile if it changed
+func (nm *NetworkMonitor) Check(ctx context.Context) {
+	nm.checkMu.Lock()
+	defer nm.checkMu.Unlock()
+
+	network, err := nm.Detect(ctx)
+	if err != nil {
+		nm.logger.Debug("Failed to look up the network: %v", err)
+		return
+	}
+
+	nm.mu.Lock()
+	if !nm.isRunning {
+		nm.mu.Unlock()
+		return
+	}
+	profile := MatchProfile(nm.profiles, network)
+	if nm.checked && network == nm.network && profile == nm.profile {
+		nm.mu.Unlock()
+		return
+	}
+	previous := nm.network
+	first := !nm.checked
+	nm.network, nm.profile, nm.checked = network, profile, true
+	hook := nm.hook
+	callbacks := append([]func(Network, *NetworkProfile){}, nm.callbacks...)
+	nm.mu.Unlock()
+
+	if profile != nil {
+		nm.logger.Info("On %s, applying network profile %s: %s", network, profile.Name, profile.Effects())
+	} else {
+		nm.logger.Info("On %s, no network profile applies", network)
+	}
+	for _, callback := range callbacks {
+		callback(network, profile)
+	}
+	// The hook runs on changes of network, not on start or config changes
+	if hook != "" && !first && network != previous {
+		if err := nm.runHook(ctx, hook, network, previous, profile); err != nil {
+			nm.logger.Warn("%v", err)
+		}
+	}
+}
+
+// Detect asks NetworkManager which Wi-Fi network is in use
+func (nm *NetworkMonitor) Detect(ctx context.Context) (Network, error) {
+	// e.g. "yes:wlan0:Home\:Net"; the SSID comes last as it may hold colons
+	result, err := nm.shell.ExecuteArgs(ctx, "nmcli", []string{"-t", "-f", "ACTIVE,DEVICE,SSID", "device", "wifi", "list", "--rescan", "no"}, &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		return Network{}, err
+	}
+	if result.ExitCode != 0 {
+		return Network{}, fmt.Errorf("nmcli failed: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	var network Network
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) == 3 && fields[0] == "yes" {
+			network.Device = fields[1]
+			network.SSID = strings.ReplaceAll(fields[2], `\:`, ":")
+			break
+		}
+	}
+	if network.Device == "" {
+		return network, nil
+	}
+
+	// "yes", "yes (guessed)", "no (guessed)" or "unknown"
+	result, err = nm.shell.ExecuteArgs(ctx, "nmcli", []string{"-g", "GENERAL.METERED", "device", "show", network.Device}, &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err == nil && result.ExitCode == 0 {
+		network.Metered = strings.HasPrefix(strings.TrimSpace(result.Stdout), "yes")
+	}
+	return network, nil
+}
+
+// runHook runs the hook command for a change of network
+func (nm *NetworkMonitor) runHook(ctx context.Context, command string, network, previous Network, profile *NetworkProfile) error {
+	vars := map[string]string{
+		"DAEMIRA_NETWORK_SSID":          network.SSID,
+		"DAEMIRA_NETWORK_PREVIOUS_SSID": previous.SSID,
+		"DAEMIRA_NETWORK_METERED":       fmt.Sprint(network.Metered),
+		"DAEMIRA_NETWORK_PROFILE":       "",
+	}
+	if profile != nil {
+		vars["DAEMIRA_NETWORK_PROFILE"] = profile.Name
+	}
+
+	result, err := nm.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: time.Minute,
+		Env:     vars,
+	})
+	if err != nil {
+		return fmt.Errorf("network hook failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("network hook exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+/**
+ * VPN status
+ * Finds the VPNs that are up: WireGuard interfaces, tun/tap interfaces
+ * (OpenVPN and the like) and Tailscale, asked through its CLI. Whether the
+ * default route goes through one tells a full tunnel (all traffic, as a
+ * kill switch expects) from a split one. The VPN watcher checks every 30
+ * seconds and lets the daemon hold syncs while the VPN is down.
+ */
+
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// VPN kinds
+const (
+	VPNWireGuard = "wireguard"
+	VPNTunnel    = "tun" // OpenVPN and other tun/tap tunnels
+	VPNTailscale = "tailscale"
+)
+
+// VPN is a VPN connection
+type VPN struct {
+	Name      string // interface, e.g. wg0
+	Kind      string
+	Up        bool
+	Addresses []string // for Tailscale, its tailnet addresses
+	ExitNode  string   // for Tailscale, the exit node in use
+}
+
+// VPNStatus is the VPNs found and where the default route goes
+type VPNStatus struct {
+	VPNs         []VPN
+	DefaultRoute string // interface of the default route, "" if there is none
+}
+
+// Up returns the VPNs that are up among those named (interface names or
+// kinds), or among all of them if names is empty
+func (s VPNStatus) Up(names []string) []VPN {
+	var up []VPN
+	for _, vpn := range s.VPNs {
+		if !vpn.Up {
+			continue
+		}
+		if len(names) > 0 && !containsFold(names, vpn.Name) && !containsFold(names, vpn.Kind) {
+			continue
+		}
+		up = append(up, vpn)
+	}
+	return up
+}
+
+// FullTunnel reports whether all traffic goes through a VPN: the default
+// route leaves through one, or through a Tailscale exit node
+func (s VPNStatus) FullTunnel() bool {
+	for _, vpn := range s.VPNs {
+		if vpn.Up && (vpn.Name == s.DefaultRoute || vpn.ExitNode != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary describes the VPNs for status output, e.g. "wg0 (wireguard, all traffic)"
+func (s VPNStatus) Summary() string {
+	var parts []string
+	for _, vpn := range s.VPNs {
+		if !vpn.Up {
+			continue
+		}
+		detail := vpn.Kind
+		switch {
+		case vpn.ExitNode != "":
+			detail += ", all traffic via exit node " + vpn.ExitNode
+		case vpn.Name == s.DefaultRoute:
+			detail += ", all traffic"
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", vpn.Name, detail))
+	}
+	if len(parts) == 0 {
+		return "None up"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sysfsNet is where the kernel lists network interfaces
+const sysfsNet = "/sys/class/net"
+
+// iffUp is the IFF_UP interface flag
+const iffUp = 0x1
+
+// DetectVPNs finds the VPN interfaces, Tailscale and the default route
+func DetectVPNs(ctx context.Context, runner utility.CommandRunner) (VPNStatus, error) {
+	var status VPNStatus
+	entries, err := os.ReadDir(sysfsNet)
+	if err != nil {
+		return status, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		dir := filepath.Join(sysfsNet, name)
+		kind := ""
+		if uevent, err := os.ReadFile(filepath.Join(dir, "uevent")); err == nil && strings.Contains(string(uevent), "DEVTYPE=wireguard") {
+			kind = VPNWireGuard
+		} else if _, err := os.Stat(filepath.Join(dir, "tun_flags")); err == nil {
+			kind = VPNTunnel
+		}
+		if kind == "" {
+			continue
+		}
+		// Tailscale's own tun interface is reported through its CLI
+		if strings.HasPrefix(name, "tailscale") {
+			continue
+		}
+		status.VPNs = append(status.VPNs, VPN{Name: name, Kind: kind, Up: interfaceUp(dir)})
+	}
+
+	if tailscale, ok := detectTailscale(ctx, runner); ok {
+		status.VPNs = append(status.VPNs, tailscale)
+	}
+	status.DefaultRoute = defaultRoute(ctx, runner)
+	return status, nil
+}
+
+// interfaceUp reports whether an interface is up; tunnels report their
+// operational state as "unknown", so the administrative flag decides
+func interfaceUp(dir string) bool {
+	if state, err := os.ReadFile(filepath.Join(dir, "operstate")); err == nil && strings.TrimSpace(string(state)) == "down" {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "flags"))
+	if err != nil {
+		return false
+	}
+	flags, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"), 16, 32)
+	return err == nil && flags&iffUp != 0
+}
+
+// tailscaleStatus is the part of `tailscale status --json` used here
+type tailscaleStatus struct {
+	BackendState   string   `json:"BackendState"`
+	TailscaleIPs   []string `json:"TailscaleIPs"`
+	ExitNodeStatus *struct {
+		TailscaleIPs []string `json:"TailscaleIPs"`
+	} `json:"ExitNodeStatus"`
+}
+
+// detectTailscale asks the Tailscale CLI whether it is connected
+func detectTailscale(ctx context.Context, runner utility.CommandRunner) (VPN, bool) {
+	if _, err := exec.LookPath("tailscale"); err != nil {
+		return VPN{}, false
+	}
+	result, err := runner.ExecuteArgs(ctx, "tailscale", []string{"status", "--json", "--peers=false"}, &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil || result.Stdout == "" {
+		return VPN{}, false
+	}
+	var status tailscaleStatus
+	if err := json.Unmarshal([]byte(result.Stdout), &status); err != nil {
+		return VPN{}, false
+	}
+
+	vpn := VPN{Name: "tailscale0", Kind: VPNTailscale, Up: status.BackendState == "Running", Addresses: status.TailscaleIPs}
+	if status.ExitNodeStatus != nil && len(status.ExitNodeStatus.TailscaleIPs) > 0 {
+		vpn.ExitNode = strings.Split(status.ExitNodeStatus.TailscaleIPs[0], "/")[0]
+	}
+	return vpn, true
+}
+
+// TailscaleAddress returns this machine's IPv4 tailnet address, or an
+// error if Tailscale isn't connected
+func TailscaleAddress(ctx context.Context, runner utility.CommandRunner) (string, error) {
+	tailscale, ok := detectTailscale(ctx, runner)
+	if !ok {
+		return "", fmt.Errorf("tailscale not found")
+	}
+	if !tailscale.Up {
+		return "", fmt.Errorf("tailscale is not connected (tailscale up)")
+	}
+	for _, address := range tailscale.Addresses {
+		if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+			return address, nil
+		}
+	}
+	return "", fmt.Errorf("tailscale has no IPv4 address")
+}
+
+// tailnetRanges are the addresses Tailscale hands out
+var tailnetRanges = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("fd7a:115c:a1e0::/48"),
+}
+
+// InTailnet reports whether an address is one Tailscale hands out
+func InTailnet(ip net.IP) bool {
+	for _, ipNet := range tailnetRanges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// defaultRoute returns the interface traffic to the internet leaves through
+func defaultRoute(ctx context.Context, runner utility.CommandRunner) string {
+	// `ip route get` follows policy routing, which full-tunnel WireGuard uses
+	result, err := runner.ExecuteArgs(ctx, "ip", []string{"route", "get", "1.1.1.1"}, &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil || result.ExitCode != 0 {
+		return ""
+	}
+	fields := strings.Fields(result.Stdout)
+	for idx := 0; idx+1 < len(fields); idx++ {
+		if fields[idx] == "dev" {
+			return fields[idx+1]
+		}
+	}
+	return ""
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// VPNWatcher follows whether a VPN is up
+type VPNWatcher struct {
+	logger    *utility.Logger
+	shell     *utility.Shell
+	names     []string // VPNs that count; all if empty
+	callbacks []func(up bool, status VPNStatus)
+	up        bool
+	checked   bool
+	isRunning bool
+	stopChan  chan struct{}
+	ticker    *time.Ticker
+	checkMu   sync.Mutex // held while a check runs
+	mu        sync.Mutex
+}
+
+var (
+	vpnWatcherInstance *VPNWatcher
+	vpnWatcherOnce     sync.Once
+)
+
+// GetVPNWatcher returns the singleton VPNWatcher instance
+func GetVPNWatcher() *VPNWatcher {
+	vpnWatcherOnce.Do(func() {
+		vpnWatcherInstance = &VPNWatcher{
+			logger: utility.GetLogger().With("network"),
+			shell:  utility.NewShell(utility.GetLogger()),
+		}
+	})
+	return vpnWatcherInstance
+}
+
+// SetNames sets which VPNs count (interface names or kinds; all if empty)
+func (vw *VPNWatcher) SetNames(names []string) {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	vw.names = names
+	vw.checked = false
+}
+
+// OnChange registers a callback run when the VPN goes up or down, and
+// with the first check
+func (vw *VPNWatcher) OnChange(callback func(up bool, status VPNStatus)) {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	vw.callbacks = append(vw.callbacks, callback)
+}
+
+// IsUp reports whether a VPN was up at the last check
+func (vw *VPNWatcher) IsUp() bool {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	return vw.up
+}
+
+// IsRunning reports whether the watcher is checking
+func (vw *VPNWatcher) IsRunning() bool {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	return vw.isRunning
+}
+
+// Start checks now, then every 30 seconds
+func (vw *VPNWatcher) Start() {
+	vw.mu.Lock()
+	if vw.isRunning {
+		vw.mu.Unlock()
+		return
+	}
+	vw.isRunning = true
+	vw.stopChan = make(chan struct{})
+	vw.ticker = time.NewTicker(networkCheckInterval)
+	ticker, stop := vw.ticker, vw.stopChan
+	vw.mu.Unlock()
+
+	// The first check runs before Start returns, so syncs started after it
+	// know whether to wait
+	vw.Check(context.Background())
+	go utility.Supervise("vpn-watcher", func() {
+		for {
+			select {
+			case <-ticker.C:
+				vw.Check(context.Background())
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop stops checking
+func (vw *VPNWatcher) Stop() {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+
+	if !vw.isRunning {
+		return
+	}
+	vw.isRunning = false
+	vw.ticker.Stop()
+	close(vw.stopChan)
+}
+
+// Check looks up the VPNs and runs the callbacks if one went up or down
+func (vw *VPNWatcher) Check(ctx context.Context) {
+	vw.checkMu.Lock()
+	defer vw.checkMu.Unlock()
+
+	status, err := DetectVPNs(ctx, vw.shell)
+	if err != nil {
+		vw.logger.Debug("Failed to look up VPNs: %v", err)
+		return
+	}
+
+	vw.mu.Lock()
+	up := len(status.Up(vw.names)) > 0
+	if vw.checked && up == vw.up {
+		vw.mu.Unlock()
+		return
+	}
+	vw.up, vw.checked = up, true
+	callbacks := append([]func(bool, VPNStatus){}, vw.callbacks...)
+	vw.mu.Unlock()
+
+	if up {
+		vw.logger.Info("VPN up: %s", status.Summary())
+	} else {
+		vw.logger.Warn("VPN down")
+	}
+	for _, callback := range callbacks {
+		callback(up, status)
+	}
+}
@@ -0,0 +1,257 @@
+/**
+ * Notion export
+ * The pull direction of Notion sync: renders a page, with the pages and
+ * databases nested in it, or a whole database to Markdown files under a
+ * local directory. Kept under ~/Documents the export is synced to Google
+ * Drive too, so Notion content has a copy outside Notion.
+ */
+
+package notionsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// maxFileNameLength is the longest file name made of a title, in runes
+const maxFileNameLength = 100
+
+// exporter writes Notion pages and databases as Markdown files
+type exporter struct {
+	logger  *utility.Logger
+	client  *utility.Notion
+	files   []string
+	used    map[string]bool // paths written or reserved
+	visited map[string]bool // IDs exported
+}
+
+// Export renders the page or database with the given ID to Markdown under
+// dir and returns the files written. A page becomes dir/<title>.md and the
+// pages and databases in it go to dir/<title>/; a database becomes
+// dir/<title>/ with a file per entry.
+func Export(ctx context.Context, logger *utility.Logger, client *utility.Notion, id, dir string) ([]string, error) {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	dir, err := expandHome(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &exporter{
+		logger:  logger.With("notion-sync"),
+		client:  client,
+		used:    make(map[string]bool),
+		visited: make(map[string]bool),
+	}
+
+	page, pageErr := client.GetPage(ctx, id)
+	if pageErr == nil {
+		_, err = e.exportPage(ctx, *page, dir, nil)
+		return e.files, err
+	}
+	database, err := client.GetDatabase(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s as a page (%v) or a database: %w", id, pageErr, err)
+	}
+	_, err = e.exportDatabase(ctx, id, *database, dir)
+	return e.files, err
+}
+
+// exportPage writes a page to dir/<title>.md, with frontMatter (the
+// properties of a database entry) at its top, and returns the file
+func (e *exporter) exportPage(ctx context.Context, page utility.PageObjectResponse, dir string, frontMatter []string) (string, error) {
+	id := page.ID()
+	e.visited[id] = true
+	title := page.Title()
+	path := e.reserve(dir, title, id, ".md")
+	subdir := strings.TrimSuffix(path, ".md")
+
+	blocks, err := e.client.GetBlockTree(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to read page %q: %w", title, err)
+	}
+
+	// Nested pages and databases are exported next to the page, so it can link to them
+	links := make(map[string]string)
+	if err := e.exportNested(ctx, blocks, subdir, links); err != nil {
+		return "", err
+	}
+	markdown := utility.BlocksToMarkdown(blocks, func(block utility.Block) string {
+		return links[block.ID]
+	})
+
+	var content strings.Builder
+	if len(frontMatter) > 0 {
+		content.WriteString("---\n" + strings.Join(frontMatter, "\n") + "\n---\n\n")
+	}
+	if title != "" {
+		content.WriteString("# " + title + "\n")
+		if markdown != "" {
+			content.WriteString("\n")
+		}
+	}
+	content.WriteString(markdown)
+
+	if err := e.write(path, content.String()); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// exportNested exports the child pages and databases among blocks (and
+// their nested blocks) to dir, recording the relative link to each
+func (e *exporter) exportNested(ctx context.Context, blocks []utility.Block, dir string, links map[string]string) error {
+	for _, block := range blocks {
+		id := block.ID
+		switch block.Type {
+		case "child_page":
+			if e.visited[id] {
+				continue
+			}
+			page, err := e.client.GetPage(ctx, id)
+			if err != nil {
+				return err
+			}
+			path, err := e.exportPage(ctx, *page, dir, nil)
+			if err != nil {
+				return err
+			}
+			links[id] = relativeLink(filepath.Dir(dir), path)
+		case "child_database":
+			if e.visited[id] {
+				continue
+			}
+			database, err := e.client.GetDatabase(ctx, id)
+			if err != nil {
+				return err
+			}
+			path, err := e.exportDatabase(ctx, id, *database, dir)
+			if err != nil {
+				return err
+			}
+			links[id] = relativeLink(filepath.Dir(dir), path) + "/"
+		default:
+			if err := e.exportNested(ctx, block.Children, dir, links); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportDatabase writes each entry of a database to dir/<title>/ and
+// returns that directory
+func (e *exporter) exportDatabase(ctx context.Context, id string, database utility.PageObjectResponse, dir string) (string, error) {
+	e.visited[id] = true
+	title := database.Title()
+	path := e.reserve(dir, title, id, "")
+
+	response, err := e.client.QueryDatabase(ctx, id, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to query database %q: %w", title, err)
+	}
+	if len(response.Results) == 0 {
+		if _, err := utility.EnsureDir(path); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", path, err)
+		}
+	}
+	for _, entry := range response.Results {
+		page := utility.PageObjectResponse(entry)
+		if _, err := e.exportPage(ctx, page, path, frontMatter(page)); err != nil {
+			return "", err
+		}
+	}
+
+	e.logger.Info("Exported %d entries of database %q", len(response.Results), title)
+	return path, nil
+}
+
+// frontMatter renders the properties of a database entry other than its
+// title as YAML lines, in name order
+func frontMatter(page utility.PageObjectResponse) []string {
+	var lines []string
+	for name, propertyType := range page.PropertyTypes() {
+		if propertyType == "title" {
+			continue
+		}
+		if text := page.PropertyText(name); text != "" {
+			lines = append(lines, strconv.Quote(name)+": "+strconv.Quote(text))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// reserve returns an unused path for a title in dir, telling apart
+// entries with the same title by the start of their ID
+func (e *exporter) reserve(dir, title, id, ext string) string {
+	name := fileName(title)
+	path := filepath.Join(dir, name+ext)
+	if e.used[path] {
+		path = filepath.Join(dir, fmt.Sprintf("%s (%s)%s", name, strings.ReplaceAll(id, "-", "")[:min(8, len(id))], ext))
+	}
+	e.used[path] = true
+	return path
+}
+
+// write writes an exported file, creating its directory
+func (e *exporter) write(path, content string) error {
+	if _, err := utility.EnsureDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	e.files = append(e.files, path)
+	e.logger.Debug("Exported %s", path)
+	return nil
+}
+
+// fileName turns a title into a file name, replacing path separators and
+// control characters
+func fileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return '-'
+		}
+		return r
+	}, title)
+	name = strings.Trim(name, " .")
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = strings.TrimSpace(string(runes[:maxFileNameLength]))
+	}
+	if name == "" {
+		return "Untitled"
+	}
+	return name
+}
+
+// relativeLink returns a Markdown link target to path from a file in dir
+func relativeLink(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), " ", "%20")
+}
+
+// expandHome expands a leading ~ to the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
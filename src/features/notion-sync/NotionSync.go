@@ -0,0 +1,488 @@
+/**
+ * Notion sync
+ * Copies local notes to Notion on a schedule. Each configured path syncs to
+ * the Notion page at the same position in notion.page_ids: a file becomes
+ * the content of that page, a directory gets a page under it for every
+ * Markdown or text file it holds. Files are synced again once they change;
+ * what was synced when is kept in the state directory for
+ * `daemira notion status`. A vault (see Vault.go) is synced along with them.
+ */
+
+package notionsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// DefaultInterval is the time between syncs unless configured otherwise
+const DefaultInterval = 15 * time.Minute
+
+// syncableExtensions are the files synced from a directory
+var syncableExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+}
+
+// Target is a local file or directory and the Notion page it syncs to
+type Target struct {
+	Path   string `json:"path"`
+	PageID string `json:"pageId"`
+}
+
+// ParseTargets pairs the configured paths with the page IDs at the same
+// position, expanding a leading ~
+func ParseTargets(paths, pageIDs []string) ([]Target, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if len(paths) != len(pageIDs) {
+		return nil, fmt.Errorf("notion.sync_paths has %d entries but notion.page_ids has %d; each path needs a page", len(paths), len(pageIDs))
+	}
+
+	targets := make([]Target, len(paths))
+	for idx, path := range paths {
+		path, err := expandHome(path)
+		if err != nil {
+			return nil, err
+		}
+		targets[idx] = Target{Path: filepath.Clean(path), PageID: pageIDs[idx]}
+	}
+	return targets, nil
+}
+
+// FileState is what was last synced of a file
+type FileState struct {
+	PageID  string    `json:"pageId"`
+	ModTime time.Time `json:"modTime"`
+	Synced  time.Time `json:"synced"`
+}
+
+// TargetStatus is the outcome of the last sync of a target
+type TargetStatus struct {
+	Target
+	LastSync  time.Time `json:"lastSync"`
+	LastError string    `json:"lastError,omitempty"`
+	Files     int       `json:"files"`   // files synced to the target's pages
+	Updated   int       `json:"updated"` // files that had changed in the last sync
+}
+
+// State is the saved progress of Notion sync
+type State struct {
+	LastRun time.Time                `json:"lastRun"`
+	Targets map[string]*TargetStatus `json:"targets"` // by path
+	Files   map[string]*FileState    `json:"files"`   // by path
+}
+
+// StatePath returns the file Notion sync keeps its state in
+func StatePath() string {
+	return filepath.Join(utility.StateDir(), "notion-sync.json")
+}
+
+// LoadState reads the saved state; a missing file is an empty state
+func LoadState() (*State, error) {
+	state := &State{
+		Targets: make(map[string]*TargetStatus),
+		Files:   make(map[string]*FileState),
+	}
+	data, err := os.ReadFile(StatePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read Notion sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse Notion sync state: %w", err)
+	}
+	if state.Targets == nil {
+		state.Targets = make(map[string]*TargetStatus)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]*FileState)
+	}
+	return state, nil
+}
+
+// save writes the state
+func (s *State) save() error {
+	if _, err := utility.EnsureDir(utility.StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode Notion sync state: %w", err)
+	}
+	if err := os.WriteFile(StatePath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write Notion sync state: %w", err)
+	}
+	return nil
+}
+
+// NotionSyncOptions configures Notion sync
+type NotionSyncOptions struct {
+	Interval time.Duration // Default: 15 minutes
+	Vault    *Vault        // synced both ways on each run, if set
+}
+
+// NotionSync syncs local files to Notion pages periodically
+type NotionSync struct {
+	logger    *utility.Logger
+	client    *utility.Notion
+	targets   []Target
+	vault     *Vault
+	interval  time.Duration
+	isRunning bool
+	paused    string     // why scheduled syncs are held, "" when they run
+	missed    bool       // a scheduled sync was skipped while paused
+	syncMu    sync.Mutex // held while a sync runs
+	mu        sync.Mutex
+}
+
+// notionSyncJob is the scheduler job running periodic syncs
+const notionSyncJob = "notion-sync"
+
+// NewNotionSync creates a NotionSync syncing targets with client
+func NewNotionSync(logger *utility.Logger, client *utility.Notion, targets []Target, options *NotionSyncOptions) *NotionSync {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	interval := DefaultInterval
+	var vault *Vault
+	if options != nil {
+		if options.Interval > 0 {
+			interval = options.Interval
+		}
+		vault = options.Vault
+	}
+
+	return &NotionSync{
+		logger:   logger.With("notion-sync"),
+		client:   client,
+		targets:  targets,
+		vault:    vault,
+		interval: interval,
+	}
+}
+
+// Targets returns the paths synced and their pages
+func (ns *NotionSync) Targets() []Target {
+	return ns.targets
+}
+
+// Vault returns the vault synced both ways, or nil
+func (ns *NotionSync) Vault() *Vault {
+	return ns.vault
+}
+
+// Start syncs now and then every interval
+func (ns *NotionSync) Start() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.isRunning {
+		ns.logger.Warn("Notion sync already running")
+		return
+	}
+
+	ns.isRunning = true
+	ns.logger.Info("Starting Notion sync of %d path(s) (interval: %v)", len(ns.targets), ns.interval)
+	if ns.vault != nil {
+		ns.logger.Info("Syncing vault %s both ways", ns.vault.Dir())
+	}
+
+	utility.GetScheduler().Add(utility.Job{
+		ID:          notionSyncJob,
+		Description: "Sync notes with Notion",
+		Schedule:    utility.Every(ns.interval),
+		Jitter:      ns.interval / 10,
+		RunAtStart:  true,
+		Run:         ns.syncScheduled,
+	})
+}
+
+// Stop halts the periodic syncs
+func (ns *NotionSync) Stop() {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if !ns.isRunning {
+		return
+	}
+
+	ns.isRunning = false
+	utility.GetScheduler().Remove(notionSyncJob)
+	ns.logger.Info("Notion sync stopped")
+}
+
+// Shutdown halts the periodic syncs and waits, until ctx is done, for a
+// sync in progress to finish
+func (ns *NotionSync) Shutdown(ctx context.Context) error {
+	ns.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		ns.syncMu.Lock()
+		ns.syncMu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notion sync still running: %w", ctx.Err())
+	}
+}
+
+// SetInterval changes the sync interval of a running scheduler
+func (ns *NotionSync) SetInterval(interval time.Duration) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if interval <= 0 || interval == ns.interval {
+		return
+	}
+
+	ns.interval = interval
+	if ns.isRunning {
+		utility.GetScheduler().Reschedule(notionSyncJob, utility.Every(interval))
+	}
+	ns.logger.Info("Notion sync interval changed to %v", interval)
+}
+
+// Pause holds scheduled syncs until Resume
+func (ns *NotionSync) Pause(reason string) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.paused == reason {
+		return
+	}
+	ns.paused = reason
+	ns.logger.Info("Notion sync paused: %s", reason)
+}
+
+// Resume lifts Pause, syncing now if a scheduled sync was skipped
+func (ns *NotionSync) Resume() {
+	ns.mu.Lock()
+	if ns.paused == "" {
+		ns.mu.Unlock()
+		return
+	}
+	ns.paused = ""
+	missed, running := ns.missed, ns.isRunning
+	ns.missed = false
+	ns.mu.Unlock()
+
+	ns.logger.Info("Notion sync resumed")
+	if missed && running {
+		if _, err := utility.GetScheduler().RunNow(notionSyncJob); err != nil {
+			ns.logger.Debug("Failed to run the skipped Notion sync: %v", err)
+		}
+	}
+}
+
+// Paused returns why scheduled syncs are held, "" when they run
+func (ns *NotionSync) Paused() string {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.paused
+}
+
+// syncScheduled runs a scheduled sync unless paused or do-not-disturb is on
+func (ns *NotionSync) syncScheduled(ctx context.Context) error {
+	ns.mu.Lock()
+	paused := ns.paused
+	ns.missed = ns.missed || paused != ""
+	ns.mu.Unlock()
+	if paused != "" {
+		ns.logger.Debug("Skipping Notion sync while paused: %s", paused)
+		return nil
+	}
+	if utility.GetDoNotDisturb().IsActive() {
+		ns.logger.Debug("Skipping Notion sync while do not disturb is on")
+		return nil
+	}
+	return ns.SyncAll(ctx)
+}
+
+// SyncAll syncs every target, continuing past failures, and returns the
+// first error
+func (ns *NotionSync) SyncAll(ctx context.Context) error {
+	ns.syncMu.Lock()
+	defer ns.syncMu.Unlock()
+
+	state, err := LoadState()
+	if err != nil {
+		ns.logger.Warn("Starting from an empty Notion sync state: %v", err)
+		state = &State{
+			Targets: make(map[string]*TargetStatus),
+			Files:   make(map[string]*FileState),
+		}
+	}
+
+	var firstErr error
+	for _, target := range ns.targets {
+		status := &TargetStatus{Target: target, LastSync: time.Now()}
+		files, updated, err := ns.syncTarget(ctx, state, target)
+		status.Files, status.Updated = files, updated
+		if err != nil {
+			status.LastError = err.Error()
+			ns.logger.WithFields(utility.Fields{"path": target.Path}).Error("Failed to sync %s to Notion: %v", target.Path, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", target.Path, err)
+			}
+		} else if updated > 0 {
+			ns.logger.Info("Synced %d changed file(s) of %s to Notion", updated, target.Path)
+		}
+		state.Targets[target.Path] = status
+	}
+
+	state.LastRun = time.Now()
+	if err := state.save(); err != nil {
+		return err
+	}
+
+	if ns.vault != nil {
+		if err := ns.vault.Sync(ctx); err != nil {
+			ns.logger.Error("Failed to sync vault %s with Notion: %v", ns.vault.Dir(), err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", ns.vault.Dir(), err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// syncTarget syncs the changed files of a target and returns how many
+// files it has and how many were updated
+func (ns *NotionSync) syncTarget(ctx context.Context, state *State, target Target) (int, int, error) {
+	info, err := os.Stat(target.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// A file is the content of the target's page
+	if !info.IsDir() {
+		updated, err := ns.syncFile(ctx, state, target.Path, target.PageID, "")
+		if err != nil {
+			return 1, 0, err
+		}
+		return 1, boolToInt(updated), nil
+	}
+
+	// A directory has a page per file under the target's page
+	files, err := syncableFiles(target.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	updated := 0
+	var firstErr error
+	for _, path := range files {
+		title, _ := filepath.Rel(target.Path, path)
+		changed, err := ns.syncFile(ctx, state, path, "", title)
+		if err != nil {
+			ns.logger.Warn("Failed to sync %s: %v", path, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", title, err)
+			}
+			continue
+		}
+		if changed {
+			updated++
+		}
+	}
+	return len(files), updated, firstErr
+}
+
+// syncFile uploads a file if it changed since its last sync, to pageID or,
+// without one, to a page titled title under the target's page (created on
+// its first sync). It reports whether the file was uploaded.
+func (ns *NotionSync) syncFile(ctx context.Context, state *State, path, pageID, title string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	previous := state.Files[path]
+	if previous != nil && previous.ModTime.Equal(info.ModTime()) && (pageID == "" || previous.PageID == pageID) {
+		return false, nil
+	}
+
+	if pageID == "" {
+		if previous != nil && previous.PageID != "" {
+			pageID = previous.PageID
+		} else {
+			parent := ns.parentPage(path)
+			if pageID, err = ns.client.CreateChildPage(ctx, parent, title); err != nil {
+				return false, fmt.Errorf("failed to create page: %w", err)
+			}
+		}
+	}
+
+	if err := ns.client.SyncFileToPage(ctx, pageID, path, &utility.SyncFileToPageOptions{Overwrite: true}); err != nil {
+		// Keep the page, so the next attempt doesn't create another one
+		state.Files[path] = &FileState{PageID: pageID}
+		return false, err
+	}
+
+	state.Files[path] = &FileState{PageID: pageID, ModTime: info.ModTime(), Synced: time.Now()}
+	return true, nil
+}
+
+// parentPage returns the page of the directory target holding path
+func (ns *NotionSync) parentPage(path string) string {
+	for _, target := range ns.targets {
+		if strings.HasPrefix(path, target.Path+string(filepath.Separator)) {
+			return target.PageID
+		}
+	}
+	return ""
+}
+
+// syncableFiles lists the Markdown and text files under dir, skipping
+// hidden files and directories
+func syncableFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() && syncableExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// boolToInt returns 1 for true
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+/**
+ * Notion reporter
+ * Appends a row to a Notion database after each system update and once a
+ * day with a health summary, keeping a journal of the machine in Notion.
+ * Rows fill in whichever of the columns Type (select), Date (date), Status
+ * (select) and Duration (number, seconds) the database has, besides its
+ * title; the details go in the row's page. Reports made while Notion
+ * can't be reached are queued and sent once it can.
+ */
+
+package notionsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Kinds of report
+const (
+	ReportUpdate = "Update"
+	ReportHealth = "Health"
+)
+
+// healthReportInterval is the time between health summaries
+const healthReportInterval = 24 * time.Hour
+
+// reportCheckInterval is how often the reporter checks whether a health
+// summary is due; summaries missed while the machine was off are sent soon
+// after it is back
+const reportCheckInterval = time.Hour
+
+// notionReportJob is the scheduler job sending health summaries
+const notionReportJob = "notion-report"
+
+// Report is a row for the Notion database
+type Report struct {
+	Kind     string // ReportUpdate or ReportHealth
+	Title    string
+	Time     time.Time
+	Status   string // e.g. OK, Warning or Failed
+	Duration time.Duration
+	Body     string // Markdown for the row's page
+}
+
+// reporterState is what the reporter remembers across restarts
+type reporterState struct {
+	LastHealthReport time.Time         `json:"lastHealthReport"`
+	DatabaseID       string            `json:"databaseId,omitempty"` // database the columns were read from
+	Title            string            `json:"title,omitempty"`      // its title property
+	Columns          map[string]string `json:"columns,omitempty"`    // its property types, for reports made offline
+}
+
+// reporterStatePath returns the file the reporter keeps its state in
+func reporterStatePath() string {
+	return filepath.Join(utility.StateDir(), "notion-reports.json")
+}
+
+// Reporter appends reports to a Notion database
+type Reporter struct {
+	logger     *utility.Logger
+	client     *utility.Notion
+	databaseID string
+	summary    func(ctx context.Context) Report
+	columns    map[string]string // property types by name, read once
+	title      string            // name of the title property
+	isRunning  bool
+	sendMu     sync.Mutex // held while a report is sent
+	mu         sync.Mutex
+}
+
+// NewReporter creates a Reporter adding rows to a database; summary builds
+// the daily health summary
+func NewReporter(logger *utility.Logger, client *utility.Notion, databaseID string, summary func(ctx context.Context) Report) *Reporter {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	return &Reporter{
+		logger:     logger.With("notion-sync"),
+		client:     client.Queued(),
+		databaseID: databaseID,
+		summary:    summary,
+	}
+}
+
+// Start sends a health summary whenever a day has passed since the last one
+func (r *Reporter) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isRunning {
+		return
+	}
+
+	r.isRunning = true
+	r.logger.Info("Reporting to Notion database %s", r.databaseID)
+
+	utility.GetScheduler().Add(utility.Job{
+		ID:          notionReportJob,
+		Description: "Send the daily health summary to Notion",
+		Schedule:    utility.Every(reportCheckInterval),
+		RunAtStart:  true,
+		Run:         r.reportHealthIfDue,
+	})
+}
+
+// Stop halts the daily health summaries
+func (r *Reporter) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isRunning {
+		return
+	}
+
+	r.isRunning = false
+	utility.GetScheduler().Remove(notionReportJob)
+}
+
+// reportHealthIfDue sends a health summary if the last one is a day old
+func (r *Reporter) reportHealthIfDue(ctx context.Context) error {
+	state := r.loadState()
+	if time.Since(state.LastHealthReport) < healthReportInterval {
+		return nil
+	}
+	if err := r.ReportHealth(ctx); err != nil {
+		return fmt.Errorf("failed to send health report to Notion: %w", err)
+	}
+	return nil
+}
+
+// ReportHealth sends a health summary now
+func (r *Reporter) ReportHealth(ctx context.Context) error {
+	if err := r.Send(ctx, r.summary(ctx)); err != nil {
+		return err
+	}
+
+	state := r.loadState()
+	state.LastHealthReport = time.Now()
+	r.saveState(state)
+	return nil
+}
+
+// Send appends a report to the database
+func (r *Reporter) Send(ctx context.Context, report Report) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	if err := r.readColumns(ctx); err != nil {
+		return err
+	}
+	if report.Time.IsZero() {
+		report.Time = time.Now()
+	}
+
+	blocks := utility.MarkdownToBlocks(report.Body)
+	content := blocks[:min(len(blocks), 100)]
+	page, err := r.client.CreatePage(ctx, utility.CreatePageParams{
+		DatabaseID: r.databaseID,
+		Properties: r.properties(report),
+		Content:    content,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add report: %w", err)
+	}
+
+	// A page is created with at most 100 blocks; the rest are appended
+	if len(blocks) > len(content) {
+		if err := r.client.AppendBlocks(ctx, page.ID(), blocks[len(content):]); err != nil {
+			return fmt.Errorf("failed to add report details: %w", err)
+		}
+	}
+
+	if utility.IsQueuedID(page.ID()) {
+		r.logger.Info("Queued %s report for Notion: %s", report.Kind, report.Title)
+		return nil
+	}
+	r.logger.Info("Sent %s report to Notion: %s", report.Kind, report.Title)
+	return nil
+}
+
+// readColumns reads the database's properties the first time a report is
+// sent, falling back to those last read if Notion can't be reached
+func (r *Reporter) readColumns(ctx context.Context) error {
+	if r.columns != nil {
+		return nil
+	}
+
+	state := r.loadState()
+	database, err := r.client.GetDatabase(ctx, r.databaseID)
+	if err != nil {
+		if state.DatabaseID != r.databaseID || state.Title == "" {
+			return fmt.Errorf("failed to read report database: %w", err)
+		}
+		r.logger.Debug("Using the report database columns last read: %v", err)
+		r.title, r.columns = state.Title, state.Columns
+		return nil
+	}
+
+	r.title = database.TitleProperty()
+	if r.title == "" {
+		return fmt.Errorf("report database %s has no title property", r.databaseID)
+	}
+	r.columns = database.PropertyTypes()
+
+	state.DatabaseID, state.Title, state.Columns = r.databaseID, r.title, r.columns
+	r.saveState(state)
+	return nil
+}
+
+// properties returns the row's values for the columns the database has
+func (r *Reporter) properties(report Report) utility.Properties {
+	properties := utility.Properties{
+		r.title: utility.TitleValue(report.Title),
+	}
+
+	if r.columns["Type"] == "select" && report.Kind != "" {
+		properties["Type"] = utility.SelectValue(report.Kind)
+	}
+	if r.columns["Status"] == "select" && report.Status != "" {
+		properties["Status"] = utility.SelectValue(report.Status)
+	}
+	if r.columns["Date"] == "date" {
+		properties["Date"] = utility.DateValue(report.Time)
+	}
+	if r.columns["Duration"] == "number" && report.Duration > 0 {
+		properties["Duration"] = utility.NumberValue(report.Duration.Round(time.Second).Seconds())
+	}
+	return properties
+}
+
+// loadState reads the reporter's state; a missing or broken file is empty
+func (r *Reporter) loadState() reporterState {
+	var state reporterState
+	if data, err := os.ReadFile(reporterStatePath()); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// saveState writes the reporter's state
+func (r *Reporter) saveState(state reporterState) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		if _, err = utility.EnsureDir(utility.StateDir()); err == nil {
+			err = os.WriteFile(reporterStatePath(), data, 0644)
+		}
+	}
+	if err != nil {
+		r.logger.Warn("Failed to save Notion report state: %v", err)
+	}
+}
@@ -0,0 +1,570 @@
+/**
+ * Notion vault sync
+ * Two-way sync between a folder of Markdown notes (e.g. an Obsidian vault)
+ * and a Notion database: each note is an entry titled by its path in the
+ * vault, without the extension. Edits on either side are carried over to
+ * the other, as are new notes and deletions. A note changed on both sides
+ * since the last sync is a conflict: it is left alone and shown by
+ * `daemira notion status` until `daemira notion resolve` picks a side.
+ */
+
+package notionsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Sides of a conflict to keep
+const (
+	KeepLocal  = "local"
+	KeepNotion = "notion"
+)
+
+// VaultEntry is what was last synced of a note
+type VaultEntry struct {
+	PageID       string    `json:"pageId"`
+	Hash         string    `json:"hash"`         // of the note's content
+	ModTime      time.Time `json:"modTime"`      // of the note's file
+	RemoteEdited time.Time `json:"remoteEdited"` // last_edited_time of the page
+}
+
+// Conflict is a note that changed on both sides since its last sync
+type Conflict struct {
+	Path         string    `json:"path"` // in the vault
+	PageID       string    `json:"pageId"`
+	Reason       string    `json:"reason"`
+	LocalModTime time.Time `json:"localModTime,omitempty"`
+	RemoteEdited time.Time `json:"remoteEdited,omitempty"`
+}
+
+// VaultState is the saved progress of vault sync
+type VaultState struct {
+	Dir        string                 `json:"dir"`
+	DatabaseID string                 `json:"databaseId"`
+	LastRun    time.Time              `json:"lastRun"`
+	LastError  string                 `json:"lastError,omitempty"`
+	Pushed     int                    `json:"pushed"`    // notes sent to Notion in the last run
+	Pulled     int                    `json:"pulled"`    // notes written from Notion in the last run
+	Entries    map[string]*VaultEntry `json:"entries"`   // by path in the vault
+	Conflicts  map[string]*Conflict   `json:"conflicts"` // by path in the vault
+}
+
+// VaultStatePath returns the file vault sync keeps its state in
+func VaultStatePath() string {
+	return filepath.Join(utility.StateDir(), "notion-vault.json")
+}
+
+// LoadVaultState reads the saved state; a missing file is an empty state
+func LoadVaultState() (*VaultState, error) {
+	state := &VaultState{}
+	data, err := os.ReadFile(VaultStatePath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read Notion vault state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse Notion vault state: %w", err)
+		}
+	}
+	if state.Entries == nil {
+		state.Entries = make(map[string]*VaultEntry)
+	}
+	if state.Conflicts == nil {
+		state.Conflicts = make(map[string]*Conflict)
+	}
+	return state, nil
+}
+
+// save writes the state
+func (s *VaultState) save() error {
+	if _, err := utility.EnsureDir(utility.StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode Notion vault state: %w", err)
+	}
+	if err := os.WriteFile(VaultStatePath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write Notion vault state: %w", err)
+	}
+	return nil
+}
+
+// remotePage is an entry of the vault's database
+type remotePage struct {
+	ID     string
+	Path   string // in the vault, from the title
+	Edited time.Time
+}
+
+// Vault syncs a folder of Markdown notes with a Notion database both ways
+type Vault struct {
+	logger     *utility.Logger
+	client     *utility.Notion
+	dir        string
+	databaseID string
+	title      string // name of the database's title property
+}
+
+// NewVault creates a Vault syncing the notes in dir with a database
+func NewVault(logger *utility.Logger, client *utility.Notion, dir, databaseID string) (*Vault, error) {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	dir, err := expandHome(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Vault{
+		logger:     logger.With("notion-sync"),
+		client:     client,
+		dir:        filepath.Clean(dir),
+		databaseID: databaseID,
+	}, nil
+}
+
+// Dir returns the vault's folder
+func (v *Vault) Dir() string {
+	return v.dir
+}
+
+// loadState reads the state, starting over if it belongs to another vault
+// or database
+func (v *Vault) loadState() (*VaultState, error) {
+	state, err := LoadVaultState()
+	if err != nil {
+		return nil, err
+	}
+	if state.Dir != v.dir || state.DatabaseID != v.databaseID {
+		state = &VaultState{
+			Entries:   make(map[string]*VaultEntry),
+			Conflicts: make(map[string]*Conflict),
+		}
+	}
+	state.Dir, state.DatabaseID = v.dir, v.databaseID
+	return state, nil
+}
+
+// Sync carries the changes on each side since the last sync over to the
+// other and records the notes that changed on both
+func (v *Vault) Sync(ctx context.Context) error {
+	state, err := v.loadState()
+	if err != nil {
+		return err
+	}
+
+	state.Pushed, state.Pulled = 0, 0
+	err = v.sync(ctx, state)
+	state.LastRun = time.Now()
+	state.LastError = ""
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	if saveErr := state.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+
+	if len(state.Conflicts) > 0 {
+		v.logger.Warn("%d note(s) of %s changed both locally and in Notion; see daemira notion status", len(state.Conflicts), v.dir)
+	}
+	if state.Pushed > 0 || state.Pulled > 0 {
+		v.logger.Info("Synced vault %s: %d note(s) sent to Notion, %d updated from Notion", v.dir, state.Pushed, state.Pulled)
+	}
+	return err
+}
+
+// sync runs a sync on state, continuing past failed notes
+func (v *Vault) sync(ctx context.Context, state *VaultState) error {
+	if err := v.readTitle(ctx); err != nil {
+		return err
+	}
+	pages, err := v.remotePages(ctx)
+	if err != nil {
+		return err
+	}
+	files, err := v.localNotes()
+	if err != nil {
+		return err
+	}
+
+	// Conflicts are found afresh each run; one stays until a side is picked
+	state.Conflicts = make(map[string]*Conflict)
+	var firstErr error
+	fail := func(path string, err error) {
+		v.logger.Warn("Failed to sync note %s: %v", path, err)
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	paths := make([]string, 0, len(state.Entries))
+	for path := range state.Entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := state.Entries[path]
+		page, remoteExists := pages[entry.PageID]
+		delete(pages, entry.PageID)
+		modTime, localExists := files[path]
+		delete(files, path)
+
+		localChanged := false
+		if localExists {
+			if localChanged, err = v.localChanged(path, modTime, entry); err != nil {
+				fail(path, err)
+				continue
+			}
+		}
+		remoteChanged := remoteExists && page.Edited.After(entry.RemoteEdited)
+
+		switch {
+		case !localExists && !remoteExists:
+			delete(state.Entries, path)
+		case !localExists && remoteChanged:
+			state.Conflicts[path] = &Conflict{Path: path, PageID: entry.PageID, Reason: "deleted locally, edited in Notion", RemoteEdited: page.Edited}
+		case !localExists:
+			// The content is in the Notion trash should the deletion be a mistake
+			if err := v.client.ArchivePage(ctx, entry.PageID); err != nil {
+				fail(path, err)
+				continue
+			}
+			delete(state.Entries, path)
+		case !remoteExists && localChanged:
+			state.Conflicts[path] = &Conflict{Path: path, PageID: entry.PageID, Reason: "deleted in Notion, edited locally", LocalModTime: modTime}
+		case !remoteExists:
+			// Unchanged since the last sync, so the page in the Notion trash holds it
+			if err := os.Remove(filepath.Join(v.dir, path)); err != nil {
+				fail(path, err)
+				continue
+			}
+			v.logger.Info("Removed %s, deleted in Notion", path)
+			delete(state.Entries, path)
+		case localChanged && remoteChanged:
+			state.Conflicts[path] = &Conflict{Path: path, PageID: entry.PageID, Reason: "edited locally and in Notion", LocalModTime: modTime, RemoteEdited: page.Edited}
+		case localChanged:
+			if err := v.push(ctx, state, path, entry.PageID); err != nil {
+				fail(path, err)
+			}
+		case remoteChanged:
+			if err := v.pull(ctx, state, path, entry.PageID); err != nil {
+				fail(path, err)
+			}
+		}
+	}
+
+	// Pages new in Notion are pulled, unless a note new locally has their path
+	remoteIDs := make([]string, 0, len(pages))
+	for id := range pages {
+		remoteIDs = append(remoteIDs, id)
+	}
+	sort.Strings(remoteIDs)
+	for _, id := range remoteIDs {
+		page := pages[id]
+		if _, ok := files[page.Path]; ok {
+			delete(files, page.Path)
+			if err := v.link(ctx, state, page); err != nil {
+				fail(page.Path, err)
+			}
+			continue
+		}
+		if _, ok := state.Entries[page.Path]; ok {
+			fail(page.Path, fmt.Errorf("another page (%s) has the same title", id))
+			continue
+		}
+		if err := v.pull(ctx, state, page.Path, id); err != nil {
+			fail(page.Path, err)
+		}
+	}
+
+	// Notes new locally get a page
+	newPaths := make([]string, 0, len(files))
+	for path := range files {
+		newPaths = append(newPaths, path)
+	}
+	sort.Strings(newPaths)
+	for _, path := range newPaths {
+		if err := v.push(ctx, state, path, ""); err != nil {
+			fail(path, err)
+		}
+	}
+
+	return firstErr
+}
+
+// link pairs a new page with the new note at its path; they are in sync if
+// the note has what would be pulled, otherwise it is a conflict
+func (v *Vault) link(ctx context.Context, state *VaultState, page remotePage) error {
+	markdown, err := v.render(ctx, page.ID)
+	if err != nil {
+		return err
+	}
+	content, info, err := v.readNote(page.Path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) != strings.TrimSpace(markdown) {
+		state.Conflicts[page.Path] = &Conflict{Path: page.Path, PageID: page.ID, Reason: "created locally and in Notion", LocalModTime: info.ModTime(), RemoteEdited: page.Edited}
+		return nil
+	}
+	state.Entries[page.Path] = &VaultEntry{PageID: page.ID, Hash: noteHash(content), ModTime: info.ModTime(), RemoteEdited: page.Edited}
+	return nil
+}
+
+// Resolve settles the conflict of a note by keeping the local side (which
+// is sent to Notion, or whose deletion is) or the Notion side
+func (v *Vault) Resolve(ctx context.Context, path, keep string) error {
+	state, err := v.loadState()
+	if err != nil {
+		return err
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if rel, err := filepath.Rel(v.dir, path); err == nil && filepath.IsAbs(path) {
+		path = filepath.ToSlash(rel)
+	}
+	conflict := state.Conflicts[path]
+	if conflict == nil {
+		return fmt.Errorf("%s has no conflict", path)
+	}
+	if err := v.readTitle(ctx); err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(filepath.Join(v.dir, path))
+	localExists := statErr == nil
+	page, pageErr := v.client.GetPage(ctx, conflict.PageID)
+	remoteExists := pageErr == nil && !page.Archived()
+	switch keep {
+	case KeepLocal:
+		switch {
+		case localExists && remoteExists:
+			err = v.push(ctx, state, path, conflict.PageID)
+		case localExists:
+			err = v.push(ctx, state, path, "")
+		case remoteExists:
+			if err = v.client.ArchivePage(ctx, conflict.PageID); err == nil {
+				delete(state.Entries, path)
+			}
+		}
+	case KeepNotion:
+		switch {
+		case remoteExists:
+			err = v.pull(ctx, state, path, conflict.PageID)
+		case localExists:
+			if err = os.Remove(filepath.Join(v.dir, path)); err == nil {
+				delete(state.Entries, path)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown side %q (use %s or %s)", keep, KeepLocal, KeepNotion)
+	}
+	if err != nil {
+		return err
+	}
+
+	delete(state.Conflicts, path)
+	return state.save()
+}
+
+// push sends a note to its page, creating the page without a pageID
+func (v *Vault) push(ctx context.Context, state *VaultState, path, pageID string) error {
+	content, info, err := v.readNote(path)
+	if err != nil {
+		return err
+	}
+
+	// Files the note refers to are found next to it or at the vault's root
+	file := filepath.Join(v.dir, path)
+	blocks := v.client.ResolveAttachments(ctx, utility.MarkdownToBlocks(string(content)), filepath.Dir(file), v.dir)
+	if pageID == "" {
+		title := strings.TrimSuffix(path, filepath.Ext(path))
+		page, err := v.client.CreatePage(ctx, utility.CreatePageParams{
+			DatabaseID: v.databaseID,
+			Properties: utility.Properties{
+				v.title: utility.TitleValue(title),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create page: %w", err)
+		}
+		pageID = page.ID()
+	} else if err := v.client.ClearPage(ctx, pageID); err != nil {
+		return err
+	}
+	if err := v.client.AppendBlocks(ctx, pageID, blocks); err != nil {
+		return err
+	}
+
+	// Record the page as edited by this push, so it isn't pulled back.
+	// Notion keeps edit times to the minute, so an edit in Notion in the
+	// same minute as a push goes unnoticed.
+	page, err := v.client.GetPage(ctx, pageID)
+	if err != nil {
+		return err
+	}
+	state.Entries[path] = &VaultEntry{PageID: pageID, Hash: noteHash(content), ModTime: info.ModTime(), RemoteEdited: page.LastEditedTime()}
+	state.Pushed++
+	v.logger.Debug("Sent %s to Notion", path)
+	return nil
+}
+
+// pull writes a page to its note
+func (v *Vault) pull(ctx context.Context, state *VaultState, path, pageID string) error {
+	page, err := v.client.GetPage(ctx, pageID)
+	if err != nil {
+		return err
+	}
+	markdown, err := v.render(ctx, pageID)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(v.dir, path)
+	if _, err := utility.EnsureDir(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	if err := os.WriteFile(file, []byte(markdown), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	state.Entries[path] = &VaultEntry{PageID: pageID, Hash: noteHash([]byte(markdown)), ModTime: info.ModTime(), RemoteEdited: page.LastEditedTime()}
+	state.Pulled++
+	v.logger.Debug("Updated %s from Notion", path)
+	return nil
+}
+
+// render returns the Markdown of a page; pages nested in it link to Notion
+func (v *Vault) render(ctx context.Context, pageID string) (string, error) {
+	blocks, err := v.client.GetBlockTree(ctx, pageID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read page: %w", err)
+	}
+	return utility.BlocksToMarkdown(blocks, func(block utility.Block) string {
+		return "https://www.notion.so/" + strings.ReplaceAll(block.ID, "-", "")
+	}), nil
+}
+
+// readTitle finds the database's title property the first time it is needed
+func (v *Vault) readTitle(ctx context.Context) error {
+	if v.title != "" {
+		return nil
+	}
+	database, err := v.client.GetDatabase(ctx, v.databaseID)
+	if err != nil {
+		return fmt.Errorf("failed to read vault database: %w", err)
+	}
+	if v.title = database.TitleProperty(); v.title == "" {
+		return fmt.Errorf("vault database %s has no title property", v.databaseID)
+	}
+	return nil
+}
+
+// remotePages returns the entries of the database by page ID
+func (v *Vault) remotePages(ctx context.Context) (map[string]remotePage, error) {
+	response, err := v.client.Query(ctx, v.databaseID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vault database: %w", err)
+	}
+	pages := make(map[string]remotePage, len(response.Results))
+	for _, result := range response.Results {
+		page := utility.PageObjectResponse(result)
+		pages[page.ID()] = remotePage{ID: page.ID(), Path: notePath(page.Title()), Edited: page.LastEditedTime()}
+	}
+	return pages, nil
+}
+
+// localNotes returns the modification times of the notes in the vault by
+// path, skipping hidden files and directories (such as .obsidian)
+func (v *Vault) localNotes() (map[string]time.Time, error) {
+	notes := make(map[string]time.Time)
+	err := filepath.WalkDir(v.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != v.dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !entry.Type().IsRegular() || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(v.dir, path)
+		notes[filepath.ToSlash(rel)] = info.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", v.dir, err)
+	}
+	return notes, nil
+}
+
+// localChanged reports whether a note's content changed since its last
+// sync; a note only touched gets its new time recorded
+func (v *Vault) localChanged(path string, modTime time.Time, entry *VaultEntry) (bool, error) {
+	if modTime.Equal(entry.ModTime) {
+		return false, nil
+	}
+	content, _, err := v.readNote(path)
+	if err != nil {
+		return false, err
+	}
+	if noteHash(content) != entry.Hash {
+		return true, nil
+	}
+	entry.ModTime = modTime
+	return false, nil
+}
+
+// readNote reads a note of the vault
+func (v *Vault) readNote(path string) ([]byte, os.FileInfo, error) {
+	file := filepath.Join(v.dir, path)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return content, info, nil
+}
+
+// notePath turns a page title into the path of its note, each part of the
+// title made a safe file name
+func notePath(title string) string {
+	parts := strings.Split(title, "/")
+	for idx, part := range parts {
+		parts[idx] = fileName(part)
+	}
+	return strings.Join(parts, "/") + ".md"
+}
+
+// noteHash identifies the content of a note
+func noteHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,364 @@
+/**
+ * Snapshot backends - snapper and raw btrfs behind one interface
+ * snapper keeps snapshots of a configured subvolume in its own .snapshots;
+ * without snapper, read-only btrfs snapshots go to .snapshots inside the
+ * subvolume. Either way daemira marks the snapshots it takes (a snapper
+ * description, a name prefix) and only prunes its scheduled ones.
+ */
+
+package snapshots
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Backend names
+const (
+	BackendAuto    = "auto"
+	BackendSnapper = "snapper"
+	BackendBtrfs   = "btrfs"
+)
+
+// Snapshot kinds
+const (
+	KindScheduled = "scheduled" // taken on schedule, pruned to the retention
+	KindManual    = "manual"    // taken with `daemira snapshots create`
+	KindRollback  = "rollback"  // taken before a rollback, to undo it
+)
+
+// snapshotPrefix marks the snapshots daemira takes
+const snapshotPrefix = "daemira"
+
+// btrfsTimeLayout is the time in raw btrfs snapshot names
+const btrfsTimeLayout = "20060102-150405"
+
+// btrfsSuperMagic is the f_type statfs reports for btrfs
+const btrfsSuperMagic = 0x9123683E
+
+// btrfsSubvolumeInode is the inode number of every subvolume's root
+const btrfsSubvolumeInode = 256
+
+// Snapshot is a snapshot of the subvolume
+type Snapshot struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind,omitempty"` // empty for snapshots daemira didn't take
+	Description string    `json:"description,omitempty"`
+}
+
+// Backend takes, lists, deletes and rolls back snapshots
+type Backend interface {
+	// Name returns the backend name
+	Name() string
+
+	// Subvolume returns the subvolume snapshotted
+	Subvolume() string
+
+	// Create takes a snapshot of the given kind
+	Create(ctx context.Context, kind string) (Snapshot, error)
+
+	// List returns the snapshots, oldest first
+	List(ctx context.Context) ([]Snapshot, error)
+
+	// Delete removes snapshots
+	Delete(ctx context.Context, snapshots []Snapshot) error
+
+	// Rollback returns path, a file or directory in the subvolume, to how
+	// it was in snapshot
+	Rollback(ctx context.Context, snapshot Snapshot, path string, run *utility.RunLog) error
+}
+
+// newBackend returns the backend named name, or for "auto" snapper if it
+// has a config named snapperConfig and raw btrfs otherwise
+func newBackend(ctx context.Context, name, subvolume, snapperConfig string, runner utility.CommandRunner) (Backend, error) {
+	commands := backendRunner{runner: runner, privileges: utility.GetPrivilegeManager()}
+	switch name {
+	case BackendSnapper:
+		return newSnapper(ctx, snapperConfig, commands)
+	case BackendBtrfs:
+		return newBtrfs(subvolume, commands)
+	case BackendAuto, "":
+		if _, err := exec.LookPath("snapper"); err == nil {
+			if b, err := newSnapper(ctx, snapperConfig, commands); err == nil {
+				return b, nil
+			}
+		}
+		return newBtrfs(subvolume, commands)
+	}
+	return nil, fmt.Errorf("unknown snapshot backend %q (must be auto, snapper or btrfs)", name)
+}
+
+// IsSubvolume reports whether path is the root of a btrfs subvolume
+func IsSubvolume(path string) bool {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil || fs.Type != btrfsSuperMagic {
+		return false
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false
+	}
+	return st.Ino == btrfsSubvolumeInode
+}
+
+// backendRunner runs the snapshot programs as root
+type backendRunner struct {
+	runner     utility.CommandRunner
+	privileges *utility.PrivilegeManager
+}
+
+// run runs a program as root, writing its output to the run log, and
+// returns its output
+func (r backendRunner) run(ctx context.Context, run *utility.RunLog, argv ...string) (string, error) {
+	command := utility.CommandLine(argv...)
+	run.Println("$ " + command)
+	args := r.privileges.Command(argv...)
+	result, err := r.runner.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{
+		// A rollback copying home back or deleting a large subvolume takes
+		// long, and cutting it short leaves home half rolled back; ctx is
+		// what stops it
+		Timeout:        -1,
+		MaxOutputBytes: -1,
+		StdoutCallback: run.Println,
+		StderrCallback: run.Println,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", argv[0], err)
+	}
+	r.privileges.AuditRan(command, result.ExitCode)
+	if result.ExitCode != 0 {
+		output := strings.TrimSpace(result.Stderr)
+		if output == "" {
+			output = strings.TrimSpace(result.Stdout)
+		}
+		if idx := strings.LastIndex(output, "\n"); idx >= 0 {
+			output = output[idx+1:]
+		}
+		return "", fmt.Errorf("%s failed (exit code %d): %s", command, result.ExitCode, output)
+	}
+	return result.Stdout, nil
+}
+
+// snapper takes snapshots with a snapper config
+type snapper struct {
+	commands  backendRunner
+	config    string
+	subvolume string
+}
+
+// newSnapper returns the snapper backend for config, if snapper has it
+func newSnapper(ctx context.Context, config string, commands backendRunner) (*snapper, error) {
+	s := &snapper{commands: commands, config: config}
+	output, err := commands.run(ctx, nil, "snapper", "--csvout", "-c", config, "get-config")
+	if err != nil {
+		return nil, fmt.Errorf("no snapper config %q: %w", config, err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapper config %q: %w", config, err)
+	}
+	for _, row := range rows {
+		if len(row) >= 2 && row[0] == "SUBVOLUME" {
+			s.subvolume = row[1]
+		}
+	}
+	if s.subvolume == "" {
+		return nil, fmt.Errorf("snapper config %q has no SUBVOLUME", config)
+	}
+	return s, nil
+}
+
+func (s *snapper) Name() string      { return BackendSnapper }
+func (s *snapper) Subvolume() string { return s.subvolume }
+
+func (s *snapper) Create(ctx context.Context, kind string) (Snapshot, error) {
+	now := time.Now()
+	output, err := s.commands.run(ctx, nil, "snapper", "-c", s.config, "create",
+		"--description", snapshotPrefix+" "+kind,
+		"--userdata", snapshotPrefix+"="+kind,
+		"--print-number")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	number := strings.TrimSpace(output)
+	if _, err := strconv.Atoi(number); err != nil {
+		return Snapshot{}, fmt.Errorf("unexpected snapper output %q", number)
+	}
+	return Snapshot{ID: number, Time: now, Kind: kind, Description: snapshotPrefix + " " + kind}, nil
+}
+
+func (s *snapper) List(ctx context.Context) ([]Snapshot, error) {
+	output, err := s.commands.run(ctx, nil, "snapper", "--csvout", "-c", s.config, "list",
+		"--columns", "number,date,description,userdata")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapper list: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for idx, row := range rows {
+		// The header, and snapshot 0, which is the live subvolume
+		if idx == 0 || len(row) < 4 || row[0] == "0" {
+			continue
+		}
+		snapshot := Snapshot{ID: row[0], Description: row[2]}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", row[1], time.Local); err == nil {
+			snapshot.Time = t
+		}
+		for _, pair := range strings.Split(row[3], ",") {
+			if key, value, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && key == snapshotPrefix {
+				snapshot.Kind = value
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (s *snapper) Delete(ctx context.Context, snapshots []Snapshot) error {
+	args := []string{"snapper", "-c", s.config, "delete"}
+	for _, snapshot := range snapshots {
+		args = append(args, snapshot.ID)
+	}
+	_, err := s.commands.run(ctx, nil, args...)
+	return err
+}
+
+func (s *snapper) Rollback(ctx context.Context, snapshot Snapshot, path string, run *utility.RunLog) error {
+	// undochange reverts what changed between the snapshot and the live
+	// subvolume (snapshot 0); rollback itself only works for root configs
+	args := []string{"snapper", "-c", s.config, "undochange", snapshot.ID + "..0"}
+	if path != s.subvolume {
+		args = append(args, path)
+	}
+	_, err := s.commands.run(ctx, run, args...)
+	return err
+}
+
+// btrfs takes read-only snapshots into the subvolume's .snapshots
+type btrfs struct {
+	commands  backendRunner
+	subvolume string
+	dir       string
+}
+
+// btrfsNamePattern matches the names daemira gives raw btrfs snapshots
+var btrfsNamePattern = regexp.MustCompile(`^` + snapshotPrefix + `-(?:([a-z]+)-)?(\d{8}-\d{6})$`)
+
+// newBtrfs returns the raw btrfs backend for subvolume
+func newBtrfs(subvolume string, commands backendRunner) (*btrfs, error) {
+	subvolume = filepath.Clean(subvolume)
+	if !IsSubvolume(subvolume) {
+		return nil, fmt.Errorf("%s is not a btrfs subvolume", subvolume)
+	}
+	return &btrfs{commands: commands, subvolume: subvolume, dir: filepath.Join(subvolume, ".snapshots")}, nil
+}
+
+func (b *btrfs) Name() string      { return BackendBtrfs }
+func (b *btrfs) Subvolume() string { return b.subvolume }
+
+func (b *btrfs) Create(ctx context.Context, kind string) (Snapshot, error) {
+	if _, err := os.Stat(b.dir); os.IsNotExist(err) {
+		if _, err := b.commands.run(ctx, nil, "mkdir", "-m", "0750", b.dir); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to create %s: %w", b.dir, err)
+		}
+	}
+
+	now := time.Now()
+	name := snapshotPrefix + "-" + now.Format(btrfsTimeLayout)
+	if kind != KindScheduled {
+		name = snapshotPrefix + "-" + kind + "-" + now.Format(btrfsTimeLayout)
+	}
+	if _, err := b.commands.run(ctx, nil, "btrfs", "subvolume", "snapshot", "-r", b.subvolume, filepath.Join(b.dir, name)); err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{ID: name, Time: now.Truncate(time.Second), Kind: kind}, nil
+}
+
+func (b *btrfs) List(ctx context.Context) ([]Snapshot, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", b.dir, err)
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		match := btrfsNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil || !entry.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(btrfsTimeLayout, match[2], time.Local)
+		if err != nil {
+			continue
+		}
+		kind := match[1]
+		if kind == "" {
+			kind = KindScheduled
+		}
+		snapshots = append(snapshots, Snapshot{ID: entry.Name(), Time: t, Kind: kind})
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+func (b *btrfs) Delete(ctx context.Context, snapshots []Snapshot) error {
+	args := []string{"btrfs", "subvolume", "delete"}
+	for _, snapshot := range snapshots {
+		args = append(args, filepath.Join(b.dir, snapshot.ID))
+	}
+	_, err := b.commands.run(ctx, nil, args...)
+	return err
+}
+
+func (b *btrfs) Rollback(ctx context.Context, snapshot Snapshot, path string, run *utility.RunLog) error {
+	rel, err := filepath.Rel(b.subvolume, path)
+	if err != nil {
+		return err
+	}
+	source := filepath.Join(b.dir, snapshot.ID, rel)
+	info, err := os.Lstat(source)
+	if err != nil {
+		return fmt.Errorf("%s is not in snapshot %s", path, snapshot.ID)
+	}
+
+	// Copy the snapshot's version over the live one, removing files added
+	// since; the snapshots themselves stay where they are
+	args := []string{"rsync", "-aAXH", "--delete"}
+	if rel == "." {
+		args = append(args, "--exclude", "/.snapshots")
+	}
+	if info.IsDir() {
+		args = append(args, source+"/", path+"/")
+	} else {
+		args = append(args, source, path)
+	}
+	_, err = b.commands.run(ctx, run, args...)
+	return err
+}
+
+// sortSnapshots orders snapshots oldest first
+func sortSnapshots(snapshots []Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+}
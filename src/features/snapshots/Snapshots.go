@@ -0,0 +1,437 @@
+/**
+ * HomeSnapshots - Periodic btrfs snapshots of the home subvolume
+ * Takes a snapshot every interval with snapper or raw btrfs (see
+ * Backends.go), independent of system updates, and prunes daemira's
+ * scheduled snapshots to an hourly/daily/weekly retention itself rather
+ * than through snapper's cleanup. Rolling back first takes a snapshot of
+ * the current state, so a rollback can be undone. The outcome of the last
+ * snapshot is kept in the state store for `daemira snapshots status`.
+ */
+
+package snapshots
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// DefaultInterval is the time between snapshots unless configured otherwise
+const DefaultInterval = time.Hour
+
+// snapshotJob is the scheduler job taking snapshots
+const snapshotJob = "snapshot"
+
+// snapshotsState is the state store section keeping the last snapshot
+const snapshotsState = "snapshots"
+
+// Retention is how many scheduled snapshots pruning keeps: the newest of
+// each of the last Hourly hours, Daily days and Weekly weeks. With all
+// three 0 nothing is pruned.
+type Retention struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+// IsSet reports whether the retention prunes anything
+func (r Retention) IsSet() bool {
+	return r.Hourly > 0 || r.Daily > 0 || r.Weekly > 0
+}
+
+// String describes the retention, e.g. "24 hourly, 7 daily, 4 weekly"
+func (r Retention) String() string {
+	if !r.IsSet() {
+		return "keep all"
+	}
+	var parts []string
+	for _, keep := range []struct {
+		name  string
+		count int
+	}{{"hourly", r.Hourly}, {"daily", r.Daily}, {"weekly", r.Weekly}} {
+		if keep.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", keep.count, keep.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Expired returns the scheduled snapshots the retention doesn't keep.
+// Snapshots of other kinds are never expired.
+func (r Retention) Expired(snapshots []Snapshot) []Snapshot {
+	if !r.IsSet() {
+		return nil
+	}
+
+	var scheduled []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Kind == KindScheduled {
+			scheduled = append(scheduled, snapshot)
+		}
+	}
+	sortSnapshots(scheduled)
+
+	// Walking newest first, keep the first snapshot of each period until
+	// enough periods are kept
+	keep := make(map[string]bool)
+	for _, period := range []struct {
+		count int
+		key   func(time.Time) string
+	}{
+		{r.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+	} {
+		seen := make(map[string]bool)
+		for idx := len(scheduled) - 1; idx >= 0 && len(seen) < period.count; idx-- {
+			key := period.key(scheduled[idx].Time.Local())
+			if !seen[key] {
+				seen[key] = true
+				keep[scheduled[idx].ID] = true
+			}
+		}
+	}
+
+	var expired []Snapshot
+	for _, snapshot := range scheduled {
+		if !keep[snapshot.ID] {
+			expired = append(expired, snapshot)
+		}
+	}
+	return expired
+}
+
+// SnapshotOptions configures home snapshots
+type SnapshotOptions struct {
+	Backend       string // auto (default), snapper or btrfs
+	Subvolume     string // Default: /home (raw btrfs)
+	SnapperConfig string // Default: home
+	Interval      time.Duration
+	Retention     Retention
+}
+
+// Status is the outcome of the last snapshot
+type Status struct {
+	Backend      string    `json:"backend"`
+	Subvolume    string    `json:"subvolume"`
+	Running      bool      `json:"running"`
+	LastRun      time.Time `json:"lastRun"`
+	LastSnapshot string    `json:"lastSnapshot,omitempty"`
+	LastSuccess  time.Time `json:"lastSuccess"`
+	LastError    string    `json:"lastError,omitempty"`
+	Pruned       int       `json:"pruned"` // snapshots removed after the last one
+	NextSnapshot time.Time `json:"nextSnapshot"`
+	Retention    string    `json:"retention"` // e.g. "24 hourly, 7 daily"
+}
+
+// LoadStatus returns the outcome of the last snapshot the daemon saved
+func LoadStatus() Status {
+	var status Status
+	utility.GetStateStore().Load(snapshotsState, &status)
+	status.Running = false
+	return status
+}
+
+// HomeSnapshots snapshots a subvolume periodically
+type HomeSnapshots struct {
+	logger    *utility.Logger
+	backend   Backend
+	interval  time.Duration
+	retention Retention
+	status    Status
+	isRunning bool
+	runMu     sync.Mutex // held while a snapshot, pruning or rollback runs
+	mu        sync.Mutex
+}
+
+// NewHomeSnapshots creates HomeSnapshots with the backend options name,
+// failing if it can't snapshot the subvolume
+func NewHomeSnapshots(ctx context.Context, logger *utility.Logger, options *SnapshotOptions) (*HomeSnapshots, error) {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+	if options == nil {
+		options = &SnapshotOptions{}
+	}
+	subvolume := options.Subvolume
+	if subvolume == "" {
+		subvolume = "/home"
+	} else if strings.HasPrefix(subvolume, "~") {
+		home, _ := os.UserHomeDir()
+		subvolume = filepath.Join(home, subvolume[1:])
+	}
+	snapperConfig := options.SnapperConfig
+	if snapperConfig == "" {
+		snapperConfig = "home"
+	}
+
+	backend, err := newBackend(ctx, options.Backend, subvolume, snapperConfig, utility.NewShell(logger))
+	if err != nil {
+		return nil, err
+	}
+
+	hs := &HomeSnapshots{
+		logger:    logger.With("snapshots"),
+		backend:   backend,
+		interval:  DefaultInterval,
+		retention: options.Retention,
+	}
+	if options.Interval > 0 {
+		hs.interval = options.Interval
+	}
+	hs.status = LoadStatus()
+	hs.status.Backend = backend.Name()
+	hs.status.Subvolume = backend.Subvolume()
+	return hs, nil
+}
+
+// Backend returns the snapshot backend in use
+func (hs *HomeSnapshots) Backend() string {
+	return hs.backend.Name()
+}
+
+// Subvolume returns the subvolume snapshotted
+func (hs *HomeSnapshots) Subvolume() string {
+	return hs.backend.Subvolume()
+}
+
+// Start takes a snapshot now (unless one is still recent) and then every
+// interval
+func (hs *HomeSnapshots) Start() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.isRunning {
+		hs.logger.Warn("Snapshots already running")
+		return
+	}
+
+	hs.isRunning = true
+	hs.logger.Info("Starting %s snapshots of %s (interval: %v)", hs.backend.Name(), hs.backend.Subvolume(), hs.interval)
+
+	utility.GetScheduler().Add(utility.Job{
+		ID:          snapshotJob,
+		Description: "Snapshot " + hs.backend.Subvolume() + " with " + hs.backend.Name(),
+		Schedule:    utility.Every(hs.interval),
+		Jitter:      time.Minute,
+		RunAtStart:  true,
+		Run:         hs.Run,
+	})
+}
+
+// Stop halts the periodic snapshots
+func (hs *HomeSnapshots) Stop() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if !hs.isRunning {
+		return
+	}
+
+	hs.isRunning = false
+	utility.GetScheduler().Remove(snapshotJob)
+	hs.logger.Info("Snapshots stopped")
+}
+
+// Shutdown halts the periodic snapshots and waits, until ctx is done, for
+// one in progress to finish
+func (hs *HomeSnapshots) Shutdown(ctx context.Context) error {
+	hs.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		hs.runMu.Lock()
+		hs.runMu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("snapshot still running: %w", ctx.Err())
+	}
+}
+
+// SetInterval changes the snapshot interval of a running scheduler
+func (hs *HomeSnapshots) SetInterval(interval time.Duration) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if interval <= 0 || interval == hs.interval {
+		return
+	}
+
+	hs.interval = interval
+	if hs.isRunning {
+		utility.GetScheduler().Reschedule(snapshotJob, utility.Every(interval))
+	}
+	hs.logger.Info("Snapshot interval changed to %v", interval)
+}
+
+// SetRetention changes what pruning keeps after the next snapshots
+func (hs *HomeSnapshots) SetRetention(retention Retention) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.retention = retention
+}
+
+// Run takes a scheduled snapshot, then prunes scheduled snapshots beyond
+// the retention
+func (hs *HomeSnapshots) Run(ctx context.Context) error {
+	hs.runMu.Lock()
+	defer hs.runMu.Unlock()
+
+	hs.mu.Lock()
+	retention := hs.retention
+	hs.status.Running = true
+	hs.mu.Unlock()
+
+	start := time.Now()
+	snapshot, err := hs.backend.Create(ctx, KindScheduled)
+	var pruned int
+	if err == nil {
+		pruned, err = hs.prune(ctx, retention)
+	}
+
+	hs.mu.Lock()
+	hs.status.Running = false
+	hs.status.LastRun = start
+	hs.status.Pruned = pruned
+	hs.status.LastError = ""
+	if snapshot.ID != "" {
+		hs.status.LastSnapshot = snapshot.ID
+	}
+	if err != nil {
+		hs.status.LastError = err.Error()
+	} else {
+		hs.status.LastSuccess = start
+	}
+	saved := hs.status
+	hs.mu.Unlock()
+	utility.GetStateStore().Save(snapshotsState, saved)
+
+	if err != nil {
+		hs.logger.Error("Snapshot failed: %v", err)
+		return err
+	}
+	hs.logger.Info("Took snapshot %s of %s", snapshot.ID, hs.backend.Subvolume())
+	return nil
+}
+
+// prune deletes the scheduled snapshots beyond the retention
+func (hs *HomeSnapshots) prune(ctx context.Context, retention Retention) (int, error) {
+	if !retention.IsSet() {
+		return 0, nil
+	}
+	snapshots, err := hs.backend.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	expired := retention.Expired(snapshots)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	if err := hs.backend.Delete(ctx, expired); err != nil {
+		return 0, fmt.Errorf("pruning old snapshots failed: %w", err)
+	}
+	hs.logger.Info("Pruned %d snapshots beyond the retention (%s)", len(expired), retention)
+	utility.Audit(utility.AuditDelete, hs.backend.Subvolume(), fmt.Sprintf("%d %s snapshots pruned beyond the retention (%s)", len(expired), hs.backend.Name(), retention))
+	return len(expired), nil
+}
+
+// Create takes a manual snapshot, which pruning leaves alone
+func (hs *HomeSnapshots) Create(ctx context.Context) (Snapshot, error) {
+	hs.runMu.Lock()
+	defer hs.runMu.Unlock()
+
+	snapshot, err := hs.backend.Create(ctx, KindManual)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to take snapshot: %w", err)
+	}
+	hs.logger.Info("Took snapshot %s of %s", snapshot.ID, hs.backend.Subvolume())
+	return snapshot, nil
+}
+
+// List returns the snapshots of the subvolume, oldest first
+func (hs *HomeSnapshots) List(ctx context.Context) ([]Snapshot, error) {
+	snapshots, err := hs.backend.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// Rollback returns path (the whole subvolume if empty) to how it was in
+// the snapshot with id, after taking a snapshot of its current state. It
+// returns that snapshot, to roll back to for undoing, and the run log.
+func (hs *HomeSnapshots) Rollback(ctx context.Context, id, path string) (Snapshot, string, error) {
+	hs.runMu.Lock()
+	defer hs.runMu.Unlock()
+
+	subvolume := hs.backend.Subvolume()
+	if path == "" {
+		path = subvolume
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Snapshot{}, "", err
+	}
+	if rel, err := filepath.Rel(subvolume, path); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return Snapshot{}, "", fmt.Errorf("%s is not in %s", path, subvolume)
+	}
+
+	snapshots, err := hs.backend.List(ctx)
+	if err != nil {
+		return Snapshot{}, "", fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var target *Snapshot
+	for idx := range snapshots {
+		if snapshots[idx].ID == id {
+			target = &snapshots[idx]
+		}
+	}
+	if target == nil {
+		return Snapshot{}, "", fmt.Errorf("no snapshot %s of %s (see daemira snapshots list)", id, subvolume)
+	}
+
+	undo, err := hs.backend.Create(ctx, KindRollback)
+	if err != nil {
+		return Snapshot{}, "", fmt.Errorf("failed to take snapshot before rolling back: %w", err)
+	}
+
+	run, logErr := utility.NewRunLog("snapshots", "rollback "+id)
+	if logErr != nil {
+		hs.logger.Debug("Rolling back without run log: %v", logErr)
+	}
+	defer run.Close()
+
+	hs.logger.Info("Rolling back %s to snapshot %s (undo with snapshot %s)...", path, id, undo.ID)
+	if err := hs.backend.Rollback(ctx, *target, path, run); err != nil {
+		return undo, run.Path(), fmt.Errorf("rollback failed: %w", err)
+	}
+	utility.Audit(utility.AuditDelete, path, fmt.Sprintf("rolled back to snapshot %s; the previous state is snapshot %s", id, undo.ID))
+	hs.logger.Info("Rolled back %s to snapshot %s", path, id)
+	return undo, run.Path(), nil
+}
+
+// GetStatus returns the outcome of the last snapshot and when the next
+// one is taken
+func (hs *HomeSnapshots) GetStatus() Status {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	status := hs.status
+	status.Retention = hs.retention.String()
+	status.NextSnapshot = utility.GetScheduler().NextRun(snapshotJob)
+	return status
+}
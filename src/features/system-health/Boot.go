@@ -0,0 +1,421 @@
+/**
+ * Boot time
+ * Reads how long the last boot took from systemd-analyze, split into
+ * firmware, loader, kernel, initrd and userspace, and which units took
+ * longest to start. Each boot is recorded once in the state store, so the
+ * trend survives restarts; a boot slower than the usual one by more than
+ * health.boot_regression percent raises an alert naming the units that are
+ * new or slower since the boots before it.
+ */
+
+package systemhealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// bootAlert is raised when the last boot was much slower than usual
+const bootAlert = "boot-time"
+
+// bootState is the state store section keeping past boots
+const bootState = "boots"
+
+// DefaultBootRegression is how much slower than usual, in percent, a boot
+// may be before it is reported
+const DefaultBootRegression = 25
+
+const (
+	// bootHistory is how many boots are kept
+	bootHistory = 30
+	// bootBaseline is how many earlier boots the usual boot time is taken from
+	bootBaseline = 5
+	// bootMinRegression keeps a few seconds of noise from counting as a
+	// regression on fast machines
+	bootMinRegression = 5 * time.Second
+	// bootBlameUnits is how many of the slowest units are kept per boot
+	bootBlameUnits = 40
+)
+
+// ErrBootNotFinished is returned while systemd is still starting units
+var ErrBootNotFinished = errors.New("boot has not finished yet")
+
+var (
+	// bootStagePattern matches a stage of "Startup finished in 5.1s (kernel) + ..."
+	bootStagePattern = regexp.MustCompile(`([0-9][0-9a-z. ]*?) \((firmware|loader|kernel|initrd|userspace)\)`)
+	// bootTotalPattern matches the total at the end of the same line
+	bootTotalPattern = regexp.MustCompile(`= ([0-9][0-9a-z. ]*)$`)
+)
+
+// BootUnit is a unit and how long it took to start
+type BootUnit struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// BootTime is how long a boot took
+type BootTime struct {
+	ID        string        `json:"id"` // the kernel's boot ID
+	Booted    time.Time     `json:"booted"`
+	Firmware  time.Duration `json:"firmware,omitempty"`
+	Loader    time.Duration `json:"loader,omitempty"`
+	Kernel    time.Duration `json:"kernel"`
+	Initrd    time.Duration `json:"initrd,omitempty"`
+	Userspace time.Duration `json:"userspace"`
+	Total     time.Duration `json:"total"`
+	Blame     []BootUnit    `json:"blame"` // the slowest units, slowest first
+}
+
+// Stages describes the boot's stages, e.g. "2.1s (firmware) + 8.9s (userspace)"
+func (b BootTime) Stages() string {
+	var stages []string
+	for _, stage := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"firmware", b.Firmware},
+		{"loader", b.Loader},
+		{"kernel", b.Kernel},
+		{"initrd", b.Initrd},
+		{"userspace", b.Userspace},
+	} {
+		if stage.duration > 0 {
+			stages = append(stages, fmt.Sprintf("%s (%s)", formatBootDuration(stage.duration), stage.name))
+		}
+	}
+	return strings.Join(stages, " + ")
+}
+
+// BootRegression is a boot slower than the usual one
+type BootRegression struct {
+	Boot    BootTime
+	Usual   time.Duration // median of the boots before it
+	New     []BootUnit    // slow units that weren't among the slowest before
+	Slower  []BootUnit    // units that got slower, by how much
+	Percent int
+}
+
+// Summary describes the regression, e.g. "Boot took 40.0s, 90% over the usual 21.0s"
+func (r BootRegression) Summary() string {
+	return fmt.Sprintf("Boot took %s, %d%% over the usual %s", formatBootDuration(r.Boot.Total), r.Percent, formatBootDuration(r.Usual))
+}
+
+// Causes describes the units behind the regression
+func (r BootRegression) Causes() string {
+	var causes []string
+	for _, unit := range r.New {
+		causes = append(causes, fmt.Sprintf("new: %s (%s)", unit.Name, formatBootDuration(unit.Duration)))
+	}
+	for _, unit := range r.Slower {
+		causes = append(causes, fmt.Sprintf("slower: %s (+%s)", unit.Name, formatBootDuration(unit.Duration)))
+	}
+	if len(causes) == 0 {
+		return "no unit stands out (see daemira performance boot)"
+	}
+	return strings.Join(causes, "; ")
+}
+
+// BootMonitor records boot times and reports regressions
+type BootMonitor struct {
+	logger     *utility.Logger
+	shell      utility.CommandRunner
+	regression int // percent
+	boots      []BootTime
+	loaded     bool
+	mu         sync.Mutex
+}
+
+var (
+	bootMonitorInstance *BootMonitor
+	bootMonitorOnce     sync.Once
+)
+
+// GetBootMonitor returns the singleton BootMonitor instance
+func GetBootMonitor() *BootMonitor {
+	bootMonitorOnce.Do(func() {
+		bootMonitorInstance = &BootMonitor{
+			logger:     utility.GetLogger().With("performance"),
+			shell:      utility.NewShell(utility.GetLogger()),
+			regression: DefaultBootRegression,
+		}
+	})
+	return bootMonitorInstance
+}
+
+// SetRegression sets how much slower than usual, in percent, a boot may be;
+// 0 stops reporting regressions
+func (bm *BootMonitor) SetRegression(percent int) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.regression = percent
+}
+
+// History returns the recorded boots, oldest first
+func (bm *BootMonitor) History() []BootTime {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.load()
+	return append([]BootTime(nil), bm.boots...)
+}
+
+// load reads the recorded boots once; the caller holds mu
+func (bm *BootMonitor) load() {
+	if bm.loaded {
+		return
+	}
+	bm.loaded = true
+	utility.GetStateStore().Load(bootState, &bm.boots)
+}
+
+// Analyze reads how long the current boot took and its slowest units
+func (bm *BootMonitor) Analyze(ctx context.Context) (BootTime, error) {
+	boot := BootTime{ID: currentBootID()}
+	result, err := bm.shell.ExecuteArgs(ctx, "systemd-analyze", []string{"time"}, &utility.ExecOptions{
+		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		return boot, fmt.Errorf("failed to run systemd-analyze: %w", err)
+	}
+	output := strings.TrimSpace(result.Stdout + "\n" + result.Stderr)
+	if strings.Contains(output, "not yet finished") {
+		return boot, ErrBootNotFinished
+	}
+	if result.ExitCode != 0 {
+		return boot, fmt.Errorf("systemd-analyze time: %s", strings.TrimSpace(result.Stderr))
+	}
+	if err := parseBootTime(result.Stdout, &boot); err != nil {
+		return boot, err
+	}
+	if uptime, err := readUptime(); err == nil {
+		boot.Booted = time.Now().Add(-uptime).Truncate(time.Second)
+	}
+
+	blame, err := bm.Blame(ctx)
+	if err != nil {
+		return boot, err
+	}
+	if len(blame) > bootBlameUnits {
+		blame = blame[:bootBlameUnits]
+	}
+	boot.Blame = blame
+	return boot, nil
+}
+
+// Blame returns the units of the current boot by how long they took to
+// start, slowest first
+func (bm *BootMonitor) Blame(ctx context.Context) ([]BootUnit, error) {
+	result, err := bm.shell.ExecuteArgs(ctx, "systemd-analyze", []string{"blame", "--no-pager"}, &utility.ExecOptions{
+		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run systemd-analyze blame: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("systemd-analyze blame: %s", strings.TrimSpace(result.Stderr))
+	}
+	return parseBlame(result.Stdout), nil
+}
+
+// parseBootTime reads the stages of "Startup finished in 3.2s (firmware) +
+// 1.1s (loader) + 1.9s (kernel) + 2.3s (initrd) + 9.8s (userspace) = 18.3s"
+func parseBootTime(output string, boot *BootTime) error {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Startup finished in") {
+			continue
+		}
+		for _, match := range bootStagePattern.FindAllStringSubmatch(line, -1) {
+			duration, err := parseSystemdDuration(match[1])
+			if err != nil {
+				return err
+			}
+			switch match[2] {
+			case "firmware":
+				boot.Firmware = duration
+			case "loader":
+				boot.Loader = duration
+			case "kernel":
+				boot.Kernel = duration
+			case "initrd":
+				boot.Initrd = duration
+			case "userspace":
+				boot.Userspace = duration
+			}
+		}
+		if match := bootTotalPattern.FindStringSubmatch(line); match != nil {
+			total, err := parseSystemdDuration(match[1])
+			if err != nil {
+				return err
+			}
+			boot.Total = total
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected systemd-analyze output: %s", strings.TrimSpace(output))
+}
+
+// parseBlame reads the lines of `systemd-analyze blame`, e.g.
+// "1min 2.104s NetworkManager-wait-online.service"
+func parseBlame(output string) []BootUnit {
+	var units []BootUnit
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[len(fields)-1]
+		duration, err := parseSystemdDuration(strings.Join(fields[:len(fields)-1], " "))
+		if err != nil {
+			continue
+		}
+		units = append(units, BootUnit{Name: name, Duration: duration})
+	}
+	sort.SliceStable(units, func(i, j int) bool { return units[i].Duration > units[j].Duration })
+	return units
+}
+
+// parseSystemdDuration reads systemd's time spans, e.g. "1min 2.345s",
+// "812ms" or "1h 3min"
+func parseSystemdDuration(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	var total time.Duration
+	for _, part := range strings.Fields(text) {
+		part = strings.Replace(part, "min", "m", 1)
+		part = strings.Replace(part, "us", "µs", 1)
+		duration, err := time.ParseDuration(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		total += duration
+	}
+	if text == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	return total, nil
+}
+
+// currentBootID returns the kernel's ID of the current boot
+func currentBootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readUptime returns how long ago the machine booted
+func readUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/uptime")
+	}
+	return time.ParseDuration(fields[0] + "s")
+}
+
+// Record records the current boot once, raising the boot-time alert when it
+// was much slower than the boots before it. A boot still starting units is
+// left for a later check.
+func (bm *BootMonitor) Record(ctx context.Context) error {
+	id := currentBootID()
+	bm.mu.Lock()
+	bm.load()
+	recorded := id != "" && len(bm.boots) > 0 && bm.boots[len(bm.boots)-1].ID == id
+	bm.mu.Unlock()
+	if recorded {
+		return nil
+	}
+
+	boot, err := bm.Analyze(ctx)
+	if errors.Is(err, ErrBootNotFinished) {
+		bm.logger.Debug("Boot not finished, recording its time later")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	bm.mu.Lock()
+	bm.boots = append(bm.boots, boot)
+	if len(bm.boots) > bootHistory {
+		bm.boots = bm.boots[len(bm.boots)-bootHistory:]
+	}
+	boots := append([]BootTime(nil), bm.boots...)
+	percent := bm.regression
+	bm.mu.Unlock()
+	utility.GetStateStore().Save(bootState, boots)
+	bm.logger.Info("Boot took %s: %s", formatBootDuration(boot.Total), boot.Stages())
+
+	regression, ok := FindBootRegression(boots, percent)
+	if !ok {
+		utility.GetAlerts().Resolve(bootAlert)
+		return nil
+	}
+	bm.logger.Warn("%s; %s", regression.Summary(), regression.Causes())
+	utility.GetAlerts().Raise(bootAlert, utility.AlertWarning, regression.Summary(), regression.Causes())
+	return nil
+}
+
+// FindBootRegression reports whether the last boot was more than percent
+// slower than the median of the boots before it, and which units are new
+// among the slowest or got slower
+func FindBootRegression(boots []BootTime, percent int) (BootRegression, bool) {
+	if percent <= 0 || len(boots) < 2 {
+		return BootRegression{}, false
+	}
+	last := boots[len(boots)-1]
+	earlier := boots[max(len(boots)-1-bootBaseline, 0) : len(boots)-1]
+
+	totals := make([]time.Duration, 0, len(earlier))
+	for _, boot := range earlier {
+		totals = append(totals, boot.Total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+	usual := totals[len(totals)/2]
+	if usual <= 0 {
+		return BootRegression{}, false
+	}
+	over := last.Total - usual
+	if over < bootMinRegression || over*100 < usual*time.Duration(percent) {
+		return BootRegression{}, false
+	}
+
+	regression := BootRegression{Boot: last, Usual: usual, Percent: int(over * 100 / usual)}
+	previous := earlier[len(earlier)-1]
+	before := make(map[string]time.Duration, len(previous.Blame))
+	for _, unit := range previous.Blame {
+		before[unit.Name] = unit.Duration
+	}
+	// Only units taking a noticeable share of the extra time are named
+	notable := max(over/10, time.Second)
+	for _, unit := range last.Blame {
+		duration, ok := before[unit.Name]
+		switch {
+		case !ok && unit.Duration >= notable:
+			regression.New = append(regression.New, unit)
+		case ok && unit.Duration-duration >= notable:
+			regression.Slower = append(regression.Slower, BootUnit{Name: unit.Name, Duration: unit.Duration - duration})
+		}
+	}
+	return regression, true
+}
+
+// formatBootDuration rounds a boot duration for display, e.g. "21.4s" or "1m12s"
+func formatBootDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
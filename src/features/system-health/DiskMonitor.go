@@ -56,11 +56,19 @@ type SmartStatus struct {
 // Protected disks that should never be mounted or modified
 var protectedDisks = []string{"sdc"} // Windows partition
 
+// Default free space below which a disk is reported
+const (
+	DefaultWarnFree     int64 = 200 << 30
+	DefaultCriticalFree int64 = 100 << 30
+)
+
 // DiskMonitor monitors disk space, health (SMART), and provides alerts
 type DiskMonitor struct {
-	logger *utility.Logger
-	shell  *utility.Shell
-	mu     sync.RWMutex
+	logger       *utility.Logger
+	shell        utility.CommandRunner
+	warnFree     int64 // bytes free below which a disk is "warning"
+	criticalFree int64 // bytes free below which a disk is "critical"
+	mu           sync.RWMutex
 }
 
 var (
@@ -72,13 +80,35 @@ var (
 func GetDiskMonitor() *DiskMonitor {
 	diskMonitorOnce.Do(func() {
 		diskMonitorInstance = &DiskMonitor{
-			logger: utility.GetLogger(),
-			shell:  utility.NewShell(utility.GetLogger()),
+			logger:       utility.GetLogger().With("disk"),
+			shell:        utility.NewShell(utility.GetLogger()),
+			warnFree:     DefaultWarnFree,
+			criticalFree: DefaultCriticalFree,
 		}
 	})
 	return diskMonitorInstance
 }
 
+// SetRunner makes the monitor run its commands with runner, e.g. a
+// utility.FakeRunner; call it before the monitor is used
+func (dm *DiskMonitor) SetRunner(runner utility.CommandRunner) {
+	dm.shell = runner
+}
+
+// SetThresholds sets the free space (in bytes) below which disks are reported
+// as warning and critical; zero keeps the current value
+func (dm *DiskMonitor) SetThresholds(warnFree, criticalFree int64) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if warnFree > 0 {
+		dm.warnFree = warnFree
+	}
+	if criticalFree > 0 {
+		dm.criticalFree = criticalFree
+	}
+}
+
 // IsProtectedDisk checks if a disk is protected (e.g., Windows partition)
 func (dm *DiskMonitor) IsProtectedDisk(device string) bool {
 	for _, protected := range protectedDisks {
@@ -102,6 +132,10 @@ func (dm *DiskMonitor) GetAllDiskUsage(ctx context.Context) ([]DiskUsage, error)
 		return []DiskUsage{}, err
 	}
 
+	dm.mu.RLock()
+	warnFree, criticalFree := dm.warnFree, dm.criticalFree
+	dm.mu.RUnlock()
+
 	var disks []DiskUsage
 	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
 
@@ -147,9 +181,9 @@ func (dm *DiskMonitor) GetAllDiskUsage(ctx context.Context) ([]DiskUsage, error)
 
 		// Determine status based on thresholds
 		status := "healthy"
-		if percentUsed >= 95 || freeBytes < 100*1024*1024*1024 {
+		if percentUsed >= 95 || freeBytes < criticalFree {
 			status = "critical"
-		} else if percentUsed >= 90 || freeBytes < 200*1024*1024*1024 {
+		} else if percentUsed >= 90 || freeBytes < warnFree {
 			status = "warning"
 		}
 
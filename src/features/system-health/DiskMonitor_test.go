@@ -0,0 +1,115 @@
+package systemhealth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// newTestDiskMonitor creates a DiskMonitor running its commands with runner
+func newTestDiskMonitor(runner *utility.FakeRunner) *DiskMonitor {
+	dm := &DiskMonitor{
+		logger:       utility.GetLogger().With("disk"),
+		warnFree:     DefaultWarnFree,
+		criticalFree: DefaultCriticalFree,
+	}
+	dm.SetRunner(runner)
+	return dm
+}
+
+func TestDiskMonitorCheckLowSpace(t *testing.T) {
+	tests := []struct {
+		name         string
+		warnFree     int64
+		criticalFree int64
+		want         map[string]string // warning level by mount point
+	}{
+		{
+			name: "default thresholds",
+			want: map[string]string{"/boot": "critical", "/mnt/data": "critical"},
+		},
+		{
+			name:         "small disks",
+			warnFree:     1 << 30,
+			criticalFree: 512 << 20,
+			want:         map[string]string{"/boot": "warning", "/mnt/data": "critical"},
+		},
+		{
+			name:         "nearly full is critical whatever is free",
+			warnFree:     1 << 20,
+			criticalFree: 1 << 20,
+			want:         map[string]string{"/mnt/data": "critical"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := newTestDiskMonitor(utility.NewFakeRunner().On(`^df -B1 `, fixtureDiskUsage))
+			dm.SetThresholds(tt.warnFree, tt.criticalFree)
+
+			warnings, err := dm.CheckLowSpace(context.Background())
+			if err != nil {
+				t.Fatalf("CheckLowSpace() = %v", err)
+			}
+			got := map[string]string{}
+			for _, warning := range warnings {
+				got[warning.MountPoint] = warning.Level
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("CheckLowSpace() = %v, want %v", got, tt.want)
+			}
+			for mount, level := range tt.want {
+				if got[mount] != level {
+					t.Errorf("%s is %q, want %q", mount, got[mount], level)
+				}
+			}
+		})
+	}
+}
+
+func TestDiskMonitorGetAllDiskUsage(t *testing.T) {
+	dm := newTestDiskMonitor(utility.NewFakeRunner().On(`^df -B1 `, fixtureDiskUsage))
+
+	disks, err := dm.GetAllDiskUsage(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllDiskUsage() = %v", err)
+	}
+	if len(disks) != 3 {
+		t.Fatalf("got %d disks, want 3", len(disks))
+	}
+	root := disks[0]
+	if root.Device != "/dev/nvme0n1p2" || root.MountPoint != "/" || root.Filesystem != "btrfs" || root.Status != "healthy" {
+		t.Errorf("root = %+v", root)
+	}
+	if root.FreeBytes != 384124112896 || root.PercentUsed != 62 {
+		t.Errorf("root has %d bytes free, %.0f%% used", root.FreeBytes, root.PercentUsed)
+	}
+}
+
+func TestDiskMonitorGetAllSmartStatus(t *testing.T) {
+	runner := utility.NewFakeRunner().
+		On(`^lsblk `, fixtureDisks).
+		On(`^which smartctl$`, utility.Result{Stdout: "/usr/bin/smartctl"}).
+		On(`^sudo smartctl -H /dev/nvme0n1$`, fixtureSmartPassed).
+		On(`^sudo smartctl -a /dev/nvme0n1$`, fixtureSmartNvme).
+		On(`^sudo smartctl -H /dev/sda$`, fixtureSmartFailed)
+	dm := newTestDiskMonitor(runner)
+
+	statuses, err := dm.GetAllSmartStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllSmartStatus() = %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("got %d statuses, want 2", len(statuses))
+	}
+	nvme, sda := statuses[0], statuses[1]
+	if !nvme.Passed || nvme.Temperature == nil || *nvme.Temperature != 41 {
+		t.Errorf("/dev/nvme0n1 = %+v", nvme)
+	}
+	if sda.Passed {
+		t.Error("/dev/sda passed, its self-assessment failed")
+	}
+	if runs := runner.Ran(`/dev/sdc`); runs != 0 {
+		t.Errorf("the protected disk was checked: %q", runner.Commands())
+	}
+}
@@ -0,0 +1,461 @@
+/**
+ * Failed logins
+ * Scans the journal (or /var/log/auth.log and /var/log/secure without one)
+ * for failed SSH logins and sudo passwords, counts them by source, and
+ * raises an alert when a source fails more often than the threshold within
+ * the window. Optionally the offending addresses are dropped for a while
+ * by an nftables set of daemira's own, except those on the allowlist.
+ */
+
+package systemhealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// failedLoginsAlert is the alert raised while sources are over the threshold
+const failedLoginsAlert = "failed-logins"
+
+// Default failed login policy
+const (
+	DefaultFailedLoginThreshold = 10
+	DefaultFailedLoginWindow    = time.Hour
+	DefaultBlockDuration        = 24 * time.Hour
+)
+
+// blockTable is the nftables table holding the blocked addresses
+const blockTable = "daemira"
+
+// blockTableSetup creates blockTable: two sets of addresses, dropped before
+// any other input rule, whose elements expire on their own. The root helper
+// runs each of these commands as it is.
+var blockTableSetup = [][]string{
+	{"nft", "add", "table", "inet", blockTable},
+	{"nft", "add", "set", "inet", blockTable, "blocked4", "{", "type", "ipv4_addr", ";", "flags", "timeout", ";", "}"},
+	{"nft", "add", "set", "inet", blockTable, "blocked6", "{", "type", "ipv6_addr", ";", "flags", "timeout", ";", "}"},
+	{"nft", "add", "chain", "inet", blockTable, "input", "{", "type", "filter", "hook", "input", "priority", "filter", "-", "10", ";", "policy", "accept", ";", "}"},
+	{"nft", "add", "rule", "inet", blockTable, "input", "ip", "saddr", "@blocked4", "drop"},
+	{"nft", "add", "rule", "inet", blockTable, "input", "ip6", "saddr", "@blocked6", "drop"},
+}
+
+// authLogs are read when there is no journal, Debian's and Fedora's
+var authLogs = []string{"/var/log/auth.log", "/var/log/secure"}
+
+// errJournalAccess is returned when the journal hides the system's entries
+var errJournalAccess = errors.New("can't read the system journal (add yourself to the systemd-journal group)")
+
+var (
+	// authLinePattern splits a log line into its time, program and message
+	authLinePattern = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d|\S+) \S+ ([\w.-]+)(?:\[\d+\])?: (.*)$`)
+	// sshFailedPattern matches a rejected password or key of an SSH login
+	sshFailedPattern = regexp.MustCompile(`^Failed \S+ for (invalid user )?(\S*) from (\S+) port`)
+	// sshInvalidUserPattern matches an SSH login as a user that doesn't exist
+	sshInvalidUserPattern = regexp.MustCompile(`^Invalid user (\S*) from (\S+)`)
+	// sudoFailedPattern matches sudo giving up after wrong passwords
+	sudoFailedPattern = regexp.MustCompile(`^\s*(\S+) : (\d+) incorrect password attempts?`)
+)
+
+// LoginPolicy decides when failed logins are reported and blocked
+type LoginPolicy struct {
+	Threshold     int           // failed attempts from one source within Window raising the alert; 0 disables
+	Window        time.Duration // Default: 1 hour
+	Block         bool          // drop addresses over the threshold with nftables
+	BlockDuration time.Duration // Default: 24 hours
+	Allowlist     []string      // addresses and CIDR ranges never blocked, besides loopback
+}
+
+// FailedLogins are the failed attempts of one source
+type FailedLogins struct {
+	Source   string   // the remote address for SSH, the user for sudo
+	Service  string   // "ssh" or "sudo"
+	Attempts int      // failed attempts
+	Users    []string // users tried
+	First    time.Time
+	Last     time.Time
+}
+
+// IsRemote reports whether the source is an address that can be blocked
+func (f FailedLogins) IsRemote() bool {
+	return net.ParseIP(f.Source) != nil
+}
+
+// BlockedAddress is an address dropped by the nftables set
+type BlockedAddress struct {
+	Address string
+	Expires time.Duration // time left
+}
+
+// SetLoginPolicy changes when failed logins are reported and blocked
+func (sm *SecurityMonitor) SetLoginPolicy(policy LoginPolicy) {
+	if policy.Window <= 0 {
+		policy.Window = DefaultFailedLoginWindow
+	}
+	if policy.BlockDuration <= 0 {
+		policy.BlockDuration = DefaultBlockDuration
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.policy = policy
+}
+
+// LoginPolicy returns when failed logins are reported and blocked
+func (sm *SecurityMonitor) LoginPolicy() LoginPolicy {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.policy
+}
+
+// CheckFailedLogins counts the failed logins within the window, raising an
+// alert for the sources over the threshold and blocking them if the policy
+// says so
+func (sm *SecurityMonitor) CheckFailedLogins(ctx context.Context) error {
+	policy := sm.LoginPolicy()
+	if policy.Threshold <= 0 {
+		utility.GetAlerts().Resolve(failedLoginsAlert)
+		return nil
+	}
+
+	logins, err := sm.ScanFailedLogins(ctx, time.Now().Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+
+	var offenders, sources []string
+	offending := make(map[string]bool)
+	for _, login := range logins {
+		if login.Attempts < policy.Threshold {
+			continue
+		}
+		key := login.Service + " " + login.Source
+		offending[key] = true
+		line := fmt.Sprintf("%s: %d failed %s logins", login.Source, login.Attempts, login.Service)
+		if login.Service == "ssh" {
+			line += " as " + strings.Join(login.Users, ", ")
+		}
+
+		sm.mu.Lock()
+		known := sm.offending[key]
+		sm.mu.Unlock()
+		if !known {
+			sm.logger.Warn("%s within %v", line, policy.Window)
+		}
+
+		switch {
+		case !policy.Block || !login.IsRemote():
+		case allowlisted(login.Source, policy.Allowlist):
+			line += " (allowlisted)"
+		default:
+			if err := sm.blockOnce(ctx, login.Source, policy.BlockDuration); err != nil {
+				sm.logger.Warn("Failed to block %s: %v", login.Source, err)
+			} else {
+				line += fmt.Sprintf(" (blocked for %v)", policy.BlockDuration)
+			}
+		}
+		offenders = append(offenders, line)
+		sources = append(sources, login.Source)
+	}
+
+	sm.mu.Lock()
+	sm.offending = offending
+	sm.mu.Unlock()
+
+	if len(offenders) == 0 {
+		utility.GetAlerts().Resolve(failedLoginsAlert)
+		return nil
+	}
+	summary := fmt.Sprintf("Repeated failed logins from %d sources", len(sources))
+	if len(sources) == 1 {
+		summary = "Repeated failed logins from " + sources[0]
+	}
+	utility.GetAlerts().Raise(failedLoginsAlert, utility.AlertWarning, summary, strings.Join(offenders, "; "))
+	return nil
+}
+
+// ScanFailedLogins counts the failed SSH logins and sudo passwords since a
+// time by source, most attempts first
+func (sm *SecurityMonitor) ScanFailedLogins(ctx context.Context, since time.Time) ([]FailedLogins, error) {
+	lines, err := sm.readAuthLog(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string]*FailedLogins)
+	record := func(service, source, user string, attempts int, at time.Time) {
+		key := service + " " + source
+		login, ok := bySource[key]
+		if !ok {
+			login = &FailedLogins{Source: source, Service: service, First: at}
+			bySource[key] = login
+		}
+		login.Attempts += attempts
+		login.Last = at
+		if user == "" {
+			user = `""`
+		}
+		for _, known := range login.Users {
+			if known == user {
+				return
+			}
+		}
+		login.Users = append(login.Users, user)
+	}
+
+	for _, line := range lines {
+		at, program, message, ok := parseAuthLine(line)
+		if !ok || at.Before(since) {
+			continue
+		}
+		switch program {
+		case "sshd", "sshd-session":
+			// An unknown user is counted once, from "Invalid user"
+			if match := sshFailedPattern.FindStringSubmatch(message); match != nil && match[1] == "" {
+				record("ssh", match[3], match[2], 1, at)
+			} else if match := sshInvalidUserPattern.FindStringSubmatch(message); match != nil {
+				record("ssh", match[2], match[1], 1, at)
+			}
+		case "sudo":
+			if match := sudoFailedPattern.FindStringSubmatch(message); match != nil {
+				attempts, _ := strconv.Atoi(match[2])
+				record("sudo", match[1], match[1], attempts, at)
+			}
+		}
+	}
+
+	logins := make([]FailedLogins, 0, len(bySource))
+	for _, login := range bySource {
+		logins = append(logins, *login)
+	}
+	sort.Slice(logins, func(i, j int) bool {
+		if logins[i].Attempts != logins[j].Attempts {
+			return logins[i].Attempts > logins[j].Attempts
+		}
+		return logins[i].Source < logins[j].Source
+	})
+	return logins, nil
+}
+
+// readAuthLog returns the sshd and sudo lines logged since a time, from the
+// journal or, without one, the auth log files
+func (sm *SecurityMonitor) readAuthLog(ctx context.Context, since time.Time) ([]string, error) {
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		result, err := sm.shell.ExecuteArgs(ctx, "journalctl", []string{
+			"--quiet", "--no-pager", "--output", "short-unix",
+			"--identifier", "sshd", "--identifier", "sshd-session", "--identifier", "sudo",
+			"--since", fmt.Sprintf("@%d", since.Unix()),
+		}, &utility.ExecOptions{Timeout: time.Minute, MaxOutputBytes: -1})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the journal: %w", err)
+		}
+		if strings.Contains(result.Stderr, "not seeing messages from other users and the system") {
+			return nil, errJournalAccess
+		}
+		if result.ExitCode == 0 {
+			return strings.Split(result.Stdout, "\n"), nil
+		}
+		// No journal on this machine (no systemd); try the log files
+	}
+
+	for _, path := range authLogs {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return strings.Split(string(data), "\n"), nil
+	}
+	return nil, fmt.Errorf("no journal or auth log to read (%s)", strings.Join(authLogs, ", "))
+}
+
+// parseAuthLine splits a journal (short-unix) or syslog line into its time,
+// program and message
+func parseAuthLine(line string) (time.Time, string, string, bool) {
+	match := authLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return time.Time{}, "", "", false
+	}
+	stamp := match[1]
+
+	if seconds, err := strconv.ParseFloat(stamp, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), match[2], match[3], true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700"} {
+		if at, err := time.Parse(layout, stamp); err == nil {
+			return at, match[2], match[3], true
+		}
+	}
+	// Classic syslog times have no year; a time ahead of now is last year's
+	at, err := time.ParseInLocation("Jan _2 15:04:05", stamp, time.Local)
+	if err != nil {
+		return time.Time{}, "", "", false
+	}
+	now := time.Now()
+	at = at.AddDate(now.Year(), 0, 0)
+	if at.After(now.Add(24 * time.Hour)) {
+		at = at.AddDate(-1, 0, 0)
+	}
+	return at, match[2], match[3], true
+}
+
+// allowlisted reports whether an address is loopback or on the allowlist
+func allowlisted(address string, allowlist []string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockOnce blocks an address unless this monitor blocked it already and
+// the block hasn't expired
+func (sm *SecurityMonitor) blockOnce(ctx context.Context, address string, duration time.Duration) error {
+	sm.mu.Lock()
+	until, blocked := sm.blocked[address]
+	sm.mu.Unlock()
+	if blocked && time.Now().Before(until) {
+		return nil
+	}
+
+	if err := sm.Block(ctx, address, duration); err != nil {
+		return err
+	}
+	sm.mu.Lock()
+	sm.blocked[address] = time.Now().Add(duration)
+	sm.mu.Unlock()
+	return nil
+}
+
+// Block drops an address for a while with daemira's nftables set
+func (sm *SecurityMonitor) Block(ctx context.Context, address string, duration time.Duration) error {
+	set, element, err := blockElement(address)
+	if err != nil {
+		return err
+	}
+	timeout := fmt.Sprintf("%ds", max(int(duration.Seconds()), 1))
+	add := []string{"nft", "add", "element", "inet", blockTable, set, "{", element, "timeout", timeout, "}"}
+	if err := sm.privileges.CanRun(ctx, add...); err != nil {
+		return fmt.Errorf("blocking needs root: %w", err)
+	}
+	if err := sm.ensureBlockTable(ctx); err != nil {
+		return err
+	}
+	if err := sm.runAll(ctx, nil, add); err != nil {
+		return err
+	}
+	sm.logger.Warn("Blocked %s for %v", address, duration)
+	return nil
+}
+
+// Unblock stops dropping an address
+func (sm *SecurityMonitor) Unblock(ctx context.Context, address string) error {
+	set, element, err := blockElement(address)
+	if err != nil {
+		return err
+	}
+	remove := []string{"nft", "delete", "element", "inet", blockTable, set, "{", element, "}"}
+	if err := sm.privileges.CanRun(ctx, remove...); err != nil {
+		return fmt.Errorf("unblocking needs root: %w", err)
+	}
+	if err := sm.runAll(ctx, nil, remove); err != nil {
+		return err
+	}
+	sm.mu.Lock()
+	delete(sm.blocked, address)
+	sm.mu.Unlock()
+	sm.logger.Info("Unblocked %s", address)
+	return nil
+}
+
+// Blocked lists the addresses daemira's nftables set drops
+func (sm *SecurityMonitor) Blocked(ctx context.Context) ([]BlockedAddress, error) {
+	if err := sm.privileges.CanRun(ctx, "nft", "--json", "list", "set", "inet", blockTable, "blocked4"); err != nil {
+		return nil, fmt.Errorf("listing blocked addresses needs root: %w", err)
+	}
+
+	var blocked []BlockedAddress
+	for _, set := range []string{"blocked4", "blocked6"} {
+		args := sm.privileges.Command("nft", "--json", "list", "set", "inet", blockTable, set)
+		result, err := sm.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{Timeout: 10 * time.Second, MaxOutputBytes: -1})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blocked addresses: %w", err)
+		}
+		if result.ExitCode != 0 {
+			// The table only exists once something was blocked
+			continue
+		}
+		var listing struct {
+			Nftables []struct {
+				Set *struct {
+					Elem []json.RawMessage `json:"elem"`
+				} `json:"set"`
+			} `json:"nftables"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &listing); err != nil {
+			return nil, fmt.Errorf("failed to parse nft output: %w", err)
+		}
+		for _, object := range listing.Nftables {
+			if object.Set == nil {
+				continue
+			}
+			for _, raw := range object.Set.Elem {
+				var element struct {
+					Elem struct {
+						Val     string `json:"val"`
+						Expires int64  `json:"expires"`
+					} `json:"elem"`
+				}
+				if err := json.Unmarshal(raw, &element); err == nil && element.Elem.Val != "" {
+					blocked = append(blocked, BlockedAddress{Address: element.Elem.Val, Expires: time.Duration(element.Elem.Expires) * time.Second})
+				}
+			}
+		}
+	}
+	return blocked, nil
+}
+
+// ensureBlockTable creates daemira's nftables table and its sets unless they
+// exist; the firewall's ruleset may have created the table without them
+func (sm *SecurityMonitor) ensureBlockTable(ctx context.Context) error {
+	args := sm.privileges.Command("nft", "list", "set", "inet", blockTable, "blocked4")
+	if result, err := sm.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{Timeout: 10 * time.Second}); err == nil && result.ExitCode == 0 {
+		return nil
+	}
+	return sm.runAll(ctx, nil, blockTableSetup...)
+}
+
+// blockElement returns the set an address goes in and the address as that
+// set takes it: an IPv4-mapped IPv6 address goes in blocked4 as IPv4
+func blockElement(address string) (set, element string, err error) {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return "", "", fmt.Errorf("invalid address %q", address)
+	case ip.To4() != nil:
+		return "blocked4", ip.To4().String(), nil
+	default:
+		return "blocked6", ip.String(), nil
+	}
+}
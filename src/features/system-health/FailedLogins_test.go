@@ -0,0 +1,62 @@
+package systemhealth
+
+import (
+	"testing"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+func TestBlockElement(t *testing.T) {
+	tests := []struct {
+		address, set, element string
+	}{
+		{"203.0.113.7", "blocked4", "203.0.113.7"},
+		{"::ffff:203.0.113.7", "blocked4", "203.0.113.7"},
+		{"2001:DB8::7", "blocked6", "2001:db8::7"},
+	}
+	for _, tt := range tests {
+		set, element, err := blockElement(tt.address)
+		if err != nil || set != tt.set || element != tt.element {
+			t.Errorf("blockElement(%q) = %q, %q, %v, want %q, %q", tt.address, set, element, err, tt.set, tt.element)
+		}
+		// The helper runs the commands blocking and unblocking it
+		add := []string{"nft", "add", "element", "inet", blockTable, set, "{", element, "timeout", "60s", "}"}
+		remove := []string{"nft", "delete", "element", "inet", blockTable, set, "{", element, "}"}
+		if !utility.RootHelperAllows(add) || !utility.RootHelperAllows(remove) {
+			t.Errorf("root helper refuses to block or unblock %q", tt.address)
+		}
+	}
+	if _, _, err := blockElement("203.0.113.0/24"); err == nil {
+		t.Error("blockElement() accepted a range")
+	}
+}
+
+func TestBlockTableSetupRunsInHelper(t *testing.T) {
+	for _, command := range blockTableSetup {
+		if !utility.RootHelperAllows(command) {
+			t.Errorf("root helper refuses %q", command)
+		}
+	}
+}
+
+func TestAllowlisted(t *testing.T) {
+	allowlist := []string{"100.64.0.0/10", "192.168.0.0/16", "198.51.100.9"}
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"100.101.102.103", true},
+		{"192.168.1.20", true},
+		{"::ffff:192.168.1.20", true},
+		{"198.51.100.9", true},
+		{"198.51.100.10", false},
+		{"203.0.113.7", false},
+	}
+	for _, tt := range tests {
+		if got := allowlisted(tt.address, allowlist); got != tt.want {
+			t.Errorf("allowlisted(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
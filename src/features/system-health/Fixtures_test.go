@@ -0,0 +1,36 @@
+/**
+ * Fixtures - Output of /proc, /sys and system tools for utility.FakeRunner
+ * Results as the files and tools print them, trimmed to what daemira
+ * parses, e.g.
+ *   utility.NewFakeRunner().On(`^cat /proc/meminfo`, fixtureMeminfo)
+ */
+
+package systemhealth
+
+import "github.com/ln64-git/daemira/src/utility"
+
+var (
+	fixtureMeminfo = utility.Result{Stdout: "MemTotal:       32585472 kB\nMemFree:         9823744 kB\nMemAvailable:   21154816 kB\nBuffers:          412160 kB\nCached:         11325440 kB\n" +
+		"SwapCached:            0 kB\nSwapTotal:      16292860 kB\nSwapFree:       16292860 kB"}
+
+	fixtureSwappiness = utility.Result{Stdout: "60"}
+
+	fixtureDiskUsage = utility.Result{Stdout: "/dev/nvme0n1p2 /          btrfs 998579896320 612839505920 384124112896  62%\n" +
+		"/dev/nvme0n1p1 /boot      vfat     1071624192    287182848    784441344  27%\n" +
+		"/dev/sda1      /mnt/data  ext4  3936818806784 3851046494208  85772312576  98%"}
+
+	fixtureDisks = utility.Result{Stdout: "/dev/nvme0n1\n/dev/sda\n/dev/sdc"}
+
+	fixtureSmartPassed = utility.Result{Stdout: "smartctl 7.4 2023-08-01 r5530 [x86_64-linux-6.12.4-arch1-1] (local build)\n\n=== START OF READ SMART DATA SECTION ===\nSMART overall-health self-assessment test result: PASSED"}
+
+	fixtureSmartFailed = utility.Result{ExitCode: 8, Stdout: "smartctl 7.4 2023-08-01 r5530 [x86_64-linux-6.12.4-arch1-1] (local build)\n\n=== START OF READ SMART DATA SECTION ===\nSMART overall-health self-assessment test result: FAILED!\nDrive failure expected in less than 24 hours. SAVE ALL DATA."}
+
+	fixtureSmartNvme = utility.Result{Stdout: "=== START OF SMART DATA SECTION ===\nSMART overall-health self-assessment test result: PASSED\n\n" +
+		"SMART/Health Information (NVMe Log 0x02)\nCritical Warning:                   0x00\nTemperature:                        41 Celsius\nAvailable Spare:                    100%\nPercentage Used:                    2%"}
+
+	fixturePowerProfile = utility.Result{Stdout: "balanced"}
+
+	fixturePowerProfiles = utility.Result{Stdout: "  performance:\n    CpuDriver:\tamd_pstate\n    PlatformDriver:\tplatform_profile\n    Degraded:   no\n\n" +
+		"* balanced:\n    CpuDriver:\tamd_pstate\n    PlatformDriver:\tplatform_profile\n\n" +
+		"  power-saver:\n    CpuDriver:\tamd_pstate\n    PlatformDriver:\tplatform_profile"}
+)
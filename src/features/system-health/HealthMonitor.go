@@ -0,0 +1,338 @@
+/**
+ * Health monitor
+ * Periodically checks disk space while the daemon runs and logs when a disk
+ * crosses the warning or critical free-space threshold, and when it recovers.
+ * Low disks, disks failing SMART (checked daily), no active firewall
+ * (checked hourly), repeated failed logins, watched config files changed
+ * outside daemira, SSH key problems (checked hourly), boots much slower
+ * than usual, and missing kernel parameters or microcode (checked daily) are
+ * raised as alerts.
+ */
+
+package systemhealth
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// HealthMonitorOptions configures the health monitor
+type HealthMonitorOptions struct {
+	Interval time.Duration // Default: 60 seconds
+}
+
+// HealthMonitor runs periodic health checks
+type HealthMonitor struct {
+	logger    *utility.Logger
+	disk      *DiskMonitor
+	interval  time.Duration
+	levels    map[string]string // last reported level per mount point
+	isRunning bool
+	mu        sync.Mutex
+}
+
+// healthCheckJob is the scheduler job running the checks
+const healthCheckJob = "health-check"
+
+// smartCheckJob is the scheduler job checking the disks' SMART health
+const smartCheckJob = "smart-check"
+
+// smartCheckInterval is how often SMART health is checked
+const smartCheckInterval = 24 * time.Hour
+
+// firewallCheckJob is the scheduler job checking that a firewall is active
+const firewallCheckJob = "firewall-check"
+
+// firewallCheckInterval is how often the firewall is checked
+const firewallCheckInterval = time.Hour
+
+// loginCheckJob is the scheduler job counting failed logins
+const loginCheckJob = "login-check"
+
+// loginCheckInterval is how often failed logins are counted
+const loginCheckInterval = 5 * time.Minute
+
+// integrityCheckJob is the scheduler job checking the watched config files
+const integrityCheckJob = "integrity-check"
+
+// integrityCheckInterval is how often the watched config files are checked
+const integrityCheckInterval = 15 * time.Minute
+
+// sshCheckJob is the scheduler job checking SSH keys and the agent
+const sshCheckJob = "ssh-check"
+
+// sshCheckInterval is how often SSH keys and the agent are checked
+const sshCheckInterval = time.Hour
+
+// bootCheckJob is the scheduler job recording the boot time
+const bootCheckJob = "boot-check"
+
+// bootCheckInterval is how often a boot still starting units is checked
+// again; a recorded boot isn't analyzed again
+const bootCheckInterval = 10 * time.Minute
+
+// kernelCheckJob is the scheduler job checking kernel parameters and microcode
+const kernelCheckJob = "kernel-check"
+
+// kernelCheckInterval is how often kernel parameters and microcode are checked
+const kernelCheckInterval = 24 * time.Hour
+
+// healthState is the state store section keeping the reported levels
+const healthState = "health"
+
+// NewHealthMonitor creates a new HealthMonitor instance
+func NewHealthMonitor(logger *utility.Logger, options *HealthMonitorOptions) *HealthMonitor {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	interval := 60 * time.Second
+	if options != nil && options.Interval > 0 {
+		interval = options.Interval
+	}
+
+	hm := &HealthMonitor{
+		logger:   logger.With("health"),
+		disk:     GetDiskMonitor(),
+		interval: interval,
+		levels:   make(map[string]string),
+	}
+	// Disks already reported before a restart aren't reported again
+	utility.GetStateStore().Load(healthState, &hm.levels)
+	if hm.levels == nil {
+		hm.levels = make(map[string]string)
+	}
+	return hm
+}
+
+// Start checks health now and then every interval
+func (hm *HealthMonitor) Start() {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	if hm.isRunning {
+		hm.logger.Warn("Health monitor already running")
+		return
+	}
+
+	hm.isRunning = true
+	hm.logger.Info("Starting health monitor (interval: %v)", hm.interval)
+
+	utility.GetScheduler().Add(utility.Job{
+		ID:          healthCheckJob,
+		Description: "Check free disk space",
+		Schedule:    utility.Every(hm.interval),
+		RunAtStart:  true,
+		Run:         hm.check,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          smartCheckJob,
+		Description: "Check the disks' SMART health",
+		Schedule:    utility.Every(smartCheckInterval),
+		Jitter:      10 * time.Minute,
+		RunAtStart:  true,
+		Run:         hm.checkSmart,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          firewallCheckJob,
+		Description: "Check that a firewall is active",
+		Schedule:    utility.Every(firewallCheckInterval),
+		Jitter:      time.Minute,
+		RunAtStart:  true,
+		Run:         hm.checkFirewall,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          loginCheckJob,
+		Description: "Count failed SSH and sudo logins, blocking repeat offenders if configured",
+		Schedule:    utility.Every(loginCheckInterval),
+		RunAtStart:  true,
+		Run:         GetSecurityMonitor().CheckFailedLogins,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          integrityCheckJob,
+		Description: "Check the watched config files against their recorded checksums",
+		Schedule:    utility.Every(integrityCheckInterval),
+		Jitter:      time.Minute,
+		RunAtStart:  true,
+		Run:         GetIntegrityMonitor().Check,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          sshCheckJob,
+		Description: "Check SSH key passphrases, permissions and certificates, and the agent's identities",
+		Schedule:    utility.Every(sshCheckInterval),
+		Jitter:      time.Minute,
+		RunAtStart:  true,
+		Run:         GetSSHMonitor().Check,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          bootCheckJob,
+		Description: "Record how long the boot took and report regressions",
+		Schedule:    utility.Every(bootCheckInterval),
+		RunAtStart:  true,
+		Run:         GetBootMonitor().Record,
+	})
+	utility.GetScheduler().Add(utility.Job{
+		ID:          kernelCheckJob,
+		Description: "Check the kernel parameters and that microcode is loaded",
+		Schedule:    utility.Every(kernelCheckInterval),
+		Jitter:      10 * time.Minute,
+		RunAtStart:  true,
+		Run:         GetKernelMonitor().Check,
+	})
+}
+
+// Stop halts the periodic checks
+func (hm *HealthMonitor) Stop() {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	if !hm.isRunning {
+		return
+	}
+
+	hm.isRunning = false
+	utility.GetScheduler().Remove(healthCheckJob)
+	utility.GetScheduler().Remove(smartCheckJob)
+	utility.GetScheduler().Remove(firewallCheckJob)
+	utility.GetScheduler().Remove(loginCheckJob)
+	utility.GetScheduler().Remove(integrityCheckJob)
+	utility.GetScheduler().Remove(sshCheckJob)
+	utility.GetScheduler().Remove(bootCheckJob)
+	utility.GetScheduler().Remove(kernelCheckJob)
+	hm.logger.Info("Health monitor stopped")
+}
+
+// SetInterval changes the check interval of a running monitor
+func (hm *HealthMonitor) SetInterval(interval time.Duration) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	if interval <= 0 || interval == hm.interval {
+		return
+	}
+
+	hm.interval = interval
+	if hm.isRunning {
+		utility.GetScheduler().Reschedule(healthCheckJob, utility.Every(interval))
+	}
+	hm.logger.Info("Health monitor interval changed to %v", interval)
+}
+
+// check logs disks whose free-space level changed since the last check
+func (hm *HealthMonitor) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	warnings, err := hm.disk.CheckLowSpace(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check disk space: %w", err)
+	}
+
+	current := make(map[string]string, len(warnings))
+	for _, warning := range warnings {
+		current[warning.MountPoint] = warning.Level
+	}
+
+	alerts := utility.GetAlerts()
+	raised := make(map[string]bool, len(warnings))
+	for _, warning := range warnings {
+		id := diskAlertID(warning.MountPoint)
+		raised[id] = true
+		alerts.Raise(id, warning.Level, fmt.Sprintf("Low disk space on %s", warning.MountPoint), warning.Message)
+	}
+	for _, alert := range alerts.List() {
+		if strings.HasPrefix(alert.ID, "disk-") && !raised[alert.ID] {
+			alerts.Resolve(alert.ID)
+		}
+	}
+
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+
+	for _, warning := range warnings {
+		if hm.levels[warning.MountPoint] == warning.Level {
+			continue
+		}
+		if warning.Level == "critical" {
+			hm.logger.Error("%s", warning.Message)
+		} else {
+			hm.logger.Warn("%s", warning.Message)
+		}
+	}
+	changed := len(current) != len(hm.levels)
+	for mountPoint, level := range hm.levels {
+		if current[mountPoint] != level {
+			changed = true
+		}
+		if _, ok := current[mountPoint]; !ok {
+			hm.logger.Info("%s has enough free space again", mountPoint)
+		}
+	}
+	hm.levels = current
+	if changed {
+		utility.GetStateStore().Save(healthState, current)
+	}
+	return nil
+}
+
+// checkSmart raises an alert for each disk failing its SMART check or
+// reporting errors, and resolves those that pass again
+func (hm *HealthMonitor) checkSmart(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	statuses, err := hm.disk.GetAllSmartStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check SMART health: %w", err)
+	}
+
+	alerts := utility.GetAlerts()
+	for _, status := range statuses {
+		id := "smart-" + filepath.Base(status.Device)
+		switch {
+		case !status.Passed:
+			alerts.Raise(id, utility.AlertCritical, fmt.Sprintf("%s failed its SMART check", status.Device),
+				"Back up its data and replace the disk. Details: sudo smartctl -a "+status.Device)
+		case len(status.Errors) > 0:
+			alerts.Raise(id, utility.AlertWarning, fmt.Sprintf("%s reports SMART errors", status.Device), strings.Join(status.Errors, "; "))
+		default:
+			alerts.Resolve(id)
+		}
+	}
+	return nil
+}
+
+// checkFirewall raises an alert while no firewall is active
+func (hm *HealthMonitor) checkFirewall(ctx context.Context) error {
+	status, err := GetSecurityMonitor().GetFirewallStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Active != "" {
+		utility.GetAlerts().Resolve("firewall")
+		return nil
+	}
+	detail := "Enable one with: daemira security firewall enable"
+	if len(status.Installed) == 0 {
+		detail = "Install ufw, firewalld or nftables, then run: daemira security firewall enable"
+	}
+	utility.GetAlerts().Raise("firewall", utility.AlertWarning, "No firewall is active", detail)
+	return nil
+}
+
+// diskAlertID names the low space alert of a mount point, e.g. "disk-home"
+// for /home and "disk-root" for /
+func diskAlertID(mountPoint string) string {
+	name := strings.ReplaceAll(strings.Trim(mountPoint, "/"), "/", "-")
+	if name == "" {
+		name = "root"
+	}
+	return "disk-" + name
+}
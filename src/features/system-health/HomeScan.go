@@ -0,0 +1,242 @@
+/**
+ * Home directory scanner
+ * Walks the home directory for files owned by someone other than its owner
+ * (typically left by commands run as root, daemira included), files and
+ * directories anyone can write to, and symlinks to nothing. Owners and
+ * modes can be put back; dangling links are only reported, since what they
+ * pointed to may come back (e.g. an unmounted drive). The walk stays on the
+ * home directory's filesystem and skips rootless container storage, whose
+ * files belong to the user's subordinate IDs.
+ */
+
+package systemhealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Kinds of home directory findings
+const (
+	HomeWrongOwner    = "owner"
+	HomeWorldWritable = "world-writable"
+	HomeDanglingLink  = "dangling-link"
+)
+
+// homeScanSkip are directories under home not scanned
+var homeScanSkip = []string{
+	".local/share/containers", // podman's rootless storage, owned by subordinate IDs
+	".local/share/docker",     // rootless docker's
+}
+
+// HomeFinding is a file the scan found wrong
+type HomeFinding struct {
+	Path   string
+	Kind   string
+	UID    uint32      // owner, for HomeWrongOwner
+	Mode   os.FileMode // for HomeWorldWritable
+	Target string      // for HomeDanglingLink
+}
+
+// Describe says what is wrong, e.g. "owned by root"
+func (f HomeFinding) Describe() string {
+	switch f.Kind {
+	case HomeWrongOwner:
+		return "owned by " + userName(f.UID)
+	case HomeWorldWritable:
+		return fmt.Sprintf("writable by anyone (%s)", f.Mode)
+	case HomeDanglingLink:
+		return "points to missing " + f.Target
+	}
+	return f.Kind
+}
+
+// HomeScan is what a scan of a home directory found
+type HomeScan struct {
+	Root       string
+	UID, GID   uint32 // the home directory's owner, which its files should have
+	Findings   []HomeFinding
+	Scanned    int
+	Unreadable []string // directories the walk couldn't enter
+	Duration   time.Duration
+}
+
+// Owner returns the name of the user the files should belong to
+func (s *HomeScan) Owner() string {
+	return userName(s.UID)
+}
+
+// Count returns the number of findings of a kind
+func (s *HomeScan) Count(kind string) int {
+	count := 0
+	for _, finding := range s.Findings {
+		if finding.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// ScanHome walks root (the home directory unless given) for files with the
+// wrong owner, writable by anyone, or dangling symlinks
+func ScanHome(ctx context.Context, root string) (*HomeScan, error) {
+	if root == "" {
+		var err error
+		if root, err = os.UserHomeDir(); err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, fmt.Errorf("can't read the owner of %s", root)
+	}
+
+	scan := &HomeScan{Root: root, UID: stat.Uid, GID: stat.Gid}
+	rootDev := uint64(stat.Dev)
+	start := time.Now()
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// A directory that can't be read is still checked itself
+			if path != root && (errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist)) {
+				if entry != nil && entry.IsDir() {
+					scan.Unreadable = append(scan.Unreadable, path)
+				}
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && path != root && skipHomeDir(root, path) {
+			return filepath.SkipDir
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since its directory was read
+			return nil
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		// Other filesystems mounted under home are theirs to get right
+		if entry.IsDir() && uint64(stat.Dev) != rootDev {
+			return filepath.SkipDir
+		}
+		scan.Scanned++
+
+		if stat.Uid != scan.UID {
+			scan.Findings = append(scan.Findings, HomeFinding{Path: path, Kind: HomeWrongOwner, UID: stat.Uid})
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+				target, _ := os.Readlink(path)
+				scan.Findings = append(scan.Findings, HomeFinding{Path: path, Kind: HomeDanglingLink, Target: target})
+			}
+			return nil
+		}
+		if info.Mode().Perm()&0002 != 0 {
+			scan.Findings = append(scan.Findings, HomeFinding{Path: path, Kind: HomeWorldWritable, Mode: info.Mode()})
+		}
+		return nil
+	})
+	scan.Duration = time.Since(start)
+	return scan, err
+}
+
+// skipHomeDir reports whether a directory under root is left out of scans
+func skipHomeDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for _, skip := range homeScanSkip {
+		if rel == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// userName returns the name of the user with uid, or the uid if unknown
+func userName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// FixHome gives the files of the wrong owner back to the home directory's
+// owner (through sudo unless running as root), then takes write access for
+// others away. Dangling links are left alone. It returns how many files
+// were fixed.
+func FixHome(ctx context.Context, scan *HomeScan) (int, error) {
+	var chown, chmod []string
+	for _, finding := range scan.Findings {
+		switch finding.Kind {
+		case HomeWrongOwner:
+			chown = append(chown, finding.Path)
+		case HomeWorldWritable:
+			chmod = append(chmod, finding.Path)
+		}
+	}
+
+	shell := utility.NewShell(utility.GetLogger())
+	fixed := 0
+	if len(chown) > 0 {
+		privileges := utility.GetPrivilegeManager()
+		if err := privileges.Validate(ctx); err != nil {
+			return 0, fmt.Errorf("giving files back to %s needs root: %w", userName(scan.UID), err)
+		}
+		argv := privileges.Command("chown", "-h", fmt.Sprintf("%d:%d", scan.UID, scan.GID), "--")
+		count, err := changeFiles(ctx, shell, argv, chown, "owner set back to "+userName(scan.UID)+" by security scan-home")
+		fixed += count
+		if err != nil {
+			return fixed, err
+		}
+	}
+	// The files are the user's now, so their modes need no sudo
+	count, err := changeFiles(ctx, shell, []string{"chmod", "o-w", "--"}, chmod, "write access for others removed by security scan-home")
+	return fixed + count, err
+}
+
+// changeFiles runs argv on the paths, in batches that keep the command line
+// within limits, and audits each change
+func changeFiles(ctx context.Context, shell *utility.Shell, argv, paths []string, detail string) (int, error) {
+	const batchSize = 500
+	changed := 0
+	for start := 0; start < len(paths); start += batchSize {
+		batch := paths[start:min(start+batchSize, len(paths))]
+		args := append(append([]string{}, argv[1:]...), batch...)
+		result, err := shell.ExecuteArgs(ctx, argv[0], args, &utility.ExecOptions{Timeout: 5 * time.Minute})
+		if err != nil {
+			return changed, fmt.Errorf("failed to run %s: %w", argv[0], err)
+		}
+		if result.ExitCode != 0 {
+			return changed, fmt.Errorf("%s: %s", strings.Join(argv, " "), strings.TrimSpace(result.Stderr))
+		}
+		for _, path := range batch {
+			utility.Audit(utility.AuditPermissions, path, detail)
+		}
+		changed += len(batch)
+	}
+	return changed, nil
+}
@@ -0,0 +1,622 @@
+/**
+ * Integrity checker
+ * Records the checksums and modes of watched config files (sudoers
+ * drop-ins, the daemira unit and the Hyprland config by default) and raises
+ * an alert when one is changed, added or removed by something other than
+ * daemira. What daemira writes itself is in the audit log and taken into
+ * the record on its own; other changes stay reported until accepted.
+ * Copies of the recorded files are kept in the state directory for diffs.
+ * Root-only files are read through sudo when it needs no password.
+ */
+
+package systemhealth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// integrityAlert is the alert raised while watched files changed
+const integrityAlert = "integrity"
+
+// integrityState is the state store section keeping the record
+const integrityState = "integrity"
+
+// maxIntegrityCopy is the largest file a copy is kept of for diffs
+const maxIntegrityCopy = 1 << 20
+
+// Kinds of integrity changes
+const (
+	IntegrityModified = "modified"
+	IntegrityAdded    = "added"
+	IntegrityRemoved  = "removed"
+)
+
+var (
+	// hashLinePattern matches a line of sha256sum's output
+	hashLinePattern = regexp.MustCompile(`^([0-9a-f]{64})  (.+)$`)
+	// modeLinePattern matches a line of find's "%m %p" output
+	modeLinePattern = regexp.MustCompile(`^([0-7]{1,4}) (.+)$`)
+)
+
+// IntegrityFile is the recorded state of a watched file
+type IntegrityFile struct {
+	Hash     string      `json:"hash"` // sha256 of the content
+	Mode     os.FileMode `json:"mode"`
+	Recorded time.Time   `json:"recorded"`
+}
+
+// IntegrityChange is a watched file that differs from its record
+type IntegrityChange struct {
+	Path     string    `json:"path"`
+	Kind     string    `json:"kind"`             // IntegrityModified, IntegrityAdded or IntegrityRemoved
+	Detail   string    `json:"detail,omitempty"` // what was modified, e.g. "mode 0440 -> 0644"
+	Detected time.Time `json:"detected"`
+}
+
+// IntegrityStatus is what the last check found
+type IntegrityStatus struct {
+	Paths      []string
+	Files      int // files recorded
+	Changes    []IntegrityChange
+	Unreadable []string // watched paths that need root without passwordless sudo
+	Checked    time.Time
+}
+
+// integrityRecord is the state kept across restarts
+type integrityRecord struct {
+	Roots      []string                 `json:"roots"` // the watched paths the files were recorded for
+	Files      map[string]IntegrityFile `json:"files"`
+	Changes    []IntegrityChange        `json:"changes"` // changes not made by daemira at the last check
+	Unreadable []string                 `json:"unreadable"`
+	Checked    time.Time                `json:"checked"`
+}
+
+// IntegrityMonitor records watched files and reports changes to them
+type IntegrityMonitor struct {
+	logger     *utility.Logger
+	shell      utility.CommandRunner
+	privileges *utility.PrivilegeManager
+	paths      []string
+	record     integrityRecord
+	mu         sync.Mutex
+}
+
+var (
+	integrityMonitorInstance *IntegrityMonitor
+	integrityMonitorOnce     sync.Once
+)
+
+// GetIntegrityMonitor returns the singleton IntegrityMonitor instance
+func GetIntegrityMonitor() *IntegrityMonitor {
+	integrityMonitorOnce.Do(func() {
+		im := &IntegrityMonitor{
+			logger:     utility.GetLogger().With("integrity"),
+			shell:      utility.NewShell(utility.GetLogger()),
+			privileges: utility.GetPrivilegeManager(),
+		}
+		utility.GetStateStore().Load(integrityState, &im.record)
+		im.paths = append([]string{}, im.record.Roots...)
+		integrityMonitorInstance = im
+	})
+	return integrityMonitorInstance
+}
+
+// SetPaths sets the files and directories watched
+func (im *IntegrityMonitor) SetPaths(paths []string) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.paths = append([]string{}, paths...)
+}
+
+// Status returns what the last check found
+func (im *IntegrityMonitor) Status() IntegrityStatus {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return IntegrityStatus{
+		Paths:      append([]string{}, im.paths...),
+		Files:      len(im.record.Files),
+		Changes:    append([]IntegrityChange{}, im.record.Changes...),
+		Unreadable: append([]string{}, im.record.Unreadable...),
+		Checked:    im.record.Checked,
+	}
+}
+
+// Check compares the watched files with their record. Files never recorded
+// are recorded, changes daemira made are taken into the record, and the
+// others are raised as an alert.
+func (im *IntegrityMonitor) Check(ctx context.Context) error {
+	im.mu.Lock()
+	paths := append([]string{}, im.paths...)
+	im.mu.Unlock()
+
+	files, unreadable, err := im.scan(ctx, paths)
+	if err != nil {
+		return err
+	}
+	audit, err := utility.ReadAudit()
+	if err != nil {
+		im.logger.Warn("Changes made by daemira can't be told apart: %v", err)
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	now := time.Now()
+	record := &im.record
+	if record.Files == nil {
+		record.Files = make(map[string]IntegrityFile)
+	}
+	// Files under paths watched for the first time are only recorded
+	var newRoots []string
+	for _, path := range paths {
+		if !containsString(record.Roots, path) {
+			newRoots = append(newRoots, path)
+		}
+	}
+
+	changes := compareIntegrity(record.Files, files, paths, unreadable)
+	var unexpected []IntegrityChange
+	recorded := 0
+	for _, change := range changes {
+		since := record.Checked
+		if old, ok := record.Files[change.Path]; ok {
+			since = old.Recorded
+		}
+		switch {
+		case change.Kind == IntegrityAdded && underAny(change.Path, newRoots):
+			recorded++
+		case changedByDaemira(audit, change.Path, since):
+			im.logger.Info("%s %s by daemira; recorded", change.Path, change.Kind)
+		default:
+			change.Detected = now
+			for _, known := range record.Changes {
+				if known.Path == change.Path && known.Kind == change.Kind {
+					change.Detected = known.Detected
+				}
+			}
+			if change.Detected.Equal(now) {
+				im.logger.Warn("%s was %s outside daemira", change.Path, change.Kind)
+			}
+			unexpected = append(unexpected, change)
+			continue
+		}
+		im.accept(ctx, change.Path, files, now)
+	}
+	// Files under paths no longer watched are forgotten
+	for path := range record.Files {
+		if !underAny(path, paths) {
+			delete(record.Files, path)
+		}
+	}
+	if recorded > 0 {
+		im.logger.Info("Recorded the checksums of %d files", recorded)
+	}
+
+	for _, path := range unreadable {
+		if !containsString(record.Unreadable, path) {
+			im.logger.Warn("Can't read %s without root (sudo needs a password); it isn't checked", path)
+		}
+	}
+
+	// Unreadable paths count as new once they can be read
+	roots := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !containsString(unreadable, path) {
+			roots = append(roots, path)
+		}
+	}
+	record.Roots = roots
+	record.Changes = unexpected
+	record.Unreadable = unreadable
+	record.Checked = now
+	im.save()
+	im.alert()
+	return nil
+}
+
+// Accept takes the current state of changed files into the record: those
+// at or under the given paths, or all of them without any
+func (im *IntegrityMonitor) Accept(ctx context.Context, paths []string) ([]IntegrityChange, error) {
+	im.mu.Lock()
+	watched := append([]string{}, im.paths...)
+	im.mu.Unlock()
+
+	files, _, err := im.scan(ctx, watched)
+	if err != nil {
+		return nil, err
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	now := time.Now()
+	var accepted, remaining []IntegrityChange
+	for _, change := range im.record.Changes {
+		if len(paths) > 0 && !underAny(change.Path, paths) {
+			remaining = append(remaining, change)
+			continue
+		}
+		im.accept(ctx, change.Path, files, now)
+		accepted = append(accepted, change)
+	}
+	if len(accepted) == 0 {
+		return nil, fmt.Errorf("no changed files to accept")
+	}
+	for _, change := range accepted {
+		im.logger.Info("Accepted %s %s", change.Kind, change.Path)
+	}
+	im.record.Changes = remaining
+	im.save()
+	im.alert()
+	return accepted, nil
+}
+
+// Diff shows how a watched file differs from its recorded copy
+func (im *IntegrityMonitor) Diff(ctx context.Context, path string) (string, error) {
+	im.mu.Lock()
+	old, recorded := im.record.Files[path]
+	im.mu.Unlock()
+
+	before := os.DevNull
+	if recorded {
+		before = integrityCopyPath(old.Hash)
+		if _, err := os.Stat(before); err != nil {
+			return fmt.Sprintf("%s: no copy of the recorded content (sha256 %s, mode %04o)\n", path, old.Hash, old.Mode.Perm()), nil
+		}
+	}
+
+	after := os.DevNull
+	data, err := im.readFile(ctx, path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return "", err
+	default:
+		file, err := os.CreateTemp("", "daemira-integrity-*")
+		if err != nil {
+			return "", fmt.Errorf("failed to write %s for diffing: %w", path, err)
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to write %s for diffing: %w", path, err)
+		}
+		after = file.Name()
+	}
+
+	result, err := im.shell.ExecuteArgs(ctx, "diff", []string{
+		"-u", "--label", "recorded " + path, "--label", "current " + path, before, after,
+	}, &utility.ExecOptions{Timeout: 30 * time.Second, MaxOutputBytes: -1})
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s: %w", path, err)
+	}
+	// diff exits with 1 when the files differ
+	if result.ExitCode > 1 {
+		return "", fmt.Errorf("failed to diff %s: %s", path, strings.TrimSpace(result.Stderr))
+	}
+	return result.Stdout, nil
+}
+
+// accept records the current state of a file, or forgets it if it is gone;
+// the caller holds mu
+func (im *IntegrityMonitor) accept(ctx context.Context, path string, files map[string]IntegrityFile, now time.Time) {
+	file, ok := files[path]
+	if !ok {
+		delete(im.record.Files, path)
+		return
+	}
+	file.Recorded = now
+	im.record.Files[path] = file
+	if err := im.saveCopy(ctx, path, file.Hash); err != nil {
+		im.logger.Debug("No copy of %s for diffs: %v", path, err)
+	}
+}
+
+// alert raises the integrity alert while there are changes, critical when
+// a file in /etc changed; the caller holds mu
+func (im *IntegrityMonitor) alert() {
+	changes := im.record.Changes
+	if len(changes) == 0 {
+		utility.GetAlerts().Resolve(integrityAlert)
+		return
+	}
+
+	severity := utility.AlertWarning
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if strings.HasPrefix(change.Path, "/etc/") {
+			severity = utility.AlertCritical
+		}
+		line := change.Path + " " + change.Kind
+		if change.Detail != "" && change.Detail != "content" {
+			line += " (" + change.Detail + ")"
+		}
+		lines = append(lines, line)
+	}
+	summary := fmt.Sprintf("%d watched files changed outside daemira", len(changes))
+	if len(changes) == 1 {
+		summary = fmt.Sprintf("%s was %s outside daemira", changes[0].Path, changes[0].Kind)
+	}
+	detail := strings.Join(lines, "; ") + ". Review with: daemira security integrity diff, then accept with: daemira security integrity accept"
+	utility.GetAlerts().Raise(integrityAlert, severity, summary, detail)
+}
+
+// save writes the record and removes copies nothing refers to any more;
+// the caller holds mu
+func (im *IntegrityMonitor) save() {
+	utility.GetStateStore().Save(integrityState, im.record)
+	if !utility.GetStateStore().Persists() {
+		return
+	}
+
+	hashes := make(map[string]bool, len(im.record.Files))
+	for _, file := range im.record.Files {
+		hashes[file.Hash] = true
+	}
+	entries, err := os.ReadDir(integrityCopyDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !hashes[entry.Name()] {
+			os.Remove(filepath.Join(integrityCopyDir(), entry.Name()))
+		}
+	}
+}
+
+// saveCopy keeps a copy of a file's content for diffs unless one exists
+func (im *IntegrityMonitor) saveCopy(ctx context.Context, path, hash string) error {
+	if !utility.GetStateStore().Persists() {
+		return nil
+	}
+	copyPath := integrityCopyPath(hash)
+	if _, err := os.Stat(copyPath); err == nil {
+		return nil
+	}
+	data, err := im.readFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxIntegrityCopy {
+		return fmt.Errorf("larger than %d bytes", maxIntegrityCopy)
+	}
+	if _, err := utility.EnsureDir(integrityCopyDir()); err != nil {
+		return err
+	}
+	return os.WriteFile(copyPath, data, 0600)
+}
+
+// scan returns the checksums and modes of the regular files at or under
+// the paths, and the paths that need root to read
+func (im *IntegrityMonitor) scan(ctx context.Context, paths []string) (map[string]IntegrityFile, []string, error) {
+	files := make(map[string]IntegrityFile)
+	var unreadable []string
+	for _, root := range paths {
+		err := scanDirect(root, files)
+		if errors.Is(err, fs.ErrPermission) {
+			err = im.scanPrivileged(ctx, root, files)
+			if errors.Is(err, utility.ErrNeedsPassword) {
+				unreadable = append(unreadable, root)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check %s: %w", root, err)
+		}
+	}
+	return files, unreadable, nil
+}
+
+// scanDirect adds the files at or under root to files, following links to
+// files but not to directories
+func scanDirect(root string, files map[string]IntegrityFile) error {
+	scanned := make(map[string]IntegrityFile)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // a dangling link
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		scanned[path] = IntegrityFile{Hash: hash, Mode: info.Mode().Perm()}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for path, file := range scanned {
+		files[path] = file
+	}
+	return nil
+}
+
+// scanPrivileged adds the files at or under root to files, listing and
+// hashing them as root
+func (im *IntegrityMonitor) scanPrivileged(ctx context.Context, root string, files map[string]IntegrityFile) error {
+	if err := im.privileges.Validate(ctx); err != nil {
+		return err
+	}
+	args := im.privileges.Command("find", "-L", root, "-type", "f", "-printf", `%m %p\n`, "-exec", "sha256sum", "{}", "+")
+	result, err := im.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{
+		Timeout:        time.Minute,
+		MaxOutputBytes: -1,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		if strings.Contains(result.Stderr, "No such file") {
+			return nil
+		}
+		return fmt.Errorf("find: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	modes := make(map[string]os.FileMode)
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(result.Stdout))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := hashLinePattern.FindStringSubmatch(line); match != nil {
+			hashes[match[2]] = match[1]
+		} else if match := modeLinePattern.FindStringSubmatch(line); match != nil {
+			mode, _ := strconv.ParseUint(match[1], 8, 32)
+			modes[match[2]] = os.FileMode(mode)
+		}
+	}
+	for path, hash := range hashes {
+		files[path] = IntegrityFile{Hash: hash, Mode: modes[path]}
+	}
+	return nil
+}
+
+// readFile reads a file, as root if only root may
+func (im *IntegrityMonitor) readFile(ctx context.Context, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if !errors.Is(err, fs.ErrPermission) {
+		return data, err
+	}
+	if err := im.privileges.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("reading %s needs root: %w", path, err)
+	}
+	args := im.privileges.Command("cat", "--", path)
+	result, err := im.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{
+		Timeout:        30 * time.Second,
+		MaxOutputBytes: -1,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		if strings.Contains(result.Stderr, "No such file") {
+			return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to read %s: %s", path, strings.TrimSpace(result.Stderr))
+	}
+	return []byte(result.Stdout), nil
+}
+
+// compareIntegrity lists how the scanned files differ from the record,
+// leaving out files under unreadable paths, sorted by path
+func compareIntegrity(recorded, scanned map[string]IntegrityFile, paths, unreadable []string) []IntegrityChange {
+	var changes []IntegrityChange
+	for path, file := range scanned {
+		old, ok := recorded[path]
+		switch {
+		case !ok:
+			changes = append(changes, IntegrityChange{Path: path, Kind: IntegrityAdded})
+		case old.Hash != file.Hash:
+			changes = append(changes, IntegrityChange{Path: path, Kind: IntegrityModified, Detail: "content"})
+		case old.Mode != file.Mode:
+			changes = append(changes, IntegrityChange{Path: path, Kind: IntegrityModified,
+				Detail: fmt.Sprintf("mode %04o -> %04o", old.Mode.Perm(), file.Mode.Perm())})
+		}
+	}
+	for path := range recorded {
+		if _, ok := scanned[path]; !ok && underAny(path, paths) && !underAny(path, unreadable) {
+			changes = append(changes, IntegrityChange{Path: path, Kind: IntegrityRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// changedByDaemira reports whether the audit log has daemira writing or
+// deleting a path, or a directory it is in, since a time
+func changedByDaemira(audit []utility.AuditEntry, path string, since time.Time) bool {
+	for i := len(audit) - 1; i >= 0; i-- {
+		entry := audit[i]
+		if entry.Time.Before(since) {
+			break
+		}
+		if entry.Action != utility.AuditWrite && entry.Action != utility.AuditDelete {
+			continue
+		}
+		if entry.Target == path || strings.HasPrefix(path, entry.Target+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// underAny reports whether a path is one of the others or inside one
+func underAny(path string, others []string) bool {
+	for _, other := range others {
+		if path == other || strings.HasPrefix(path, strings.TrimSuffix(other, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether a list holds a string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFile returns the sha256 of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// integrityCopyDir is where copies of recorded files are kept
+func integrityCopyDir() string {
+	return filepath.Join(utility.StateDir(), "integrity")
+}
+
+// integrityCopyPath returns the copy of content with a checksum
+func integrityCopyPath(hash string) string {
+	return filepath.Join(integrityCopyDir(), hash)
+}
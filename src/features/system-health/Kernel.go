@@ -0,0 +1,394 @@
+/**
+ * Kernel parameters and microcode
+ * Compares the running kernel's command line with the parameters expected in
+ * health.kernel_params, and the boot entry GRUB generated with them, so a
+ * parameter dropped from /etc/default/grub shows before the next reboot. The
+ * CPU's microcode package must be installed and loaded early, through the
+ * boot entry's initrd line or mkinitcpio's microcode hook. Checked daily and
+ * after updates regenerate the GRUB config.
+ */
+
+package systemhealth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Alerts raised by the kernel check
+const (
+	kernelParamsAlert = "kernel-params"
+	microcodeAlert    = "microcode"
+)
+
+const (
+	// grubConfig is the config grub-mkconfig writes
+	grubConfig = "/boot/grub/grub.cfg"
+	// mkinitcpioConfig lists the initramfs hooks
+	mkinitcpioConfig = "/etc/mkinitcpio.conf"
+)
+
+// microcodePackages are the microcode packages by CPU vendor ID
+var microcodePackages = map[string]string{
+	"GenuineIntel": "intel-ucode",
+	"AuthenticAMD": "amd-ucode",
+}
+
+// KernelParam is an expected kernel parameter: "name=value" must be set to
+// that value, "name" set to anything and "!name" not set
+type KernelParam string
+
+// Matches reports whether a command line has the parameter as expected;
+// the kernel uses the last of repeated parameters
+func (p KernelParam) Matches(cmdline []string) bool {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(string(p), "!"), "=")
+	found, current := false, ""
+	for _, param := range cmdline {
+		key, val, _ := strings.Cut(param, "=")
+		if key == name {
+			found, current = true, val
+		}
+	}
+	switch {
+	case strings.HasPrefix(string(p), "!"):
+		return !found
+	case hasValue:
+		return found && current == value
+	default:
+		return found
+	}
+}
+
+// MicrocodeStatus is whether the CPU's microcode updates are loaded
+type MicrocodeStatus struct {
+	Vendor    string // e.g. GenuineIntel, "" if unknown
+	Package   string // e.g. intel-ucode, "" for other vendors
+	Revision  string // the running revision, e.g. 0xf4
+	Virtual   bool   // a virtual machine, whose host loads microcode
+	Installed bool
+	Early     string // how it is loaded early, "" if it isn't
+}
+
+// KernelStatus is the running command line, the next boot's and microcode
+type KernelStatus struct {
+	Cmdline         []string
+	NextBoot        []string // the first GRUB entry's parameters, nil if unknown
+	NextBootInitrd  []string
+	Missing         []KernelParam // expected but not in the running command line
+	NextBootMissing []KernelParam // expected but not in the next boot's
+	Microcode       MicrocodeStatus
+	Checked         time.Time
+}
+
+// MicrocodeProblem describes what is wrong with microcode loading, "" if
+// nothing is
+func (s KernelStatus) MicrocodeProblem() string {
+	mc := s.Microcode
+	switch {
+	case mc.Package == "" || mc.Virtual:
+		return ""
+	case !mc.Installed:
+		return fmt.Sprintf("%s is not installed (sudo pacman -S %s)", mc.Package, mc.Package)
+	case mc.Early == "" && s.NextBoot != nil:
+		// Without the boot entry GRUB's initrd line can't be checked
+		return fmt.Sprintf("%s is installed but not loaded at boot: add the microcode hook to %s, or regenerate the GRUB config", mc.Package, mkinitcpioConfig)
+	}
+	return ""
+}
+
+// KernelMonitor checks kernel parameters and microcode
+type KernelMonitor struct {
+	logger   *utility.Logger
+	shell    utility.CommandRunner
+	expected []KernelParam
+	mu       sync.Mutex
+}
+
+var (
+	kernelMonitorInstance *KernelMonitor
+	kernelMonitorOnce     sync.Once
+)
+
+// GetKernelMonitor returns the singleton KernelMonitor instance
+func GetKernelMonitor() *KernelMonitor {
+	kernelMonitorOnce.Do(func() {
+		kernelMonitorInstance = &KernelMonitor{
+			logger: utility.GetLogger().With("health"),
+			shell:  utility.NewShell(utility.GetLogger()),
+		}
+	})
+	return kernelMonitorInstance
+}
+
+// SetExpected sets the kernel parameters expected, e.g. "zswap.enabled=0",
+// "mitigations=auto" or "!nomodeset"
+func (km *KernelMonitor) SetExpected(params []string) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.expected = make([]KernelParam, 0, len(params))
+	for _, param := range params {
+		if param = strings.TrimSpace(param); param != "" {
+			km.expected = append(km.expected, KernelParam(param))
+		}
+	}
+}
+
+// Expected returns the kernel parameters expected
+func (km *KernelMonitor) Expected() []KernelParam {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return append([]KernelParam(nil), km.expected...)
+}
+
+// Inspect reads the running command line, the next boot entry and the
+// microcode state
+func (km *KernelMonitor) Inspect(ctx context.Context) (KernelStatus, error) {
+	status := KernelStatus{Checked: time.Now()}
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return status, fmt.Errorf("failed to read the kernel command line: %w", err)
+	}
+	status.Cmdline = kernelArgs(strings.Fields(string(data)))
+
+	if grub, err := km.readGrubConfig(ctx); err == nil {
+		status.NextBoot, status.NextBootInitrd = parseGrubEntry(grub)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		km.logger.Debug("Not checking the next boot entry: %v", err)
+	}
+
+	for _, param := range km.Expected() {
+		if !param.Matches(status.Cmdline) {
+			status.Missing = append(status.Missing, param)
+		}
+		if status.NextBoot != nil && !param.Matches(status.NextBoot) {
+			status.NextBootMissing = append(status.NextBootMissing, param)
+		}
+	}
+
+	status.Microcode = inspectMicrocode(status.NextBootInitrd)
+	return status, nil
+}
+
+// readGrubConfig reads grub.cfg, through sudo when only root may read it
+func (km *KernelMonitor) readGrubConfig(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(grubConfig)
+	if err == nil {
+		return string(data), nil
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		return "", err
+	}
+	privileges := utility.GetPrivilegeManager()
+	if err := privileges.Validate(ctx); err != nil {
+		return "", err
+	}
+	argv := privileges.Command("cat", grubConfig)
+	result, err := km.shell.ExecuteArgs(ctx, argv[0], argv[1:], &utility.ExecOptions{
+		Timeout:  10 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("failed to read %s: %s", grubConfig, strings.TrimSpace(result.Stderr))
+	}
+	return result.Stdout, nil
+}
+
+// parseGrubEntry returns the kernel parameters and initrd images of the
+// first menu entry, the one booted unless GRUB_DEFAULT says otherwise
+func parseGrubEntry(config string) (params, initrd []string) {
+	inEntry := false
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case fields[0] == "menuentry":
+			if inEntry {
+				return params, initrd
+			}
+			inEntry = true
+		case !inEntry:
+		case (fields[0] == "linux" || fields[0] == "linuxefi") && len(fields) > 1:
+			params = kernelArgs(append([]string{}, fields[2:]...))
+		case (fields[0] == "initrd" || fields[0] == "initrdefi") && len(fields) > 1:
+			initrd = append([]string{}, fields[1:]...)
+		}
+	}
+	return params, initrd
+}
+
+// kernelArgs drops what follows "--" on a command line, which the kernel
+// passes to init
+func kernelArgs(cmdline []string) []string {
+	for idx, arg := range cmdline {
+		if arg == "--" {
+			return cmdline[:idx]
+		}
+	}
+	return cmdline
+}
+
+// inspectMicrocode finds the CPU vendor and revision, whether its
+// microcode package is installed and how it is loaded early
+func inspectMicrocode(initrd []string) MicrocodeStatus {
+	var status MicrocodeStatus
+	if data, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			switch key {
+			case "vendor_id":
+				status.Vendor = value
+			case "microcode":
+				status.Revision = value
+			case "flags":
+				status.Virtual = strings.Contains(" "+value+" ", " hypervisor ")
+			}
+			if key == "flags" {
+				break // the first CPU's entry says it all
+			}
+		}
+	}
+	status.Package = microcodePackages[status.Vendor]
+	if status.Package == "" {
+		return status
+	}
+
+	image := "/boot/" + status.Package + ".img"
+	if _, err := os.Stat(image); err == nil {
+		status.Installed = true
+	} else if _, err := os.Stat(filepath.Join("/usr/lib/firmware", status.Package)); err == nil {
+		status.Installed = true
+	}
+
+	for _, path := range initrd {
+		if filepath.Base(path) == filepath.Base(image) {
+			status.Early = "GRUB initrd"
+		}
+	}
+	if status.Early == "" && mkinitcpioHasHook("microcode") {
+		status.Early = "mkinitcpio microcode hook"
+	}
+	return status
+}
+
+// mkinitcpioHasHook reports whether mkinitcpio's HOOKS, in its config or a
+// drop-in, include a hook
+func mkinitcpioHasHook(hook string) bool {
+	paths := []string{mkinitcpioConfig}
+	dropIns, _ := filepath.Glob(mkinitcpioConfig + ".d/*.conf")
+	paths = append(paths, dropIns...)
+	found := false
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "HOOKS=") {
+				continue
+			}
+			// Later assignments replace earlier ones
+			hooks := strings.Trim(strings.TrimPrefix(line, "HOOKS="), "()\"' ")
+			found = false
+			for _, name := range strings.Fields(hooks) {
+				if name == hook {
+					found = true
+				}
+			}
+		}
+	}
+	return found
+}
+
+// Check inspects the kernel and raises alerts for missing parameters and
+// microcode not loaded
+func (km *KernelMonitor) Check(ctx context.Context) error {
+	_, err := km.check(ctx)
+	return err
+}
+
+// check inspects the kernel, raises or resolves the alerts and returns what
+// it found
+func (km *KernelMonitor) check(ctx context.Context) (KernelStatus, error) {
+	status, err := km.Inspect(ctx)
+	if err != nil {
+		return status, err
+	}
+	alerts := utility.GetAlerts()
+
+	if problems := status.ParamProblems(); len(problems) == 0 {
+		alerts.Resolve(kernelParamsAlert)
+	} else {
+		alerts.Raise(kernelParamsAlert, utility.AlertWarning, "Kernel parameters differ from health.kernel_params", strings.Join(problems, "; "))
+	}
+
+	if problem := status.MicrocodeProblem(); problem == "" {
+		alerts.Resolve(microcodeAlert)
+	} else {
+		alerts.Raise(microcodeAlert, utility.AlertWarning, "CPU microcode updates not loaded", problem)
+	}
+	return status, nil
+}
+
+// CheckNextBoot checks the boot entry just generated and returns how it
+// differs from what is expected, raising the same alerts as Check
+func (km *KernelMonitor) CheckNextBoot(ctx context.Context) []string {
+	status, err := km.check(ctx)
+	if err != nil {
+		km.logger.Debug("Failed to check the kernel parameters: %v", err)
+		return nil
+	}
+	var problems []string
+	for _, param := range status.NextBootMissing {
+		problems = append(problems, fmt.Sprintf("the new boot entry lacks %s", describeParam(param)))
+	}
+	if problem := status.MicrocodeProblem(); problem != "" {
+		problems = append(problems, problem)
+	}
+	for _, problem := range problems {
+		km.logger.Warn("After regenerating the GRUB config: %s", problem)
+	}
+	return problems
+}
+
+// ParamProblems describes the expected parameters missing now or at the
+// next boot
+func (s KernelStatus) ParamProblems() []string {
+	var problems []string
+	for _, param := range s.Missing {
+		problems = append(problems, "running kernel: "+describeParam(param))
+	}
+	for _, param := range s.NextBootMissing {
+		problems = append(problems, "next boot: "+describeParam(param))
+	}
+	return problems
+}
+
+// describeParam says what an expected parameter needs, e.g. "mitigations=auto"
+// or "no nomodeset"
+func describeParam(param KernelParam) string {
+	if name, ok := strings.CutPrefix(string(param), "!"); ok {
+		return "no " + name
+	}
+	return string(param)
+}
@@ -61,7 +61,7 @@ const optimalSwappinessZram = 180
 // MemoryMonitor tracks memory usage, swap, and zram statistics
 type MemoryMonitor struct {
 	logger *utility.Logger
-	shell  *utility.Shell
+	shell  utility.CommandRunner
 	mu     sync.RWMutex
 }
 
@@ -74,13 +74,19 @@ var (
 func GetMemoryMonitor() *MemoryMonitor {
 	memoryMonitorOnce.Do(func() {
 		memoryMonitorInstance = &MemoryMonitor{
-			logger: utility.GetLogger(),
+			logger: utility.GetLogger().With("memory"),
 			shell:  utility.NewShell(utility.GetLogger()),
 		}
 	})
 	return memoryMonitorInstance
 }
 
+// SetRunner makes the monitor run its commands with runner, e.g. a
+// utility.FakeRunner; call it before the monitor is used
+func (mm *MemoryMonitor) SetRunner(runner utility.CommandRunner) {
+	mm.shell = runner
+}
+
 // GetSwappiness gets current swappiness value
 func (mm *MemoryMonitor) GetSwappiness(ctx context.Context) (int, error) {
 	result, err := mm.shell.Execute(ctx, "cat /proc/sys/vm/swappiness", &utility.ExecOptions{
@@ -0,0 +1,38 @@
+package systemhealth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+func TestMemoryMonitorGetMemoryStats(t *testing.T) {
+	mm := &MemoryMonitor{logger: utility.GetLogger().With("memory")}
+	mm.SetRunner(utility.NewFakeRunner().
+		On(`^cat /proc/meminfo$`, fixtureMeminfo).
+		On(`^cat /proc/sys/vm/swappiness$`, fixtureSwappiness))
+
+	stats, err := mm.GetMemoryStats(context.Background())
+	if err != nil {
+		t.Fatalf("GetMemoryStats() = %v", err)
+	}
+	if stats.TotalBytes != 32585472<<10 || stats.AvailableBytes != 21154816<<10 {
+		t.Errorf("total %d, available %d bytes", stats.TotalBytes, stats.AvailableBytes)
+	}
+	// Buffers and cache don't count as used
+	if want := int64(32585472-9823744-412160-11325440) << 10; stats.UsedBytes != want {
+		t.Errorf("used %d bytes, want %d", stats.UsedBytes, want)
+	}
+	if stats.Swap.TotalBytes != 16292860<<10 || stats.Swap.UsedBytes != 0 {
+		t.Errorf("swap = %+v", stats.Swap)
+	}
+	if stats.Zram != nil {
+		t.Errorf("zram = %+v without /sys/block/zram0", stats.Zram)
+	}
+
+	swappiness, err := mm.GetSwappiness(context.Background())
+	if err != nil || swappiness != 60 {
+		t.Errorf("GetSwappiness() = %d, %v", swappiness, err)
+	}
+}
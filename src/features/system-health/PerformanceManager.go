@@ -51,7 +51,7 @@ type CPUStats struct {
 // PerformanceManager integrates with power-profiles-daemon for CPU power management
 type PerformanceManager struct {
 	logger *utility.Logger
-	shell  *utility.Shell
+	shell  utility.CommandRunner
 	mu     sync.RWMutex
 }
 
@@ -64,13 +64,19 @@ var (
 func GetPerformanceManager() *PerformanceManager {
 	performanceManagerOnce.Do(func() {
 		performanceManagerInstance = &PerformanceManager{
-			logger: utility.GetLogger(),
+			logger: utility.GetLogger().With("performance"),
 			shell:  utility.NewShell(utility.GetLogger()),
 		}
 	})
 	return performanceManagerInstance
 }
 
+// SetRunner makes the manager run its commands with runner, e.g. a
+// utility.FakeRunner; call it before the manager is used
+func (pm *PerformanceManager) SetRunner(runner utility.CommandRunner) {
+	pm.shell = runner
+}
+
 // IsPowerProfilesAvailable checks if power-profiles-daemon is available
 func (pm *PerformanceManager) IsPowerProfilesAvailable(ctx context.Context) (bool, error) {
 	result, err := pm.shell.Execute(ctx, "which powerprofilesctl", &utility.ExecOptions{
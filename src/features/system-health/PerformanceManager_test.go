@@ -0,0 +1,47 @@
+package systemhealth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+func TestPerformanceManagerProfiles(t *testing.T) {
+	pm := &PerformanceManager{logger: utility.GetLogger().With("performance")}
+	pm.SetRunner(utility.NewFakeRunner().
+		On(`^which powerprofilesctl$`, utility.Result{Stdout: "/usr/bin/powerprofilesctl"}).
+		On(`^powerprofilesctl get$`, fixturePowerProfile).
+		On(`^powerprofilesctl list$`, fixturePowerProfiles))
+
+	profile, err := pm.GetCurrentProfile(context.Background())
+	if err != nil || profile != PowerProfileBalanced {
+		t.Errorf("GetCurrentProfile() = %q, %v", profile, err)
+	}
+
+	profiles, err := pm.GetAllProfiles(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllProfiles() = %v", err)
+	}
+	want := []PowerProfile{PowerProfilePerformance, PowerProfileBalanced, PowerProfilePowerSaver}
+	if len(profiles) != len(want) {
+		t.Fatalf("got %d profiles, want %d", len(profiles), len(want))
+	}
+	for i, p := range profiles {
+		if p.Name != want[i] || p.Active != (p.Name == PowerProfileBalanced) || p.CPUDriver != "amd_pstate" {
+			t.Errorf("profile %d = %+v", i, p)
+		}
+	}
+}
+
+func TestPerformanceManagerWithoutPowerProfiles(t *testing.T) {
+	pm := &PerformanceManager{logger: utility.GetLogger().With("performance")}
+	pm.SetRunner(utility.NewFakeRunner())
+
+	if _, err := pm.GetCurrentProfile(context.Background()); err == nil {
+		t.Error("GetCurrentProfile() succeeded without powerprofilesctl")
+	}
+	if profiles, err := pm.GetAllProfiles(context.Background()); err != nil || len(profiles) != 0 {
+		t.Errorf("GetAllProfiles() = %v, %v", profiles, err)
+	}
+}
@@ -0,0 +1,489 @@
+/**
+ * SSH key health
+ * Inventories the keys in ~/.ssh: their type, fingerprint, age, whether the
+ * private key is protected by a passphrase, and file permissions ssh would
+ * refuse or that expose keys to other users. Checks that the SSH agent
+ * answers with the identities expected to be loaded, and when user
+ * certificates expire. Problems are raised as alerts hourly.
+ */
+
+package systemhealth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Alerts raised by the SSH check
+const (
+	sshKeysAlert         = "ssh-keys"
+	sshPermissionsAlert  = "ssh-permissions"
+	sshAgentAlert        = "ssh-agent"
+	sshCertificatesAlert = "ssh-certificates"
+)
+
+// DefaultSSHCertWarn is how long before a certificate expires it is reported
+const DefaultSSHCertWarn = 7 * 24 * time.Hour
+
+var (
+	// sshFingerprintPattern matches a line of `ssh-keygen -l` or `ssh-add -l`:
+	// "256 SHA256:abc comment (ED25519)"
+	sshFingerprintPattern = regexp.MustCompile(`^(\d+) (\S+) (.*?) ?\((\S+)\)$`)
+	// sshValidPattern matches the validity of `ssh-keygen -L`
+	sshValidPattern = regexp.MustCompile(`Valid: (?:from \S+ to (\S+)|forever)`)
+	// sshKeyIDPattern matches the key ID of `ssh-keygen -L`
+	sshKeyIDPattern = regexp.MustCompile(`Key ID: "(.*)"`)
+)
+
+// SSHKey is a private key in ~/.ssh
+type SSHKey struct {
+	Path        string
+	Type        string // e.g. ED25519 or RSA
+	Bits        int
+	Fingerprint string
+	Comment     string
+	Encrypted   bool
+	Mode        os.FileMode
+	Modified    time.Time
+	InAgent     bool
+}
+
+// Name is the key's file name, e.g. id_ed25519
+func (k SSHKey) Name() string {
+	return filepath.Base(k.Path)
+}
+
+// Weak reports why the key's type or size is too weak, "" if it isn't
+func (k SSHKey) Weak() string {
+	switch {
+	case k.Type == "DSA":
+		return "DSA keys are no longer accepted by OpenSSH"
+	case k.Type == "RSA" && k.Bits > 0 && k.Bits < 3072:
+		return fmt.Sprintf("RSA keys under 3072 bits are weak (%d)", k.Bits)
+	}
+	return ""
+}
+
+// SSHCertificate is a user certificate in ~/.ssh
+type SSHCertificate struct {
+	Path        string
+	KeyID       string
+	ValidBefore time.Time // zero if valid forever
+}
+
+// SSHAgentStatus is what the SSH agent answered
+type SSHAgentStatus struct {
+	Socket     string // "" if no agent socket was found
+	Running    bool
+	Identities []string // fingerprints of the loaded identities
+	Missing    []string // expected identities not loaded
+}
+
+// SSHStatus is the state of ~/.ssh and the agent
+type SSHStatus struct {
+	Dir          string
+	Keys         []SSHKey
+	Certificates []SSHCertificate
+	Agent        SSHAgentStatus
+	Permissions  []string // files whose permissions are wrong, with why
+	Checked      time.Time
+}
+
+// Unencrypted returns the private keys without a passphrase
+func (s SSHStatus) Unencrypted() []SSHKey {
+	var keys []SSHKey
+	for _, key := range s.Keys {
+		if !key.Encrypted {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SSHOptions is what the SSH check expects
+type SSHOptions struct {
+	AgentKeys []string      // keys expected in the agent, by file name or fingerprint
+	MaxKeyAge time.Duration // keys older are reported; 0 disables
+	CertWarn  time.Duration // certificates expiring sooner are reported
+}
+
+// SSHMonitor inventories SSH keys and checks the agent
+type SSHMonitor struct {
+	logger  *utility.Logger
+	shell   utility.CommandRunner
+	options SSHOptions
+	mu      sync.Mutex
+}
+
+var (
+	sshMonitorInstance *SSHMonitor
+	sshMonitorOnce     sync.Once
+)
+
+// GetSSHMonitor returns the singleton SSHMonitor instance
+func GetSSHMonitor() *SSHMonitor {
+	sshMonitorOnce.Do(func() {
+		sshMonitorInstance = &SSHMonitor{
+			logger:  utility.GetLogger().With("security"),
+			shell:   utility.NewShell(utility.GetLogger()),
+			options: SSHOptions{CertWarn: DefaultSSHCertWarn},
+		}
+	})
+	return sshMonitorInstance
+}
+
+// SetOptions sets the expected agent identities, key age and certificate
+// warning time
+func (sm *SSHMonitor) SetOptions(options SSHOptions) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if options.CertWarn <= 0 {
+		options.CertWarn = DefaultSSHCertWarn
+	}
+	sm.options = options
+}
+
+// Options returns what the SSH check expects
+func (sm *SSHMonitor) Options() SSHOptions {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.options
+}
+
+// Inspect inventories ~/.ssh and asks the agent for its identities
+func (sm *SSHMonitor) Inspect(ctx context.Context) (SSHStatus, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return SSHStatus{}, err
+	}
+	status := SSHStatus{Dir: filepath.Join(home, ".ssh"), Checked: time.Now()}
+	info, err := os.Stat(status.Dir)
+	if os.IsNotExist(err) {
+		status.Agent = sm.inspectAgent(ctx, nil)
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		status.Permissions = append(status.Permissions, fmt.Sprintf("%s is %04o, should be 0700", status.Dir, info.Mode().Perm()))
+	}
+
+	entries, err := os.ReadDir(status.Dir)
+	if err != nil {
+		return status, err
+	}
+	uid := os.Getuid()
+	for _, entry := range entries {
+		path := filepath.Join(status.Dir, entry.Name())
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != uid {
+			status.Permissions = append(status.Permissions, fmt.Sprintf("%s is owned by uid %d", path, stat.Uid))
+		}
+
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, "-cert.pub"):
+			if cert, err := sm.inspectCertificate(ctx, path); err == nil {
+				status.Certificates = append(status.Certificates, cert)
+			}
+		case strings.HasSuffix(name, ".pub"):
+		case name == "authorized_keys" || name == "config":
+			// ssh refuses these when others can write them
+			if info.Mode().Perm()&0022 != 0 {
+				status.Permissions = append(status.Permissions, fmt.Sprintf("%s is %04o, writable by others", path, info.Mode().Perm()))
+			}
+		default:
+			key, ok := sm.inspectKey(ctx, path, info)
+			if !ok {
+				continue
+			}
+			if key.Mode&0077 != 0 {
+				status.Permissions = append(status.Permissions, fmt.Sprintf("%s is %04o, should be 0600", path, key.Mode))
+			}
+			status.Keys = append(status.Keys, key)
+		}
+	}
+
+	status.Agent = sm.inspectAgent(ctx, status.Keys)
+	loaded := make(map[string]bool, len(status.Agent.Identities))
+	for _, fingerprint := range status.Agent.Identities {
+		loaded[fingerprint] = true
+	}
+	for idx := range status.Keys {
+		status.Keys[idx].InAgent = loaded[status.Keys[idx].Fingerprint]
+	}
+	return status, nil
+}
+
+// inspectKey reads a private key, reporting false for files that aren't one
+func (sm *SSHMonitor) inspectKey(ctx context.Context, path string, info os.FileInfo) (SSHKey, bool) {
+	if info.Size() > 64<<10 {
+		return SSHKey{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		return SSHKey{}, false
+	}
+
+	key := SSHKey{
+		Path:      path,
+		Encrypted: privateKeyEncrypted(data),
+		Mode:      info.Mode().Perm(),
+		Modified:  info.ModTime(),
+	}
+	// The public key next to it needs no passphrase
+	source := path
+	if _, err := os.Stat(path + ".pub"); err == nil {
+		source = path + ".pub"
+	}
+	if line, err := sm.fingerprint(ctx, source); err == nil {
+		key.Bits, key.Fingerprint, key.Comment, key.Type = line.bits, line.fingerprint, line.comment, line.keyType
+	}
+	return key, true
+}
+
+// fingerprintLine is a parsed line of `ssh-keygen -l` or `ssh-add -l`
+type fingerprintLine struct {
+	bits        int
+	fingerprint string
+	comment     string
+	keyType     string
+}
+
+func parseFingerprintLine(line string) (fingerprintLine, bool) {
+	match := sshFingerprintPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return fingerprintLine{}, false
+	}
+	bits, _ := strconv.Atoi(match[1])
+	return fingerprintLine{bits: bits, fingerprint: match[2], comment: match[3], keyType: match[4]}, true
+}
+
+// fingerprint runs `ssh-keygen -l` on a key
+func (sm *SSHMonitor) fingerprint(ctx context.Context, path string) (fingerprintLine, error) {
+	result, err := sm.shell.ExecuteArgs(ctx, "ssh-keygen", []string{"-l", "-f", path}, &utility.ExecOptions{
+		Timeout:  10 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return fingerprintLine{}, err
+	}
+	line, ok := parseFingerprintLine(result.Stdout)
+	if result.ExitCode != 0 || !ok {
+		return fingerprintLine{}, fmt.Errorf("ssh-keygen couldn't read %s", path)
+	}
+	return line, nil
+}
+
+// privateKeyEncrypted reports whether a private key needs a passphrase
+func privateKeyEncrypted(data []byte) bool {
+	text := string(data)
+	switch {
+	case strings.Contains(text, "BEGIN ENCRYPTED PRIVATE KEY"), strings.Contains(text, "Proc-Type: 4,ENCRYPTED"):
+		return true
+	case !strings.Contains(text, "BEGIN OPENSSH PRIVATE KEY"):
+		// PEM keys without an encryption header are in the clear
+		return false
+	}
+
+	// The OpenSSH format starts with "openssh-key-v1\0" and the cipher name
+	var body strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "-----") {
+			body.WriteString(line)
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(body.String())
+	magic := []byte("openssh-key-v1\x00")
+	if err != nil || !bytes.HasPrefix(raw, magic) || len(raw) < len(magic)+4 {
+		return false
+	}
+	raw = raw[len(magic):]
+	length := binary.BigEndian.Uint32(raw)
+	if int(length) > len(raw)-4 {
+		return false
+	}
+	return string(raw[4:4+length]) != "none"
+}
+
+// inspectCertificate reads a certificate's key ID and expiry
+func (sm *SSHMonitor) inspectCertificate(ctx context.Context, path string) (SSHCertificate, error) {
+	result, err := sm.shell.ExecuteArgs(ctx, "ssh-keygen", []string{"-L", "-f", path}, &utility.ExecOptions{
+		Timeout:  10 * time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		return SSHCertificate{}, err
+	}
+	if result.ExitCode != 0 {
+		return SSHCertificate{}, fmt.Errorf("ssh-keygen couldn't read %s", path)
+	}
+
+	cert := SSHCertificate{Path: path}
+	if match := sshKeyIDPattern.FindStringSubmatch(result.Stdout); match != nil {
+		cert.KeyID = match[1]
+	}
+	if match := sshValidPattern.FindStringSubmatch(result.Stdout); match != nil && match[1] != "" {
+		// ssh-keygen prints local time
+		if validBefore, err := time.ParseInLocation("2006-01-02T15:04:05", match[1], time.Local); err == nil {
+			cert.ValidBefore = validBefore
+		}
+	}
+	return cert, nil
+}
+
+// agentSockets are where agents put their socket when SSH_AUTH_SOCK isn't
+// set, as in a daemon started by systemd
+func agentSockets() []string {
+	sockets := []string{os.Getenv("SSH_AUTH_SOCK")}
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		sockets = append(sockets,
+			filepath.Join(runtime, "ssh-agent.socket"),
+			filepath.Join(runtime, "gcr", "ssh"),
+			filepath.Join(runtime, "keyring", "ssh"),
+			filepath.Join(runtime, "gnupg", "S.gpg-agent.ssh"),
+		)
+	}
+	return sockets
+}
+
+// inspectAgent asks the agent for its identities and names the expected
+// ones it lacks
+func (sm *SSHMonitor) inspectAgent(ctx context.Context, keys []SSHKey) SSHAgentStatus {
+	var agent SSHAgentStatus
+	for _, socket := range agentSockets() {
+		if info, err := os.Stat(socket); socket != "" && err == nil && info.Mode()&os.ModeSocket != 0 {
+			agent.Socket = socket
+			break
+		}
+	}
+
+	expected := sm.Options().AgentKeys
+	if agent.Socket != "" {
+		result, err := sm.shell.ExecuteArgs(ctx, "ssh-add", []string{"-l"}, &utility.ExecOptions{
+			Timeout:  10 * time.Second,
+			Env:      map[string]string{"SSH_AUTH_SOCK": agent.Socket},
+			ReadOnly: true,
+		})
+		// ssh-add exits 1 for an agent without identities, 2 when none answers
+		if err == nil && (result.ExitCode == 0 || result.ExitCode == 1) {
+			agent.Running = true
+			for _, line := range strings.Split(result.Stdout, "\n") {
+				if parsed, ok := parseFingerprintLine(line); ok {
+					agent.Identities = append(agent.Identities, parsed.fingerprint)
+				}
+			}
+		}
+	}
+
+	for _, want := range expected {
+		fingerprint := want
+		for _, key := range keys {
+			if key.Name() == want || key.Path == want {
+				fingerprint = key.Fingerprint
+			}
+		}
+		found := false
+		for _, identity := range agent.Identities {
+			if identity == fingerprint {
+				found = true
+			}
+		}
+		if !found {
+			agent.Missing = append(agent.Missing, want)
+		}
+	}
+	return agent
+}
+
+// Check inspects ~/.ssh and the agent and raises alerts for unprotected,
+// weak or old keys, wrong permissions, a missing agent identity and
+// certificates about to expire
+func (sm *SSHMonitor) Check(ctx context.Context) error {
+	status, err := sm.Inspect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to inspect SSH keys: %w", err)
+	}
+	options := sm.Options()
+	alerts := utility.GetAlerts()
+
+	var keyProblems []string
+	for _, key := range status.Keys {
+		switch {
+		case !key.Encrypted:
+			keyProblems = append(keyProblems, key.Name()+" has no passphrase")
+		case key.Weak() != "":
+			keyProblems = append(keyProblems, key.Name()+": "+key.Weak())
+		case options.MaxKeyAge > 0 && time.Since(key.Modified) > options.MaxKeyAge:
+			keyProblems = append(keyProblems, fmt.Sprintf("%s is %s old", key.Name(), formatDays(time.Since(key.Modified))))
+		}
+	}
+	if len(keyProblems) == 0 {
+		alerts.Resolve(sshKeysAlert)
+	} else {
+		alerts.Raise(sshKeysAlert, utility.AlertWarning, fmt.Sprintf("%d SSH key(s) need attention", len(keyProblems)), strings.Join(keyProblems, "; "))
+	}
+
+	if len(status.Permissions) == 0 {
+		alerts.Resolve(sshPermissionsAlert)
+	} else {
+		alerts.Raise(sshPermissionsAlert, utility.AlertWarning, "Wrong permissions in ~/.ssh", strings.Join(status.Permissions, "; "))
+	}
+
+	switch {
+	case len(options.AgentKeys) == 0 || len(status.Agent.Missing) == 0:
+		alerts.Resolve(sshAgentAlert)
+	case !status.Agent.Running:
+		alerts.Raise(sshAgentAlert, utility.AlertWarning, "SSH agent not running", "Expected identities: "+strings.Join(options.AgentKeys, ", "))
+	default:
+		alerts.Raise(sshAgentAlert, utility.AlertWarning, "SSH agent lacks identities", "Not loaded: "+strings.Join(status.Agent.Missing, ", ")+" (ssh-add)")
+	}
+
+	var expiring []string
+	severity := utility.AlertWarning
+	for _, cert := range status.Certificates {
+		if cert.ValidBefore.IsZero() || time.Until(cert.ValidBefore) > options.CertWarn {
+			continue
+		}
+		if time.Now().After(cert.ValidBefore) {
+			expiring = append(expiring, filepath.Base(cert.Path)+" expired")
+			severity = utility.AlertCritical
+		} else {
+			expiring = append(expiring, fmt.Sprintf("%s expires in %s", filepath.Base(cert.Path), formatDays(time.Until(cert.ValidBefore))))
+		}
+	}
+	sort.Strings(expiring)
+	if len(expiring) == 0 {
+		alerts.Resolve(sshCertificatesAlert)
+	} else {
+		alerts.Raise(sshCertificatesAlert, severity, "SSH certificates expiring", strings.Join(expiring, "; "))
+	}
+	return nil
+}
+
+// formatDays describes a duration in days, or hours under two days
+func formatDays(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
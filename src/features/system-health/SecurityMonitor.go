@@ -0,0 +1,394 @@
+/**
+ * Security monitor
+ * Reports which firewalls (firewalld, ufw, nftables) are installed and
+ * which one is active, and enables one with a default ruleset: incoming
+ * connections dropped except replies, ping, the tailnet, local container
+ * and VM bridges and SSH on sshd's ports while it runs, outgoing allowed.
+ * Failed logins are watched in FailedLogins.go.
+ */
+
+package systemhealth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Firewalls daemira knows, in the order one is picked to enable
+const (
+	FirewallFirewalld = "firewalld"
+	FirewallUfw       = "ufw"
+	FirewallNftables  = "nftables"
+)
+
+// firewalls maps each firewall to the program that manages it
+var firewalls = []struct{ name, program string }{
+	{FirewallFirewalld, "firewall-cmd"},
+	{FirewallUfw, "ufw"},
+	{FirewallNftables, "nft"},
+}
+
+// nftablesConfig is the ruleset nftables.service loads
+const nftablesConfig = "/etc/nftables.conf"
+
+// nftablesRuleset is written to nftablesConfig when enabling nftables; %s
+// are the SSH rules, if any. It only touches daemira's own table, so the
+// tables Docker, libvirt and Tailscale add stay and forwarded traffic is
+// left to them, and the chain is emptied first so reloading doesn't add
+// its rules twice (the blocked addresses' sets in the table stay).
+const nftablesRuleset = `#!/usr/sbin/nft -f
+# Written by daemira security firewall enable
+
+table inet daemira {
+	chain firewall {
+		type filter hook input priority filter; policy drop;
+	}
+}
+flush chain inet daemira firewall
+
+table inet daemira {
+	chain firewall {
+		ct state established,related accept
+		ct state invalid drop
+		iif "lo" accept
+		iifname "` + tailscaleInterface + `" accept
+		iifname "virbr*" accept
+		iifname "docker*" accept
+		iifname "podman*" accept
+		meta l4proto { icmp, ipv6-icmp } accept
+		ip6 saddr fe80::/10 udp dport 546 accept
+%s	}
+}
+`
+
+// tailscaleInterface is Tailscale's network interface, trusted by the
+// default rulesets so the tailnet (and the API served on it) stays reachable
+const tailscaleInterface = "tailscale0"
+
+// FirewallStatus is what is known about the machine's firewall
+type FirewallStatus struct {
+	Installed []string // firewalls whose program is installed
+	Active    string   // the firewall filtering traffic, empty if none
+	Detail    string   // e.g. firewalld's default zone or ufw's incoming policy
+}
+
+// Summary describes the firewall in a line, e.g. "ufw active (incoming: deny)"
+func (s FirewallStatus) Summary() string {
+	switch {
+	case s.Active != "" && s.Detail != "":
+		return fmt.Sprintf("%s active (%s)", s.Active, s.Detail)
+	case s.Active != "":
+		return s.Active + " active"
+	case len(s.Installed) > 0:
+		return fmt.Sprintf("none active (%s installed)", strings.Join(s.Installed, ", "))
+	default:
+		return "none installed"
+	}
+}
+
+// SecurityMonitor checks and enables the firewall, and watches failed logins
+type SecurityMonitor struct {
+	logger     *utility.Logger
+	shell      utility.CommandRunner
+	privileges *utility.PrivilegeManager
+	policy     LoginPolicy
+	offending  map[string]bool      // sources over the threshold at the last check
+	blocked    map[string]time.Time // addresses blocked, until when
+	enabling   sync.Mutex           // held while enabling the firewall
+	mu         sync.Mutex
+}
+
+var (
+	securityMonitorInstance *SecurityMonitor
+	securityMonitorOnce     sync.Once
+)
+
+// GetSecurityMonitor returns the singleton SecurityMonitor instance
+func GetSecurityMonitor() *SecurityMonitor {
+	securityMonitorOnce.Do(func() {
+		securityMonitorInstance = &SecurityMonitor{
+			logger:     utility.GetLogger().With("security"),
+			shell:      utility.NewShell(utility.GetLogger()),
+			privileges: utility.GetPrivilegeManager(),
+			policy: LoginPolicy{
+				Threshold:     DefaultFailedLoginThreshold,
+				Window:        DefaultFailedLoginWindow,
+				BlockDuration: DefaultBlockDuration,
+			},
+			offending: make(map[string]bool),
+			blocked:   make(map[string]time.Time),
+		}
+	})
+	return securityMonitorInstance
+}
+
+// SetRunner makes the monitor run its commands with runner, e.g. a
+// utility.FakeRunner; call it before the monitor is used
+func (sm *SecurityMonitor) SetRunner(runner utility.CommandRunner) {
+	sm.shell = runner
+}
+
+// GetFirewallStatus reports the installed firewalls and the active one,
+// without needing root
+func (sm *SecurityMonitor) GetFirewallStatus(ctx context.Context) (*FirewallStatus, error) {
+	status := &FirewallStatus{}
+	for _, firewall := range firewalls {
+		if _, err := exec.LookPath(firewall.program); err == nil {
+			status.Installed = append(status.Installed, firewall.name)
+		}
+	}
+
+	active, err := sm.activeUnits(ctx, FirewallFirewalld, FirewallUfw, FirewallNftables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the firewall services: %w", err)
+	}
+	switch {
+	case active[FirewallFirewalld]:
+		status.Active = FirewallFirewalld
+		if zone, err := sm.output(ctx, "firewall-cmd", "--get-default-zone"); err == nil && zone != "" {
+			status.Detail = "zone " + zone
+		}
+	// ufw.service stays active with ufw disabled; ufw.conf says whether it filters
+	case active[FirewallUfw] && readConfigValue("/etc/ufw/ufw.conf", "ENABLED") == "yes":
+		status.Active = FirewallUfw
+		if policy := readConfigValue("/etc/default/ufw", "DEFAULT_INPUT_POLICY"); policy != "" {
+			status.Detail = "incoming: " + strings.ToLower(policy)
+		}
+	case active[FirewallNftables]:
+		status.Active = FirewallNftables
+		status.Detail = nftablesConfig
+	}
+	return status, nil
+}
+
+// EnableFirewall turns on the first installed firewall with the default
+// ruleset, unless one is active already. It returns the firewall's status
+// and the run log of the commands.
+func (sm *SecurityMonitor) EnableFirewall(ctx context.Context) (*FirewallStatus, string, error) {
+	sm.enabling.Lock()
+	defer sm.enabling.Unlock()
+
+	status, err := sm.GetFirewallStatus(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if status.Active != "" {
+		return status, "", nil
+	}
+	if len(status.Installed) == 0 {
+		return status, "", fmt.Errorf("no firewall installed (install ufw, firewalld or nftables)")
+	}
+	if err := sm.privileges.Validate(ctx); err != nil {
+		return status, "", fmt.Errorf("enabling the firewall needs root: %w", err)
+	}
+
+	run, err := utility.NewRunLog("security", "firewall-enable")
+	if err != nil {
+		sm.logger.Warn("Firewall commands won't be logged: %v", err)
+	}
+	defer run.Close()
+
+	var sshPorts []int
+	if sm.sshRunning(ctx) {
+		sshPorts = sm.sshPorts(ctx)
+	}
+	firewall := status.Installed[0]
+	sm.logger.Info("Enabling %s (SSH ports allowed: %v)", firewall, sshPorts)
+	switch firewall {
+	case FirewallFirewalld:
+		// The public zone drops what isn't asked for, except SSH on port 22
+		// and DHCPv6; the tailnet is trusted
+		commands := [][]string{
+			{"systemctl", "enable", "--now", "firewalld"},
+			{"firewall-cmd", "--set-default-zone=public"},
+			{"firewall-cmd", "--permanent", "--zone=trusted", "--add-interface=" + tailscaleInterface},
+		}
+		for _, port := range sshPorts {
+			if port != 22 {
+				commands = append(commands, []string{"firewall-cmd", "--permanent", "--zone=public", fmt.Sprintf("--add-port=%d/tcp", port)})
+			}
+		}
+		commands = append(commands, []string{"firewall-cmd", "--reload"})
+		err = sm.runAll(ctx, run, commands...)
+	case FirewallUfw:
+		commands := [][]string{
+			{"ufw", "default", "deny", "incoming"},
+			{"ufw", "default", "allow", "outgoing"},
+			{"ufw", "allow", "in", "on", tailscaleInterface},
+		}
+		for _, port := range sshPorts {
+			commands = append(commands, []string{"ufw", "limit", fmt.Sprintf("%d/tcp", port)})
+		}
+		commands = append(commands,
+			[]string{"ufw", "--force", "enable"},
+			[]string{"systemctl", "enable", "--now", "ufw"},
+		)
+		err = sm.runAll(ctx, run, commands...)
+	case FirewallNftables:
+		err = sm.writeNftablesRuleset(ctx, run, sshPorts)
+		if err == nil {
+			err = sm.runAll(ctx, run, []string{"systemctl", "enable", "--now", "nftables"})
+		}
+	}
+	if err != nil {
+		return status, run.Path(), fmt.Errorf("failed to enable %s: %w", firewall, err)
+	}
+
+	status, err = sm.GetFirewallStatus(ctx)
+	if err != nil {
+		return nil, run.Path(), err
+	}
+	if status.Active == "" {
+		return status, run.Path(), fmt.Errorf("%s was enabled but isn't active", firewall)
+	}
+	sm.logger.Info("Firewall enabled: %s", status.Summary())
+	return status, run.Path(), nil
+}
+
+// writeNftablesRuleset checks the default ruleset and installs it as
+// nftablesConfig, keeping the file it replaces next to it
+func (sm *SecurityMonitor) writeNftablesRuleset(ctx context.Context, run *utility.RunLog, sshPorts []int) error {
+	sshRules := ""
+	for _, port := range sshPorts {
+		sshRules += fmt.Sprintf("\t\ttcp dport %d ct state new limit rate 10/minute accept\n", port)
+	}
+	file, err := os.CreateTemp("", "daemira-nftables-*.conf")
+	if err != nil {
+		return fmt.Errorf("failed to write ruleset: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := fmt.Fprintf(file, nftablesRuleset, sshRules); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write ruleset: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write ruleset: %w", err)
+	}
+
+	commands := [][]string{{"nft", "--check", "--file", file.Name()}}
+	if _, err := os.Stat(nftablesConfig); err == nil {
+		backup := nftablesConfig + ".daemira-" + time.Now().Format("20060102-150405")
+		commands = append(commands, []string{"cp", "--archive", nftablesConfig, backup})
+	}
+	commands = append(commands, []string{"install", "--mode=0644", file.Name(), nftablesConfig})
+	if err := sm.runAll(ctx, run, commands...); err != nil {
+		return err
+	}
+	utility.Audit(utility.AuditWrite, nftablesConfig, "default ruleset installed by daemira security firewall enable")
+	return nil
+}
+
+// runAll runs commands as root in order, stopping at the first failure
+func (sm *SecurityMonitor) runAll(ctx context.Context, run *utility.RunLog, commands ...[]string) error {
+	for _, argv := range commands {
+		command := utility.CommandLine(argv...)
+		run.Println("$ " + command)
+		args := sm.privileges.Command(argv...)
+		result, err := sm.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{
+			Timeout:        time.Minute,
+			StdoutCallback: run.Println,
+			StderrCallback: run.Println,
+		})
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", argv[0], err)
+		}
+		sm.privileges.AuditRan(command, result.ExitCode)
+		if result.ExitCode != 0 {
+			output := strings.TrimSpace(result.Stderr)
+			if output == "" {
+				output = strings.TrimSpace(result.Stdout)
+			}
+			return fmt.Errorf("%s failed (exit code %d): %s", command, result.ExitCode, output)
+		}
+	}
+	return nil
+}
+
+// activeUnits reports which of the systemd units are active
+func (sm *SecurityMonitor) activeUnits(ctx context.Context, units ...string) (map[string]bool, error) {
+	// Exits non-zero unless all are active, printing one state per unit either way
+	result, err := sm.shell.ExecuteArgs(ctx, "systemctl", append([]string{"is-active"}, units...), &utility.ExecOptions{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	states := strings.Fields(result.Stdout)
+	if len(states) != len(units) {
+		return nil, fmt.Errorf("systemctl is-active: %s", strings.SplitN(strings.TrimSpace(result.Stderr), "\n", 2)[0])
+	}
+	active := make(map[string]bool, len(units))
+	for i, unit := range units {
+		active[unit] = states[i] == "active"
+	}
+	return active, nil
+}
+
+// sshRunning reports whether an SSH server runs, whose port the default
+// rulesets keep open
+func (sm *SecurityMonitor) sshRunning(ctx context.Context) bool {
+	// The unit is sshd on Arch and Fedora, ssh on Debian and Ubuntu
+	active, err := sm.activeUnits(ctx, "sshd", "ssh")
+	return err == nil && (active["sshd"] || active["ssh"])
+}
+
+// sshPorts returns the ports the SSH server listens on, from its effective
+// config (which only root can read), or 22 if it can't be read
+func (sm *SecurityMonitor) sshPorts(ctx context.Context) []int {
+	args := sm.privileges.Command("sshd", "-T")
+	result, err := sm.shell.ExecuteArgs(ctx, args[0], args[1:], &utility.ExecOptions{Timeout: 10 * time.Second})
+	if err != nil || result.ExitCode != 0 {
+		sm.logger.Debug("Can't read the SSH server's ports, assuming 22")
+		return []int{22}
+	}
+	var ports []int
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "port ")
+		if !ok {
+			continue
+		}
+		if port, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && port > 0 && port < 65536 && !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return []int{22}
+	}
+	return ports
+}
+
+// output runs a program and returns its trimmed output
+func (sm *SecurityMonitor) output(ctx context.Context, name string, args ...string) (string, error) {
+	result, err := sm.shell.ExecuteArgs(ctx, name, args, &utility.ExecOptions{Timeout: 10 * time.Second})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("%s exited with %d", name, result.ExitCode)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// readConfigValue returns a KEY=value setting of a shell-style config file
+func readConfigValue(path, key string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && name == key {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+/**
+ * Fixtures - Output of pacman and sudo for utility.FakeRunner
+ * Results as pacman and sudo print them, trimmed to what daemira parses, e.g.
+ *   utility.NewFakeRunner().On(`pacman -Syu`, fixturePacmanUpToDate)
+ */
+
+package systemupdate
+
+import "github.com/ln64-git/daemira/src/utility"
+
+var (
+	fixturePacmanUpToDate = utility.Result{Stdout: ":: Synchronizing package databases...\n core is up to date\n extra is up to date\n:: Starting full system upgrade...\n there is nothing to do"}
+
+	fixturePacmanLocked = utility.Result{ExitCode: 1, Stderr: "error: failed to init transaction (unable to lock database)\nerror: could not lock database: File exists\n  if you're sure a package manager is not already\n  running, you can remove /var/lib/pacman/db.lck"}
+
+	fixturePacmanMirrorDown = utility.Result{ExitCode: 1, Stdout: ":: Synchronizing package databases...", Stderr: "error: failed retrieving file 'core.db' from mirror.example.org : The requested URL returned error: 503\nerror: failed to synchronize all databases (failed to retrieve some files)"}
+
+	fixturePacmanTargetNotFound = utility.Result{ExitCode: 1, Stderr: "error: target not found: cachyos-keyring"}
+
+	fixtureSudoPasswordRequired = utility.Result{ExitCode: 1, Stderr: "sudo: a password is required"}
+)
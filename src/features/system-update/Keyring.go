@@ -0,0 +1,339 @@
+/**
+ * Pacman keyring health
+ * Updates fail when the keys packages are signed with have expired locally
+ * or the keyring package lags behind the repositories. The check compares
+ * the installed keyring packages with the sync database and their build
+ * date, lists expired keys in pacman's GnuPG keyring and makes sure its
+ * trust database is readable. Problems are raised as an alert daily, and
+ * expired keys are refreshed and the trust database rebuilt before updates.
+ */
+
+package systemupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// keyringAlert is raised while the keyring needs attention
+const keyringAlert = "pacman-keyring"
+
+// keyringCheckJob is the scheduler job checking the keyring
+const keyringCheckJob = "keyring-check"
+
+// DefaultKeyringMaxAge is how old an installed keyring package may be
+const DefaultKeyringMaxAge = 90 * 24 * time.Hour
+
+const (
+	// pacmanGnupgDir is pacman's GnuPG home
+	pacmanGnupgDir = "/etc/pacman.d/gnupg"
+	// pacmanLocalDB holds the installed packages' metadata
+	pacmanLocalDB = "/var/lib/pacman/local"
+	// pacmanKeyringsDir holds the keyrings packages install, with their
+	// lists of revoked keys
+	pacmanKeyringsDir = "/usr/share/pacman/keyrings"
+)
+
+// keyringPackages are the keyring packages updated before upgrades
+var keyringPackages = []string{"archlinux-keyring", "cachyos-keyring"}
+
+// KeyringPackage is an installed keyring package
+type KeyringPackage struct {
+	Name      string
+	Version   string
+	Available string // version in the sync database, "" if unknown
+	BuildDate time.Time
+}
+
+// Outdated reports whether the sync database has a newer version
+func (p KeyringPackage) Outdated() bool {
+	return p.Available != "" && p.Available != p.Version
+}
+
+// ExpiredKey is a key in pacman's keyring that expired without being revoked
+type ExpiredKey struct {
+	Fingerprint string
+	UID         string
+	Expired     time.Time
+}
+
+// KeyringStatus is the state of pacman's keyring
+type KeyringStatus struct {
+	Packages       []KeyringPackage
+	Expired        []ExpiredKey
+	TrustDB        string // what is wrong with the trust database, "" if fine
+	TrustDBChecked bool   // false when the keyring couldn't be read without a password
+	Checked        time.Time
+}
+
+// Problems describes what makes the keyring stale, given how old the
+// keyring packages may be
+func (s KeyringStatus) Problems(maxAge time.Duration) []string {
+	var problems []string
+	for _, pkg := range s.Packages {
+		switch {
+		case pkg.Outdated():
+			problems = append(problems, fmt.Sprintf("%s %s is behind %s", pkg.Name, pkg.Version, pkg.Available))
+		case maxAge > 0 && !pkg.BuildDate.IsZero() && time.Since(pkg.BuildDate) > maxAge:
+			problems = append(problems, fmt.Sprintf("%s %s was built %d days ago", pkg.Name, pkg.Version, int(time.Since(pkg.BuildDate).Hours()/24)))
+		}
+	}
+	if len(s.Expired) > 0 {
+		problems = append(problems, fmt.Sprintf("%d key(s) expired", len(s.Expired)))
+	}
+	if s.TrustDB != "" {
+		problems = append(problems, s.TrustDB)
+	}
+	return problems
+}
+
+// InspectKeyring reads the keyring packages and pacman's keyring, using
+// sudo for the keyring when it needs no password
+func InspectKeyring(ctx context.Context, runner utility.CommandRunner, privileges *utility.PrivilegeManager) (KeyringStatus, error) {
+	status := KeyringStatus{Checked: time.Now()}
+	if _, err := os.Stat(pacmanLocalDB); err != nil {
+		return status, fmt.Errorf("pacman database not found: %w", err)
+	}
+
+	for _, name := range keyringPackages {
+		pkg, ok := installedPackage(name)
+		if !ok {
+			continue
+		}
+		result, err := runner.ExecuteArgs(ctx, "pacman", []string{"-Sp", "--print-format", "%v", name}, &utility.ExecOptions{
+			Timeout: 30 * time.Second,
+		})
+		if err == nil && result.ExitCode == 0 {
+			pkg.Available = strings.TrimSpace(result.Stdout)
+		}
+		status.Packages = append(status.Packages, pkg)
+	}
+
+	if _, err := os.Stat(pacmanGnupgDir); err != nil {
+		status.TrustDB = "the keyring is not initialized (pacman-key --init)"
+		status.TrustDBChecked = true
+		return status, nil
+	}
+	if info, err := os.Stat(filepath.Join(pacmanGnupgDir, "trustdb.gpg")); err != nil || info.Size() == 0 {
+		status.TrustDB = "the trust database is missing (pacman-key --updatedb)"
+	}
+
+	if err := privileges.Validate(ctx); err != nil {
+		if errors.Is(err, utility.ErrNeedsPassword) {
+			return status, nil
+		}
+		return status, err
+	}
+	argv := privileges.Command("gpg", "--homedir", pacmanGnupgDir, "--batch", "--no-auto-check-trustdb", "--with-colons", "--fixed-list-mode", "--list-keys")
+	result, err := runner.ExecuteArgs(ctx, argv[0], argv[1:], &utility.ExecOptions{
+		Timeout:  time.Minute,
+		ReadOnly: true,
+	})
+	if errors.Is(err, utility.ErrNeedsPassword) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to list pacman's keys: %w", err)
+	}
+	status.TrustDBChecked = true
+	if result.ExitCode != 0 || strings.Contains(strings.ToLower(result.Stderr), "trustdb") {
+		if status.TrustDB == "" {
+			status.TrustDB = "the trust database is damaged (pacman-key --updatedb): " + firstLine(result.Stderr)
+		}
+	}
+	status.Expired = expiredKeys(result.Stdout, revokedKeys())
+	return status, nil
+}
+
+// installedPackage reads a package's version and build date from pacman's
+// local database
+func installedPackage(name string) (KeyringPackage, bool) {
+	matches, _ := filepath.Glob(filepath.Join(pacmanLocalDB, name+"-*", "desc"))
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fields := parseDesc(string(data))
+		if fields["NAME"] != name {
+			continue
+		}
+		pkg := KeyringPackage{Name: name, Version: fields["VERSION"]}
+		if seconds, err := strconv.ParseInt(fields["BUILDDATE"], 10, 64); err == nil {
+			pkg.BuildDate = time.Unix(seconds, 0)
+		}
+		return pkg, true
+	}
+	return KeyringPackage{}, false
+}
+
+// parseDesc reads the first value of each %FIELD% in a pacman desc file
+func parseDesc(data string) map[string]string {
+	fields := map[string]string{}
+	lines := strings.Split(data, "\n")
+	for idx := 0; idx+1 < len(lines); idx++ {
+		line := strings.TrimSpace(lines[idx])
+		if len(line) > 2 && strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%") {
+			fields[strings.Trim(line, "%")] = strings.TrimSpace(lines[idx+1])
+		}
+	}
+	return fields
+}
+
+// revokedKeys reads the fingerprints the keyring packages list as revoked
+func revokedKeys() map[string]bool {
+	revoked := map[string]bool{}
+	matches, _ := filepath.Glob(filepath.Join(pacmanKeyringsDir, "*-revoked"))
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Fields(string(data)) {
+			revoked[strings.ToUpper(strings.Split(line, ":")[0])] = true
+		}
+	}
+	return revoked
+}
+
+// expiredKeys finds the expired keys in `gpg --with-colons --list-keys`,
+// leaving out those the keyring packages revoked
+func expiredKeys(listing string, revoked map[string]bool) []ExpiredKey {
+	var expired []ExpiredKey
+	current := -1 // index of the expired key being read, -1 between them
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			current = -1
+			if fields[1] != "e" {
+				continue
+			}
+			key := ExpiredKey{}
+			if seconds, err := strconv.ParseInt(fields[6], 10, 64); err == nil {
+				key.Expired = time.Unix(seconds, 0)
+			}
+			expired = append(expired, key)
+			current = len(expired) - 1
+		case "fpr":
+			if current >= 0 && expired[current].Fingerprint == "" {
+				expired[current].Fingerprint = fields[9]
+			}
+		case "uid":
+			if current >= 0 && expired[current].UID == "" {
+				expired[current].UID = fields[9]
+			}
+		}
+	}
+
+	kept := expired[:0]
+	for _, key := range expired {
+		if !revoked[strings.ToUpper(key.Fingerprint)] {
+			kept = append(kept, key)
+		}
+	}
+	return kept
+}
+
+// firstLine returns the first non-empty line of output
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// SetKeyringMaxAge changes how old the keyring packages may be; 0 only
+// compares them with the sync database
+func (su *SystemUpdate) SetKeyringMaxAge(maxAge time.Duration) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+	su.keyringMaxAge = maxAge
+}
+
+// CheckKeyring inspects the keyring and raises or resolves the keyring alert
+func (su *SystemUpdate) CheckKeyring(ctx context.Context) (KeyringStatus, error) {
+	status, err := InspectKeyring(ctx, su.shell, su.privileges)
+	if err != nil {
+		return status, err
+	}
+	su.mu.RLock()
+	maxAge := su.keyringMaxAge
+	su.mu.RUnlock()
+
+	problems := status.Problems(maxAge)
+	if len(problems) == 0 {
+		utility.GetAlerts().Resolve(keyringAlert)
+		return status, nil
+	}
+	severity := utility.AlertWarning
+	if status.TrustDB != "" {
+		severity = utility.AlertCritical
+	}
+	utility.GetAlerts().Raise(keyringAlert, severity, "Pacman keyring is stale", strings.Join(problems, "; "))
+	return status, nil
+}
+
+// refreshKeyring brings a stale keyring up to date before an update:
+// expired keys are fetched again and a damaged trust database rebuilt. An
+// outdated keyring package is left to the keyring update step.
+func (su *SystemUpdate) refreshKeyring(ctx context.Context) {
+	status, err := su.CheckKeyring(ctx)
+	if err != nil {
+		su.logger.Debug("Skipping keyring check: %v", err)
+		return
+	}
+	if !status.TrustDBChecked {
+		return
+	}
+
+	if len(status.Expired) > 0 {
+		fingerprints := make([]string, 0, len(status.Expired))
+		for _, key := range status.Expired {
+			fingerprints = append(fingerprints, key.Fingerprint)
+		}
+		su.logger.Info("Refreshing %d expired key(s) in the pacman keyring", len(fingerprints))
+		fmt.Printf("\nRefreshing %d expired pacman key(s)...\n", len(fingerprints))
+		su.runKeyringCommand(ctx, append([]string{"pacman-key", "--refresh-keys"}, fingerprints...), 10*time.Minute)
+	}
+	if status.TrustDB != "" {
+		su.logger.Info("Rebuilding the pacman trust database: %s", status.TrustDB)
+		fmt.Println("\nRebuilding the pacman trust database...")
+		if _, err := os.Stat(pacmanGnupgDir); err != nil {
+			su.runKeyringCommand(ctx, []string{"pacman-key", "--init"}, 5*time.Minute)
+			su.runKeyringCommand(ctx, []string{"pacman-key", "--populate"}, 5*time.Minute)
+		}
+		su.runKeyringCommand(ctx, []string{"pacman-key", "--updatedb"}, 5*time.Minute)
+	}
+
+	if len(status.Expired) > 0 || status.TrustDB != "" {
+		if _, err := su.CheckKeyring(ctx); err != nil {
+			su.logger.Debug("Failed to check the keyring again: %v", err)
+		}
+	}
+}
+
+// runKeyringCommand runs a pacman-key command as root, logging failures
+func (su *SystemUpdate) runKeyringCommand(ctx context.Context, argv []string, timeout time.Duration) {
+	argv = su.privileges.Command(argv...)
+	result, err := su.shell.ExecuteArgs(ctx, argv[0], argv[1:], &utility.ExecOptions{Timeout: timeout})
+	switch {
+	case err != nil:
+		su.logger.Warn("%s failed: %v", utility.CommandLine(argv...), err)
+	case result.ExitCode != 0:
+		su.logger.Warn("%s exited with code %d: %s", utility.CommandLine(argv...), result.ExitCode, firstLine(result.Stderr))
+	}
+}
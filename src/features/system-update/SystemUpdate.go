@@ -7,6 +7,7 @@
  * - Update history tracking
  * - .pacnew file detection
  * - Reboot requirement detection
+ * - Pacman keyring checks, refreshing expired keys before updates
  * - Integration with Shell utility and Logger
  */
 
@@ -17,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/user"
 	"strings"
 	"sync"
@@ -26,20 +28,50 @@ import (
 )
 
 const (
-	errPasswordlessSudoNotConfigured = "passwordless sudo is not configured; system updates require sudo access without password prompts"
+	errNoRootAccess = "neither the root helper nor passwordless sudo is available; system updates need to run commands as root"
 )
 
 // SystemUpdateOptions configures the system update service
 type SystemUpdateOptions struct {
-	Interval  time.Duration // Default: 6 hours
-	AutoStart bool          // Start scheduler immediately
+	Interval      time.Duration // Default: 6 hours
+	AutoStart     bool          // Start scheduler immediately
+	KeyringMaxAge time.Duration // Keyring packages older are reported; 0 only compares them with the sync database
 }
 
 // UpdateStep represents a single update step
 type UpdateStep struct {
-	Name     string
-	Cmd      string
-	Optional bool
+	Name       string
+	Args       []string // program and arguments, run without a shell
+	Cmd        string   // shell command line, for steps that need a pipeline
+	Optional   bool
+	Retry      bool // run again after transient failures (network, mirrors, database lock); Args steps only
+	Bootloader bool // regenerates the boot entries, checked by the OnBootloaderUpdate callbacks
+	// Resolve builds Args when the step runs, for commands that depend on
+	// the system's state; nil Args means there is nothing to do
+	Resolve func(ctx context.Context) ([]string, error)
+}
+
+// CommandLine returns the step's command as it would be typed
+func (s UpdateStep) CommandLine() string {
+	if s.Cmd != "" {
+		return s.Cmd
+	}
+	return utility.CommandLine(s.Args...)
+}
+
+// program returns the program the step runs, past sudo and its flags
+func (s UpdateStep) program() string {
+	argv := s.Args
+	if s.Cmd != "" {
+		argv = strings.Fields(s.Cmd)
+	}
+	for len(argv) > 0 && (argv[0] == "sudo" || strings.HasPrefix(argv[0], "-")) {
+		argv = argv[1:]
+	}
+	if len(argv) == 0 {
+		return ""
+	}
+	return argv[0]
 }
 
 // UpdateHistoryEntry tracks update execution history
@@ -47,19 +79,39 @@ type UpdateHistoryEntry struct {
 	Timestamp time.Time
 	Success   bool
 	Duration  time.Duration
+	Error     string   // why it failed
+	RunLogs   []string // full output of each step that ran, in order
 }
 
 // SystemUpdate manages automated system updates for Arch Linux
 type SystemUpdate struct {
 	logger         *utility.Logger
-	shell          *utility.Shell
+	shell          utility.CommandRunner
+	privileges     *utility.PrivilegeManager
 	isRunning      bool
 	updateInterval time.Duration
 	lastUpdateTime *time.Time
 	updateHistory  []UpdateHistoryEntry
+	deferred       bool
+	paused         string // why scheduled updates wait, e.g. a metered network
+	keyringMaxAge  time.Duration
+	onUpdate       []func(UpdateHistoryEntry)
+	onBootloader   []func(ctx context.Context) []string
+	shuttingDown   bool
+	runMu          sync.Mutex // held while an update runs
 	mu             sync.RWMutex
-	stopChan       chan struct{}
-	ticker         *time.Ticker
+}
+
+// systemUpdateJob is the scheduler job running periodic updates
+const systemUpdateJob = "system-update"
+
+// systemUpdateState is the state store section keeping past updates
+const systemUpdateState = "system-update"
+
+// savedUpdates is the update history as kept in the state store
+type savedUpdates struct {
+	LastUpdate *time.Time           `json:"last_update,omitempty"`
+	History    []UpdateHistoryEntry `json:"history"`
 }
 
 // NewSystemUpdate creates a new SystemUpdate instance
@@ -74,12 +126,16 @@ func NewSystemUpdate(logger *utility.Logger, options *SystemUpdateOptions) *Syst
 	}
 
 	su := &SystemUpdate{
-		logger:         logger,
+		logger:         logger.With("system-update"),
 		shell:          utility.NewShell(logger),
+		privileges:     utility.GetPrivilegeManager(),
 		updateInterval: interval,
 		updateHistory:  make([]UpdateHistoryEntry, 0),
-		stopChan:       make(chan struct{}),
 	}
+	if options != nil {
+		su.keyringMaxAge = options.KeyringMaxAge
+	}
+	su.loadState()
 
 	if options != nil && options.AutoStart {
 		su.Start()
@@ -88,6 +144,26 @@ func NewSystemUpdate(logger *utility.Logger, options *SystemUpdateOptions) *Syst
 	return su
 }
 
+// loadState restores past updates from the state store
+func (su *SystemUpdate) loadState() {
+	var saved savedUpdates
+	if !utility.GetStateStore().Load(systemUpdateState, &saved) {
+		return
+	}
+	su.lastUpdateTime = saved.LastUpdate
+	if saved.History != nil {
+		su.updateHistory = saved.History
+	}
+}
+
+// savedState returns past updates for the state store; the caller holds mu
+func (su *SystemUpdate) savedState() savedUpdates {
+	return savedUpdates{
+		LastUpdate: su.lastUpdateTime,
+		History:    append([]UpdateHistoryEntry(nil), su.updateHistory...),
+	}
+}
+
 // Start begins the periodic update scheduler
 func (su *SystemUpdate) Start() {
 	su.mu.Lock()
@@ -101,21 +177,29 @@ func (su *SystemUpdate) Start() {
 	su.isRunning = true
 	su.logger.Info("Starting system update scheduler (interval: %v)", su.updateInterval)
 
-	// Run immediately
-	go su.runUpdate(context.Background())
+	// Deferred runs catch up as soon as do-not-disturb ends
+	utility.GetDoNotDisturb().OnEnd(su.runDeferred)
+
+	// Runs immediately, then every interval
+	utility.GetScheduler().Add(utility.Job{
+		ID:          systemUpdateJob,
+		Description: "Update the system",
+		Schedule:    utility.Every(su.updateInterval),
+		Jitter:      5 * time.Minute,
+		RunAtStart:  true,
+		Run:         su.scheduledUpdate,
+	})
 
-	// Schedule periodic updates
-	su.ticker = time.NewTicker(su.updateInterval)
-	go func() {
-		for {
-			select {
-			case <-su.ticker.C:
-				su.runUpdate(context.Background())
-			case <-su.stopChan:
-				return
-			}
-		}
-	}()
+	utility.GetScheduler().Add(utility.Job{
+		ID:          keyringCheckJob,
+		Description: "Check the pacman keyring",
+		Schedule:    utility.Every(24 * time.Hour),
+		Jitter:      10 * time.Minute,
+		Run: func(ctx context.Context) error {
+			_, err := su.CheckKeyring(ctx)
+			return err
+		},
+	})
 }
 
 // Stop halts the scheduler
@@ -129,14 +213,138 @@ func (su *SystemUpdate) Stop() {
 	}
 
 	su.isRunning = false
-	if su.ticker != nil {
-		su.ticker.Stop()
-	}
-	close(su.stopChan)
+	utility.GetScheduler().Remove(systemUpdateJob)
+	utility.GetScheduler().Remove(keyringCheckJob)
 
 	su.logger.Info("System update scheduler stopped")
 }
 
+// Shutdown halts the scheduler and waits, until ctx is done, for an update
+// in progress to finish. Updates are never interrupted, as a half-applied
+// upgrade is worse than a late exit; one running skips its optimization
+// steps and checks.
+func (su *SystemUpdate) Shutdown(ctx context.Context) error {
+	su.mu.Lock()
+	su.shuttingDown = true
+	running := su.isRunning
+	su.mu.Unlock()
+	if running {
+		su.Stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		su.runMu.Lock()
+		su.runMu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("system update still running: %w", ctx.Err())
+	}
+}
+
+// SetRunner makes updates run their commands with runner, e.g. a
+// utility.FakeRunner, sudo checks included; call it before Start
+func (su *SystemUpdate) SetRunner(runner utility.CommandRunner) {
+	su.shell = runner
+	su.privileges = utility.NewPrivilegeManager(runner)
+}
+
+// SetInterval changes the update interval; a running scheduler waits the new
+// interval from now
+func (su *SystemUpdate) SetInterval(interval time.Duration) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+
+	if interval <= 0 || interval == su.updateInterval {
+		return
+	}
+
+	su.updateInterval = interval
+	if su.isRunning {
+		utility.GetScheduler().Reschedule(systemUpdateJob, utility.Every(interval))
+	}
+	su.logger.Info("System update interval changed to %v", interval)
+}
+
+// scheduledUpdate runs a scheduled update unless do-not-disturb is active
+func (su *SystemUpdate) scheduledUpdate(ctx context.Context) error {
+	su.mu.RLock()
+	shuttingDown := su.shuttingDown
+	su.mu.RUnlock()
+	if shuttingDown {
+		return nil
+	}
+
+	if utility.GetDoNotDisturb().IsActive() {
+		su.mu.Lock()
+		su.deferred = true
+		su.mu.Unlock()
+		su.logger.Info("System update deferred (do not disturb)")
+		return nil
+	}
+
+	su.mu.Lock()
+	paused := su.paused
+	if paused != "" {
+		su.deferred = true
+	}
+	su.mu.Unlock()
+	if paused != "" {
+		su.logger.Info("System update deferred (%s)", paused)
+		return nil
+	}
+	return su.runUpdate(ctx)
+}
+
+// Pause defers scheduled updates until Resume; reason says why, e.g. "on a
+// metered network". Updates run by hand are not affected.
+func (su *SystemUpdate) Pause(reason string) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+
+	if su.paused == "" {
+		su.logger.Info("Scheduled system updates paused (%s)", reason)
+	}
+	su.paused = reason
+}
+
+// Resume lets scheduled updates run again, running one deferred while paused
+func (su *SystemUpdate) Resume() {
+	su.mu.Lock()
+	wasPaused := su.paused != ""
+	su.paused = ""
+	su.mu.Unlock()
+
+	if wasPaused {
+		su.logger.Info("Scheduled system updates resumed")
+		if !utility.GetDoNotDisturb().IsActive() {
+			go su.runDeferred()
+		}
+	}
+}
+
+// runDeferred runs an update that was skipped during do-not-disturb or a pause
+func (su *SystemUpdate) runDeferred() {
+	su.mu.Lock()
+	if su.paused != "" {
+		su.mu.Unlock()
+		return
+	}
+	deferred := su.deferred && su.isRunning
+	su.deferred = false
+	su.mu.Unlock()
+
+	if deferred {
+		su.logger.Info("Running deferred system update")
+		su.runUpdate(context.Background())
+	}
+}
+
 // RunUpdate executes system update immediately
 func (su *SystemUpdate) RunUpdate(ctx context.Context) error {
 	return su.runUpdate(ctx)
@@ -144,87 +352,110 @@ func (su *SystemUpdate) RunUpdate(ctx context.Context) error {
 
 // runUpdate is the internal update execution method
 func (su *SystemUpdate) runUpdate(ctx context.Context) error {
+	su.runMu.Lock()
+	defer su.runMu.Unlock()
+
 	su.logger.Info("Starting system update...")
 	fmt.Println("=== Starting System Update ===")
 	startTime := time.Now()
 
-	// Check if running as root - if so, no sudo needed
-	if su.isRoot() {
-		su.logger.Info("Running as root - sudo not required")
-	} else {
-		// Not running as root - check for passwordless sudo
-		hasPasswordlessSudo, err := su.checkPasswordlessSudo(ctx)
-		if err != nil || !hasPasswordlessSudo {
-			username := os.Getenv("USER")
-			if username == "" {
-				if u, err := user.Current(); err == nil {
-					username = u.Username
-				} else {
-					username = "ln64"
-				}
+	// Root, the root helper or passwordless sudo runs the privileged steps
+	if err := su.privileges.CanRun(ctx, "pacman", "-Syu", "--noconfirm"); err != nil {
+		username := os.Getenv("USER")
+		if username == "" {
+			if u, err := user.Current(); err == nil {
+				username = u.Username
+			} else {
+				username = "ln64"
 			}
-
-			fmt.Printf("\n✗ ERROR: system updates require root privileges\n")
-			fmt.Println("\nSOLUTION 1 (EASIEST): Run daemira with sudo:")
-			fmt.Println("  sudo go run main.go")
-			fmt.Println("  # Or if installed:")
-			fmt.Println("  sudo daemira")
-			fmt.Println("\nSOLUTION 2 (RECOMMENDED): Use the setup script for passwordless sudo:")
-			fmt.Println("  sudo ./scripts/setup-sudo-daemira.sh")
-			fmt.Println("  # This allows: sudo daemira (without password)")
-			fmt.Println("\nSOLUTION 3: Configure passwordless sudo manually:")
-			fmt.Println("  sudo visudo")
-			fmt.Printf("  # Add this line (replace '%s' with your username):\n", username)
-			fmt.Printf("  %s ALL=(ALL) NOPASSWD: /usr/local/bin/daemira\n", username)
-			fmt.Println("  # Or for development (running from source):")
-			fmt.Printf("  %s ALL=(ALL) NOPASSWD: /usr/bin/go\n", username)
-			fmt.Println("\nSOLUTION 4: Configure passwordless sudo for specific commands only:")
-			fmt.Println("  sudo visudo")
-			fmt.Printf("  # Add this line:\n")
-			fmt.Printf("  %s ALL=(ALL) NOPASSWD: /usr/bin/pacman, /usr/bin/paccache, /usr/bin/pacman-optimize, /usr/bin/grub-mkconfig, /usr/bin/systemctl, /usr/bin/fwupdmgr, /usr/bin/fstrim, /usr/bin/dkms\n", username)
-			su.logger.Error("%s", errPasswordlessSudoNotConfigured)
-			//nolint:ST1005,SA1006 // error message is correct, linter false positive
-			return errors.New(errPasswordlessSudoNotConfigured)
 		}
+
+		fmt.Printf("\n✗ ERROR: system updates require root privileges (%v)\n", err)
+		fmt.Println("\nSOLUTION 1 (RECOMMENDED): Install the root helper, which runs the update,")
+		fmt.Println("TRIM and DKMS commands as root for the daemon running as you:")
+		fmt.Println("  daemira helper install")
+		fmt.Println("\nSOLUTION 2: Configure passwordless sudo for specific commands only:")
+		fmt.Println("  sudo visudo")
+		fmt.Printf("  # Add this line (replace '%s' with your username):\n", username)
+		fmt.Printf("  %s ALL=(ALL) NOPASSWD: /usr/bin/pacman, /usr/bin/paccache, /usr/bin/pacman-optimize, /usr/bin/grub-mkconfig, /usr/bin/systemctl, /usr/bin/fwupdmgr, /usr/bin/fstrim, /usr/bin/dkms\n", username)
+		fmt.Println("\nSOLUTION 3: Use the setup script for passwordless sudo for daemira:")
+		fmt.Println("  sudo ./scripts/setup-sudo-daemira.sh")
+		su.logger.Error("%s", errNoRootAccess)
+		//nolint:ST1005,SA1006 // error message is correct, linter false positive
+		return fmt.Errorf("%s: %w", errNoRootAccess, err)
+	}
+
+	// Keep cached sudo credentials from expiring between steps
+	stopKeepAlive := su.privileges.KeepAlive(ctx)
+	defer stopKeepAlive()
+
+	// Keep the machine from suspending or shutting down mid-upgrade
+	lock, lockErr := utility.AcquireInhibitor(su.logger, "sleep:shutdown", "Running system update")
+	if lockErr != nil {
+		su.logger.Debug("Updating without inhibitor lock: %v", lockErr)
 	}
+	defer lock.Release()
+
+	// Expired keys would fail the upgrade on signature checks
+	su.refreshKeyring(ctx)
 
-	var err error
 	success := true
 
 	// Execute update steps
-	if err = su.executeUpdateSteps(ctx); err != nil {
+	runLogs, err := su.executeUpdateSteps(ctx)
+	if err != nil {
 		success = false
 	}
 
-	// Execute optimization steps
-	if err2 := su.executeOptimizationSteps(ctx); err2 != nil {
-		su.logger.Warn("Some optimization steps failed: %v", err2)
-	}
+	su.mu.RLock()
+	shuttingDown := su.shuttingDown
+	su.mu.RUnlock()
+	if shuttingDown {
+		su.logger.Info("Shutting down, skipping optimization steps and checks")
+	} else {
+		// Execute optimization steps
+		if err2 := su.executeOptimizationSteps(ctx); err2 != nil {
+			su.logger.Warn("Some optimization steps failed: %v", err2)
+		}
 
-	// Check for .pacnew files
-	su.checkPacnewFiles(ctx)
+		// Check for .pacnew files
+		su.checkPacnewFiles(ctx)
 
-	// Check if reboot required
-	su.checkRebootRequired(ctx)
+		// Check if reboot required
+		su.checkRebootRequired(ctx)
 
-	// Post-update verification
-	su.postUpdateVerification(ctx)
+		// Post-update verification
+		su.postUpdateVerification(ctx)
+	}
 
 	duration := time.Since(startTime)
 	su.mu.Lock()
 	now := time.Now()
 	su.lastUpdateTime = &now
-	su.updateHistory = append(su.updateHistory, UpdateHistoryEntry{
+	entry := UpdateHistoryEntry{
 		Timestamp: now,
 		Success:   success,
 		Duration:  duration,
-	})
+		RunLogs:   runLogs,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	su.updateHistory = append(su.updateHistory, entry)
 	// Keep only last 10 entries
 	if len(su.updateHistory) > 10 {
 		su.updateHistory = su.updateHistory[len(su.updateHistory)-10:]
 	}
+	callbacks := su.onUpdate
+	saved := su.savedState()
 	su.mu.Unlock()
 
+	utility.GetStateStore().Save(systemUpdateState, saved)
+
+	for _, callback := range callbacks {
+		callback(entry)
+	}
+
 	if success {
 		successMsg := fmt.Sprintf("System update completed successfully in %.1fs", duration.Seconds())
 		su.logger.Info(successMsg)
@@ -239,6 +470,34 @@ func (su *SystemUpdate) runUpdate(ctx context.Context) error {
 	return nil
 }
 
+// OnUpdate registers a callback run with the outcome of each update
+func (su *SystemUpdate) OnUpdate(callback func(UpdateHistoryEntry)) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+	su.onUpdate = append(su.onUpdate, callback)
+}
+
+// OnBootloaderUpdate registers a check run after the boot entries are
+// regenerated, returning how they differ from what is expected
+func (su *SystemUpdate) OnBootloaderUpdate(check func(ctx context.Context) []string) {
+	su.mu.Lock()
+	defer su.mu.Unlock()
+	su.onBootloader = append(su.onBootloader, check)
+}
+
+// checkBootloader runs the checks of the regenerated boot entries
+func (su *SystemUpdate) checkBootloader(ctx context.Context) {
+	su.mu.RLock()
+	checks := su.onBootloader
+	su.mu.RUnlock()
+
+	for _, check := range checks {
+		for _, problem := range check(ctx) {
+			fmt.Printf("  ⚠ %s\n", problem)
+		}
+	}
+}
+
 // GetStatus returns the current update status
 func (su *SystemUpdate) GetStatus() map[string]interface{} {
 	su.mu.RLock()
@@ -251,159 +510,168 @@ func (su *SystemUpdate) GetStatus() map[string]interface{} {
 
 	if su.lastUpdateTime != nil {
 		status["lastUpdate"] = su.lastUpdateTime.Unix()
-		status["nextUpdate"] = su.lastUpdateTime.Add(su.updateInterval).Unix()
+	}
+	if next := utility.GetScheduler().NextRun(systemUpdateJob); !next.IsZero() {
+		status["nextUpdate"] = next.Unix()
 	}
 
 	return status
 }
 
-// checkPasswordlessSudo verifies if passwordless sudo is available
-func (su *SystemUpdate) checkPasswordlessSudo(ctx context.Context) (bool, error) {
-	result, err := su.shell.Execute(ctx, "sudo -n true", &utility.ExecOptions{
-		Timeout: 5 * time.Second,
-	})
-	if err != nil {
-		return false, err
+// orphanRemoval returns the command removing the packages installed as
+// dependencies that nothing needs anymore, nil when there are none. The root
+// helper lists them itself; through sudo they are passed as arguments.
+func (su *SystemUpdate) orphanRemoval(ctx context.Context) ([]string, error) {
+	if helper := su.privileges.HelperCommand(utility.RootHelperRemoveOrphans); helper != nil {
+		return helper, nil
 	}
-	return result.ExitCode == 0, nil
-}
-
-// isRoot checks if running as root
-func (su *SystemUpdate) isRoot() bool {
-	return os.Geteuid() == 0
+	argv, err := utility.OrphanRemoval(ctx, su.shell)
+	if err != nil || argv == nil {
+		return nil, err
+	}
+	return su.privileges.Command(argv...), nil
 }
 
 // commandExists checks if a command exists in PATH
-func (su *SystemUpdate) commandExists(ctx context.Context, command string) bool {
-	// Extract base command (first word before space)
-	parts := strings.Fields(command)
-	baseCmd := parts[0]
-	if strings.HasPrefix(baseCmd, "sudo") {
-		if len(parts) > 1 {
-			baseCmd = parts[1]
-		}
-	}
-
-	result, err := su.shell.Execute(ctx, fmt.Sprintf("command -v %s", baseCmd), &utility.ExecOptions{
-		Timeout: 2 * time.Second,
-	})
-	if err != nil {
-		return false
-	}
-	return result.ExitCode == 0
+func (su *SystemUpdate) commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
 }
 
-// executeUpdateSteps runs all update steps
-func (su *SystemUpdate) executeUpdateSteps(ctx context.Context) error {
+// executeUpdateSteps runs all update steps, writing each step's output to
+// its own run log, and returns the run logs
+func (su *SystemUpdate) executeUpdateSteps(ctx context.Context) ([]string, error) {
+	var runLogs []string
 	fmt.Println("\n=== Executing Update Steps ===")
 
-	// Determine command prefix based on whether we're root
-	cmdPrefix := ""
-	if !su.isRoot() {
-		cmdPrefix = "sudo -n "
-	}
-
+	yayFlags := []string{"--noconfirm", "--answerclean", "All", "--answerdiff", "None", "--answeredit", "None", "--removemake"}
 	steps := []UpdateStep{
 		{
 			Name:     "Refreshing mirrorlist",
-			Cmd:      cmdPrefix + "pacman-mirrors --fasttrack",
+			Args:     su.privileges.Command("pacman-mirrors", "--fasttrack"),
 			Optional: true,
+			Retry:    true,
 		},
 		{
-			Name: "Updating keyrings",
-			Cmd:  cmdPrefix + "pacman -Sy --needed --noconfirm archlinux-keyring cachyos-keyring",
+			Name:  "Updating keyrings",
+			Args:  su.privileges.Command("pacman", "-Sy", "--needed", "--noconfirm", "archlinux-keyring", "cachyos-keyring"),
+			Retry: true,
 		},
 		{
-			Name: "Updating package databases",
-			Cmd:  cmdPrefix + "pacman -Syy --noconfirm",
+			Name:  "Updating package databases",
+			Args:  su.privileges.Command("pacman", "-Syy", "--noconfirm"),
+			Retry: true,
 		},
 		{
-			Name: "Upgrading packages",
-			Cmd:  cmdPrefix + "pacman -Syu --noconfirm",
+			Name:  "Upgrading packages",
+			Args:  su.privileges.Command("pacman", "-Syu", "--noconfirm"),
+			Retry: true,
 		},
 		{
-			Name: "Updating AUR packages",
-			Cmd:  "yay -Sua --noconfirm --answerclean All --answerdiff None --answeredit None --removemake --cleanafter",
+			Name:  "Updating AUR packages",
+			Args:  append(append([]string{"yay", "-Sua"}, yayFlags...), "--cleanafter"),
+			Retry: true,
 		},
 		{
-			Name:     "Updating firmware",
-			Cmd:      cmdPrefix + "fwupdmgr refresh --force && " + cmdPrefix + "fwupdmgr update -y",
+			Name: "Updating firmware",
+			Cmd: utility.Sequence(
+				su.privileges.Command("fwupdmgr", "refresh", "--force"),
+				su.privileges.Command("fwupdmgr", "update", "-y"),
+			),
 			Optional: true,
 		},
 		{
-			Name: "Removing orphaned packages",
-			Cmd:  `orphans=$(pacman -Qdtq 2>/dev/null); [ -z "$orphans" ] || ` + cmdPrefix + `pacman -Rns --noconfirm $orphans`,
+			Name:    "Removing orphaned packages",
+			Resolve: su.orphanRemoval,
 		},
 		{
 			Name: "Cleaning package cache",
-			Cmd:  cmdPrefix + "paccache -rk2",
+			Args: su.privileges.Command("paccache", "-rk2"),
 		},
 		{
 			Name: "Cleaning uninstalled cache",
-			Cmd:  cmdPrefix + "paccache -ruk0",
+			Args: su.privileges.Command("paccache", "-ruk0"),
 		},
 		{
 			Name: "Cleaning yay cache",
-			Cmd:  "yes | yay -Sc --noconfirm --answerclean All --answerdiff None --answeredit None --removemake",
+			Cmd:  utility.Pipeline([]string{"yes"}, append([]string{"yay", "-Sc"}, yayFlags...)),
 		},
 		{
 			Name:     "Optimizing pacman database",
-			Cmd:      cmdPrefix + "pacman-optimize",
+			Args:     su.privileges.Command("pacman-optimize"),
 			Optional: true,
 		},
 		{
-			Name: "Updating GRUB",
-			Cmd:  cmdPrefix + "grub-mkconfig -o /boot/grub/grub.cfg",
+			Name:       "Updating GRUB",
+			Args:       su.privileges.Command("grub-mkconfig", "-o", "/boot/grub/grub.cfg"),
+			Bootloader: true,
 		},
 		{
 			Name: "Reloading systemd daemon",
-			Cmd:  cmdPrefix + "systemctl daemon-reload",
+			Args: su.privileges.Command("systemctl", "daemon-reload"),
 		},
 	}
 
 	for i, step := range steps {
 		stepNum := i + 1
-		su.logger.Info("Step %d/%d: %s", stepNum, len(steps), step.Name)
+		stepLog := su.logger.WithFields(utility.Fields{"step": step.Name})
+		stepLog.Info("Step %d/%d: %s", stepNum, len(steps), step.Name)
 		fmt.Printf("\n[%d/%d] %s...\n", stepNum, len(steps), step.Name)
 
 		// For optional steps, check if command exists first
 		if step.Optional {
-			if !su.commandExists(ctx, step.Cmd) {
+			if !su.commandExists(step.program()) {
 				skipMsg := fmt.Sprintf("Skipped (optional): %s - command not available on this system", step.Name)
-				su.logger.Info(skipMsg)
+				stepLog.Info(skipMsg)
 				fmt.Printf("  ⚠ %s\n", skipMsg)
 				continue
 			}
 		}
 
+		if step.Resolve != nil {
+			// Like a step exiting non-zero, a failure here doesn't stop the update
+			args, err := step.Resolve(ctx)
+			if err != nil {
+				stepLog.Warn("Skipped: %s - %v", step.Name, err)
+				fmt.Printf("  ⚠ Skipped: %s (%v)\n", step.Name, err)
+				continue
+			}
+			if args == nil {
+				stepLog.Info("Nothing to do: %s", step.Name)
+				fmt.Printf("  ✓ Nothing to do\n")
+				continue
+			}
+			step.Args = args
+		}
+
 		// Use shorter timeout for first few commands
 		timeout := 30 * time.Second
 		if i >= 3 {
 			timeout = 10 * time.Minute
 		}
 
-		passwordDetected := false
-		var stdoutLines []string
-		var stderrLines []string
+		run, err := utility.NewRunLog("system-update", step.Name)
+		if err != nil {
+			stepLog.Debug("Running step without run log: %v", err)
+		}
+		if path := run.Path(); path != "" {
+			runLogs = append(runLogs, path)
+		}
+		command := step.CommandLine()
+		run.Println("$ " + command)
 
-		result, err := su.shell.Execute(ctx, step.Cmd, &utility.ExecOptions{
+		opts := &utility.ExecOptions{
 			Timeout: timeout,
 			StdoutCallback: func(line string) {
-				stdoutLines = append(stdoutLines, line)
-				su.logger.Debug("  %s", line)
+				run.Println(line)
 				if strings.TrimSpace(line) != "" {
 					fmt.Printf("  %s\n", line)
 				}
 			},
 			StderrCallback: func(line string) {
-				stderrLines = append(stderrLines, line)
-				lowerLine := strings.ToLower(line)
-				if strings.Contains(lowerLine, "password") ||
-					strings.Contains(lowerLine, "sudo: a password is required") {
-					passwordDetected = true
-				}
+				run.Println("[stderr] " + line)
 
-				if strings.TrimSpace(line) != "" && !passwordDetected {
+				if strings.TrimSpace(line) != "" {
 					lowerLine := strings.ToLower(line)
 					isNormalWarning := strings.Contains(lowerLine, "warning:") &&
 						(strings.Contains(lowerLine, "is newer than") ||
@@ -414,47 +682,61 @@ func (su *SystemUpdate) executeUpdateSteps(ctx context.Context) error {
 					}
 				}
 			},
-		})
+		}
+		var result *utility.Result
+		if step.Cmd != "" {
+			result, err = su.shell.Execute(ctx, step.Cmd, opts)
+		} else if step.Retry {
+			result, err = su.shell.ExecuteWithRetry(ctx, step.Args[0], step.Args[1:], opts, utility.DefaultRetryPolicy)
+		} else {
+			result, err = su.shell.ExecuteArgs(ctx, step.Args[0], step.Args[1:], opts)
+		}
+		if result != nil {
+			run.Println(fmt.Sprintf("exit code %d", result.ExitCode))
+			su.privileges.AuditRan(command, result.ExitCode)
+		}
+		run.Close()
 
 		// Check for password requirement
-		if passwordDetected || (result != nil && result.Stderr != "" &&
-			(strings.Contains(strings.ToLower(result.Stderr), "password") ||
-				strings.Contains(strings.ToLower(result.Stderr), "sudo: a password is required"))) {
+		if errors.Is(err, utility.ErrNeedsPassword) {
 			errorMsg := fmt.Sprintf("sudo password required for: %s", step.Name)
 			fmt.Printf("\n✗ ERROR: %s\n", errorMsg)
-			fmt.Printf("  Command: %s\n", step.Cmd)
+			fmt.Printf("  Command: %s\n", command)
 			fmt.Println("  Solutions:")
 			fmt.Println("  1. Configure passwordless sudo for this command")
-			fmt.Printf("  2. Run manually: %s\n", step.Cmd)
-			fmt.Println("  3. Run entire update with sudo: sudo daemira system:update")
+			fmt.Printf("  2. Run manually: %s\n", command)
+			fmt.Println("  3. Install the root helper: daemira helper install")
 			//nolint:SA1006 // fmt.Errorf is correct here with format string and argument
-			return fmt.Errorf("sudo password required for: %s", step.Name)
+			return runLogs, fmt.Errorf("step %s: %w", step.Name, err)
 		}
 
 		if err != nil {
 			if step.Optional {
-				su.logger.Warn("Skipped (optional): %s - %v", step.Name, err)
+				stepLog.Warn("Skipped (optional): %s - %v", step.Name, err)
 				fmt.Printf("  ⚠ Skipped (optional): %s\n", step.Name)
 				continue
 			}
-			return fmt.Errorf("step failed: %s - %w", step.Name, err)
+			return runLogs, fmt.Errorf("step failed: %s - %w", step.Name, err)
 		}
 
 		if result.TimedOut {
 			errorMsg := fmt.Sprintf("Command timed out: %s", step.Name)
-			su.logger.Error(errorMsg)
+			stepLog.Error(errorMsg)
 			fmt.Printf("  ✗ %s\n", errorMsg)
 			if step.Optional {
-				su.logger.Warn("Skipping optional step due to timeout")
+				stepLog.Warn("Skipping optional step due to timeout")
 				fmt.Println("  ⚠ Skipping optional step")
 				continue
 			}
-			return fmt.Errorf("step timed out: %s", step.Name)
+			return runLogs, fmt.Errorf("step timed out: %s", step.Name)
 		}
 
 		if result.ExitCode == 0 {
-			su.logger.Info("Completed: %s", step.Name)
+			stepLog.Info("Completed: %s", step.Name)
 			fmt.Printf("  ✓ %s\n", step.Name)
+			if step.Bootloader {
+				su.checkBootloader(ctx)
+			}
 		} else {
 			isCommandNotFound := result.Stderr != "" &&
 				(strings.Contains(strings.ToLower(result.Stderr), "command not found") ||
@@ -463,24 +745,24 @@ func (su *SystemUpdate) executeUpdateSteps(ctx context.Context) error {
 			if step.Optional {
 				if isCommandNotFound {
 					skipMsg := fmt.Sprintf("Skipped (optional): %s - command not available on this system", step.Name)
-					su.logger.Info(skipMsg)
+					stepLog.Info(skipMsg)
 					fmt.Printf("  ⚠ %s\n", skipMsg)
 				} else {
 					warnMsg := fmt.Sprintf("Skipped (optional): %s (exit code %d)", step.Name, result.ExitCode)
-					su.logger.Warn(warnMsg)
+					stepLog.Warn(warnMsg)
 					fmt.Printf("  ⚠ %s\n", warnMsg)
 				}
 			} else {
 				warnMsg := fmt.Sprintf("Warning: %s exited with code %d", step.Name, result.ExitCode)
-				su.logger.Warn(warnMsg)
+				if path := run.Path(); path != "" {
+					stepLog.Warn("%s, full output in %s", warnMsg, path)
+				} else {
+					stepLog.Warn(warnMsg)
+				}
 				fmt.Printf("  ⚠ %s\n", warnMsg)
 			}
 
 			if result.Stderr != "" && !isCommandNotFound {
-				if strings.Contains(strings.ToLower(result.Stderr), "password") ||
-					strings.Contains(strings.ToLower(result.Stderr), "sudo: a password is required") {
-					return fmt.Errorf("sudo password required for: %s. Configure passwordless sudo", step.Name)
-				}
 				errorPreview := result.Stderr
 				if len(errorPreview) > 200 {
 					errorPreview = errorPreview[:200]
@@ -490,7 +772,7 @@ func (su *SystemUpdate) executeUpdateSteps(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	return runLogs, nil
 }
 
 // executeOptimizationSteps runs post-update optimization
@@ -527,21 +809,12 @@ func (su *SystemUpdate) runTrimOperation(ctx context.Context, stepNum int) {
 	su.logger.Info("Step %d/20: Running TRIM on SSD", stepNum)
 	fmt.Printf("  [%d/20] Running TRIM on SSD...\n", stepNum)
 
-	passwordDetected := false
-	result, err := su.shell.Execute(ctx, "sudo -n fstrim -v /", &utility.ExecOptions{
+	trimCmd := su.privileges.Command("fstrim", "-v", "/")
+	result, err := su.shell.ExecuteArgs(ctx, trimCmd[0], trimCmd[1:], &utility.ExecOptions{
 		Timeout: 30 * time.Second,
-		StderrCallback: func(line string) {
-			lowerLine := strings.ToLower(line)
-			if strings.Contains(lowerLine, "password") ||
-				strings.Contains(lowerLine, "sudo: a password is required") {
-				passwordDetected = true
-			}
-		},
 	})
 
-	if passwordDetected || (result != nil && result.Stderr != "" &&
-		(strings.Contains(strings.ToLower(result.Stderr), "password") ||
-			strings.Contains(strings.ToLower(result.Stderr), "sudo: a password is required"))) {
+	if errors.Is(err, utility.ErrNeedsPassword) {
 		warnMsg := "TRIM skipped: sudo password required (run manually: sudo fstrim -v /)"
 		su.logger.Warn(warnMsg)
 		fmt.Printf("    ⚠ %s\n", warnMsg)
@@ -575,7 +848,7 @@ func (su *SystemUpdate) checkIOScheduler(ctx context.Context, stepNum int) {
 	su.logger.Info("Step %d/20: Checking I/O scheduler", stepNum)
 	fmt.Printf("  [%d/20] Checking I/O scheduler...\n", stepNum)
 
-	result, err := su.shell.Execute(ctx, "cat /sys/block/nvme0n1/queue/scheduler 2>/dev/null", &utility.ExecOptions{
+	result, err := su.shell.ExecuteArgs(ctx, "cat", []string{"/sys/block/nvme0n1/queue/scheduler"}, &utility.ExecOptions{
 		Timeout: 5 * time.Second,
 	})
 
@@ -604,7 +877,10 @@ func (su *SystemUpdate) checkSmartHealth(ctx context.Context, stepNum int) {
 	fmt.Printf("  [%d/20] Checking SMART disk health...\n", stepNum)
 
 	// Get list of disk devices
-	result, err := su.shell.Execute(ctx, "lsblk -d -n -o NAME | grep -E '^[sv]d[a-z]|^nvme'", &utility.ExecOptions{
+	result, err := su.shell.Execute(ctx, utility.Pipeline(
+		[]string{"lsblk", "-d", "-n", "-o", "NAME"},
+		[]string{"grep", "-E", "^[sv]d[a-z]|^nvme"},
+	), &utility.ExecOptions{
 		Timeout: 5 * time.Second,
 	})
 
@@ -625,7 +901,7 @@ func (su *SystemUpdate) checkSmartHealth(ctx context.Context, stepNum int) {
 
 	for _, device := range devices {
 		devicePath := "/dev/" + device
-		smartResult, err := su.shell.Execute(ctx, fmt.Sprintf("sudo -n smartctl -H %s 2>/dev/null", devicePath), &utility.ExecOptions{
+		smartResult, err := su.shell.ExecuteArgs(ctx, "sudo", []string{"-n", "smartctl", "-H", devicePath}, &utility.ExecOptions{
 			Timeout: 10 * time.Second,
 		})
 
@@ -660,7 +936,7 @@ func (su *SystemUpdate) checkPowerProfile(ctx context.Context, stepNum int) {
 	su.logger.Info("Step %d/20: Checking power profile", stepNum)
 	fmt.Printf("  [%d/20] Checking power profile...\n", stepNum)
 
-	result, err := su.shell.Execute(ctx, "powerprofilesctl get 2>/dev/null", &utility.ExecOptions{
+	result, err := su.shell.ExecuteArgs(ctx, "powerprofilesctl", []string{"get"}, &utility.ExecOptions{
 		Timeout: 5 * time.Second,
 	})
 
@@ -682,7 +958,7 @@ func (su *SystemUpdate) checkSwappiness(ctx context.Context, stepNum int) {
 	su.logger.Info("Step %d/20: Checking memory swappiness", stepNum)
 	fmt.Printf("  [%d/20] Checking memory swappiness...\n", stepNum)
 
-	result, err := su.shell.Execute(ctx, "cat /proc/sys/vm/swappiness", &utility.ExecOptions{
+	result, err := su.shell.ExecuteArgs(ctx, "cat", []string{"/proc/sys/vm/swappiness"}, &utility.ExecOptions{
 		Timeout: 2 * time.Second,
 	})
 
@@ -755,7 +1031,7 @@ func (su *SystemUpdate) rebuildDKMSModules(ctx context.Context, stepNum int) {
 	su.logger.Info("Step %d/20: Checking DKMS modules", stepNum)
 	fmt.Printf("  [%d/20] Checking DKMS modules...\n", stepNum)
 
-	statusResult, err := su.shell.Execute(ctx, "dkms status", &utility.ExecOptions{
+	statusResult, err := su.shell.ExecuteArgs(ctx, "dkms", []string{"status"}, &utility.ExecOptions{
 		Timeout: 10 * time.Second,
 	})
 
@@ -768,30 +1044,15 @@ func (su *SystemUpdate) rebuildDKMSModules(ctx context.Context, stepNum int) {
 
 	su.logger.Info("DKMS modules present, verifying installation")
 
-	// Determine command prefix based on whether we're root
-	dkmsCmd := "dkms autoinstall"
-	if !su.isRoot() {
-		dkmsCmd = "sudo -n " + dkmsCmd
-	}
-
-	passwordDetected := false
-	result, err := su.shell.Execute(ctx, dkmsCmd, &utility.ExecOptions{
+	dkmsCmd := su.privileges.Command("dkms", "autoinstall")
+	result, err := su.shell.ExecuteArgs(ctx, dkmsCmd[0], dkmsCmd[1:], &utility.ExecOptions{
 		Timeout: 2 * time.Minute,
 		StdoutCallback: func(line string) {
 			su.logger.Debug("  %s", line)
 		},
-		StderrCallback: func(line string) {
-			lowerLine := strings.ToLower(line)
-			if strings.Contains(lowerLine, "password") ||
-				strings.Contains(lowerLine, "sudo: a password is required") {
-				passwordDetected = true
-			}
-		},
 	})
 
-	if passwordDetected || (result != nil && result.Stderr != "" &&
-		(strings.Contains(strings.ToLower(result.Stderr), "password") ||
-			strings.Contains(strings.ToLower(result.Stderr), "sudo: a password is required"))) {
+	if errors.Is(err, utility.ErrNeedsPassword) {
 		msg := "DKMS check skipped: sudo password required"
 		su.logger.Warn(msg)
 		fmt.Printf("    ⚠ %s\n", msg)
@@ -850,7 +1111,7 @@ func (su *SystemUpdate) postUpdateVerification(ctx context.Context) {
 	su.logger.Info("Running post-update verification...")
 
 	// Check for any systemd service failures
-	result, err := su.shell.Execute(ctx, "systemctl --failed --no-legend --no-pager", &utility.ExecOptions{
+	result, err := su.shell.ExecuteArgs(ctx, "systemctl", []string{"--failed", "--no-legend", "--no-pager"}, &utility.ExecOptions{
 		Timeout: 10 * time.Second,
 	})
 
@@ -0,0 +1,173 @@
+package systemupdate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// newTestUpdate creates a SystemUpdate running its commands with runner.
+// Run logs and the state store go to a temporary directory, and with
+// nothing in PATH the optional steps are skipped.
+func newTestUpdate(t *testing.T, runner *utility.FakeRunner) *SystemUpdate {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	t.Setenv("PATH", dir)
+
+	su := NewSystemUpdate(nil, nil)
+	su.SetRunner(runner)
+	return su
+}
+
+func TestOrphanRemoval(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  utility.Result
+		want    string // the end of the removal command, "" for none
+		wantErr string
+	}{
+		{
+			name:   "no orphans",
+			answer: utility.Result{ExitCode: 1},
+		},
+		{
+			name:   "orphans are passed as arguments",
+			answer: utility.Result{Stdout: "libfoo\npython-bar\n"},
+			want:   "pacman -Rns --noconfirm libfoo python-bar",
+		},
+		{
+			name:    "locked database",
+			answer:  fixturePacmanLocked,
+			wantErr: "unable to lock database",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			su := newTestUpdate(t, utility.NewFakeRunner().On(`^pacman -Qdtq$`, tt.answer))
+
+			args, err := su.orphanRemoval(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("orphanRemoval() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orphanRemoval() = %v", err)
+			}
+			if tt.want == "" && args != nil {
+				t.Errorf("orphanRemoval() = %q, want nothing to run", args)
+			}
+			if tt.want != "" && !strings.HasSuffix(strings.Join(args, " "), tt.want) {
+				t.Errorf("orphanRemoval() = %q, want it to end in %q", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteUpdateSteps(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   func(f *utility.FakeRunner)
+		wantErr  string
+		wantRuns map[string]int // commands matching each pattern, run
+	}{
+		{
+			name: "update",
+			answer: func(f *utility.FakeRunner) {
+				f.On(`pacman -Syy --noconfirm$`, fixturePacmanUpToDate).
+					On(`pacman -Syu --noconfirm$`, fixturePacmanUpToDate).
+					On(`^pacman -Qdtq$`, utility.Result{Stdout: "libfoo"})
+			},
+			wantRuns: map[string]int{
+				`pacman -Syu --noconfirm$`:         1,
+				`pacman -Rns --noconfirm libfoo$`:  1,
+				`grub-mkconfig -o /boot/grub/grub`: 1,
+				`pacman-mirrors`:                   0,
+			},
+		},
+		{
+			name: "mirror outage is retried",
+			answer: func(f *utility.FakeRunner) {
+				f.On(`pacman -Syy --noconfirm$`, fixturePacmanMirrorDown).
+					On(`pacman -Syy --noconfirm$`, fixturePacmanUpToDate)
+			},
+			wantRuns: map[string]int{
+				`pacman -Syy --noconfirm$`: 2,
+				`pacman -Syu --noconfirm$`: 1,
+			},
+		},
+		{
+			name: "failing step is reported and the update goes on",
+			answer: func(f *utility.FakeRunner) {
+				f.On(`pacman -Sy --needed`, fixturePacmanTargetNotFound)
+			},
+			wantRuns: map[string]int{
+				`pacman -Sy --needed`:      1,
+				`pacman -Syu --noconfirm$`: 1,
+			},
+		},
+		{
+			name: "step that can't start stops the update",
+			answer: func(f *utility.FakeRunner) {
+				f.OnError(`pacman -Syy --noconfirm$`, errors.New("fork/exec /usr/bin/pacman: permission denied"))
+			},
+			wantErr: "Updating package databases",
+			wantRuns: map[string]int{
+				`pacman -Syy --noconfirm$`: 1,
+				`pacman -Syu --noconfirm$`: 0,
+			},
+		},
+		{
+			name: "empty orphan list skips the removal",
+			answer: func(f *utility.FakeRunner) {
+				f.On(`^pacman -Qdtq$`, utility.Result{ExitCode: 1})
+			},
+			wantRuns: map[string]int{
+				`pacman -Rns`:    0,
+				`paccache -rk2$`: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := utility.NewFakeRunner()
+			tt.answer(runner)
+			su := newTestUpdate(t, runner)
+
+			_, err := su.executeUpdateSteps(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("executeUpdateSteps() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("executeUpdateSteps() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			for pattern, want := range tt.wantRuns {
+				if runs := runner.Ran(pattern); runs != want {
+					t.Errorf("%s ran %d times, want %d; ran %q", pattern, runs, want, runner.Commands())
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteUpdateStepsNeedsPassword(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("as root the steps run without sudo")
+	}
+	runner := utility.NewFakeRunner().On(`^sudo -n pacman -Sy --needed`, fixtureSudoPasswordRequired)
+	su := newTestUpdate(t, runner)
+
+	_, err := su.executeUpdateSteps(context.Background())
+	if !errors.Is(err, utility.ErrNeedsPassword) {
+		t.Errorf("executeUpdateSteps() = %v, want ErrNeedsPassword", err)
+	}
+	if runs := runner.Ran(`pacman -Syy`); runs != 0 {
+		t.Errorf("the update went on after sudo asked for a password; ran %q", runner.Commands())
+	}
+}
@@ -0,0 +1,398 @@
+/**
+ * Wallpaper rotator
+ * Rotates wallpapers from a directory on a schedule via swww, hyprpaper or swaybg,
+ * optionally switching between light and dark sets (and the GTK color scheme)
+ * based on time of day
+ */
+
+package wallpaper
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ln64-git/daemira/src/utility"
+)
+
+// Backend is the program used to set the wallpaper
+type Backend string
+
+const (
+	BackendAuto      Backend = "auto"
+	BackendSwww      Backend = "swww"
+	BackendHyprpaper Backend = "hyprpaper"
+	BackendSwaybg    Backend = "swaybg"
+)
+
+// imageExtensions are the file types picked up from wallpaper directories
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".gif":  true,
+}
+
+// WallpaperOptions configures the rotator
+type WallpaperOptions struct {
+	Directory      string        // default wallpaper set
+	LightDirectory string        // used during the day if set
+	DarkDirectory  string        // used at night if set
+	Interval       time.Duration // 0 disables scheduled rotation
+	Backend        Backend
+	LightStart     string // "HH:MM", default 07:00
+	DarkStart      string // "HH:MM", default 19:00
+}
+
+// WallpaperRotator rotates wallpapers on a schedule
+type WallpaperRotator struct {
+	logger    *utility.Logger
+	shell     *utility.Shell
+	options   WallpaperOptions
+	statePath string
+	lastDark  *bool
+	isRunning bool
+	mu        sync.Mutex
+}
+
+// Scheduler jobs of the rotator
+const (
+	wallpaperJob      = "wallpaper"       // rotates every interval
+	wallpaperThemeJob = "wallpaper-theme" // rotates on light/dark transitions
+)
+
+// NewWallpaperRotator creates a new WallpaperRotator instance
+func NewWallpaperRotator(logger *utility.Logger, options *WallpaperOptions) *WallpaperRotator {
+	if logger == nil {
+		logger = utility.GetLogger()
+	}
+
+	opts := WallpaperOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Backend == "" {
+		opts.Backend = BackendAuto
+	}
+	if opts.LightStart == "" {
+		opts.LightStart = "07:00"
+	}
+	if opts.DarkStart == "" {
+		opts.DarkStart = "19:00"
+	}
+
+	return &WallpaperRotator{
+		logger:    logger.With("wallpaper"),
+		shell:     utility.NewShell(logger),
+		options:   opts,
+		statePath: filepath.Join(utility.StateDir(), "wallpaper"),
+	}
+}
+
+// IsConfigured returns true if any wallpaper directory is set
+func (wr *WallpaperRotator) IsConfigured() bool {
+	return wr.options.Directory != "" || wr.options.LightDirectory != "" || wr.options.DarkDirectory != ""
+}
+
+// Start rotates the wallpaper every interval and on light/dark transitions
+func (wr *WallpaperRotator) Start() {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.isRunning {
+		wr.logger.Warn("Wallpaper rotator already running")
+		return
+	}
+
+	wr.isRunning = true
+	wr.logger.Info("Starting wallpaper rotator (interval: %v)", wr.options.Interval)
+
+	utility.Go("wallpaper", func() {
+		if _, err := wr.Next(context.Background()); err != nil {
+			wr.logger.Warn("Failed to set wallpaper: %v", err)
+		}
+	})
+
+	scheduler := utility.GetScheduler()
+	if wr.options.Interval > 0 {
+		scheduler.Add(utility.Job{
+			ID:          wallpaperJob,
+			Description: "Rotate the wallpaper",
+			Schedule:    utility.Every(wr.options.Interval),
+			Run:         wr.rotate,
+		})
+	}
+	if wr.usesSchedule() {
+		// The light/dark period is checked every minute
+		scheduler.Add(utility.Job{
+			ID:          wallpaperThemeJob,
+			Description: "Switch between light and dark wallpapers",
+			Schedule:    utility.Every(time.Minute),
+			Run: func(ctx context.Context) error {
+				if !wr.themeChanged(time.Now()) {
+					return nil
+				}
+				return wr.rotate(ctx)
+			},
+		})
+	}
+}
+
+// rotate sets the next wallpaper
+func (wr *WallpaperRotator) rotate(ctx context.Context) error {
+	if _, err := wr.Next(ctx); err != nil {
+		return fmt.Errorf("failed to rotate wallpaper: %w", err)
+	}
+	return nil
+}
+
+// Stop halts the rotator
+func (wr *WallpaperRotator) Stop() {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if !wr.isRunning {
+		return
+	}
+
+	wr.isRunning = false
+	utility.GetScheduler().Remove(wallpaperJob)
+	utility.GetScheduler().Remove(wallpaperThemeJob)
+	wr.logger.Info("Wallpaper rotator stopped")
+}
+
+// IsDark returns true if t falls inside the dark period of the schedule
+func (wr *WallpaperRotator) IsDark(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	light := parseClock(wr.options.LightStart, 7*60)
+	dark := parseClock(wr.options.DarkStart, 19*60)
+
+	if light < dark {
+		return minutes < light || minutes >= dark
+	}
+	return minutes >= dark && minutes < light
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(clock string, fallback int) int {
+	var hour, minute int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil {
+		return fallback
+	}
+	return hour*60 + minute
+}
+
+// usesSchedule returns true if separate light/dark sets are configured
+func (wr *WallpaperRotator) usesSchedule() bool {
+	return wr.options.LightDirectory != "" || wr.options.DarkDirectory != ""
+}
+
+// themeChanged reports whether the light/dark period changed since the last check
+func (wr *WallpaperRotator) themeChanged(now time.Time) bool {
+	if !wr.usesSchedule() {
+		return false
+	}
+
+	dark := wr.IsDark(now)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	changed := wr.lastDark != nil && *wr.lastDark != dark
+	wr.lastDark = &dark
+	return changed
+}
+
+// activeDirectory returns the wallpaper directory for the current time
+func (wr *WallpaperRotator) activeDirectory(now time.Time) string {
+	if wr.usesSchedule() {
+		if wr.IsDark(now) && wr.options.DarkDirectory != "" {
+			return wr.options.DarkDirectory
+		}
+		if !wr.IsDark(now) && wr.options.LightDirectory != "" {
+			return wr.options.LightDirectory
+		}
+	}
+	return wr.options.Directory
+}
+
+// listImages returns all images in a directory, sorted by name
+func listImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wallpaper directory: %w", err)
+	}
+
+	images := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if imageExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			images = append(images, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// Next switches to a random wallpaper (other than the current one) and returns its path
+func (wr *WallpaperRotator) Next(ctx context.Context) (string, error) {
+	now := time.Now()
+	dir := wr.activeDirectory(now)
+	if dir == "" {
+		return "", fmt.Errorf("no wallpaper directory configured")
+	}
+
+	images, err := listImages(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("no images found in %s", dir)
+	}
+
+	current := wr.Current()
+	candidates := []string{}
+	for _, image := range images {
+		if image != current {
+			candidates = append(candidates, image)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = images
+	}
+
+	path := candidates[rand.Intn(len(candidates))]
+	if err := wr.Set(ctx, path); err != nil {
+		return "", err
+	}
+
+	if wr.usesSchedule() {
+		wr.applyColorScheme(ctx, wr.IsDark(now))
+	}
+	return path, nil
+}
+
+// Set changes the wallpaper to the given image
+func (wr *WallpaperRotator) Set(ctx context.Context, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid wallpaper path: %w", err)
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("wallpaper not found: %w", err)
+	}
+
+	backend := wr.options.Backend
+	if backend == BackendAuto {
+		backend = wr.detectBackend(ctx)
+	}
+
+	quoted := "'" + strings.ReplaceAll(absPath, "'", `'"'"'`) + "'"
+	var command string
+	switch backend {
+	case BackendSwww:
+		command = fmt.Sprintf("swww img %s --transition-type fade", quoted)
+	case BackendHyprpaper:
+		command = fmt.Sprintf("hyprctl hyprpaper preload %s && hyprctl hyprpaper wallpaper ,%s && hyprctl hyprpaper unload unused",
+			quoted, quoted)
+	case BackendSwaybg:
+		command = fmt.Sprintf("pkill -x swaybg; setsid -f swaybg -i %s -m fill >/dev/null 2>&1", quoted)
+	default:
+		return fmt.Errorf("no wallpaper backend available (install swww, hyprpaper or swaybg)")
+	}
+
+	result, err := wr.shell.Execute(ctx, command, &utility.ExecOptions{
+		Timeout: 15 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set wallpaper via %s: %w", backend, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to set wallpaper via %s: %s", backend, result.Stderr)
+	}
+
+	if _, err := utility.EnsureDir(filepath.Dir(wr.statePath)); err == nil {
+		os.WriteFile(wr.statePath, []byte(absPath), 0644)
+	}
+
+	wr.logger.Info("Wallpaper set to %s (%s)", filepath.Base(absPath), backend)
+	return nil
+}
+
+// Current returns the last wallpaper set by daemira
+func (wr *WallpaperRotator) Current() string {
+	data, err := os.ReadFile(wr.statePath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// detectBackend picks the running wallpaper daemon, falling back to whatever is installed
+func (wr *WallpaperRotator) detectBackend(ctx context.Context) Backend {
+	daemons := []struct {
+		process string
+		backend Backend
+	}{
+		{"swww-daemon", BackendSwww},
+		{"hyprpaper", BackendHyprpaper},
+		{"swaybg", BackendSwaybg},
+	}
+
+	for _, daemon := range daemons {
+		if result, err := wr.shell.Execute(ctx, "pgrep -x "+daemon.process, &utility.ExecOptions{
+			Timeout: 5 * time.Second,
+		}); err == nil && result.ExitCode == 0 {
+			return daemon.backend
+		}
+	}
+
+	// Nothing running: swaybg can be spawned on demand
+	if result, err := wr.shell.Execute(ctx, "command -v swaybg", &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	}); err == nil && result.ExitCode == 0 {
+		return BackendSwaybg
+	}
+	return ""
+}
+
+// applyColorScheme switches the GTK/portal color scheme to match the schedule
+func (wr *WallpaperRotator) applyColorScheme(ctx context.Context, dark bool) {
+	scheme := "prefer-light"
+	if dark {
+		scheme = "prefer-dark"
+	}
+
+	result, err := wr.shell.Execute(ctx, fmt.Sprintf("gsettings set org.gnome.desktop.interface color-scheme %s", scheme), &utility.ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil || result.ExitCode != 0 {
+		wr.logger.Debug("Failed to set color scheme: %v", err)
+	}
+}
+
+// GetStatus returns the rotator status
+func (wr *WallpaperRotator) GetStatus() map[string]interface{} {
+	wr.mu.Lock()
+	running := wr.isRunning
+	wr.mu.Unlock()
+
+	now := time.Now()
+	return map[string]interface{}{
+		"running":   running,
+		"current":   wr.Current(),
+		"directory": wr.activeDirectory(now),
+		"interval":  wr.options.Interval.String(),
+		"backend":   string(wr.options.Backend),
+		"dark":      wr.usesSchedule() && wr.IsDark(now),
+		"schedule":  wr.usesSchedule(),
+	}
+}
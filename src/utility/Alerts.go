@@ -0,0 +1,202 @@
+/**
+ * Alerts - Problems that need the user, and which ones they already know of
+ * Health checks raise an alert while a problem lasts (a disk running out of
+ * space, a failing SMART check) and resolve it once it's gone. A new alert
+ * is sent as a desktop notification and re-sent every day it stays; once
+ * acknowledged it isn't sent again until it gets worse, and while silenced
+ * it isn't sent at all. Alerts are kept in the state store.
+ */
+
+package utility
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// alertRenotifyInterval is how often an alert nobody acknowledged is sent again
+const alertRenotifyInterval = 24 * time.Hour
+
+// alertsState is the state store section keeping the alerts
+const alertsState = "alerts"
+
+// Alert severities
+const (
+	AlertWarning  = "warning"
+	AlertCritical = "critical"
+)
+
+// ErrUnknownAlert is returned when an alert asked for isn't active
+var ErrUnknownAlert = errors.New("no such alert")
+
+// Alert is an active problem
+type Alert struct {
+	ID            string    `json:"id"` // e.g. "disk-home" or "smart-sda"
+	Severity      string    `json:"severity"`
+	Summary       string    `json:"summary"`
+	Detail        string    `json:"detail,omitempty"`
+	Raised        time.Time `json:"raised"`
+	Notified      time.Time `json:"notified"`
+	Acknowledged  time.Time `json:"acknowledged"`
+	SilencedUntil time.Time `json:"silenced_until"`
+}
+
+// Silenced reports whether the alert is silenced now
+func (a Alert) Silenced() bool {
+	return time.Now().Before(a.SilencedUntil)
+}
+
+// Known reports whether the user acknowledged or silenced the alert
+func (a Alert) Known() bool {
+	return !a.Acknowledged.IsZero() || a.Silenced()
+}
+
+// Alerts keeps the active alerts
+type Alerts struct {
+	logger *Logger
+	alerts map[string]*Alert
+	mu     sync.Mutex
+}
+
+var (
+	alertsInstance *Alerts
+	alertsOnce     sync.Once
+)
+
+// GetAlerts returns the singleton Alerts instance
+func GetAlerts() *Alerts {
+	alertsOnce.Do(func() {
+		alertsInstance = &Alerts{
+			logger: GetLogger().With("alerts"),
+			alerts: make(map[string]*Alert),
+		}
+		GetStateStore().Load(alertsState, &alertsInstance.alerts)
+		if alertsInstance.alerts == nil {
+			alertsInstance.alerts = make(map[string]*Alert)
+		}
+	})
+	return alertsInstance
+}
+
+// Raise reports a problem that is still there, sending it unless it is
+// known or was sent within the last day. An alert that turns critical
+// counts as new again.
+func (a *Alerts) Raise(id, severity, summary, detail string) {
+	a.mu.Lock()
+	now := time.Now()
+	alert, ok := a.alerts[id]
+	switch {
+	case !ok:
+		alert = &Alert{ID: id, Raised: now}
+		a.alerts[id] = alert
+		a.logger.Info("Alert %s raised: %s", id, summary)
+	case severity == AlertCritical && alert.Severity != AlertCritical:
+		alert.Raised = now
+		alert.Notified = time.Time{}
+		alert.Acknowledged = time.Time{}
+		alert.SilencedUntil = time.Time{}
+		a.logger.Info("Alert %s turned critical: %s", id, summary)
+	}
+	// A detail that changes every check (free space left) isn't worth a write
+	changed := alert.Severity != severity || alert.Summary != summary
+	alert.Severity = severity
+	alert.Summary = summary
+	alert.Detail = detail
+
+	send := !alert.Known() && now.Sub(alert.Notified) >= alertRenotifyInterval
+	if send {
+		alert.Notified = now
+		changed = true
+	}
+	if changed {
+		a.save()
+	}
+	a.mu.Unlock()
+
+	// Sent outside the lock, as notify-send can take a few seconds
+	if send {
+		urgency := UrgencyNormal
+		if severity == AlertCritical {
+			urgency = UrgencyCritical
+		}
+		if err := GetNotifier().Notify(summary, detail, urgency); err != nil {
+			a.logger.Warn("Failed to send alert %s: %v", id, err)
+		}
+	}
+}
+
+// Resolve clears an alert whose problem is gone
+func (a *Alerts) Resolve(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.alerts[id]; !ok {
+		return
+	}
+	delete(a.alerts, id)
+	a.logger.Info("Alert %s resolved", id)
+	a.save()
+}
+
+// Acknowledge marks an alert as known, so it isn't sent again unless it
+// gets worse
+func (a *Alerts) Acknowledge(id string) (Alert, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alert, ok := a.alerts[id]
+	if !ok {
+		return Alert{}, fmt.Errorf("%s: %w", id, ErrUnknownAlert)
+	}
+	alert.Acknowledged = time.Now()
+	a.logger.Info("Alert %s acknowledged", id)
+	a.save()
+	return *alert, nil
+}
+
+// Silence keeps an alert from being sent for a while; a zero duration ends
+// the silence
+func (a *Alerts) Silence(id string, duration time.Duration) (Alert, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alert, ok := a.alerts[id]
+	if !ok {
+		return Alert{}, fmt.Errorf("%s: %w", id, ErrUnknownAlert)
+	}
+	if duration > 0 {
+		alert.SilencedUntil = time.Now().Add(duration)
+		a.logger.Info("Alert %s silenced for %v", id, duration)
+	} else {
+		alert.SilencedUntil = time.Time{}
+		a.logger.Info("Alert %s no longer silenced", id)
+	}
+	a.save()
+	return *alert, nil
+}
+
+// List returns the active alerts, critical ones first
+func (a *Alerts) List() []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(a.alerts))
+	for _, alert := range a.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Severity != alerts[j].Severity {
+			return alerts[i].Severity == AlertCritical
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+	return alerts
+}
+
+// save keeps the alerts in the state store; call with mu held
+func (a *Alerts) save() {
+	GetStateStore().Save(alertsState, a.alerts)
+}
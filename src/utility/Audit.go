@@ -0,0 +1,170 @@
+/**
+ * Audit - Append-only record of privileged and destructive actions
+ * Commands run through sudo, service and power changes, written and deleted
+ * files and files deleted on the remote by a sync are appended to audit.log
+ * in the state directory with when, who and what started them, for
+ * `daemira audit`.
+ */
+
+package utility
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditSudo         = "sudo"          // a command run through sudo
+	AuditPrivileged   = "privileged"    // a system command run as root
+	AuditService      = "service"       // a systemd unit enabled, disabled, started or stopped
+	AuditPower        = "power"         // suspend, reboot or power off
+	AuditPowerProfile = "power-profile" // power profile changed
+	AuditDelete       = "delete"        // a local file or directory removed
+	AuditWrite        = "write"         // a config file installed, replaced or restored
+	AuditPermissions  = "permissions"   // a file's owner or mode set back
+	AuditRemoteDelete = "remote-delete" // files deleted on the remote by a sync
+)
+
+// Audit initiators
+const (
+	InitiatorCLI       = "cli"       // a command the user ran
+	InitiatorScheduler = "scheduler" // the daemon on its own
+)
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Initiator string    `json:"initiator"`
+	User      string    `json:"user"`
+	PID       int       `json:"pid"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+var (
+	auditInitiator = InitiatorCLI
+	auditMu        sync.Mutex
+)
+
+var (
+	// sudoPattern finds sudo invoked anywhere in a shell command
+	sudoPattern = regexp.MustCompile(`(^|[;&|(]|\s)sudo\s`)
+	// rootHelperPattern finds a command run through the root helper
+	rootHelperPattern = regexp.MustCompile(`\shelper exec --\s`)
+	// servicePattern finds systemctl changing a unit
+	servicePattern = regexp.MustCompile(`\bsystemctl\b.*\s(enable|disable|start|stop|restart|mask|unmask)\s`)
+	// powerPattern finds systemctl changing the power state
+	powerPattern = regexp.MustCompile(`\bsystemctl\b.*\s(suspend|hibernate|hybrid-sleep|reboot|poweroff)\b`)
+	// powerProfilePattern finds a power profile change
+	powerProfilePattern = regexp.MustCompile(`\bpowerprofilesctl\s+set\b`)
+)
+
+// AuditPath returns the audit log file
+func AuditPath() string {
+	return filepath.Join(StateDir(), "audit.log")
+}
+
+// SetAuditInitiator sets what started this process's actions: InitiatorCLI
+// (the default) or InitiatorScheduler for the daemon
+func SetAuditInitiator(initiator string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditInitiator = initiator
+}
+
+// Audit appends an action to the audit log. Failing to write it is logged
+// but does not stop the action.
+func Audit(action, target, detail string) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	entry := AuditEntry{
+		Time:      time.Now(),
+		Initiator: auditInitiator,
+		PID:       os.Getpid(),
+		Action:    action,
+		Target:    Redact(target),
+		Detail:    Redact(detail),
+	}
+	if current, err := user.Current(); err == nil {
+		entry.User = current.Username
+	}
+
+	if err := appendAudit(entry); err != nil {
+		GetLogger().With("audit").Warn("Failed to write audit log: %v", err)
+	}
+}
+
+// appendAudit writes one entry to the end of the audit log
+func appendAudit(entry AuditEntry) error {
+	if _, err := EnsureDir(StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	file, err := os.OpenFile(AuditPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// auditCommandAction returns the audit action of a shell command, or "" if
+// it needs no record
+func auditCommandAction(command string) string {
+	switch {
+	case powerProfilePattern.MatchString(command):
+		return AuditPowerProfile
+	case powerPattern.MatchString(command):
+		return AuditPower
+	case servicePattern.MatchString(command):
+		return AuditService
+	case sudoPattern.MatchString(command):
+		return AuditSudo
+	case rootHelperPattern.MatchString(command):
+		return AuditPrivileged
+	}
+	return ""
+}
+
+// ReadAudit reads the audit log, oldest first
+func ReadAudit() ([]AuditEntry, error) {
+	file, err := os.Open(AuditPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
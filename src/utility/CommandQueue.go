@@ -0,0 +1,158 @@
+/**
+ * CommandQueue - Limits on how many commands run at once
+ * Every command Shell runs takes a slot of its category (one pacman, two
+ * rclone transfers, eight quick probes) and one of the global limit, waiting
+ * in line when they are taken, so bursts of status queries and syncs can't
+ * spawn dozens of processes. Queue depths show in `daemira diagnostics`.
+ */
+
+package utility
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxConcurrentCommands is how many commands run at once in total
+const maxConcurrentCommands = 16
+
+// probeTimeout is the longest timeout of a quick probe; such commands share
+// the probe limit whatever they run, so they don't wait behind long transfers
+const probeTimeout = 15 * time.Second
+
+// commandCategories groups programs that share a limit
+var commandCategories = map[string]string{
+	"pacman":         "pacman",
+	"pacman-mirrors": "pacman",
+	"paccache":       "pacman",
+	"yay":            "pacman",
+	"makepkg":        "pacman",
+	"remove-orphans": "pacman", // the root helper's
+	"rclone":         "rclone",
+}
+
+// QueueStats describes a command limit
+type QueueStats struct {
+	Limit       int           `json:"limit"`
+	Running     int           `json:"running"`
+	Waiting     int           `json:"waiting"`
+	PeakWaiting int           `json:"peakWaiting"` // most commands waiting at once
+	Waited      int           `json:"waited"`      // commands that had to wait
+	WaitTime    time.Duration `json:"waitTime"`    // time spent waiting in total
+}
+
+// commandQueue is a limit on concurrent commands
+type commandQueue struct {
+	slots chan struct{}
+	stats QueueStats
+}
+
+var (
+	globalQueue    = newCommandQueue(maxConcurrentCommands)
+	categoryQueues = map[string]*commandQueue{
+		"pacman": newCommandQueue(1),
+		"rclone": newCommandQueue(2),
+		"probe":  newCommandQueue(8),
+	}
+	queueMu sync.Mutex
+)
+
+// newCommandQueue creates a queue letting limit commands run at once
+func newCommandQueue(limit int) *commandQueue {
+	return &commandQueue{
+		slots: make(chan struct{}, limit),
+		stats: QueueStats{Limit: limit},
+	}
+}
+
+// acquire takes a slot, waiting in line until one is free or ctx is done
+func (q *commandQueue) acquire(ctx context.Context) error {
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	queueMu.Lock()
+	q.stats.Waiting++
+	q.stats.Waited++
+	if q.stats.Waiting > q.stats.PeakWaiting {
+		q.stats.PeakWaiting = q.stats.Waiting
+	}
+	queueMu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		queueMu.Lock()
+		q.stats.Waiting--
+		q.stats.WaitTime += time.Since(start)
+		queueMu.Unlock()
+	}()
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire
+func (q *commandQueue) release() {
+	<-q.slots
+}
+
+// commandCategory returns the limit a command falls under, or "" for only the global one
+func commandCategory(command string, timeout time.Duration) string {
+	if timeout > 0 && timeout <= probeTimeout {
+		return "probe"
+	}
+	return commandCategories[commandName(command)]
+}
+
+// acquireCommandSlot waits for a slot of the command's category, then of the
+// global limit, and returns the function that frees them
+func acquireCommandSlot(ctx context.Context, command string, timeout time.Duration) (func(), error) {
+	category := commandCategory(command, timeout)
+	queue := categoryQueues[category]
+	if queue != nil {
+		if err := queue.acquire(ctx); err != nil {
+			return nil, fmt.Errorf("cancelled while waiting for a %s slot: %w", category, err)
+		}
+	}
+	if err := globalQueue.acquire(ctx); err != nil {
+		if queue != nil {
+			queue.release()
+		}
+		return nil, fmt.Errorf("cancelled while waiting for a command slot: %w", err)
+	}
+
+	return func() {
+		globalQueue.release()
+		if queue != nil {
+			queue.release()
+		}
+	}, nil
+}
+
+// CommandQueues returns the state of each command limit, the global one as "all"
+func CommandQueues() map[string]QueueStats {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	stats := make(map[string]QueueStats, len(categoryQueues)+1)
+	for category, queue := range categoryQueues {
+		stats[category] = queue.snapshot()
+	}
+	stats["all"] = globalQueue.snapshot()
+	return stats
+}
+
+// snapshot copies the queue's stats; the caller holds queueMu
+func (q *commandQueue) snapshot() QueueStats {
+	stats := q.stats
+	stats.Running = len(q.slots)
+	return stats
+}
@@ -0,0 +1,28 @@
+package utility
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommandCategory(t *testing.T) {
+	tests := []struct {
+		command string
+		timeout time.Duration
+		want    string
+	}{
+		{"pacman -Syu --noconfirm", time.Minute, "pacman"},
+		{"sudo -n pacman -Syu --noconfirm", time.Minute, "pacman"},
+		// Through the root helper the wrapped command counts
+		{"/usr/local/bin/daemira helper exec -- pacman -Syu --noconfirm", time.Minute, "pacman"},
+		{"/usr/local/bin/daemira helper exec -- remove-orphans", time.Minute, "pacman"},
+		{"/usr/local/bin/daemira helper exec -- fstrim -v /", time.Minute, ""},
+		{"rclone bisync a b", -1, "rclone"},
+		{"pacman -Qdtq", 10 * time.Second, "probe"},
+	}
+	for _, tt := range tests {
+		if got := commandCategory(tt.command, tt.timeout); got != tt.want {
+			t.Errorf("commandCategory(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/**
+ * Cron - Schedules for the scheduler
+ * A schedule is an interval ("6h", "@every 6h"), a cron expression with the
+ * usual five fields ("0 4 * * *", "30 9-17/2 * * mon-fri") or one of the
+ * macros @hourly, @daily, @weekly, @monthly and @yearly. Cron expressions are
+ * read in local time.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives the times a job runs at
+type Schedule interface {
+	// Next returns the first run after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// intervalSchedule runs a fixed time after the previous run
+type intervalSchedule time.Duration
+
+// Every returns a schedule running every d
+func Every(d time.Duration) Schedule {
+	return intervalSchedule(d)
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func (s intervalSchedule) String() string {
+	return "every " + formatInterval(time.Duration(s))
+}
+
+// formatInterval writes a duration without zero units, e.g. 6h instead of 6h0m0s
+func formatInterval(d time.Duration) string {
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// cronSchedule runs at the minutes matching all five fields
+type cronSchedule struct {
+	spec    string
+	minute  uint64
+	hour    uint64
+	day     uint64
+	month   uint64
+	weekday uint64
+	// Whether day and weekday were restricted; if both are, either matches
+	dayStar, weekdayStar bool
+}
+
+// cronMacros are the @ shorthands for cron expressions
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the range and names of a cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names of min, min+1, ...
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// ParseSchedule parses an interval, cron expression or macro
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		spec = strings.TrimSpace(interval)
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least 1m", spec)
+		}
+		return Every(d), nil
+	}
+
+	expr := spec
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected an interval like 6h, five cron fields or a macro like @daily", spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = parseCronField(field, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+	// Sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &cronSchedule{
+		spec:        spec,
+		minute:      bits[0],
+		hour:        bits[1],
+		day:         bits[2],
+		month:       bits[3],
+		weekday:     bits[4],
+		dayStar:     strings.HasPrefix(fields[2], "*"),
+		weekdayStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses a comma-separated list of *, values and ranges,
+// each with an optional /step, into a bit set
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, spec.name)
+			}
+		}
+
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseCronValue(first, spec); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = parseCronValue(last, spec); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = spec.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, spec.name)
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a number or name within a field's range
+func parseCronValue(value string, spec cronField) (int, error) {
+	for i, name := range spec.names {
+		if strings.EqualFold(value, name) {
+			return spec.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid %s %q (expected %d-%d)", spec.name, value, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Impossible dates like Feb 30 would loop forever
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		year, month, day := t.Date()
+		switch {
+		case s.month&(1<<uint(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches checks the day of month and day of week like cron does: if
+// both are restricted, either one matching is enough
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	day := s.day&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if !s.dayStar && !s.weekdayStar {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+func (s *cronSchedule) String() string {
+	return s.spec
+}
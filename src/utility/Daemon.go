@@ -0,0 +1,182 @@
+/**
+ * Daemon - Running daemira in the background
+ * The daemon records its PID in the runtime directory and holds a lock on
+ * the file while it runs, so other daemira processes can find it, stop it
+ * and refuse to start a second one. Detach starts the daemon in the
+ * background by running the binary again in a session of its own (Go can't
+ * fork), with its output in the log directory.
+ */
+
+package utility
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How often and how far apart taking a held PID file lock is tried
+const (
+	pidLockAttempts   = 5
+	pidLockRetryDelay = 20 * time.Millisecond
+)
+
+// PIDFilePath returns the file the running daemon's PID is kept in
+func PIDFilePath() string {
+	return filepath.Join(RuntimeDir(), "daemira.pid")
+}
+
+// DaemonOutputPath returns the file a detached daemon's output goes to
+func DaemonOutputPath() string {
+	return filepath.Join(LogDir(), "daemon.out")
+}
+
+// DaemonPID returns the PID of the running daemon, or 0 if none is running.
+// Only a running daemon holds the PID file's lock, so a file left by one
+// that died is ignored, also once its PID has gone to another program.
+func DaemonPID() int {
+	file, err := os.Open(PIDFilePath())
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	// Taking a shared lock fails while the daemon holds its exclusive one
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		return 0
+	} else if !errors.Is(err, syscall.EWOULDBLOCK) {
+		return 0
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
+
+// WritePIDFile records this process as the running daemon and returns a
+// function removing the record again. The file stays locked until then, so
+// it fails if another daemon runs, even one starting at the same time.
+func WritePIDFile() (func(), error) {
+	if _, err := EnsureDir(RuntimeDir()); err != nil {
+		return nil, fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+
+	path := PIDFilePath()
+	file, err := lockPIDFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+
+	return func() {
+		// Removed before the lock is let go, so the next daemon writes a new file
+		if info, err := os.Stat(path); err == nil {
+			if locked, err := file.Stat(); err == nil && os.SameFile(info, locked) {
+				_ = os.Remove(path)
+			}
+		}
+		file.Close()
+	}, nil
+}
+
+// lockPIDFile opens the PID file and takes its lock, failing if a daemon
+// holds it. A file removed by a daemon exiting meanwhile is opened again.
+func lockPIDFile(path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open PID file: %w", err)
+		}
+		if err := flockExclusive(file); err != nil {
+			file.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) != "" {
+					return nil, fmt.Errorf("daemira is already running (pid %s)", strings.TrimSpace(string(data)))
+				}
+				return nil, fmt.Errorf("daemira is already running")
+			}
+			return nil, fmt.Errorf("failed to lock PID file: %w", err)
+		}
+
+		info, err := os.Stat(path)
+		if err == nil {
+			var locked os.FileInfo
+			if locked, err = file.Stat(); err == nil && os.SameFile(info, locked) {
+				return file, nil
+			}
+		}
+		file.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to lock PID file: %w", err)
+		}
+	}
+}
+
+// flockExclusive takes the PID file's lock. DaemonPID holds a shared lock
+// for a moment, so a lock taken is tried again a few times before the file
+// counts as a daemon's.
+func flockExclusive(file *os.File) error {
+	var err error
+	for range pidLockAttempts {
+		if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); !errors.Is(err, syscall.EWOULDBLOCK) {
+			return err
+		}
+		time.Sleep(pidLockRetryDelay)
+	}
+	return err
+}
+
+// Detach starts daemira with args in the background, in a session of its
+// own and without a terminal, and returns the started process. Its output
+// is appended to DaemonOutputPath.
+func Detach(args ...string) (*os.Process, error) {
+	binary, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the daemira binary: %w", err)
+	}
+	if _, err := EnsureDir(LogDir()); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	output, err := os.OpenFile(DaemonOutputPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open daemon output file: %w", err)
+	}
+	defer output.Close()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer devNull.Close()
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devNull, output, output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start daemon: %w", err)
+	}
+	return cmd.Process, nil
+}
+
+// APISocketPath returns the socket the running daemon serves its API on
+func APISocketPath() string {
+	return filepath.Join(RuntimeDir(), "daemira.sock")
+}
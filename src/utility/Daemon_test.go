@@ -0,0 +1,65 @@
+package utility
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	release, err := WritePIDFile()
+	if err != nil {
+		t.Fatalf("WritePIDFile() = %v", err)
+	}
+	if pid := DaemonPID(); pid != os.Getpid() {
+		t.Errorf("DaemonPID() = %d, want %d", pid, os.Getpid())
+	}
+
+	// The lock is held per open file, so a second daemon in this process is refused too
+	if _, err := WritePIDFile(); err == nil || !strings.Contains(err.Error(), "already running (pid "+strconv.Itoa(os.Getpid())+")") {
+		t.Errorf("second WritePIDFile() = %v, want already running", err)
+	}
+
+	release()
+	if _, err := os.Stat(PIDFilePath()); !os.IsNotExist(err) {
+		t.Errorf("PID file left after release: %v", err)
+	}
+	if pid := DaemonPID(); pid != 0 {
+		t.Errorf("DaemonPID() after release = %d, want 0", pid)
+	}
+
+	release, err = WritePIDFile()
+	if err != nil {
+		t.Fatalf("WritePIDFile() after release = %v", err)
+	}
+	release()
+}
+
+func TestDaemonPIDIgnoresUnlockedFile(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if _, err := EnsureDir(RuntimeDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PID of the go tool that started the test is alive, but nothing
+	// holds the file's lock
+	if err := os.WriteFile(PIDFilePath(), []byte(strconv.Itoa(os.Getppid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid := DaemonPID(); pid != 0 {
+		t.Errorf("DaemonPID() = %d for an unlocked file, want 0", pid)
+	}
+
+	// An unlocked file left behind is taken over
+	release, err := WritePIDFile()
+	if err != nil {
+		t.Fatalf("WritePIDFile() over a stale file = %v", err)
+	}
+	defer release()
+	if pid := DaemonPID(); pid != os.Getpid() {
+		t.Errorf("DaemonPID() = %d, want %d", pid, os.Getpid())
+	}
+}
@@ -0,0 +1,289 @@
+/**
+ * Do not disturb - suppress notifications and defer maintenance
+ *
+ * The state lives in $XDG_STATE_HOME/daemira/dnd.json so the CLI and the
+ * daemon agree on it. While active, non-critical notifications are dropped
+ * and scheduled maintenance waits; the notification daemon (swaync or mako)
+ * can be switched to its own DND mode as well. A timed DND ends on its own:
+ * the daemon's watcher notices the expiry, restores the notification daemon
+ * and runs anything that was deferred.
+ */
+
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Notification daemons whose DND mode can be toggled
+const (
+	NotificationDaemonAuto   = "auto"
+	NotificationDaemonSwaync = "swaync"
+	NotificationDaemonMako   = "mako"
+	NotificationDaemonNone   = "none"
+)
+
+// DNDState is the persisted do-not-disturb state
+type DNDState struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until,omitempty"`  // zero means until turned off
+	Daemon  string    `json:"daemon,omitempty"` // notification daemon switched to DND
+}
+
+// IsActive returns true if DND is on and has not expired
+func (s DNDState) IsActive() bool {
+	return s.Enabled && (s.Until.IsZero() || time.Now().Before(s.Until))
+}
+
+// DoNotDisturb manages do-not-disturb mode
+type DoNotDisturb struct {
+	logger     *Logger
+	shell      *Shell
+	path       string
+	onEnd      []func()
+	lastActive bool
+	isRunning  bool
+	stopChan   chan struct{}
+	ticker     *time.Ticker
+	mu         sync.Mutex
+}
+
+var (
+	doNotDisturbInstance *DoNotDisturb
+	doNotDisturbOnce     sync.Once
+)
+
+// GetDoNotDisturb returns the singleton DoNotDisturb instance
+func GetDoNotDisturb() *DoNotDisturb {
+	doNotDisturbOnce.Do(func() {
+		doNotDisturbInstance = &DoNotDisturb{
+			logger: GetLogger().With("dnd"),
+			shell:  NewShell(GetLogger()),
+			path:   filepath.Join(StateDir(), "dnd.json"),
+		}
+	})
+	return doNotDisturbInstance
+}
+
+// State reads the current DND state
+func (d *DoNotDisturb) State() DNDState {
+	var state DNDState
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		d.logger.Debug("Ignoring invalid DND state: %v", err)
+		return DNDState{}
+	}
+	return state
+}
+
+// IsActive returns true if DND is currently on
+func (d *DoNotDisturb) IsActive() bool {
+	return d.State().IsActive()
+}
+
+// save writes the DND state
+func (d *DoNotDisturb) save(state DNDState) error {
+	if _, err := EnsureDir(filepath.Dir(d.path)); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode DND state: %w", err)
+	}
+	if err := os.WriteFile(d.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write DND state: %w", err)
+	}
+	return nil
+}
+
+// Enable turns DND on; a zero duration keeps it on until Disable is called
+func (d *DoNotDisturb) Enable(ctx context.Context, duration time.Duration, daemon string) (DNDState, error) {
+	previous := d.State()
+
+	state := DNDState{Enabled: true, Since: time.Now()}
+	if previous.IsActive() {
+		state.Since = previous.Since
+		state.Daemon = previous.Daemon
+	}
+	if duration > 0 {
+		state.Until = time.Now().Add(duration)
+	}
+
+	if state.Daemon == "" {
+		state.Daemon = d.resolveDaemon(ctx, daemon)
+		if err := d.setDaemonDND(ctx, state.Daemon, true); err != nil {
+			d.logger.Warn("Failed to enable %s do-not-disturb: %v", state.Daemon, err)
+			state.Daemon = ""
+		}
+	}
+
+	if err := d.save(state); err != nil {
+		return state, err
+	}
+	d.logger.Info("Do not disturb enabled")
+	return state, nil
+}
+
+// Disable turns DND off and restores the notification daemon
+func (d *DoNotDisturb) Disable(ctx context.Context) error {
+	state := d.State()
+	if state.Daemon != "" {
+		if err := d.setDaemonDND(ctx, state.Daemon, false); err != nil {
+			d.logger.Warn("Failed to disable %s do-not-disturb: %v", state.Daemon, err)
+		}
+	}
+
+	if err := d.save(DNDState{}); err != nil {
+		return err
+	}
+	d.logger.Info("Do not disturb disabled")
+	return nil
+}
+
+// OnEnd registers a callback run by the watcher when DND ends
+func (d *DoNotDisturb) OnEnd(callback func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onEnd = append(d.onEnd, callback)
+}
+
+// Start watches for DND expiry (called by the daemon)
+func (d *DoNotDisturb) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.isRunning {
+		return
+	}
+
+	d.isRunning = true
+	d.lastActive = d.IsActive()
+	d.stopChan = make(chan struct{})
+	d.ticker = time.NewTicker(30 * time.Second)
+
+	go Supervise("dnd-watcher", func() {
+		for {
+			select {
+			case <-d.ticker.C:
+				d.check(context.Background())
+			case <-d.stopChan:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts the expiry watcher
+func (d *DoNotDisturb) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.isRunning {
+		return
+	}
+
+	d.isRunning = false
+	d.ticker.Stop()
+	close(d.stopChan)
+}
+
+// check restores an expired DND and runs end callbacks on the active -> inactive transition
+func (d *DoNotDisturb) check(ctx context.Context) {
+	state := d.State()
+	if state.Enabled && !state.IsActive() {
+		d.logger.Info("Do not disturb expired")
+		if err := d.Disable(ctx); err != nil {
+			d.logger.Warn("Failed to end do not disturb: %v", err)
+		}
+	}
+
+	active := state.IsActive()
+	d.mu.Lock()
+	ended := d.lastActive && !active
+	d.lastActive = active
+	callbacks := append([]func(){}, d.onEnd...)
+	d.mu.Unlock()
+
+	if ended {
+		for _, callback := range callbacks {
+			Go("dnd-end-callback", callback)
+		}
+	}
+}
+
+// resolveDaemon picks the notification daemon to toggle
+func (d *DoNotDisturb) resolveDaemon(ctx context.Context, daemon string) string {
+	switch daemon {
+	case NotificationDaemonSwaync, NotificationDaemonMako:
+		return daemon
+	case NotificationDaemonAuto, "":
+		for _, candidate := range []string{NotificationDaemonSwaync, NotificationDaemonMako} {
+			result, err := d.shell.Execute(ctx, "pgrep -x "+candidate, &ExecOptions{
+				Timeout: 5 * time.Second,
+			})
+			if err == nil && result.ExitCode == 0 {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// setDaemonDND switches the notification daemon's own DND mode
+func (d *DoNotDisturb) setDaemonDND(ctx context.Context, daemon string, on bool) error {
+	var command string
+	switch daemon {
+	case NotificationDaemonSwaync:
+		command = "swaync-client --dnd-off"
+		if on {
+			command = "swaync-client --dnd-on"
+		}
+	case NotificationDaemonMako:
+		// Requires a [mode=do-not-disturb] section with invisible=1 in the mako config
+		command = "makoctl mode -r do-not-disturb"
+		if on {
+			command = "makoctl mode -a do-not-disturb"
+		}
+	default:
+		return nil
+	}
+
+	result, err := d.shell.Execute(ctx, command, &ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s: %s", command, result.Stderr)
+	}
+	return nil
+}
+
+// FormatStatus formats the DND state for display
+func (d *DoNotDisturb) FormatStatus(state DNDState) string {
+	if !state.IsActive() {
+		return "Do not disturb: off"
+	}
+
+	status := "Do not disturb: on"
+	if state.Until.IsZero() {
+		status += " (until turned off)"
+	} else {
+		status += fmt.Sprintf(" until %s (%s left)", state.Until.Format("15:04"), time.Until(state.Until).Round(time.Minute))
+	}
+	if state.Daemon != "" {
+		status += fmt.Sprintf("\nNotification daemon: %s", state.Daemon)
+	}
+	return status
+}
@@ -0,0 +1,204 @@
+/**
+ * FakeRunner - A CommandRunner that runs nothing
+ * Answers commands from canned results registered with On and records every
+ * call, so GoogleDrive, SystemUpdate and the health monitors can be driven
+ * through their logic without rclone, pacman or /proc. The tests keep the
+ * output they answer with in their package's Fixtures_test.go.
+ */
+
+package utility
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// FakeCall is a command a FakeRunner was asked to run
+type FakeCall struct {
+	Command string // the command line, as Result.Command shows it
+	Options ExecOptions
+}
+
+// fakeResponse is a canned answer to the commands matching pattern
+type fakeResponse struct {
+	pattern *regexp.Regexp
+	result  Result
+	err     error
+	used    bool
+}
+
+// FakeRunner answers commands with the results registered for them
+type FakeRunner struct {
+	responses []*fakeResponse
+	calls     []FakeCall
+	mu        sync.Mutex
+}
+
+var _ CommandRunner = (*FakeRunner)(nil)
+
+// NewFakeRunner creates a FakeRunner with no answers; unknown commands get
+// exit code 127, as if the program weren't installed
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// On answers commands matching pattern (a regular expression, matched
+// against the command line) with result. Answers registered for the same
+// commands are given in order, the last one repeating, so a command can
+// fail before it succeeds.
+func (f *FakeRunner) On(pattern string, result Result) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, &fakeResponse{pattern: regexp.MustCompile(pattern), result: result})
+	return f
+}
+
+// OnError makes commands matching pattern fail with err, as when they can't be started
+func (f *FakeRunner) OnError(pattern string, err error) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, &fakeResponse{pattern: regexp.MustCompile(pattern), err: err})
+	return f
+}
+
+// Execute answers a command line
+func (f *FakeRunner) Execute(ctx context.Context, command string, opts *ExecOptions) (*Result, error) {
+	opts = withDefaults(opts)
+	if opts.UseSudo {
+		command = fmt.Sprintf("sudo %s", command)
+	}
+	return f.run(ctx, command, opts)
+}
+
+// ExecuteArgs answers a program run with its arguments
+func (f *FakeRunner) ExecuteArgs(ctx context.Context, name string, args []string, opts *ExecOptions) (*Result, error) {
+	opts = withDefaults(opts)
+	argv := append([]string{name}, args...)
+	if opts.UseSudo {
+		argv = append([]string{"sudo"}, argv...)
+	}
+	return f.run(ctx, CommandLine(argv...), opts)
+}
+
+// ExecuteWithRetry answers a program run like ExecuteArgs, asking again
+// after transient failures without waiting in between
+func (f *FakeRunner) ExecuteWithRetry(ctx context.Context, name string, args []string, opts *ExecOptions, policy RetryPolicy) (*Result, error) {
+	policy.Delay, policy.MaxDelay = 0, 0
+	return retryCommand(ctx, GetLogger().With("shell"), policy, func() (*Result, error) {
+		return f.ExecuteArgs(ctx, name, args, opts)
+	})
+}
+
+// run records a command and answers it, passing the output to the callbacks
+// line by line as Shell would
+func (f *FakeRunner) run(ctx context.Context, command string, opts *ExecOptions) (*Result, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, FakeCall{Command: command, Options: *opts})
+	response := f.match(command)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return &Result{ExitCode: -1, Command: command}, fmt.Errorf("command cancelled: %w", err)
+	}
+	if response == nil {
+		name := commandName(command)
+		return &Result{ExitCode: 127, Stderr: name + ": command not found", Command: command}, nil
+	}
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	result := response.result
+	result.Command = command
+	if opts.StartCallback != nil {
+		opts.StartCallback(result.PID)
+	}
+	for _, line := range splitOutput(result.Stdout) {
+		if opts.StdoutCallback != nil {
+			opts.StdoutCallback(line)
+		}
+	}
+	for _, line := range splitOutput(result.Stderr) {
+		// On a pseudo-terminal stderr arrives with stdout
+		if opts.PTY && opts.StdoutCallback != nil {
+			opts.StdoutCallback(line)
+		} else if !opts.PTY && opts.StderrCallback != nil {
+			opts.StderrCallback(line)
+		}
+	}
+	if result.TimedOut {
+		return &result, fmt.Errorf("command timed out after %v", opts.Timeout)
+	}
+	if needsPassword(command, &result) {
+		return &result, fmt.Errorf("%s: %w", command, ErrNeedsPassword)
+	}
+	return &result, nil
+}
+
+// match returns the next answer to command, or nil if there is none; the
+// caller holds mu
+func (f *FakeRunner) match(command string) *fakeResponse {
+	var last *fakeResponse
+	for _, response := range f.responses {
+		if !response.pattern.MatchString(command) {
+			continue
+		}
+		if !response.used {
+			response.used = true
+			return response
+		}
+		last = response
+	}
+	return last
+}
+
+// splitOutput splits captured output into its lines
+func splitOutput(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// Calls returns the commands run so far, in order
+func (f *FakeRunner) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// Commands returns the command lines run so far, in order
+func (f *FakeRunner) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		commands[i] = call.Command
+	}
+	return commands
+}
+
+// Ran returns how many commands run so far match pattern
+func (f *FakeRunner) Ran(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	count := 0
+	for _, command := range f.Commands() {
+		if re.MatchString(command) {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset forgets the recorded calls and marks every answer unused again
+func (f *FakeRunner) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	for _, response := range f.responses {
+		response.used = false
+	}
+}
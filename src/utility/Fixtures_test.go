@@ -0,0 +1,35 @@
+/**
+ * Fixtures - Output of rclone for FakeRunner
+ * Results as rclone prints them, trimmed to what daemira parses, e.g.
+ *   NewFakeRunner().On(`^rclone listremotes`, fixtureRcloneListRemotes)
+ */
+
+package utility
+
+var (
+	fixtureRcloneVersion = Result{Stdout: "rclone v1.68.2\n- os/version: arch (64 bit)\n- os/kernel: 6.12.4-arch1-1 (x86_64)\n- go/version: go1.23.4"}
+
+	fixtureRcloneListRemotes = Result{Stdout: "gdrive:"}
+
+	fixtureRcloneAbout = Result{Stdout: "Total:   2 TiB\nUsed:    312.480 GiB\nFree:    1.695 TiB\nTrashed: 1.203 GiB\nOther:   4.120 GiB"}
+
+	fixtureRcloneBisync = Result{Stdout: "2025/01/12 10:15:02 INFO  : Synching Path1 \"/home/user/Documents/\" with Path2 \"gdrive:Documents/\"\n" +
+		"2025/01/12 10:15:03 INFO  : Path2    Queue delete          - old-notes.md\n" +
+		"2025/01/12 10:15:04 INFO  : Bisync successful\n" +
+		"Transferred:   \t    1.204 KiB / 1.204 KiB, 100%, 0 B/s, ETA -\n" +
+		"Deleted:            1 (files), 0 (dirs)\n" +
+		"Elapsed time:         2.1s"}
+
+	fixtureRcloneBisyncNeedsResync = Result{ExitCode: 2, Stderr: "2025/01/12 10:15:02 ERROR : Bisync critical error: cannot find prior Path1 or Path2 listings, likely due to critical error on prior run\n" +
+		"2025/01/12 10:15:02 ERROR : Failed loading prior Path1 listing: open /home/user/.cache/rclone/bisync/home_user_Documents..gdrive_Documents.path1.lst: no such file or directory\n" +
+		"2025/01/12 10:15:02 ERROR : Bisync aborted. Must run --resync to recover."}
+
+	fixtureRcloneBisyncLocked = Result{ExitCode: 2, Stderr: "2025/01/12 10:15:02 ERROR : Bisync critical error: prior lock file found: /home/user/.cache/rclone/bisync/home_user_Documents..gdrive_Documents.lck\n" +
+		"2025/01/12 10:15:02 ERROR : Bisync aborted. Please try again."}
+
+	fixtureRcloneRemoteMissing = Result{ExitCode: 2, Stderr: "2025/01/12 10:15:02 ERROR : error reading source root directory: directory not found"}
+
+	fixtureRcloneNoNetwork = Result{ExitCode: 1, Stderr: "2025/01/12 10:15:02 Failed to about: Get \"https://www.googleapis.com/drive/v3/about?alt=json\": dial tcp: lookup www.googleapis.com: no such host"}
+
+	fixtureRcloneServerError = Result{ExitCode: 1, Stderr: "2025/01/12 10:15:02 Failed to about: googleapi: Error 503: The service is currently unavailable., backendError"}
+)
@@ -2,9 +2,13 @@ package utility
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +21,9 @@ const (
 	QueueProcessIntervalMS = 1000  // 1 second
 )
 
+// gdriveSyncJob is the scheduler job queueing periodic syncs
+const gdriveSyncJob = "gdrive-sync"
+
 // SyncDirectory represents a directory to sync
 type SyncDirectory struct {
 	LocalPath        string
@@ -45,27 +52,38 @@ type SyncState struct {
 	LastSyncTime  map[string]time.Time
 	SyncStatus    map[string]SyncStatus
 	ErrorMessages map[string]string
+	RunLogs       map[string]string // full output of each directory's latest sync
+	PIDs          map[string]int    // rclone process of each directory syncing now
 	mu            sync.RWMutex
 }
 
+var (
+	// remoteDeletePattern matches bisync queueing a delete on the remote
+	remoteDeletePattern = regexp.MustCompile(`Path2\s+Queue delete`)
+	// deletedStatsPattern matches rclone's stats line of deleted files
+	deletedStatsPattern = regexp.MustCompile(`Deleted:\s+(\d+) \(files\)`)
+)
+
 // GoogleDrive manages Google Drive synchronization using rclone
 type GoogleDrive struct {
-	logger             *Logger
-	shell              *Shell
-	directories        map[string]*SyncDirectory
-	syncQueue          map[string]*SyncOperation
-	debounceTimers     map[string]*time.Timer
-	isRunning          bool
-	remoteName         string
-	debounceDelay      time.Duration
-	periodicSyncDelay  time.Duration
-	excludePatterns    []string
-	state              *SyncState
-	processInterval    *time.Ticker
-	periodicSyncTicker *time.Ticker
-	cancelFunc         context.CancelFunc
-	mu                 sync.RWMutex
-	wg                 sync.WaitGroup
+	logger            *Logger
+	shell             CommandRunner
+	directories       map[string]*SyncDirectory
+	syncQueue         map[string]*SyncOperation
+	debounceTimers    map[string]*time.Timer
+	isRunning         bool
+	remoteName        string
+	debounceDelay     time.Duration
+	periodicSyncDelay time.Duration
+	excludePatterns   []string
+	bandwidthLimit    string // rclone --bwlimit, "" for none
+	paused            string // why syncs are held, "" when they run
+	state             *SyncState
+	processInterval   *time.Ticker
+	cancelFunc        context.CancelFunc
+	stopChan          chan struct{} // closed when stopping; workers take no more syncs
+	mu                sync.RWMutex
+	wg                sync.WaitGroup
 }
 
 // NewGoogleDrive creates a new GoogleDrive instance
@@ -73,9 +91,12 @@ func NewGoogleDrive(logger *Logger, remoteName string) *GoogleDrive {
 	if remoteName == "" {
 		remoteName = "gdrive"
 	}
+	if logger == nil {
+		logger = GetLogger()
+	}
 
 	gd := &GoogleDrive{
-		logger:            logger,
+		logger:            logger.With("gdrive"),
 		shell:             NewShell(logger),
 		directories:       make(map[string]*SyncDirectory),
 		syncQueue:         make(map[string]*SyncOperation),
@@ -87,10 +108,13 @@ func NewGoogleDrive(logger *Logger, remoteName string) *GoogleDrive {
 			LastSyncTime:  make(map[string]time.Time),
 			SyncStatus:    make(map[string]SyncStatus),
 			ErrorMessages: make(map[string]string),
+			RunLogs:       make(map[string]string),
+			PIDs:          make(map[string]int),
 		},
 	}
 
 	gd.setupExcludePatterns()
+	gd.loadState()
 	gd.logger.Info("GoogleDrive initialized with remote: %s", remoteName)
 
 	return gd
@@ -230,7 +254,9 @@ func (gd *GoogleDrive) AddDirectory(localPath, remotePath string) {
 	}
 
 	gd.state.mu.Lock()
-	gd.state.SyncStatus[localPath] = StatusIdle
+	if _, known := gd.state.SyncStatus[localPath]; !known {
+		gd.state.SyncStatus[localPath] = StatusIdle
+	}
 	gd.state.mu.Unlock()
 
 	gd.logger.Debug("Added directory: %s -> %s", localPath, remotePath)
@@ -272,7 +298,7 @@ func (gd *GoogleDrive) Start(ctx context.Context) error {
 	}
 
 	// Check rclone configuration
-	if err := gd.checkConfig(ctx); err != nil {
+	if err := gd.CheckConfig(ctx); err != nil {
 		gd.mu.Unlock()
 		return err
 	}
@@ -293,6 +319,7 @@ func (gd *GoogleDrive) Start(ctx context.Context) error {
 
 	gd.mu.Lock()
 	gd.isRunning = true
+	gd.stopChan = make(chan struct{})
 
 	// Create cancellable context
 	ctx, cancel := context.WithCancel(ctx)
@@ -314,7 +341,7 @@ func (gd *GoogleDrive) Start(ctx context.Context) error {
 	gd.logger.Info("Background workers started")
 
 	// Check which directories need initial sync in background (non-blocking)
-	go func() {
+	Go("gdrive-resync-check", func() {
 		for path, dir := range gd.directories {
 			needsSync, err := gd.needsResync(ctx, dir.LocalPath, dir.RemotePath)
 			if err != nil {
@@ -329,7 +356,7 @@ func (gd *GoogleDrive) Start(ctx context.Context) error {
 				gd.logger.Info("Directory %s is already synced", path)
 			}
 		}
-	}()
+	})
 
 	dirCount := len(gd.directories)
 	gd.logger.Info("Google Drive sync started. Syncing %d directories every %d seconds",
@@ -338,60 +365,68 @@ func (gd *GoogleDrive) Start(ctx context.Context) error {
 		dirCount, int(gd.periodicSyncDelay.Seconds()))
 
 	// Perform initial syncs in background (non-blocking)
-	go func() {
+	gd.wg.Add(1)
+	Go("gdrive-initial-sync", func() {
+		defer gd.wg.Done()
 		gd.logger.Info("Starting initial syncs in background...")
 		if err := gd.performInitialSyncs(ctx); err != nil {
 			gd.logger.Error("Initial syncs failed: %v", err)
 		} else {
 			gd.logger.Info("Initial syncs completed")
 		}
-	}()
+	})
 
 	return nil
 }
 
 // startWorkers starts background goroutines for queue processing and periodic syncs
 func (gd *GoogleDrive) startWorkers(ctx context.Context) {
+	stop := gd.stopChan
+
 	gd.logger.Info("startWorkers: Creating queue processor...")
 	// Queue processor
 	gd.processInterval = time.NewTicker(QueueProcessIntervalMS * time.Millisecond)
 	gd.wg.Add(1)
 	go func() {
 		defer gd.wg.Done()
-		gd.logger.Debug("Queue processor goroutine started")
-		for {
-			select {
-			case <-ctx.Done():
-				gd.logger.Debug("Queue processor stopping (context cancelled)")
-				return
-			case <-gd.processInterval.C:
-				gd.processQueue(ctx)
+		Supervise("gdrive-queue", func() {
+			gd.logger.Debug("Queue processor goroutine started")
+			for {
+				select {
+				case <-ctx.Done():
+					gd.logger.Debug("Queue processor stopping (context cancelled)")
+					return
+				case <-stop:
+					gd.logger.Debug("Queue processor stopping")
+					return
+				case <-gd.processInterval.C:
+					gd.processQueue(ctx)
+				}
 			}
-		}
+		})
 	}()
 
-	gd.logger.Info("startWorkers: Creating periodic sync timer...")
-	// Periodic sync timer
-	gd.periodicSyncTicker = time.NewTicker(gd.periodicSyncDelay)
-	gd.wg.Add(1)
-	go func() {
-		defer gd.wg.Done()
-		gd.logger.Debug("Periodic sync timer goroutine started")
-		for {
-			select {
-			case <-ctx.Done():
-				gd.logger.Debug("Periodic sync timer stopping (context cancelled)")
-				return
-			case <-gd.periodicSyncTicker.C:
-				gd.logger.Debug("Periodic sync triggered for all directories")
-				gd.mu.RLock()
-				for path := range gd.directories {
-					gd.QueueSync(path)
-				}
-				gd.mu.RUnlock()
+	gd.logger.Info("startWorkers: Scheduling periodic sync...")
+	// Periodic sync of every directory
+	GetScheduler().Add(Job{
+		ID:          gdriveSyncJob,
+		Description: "Sync every Google Drive directory",
+		Schedule:    Every(gd.periodicSyncDelay),
+		Jitter:      gd.periodicSyncDelay / 10,
+		Run: func(ctx context.Context) error {
+			gd.logger.Debug("Periodic sync triggered for all directories")
+			gd.mu.RLock()
+			paths := make([]string, 0, len(gd.directories))
+			for path := range gd.directories {
+				paths = append(paths, path)
 			}
-		}
-	}()
+			gd.mu.RUnlock()
+			for _, path := range paths {
+				gd.QueueSync(path)
+			}
+			return nil
+		},
+	})
 
 	gd.logger.Info("startWorkers: Queueing all directories for immediate sync...")
 	// Queue all directories for immediate sync after startup
@@ -418,6 +453,10 @@ func (gd *GoogleDrive) performInitialSyncs(ctx context.Context) error {
 		if !dir.NeedsInitialSync {
 			continue
 		}
+		if !gd.waitWhilePaused(ctx) || !gd.running() {
+			gd.logger.Info("Stopping, leaving the remaining initial syncs for the next start")
+			return nil
+		}
 
 		gd.logger.Info("Performing initial sync for %s...", path)
 		gd.state.mu.Lock()
@@ -436,6 +475,7 @@ func (gd *GoogleDrive) performInitialSyncs(ctx context.Context) error {
 			gd.state.SyncStatus[path] = StatusError
 			gd.state.ErrorMessages[path] = err.Error()
 			gd.state.mu.Unlock()
+			gd.saveState()
 			gd.logger.Error("Initial sync failed for %s: %v", path, err)
 			continue
 		}
@@ -444,13 +484,22 @@ func (gd *GoogleDrive) performInitialSyncs(ctx context.Context) error {
 		gd.state.mu.Lock()
 		gd.state.LastSyncTime[path] = time.Now()
 		gd.state.SyncStatus[path] = StatusIdle
+		delete(gd.state.ErrorMessages, path)
 		gd.state.mu.Unlock()
+		gd.saveState()
 		gd.logger.Info("Initial sync completed for %s", path)
 	}
 
 	return nil
 }
 
+// running reports whether the sync is started and not stopping
+func (gd *GoogleDrive) running() bool {
+	gd.mu.RLock()
+	defer gd.mu.RUnlock()
+	return gd.isRunning
+}
+
 // QueueSync adds a directory to the sync queue
 func (gd *GoogleDrive) QueueSync(directoryPath string) {
 	gd.mu.Lock()
@@ -470,7 +519,8 @@ func (gd *GoogleDrive) QueueSync(directoryPath string) {
 // processQueue processes queued sync operations (one at a time)
 func (gd *GoogleDrive) processQueue(ctx context.Context) {
 	gd.mu.Lock()
-	if len(gd.syncQueue) == 0 {
+	// While paused, syncs stay queued
+	if len(gd.syncQueue) == 0 || gd.paused != "" {
 		gd.mu.Unlock()
 		return
 	}
@@ -505,12 +555,14 @@ func (gd *GoogleDrive) processQueue(ctx context.Context) {
 
 // syncDirectory syncs a specific directory
 func (gd *GoogleDrive) syncDirectory(ctx context.Context, directoryPath string) {
+	dirLog := gd.logger.WithFields(Fields{"directory": directoryPath})
+
 	gd.mu.RLock()
 	dir, exists := gd.directories[directoryPath]
 	gd.mu.RUnlock()
 
 	if !exists {
-		gd.logger.Error("Directory not found: %s", directoryPath)
+		dirLog.Error("Directory not found: %s", directoryPath)
 		return
 	}
 
@@ -518,11 +570,11 @@ func (gd *GoogleDrive) syncDirectory(ctx context.Context, directoryPath string)
 	gd.state.SyncStatus[directoryPath] = StatusSyncing
 	gd.state.mu.Unlock()
 
-	gd.logger.Info("Syncing %s...", directoryPath)
+	dirLog.Info("Syncing %s...", directoryPath)
 
 	// Clear any stale lock files before syncing
 	if err := gd.clearLocks(dir.LocalPath, dir.RemotePath); err != nil {
-		gd.logger.Debug("Failed to clear locks: %v", err)
+		dirLog.Debug("Failed to clear locks: %v", err)
 	}
 
 	if err := gd.executeBisync(ctx, dir.LocalPath, dir.RemotePath, false); err != nil {
@@ -530,7 +582,8 @@ func (gd *GoogleDrive) syncDirectory(ctx context.Context, directoryPath string)
 		gd.state.SyncStatus[directoryPath] = StatusError
 		gd.state.ErrorMessages[directoryPath] = err.Error()
 		gd.state.mu.Unlock()
-		gd.logger.Error("Sync failed for %s: %v", directoryPath, err)
+		gd.saveState()
+		dirLog.Error("Sync failed for %s: %v", directoryPath, err)
 		return
 	}
 
@@ -539,18 +592,21 @@ func (gd *GoogleDrive) syncDirectory(ctx context.Context, directoryPath string)
 	gd.state.SyncStatus[directoryPath] = StatusIdle
 	delete(gd.state.ErrorMessages, directoryPath)
 	gd.state.mu.Unlock()
+	gd.saveState()
 
-	gd.logger.Info("Synced %s", directoryPath)
+	dirLog.Info("Synced %s", directoryPath)
 }
 
 // executeBisync executes rclone bisync command
 func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath string, isInitial bool) error {
+	dirLog := gd.logger.WithFields(Fields{"directory": localPath})
 	args := []string{
 		"bisync",
 		localPath,
 		remotePath,
 	}
 	args = append(args, gd.GetExcludeArgs()...)
+	args = append(args, gd.bandwidthArgs()...)
 	args = append(args,
 		"--resilient",
 		"--recover",
@@ -570,54 +626,86 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 		args = append(args, "--resync")
 	}
 
-	// Build command with proper quoting for arguments that contain spaces
-	// This prevents bash from splitting arguments like "IK Multimedia/**" into two separate arguments
-	quotedArgs := make([]string, 0, len(args))
-	for _, arg := range args {
-		if strings.Contains(arg, " ") {
-			// Use single quotes for shell safety, but escape single quotes inside
-			quoted := strings.ReplaceAll(arg, "'", "'\"'\"'")
-			quotedArgs = append(quotedArgs, "'"+quoted+"'")
-		} else {
-			quotedArgs = append(quotedArgs, arg)
+	// Keep the machine from suspending mid-transfer
+	lock, err := AcquireInhibitor(dirLog, "sleep:shutdown", fmt.Sprintf("Syncing %s", localPath))
+	if err != nil {
+		dirLog.Debug("Syncing without inhibitor lock: %v", err)
+	}
+	defer lock.Release()
+
+	// Every line of output goes to the run log; the main log gets the
+	// transfers, deletions and errors
+	run, err := NewRunLog("gdrive", localPath)
+	if err != nil {
+		dirLog.Debug("Syncing without run log: %v", err)
+	}
+	defer run.Close()
+
+	// Deletions go to the audit log: bisync queues remote (Path2) deletes
+	// one per line, and the stats count the deletes of each run on both sides
+	remoteDeletes, totalDeletes := 0, 0
+	defer func() {
+		if remoteDeletes > 0 || totalDeletes > 0 {
+			Audit(AuditRemoteDelete, remotePath, fmt.Sprintf("%d deleted on the remote, %d in total, syncing %s", remoteDeletes, totalDeletes, localPath))
+		}
+	}()
+	runDeletes := 0
+	var deletesMu sync.Mutex // stdout and stderr are read concurrently
+	countDeletes := func(line string) {
+		deletesMu.Lock()
+		defer deletesMu.Unlock()
+		if remoteDeletePattern.MatchString(line) {
+			remoteDeletes++
+		}
+		if match := deletedStatsPattern.FindStringSubmatch(line); match != nil {
+			runDeletes, _ = strconv.Atoi(match[1])
 		}
 	}
-	command := "rclone " + strings.Join(quotedArgs, " ")
 
-	lastProgressTime := time.Now()
-	result, err := gd.shell.Execute(ctx, command, &ExecOptions{
-		Timeout: 0, // No timeout for large syncs
-		StdoutCallback: func(line string) {
-			if !strings.Contains(line, "Can't follow symlink") {
-				now := time.Now()
-				// Log important information about deletions and transfers
+	runBisync := func(args []string) (*Result, error) {
+		run.Println("$ " + CommandLine(append([]string{"rclone"}, args...)...))
+		runDeletes = 0
+		defer func() { totalDeletes += runDeletes }()
+		defer gd.recordPID(localPath, 0)
+		return gd.shell.ExecuteArgs(ctx, "rclone", args, &ExecOptions{
+			Timeout: 0, // No timeout for large syncs
+			// Every line is in the run log; the result only needs the errors near the end
+			MaxOutputBytes: 256 << 10,
+			StartCallback: func(pid int) {
+				gd.recordPID(localPath, pid)
+			},
+			StdoutCallback: func(line string) {
+				run.Println(line)
+				countDeletes(line)
+				if strings.Contains(line, "Can't follow symlink") {
+					return
+				}
 				if strings.Contains(line, "Deleted:") ||
 					strings.Contains(line, "Transferred:") ||
 					strings.Contains(line, "INFO") ||
 					strings.Contains(line, "Deleting") ||
-					strings.Contains(line, "Copied") ||
-					now.Sub(lastProgressTime) > 5*time.Second {
-					gd.logger.Info("  %s", line)
-					lastProgressTime = now
-				} else {
-					gd.logger.Debug("  %s", line)
+					strings.Contains(line, "Copied") {
+					dirLog.Info("  %s", line)
+				}
+			},
+			StderrCallback: func(line string) {
+				run.Println(line)
+				countDeletes(line)
+				if strings.Contains(line, "Can't follow symlink") {
+					return
 				}
-			}
-		},
-		StderrCallback: func(line string) {
-			if !strings.Contains(line, "Can't follow symlink") {
-				// Log errors and important notices
 				if strings.Contains(line, "ERROR") ||
 					strings.Contains(line, "NOTICE") ||
 					strings.Contains(line, "Deleted") ||
 					strings.Contains(line, "Deleting") {
-					gd.logger.Info("  %s", line)
-				} else {
-					gd.logger.Debug("  %s", line)
+					dirLog.Info("  %s", line)
 				}
-			}
-		},
-	})
+			},
+		})
+	}
+	gd.recordRunLog(localPath, run.Path())
+
+	result, err := runBisync(args)
 
 	if err != nil {
 		return fmt.Errorf("bisync failed: %w", err)
@@ -647,12 +735,11 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 
 		// If remote directory doesn't exist, create it first
 		if remoteDirMissing {
-			gd.logger.Warn("Remote directory %s doesn't exist on Google Drive, creating it...", remotePath)
+			dirLog.Warn("Remote directory %s doesn't exist on Google Drive, creating it...", remotePath)
 			// Create the remote directory using rclone mkdir
-			mkdirCmd := fmt.Sprintf("rclone mkdir %s", remotePath)
-			mkdirResult, mkdirErr := gd.shell.Execute(ctx, mkdirCmd, &ExecOptions{Timeout: 30 * time.Second})
+			mkdirResult, mkdirErr := gd.shell.ExecuteArgs(ctx, "rclone", []string{"mkdir", remotePath}, &ExecOptions{Timeout: 30 * time.Second})
 			if mkdirErr == nil && mkdirResult.ExitCode == 0 {
-				gd.logger.Info("Remote directory created successfully, retrying sync with --resync...")
+				dirLog.Info("Remote directory created successfully, retrying sync with --resync...")
 				// Now retry with --resync since this is a new directory
 				resyncArgs := []string{
 					"bisync",
@@ -660,6 +747,7 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 					remotePath,
 				}
 				resyncArgs = append(resyncArgs, gd.GetExcludeArgs()...)
+				resyncArgs = append(resyncArgs, gd.bandwidthArgs()...)
 				resyncArgs = append(resyncArgs,
 					"--resync",
 					"--resilient",
@@ -676,51 +764,10 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 					"--checkers", "8",
 				)
 
-				quotedResyncArgs := make([]string, 0, len(resyncArgs))
-				for _, arg := range resyncArgs {
-					if strings.Contains(arg, " ") {
-						quoted := strings.ReplaceAll(arg, "'", "'\"'\"'")
-						quotedResyncArgs = append(quotedResyncArgs, "'"+quoted+"'")
-					} else {
-						quotedResyncArgs = append(quotedResyncArgs, arg)
-					}
-				}
-				resyncCommand := "rclone " + strings.Join(quotedResyncArgs, " ")
-
-				resyncResult, resyncErr := gd.shell.Execute(ctx, resyncCommand, &ExecOptions{
-					Timeout: 0,
-					StdoutCallback: func(line string) {
-						if !strings.Contains(line, "Can't follow symlink") {
-							now := time.Now()
-							if strings.Contains(line, "Transferred:") ||
-								strings.Contains(line, "INFO") ||
-								strings.Contains(line, "Deleted:") ||
-								strings.Contains(line, "Deleting") ||
-								strings.Contains(line, "Copied") ||
-								now.Sub(lastProgressTime) > 5*time.Second {
-								gd.logger.Info("  %s", line)
-								lastProgressTime = now
-							} else {
-								gd.logger.Debug("  %s", line)
-							}
-						}
-					},
-					StderrCallback: func(line string) {
-						if !strings.Contains(line, "Can't follow symlink") {
-							if strings.Contains(line, "ERROR") ||
-								strings.Contains(line, "NOTICE") ||
-								strings.Contains(line, "Deleted") ||
-								strings.Contains(line, "Deleting") {
-								gd.logger.Info("  %s", line)
-							} else {
-								gd.logger.Debug("  %s", line)
-							}
-						}
-					},
-				})
+				resyncResult, resyncErr := runBisync(resyncArgs)
 
 				if resyncErr == nil && !resyncResult.TimedOut && resyncResult.ExitCode == 0 {
-					gd.logger.Info("Sync completed successfully after creating remote directory")
+					dirLog.Info("Sync completed successfully after creating remote directory")
 					return nil
 				}
 				// If resync failed, fall through to error handling
@@ -732,54 +779,25 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 					}
 				}
 			} else {
-				gd.logger.Warn("Failed to create remote directory: %v", mkdirErr)
+				dirLog.Warn("Failed to create remote directory: %v", mkdirErr)
 				if mkdirResult != nil {
-					gd.logger.Warn("mkdir output: %s", mkdirResult.Stderr)
+					dirLog.Warn("mkdir output: %s", mkdirResult.Stderr)
 				}
 			}
 		}
 
 		// Check for lock file error and automatically retry after clearing
 		if strings.Contains(errorMsg, "prior lock file found") || strings.Contains(errorMsg, "lock file found") {
-			gd.logger.Warn("Lock file detected, clearing and retrying...")
+			dirLog.Warn("Lock file detected, clearing and retrying...")
 			if err := gd.clearLocks(localPath, remotePath); err != nil {
-				gd.logger.Warn("Failed to clear lock file: %v", err)
+				dirLog.Warn("Failed to clear lock file: %v", err)
 			} else {
-				gd.logger.Info("Lock file cleared, retrying sync...")
+				dirLog.Info("Lock file cleared, retrying sync...")
 				// Retry the sync once after clearing lock
-				retryResult, retryErr := gd.shell.Execute(ctx, command, &ExecOptions{
-					Timeout: 0, // No timeout for large syncs
-					StdoutCallback: func(line string) {
-						if !strings.Contains(line, "Can't follow symlink") {
-							now := time.Now()
-							if strings.Contains(line, "Transferred:") ||
-								strings.Contains(line, "INFO") ||
-								strings.Contains(line, "Deleted:") ||
-								strings.Contains(line, "Deleting") ||
-								now.Sub(lastProgressTime) > 5*time.Second {
-								gd.logger.Info("  %s", line)
-								lastProgressTime = now
-							} else {
-								gd.logger.Debug("  %s", line)
-							}
-						}
-					},
-					StderrCallback: func(line string) {
-						if !strings.Contains(line, "Can't follow symlink") {
-							if strings.Contains(line, "ERROR") ||
-								strings.Contains(line, "NOTICE") ||
-								strings.Contains(line, "Deleted") ||
-								strings.Contains(line, "Deleting") {
-								gd.logger.Info("  %s", line)
-							} else {
-								gd.logger.Debug("  %s", line)
-							}
-						}
-					},
-				})
+				retryResult, retryErr := runBisync(args)
 
 				if retryErr == nil && !retryResult.TimedOut && retryResult.ExitCode == 0 {
-					gd.logger.Info("Sync succeeded after clearing lock file")
+					dirLog.Info("Sync succeeded after clearing lock file")
 					return nil
 				}
 				// If retry also failed, fall through to error handling
@@ -801,7 +819,7 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 
 		// If cache files are missing, retry with --resync to rebuild cache
 		if needsResync && !isInitial {
-			gd.logger.Warn("Bisync cache files missing or corrupted, performing resync to rebuild cache...")
+			dirLog.Warn("Bisync cache files missing or corrupted, performing resync to rebuild cache...")
 			// Build resync command
 			resyncArgs := []string{
 				"bisync",
@@ -825,52 +843,11 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 				"--checkers", "8",
 			)
 
-			quotedResyncArgs := make([]string, 0, len(resyncArgs))
-			for _, arg := range resyncArgs {
-				if strings.Contains(arg, " ") {
-					quoted := strings.ReplaceAll(arg, "'", "'\"'\"'")
-					quotedResyncArgs = append(quotedResyncArgs, "'"+quoted+"'")
-				} else {
-					quotedResyncArgs = append(quotedResyncArgs, arg)
-				}
-			}
-			resyncCommand := "rclone " + strings.Join(quotedResyncArgs, " ")
-
-			gd.logger.Info("Running resync to rebuild cache and sync deletions...")
-			resyncResult, resyncErr := gd.shell.Execute(ctx, resyncCommand, &ExecOptions{
-				Timeout: 0, // No timeout for large syncs
-				StdoutCallback: func(line string) {
-					if !strings.Contains(line, "Can't follow symlink") {
-						now := time.Now()
-						if strings.Contains(line, "Transferred:") ||
-							strings.Contains(line, "INFO") ||
-							strings.Contains(line, "Deleted:") ||
-							strings.Contains(line, "Deleting") ||
-							strings.Contains(line, "Copied") ||
-							now.Sub(lastProgressTime) > 5*time.Second {
-							gd.logger.Info("  %s", line)
-							lastProgressTime = now
-						} else {
-							gd.logger.Debug("  %s", line)
-						}
-					}
-				},
-				StderrCallback: func(line string) {
-					if !strings.Contains(line, "Can't follow symlink") {
-						if strings.Contains(line, "ERROR") ||
-							strings.Contains(line, "NOTICE") ||
-							strings.Contains(line, "Deleted") ||
-							strings.Contains(line, "Deleting") {
-							gd.logger.Info("  %s", line)
-						} else {
-							gd.logger.Debug("  %s", line)
-						}
-					}
-				},
-			})
+			dirLog.Info("Running resync to rebuild cache and sync deletions...")
+			resyncResult, resyncErr := runBisync(resyncArgs)
 
 			if resyncErr == nil && !resyncResult.TimedOut && resyncResult.ExitCode == 0 {
-				gd.logger.Info("Resync completed successfully, cache rebuilt and deletions synced")
+				dirLog.Info("Resync completed successfully, cache rebuilt and deletions synced")
 				return nil
 			}
 			// If resync also failed, fall through to error handling
@@ -897,21 +874,128 @@ func (gd *GoogleDrive) executeBisync(ctx context.Context, localPath, remotePath
 			errorLines = errorLines[len(errorLines)-5:]
 		}
 
-		// Log full error for debugging
-		gd.logger.Error("Rclone bisync error (exit code %d) for %s -> %s:\nStderr: %s\nStdout: %s",
-			result.ExitCode, localPath, remotePath, result.Stderr, result.Stdout)
+		// The full output is in the run log
+		if run != nil {
+			dirLog.Error("Rclone bisync error (exit code %d) for %s -> %s, full output in %s",
+				result.ExitCode, localPath, remotePath, run.Path())
+		} else {
+			dirLog.Error("Rclone bisync error (exit code %d) for %s -> %s:\nStderr: %s\nStdout: %s",
+				result.ExitCode, localPath, remotePath, result.Stderr, result.Stdout)
+		}
 
 		if len(errorLines) > 0 {
 			return fmt.Errorf("sync failed: %s", strings.Join(errorLines, "\n"))
 		}
+		if run != nil {
+			return fmt.Errorf("sync failed with exit code %d, see %s", result.ExitCode, run.Path())
+		}
 		return fmt.Errorf("sync failed with exit code %d, check logs for details", result.ExitCode)
 	}
 
 	return nil
 }
 
-// Stop stops all watchers and sync operations
+// recentLogs returns the latest n log entries about a directory
+func (gd *GoogleDrive) recentLogs(directoryPath string, n int) []LogEntry {
+	var entries []LogEntry
+	for _, entry := range gd.logger.Recent("gdrive", 0) {
+		if entry.Fields["directory"] == directoryPath {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries
+}
+
+// recordRunLog remembers the run log of a directory's latest sync
+func (gd *GoogleDrive) recordRunLog(directoryPath, path string) {
+	if path == "" {
+		return
+	}
+	gd.state.mu.Lock()
+	gd.state.RunLogs[directoryPath] = path
+	gd.state.mu.Unlock()
+}
+
+// savedSync is a directory's sync state as kept in the state store
+type savedSync struct {
+	LastSync time.Time  `json:"last_sync"`
+	Status   SyncStatus `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	RunLog   string     `json:"run_log,omitempty"`
+}
+
+// loadState restores the directories' last syncs from the state store
+func (gd *GoogleDrive) loadState() {
+	var saved map[string]savedSync
+	if !GetStateStore().Load("gdrive", &saved) {
+		return
+	}
+
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	for path, entry := range saved {
+		if !entry.LastSync.IsZero() {
+			gd.state.LastSyncTime[path] = entry.LastSync
+		}
+		// A sync that was running when the daemon stopped isn't anymore
+		if entry.Status == StatusSyncing {
+			entry.Status = StatusIdle
+		}
+		gd.state.SyncStatus[path] = entry.Status
+		if entry.Error != "" {
+			gd.state.ErrorMessages[path] = entry.Error
+		}
+		if entry.RunLog != "" {
+			gd.state.RunLogs[path] = entry.RunLog
+		}
+	}
+}
+
+// saveState keeps the directories' last syncs in the state store
+func (gd *GoogleDrive) saveState() {
+	gd.state.mu.RLock()
+	saved := make(map[string]savedSync, len(gd.state.SyncStatus))
+	for path, status := range gd.state.SyncStatus {
+		saved[path] = savedSync{
+			LastSync: gd.state.LastSyncTime[path],
+			Status:   status,
+			Error:    gd.state.ErrorMessages[path],
+			RunLog:   gd.state.RunLogs[path],
+		}
+	}
+	gd.state.mu.RUnlock()
+
+	GetStateStore().Save("gdrive", saved)
+}
+
+// recordPID remembers the rclone process syncing a directory, 0 once it is done
+func (gd *GoogleDrive) recordPID(directoryPath string, pid int) {
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	if pid == 0 {
+		delete(gd.state.PIDs, directoryPath)
+	} else {
+		gd.state.PIDs[directoryPath] = pid
+	}
+}
+
+// Stop stops all watchers and sync operations, cancelling syncs in flight
 func (gd *GoogleDrive) Stop() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gd.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops all watchers and lets syncs in flight finish until ctx is
+// done, then cancels them; an interrupted bisync checkpoints and recovers
+// on its next run
+func (gd *GoogleDrive) Shutdown(ctx context.Context) error {
 	gd.mu.Lock()
 	if !gd.isRunning {
 		gd.mu.Unlock()
@@ -919,19 +1003,13 @@ func (gd *GoogleDrive) Stop() error {
 	}
 
 	gd.isRunning = false
+	close(gd.stopChan)
 
-	// Cancel context
-	if gd.cancelFunc != nil {
-		gd.cancelFunc()
-	}
-
-	// Stop tickers
+	// Stop the queue processor and periodic sync
 	if gd.processInterval != nil {
 		gd.processInterval.Stop()
 	}
-	if gd.periodicSyncTicker != nil {
-		gd.periodicSyncTicker.Stop()
-	}
+	GetScheduler().Remove(gdriveSyncJob)
 
 	// Clear timers
 	for _, timer := range gd.debounceTimers {
@@ -939,13 +1017,34 @@ func (gd *GoogleDrive) Stop() error {
 	}
 	gd.debounceTimers = make(map[string]*time.Timer)
 
+	cancel := gd.cancelFunc
 	gd.mu.Unlock()
 
 	// Wait for workers to finish
-	gd.wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		gd.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		select {
+		case <-done:
+		default:
+			gd.logger.Warn("Interrupting syncs still running")
+			err = fmt.Errorf("google Drive syncs interrupted: %w", ctx.Err())
+		}
+	}
+	if cancel != nil {
+		cancel()
+	}
+	<-done
 
 	gd.logger.Info("Google Drive sync stopped")
-	return nil
+	return err
 }
 
 // GetStatus returns current sync status
@@ -956,13 +1055,26 @@ func (gd *GoogleDrive) GetStatus() map[string]interface{} {
 	gd.state.mu.RLock()
 	defer gd.state.mu.RUnlock()
 
+	syncStates := make(map[string]interface{}, len(gd.directories))
+	for path := range gd.directories {
+		syncStates[path] = map[string]interface{}{
+			"status":       string(gd.state.SyncStatus[path]),
+			"lastSyncTime": gd.state.LastSyncTime[path],
+			"errorMessage": gd.state.ErrorMessages[path],
+			"runLog":       gd.state.RunLogs[path],
+			"pid":          gd.state.PIDs[path],
+			"recentLogs":   gd.recentLogs(path, 5),
+		}
+	}
+
 	return map[string]interface{}{
 		"running":      gd.isRunning,
+		"paused":       gd.paused,
 		"directories":  len(gd.directories),
 		"queueSize":    len(gd.syncQueue),
 		"syncMode":     "periodic",
 		"syncInterval": int(gd.periodicSyncDelay.Seconds()),
-		"syncStates":   gd.state,
+		"syncStates":   syncStates,
 	}
 }
 
@@ -1042,19 +1154,9 @@ func (gd *GoogleDrive) ResyncDirectory(ctx context.Context, directoryPath string
 		"--checkers", "8",
 	}
 	syncArgs = append(syncArgs, gd.GetExcludeArgs()...)
+	syncArgs = append(syncArgs, gd.bandwidthArgs()...)
 
-	quotedSyncArgs := make([]string, 0, len(syncArgs))
-	for _, arg := range syncArgs {
-		if strings.Contains(arg, " ") {
-			quoted := strings.ReplaceAll(arg, "'", "'\"'\"'")
-			quotedSyncArgs = append(quotedSyncArgs, "'"+quoted+"'")
-		} else {
-			quotedSyncArgs = append(quotedSyncArgs, arg)
-		}
-	}
-	syncCommand := "rclone " + strings.Join(quotedSyncArgs, " ")
-
-	syncResult, syncErr := gd.shell.Execute(ctx, syncCommand, &ExecOptions{
+	syncResult, syncErr := gd.shell.ExecuteArgs(ctx, "rclone", syncArgs, &ExecOptions{
 		Timeout: 0,
 		StdoutCallback: func(line string) {
 			if strings.Contains(line, "Deleted:") ||
@@ -1158,6 +1260,101 @@ func (gd *GoogleDrive) AddExcludePattern(pattern string) {
 	gd.logger.Info("Added exclude pattern: %s", pattern)
 }
 
+// SetRunner makes the sync run its commands with runner, e.g. a FakeRunner;
+// call it before Start
+func (gd *GoogleDrive) SetRunner(runner CommandRunner) {
+	gd.shell = runner
+}
+
+// SetExcludePatterns replaces the configured exclude patterns; the built-in
+// ones always apply
+func (gd *GoogleDrive) SetExcludePatterns(patterns []string) {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+
+	gd.setupExcludePatterns()
+	for _, pattern := range patterns {
+		if !slices.Contains(gd.excludePatterns, pattern) {
+			gd.excludePatterns = append(gd.excludePatterns, pattern)
+		}
+	}
+	gd.logger.Info("Exclude patterns updated (%d configured)", len(patterns))
+}
+
+// SetBandwidthLimit caps the bandwidth of syncs started from now on, as
+// rclone's --bwlimit (e.g. "2M", or "1M:off" for upload only); "" lifts it
+func (gd *GoogleDrive) SetBandwidthLimit(limit string) {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+
+	if limit == gd.bandwidthLimit {
+		return
+	}
+	gd.bandwidthLimit = limit
+	if limit == "" {
+		gd.logger.Info("Sync bandwidth limit lifted")
+	} else {
+		gd.logger.Info("Sync bandwidth limited to %s", limit)
+	}
+}
+
+// bandwidthArgs returns the rclone arguments of the bandwidth limit
+func (gd *GoogleDrive) bandwidthArgs() []string {
+	gd.mu.RLock()
+	defer gd.mu.RUnlock()
+
+	if gd.bandwidthLimit == "" {
+		return nil
+	}
+	return []string{"--bwlimit", gd.bandwidthLimit}
+}
+
+// Pause holds syncs, leaving them queued, until Resume; a running sync
+// finishes
+func (gd *GoogleDrive) Pause(reason string) {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+
+	if gd.paused == reason {
+		return
+	}
+	gd.paused = reason
+	gd.logger.Info("Syncs paused: %s", reason)
+}
+
+// Resume runs the syncs held by Pause
+func (gd *GoogleDrive) Resume() {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+
+	if gd.paused == "" {
+		return
+	}
+	gd.paused = ""
+	gd.logger.Info("Syncs resumed")
+}
+
+// waitWhilePaused blocks while syncs are paused; it returns false if the
+// sync stops meanwhile
+func (gd *GoogleDrive) waitWhilePaused(ctx context.Context) bool {
+	for {
+		gd.mu.RLock()
+		paused, running := gd.paused != "", gd.isRunning
+		gd.mu.RUnlock()
+		if !paused {
+			return true
+		}
+		if !running {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
 // RemoveExcludePattern removes an exclude pattern
 func (gd *GoogleDrive) RemoveExcludePattern(pattern string) {
 	gd.mu.Lock()
@@ -1172,16 +1369,54 @@ func (gd *GoogleDrive) RemoveExcludePattern(pattern string) {
 	}
 }
 
-// checkConfig verifies rclone is installed and configured
-func (gd *GoogleDrive) checkConfig(ctx context.Context) error {
+// driveFileID matches the file ID in a Google Drive sharing link
+var driveFileID = regexp.MustCompile(`(?:[?&]id=|/d/)([\w-]{10,})`)
+
+// Link returns a public link to the Drive copy of a file in a synced
+// directory, sharing it with anyone who has the link. The file must have
+// been synced already. For Drive the link serves the file itself, so it can
+// be shown as an image.
+func (gd *GoogleDrive) Link(ctx context.Context, localPath string) (string, error) {
+	gd.mu.RLock()
+	remotePath := ""
+	for _, dir := range gd.directories {
+		if rel, err := filepath.Rel(dir.LocalPath, localPath); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			remotePath = dir.RemotePath + "/" + filepath.ToSlash(rel)
+			break
+		}
+	}
+	gd.mu.RUnlock()
+	if remotePath == "" {
+		return "", fmt.Errorf("%s is not in a directory synced to Google Drive", localPath)
+	}
+
+	result, err := gd.shell.ExecuteWithRetry(ctx, "rclone", []string{"link", remotePath}, &ExecOptions{Timeout: 30 * time.Second}, DefaultRetryPolicy)
+	if err != nil || result.ExitCode != 0 {
+		message := ""
+		if result != nil {
+			message = strings.TrimSpace(result.Stderr)
+		}
+		return "", fmt.Errorf("failed to get a link to %s: %s", remotePath, message)
+	}
+
+	link := strings.TrimSpace(result.Stdout)
+	if match := driveFileID.FindStringSubmatch(link); match != nil {
+		link = "https://drive.google.com/uc?export=view&id=" + match[1]
+	}
+	return link, nil
+}
+
+// CheckConfig verifies rclone is installed, the remote configured and
+// Google Drive reachable
+func (gd *GoogleDrive) CheckConfig(ctx context.Context) error {
 	// Check if rclone is installed
-	result, err := gd.shell.Execute(ctx, "rclone version", &ExecOptions{Timeout: 5 * time.Second})
+	result, err := gd.shell.ExecuteArgs(ctx, "rclone", []string{"version"}, &ExecOptions{Timeout: 5 * time.Second})
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("rclone is not installed or not in PATH. Install it with: sudo pacman -S rclone")
 	}
 
 	// Check if remote is configured
-	result, err = gd.shell.Execute(ctx, "rclone listremotes", &ExecOptions{Timeout: 5 * time.Second})
+	result, err = gd.shell.ExecuteWithRetry(ctx, "rclone", []string{"listremotes"}, &ExecOptions{Timeout: 5 * time.Second}, DefaultRetryPolicy)
 	if err != nil || result.ExitCode != 0 {
 		return fmt.Errorf("failed to list rclone remotes")
 	}
@@ -1199,9 +1434,9 @@ func (gd *GoogleDrive) checkConfig(ctx context.Context) error {
 		return fmt.Errorf("rclone remote '%s' is not configured. Run 'rclone config' to set it up", gd.remoteName)
 	}
 
-	// Test actual connection
+	// Test actual connection, giving a network that is still coming up a moment
 	gd.logger.Info("Testing connection to %s...", gd.remoteName)
-	result, err = gd.shell.Execute(ctx, fmt.Sprintf("rclone about %s:", gd.remoteName), &ExecOptions{Timeout: 15 * time.Second})
+	result, err = gd.shell.ExecuteWithRetry(ctx, "rclone", []string{"about", gd.remoteName + ":"}, &ExecOptions{Timeout: 15 * time.Second}, DefaultRetryPolicy)
 
 	if err != nil && result != nil && result.TimedOut {
 		return fmt.Errorf("connection to %s timed out. Check your internet connection and authentication", gd.remoteName)
@@ -1221,8 +1456,7 @@ func (gd *GoogleDrive) checkConfig(ctx context.Context) error {
 // needsResync checks if a directory needs initial resync
 func (gd *GoogleDrive) needsResync(ctx context.Context, localPath, remotePath string) (bool, error) {
 	// Try a dry-run bisync to see if it complains about needing resync
-	command := fmt.Sprintf("rclone bisync %s %s --dry-run", localPath, remotePath)
-	result, err := gd.shell.Execute(ctx, command, &ExecOptions{Timeout: 10 * time.Second})
+	result, err := gd.shell.ExecuteArgs(ctx, "rclone", []string{"bisync", localPath, remotePath, "--dry-run"}, &ExecOptions{Timeout: 10 * time.Second})
 
 	if err != nil {
 		return true, nil // Assume needs resync on error
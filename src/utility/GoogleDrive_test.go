@@ -0,0 +1,201 @@
+package utility
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// newTestDrive creates a GoogleDrive running its commands with runner. Run
+// logs, rclone's cache and the state store go to a temporary directory, and
+// with nothing in PATH syncs take no inhibitor lock.
+func newTestDrive(t *testing.T, runner *FakeRunner) *GoogleDrive {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("PATH", dir)
+
+	gd := NewGoogleDrive(nil, "gdrive")
+	gd.SetRunner(runner)
+	return gd
+}
+
+func TestGoogleDriveCheckConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		answer    func(f *FakeRunner)
+		wantErr   string
+		aboutRuns int
+	}{
+		{
+			name: "configured and reachable",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone version`, fixtureRcloneVersion).
+					On(`^rclone listremotes`, fixtureRcloneListRemotes).
+					On(`^rclone about gdrive:`, fixtureRcloneAbout)
+			},
+			aboutRuns: 1,
+		},
+		{
+			name:    "rclone missing",
+			answer:  func(f *FakeRunner) {},
+			wantErr: "rclone is not installed",
+		},
+		{
+			name: "remote not configured",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone version`, fixtureRcloneVersion).
+					On(`^rclone listremotes`, Result{Stdout: "dropbox:\nonedrive:"})
+			},
+			wantErr: "'gdrive' is not configured",
+		},
+		{
+			name: "no network gives up after the retries",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone version`, fixtureRcloneVersion).
+					On(`^rclone listremotes`, fixtureRcloneListRemotes).
+					On(`^rclone about`, fixtureRcloneNoNetwork)
+			},
+			wantErr:   "no such host",
+			aboutRuns: DefaultRetryPolicy.Attempts,
+		},
+		{
+			name: "server error is retried",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone version`, fixtureRcloneVersion).
+					On(`^rclone listremotes`, fixtureRcloneListRemotes).
+					On(`^rclone about`, fixtureRcloneServerError).
+					On(`^rclone about`, fixtureRcloneAbout)
+			},
+			aboutRuns: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeRunner()
+			tt.answer(runner)
+			gd := newTestDrive(t, runner)
+
+			err := gd.CheckConfig(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("CheckConfig() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("CheckConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			if runs := runner.Ran(`^rclone about`); runs != tt.aboutRuns {
+				t.Errorf("rclone about ran %d times, want %d", runs, tt.aboutRuns)
+			}
+		})
+	}
+}
+
+func TestGoogleDriveExecuteBisync(t *testing.T) {
+	tests := []struct {
+		name       string
+		initial    bool
+		answer     func(f *FakeRunner)
+		wantErr    string
+		bisyncRuns int
+		resyncRuns int
+		mkdirRuns  int
+	}{
+		{
+			name:       "sync",
+			answer:     func(f *FakeRunner) { f.On(`^rclone bisync`, fixtureRcloneBisync) },
+			bisyncRuns: 1,
+		},
+		{
+			name:       "first sync resyncs",
+			initial:    true,
+			answer:     func(f *FakeRunner) { f.On(`^rclone bisync`, fixtureRcloneBisync) },
+			bisyncRuns: 1,
+			resyncRuns: 1,
+		},
+		{
+			name: "missing listings are rebuilt with a resync",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone bisync`, fixtureRcloneBisyncNeedsResync).
+					On(`^rclone bisync`, fixtureRcloneBisync)
+			},
+			bisyncRuns: 2,
+			resyncRuns: 1,
+		},
+		{
+			name: "stale lock is cleared and the sync run again",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone bisync`, fixtureRcloneBisyncLocked).
+					On(`^rclone bisync`, fixtureRcloneBisync)
+			},
+			bisyncRuns: 2,
+		},
+		{
+			name: "missing remote directory is created",
+			answer: func(f *FakeRunner) {
+				f.On(`^rclone bisync`, fixtureRcloneRemoteMissing).
+					On(`^rclone bisync`, fixtureRcloneBisync).
+					On(`^rclone mkdir gdrive:Documents$`, Result{})
+			},
+			bisyncRuns: 2,
+			resyncRuns: 1,
+			mkdirRuns:  1,
+		},
+		{
+			name:       "failed resync reports rclone's errors",
+			answer:     func(f *FakeRunner) { f.On(`^rclone bisync`, fixtureRcloneBisyncNeedsResync) },
+			wantErr:    "Must run --resync to recover",
+			bisyncRuns: 2,
+			resyncRuns: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeRunner()
+			tt.answer(runner)
+			gd := newTestDrive(t, runner)
+
+			err := gd.executeBisync(context.Background(), "/home/user/Documents", "gdrive:Documents", tt.initial)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("executeBisync() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("executeBisync() = %v, want an error containing %q", err, tt.wantErr)
+			}
+			for _, want := range []struct {
+				pattern string
+				runs    int
+			}{
+				{`^rclone bisync /home/user/Documents gdrive:Documents `, tt.bisyncRuns},
+				{`^rclone bisync .* --resync`, tt.resyncRuns},
+				{`^rclone mkdir`, tt.mkdirRuns},
+			} {
+				if runs := runner.Ran(want.pattern); runs != want.runs {
+					t.Errorf("%s ran %d times, want %d; ran %q", want.pattern, runs, want.runs, runner.Commands())
+				}
+			}
+		})
+	}
+}
+
+func TestGoogleDriveLink(t *testing.T) {
+	runner := NewFakeRunner().
+		On(`^rclone link gdrive:Pictures/trips/lake\.png$`, Result{Stdout: "https://drive.google.com/open?id=1aBcDeFgHiJkLmNoP\n"})
+	gd := newTestDrive(t, runner)
+	gd.AddDirectory("/home/user/Pictures", "gdrive:Pictures")
+
+	link, err := gd.Link(context.Background(), "/home/user/Pictures/trips/lake.png")
+	if err != nil {
+		t.Fatalf("Link() = %v", err)
+	}
+	if want := "https://drive.google.com/uc?export=view&id=1aBcDeFgHiJkLmNoP"; link != want {
+		t.Errorf("Link() = %q, want %q", link, want)
+	}
+
+	if _, err := gd.Link(context.Background(), "/home/user/Music/song.flac"); err == nil {
+		t.Error("Link() of a file outside the synced directories succeeded")
+	}
+	if runs := runner.Ran(`^rclone link`); runs != 1 {
+		t.Errorf("rclone link ran %d times, want 1", runs)
+	}
+}
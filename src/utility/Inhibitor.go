@@ -0,0 +1,80 @@
+/**
+ * Inhibitor - systemd-logind inhibitor locks
+ *
+ * Holds a lock by keeping `systemd-inhibit ... sleep infinity` running;
+ * logind releases the lock as soon as that process exits, which it does
+ * when the daemon does, however it ends.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// InhibitorLock is a held logind inhibitor lock
+type InhibitorLock struct {
+	What       string
+	Why        string
+	AcquiredAt time.Time
+	cmd        *exec.Cmd
+	logger     *Logger
+	once       sync.Once
+}
+
+// AcquireInhibitor takes a blocking inhibitor lock (e.g. what="sleep:shutdown")
+func AcquireInhibitor(logger *Logger, what, why string) (*InhibitorLock, error) {
+	if logger == nil {
+		logger = GetLogger()
+	}
+
+	if _, err := exec.LookPath("systemd-inhibit"); err != nil {
+		return nil, fmt.Errorf("systemd-inhibit not found: %w", err)
+	}
+
+	cmd := exec.Command("systemd-inhibit",
+		"--what="+what,
+		"--who=daemira",
+		"--why="+why,
+		"--mode=block",
+		"sleep", "infinity",
+	)
+	// Own process group so the lock isn't dropped by a terminal Ctrl+C before
+	// we clean up, but killed with the daemon, so a SIGKILL or the OOM killer
+	// doesn't leave sleep and shutdown blocked (logind drops the lock with
+	// systemd-inhibit, and sleep dies with it)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to acquire %s inhibitor: %w", what, err)
+	}
+
+	logger.Debug("Acquired %s inhibitor: %s", what, why)
+	return &InhibitorLock{
+		What:       what,
+		Why:        why,
+		AcquiredAt: time.Now(),
+		cmd:        cmd,
+		logger:     logger,
+	}, nil
+}
+
+// Release drops the lock; safe to call more than once and on a nil lock
+func (l *InhibitorLock) Release() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		// Kill the whole group so `sleep` doesn't outlive systemd-inhibit
+		if err := syscall.Kill(-l.cmd.Process.Pid, syscall.SIGTERM); err != nil {
+			l.cmd.Process.Kill()
+		}
+		l.cmd.Wait()
+		l.logger.Debug("Released %s inhibitor after %v: %s", l.What, time.Since(l.AcquiredAt).Round(time.Second), l.Why)
+	})
+}
@@ -0,0 +1,329 @@
+/**
+ * LogReader - Reads daemira's own logs
+ * Parses the log files written by Logger (text or JSON lines, current and
+ * archived) and the journal of the daemira service, so `daemira logs` can
+ * filter and follow them without the user knowing where they live.
+ */
+
+package utility
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalUnit is the user unit whose journal holds the daemon's logs
+const journalUnit = "daemira.service"
+
+// LogEntry is one log message
+type LogEntry struct {
+	Time      time.Time
+	Level     LogLevel
+	Component string
+	Message   string
+	Fields    Fields // structured context such as directory, when known
+}
+
+// String formats the entry for display
+func (e LogEntry) String() string {
+	component := ""
+	if e.Component != "" {
+		component = "[" + e.Component + "] "
+	}
+	return fmt.Sprintf("%s %-5s %s%s", e.Time.Format("2006-01-02 15:04:05"), e.Level.String(), component, e.Message)
+}
+
+// LogFilter selects log entries; zero fields match everything
+type LogFilter struct {
+	Level     LogLevel
+	Component string
+	Since     time.Time
+}
+
+// Match reports whether an entry passes the filter
+func (f LogFilter) Match(e LogEntry) bool {
+	if e.Level < f.Level {
+		return false
+	}
+	if f.Component != "" && !strings.EqualFold(e.Component, f.Component) {
+		return false
+	}
+	return f.Since.IsZero() || !e.Time.Before(f.Since)
+}
+
+// logLinePattern matches text lines: [2006-01-02 15:04:05.000] [INFO] [component] message,
+// where older lines have only the time of day and no component
+var logLinePattern = regexp.MustCompile(`^\[([0-9: .-]+)\] \[([A-Z]+)\] (?:\[([A-Za-z0-9_.-]+)\] )?(.*)$`)
+
+// ParseLogLine parses a text or JSON log line. Lines stamped with only a
+// time of day are placed on day, or the day before if that would be after it.
+func ParseLogLine(line string, day time.Time) (LogEntry, bool) {
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return LogEntry{}, false
+		}
+		entry := LogEntry{Fields: fields}
+		entry.Message, _ = fields["message"].(string)
+		entry.Component, _ = fields["component"].(string)
+		if stamp, ok := fields["time"].(string); ok {
+			entry.Time, _ = time.Parse(time.RFC3339Nano, stamp)
+		}
+		if name, ok := fields["level"].(string); ok {
+			entry.Level, _ = ParseLogLevel(name)
+		}
+		return entry, true
+	}
+
+	match := logLinePattern.FindStringSubmatch(line)
+	if match == nil {
+		return LogEntry{}, false
+	}
+	level, err := ParseLogLevel(match[2])
+	if err != nil {
+		return LogEntry{}, false
+	}
+	entry := LogEntry{Level: level, Component: match[3], Message: match[4]}
+	if stamp, err := time.ParseInLocation(fileTimeFormat, match[1], time.Local); err == nil {
+		entry.Time = stamp
+	} else if clock, err := time.Parse("15:04:05.000", match[1]); err == nil {
+		entry.Time = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), time.Local)
+		if entry.Time.After(day) {
+			entry.Time = entry.Time.AddDate(0, 0, -1)
+		}
+	}
+	return entry, true
+}
+
+// LogFiles returns the log files in dir, oldest first: archive/bot-8.log
+// through bot-1.log, then current.log
+func LogFiles(dir string) []string {
+	var files []string
+	for idx := 8; idx >= 1; idx-- {
+		path := filepath.Join(dir, "archive", fmt.Sprintf("bot-%d.log", idx))
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if path := filepath.Join(dir, "current.log"); fileExists(path) {
+		files = append(files, path)
+	}
+	return files
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ReadLogFile parses the entries of a log file; lines that are not log
+// entries (e.g. Raw output) are skipped
+func ReadLogFile(path string) ([]LogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	day := time.Now()
+	if info, err := file.Stat(); err == nil {
+		day = info.ModTime()
+	}
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if entry, ok := ParseLogLine(scanner.Text(), day); ok {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// FollowLogFile calls fn for each entry appended to path until ctx is done,
+// reopening the file when the logger rotates it
+func FollowLogFile(ctx context.Context, path string, fn func(LogEntry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { file.Close() }()
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	reader := bufio.NewReader(file)
+	var partial string
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			if entry, ok := ParseLogLine(strings.TrimRight(partial, "\n"), time.Now()); ok {
+				fn(entry)
+			}
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// A restarted daemon moves current.log to the archive and starts a new one
+		current, statErr := os.Stat(path)
+		opened, openErr := file.Stat()
+		if statErr == nil && openErr == nil && !os.SameFile(current, opened) {
+			next, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file = next
+			reader = bufio.NewReader(file)
+			partial = ""
+		}
+	}
+}
+
+// RecentLogs returns the last n entries matching filter (all if n <= 0),
+// from the journal if it holds the service's logs, otherwise from the log files
+func RecentLogs(ctx context.Context, filter LogFilter, n int) ([]LogEntry, error) {
+	var entries []LogEntry
+	if JournalAvailable(ctx) {
+		err := ReadJournal(ctx, filter, n, false, func(entry LogEntry) {
+			entries = append(entries, entry)
+		})
+		return entries, err
+	}
+	return RecentLogFiles(filter, n)
+}
+
+// RecentLogFiles returns the last n entries of the log files matching
+// filter (all if n <= 0)
+func RecentLogFiles(filter LogFilter, n int) ([]LogEntry, error) {
+	var entries []LogEntry
+	for _, path := range LogFiles(LogDir()) {
+		fileEntries, err := ReadLogFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range fileEntries {
+			if filter.Match(entry) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+// JournalAvailable reports whether the journal holds entries of the daemira service
+func JournalAvailable(ctx context.Context) bool {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return false
+	}
+	output, err := exec.CommandContext(ctx, "journalctl", "--user", "-u", journalUnit, "-n", "1", "-q", "-o", "cat").Output()
+	return err == nil && strings.TrimSpace(string(output)) != ""
+}
+
+// ReadJournal calls fn for the service's journal entries matching filter,
+// the last lines of them (all if 0), then new ones until ctx is done if follow is set
+func ReadJournal(ctx context.Context, filter LogFilter, lines int, follow bool, fn func(LogEntry)) error {
+	args := []string{"--user", "-u", journalUnit, "-o", "json", "-q", "--no-pager",
+		"-p", strconv.Itoa(filter.Level.priority())}
+	if !filter.Since.IsZero() {
+		args = append(args, "--since", filter.Since.Format("2006-01-02 15:04:05"))
+	}
+	if lines > 0 {
+		args = append(args, "-n", strconv.Itoa(lines))
+	}
+	if follow {
+		args = append(args, "-f")
+	}
+	if filter.Component != "" {
+		args = append(args, "COMPONENT="+filter.Component)
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run journalctl: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if entry, ok := parseJournalEntry(scanner.Bytes()); ok {
+			fn(entry)
+		}
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("journalctl failed: %w", err)
+	}
+	return nil
+}
+
+// parseJournalEntry parses one entry of journalctl -o json
+func parseJournalEntry(data []byte) (LogEntry, bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return LogEntry{}, false
+	}
+	message, ok := fields["MESSAGE"].(string)
+	if !ok {
+		return LogEntry{}, false
+	}
+
+	entry := LogEntry{Message: message, Level: INFO, Fields: Fields{}}
+	entry.Component, _ = fields["COMPONENT"].(string)
+	for _, name := range []string{"COMPONENT", "DIRECTORY", "STEP"} {
+		if value, ok := fields[name].(string); ok {
+			entry.Fields[strings.ToLower(name)] = value
+		}
+	}
+	if stamp, ok := fields["__REALTIME_TIMESTAMP"].(string); ok {
+		if micros, err := strconv.ParseInt(stamp, 10, 64); err == nil {
+			entry.Time = time.UnixMicro(micros)
+		}
+	}
+	if priority, ok := fields["PRIORITY"].(string); ok {
+		switch priority {
+		case "7":
+			entry.Level = DEBUG
+		case "5", "6":
+			entry.Level = INFO
+		case "4":
+			entry.Level = WARN
+		default:
+			entry.Level = ERROR
+		}
+	}
+	return entry, true
+}
@@ -1,10 +1,16 @@
 package utility
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,6 +25,35 @@ const (
 	ERROR
 )
 
+// ParseLogLevel parses debug, info, warn or error
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	}
+	return INFO, fmt.Errorf("invalid log level %q (must be debug, info, warn or error)", s)
+}
+
+// priority returns the syslog priority journald stores for the level
+func (l LogLevel) priority() int {
+	switch l {
+	case DEBUG:
+		return 7
+	case WARN:
+		return 4
+	case ERROR:
+		return 3
+	default:
+		return 6
+	}
+}
+
 func (l LogLevel) String() string {
 	switch l {
 	case DEBUG:
@@ -34,13 +69,48 @@ func (l LogLevel) String() string {
 	}
 }
 
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json" // one object per line with time, level, message and fields
+)
+
+// fileTimeFormat stamps lines in log files, which outlive a day
+const fileTimeFormat = "2006-01-02 15:04:05.000"
+
+// maxLogSize is the size at which current.log is archived. Every daemira
+// process appends to the same file, so it is not rotated per process.
+const maxLogSize = 10 << 20
+
+// recentPerComponent is how many entries are kept in memory per component
+const recentPerComponent = 100
+
+// journalSocket receives entries in journald's native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// Fields are structured context attached to log entries, e.g. component,
+// directory or step
+type Fields map[string]interface{}
+
 // Logger provides logging capabilities with file rotation
 type Logger struct {
-	level      LogLevel
-	logDir     string
-	currentLog *os.File
-	mu         sync.Mutex
-	mode       string // "file", "cli", "journal"
+	*logOutput
+	fields Fields // added to every entry, see WithFields
+}
+
+// logOutput is the state a logger shares with the loggers derived from it
+type logOutput struct {
+	level           LogLevel
+	componentLevels map[string]LogLevel // overrides level for entries with a component field
+	logDir          string
+	currentLog      *os.File
+	mu              sync.Mutex
+	mode            string // "file", "cli", "journal"
+	format          string // FormatText or FormatJSON
+	sink            func(level LogLevel, message string)
+	output          io.Writer             // console output, stdout unless set
+	journal         net.Conn              // native journald connection in journal mode
+	recent          map[string][]LogEntry // latest entries by component, see Recent
 }
 
 var (
@@ -51,11 +121,12 @@ var (
 // GetLogger returns the singleton logger instance
 func GetLogger() *Logger {
 	once.Do(func() {
-		instance = &Logger{
+		instance = &Logger{logOutput: &logOutput{
 			level:  INFO,
-			logDir: "log",
+			logDir: LogDir(),
 			mode:   "file",
-		}
+			format: FormatText,
+		}}
 		instance.init()
 	})
 	return instance
@@ -63,11 +134,12 @@ func GetLogger() *Logger {
 
 // NewLogger creates a new logger with the specified mode
 func NewLogger(mode string, level LogLevel) *Logger {
-	logger := &Logger{
+	logger := &Logger{logOutput: &logOutput{
 		level:  level,
-		logDir: "log",
+		logDir: LogDir(),
 		mode:   mode,
-	}
+		format: FormatText,
+	}}
 	if mode == "file" {
 		logger.init()
 	}
@@ -105,8 +177,8 @@ func (l *Logger) rotateLogs() {
 
 	currentLogPath := filepath.Join(l.logDir, "current.log")
 
-	// Check if current.log exists
-	if _, err := os.Stat(currentLogPath); err == nil {
+	// Check if current.log exists and is full
+	if info, err := os.Stat(currentLogPath); err == nil && info.Size() >= maxLogSize {
 		// Move bot-7.log to bot-8.log (delete bot-8.log)
 		for i := 7; i >= 1; i-- {
 			oldPath := filepath.Join(archiveDir, fmt.Sprintf("bot-%d.log", i))
@@ -130,32 +202,179 @@ func (l *Logger) rotateLogs() {
 
 // log writes a log message
 func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
-	if level < l.level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.minLevel() {
 		return
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	now := time.Now()
+	timestamp := now.Format("15:04:05.000")
+	message := Redact(fmt.Sprintf(format, args...))
+	l.remember(now, level, message)
+	logLine := fmt.Sprintf("[%s] [%s] %s%s\n", timestamp, level.String(), l.componentTag(), message)
+	fileLine := fmt.Sprintf("[%s] [%s] %s%s\n", now.Format(fileTimeFormat), level.String(), l.componentTag(), message)
+	if l.format == FormatJSON {
+		logLine = l.jsonLine(now, level, message)
+		fileLine = logLine
+	}
 
-	timestamp := time.Now().Format("15:04:05.000")
-	message := fmt.Sprintf(format, args...)
-	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level.String(), message)
+	// A sink (e.g. the installer TUI) takes over console output
+	if l.sink != nil {
+		if l.mode == "file" && l.currentLog != nil {
+			l.currentLog.WriteString(fileLine)
+		}
+		l.sink(level, message)
+		return
+	}
 
 	switch l.mode {
 	case "file":
 		if l.currentLog != nil {
-			l.currentLog.WriteString(logLine)
+			l.currentLog.WriteString(fileLine)
 		} else {
 			fmt.Fprint(os.Stderr, logLine)
 		}
 	case "cli":
-		l.printColoredLog(level, timestamp, message)
+		if l.format == FormatJSON {
+			fmt.Fprint(l.console(), logLine)
+		} else {
+			l.printColoredLog(level, timestamp, message)
+		}
 	case "journal":
-		// For systemd journal, we'll use simple stdout
-		fmt.Print(logLine)
+		// Without the native socket, journald still reads <priority> prefixes on stdout
+		if err := l.writeJournal(level, message); err != nil {
+			fmt.Fprintf(l.console(), "<%d>%s", level.priority(), logLine)
+		}
 	default:
-		fmt.Print(logLine)
+		fmt.Fprint(l.console(), logLine)
+	}
+}
+
+// remember keeps an entry in the component's ring of recent entries
+func (l *Logger) remember(now time.Time, level LogLevel, message string) {
+	component, _ := l.fields["component"].(string)
+	if l.recent == nil {
+		l.recent = make(map[string][]LogEntry)
+	}
+	entries := append(l.recent[component], LogEntry{
+		Time:      now,
+		Level:     level,
+		Component: component,
+		Message:   message,
+		Fields:    l.fields,
+	})
+	if len(entries) > recentPerComponent {
+		entries = append([]LogEntry(nil), entries[len(entries)-recentPerComponent:]...)
+	}
+	l.recent[component] = entries
+}
+
+// Recent returns the latest entries logged for a component ("" for entries
+// without one), oldest first, at most n of them (all kept if n <= 0)
+func (l *Logger) Recent(component string, n int) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.recent[component]
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return append([]LogEntry(nil), entries...)
+}
+
+// componentTag returns "[component] " for entries with a component field
+func (l *Logger) componentTag() string {
+	if component, ok := l.fields["component"].(string); ok && component != "" {
+		return "[" + component + "] "
 	}
+	return ""
+}
+
+// minLevel returns the level below which entries are dropped, by component
+// if one is set for it
+func (l *Logger) minLevel() LogLevel {
+	if component, ok := l.fields["component"].(string); ok {
+		if level, ok := l.componentLevels[component]; ok {
+			return level
+		}
+	}
+	return l.level
+}
+
+// jsonLine renders an entry as a JSON object on one line
+func (l *Logger) jsonLine(now time.Time, level LogLevel, message string) string {
+	entry := make(map[string]interface{}, len(l.fields)+3)
+	for key, value := range l.fields {
+		if s, ok := value.(string); ok {
+			value = Redact(s)
+		}
+		entry[key] = value
+	}
+	entry["time"] = now.Format(time.RFC3339Nano)
+	entry["level"] = strings.ToLower(level.String())
+	entry["message"] = message
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf("[%s] [%s] %s\n", now.Format("15:04:05.000"), level.String(), message)
+	}
+	return string(data) + "\n"
+}
+
+// writeJournal sends an entry to journald with its priority and fields
+func (l *Logger) writeJournal(level LogLevel, message string) error {
+	if l.journal == nil {
+		conn, err := net.Dial("unixgram", journalSocket)
+		if err != nil {
+			return err
+		}
+		l.journal = conn
+	}
+
+	var entry bytes.Buffer
+	writeJournalField(&entry, "MESSAGE", message)
+	writeJournalField(&entry, "PRIORITY", strconv.Itoa(level.priority()))
+	writeJournalField(&entry, "SYSLOG_IDENTIFIER", "daemira")
+	for key, value := range l.fields {
+		if name := journalFieldName(key); name != "" {
+			writeJournalField(&entry, name, Redact(fmt.Sprint(value)))
+		}
+	}
+	if _, err := l.journal.Write(entry.Bytes()); err != nil {
+		// Dial again next time, e.g. after journald restarted
+		l.journal.Close()
+		l.journal = nil
+		return err
+	}
+	return nil
+}
+
+// writeJournalField encodes one field; values with newlines are length-prefixed
+func writeJournalField(entry *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(entry, "%s=%s\n", name, value)
+		return
+	}
+	entry.WriteString(name + "\n")
+	binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value + "\n")
+}
+
+// journalFieldName converts a field name to journald's form: uppercase
+// letters, digits and underscores, not starting with an underscore or digit
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	return strings.TrimLeft(name, "_0123456789")
 }
 
 // printColoredLog prints a colored log message to the console
@@ -182,7 +401,15 @@ func (l *Logger) printColoredLog(level LogLevel, timestamp, message string) {
 		color = colorReset
 	}
 
-	fmt.Printf("%s[%s] [%s]%s %s\n", color, timestamp, level.String(), colorReset, message)
+	fmt.Fprintf(l.console(), "%s[%s] [%s]%s %s%s\n", color, timestamp, level.String(), colorReset, l.componentTag(), message)
+}
+
+// console returns where console output goes
+func (l *Logger) console() io.Writer {
+	if l.output != nil {
+		return l.output
+	}
+	return os.Stdout
 }
 
 // Debug logs a debug message
@@ -210,6 +437,7 @@ func (l *Logger) Raw(message string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	message = Redact(message)
 	if l.currentLog != nil {
 		l.currentLog.WriteString(message + "\n")
 	} else {
@@ -224,11 +452,86 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
+// SetComponentLevels sets the minimum level per component, overriding the
+// logger's level for entries with that component field
+func (l *Logger) SetComponentLevels(levels map[string]LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.componentLevels = levels
+}
+
+// SetFormat switches between FormatText and FormatJSON
+func (l *Logger) SetFormat(format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("invalid log format %q (must be %s or %s)", format, FormatText, FormatJSON)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+	return nil
+}
+
+// SetMode changes where entries go: "cli" (colored console), "journal"
+// (journald) or "file"
+func (l *Logger) SetMode(mode string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mode = mode
+	if mode == "file" && l.currentLog == nil {
+		l.init()
+	}
+}
+
+// With returns a child logger for a component: its entries are prefixed
+// with the component (and carry it as a field) and follow the component's
+// level from SetComponentLevels, falling back to the global level
+func (l *Logger) With(component string) *Logger {
+	return l.WithFields(Fields{"component": component})
+}
+
+// WithFields returns a logger that adds fields to its entries; it shares
+// this logger's output and levels
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Logger{logOutput: l.logOutput, fields: merged}
+}
+
+// UnderJournal reports whether stdout goes to the systemd journal, as it
+// does when running as a service
+func UnderJournal() bool {
+	return os.Getenv("JOURNAL_STREAM") != ""
+}
+
+// SetSink redirects console output to fn until called with nil; file logging is unaffected
+func (l *Logger) SetSink(fn func(level LogLevel, message string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink = fn
+}
+
+// SetOutput sends console output to w instead of stdout, e.g. stderr when
+// stdout carries machine-readable output
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.output = w
+}
+
 // Close closes the log file
 func (l *Logger) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.journal != nil {
+		l.journal.Close()
+		l.journal = nil
+	}
 	if l.currentLog != nil {
 		return l.currentLog.Close()
 	}
@@ -0,0 +1,203 @@
+/**
+ * Metrics - Counts and timings of the commands daemira runs
+ * Shell records every command by program: how often it ran, how long it
+ * took and how often it failed, next to the daemon's own resource usage
+ * and its peaks. The daemon saves them to the state
+ * directory every so often, so `daemira diagnostics` can show where the
+ * time goes.
+ */
+
+package utility
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// metricsSaveInterval is how often a persisting process saves its metrics
+const metricsSaveInterval = 30 * time.Second
+
+// Timing summarizes the runs of one command
+type Timing struct {
+	Count        int           `json:"count"`
+	Failures     int           `json:"failures"` // non-zero exit codes, timeouts and cancellations
+	Total        time.Duration `json:"total"`
+	Max          time.Duration `json:"max"`
+	LastExitCode int           `json:"lastExitCode"`
+	LastRun      time.Time     `json:"lastRun"`
+}
+
+// Average returns the mean duration of a run
+func (t Timing) Average() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+// MetricsSnapshot is the saved metrics of a process
+type MetricsSnapshot struct {
+	PID     int                   `json:"pid"`
+	Started time.Time             `json:"started"`
+	Saved   time.Time             `json:"saved"`
+	Timings map[string]Timing     `json:"timings"`
+	Queues  map[string]QueueStats `json:"queues"`
+	Usage   ResourceUsage         `json:"usage"` // the latest sample
+	Peak    ResourceUsage         `json:"peak"`  // the highest of each, not one sample
+}
+
+// Metrics collects the timings of this process
+type Metrics struct {
+	timings  map[string]*Timing
+	usage    ResourceUsage
+	peak     ResourceUsage
+	started  time.Time
+	persist  bool
+	lastSave time.Time
+	mu       sync.Mutex
+}
+
+var (
+	metricsInstance *Metrics
+	metricsOnce     sync.Once
+	metricsSaveMu   sync.Mutex
+)
+
+// GetMetrics returns the metrics of this process
+func GetMetrics() *Metrics {
+	metricsOnce.Do(func() {
+		metricsInstance = &Metrics{
+			timings: make(map[string]*Timing),
+			started: time.Now(),
+		}
+	})
+	return metricsInstance
+}
+
+// MetricsPath returns the file the daemon saves its metrics to
+func MetricsPath() string {
+	return filepath.Join(StateDir(), "metrics.json")
+}
+
+// Persist makes this process save its metrics for `daemira diagnostics`;
+// only the daemon does, so CLI runs don't overwrite its numbers
+func (m *Metrics) Persist() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.persist = true
+}
+
+// Observe records a run of a command
+func (m *Metrics) Observe(name string, duration time.Duration, exitCode int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	timing, ok := m.timings[name]
+	if !ok {
+		timing = &Timing{}
+		m.timings[name] = timing
+	}
+	timing.Count++
+	if exitCode != 0 {
+		timing.Failures++
+	}
+	timing.Total += duration
+	if duration > timing.Max {
+		timing.Max = duration
+	}
+	timing.LastExitCode = exitCode
+	timing.LastRun = time.Now()
+	m.saveSoon()
+}
+
+// RecordUsage records a sample of the process's resource usage
+func (m *Metrics) RecordUsage(usage ResourceUsage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage = usage
+	m.peak.Sampled = usage.Sampled
+	m.peak.CPUTime = usage.CPUTime
+	m.peak.CPUPercent = max(m.peak.CPUPercent, usage.CPUPercent)
+	m.peak.RSS = max(m.peak.RSS, usage.RSS)
+	m.peak.Goroutines = max(m.peak.Goroutines, usage.Goroutines)
+	m.peak.FDs = max(m.peak.FDs, usage.FDs)
+	m.saveSoon()
+}
+
+// saveSoon saves the metrics in the background if this process persists
+// them and hasn't lately; the caller holds mu
+func (m *Metrics) saveSoon() {
+	if m.persist && time.Since(m.lastSave) >= metricsSaveInterval {
+		m.lastSave = time.Now()
+		snapshot := m.snapshot()
+		go func() {
+			if err := saveMetrics(snapshot); err != nil {
+				GetLogger().Debug("Failed to save metrics: %v", err)
+			}
+		}()
+	}
+}
+
+// Snapshot returns the metrics collected so far
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot()
+}
+
+// snapshot copies the metrics; the caller holds mu
+func (m *Metrics) snapshot() MetricsSnapshot {
+	timings := make(map[string]Timing, len(m.timings))
+	for name, timing := range m.timings {
+		timings[name] = *timing
+	}
+	return MetricsSnapshot{
+		PID:     os.Getpid(),
+		Started: m.started,
+		Saved:   time.Now(),
+		Timings: timings,
+		Queues:  CommandQueues(),
+		Usage:   m.usage,
+		Peak:    m.peak,
+	}
+}
+
+// saveMetrics replaces the metrics file
+func saveMetrics(snapshot MetricsSnapshot) error {
+	metricsSaveMu.Lock()
+	defer metricsSaveMu.Unlock()
+
+	if _, err := EnsureDir(StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+	pending := fmt.Sprintf("%s.%d.tmp", MetricsPath(), os.Getpid())
+	if err := os.WriteFile(pending, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return os.Rename(pending, MetricsPath())
+}
+
+// LoadMetrics reads the metrics the daemon saved last
+func LoadMetrics() (*MetricsSnapshot, error) {
+	data, err := os.ReadFile(MetricsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	var snapshot MetricsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return &snapshot, nil
+}
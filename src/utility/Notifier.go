@@ -0,0 +1,72 @@
+/**
+ * Notifier - desktop notifications via notify-send
+ */
+
+package utility
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Urgency is the notification urgency level
+type Urgency string
+
+const (
+	UrgencyLow      Urgency = "low"
+	UrgencyNormal   Urgency = "normal"
+	UrgencyCritical Urgency = "critical"
+)
+
+// Notifier sends desktop notifications
+type Notifier struct {
+	logger *Logger
+	shell  *Shell
+}
+
+var (
+	notifierInstance *Notifier
+	notifierOnce     sync.Once
+)
+
+// GetNotifier returns the singleton Notifier instance
+func GetNotifier() *Notifier {
+	notifierOnce.Do(func() {
+		notifierInstance = &Notifier{
+			logger: GetLogger(),
+			shell:  NewShell(GetLogger()),
+		}
+	})
+	return notifierInstance
+}
+
+// Notify shows a desktop notification; it is a no-op outside a graphical session
+// and, except for critical notifications, while do-not-disturb is active
+func (n *Notifier) Notify(summary, body string, urgency Urgency) error {
+	if os.Getenv("WAYLAND_DISPLAY") == "" && os.Getenv("DISPLAY") == "" {
+		n.logger.Debug("Skipping notification (no graphical session): %s", summary)
+		return nil
+	}
+	if urgency == "" {
+		urgency = UrgencyNormal
+	}
+	if urgency != UrgencyCritical && GetDoNotDisturb().IsActive() {
+		n.logger.Debug("Skipping notification (do not disturb): %s", summary)
+		return nil
+	}
+
+	command := fmt.Sprintf("notify-send --app-name=Daemira --urgency=%s %s %s", urgency, ShellQuote(summary), ShellQuote(body))
+	result, err := n.shell.Execute(context.Background(), command, &ExecOptions{
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("notify-send failed: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("notify-send failed: %s", result.Stderr)
+	}
+	return nil
+}
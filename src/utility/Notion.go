@@ -2,11 +2,16 @@
  * Notion Utility - Integration with Notion API
  *
  * Features:
- * - Database queries with filtering
- * - Page CRUD operations (create, read, update)
- * - Append content blocks to pages
- * - Sync local files to Notion pages
- * - Retry logic with exponential backoff
+ * - Database queries with filtering and sorting (see NotionQuery.go)
+ * - Page CRUD operations (create, read, update, archive), pages under pages
+ * - Typed page properties (see NotionProperties.go)
+ * - Typed blocks: list, append (100 per request), update and delete (see NotionBlocks.go)
+ * - Sync local files to Notion pages, replacing changed content
+ * - Markdown converted to blocks (see NotionMarkdown.go), with the images
+ *   and PDFs it references uploaded (see NotionAttachments.go)
+ * - Pagination of database queries and block listings
+ * - Rate limiting (3 requests/s) and retries honoring Retry-After
+ * - Page creates and block appends queued on disk while offline (see NotionQueue.go)
  * - Integration with Logger
  */
 
@@ -15,19 +20,30 @@ package utility
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // NotionOptions configures the Notion client
 type NotionOptions struct {
 	LogLevel string // debug, info, warn, error
+
+	// What becomes of local files referenced from synced Markdown (see
+	// NotionAttachments.go): without AttachmentLink they are uploaded to
+	// Notion; NoAttachments leaves them out
+	NoAttachments  bool
+	AttachmentLink func(ctx context.Context, path string) (string, error)
 }
 
 // PageFilter defines filters for database queries
@@ -42,6 +58,8 @@ type Notion struct {
 	token    string
 	logger   *Logger
 	baseURL  string
+	options  NotionOptions
+	queue    *NotionQueue // set by Queued()
 }
 
 // NewNotion creates a new Notion API client
@@ -59,9 +77,12 @@ func NewNotion(token string, logger *Logger, options *NotionOptions) (*Notion, e
 			Timeout: 30 * time.Second,
 		},
 		token:   token,
-		logger: logger,
+		logger: logger.With("notion"),
 		baseURL: "https://api.notion.com/v1",
 	}
+	if options != nil {
+		n.options = *options
+	}
 
 	logger.Info("Notion client initialized")
 	return n, nil
@@ -77,29 +98,14 @@ type QueryDatabaseResponse struct {
 // PageObjectResponse represents a Notion page
 type PageObjectResponse map[string]interface{}
 
-// QueryDatabase queries a Notion database with optional filtering
+// QueryDatabase queries a Notion database with optional filtering,
+// returning every matching page
 func (n *Notion) QueryDatabase(ctx context.Context, databaseID string, filter *PageFilter) (*QueryDatabaseResponse, error) {
-	n.logger.Debug("Querying database: %s", databaseID)
-
-	body := map[string]interface{}{}
-	
+	query := &DatabaseQuery{}
 	if filter != nil && filter.Property != "" && filter.Value != "" {
-		body["filter"] = map[string]interface{}{
-			"property": filter.Property,
-			"rich_text": map[string]interface{}{
-				"contains": filter.Value,
-			},
-		}
-	}
-
-	var response QueryDatabaseResponse
-	if err := n.makeRequest(ctx, "POST", fmt.Sprintf("/databases/%s/query", databaseID), body, &response); err != nil {
-		n.logger.Error("Failed to query database: %v", err)
-		return nil, err
+		query.Filter = TextContains(filter.Property, filter.Value)
 	}
-
-	n.logger.Info("Retrieved %d pages from database", len(response.Results))
-	return &response, nil
+	return n.Query(ctx, databaseID, query)
 }
 
 // GetPage retrieves a page by ID
@@ -116,11 +122,31 @@ func (n *Notion) GetPage(ctx context.Context, pageID string) (*PageObjectRespons
 	return &response, nil
 }
 
+// GetDatabase retrieves a database by ID
+func (n *Notion) GetDatabase(ctx context.Context, databaseID string) (*PageObjectResponse, error) {
+	n.logger.Debug("Fetching database: %s", databaseID)
+
+	var response PageObjectResponse
+	if err := n.makeRequest(ctx, "GET", fmt.Sprintf("/databases/%s", databaseID), nil, &response); err != nil {
+		n.logger.Error("Failed to retrieve database: %v", err)
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Ping checks that the API can be reached and the token is accepted, by
+// reading the integration's own user
+func (n *Notion) Ping(ctx context.Context) error {
+	var response map[string]interface{}
+	return n.makeRequest(ctx, "GET", "/users/me", nil, &response)
+}
+
 // CreatePageParams defines parameters for creating a page
 type CreatePageParams struct {
 	DatabaseID string
-	Properties map[string]interface{}
-	Content    []map[string]interface{} // Blocks
+	Properties Properties
+	Content    []Block
 }
 
 // CreatePage creates a new page in a database
@@ -139,18 +165,48 @@ func (n *Notion) CreatePage(ctx context.Context, params CreatePageParams) (*Page
 	}
 
 	var response PageObjectResponse
-	if err := n.makeRequest(ctx, "POST", "/pages", body, &response); err != nil {
+	queued, err := n.write(ctx, "POST", "/pages", body, &response)
+	if err != nil {
 		n.logger.Error("Failed to create page: %v", err)
 		return nil, err
 	}
 
-	pageID, _ := response["id"].(string)
-	n.logger.Info("Created page: %s", pageID)
+	pageID := response.ID()
+	if !queued {
+		n.logger.Info("Created page: %s", pageID)
+	}
 	return &response, nil
 }
 
+// CreateChildPage creates a page titled title under another page and returns its ID
+func (n *Notion) CreateChildPage(ctx context.Context, parentPageID, title string) (string, error) {
+	n.logger.Debug("Creating page under: %s", parentPageID)
+
+	body := map[string]interface{}{
+		"parent": map[string]interface{}{
+			"page_id": parentPageID,
+		},
+		"properties": Properties{
+			"title": TitleValue(title),
+		},
+	}
+
+	var response PageObjectResponse
+	queued, err := n.write(ctx, "POST", "/pages", body, &response)
+	if err != nil {
+		n.logger.Error("Failed to create page: %v", err)
+		return "", err
+	}
+
+	pageID := response.ID()
+	if !queued {
+		n.logger.Info("Created page %q: %s", title, pageID)
+	}
+	return pageID, nil
+}
+
 // UpdatePage updates an existing page
-func (n *Notion) UpdatePage(ctx context.Context, pageID string, properties map[string]interface{}) (*PageObjectResponse, error) {
+func (n *Notion) UpdatePage(ctx context.Context, pageID string, properties Properties) (*PageObjectResponse, error) {
 	n.logger.Debug("Updating page: %s", pageID)
 
 	body := map[string]interface{}{
@@ -167,30 +223,30 @@ func (n *Notion) UpdatePage(ctx context.Context, pageID string, properties map[s
 	return &response, nil
 }
 
-// AppendBlocks appends content blocks to a page
-func (n *Notion) AppendBlocks(ctx context.Context, pageID string, blocks []map[string]interface{}) error {
-	n.logger.Debug("Appending %d blocks to page: %s", len(blocks), pageID)
-
+// ArchivePage moves a page to the trash, from where it can be restored
+func (n *Notion) ArchivePage(ctx context.Context, pageID string) error {
 	body := map[string]interface{}{
-		"children": blocks,
+		"archived": true,
 	}
 
-	var response map[string]interface{}
-	if err := n.makeRequest(ctx, "PATCH", fmt.Sprintf("/blocks/%s/children", pageID), body, &response); err != nil {
-		n.logger.Error("Failed to append blocks: %v", err)
+	if err := n.makeRequest(ctx, "PATCH", fmt.Sprintf("/pages/%s", pageID), body, nil); err != nil {
+		n.logger.Error("Failed to archive page: %v", err)
 		return err
 	}
 
-	n.logger.Info("Appended %d blocks to page", len(blocks))
+	n.logger.Info("Archived page: %s", pageID)
 	return nil
 }
 
 // SyncFileToPageOptions configures file syncing behavior
 type SyncFileToPageOptions struct {
-	Overwrite bool
+	Overwrite bool // replace the page's content instead of appending to it
+	Force     bool // overwrite even if the file is unchanged since its last sync
 }
 
-// SyncFileToPage syncs local file content to a Notion page as blocks
+// SyncFileToPage syncs local file content to a Notion page as blocks. With
+// Overwrite the page's content is replaced, unless the file's content is
+// what was last synced to the page.
 func (n *Notion) SyncFileToPage(ctx context.Context, pageID, filePath string, options *SyncFileToPageOptions) error {
 	n.logger.Info("Syncing file to Notion page: %s -> %s", filePath, pageID)
 
@@ -200,131 +256,194 @@ func (n *Notion) SyncFileToPage(ctx context.Context, pageID, filePath string, op
 		return err
 	}
 
+	overwrite := options != nil && options.Overwrite
+	hash := contentHash(filePath, content)
+	if overwrite && !options.Force && getNotionHashes().Get(pageID) == hash {
+		n.logger.Info("File unchanged since its last sync, skipping: %s", filePath)
+		return nil
+	}
+
 	// Convert file content to Notion blocks
 	blocks := n.fileContentToBlocks(string(content), filePath)
+	blocks = n.ResolveAttachments(ctx, blocks, filepath.Dir(filePath))
 
-	if options != nil && options.Overwrite {
-		// TODO: Clear existing blocks first
-		n.logger.Warn("Overwrite mode not yet implemented")
+	if overwrite {
+		if err := n.ClearPage(ctx, pageID); err != nil {
+			return err
+		}
 	}
 
 	if err := n.AppendBlocks(ctx, pageID, blocks); err != nil {
 		return err
 	}
 
+	if overwrite {
+		if err := getNotionHashes().Set(pageID, hash); err != nil {
+			n.logger.Warn("Failed to save content hash: %v", err)
+		}
+	}
+
 	n.logger.Info("Successfully synced file to Notion")
 	return nil
 }
 
-// fileContentToBlocks converts file content to Notion blocks
-func (n *Notion) fileContentToBlocks(content, filePath string) []map[string]interface{} {
-	blocks := []map[string]interface{}{}
+// contentHash identifies a file's content as synced; the extension is part
+// of it because it decides how the content converts to blocks
+func contentHash(filePath string, content []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(strings.ToLower(filepath.Ext(filePath)) + "\n"))
+	sum.Write(content)
+	return hex.EncodeToString(sum.Sum(nil))
+}
 
-	// Detect file type
-	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), "."))
+// notionHashes remembers the hash of the content last synced to each page,
+// across runs and processes
+type notionHashes struct {
+	path string
+	mu   sync.Mutex
+}
+
+var (
+	notionHashesInstance *notionHashes
+	notionHashesOnce     sync.Once
+)
 
+// getNotionHashes returns the content hash store
+func getNotionHashes() *notionHashes {
+	notionHashesOnce.Do(func() {
+		notionHashesInstance = &notionHashes{path: filepath.Join(StateDir(), "notion-hashes.json")}
+	})
+	return notionHashesInstance
+}
+
+// load reads the hashes by page ID; a missing or broken file has none
+func (h *notionHashes) load() map[string]string {
+	hashes := make(map[string]string)
+	if data, err := os.ReadFile(h.path); err == nil {
+		_ = json.Unmarshal(data, &hashes)
+	}
+	return hashes
+}
+
+// Get returns the hash of the content last synced to a page, or ""
+func (h *notionHashes) Get(pageID string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.load()[pageID]
+}
+
+// Set records the hash of the content synced to a page
+func (h *notionHashes) Set(pageID, hash string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hashes := h.load()
+	hashes[pageID] = hash
+	data, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := EnsureDir(filepath.Dir(h.path)); err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0644)
+}
+
+// fileContentToBlocks converts file content to Notion blocks: Markdown is
+// converted, anything else becomes a code block
+func (n *Notion) fileContentToBlocks(content, filePath string) []Block {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), "."))
 	if ext == "md" || ext == "markdown" {
-		// Simple markdown parsing
-		lines := strings.Split(content, "\n")
-
-		for _, line := range lines {
-			line = strings.TrimRight(line, "\r")
-			
-			if strings.HasPrefix(line, "# ") {
-				blocks = append(blocks, map[string]interface{}{
-					"object": "block",
-					"type":   "heading_1",
-					"heading_1": map[string]interface{}{
-						"rich_text": []map[string]interface{}{
-							{
-								"text": map[string]interface{}{
-									"content": strings.TrimPrefix(line, "# "),
-								},
-							},
-						},
-					},
-				})
-			} else if strings.HasPrefix(line, "## ") {
-				blocks = append(blocks, map[string]interface{}{
-					"object": "block",
-					"type":   "heading_2",
-					"heading_2": map[string]interface{}{
-						"rich_text": []map[string]interface{}{
-							{
-								"text": map[string]interface{}{
-									"content": strings.TrimPrefix(line, "## "),
-								},
-							},
-						},
-					},
-				})
-			} else if strings.HasPrefix(line, "### ") {
-				blocks = append(blocks, map[string]interface{}{
-					"object": "block",
-					"type":   "heading_3",
-					"heading_3": map[string]interface{}{
-						"rich_text": []map[string]interface{}{
-							{
-								"text": map[string]interface{}{
-									"content": strings.TrimPrefix(line, "### "),
-								},
-							},
-						},
-					},
-				})
-			} else if strings.TrimSpace(line) != "" {
-				blocks = append(blocks, map[string]interface{}{
-					"object": "block",
-					"type":   "paragraph",
-					"paragraph": map[string]interface{}{
-						"rich_text": []map[string]interface{}{
-							{
-								"text": map[string]interface{}{
-									"content": line,
-								},
-							},
-						},
-					},
-				})
-			}
-		}
-	} else {
-		// Plain text - code block
-		language := ext
-		if language == "" {
-			language = "plain text"
-		}
+		return MarkdownToBlocks(content)
+	}
+	return []Block{codeBlock(content, notionLanguage(ext))}
+}
 
-		blocks = append(blocks, map[string]interface{}{
-			"object": "block",
-			"type":   "code",
-			"code": map[string]interface{}{
-				"rich_text": []map[string]interface{}{
-					{
-						"text": map[string]interface{}{
-							"content": content,
-						},
-					},
-				},
-				"language": language,
-			},
-		})
+// NotionAPIError is an error response from the Notion API
+type NotionAPIError struct {
+	Status     int
+	Code       string        // e.g. "object_not_found" or "rate_limited"
+	Message    string
+	RetryAfter time.Duration // how long the API asked to wait, on 429
+}
+
+func (e *NotionAPIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("notion API error (status %d): %s: %s", e.Status, e.Code, e.Message)
 	}
+	return fmt.Sprintf("notion API error (status %d): %s", e.Status, e.Message)
+}
+
+// retryable reports whether the request may succeed when made again:
+// after rate limiting, conflicts and server errors, but not after bad
+// requests, missing permissions or objects
+func (e *NotionAPIError) retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status == http.StatusConflict || e.Status >= 500
+}
+
+// notionRequestInterval spaces requests to the API's average of three per
+// second; the limit is per integration, so every client shares it
+const notionRequestInterval = time.Second / 3
+
+var notionLimiter = &requestLimiter{interval: notionRequestInterval}
 
-	return blocks
+// requestLimiter hands out request slots at most one per interval
+type requestLimiter struct {
+	interval time.Duration
+	next     time.Time
+	mu       sync.Mutex
 }
 
-// makeRequest performs an HTTP request to the Notion API with retry logic
+// Wait blocks until the caller may make a request
+func (l *requestLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay := time.Until(slot); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Delay holds back every request for d, as when the API rate limits
+func (l *requestLimiter) Delay(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+// makeRequest performs an HTTP request to the Notion API with rate limiting and retry logic
 func (n *Notion) makeRequest(ctx context.Context, method, endpoint string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		payload = jsonData
+	}
+	return n.sendRequest(ctx, method, endpoint, "application/json", payload, result)
+}
+
+// sendRequest sends a request with a body of contentType, retrying it like
+// makeRequest
+func (n *Notion) sendRequest(ctx context.Context, method, endpoint, contentType string, payload []byte, result interface{}) error {
 	return n.retryWrapper(ctx, func() error {
 		var reqBody io.Reader
-		
-		if body != nil {
-			jsonData, err := json.Marshal(body)
-			if err != nil {
-				return fmt.Errorf("failed to marshal request body: %w", err)
-			}
-			reqBody = bytes.NewBuffer(jsonData)
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
 		}
 
 		url := n.baseURL + endpoint
@@ -335,8 +454,11 @@ func (n *Notion) makeRequest(ctx context.Context, method, endpoint string, body
 
 		req.Header.Set("Authorization", "Bearer "+n.token)
 		req.Header.Set("Notion-Version", "2022-06-28")
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 
+		if err := notionLimiter.Wait(ctx); err != nil {
+			return err
+		}
 		resp, err := n.client.Do(req)
 		if err != nil {
 			return fmt.Errorf("request failed: %w", err)
@@ -349,11 +471,18 @@ func (n *Notion) makeRequest(ctx context.Context, method, endpoint string, body
 		}
 
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			var errorResp map[string]interface{}
-			if err := json.Unmarshal(respBody, &errorResp); err == nil {
-				return fmt.Errorf("notion API error (status %d): %v", resp.StatusCode, errorResp)
+			apiErr := &NotionAPIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+			var errorResp struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
 			}
-			return fmt.Errorf("notion API error (status %d): %s", resp.StatusCode, string(respBody))
+			if err := json.Unmarshal(respBody, &errorResp); err == nil && errorResp.Message != "" {
+				apiErr.Code, apiErr.Message = errorResp.Code, errorResp.Message
+			}
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				apiErr.RetryAfter = time.Duration(seconds) * time.Second
+			}
+			return apiErr
 		}
 
 		if result != nil {
@@ -366,7 +495,8 @@ func (n *Notion) makeRequest(ctx context.Context, method, endpoint string, body
 	})
 }
 
-// retryWrapper implements exponential backoff retry logic
+// retryWrapper implements exponential backoff retry logic, waiting as long
+// as the API asks when it rate limits
 func (n *Notion) retryWrapper(ctx context.Context, operation func() error) error {
 	maxRetries := 3
 	baseDelay := 1 * time.Second
@@ -379,16 +509,26 @@ func (n *Notion) retryWrapper(ctx context.Context, operation func() error) error
 		}
 
 		lastError = err
-
-		// Don't retry on auth errors or bad requests
-		if strings.Contains(err.Error(), "401") || strings.Contains(err.Error(), "400") {
+		if ctx.Err() != nil {
 			return err
 		}
 
+		delay := baseDelay * time.Duration(1<<uint(attempt))
+		var apiErr *NotionAPIError
+		if errors.As(err, &apiErr) {
+			// Don't retry on auth errors, bad requests or missing objects
+			if !apiErr.retryable() {
+				return err
+			}
+			if apiErr.RetryAfter > 0 {
+				delay = apiErr.RetryAfter
+				notionLimiter.Delay(delay)
+			}
+		}
+
 		if attempt < maxRetries {
-			delay := baseDelay * time.Duration(1<<uint(attempt))
 			n.logger.Warn("Notion API error, retrying in %v (attempt %d/%d): %v", delay, attempt+1, maxRetries, err)
-			
+
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -400,4 +540,3 @@ func (n *Notion) retryWrapper(ctx context.Context, operation func() error) error
 
 	return lastError
 }
-
@@ -0,0 +1,202 @@
+/**
+ * NotionAttachments - Local files referenced from synced Markdown
+ * Images and PDFs in a note are local files Notion can't reach, so before a
+ * note is sent they are uploaded with the File Upload API, or linked from
+ * another place they are published (such as a synced Google Drive folder)
+ * when the client has an AttachmentLink. Files that can't be attached are
+ * left as their name, so the rest of the note still syncs.
+ */
+
+package utility
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// notionMaxUploadSize is the largest file sent in a single-part upload
+const notionMaxUploadSize = 20 << 20
+
+// attachmentBlockTypes are the block types holding a file
+var attachmentBlockTypes = map[string]bool{
+	"image": true,
+	"pdf":   true,
+	"file":  true,
+	"video": true,
+	"audio": true,
+}
+
+// fileUploadResponse is a file upload object
+type fileUploadResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// UploadFile uploads a local file to Notion and returns the ID of the file
+// upload, which a block attaches with {"type": "file_upload"}
+func (n *Notion) UploadFile(ctx context.Context, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > notionMaxUploadSize {
+		return "", fmt.Errorf("%s is %d MB, larger than the %d MB Notion takes in one upload", path, info.Size()>>20, notionMaxUploadSize>>20)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	name := filepath.Base(path)
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	n.logger.Debug("Uploading %s (%s)", path, contentType)
+
+	var upload fileUploadResponse
+	if err := n.makeRequest(ctx, "POST", "/file_uploads", map[string]interface{}{
+		"mode":         "single_part",
+		"filename":     name,
+		"content_type": contentType,
+	}, &upload); err != nil {
+		n.logger.Error("Failed to start upload of %s: %v", path, err)
+		return "", err
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, name))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err == nil {
+		_, err = part.Write(content)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upload of %s: %w", path, err)
+	}
+
+	if err := n.sendRequest(ctx, "POST", fmt.Sprintf("/file_uploads/%s/send", upload.ID), writer.FormDataContentType(), form.Bytes(), &upload); err != nil {
+		n.logger.Error("Failed to upload %s: %v", path, err)
+		return "", err
+	}
+
+	n.logger.Info("Uploaded %s", name)
+	return upload.ID, nil
+}
+
+// ResolveAttachments attaches the local files that file blocks (as
+// MarkdownToBlocks makes them) refer to, looking relative paths up in dirs
+// in order. Blocks already linking to the web are kept as they are.
+func (n *Notion) ResolveAttachments(ctx context.Context, blocks []Block, dirs ...string) []Block {
+	resolved := make([]Block, len(blocks))
+	for idx, block := range blocks {
+		if len(block.Children) > 0 {
+			block.Children = n.ResolveAttachments(ctx, block.Children, dirs...)
+		}
+		if src, ok := localAttachment(block); ok {
+			block = n.attach(ctx, block, src, dirs)
+		}
+		resolved[idx] = block
+	}
+	return resolved
+}
+
+// localAttachment returns the local file a file block refers to
+func localAttachment(block Block) (string, bool) {
+	if !attachmentBlockTypes[block.Type] || block.Data["type"] != "external" {
+		return "", false
+	}
+	external, _ := block.Data["external"].(map[string]interface{})
+	src, _ := external["url"].(string)
+	if src == "" || strings.Contains(src, "://") || strings.HasPrefix(src, "data:") || strings.HasPrefix(src, "mailto:") {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(src); err == nil {
+		src = unescaped
+	}
+	return src, true
+}
+
+// attach returns block with the file at src uploaded or linked, or a
+// paragraph naming the file if it can't be attached
+func (n *Notion) attach(ctx context.Context, block Block, src string, dirs []string) Block {
+	path, err := findAttachment(src, dirs)
+	if err == nil && n.options.NoAttachments {
+		err = fmt.Errorf("attachments are off")
+	}
+
+	if err == nil && n.options.AttachmentLink != nil {
+		link, linkErr := n.options.AttachmentLink(ctx, path)
+		if linkErr == nil {
+			block.Data = withFile(block.Data, "external", map[string]interface{}{"url": link})
+			return block
+		}
+		n.logger.Debug("No link to %s, uploading it: %v", path, linkErr)
+	}
+
+	if err == nil {
+		var id string
+		if id, err = n.UploadFile(ctx, path); err == nil {
+			block.Data = withFile(block.Data, "file_upload", map[string]interface{}{"id": id})
+			return block
+		}
+	}
+
+	n.logger.Warn("Leaving out attachment %s: %v", src, err)
+	text := filepath.Base(src)
+	if caption, ok := block.Data["caption"].([]RichText); ok && len(caption) > 0 {
+		text = PlainText(caption) + " (" + text + ")"
+	}
+	return Block{Type: "paragraph", RichText: plainRichText(text)}
+}
+
+// withFile returns the fields of a file block with its file replaced
+func withFile(data map[string]interface{}, kind string, file map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{
+		"type": kind,
+		kind:   file,
+	}
+	if caption, ok := data["caption"]; ok {
+		fields["caption"] = caption
+	}
+	return fields
+}
+
+// findAttachment returns the file src names: an absolute path (or one under
+// ~) as it is, a relative one in the first of dirs holding it
+func findAttachment(src string, dirs []string) (string, error) {
+	if src == "~" || strings.HasPrefix(src, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		src = filepath.Join(home, src[1:])
+	}
+	if filepath.IsAbs(src) {
+		if _, err := os.Stat(src); err != nil {
+			return "", err
+		}
+		return src, nil
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, filepath.FromSlash(src))
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", src)
+}
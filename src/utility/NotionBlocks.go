@@ -0,0 +1,344 @@
+/**
+ * NotionBlocks - Typed Notion blocks and block CRUD
+ * Blocks and rich text as structs instead of raw JSON maps, and the block
+ * endpoints: listing a block's children (paginated), appending, updating
+ * and deleting blocks. Overwrite syncing and partial page updates build on
+ * these.
+ */
+
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Link is the target of linked text
+type Link struct {
+	URL string `json:"url"`
+}
+
+// TextContent is the content of a text rich text object
+type TextContent struct {
+	Content string `json:"content"`
+	Link    *Link  `json:"link,omitempty"`
+}
+
+// Annotations is the formatting of rich text
+type Annotations struct {
+	Bold          bool   `json:"bold"`
+	Italic        bool   `json:"italic"`
+	Strikethrough bool   `json:"strikethrough"`
+	Underline     bool   `json:"underline"`
+	Code          bool   `json:"code"`
+	Color         string `json:"color,omitempty"`
+}
+
+// RichText is a run of formatted text. PlainText and Href are filled in by
+// the API on reads and left empty on writes.
+type RichText struct {
+	Type        string       `json:"type"`
+	Text        *TextContent `json:"text,omitempty"`
+	Annotations *Annotations `json:"annotations,omitempty"`
+	PlainText   string       `json:"plain_text,omitempty"`
+	Href        string       `json:"href,omitempty"`
+}
+
+// Content returns the text of a rich text object
+func (r RichText) Content() string {
+	if r.PlainText != "" {
+		return r.PlainText
+	}
+	if r.Text != nil {
+		return r.Text.Content
+	}
+	return ""
+}
+
+// URL returns the link of a rich text object, or ""
+func (r RichText) URL() string {
+	if r.Href != "" {
+		return r.Href
+	}
+	if r.Text != nil && r.Text.Link != nil {
+		return r.Text.Link.URL
+	}
+	return ""
+}
+
+// richTextFromJSON converts rich text decoded into interface{} values, as in
+// page properties, to RichText
+func richTextFromJSON(value interface{}) []RichText {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var richText []RichText
+	if err := json.Unmarshal(data, &richText); err != nil {
+		return nil
+	}
+	return richText
+}
+
+// Block is a Notion block. The text, checkbox and language of the common
+// block types have fields of their own; anything else the type holds (a
+// table's width, an image's file, a child page's title) is kept in Data as
+// decoded JSON.
+type Block struct {
+	ID             string
+	Type           string
+	HasChildren    bool
+	Archived       bool
+	LastEditedTime time.Time
+	RichText       []RichText             // text of paragraphs, headings, list items, quotes, code...
+	Checked        bool                   // to_do
+	Language       string                 // code
+	Data           map[string]interface{} // the type's other fields
+	Children       []Block                // nested blocks, as appended or read by GetBlockTree
+}
+
+// richTextBlockTypes are the block types whose text is under "rich_text"
+var richTextBlockTypes = map[string]bool{
+	"paragraph": true, "heading_1": true, "heading_2": true, "heading_3": true,
+	"bulleted_list_item": true, "numbered_list_item": true, "to_do": true,
+	"toggle": true, "quote": true, "callout": true, "code": true,
+}
+
+// content returns the object under the block's type key
+func (b Block) content(withChildren bool) map[string]interface{} {
+	content := make(map[string]interface{}, len(b.Data)+3)
+	for key, value := range b.Data {
+		content[key] = value
+	}
+	if richTextBlockTypes[b.Type] {
+		richText := b.RichText
+		if richText == nil {
+			richText = []RichText{}
+		}
+		content["rich_text"] = richText
+	}
+	switch b.Type {
+	case "to_do":
+		content["checked"] = b.Checked
+	case "code":
+		language := b.Language
+		if language == "" {
+			language = "plain text"
+		}
+		content["language"] = language
+	}
+	if withChildren && len(b.Children) > 0 {
+		content["children"] = b.Children
+	}
+	return content
+}
+
+// MarshalJSON encodes a block as the API takes it
+func (b Block) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"object": "block",
+		"type":   b.Type,
+		b.Type:   b.content(true),
+	})
+}
+
+// UnmarshalJSON decodes a block as the API returns it
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var header struct {
+		ID             string    `json:"id"`
+		Type           string    `json:"type"`
+		HasChildren    bool      `json:"has_children"`
+		Archived       bool      `json:"archived"`
+		LastEditedTime time.Time `json:"last_edited_time"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	*b = Block{
+		ID:             header.ID,
+		Type:           header.Type,
+		HasChildren:    header.HasChildren,
+		Archived:       header.Archived,
+		LastEditedTime: header.LastEditedTime,
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	raw, ok := fields[header.Type]
+	if !ok || header.Type == "" {
+		return nil
+	}
+	var content map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return fmt.Errorf("failed to decode %s block: %w", header.Type, err)
+	}
+
+	for key, value := range content {
+		var err error
+		switch {
+		case key == "rich_text" && richTextBlockTypes[header.Type]:
+			err = json.Unmarshal(value, &b.RichText)
+		case key == "checked" && header.Type == "to_do":
+			err = json.Unmarshal(value, &b.Checked)
+		case key == "language" && header.Type == "code":
+			err = json.Unmarshal(value, &b.Language)
+		case key == "children":
+			err = json.Unmarshal(value, &b.Children)
+		default:
+			var decoded interface{}
+			if err = json.Unmarshal(value, &decoded); err == nil {
+				if b.Data == nil {
+					b.Data = make(map[string]interface{})
+				}
+				b.Data[key] = decoded
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s of %s block: %w", key, header.Type, err)
+		}
+	}
+	return nil
+}
+
+// Limits of the Notion API
+const (
+	notionMaxBlocksPerRequest = 100 // blocks appended in one request
+	notionMaxPageSize         = 100 // results returned in one request
+)
+
+// AppendBlocks appends content blocks to a page, in requests of at most 100 blocks
+func (n *Notion) AppendBlocks(ctx context.Context, pageID string, blocks []Block) error {
+	n.logger.Debug("Appending %d blocks to page: %s", len(blocks), pageID)
+
+	queued := false
+	for start := 0; start < len(blocks); start += notionMaxBlocksPerRequest {
+		end := min(start+notionMaxBlocksPerRequest, len(blocks))
+		body := map[string]interface{}{
+			"children": blocks[start:end],
+		}
+
+		var response PageObjectResponse
+		chunkQueued, err := n.write(ctx, "PATCH", fmt.Sprintf("/blocks/%s/children", pageID), body, &response)
+		if err != nil {
+			n.logger.Error("Failed to append blocks %d-%d of %d: %v", start+1, end, len(blocks), err)
+			return err
+		}
+		queued = queued || chunkQueued
+	}
+
+	if !queued {
+		n.logger.Info("Appended %d blocks to page", len(blocks))
+	}
+	return nil
+}
+
+// blockChildrenResponse is a page of a block's children
+type blockChildrenResponse struct {
+	Results    []Block `json:"results"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// GetBlockChildren returns the blocks directly under a page or block,
+// following the API's pagination
+func (n *Notion) GetBlockChildren(ctx context.Context, blockID string) ([]Block, error) {
+	n.logger.Debug("Listing blocks of: %s", blockID)
+
+	var blocks []Block
+	cursor := ""
+	for {
+		endpoint := fmt.Sprintf("/blocks/%s/children?page_size=%d", blockID, notionMaxPageSize)
+		if cursor != "" {
+			endpoint += "&start_cursor=" + cursor
+		}
+
+		var response blockChildrenResponse
+		if err := n.makeRequest(ctx, "GET", endpoint, nil, &response); err != nil {
+			n.logger.Error("Failed to list blocks: %v", err)
+			return nil, err
+		}
+		blocks = append(blocks, response.Results...)
+
+		if !response.HasMore || response.NextCursor == "" {
+			return blocks, nil
+		}
+		cursor = response.NextCursor
+	}
+}
+
+// GetBlockTree returns the blocks under a page or block with their nested
+// blocks in Children. Child pages and databases aren't descended into.
+func (n *Notion) GetBlockTree(ctx context.Context, blockID string) ([]Block, error) {
+	blocks, err := n.GetBlockChildren(ctx, blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range blocks {
+		block := &blocks[idx]
+		if !block.HasChildren || block.Type == "child_page" || block.Type == "child_database" {
+			continue
+		}
+		if block.Children, err = n.GetBlockTree(ctx, block.ID); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// UpdateBlock replaces the content of a block with that of block (matched
+// by its ID) and returns the block as updated. Its type can't change and
+// its children are left as they are.
+func (n *Notion) UpdateBlock(ctx context.Context, block Block) (*Block, error) {
+	if block.ID == "" {
+		return nil, fmt.Errorf("failed to update block: no block ID")
+	}
+	n.logger.Debug("Updating block: %s", block.ID)
+
+	body := map[string]interface{}{
+		block.Type: block.content(false),
+	}
+
+	var response Block
+	if err := n.makeRequest(ctx, "PATCH", fmt.Sprintf("/blocks/%s", block.ID), body, &response); err != nil {
+		n.logger.Error("Failed to update block %s: %v", block.ID, err)
+		return nil, err
+	}
+	return &response, nil
+}
+
+// DeleteBlock deletes (archives) a block, removing it from its page
+func (n *Notion) DeleteBlock(ctx context.Context, blockID string) error {
+	if err := n.makeRequest(ctx, "DELETE", fmt.Sprintf("/blocks/%s", blockID), nil, nil); err != nil {
+		n.logger.Error("Failed to delete block %s: %v", blockID, err)
+		return err
+	}
+	return nil
+}
+
+// ClearPage deletes the content blocks of a page. Pages and databases
+// nested in it are kept, as they aren't content a file sync put there.
+func (n *Notion) ClearPage(ctx context.Context, pageID string) error {
+	blocks, err := n.GetBlockChildren(ctx, pageID)
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	for _, block := range blocks {
+		if block.ID == "" || block.Type == "child_page" || block.Type == "child_database" {
+			continue
+		}
+		if err := n.DeleteBlock(ctx, block.ID); err != nil {
+			return fmt.Errorf("failed to clear page: %w", err)
+		}
+		deleted++
+	}
+
+	n.logger.Debug("Deleted %d blocks of page: %s", deleted, pageID)
+	return nil
+}
@@ -0,0 +1,750 @@
+/**
+ * NotionMarkdown - Markdown to Notion blocks and back
+ * Converts the Markdown of synced notes to the blocks the Notion API takes:
+ * headings, paragraphs, bulleted, numbered and nested lists, checkboxes,
+ * blockquotes, code fences with their language, tables and dividers, with
+ * bold, italic, strikethrough, inline code and links inside the text.
+ * Images, and links to PDFs, on a line of their own become file blocks.
+ * BlocksToMarkdown renders exported pages the other way round.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// notionMaxTextLength is the longest content of a single rich text object
+const notionMaxTextLength = 2000
+
+// notionMaxNestingDepth is how deep the API takes nested list items in one request
+const notionMaxNestingDepth = 2
+
+var (
+	mdHeading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFence       = regexp.MustCompile("^(\\s*)(```+|~~~+)\\s*([\\w+#.-]*)")
+	mdTodo        = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	mdBullet      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdNumbered    = regexp.MustCompile(`^(\s*)\d{1,9}[.)]\s+(.*)$`)
+	mdQuote       = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdDivider     = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdTableRow    = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+	mdTableHeader = regexp.MustCompile(`^\s*\|?(\s*:?-+:?\s*\|)+\s*(:?-+:?\s*)?$`)
+	mdEmbed       = regexp.MustCompile(`^\s*(!?)\[([^\]]*)\]\(<?([^)<>]+?)>?(?:\s+"[^"]*")?\)\s*$`)
+	mdWikiEmbed   = regexp.MustCompile(`^\s*!\[\[([^\]|#]+)(?:[|#][^\]]*)?\]\]\s*$`)
+)
+
+// notionLanguages maps code fence languages to the names Notion knows;
+// fences in other languages become plain text
+var notionLanguages = map[string]string{
+	"bash": "bash", "sh": "shell", "shell": "shell", "zsh": "shell", "fish": "shell", "console": "shell",
+	"c": "c", "cpp": "c++", "c++": "c++", "cs": "c#", "csharp": "c#", "css": "css", "diff": "diff",
+	"dockerfile": "docker", "docker": "docker", "go": "go", "golang": "go", "graphql": "graphql",
+	"html": "html", "java": "java", "js": "javascript", "javascript": "javascript", "jsx": "javascript",
+	"json": "json", "kotlin": "kotlin", "kt": "kotlin", "lua": "lua", "makefile": "makefile", "make": "makefile",
+	"markdown": "markdown", "md": "markdown", "nix": "nix", "php": "php", "powershell": "powershell",
+	"ps1": "powershell", "py": "python", "python": "python", "rb": "ruby", "ruby": "ruby", "rs": "rust",
+	"rust": "rust", "scss": "scss", "sql": "sql", "swift": "swift", "toml": "toml", "ts": "typescript",
+	"tsx": "typescript", "typescript": "typescript", "xml": "xml", "yaml": "yaml", "yml": "yaml",
+}
+
+// notionLanguage returns the Notion name of a code language
+func notionLanguage(language string) string {
+	if name, ok := notionLanguages[strings.ToLower(language)]; ok {
+		return name
+	}
+	return "plain text"
+}
+
+// mdNode is a block being built, whose nested list items may still grow
+type mdNode struct {
+	block    Block
+	children []*mdNode
+}
+
+// toBlock returns the block with its nested blocks
+func (node *mdNode) toBlock() Block {
+	block := node.block
+	for _, child := range node.children {
+		block.Children = append(block.Children, child.toBlock())
+	}
+	return block
+}
+
+// listItem is an open list item that deeper-indented items nest under
+type listItem struct {
+	indent int
+	node   *mdNode
+	depth  int
+}
+
+// MarkdownToBlocks converts a Markdown document to Notion blocks
+func MarkdownToBlocks(markdown string) []Block {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var nodes []*mdNode
+	var paragraph []string
+	var lists []listItem // the open list items, outermost first
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			nodes = append(nodes, &mdNode{block: textBlock("paragraph", strings.Join(paragraph, "\n"))})
+			paragraph = nil
+		}
+	}
+	// addListItem places a list item under the open item it is indented
+	// below, or beside it if that would nest too deep for the API
+	addListItem := func(indent int, block Block) {
+		for len(lists) > 0 && lists[len(lists)-1].indent >= indent {
+			lists = lists[:len(lists)-1]
+		}
+		if len(lists) > 0 && lists[len(lists)-1].depth >= notionMaxNestingDepth {
+			lists = lists[:len(lists)-1]
+		}
+		node := &mdNode{block: block}
+		if len(lists) == 0 {
+			nodes = append(nodes, node)
+			lists = append(lists, listItem{indent: indent, node: node})
+			return
+		}
+		parent := lists[len(lists)-1]
+		parent.node.children = append(parent.node.children, node)
+		lists = append(lists, listItem{indent: indent, node: node, depth: parent.depth + 1})
+	}
+
+	for idx := 0; idx < len(lines); idx++ {
+		line := strings.TrimRight(lines[idx], " \t")
+
+		// Code fences run to the closing fence (or the end of the document)
+		if match := mdFence.FindStringSubmatch(line); match != nil {
+			flushParagraph()
+			lists = nil
+			fence := match[2]
+			var code []string
+			for idx++; idx < len(lines); idx++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[idx]), fence) {
+					break
+				}
+				code = append(code, strings.TrimPrefix(lines[idx], match[1]))
+			}
+			nodes = append(nodes, &mdNode{block: codeBlock(strings.Join(code, "\n"), notionLanguage(match[3]))})
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flushParagraph()
+			continue
+		}
+
+		// Tables are a header row followed by a separator row
+		if mdTableRow.MatchString(line) && idx+1 < len(lines) && mdTableHeader.MatchString(strings.TrimSpace(lines[idx+1])) {
+			flushParagraph()
+			lists = nil
+			rows := [][]string{splitTableRow(line)}
+			for idx += 2; idx < len(lines) && mdTableRow.MatchString(lines[idx]); idx++ {
+				rows = append(rows, splitTableRow(lines[idx]))
+			}
+			idx--
+			for _, table := range tableBlocks(rows) {
+				nodes = append(nodes, &mdNode{block: table})
+			}
+			continue
+		}
+
+		// List items keep the list open across their lines
+		if match := mdTodo.FindStringSubmatch(line); match != nil {
+			flushParagraph()
+			block := textBlock("to_do", match[3])
+			block.Checked = match[2] != " "
+			addListItem(indentWidth(match[1]), block)
+			continue
+		}
+		if match := mdBullet.FindStringSubmatch(line); match != nil && !mdDivider.MatchString(line) {
+			flushParagraph()
+			addListItem(indentWidth(match[1]), textBlock("bulleted_list_item", match[2]))
+			continue
+		}
+		if match := mdNumbered.FindStringSubmatch(line); match != nil {
+			flushParagraph()
+			addListItem(indentWidth(match[1]), textBlock("numbered_list_item", match[2]))
+			continue
+		}
+		lists = nil
+
+		if block := attachmentLine(line); block != nil {
+			flushParagraph()
+			nodes = append(nodes, &mdNode{block: *block})
+			continue
+		}
+
+		switch {
+		case mdDivider.MatchString(line):
+			flushParagraph()
+			nodes = append(nodes, &mdNode{block: Block{Type: "divider"}})
+		case mdHeading.MatchString(line):
+			flushParagraph()
+			match := mdHeading.FindStringSubmatch(line)
+			// Notion has three heading levels
+			level := min(len(match[1]), 3)
+			nodes = append(nodes, &mdNode{block: textBlock("heading_"+strconv.Itoa(level), match[2])})
+		case mdQuote.MatchString(line):
+			flushParagraph()
+			var quote []string
+			for ; idx < len(lines) && mdQuote.MatchString(lines[idx]); idx++ {
+				quote = append(quote, mdQuote.FindStringSubmatch(strings.TrimRight(lines[idx], " \t"))[1])
+			}
+			idx--
+			nodes = append(nodes, &mdNode{block: textBlock("quote", strings.Join(quote, "\n"))})
+		default:
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	flushParagraph()
+
+	blocks := make([]Block, len(nodes))
+	for idx, node := range nodes {
+		blocks[idx] = node.toBlock()
+	}
+	return blocks
+}
+
+// indentWidth returns the width of leading whitespace, a tab counting as four spaces
+func indentWidth(indent string) int {
+	return len(strings.ReplaceAll(indent, "\t", "    "))
+}
+
+// textBlock creates a block of blockType holding Markdown text
+func textBlock(blockType, text string) Block {
+	return Block{Type: blockType, RichText: MarkdownToRichText(text)}
+}
+
+// codeBlock creates a code block; its text is taken literally
+func codeBlock(code, language string) Block {
+	return Block{Type: "code", RichText: plainRichText(code), Language: language}
+}
+
+// attachmentLine returns the file block of a line holding only an image
+// (![alt](src) or Obsidian's ![[src]]) or a link to a PDF or image, or nil
+func attachmentLine(line string) *Block {
+	var src, caption string
+	if match := mdWikiEmbed.FindStringSubmatch(line); match != nil {
+		src = strings.TrimSpace(match[1])
+	} else if match := mdEmbed.FindStringSubmatch(line); match != nil {
+		src, caption = strings.TrimSpace(match[3]), match[2]
+		if match[1] == "" && attachmentType(src) == "file" {
+			// A plain link is only an attachment if it is to an image or PDF
+			return nil
+		}
+	} else {
+		return nil
+	}
+
+	block := Block{
+		Type: attachmentType(src),
+		Data: map[string]interface{}{
+			"type":     "external",
+			"external": map[string]interface{}{"url": src},
+		},
+	}
+	if caption != "" {
+		block.Data["caption"] = MarkdownToRichText(caption)
+	}
+	return &block
+}
+
+// attachmentType returns the block type for a file: image, pdf or file
+func attachmentType(src string) string {
+	if idx := strings.IndexAny(src, "?#"); idx >= 0 {
+		src = src[:idx]
+	}
+	switch strings.ToLower(path.Ext(src)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg", ".bmp", ".heic", ".tif", ".tiff", ".ico":
+		return "image"
+	case ".pdf":
+		return "pdf"
+	}
+	return "file"
+}
+
+// splitTableRow returns the cells of a "| a | b |" row
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+
+	// A pipe escaped as \| belongs to the cell
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableBlocks creates the tables of a Markdown table: one, or for more rows
+// than Notion takes children in a request, tables of that many rows one
+// after another, each starting with the header
+func tableBlocks(rows [][]string) []Block {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	// Padded, so every table is as wide as the widest row
+	header := append(rows[0], make([]string, width-len(rows[0]))...)
+
+	var tables []Block
+	perTable := notionMaxBlocksPerRequest - 1
+	for start := 1; start == 1 || start < len(rows); start += perTable {
+		end := min(start+perTable, len(rows))
+		tables = append(tables, tableBlock(append([][]string{header}, rows[start:end]...)))
+	}
+	return tables
+}
+
+// tableBlock creates a table whose first row is its header; short rows are
+// padded to the widest
+func tableBlock(rows [][]string) Block {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	children := make([]Block, len(rows))
+	for idx, row := range rows {
+		cells := make([][]RichText, width)
+		for col := range cells {
+			cells[col] = []RichText{}
+			if col < len(row) {
+				cells[col] = MarkdownToRichText(row[col])
+			}
+		}
+		children[idx] = Block{Type: "table_row", Data: map[string]interface{}{"cells": cells}}
+	}
+
+	return Block{
+		Type: "table",
+		Data: map[string]interface{}{
+			"table_width":       width,
+			"has_column_header": true,
+			"has_row_header":    false,
+		},
+		Children: children,
+	}
+}
+
+// textStyle is the inline formatting of a run of text
+type textStyle struct {
+	bold, italic, strikethrough, code bool
+	link                              string
+}
+
+// inlineMarkers are the inline formatting delimiters, longest first so **
+// isn't read as two *
+var inlineMarkers = []struct {
+	marker string
+	apply  func(style textStyle) textStyle
+}{
+	{"**", func(s textStyle) textStyle { s.bold = true; return s }},
+	{"__", func(s textStyle) textStyle { s.bold = true; return s }},
+	{"~~", func(s textStyle) textStyle { s.strikethrough = true; return s }},
+	{"*", func(s textStyle) textStyle { s.italic = true; return s }},
+	{"_", func(s textStyle) textStyle { s.italic = true; return s }},
+}
+
+// mdLink matches a [text](url) link at the start of a string
+var mdLink = regexp.MustCompile(`^\[([^\]]+)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+
+// MarkdownToRichText converts a line of Markdown to Notion rich text
+func MarkdownToRichText(text string) []RichText {
+	var richText []RichText
+	parseInline(text, textStyle{}, &richText)
+	return richText
+}
+
+// parseInline appends the rich text of Markdown text in style to out
+func parseInline(text string, style textStyle, out *[]RichText) {
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			*out = append(*out, styledText(plain.String(), style)...)
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		// Backslash escapes a formatting character
+		if rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_~[]()#|>-+.!", rune(rest[1])) {
+			plain.WriteByte(rest[1])
+			i += 2
+			continue
+		}
+
+		// Inline code is taken literally
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				flush()
+				codeStyle := style
+				codeStyle.code = true
+				*out = append(*out, styledText(rest[1:end+1], codeStyle)...)
+				i += end + 2
+				continue
+			}
+		}
+
+		// Notion only takes absolute links; an image inside text is its
+		// alt text, linking to the image if it is on the web
+		image := rest[0] == '!' && strings.HasPrefix(rest[1:], "[")
+		if rest[0] == '[' || image {
+			offset := 0
+			if image {
+				offset = 1
+			}
+			if match := mdLink.FindStringSubmatch(rest[offset:]); match != nil {
+				flush()
+				linkStyle := style
+				if strings.Contains(match[2], "://") || strings.HasPrefix(match[2], "mailto:") {
+					linkStyle.link = match[2]
+				}
+				parseInline(match[1], linkStyle, out)
+				i += offset + len(match[0])
+				continue
+			}
+		}
+
+		// An _ inside a word (snake_case) doesn't start emphasis
+		wordBefore := i > 0 && isWordByte(text[i-1])
+		if marker, inner, ok := emphasis(rest); ok && !(wordBefore && marker[0] == '_') {
+			flush()
+			for _, m := range inlineMarkers {
+				if m.marker == marker {
+					parseInline(inner, m.apply(style), out)
+					break
+				}
+			}
+			i += len(inner) + 2*len(marker)
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		plain.WriteString(rest[:size])
+		i += size
+	}
+	flush()
+}
+
+// emphasis reports whether text starts with emphasized text, returning the
+// marker and the text inside it. Markers must hug the text they wrap, as in
+// Markdown, so "2 * 3 * 4" stays literal; _ only works at word boundaries,
+// so snake_case names stay intact.
+func emphasis(text string) (string, string, bool) {
+	for _, m := range inlineMarkers {
+		if !strings.HasPrefix(text, m.marker) {
+			continue
+		}
+		body := text[len(m.marker):]
+		if body == "" || body[0] == ' ' || (len(m.marker) == 1 && strings.HasPrefix(body, m.marker)) {
+			continue
+		}
+		for offset := 0; ; {
+			end := strings.Index(body[offset:], m.marker)
+			if end < 0 {
+				break
+			}
+			end += offset
+			// A doubled marker closes at the end of a run, so the single
+			// marker of ***both*** or **bold *italic*** nests inside it
+			for len(m.marker) > 1 && end+len(m.marker) < len(body) && body[end+len(m.marker)] == m.marker[0] {
+				end++
+			}
+			after := body[end+len(m.marker):]
+			if end > 0 && body[end-1] != ' ' && body[end-1] != '\\' &&
+				(m.marker != "_" || after == "" || !isWordByte(after[0])) &&
+				(len(m.marker) > 1 || !strings.HasPrefix(after, m.marker)) {
+				return m.marker, body[:end], true
+			}
+			offset = end + len(m.marker)
+		}
+	}
+	return "", "", false
+}
+
+// isWordByte reports whether b is a letter, digit or underscore
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// styledText creates rich text objects holding content in style, split at
+// the API's length limit
+func styledText(content string, style textStyle) []RichText {
+	var richText []RichText
+	for _, chunk := range splitText(content, notionMaxTextLength) {
+		object := RichText{Type: "text", Text: &TextContent{Content: chunk}}
+		if style.link != "" {
+			object.Text.Link = &Link{URL: style.link}
+		}
+		if style.bold || style.italic || style.strikethrough || style.code {
+			object.Annotations = &Annotations{
+				Bold:          style.bold,
+				Italic:        style.italic,
+				Strikethrough: style.strikethrough,
+				Code:          style.code,
+			}
+		}
+		richText = append(richText, object)
+	}
+	return richText
+}
+
+// plainRichText creates unformatted rich text, split at the API's length limit
+func plainRichText(content string) []RichText {
+	return styledText(content, textStyle{})
+}
+
+// splitText splits text into pieces of at most limit UTF-16 code units,
+// which is how Notion measures text
+func splitText(text string, limit int) []string {
+	var chunks []string
+	start, units := 0, 0
+	for idx, r := range text {
+		size := 1
+		if r >= 0x10000 {
+			size = 2
+		}
+		if units+size > limit {
+			chunks = append(chunks, text[start:idx])
+			start, units = idx, 0
+		}
+		units += size
+	}
+	return append(chunks, text[start:])
+}
+
+// PlainText returns the text of Notion rich text without its formatting
+func PlainText(richText []RichText) string {
+	var text strings.Builder
+	for _, object := range richText {
+		text.WriteString(object.Content())
+	}
+	return text.String()
+}
+
+// RichTextToMarkdown renders Notion rich text as Markdown
+func RichTextToMarkdown(richText []RichText) string {
+	var text strings.Builder
+	for _, object := range richText {
+		content := object.Content()
+		if content == "" {
+			continue
+		}
+
+		// Markers must hug the text, so surrounding spaces stay outside them
+		trimmed := strings.TrimSpace(content)
+		if trimmed == "" {
+			text.WriteString(content)
+			continue
+		}
+		lead := content[:strings.Index(content, trimmed)]
+		trail := content[len(lead)+len(trimmed):]
+
+		if annotations := object.Annotations; annotations != nil {
+			if annotations.Code {
+				trimmed = "`" + trimmed + "`"
+			}
+			if annotations.Bold {
+				trimmed = "**" + trimmed + "**"
+			}
+			if annotations.Italic {
+				trimmed = "*" + trimmed + "*"
+			}
+			if annotations.Strikethrough {
+				trimmed = "~~" + trimmed + "~~"
+			}
+		}
+		if href := object.URL(); href != "" {
+			trimmed = "[" + trimmed + "](" + href + ")"
+		}
+		text.WriteString(lead + trimmed + trail)
+	}
+	return text.String()
+}
+
+// BlocksToMarkdown renders Notion blocks as Markdown. Nested blocks are
+// read from each block's Children, as GetBlockTree leaves them; pageLink
+// returns the link to use for a child page or database.
+func BlocksToMarkdown(blocks []Block, pageLink func(block Block) string) string {
+	var out strings.Builder
+	renderBlocks(&out, blocks, "", pageLink)
+	if out.Len() == 0 {
+		return ""
+	}
+	return strings.TrimRight(out.String(), "\n") + "\n"
+}
+
+// renderBlocks writes blocks indented by indent, separating all but
+// consecutive list items with a blank line
+func renderBlocks(out *strings.Builder, blocks []Block, indent string, pageLink func(Block) string) {
+	number := 0
+	previous := ""
+	for _, block := range blocks {
+		blockType := block.Type
+		content := block.Data
+		text := RichTextToMarkdown(block.RichText)
+		children := block.Children
+
+		if blockType == "numbered_list_item" {
+			number++
+		} else {
+			number = 0
+		}
+		listItem := blockType == "bulleted_list_item" || blockType == "numbered_list_item" || blockType == "to_do"
+		if previous != "" && !(listItem && (previous == "bulleted_list_item" || previous == "numbered_list_item" || previous == "to_do")) {
+			out.WriteString("\n")
+		}
+		previous = blockType
+
+		line := ""
+		switch blockType {
+		case "paragraph":
+			line = text
+		case "heading_1", "heading_2", "heading_3":
+			line = strings.Repeat("#", int(blockType[len(blockType)-1]-'0')) + " " + text
+		case "bulleted_list_item":
+			line = "- " + text
+		case "numbered_list_item":
+			line = fmt.Sprintf("%d. %s", number, text)
+		case "to_do":
+			box := "[ ]"
+			if block.Checked {
+				box = "[x]"
+			}
+			line = "- " + box + " " + text
+		case "toggle":
+			line = "- " + text
+		case "quote", "callout":
+			line = "> " + strings.ReplaceAll(text, "\n", "\n> ")
+		case "code":
+			language := block.Language
+			if language == "plain text" {
+				language = ""
+			}
+			line = "```" + language + "\n" + PlainText(block.RichText) + "\n```"
+		case "equation":
+			expression, _ := content["expression"].(string)
+			line = "$$" + expression + "$$"
+		case "divider":
+			line = "---"
+		case "table":
+			line = renderTable(children, content["has_column_header"] == true)
+			children = nil
+		case "image", "file", "pdf", "video", "audio":
+			url := fileURL(content)
+			label := PlainText(richTextFromJSON(content["caption"]))
+			if label == "" {
+				label = blockType
+			}
+			if blockType == "image" {
+				line = "![" + label + "](" + url + ")"
+			} else {
+				line = "[" + label + "](" + url + ")"
+			}
+		case "bookmark", "embed", "link_preview":
+			url, _ := content["url"].(string)
+			line = "<" + url + ">"
+		case "child_page", "child_database":
+			title, _ := content["title"].(string)
+			if title == "" {
+				title = "Untitled"
+			}
+			line = "[" + title + "](" + pageLink(block) + ")"
+		default:
+			// Synced blocks, columns and the like only hold other blocks
+			if len(children) > 0 {
+				renderBlocks(out, children, indent, pageLink)
+			}
+			continue
+		}
+
+		out.WriteString(indentLines(line, indent) + "\n")
+		if len(children) > 0 {
+			childIndent := indent + "  "
+			if !listItem {
+				out.WriteString("\n")
+			}
+			renderBlocks(out, children, childIndent, pageLink)
+		}
+	}
+}
+
+// renderTable renders table rows as a Markdown table; Markdown needs a
+// header row, so a table without one gets an empty header
+func renderTable(rows []Block, hasHeader bool) string {
+	var lines []string
+	width := 0
+	for _, row := range rows {
+		var cells [][]RichText
+		switch value := row.Data["cells"].(type) {
+		case [][]RichText:
+			cells = value
+		case []interface{}:
+			for _, cell := range value {
+				cells = append(cells, richTextFromJSON(cell))
+			}
+		}
+		var rendered []string
+		for _, cell := range cells {
+			rendered = append(rendered, strings.ReplaceAll(RichTextToMarkdown(cell), "|", "\\|"))
+		}
+		width = max(width, len(rendered))
+		lines = append(lines, "| "+strings.Join(rendered, " | ")+" |")
+	}
+	if width == 0 {
+		return ""
+	}
+
+	separator := "|" + strings.Repeat(" --- |", width)
+	if hasHeader && len(lines) > 0 {
+		lines = append([]string{lines[0], separator}, lines[1:]...)
+	} else {
+		lines = append([]string{"|" + strings.Repeat("  |", width), separator}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentLines indents every non-empty line of text
+func indentLines(text, indent string) string {
+	if indent == "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		if line != "" {
+			lines[idx] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fileURL returns the URL of an uploaded or external file block
+func fileURL(content map[string]interface{}) string {
+	for _, kind := range []string{"file", "external"} {
+		if file, ok := content[kind].(map[string]interface{}); ok {
+			url, _ := file["url"].(string)
+			return url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,383 @@
+package utility
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// outline describes blocks one per line as "type: text", with the checkbox
+// of to-dos, the language of code and the cells of table rows, and nested
+// blocks indented below their parent
+func outline(blocks []Block) string {
+	var out strings.Builder
+	var write func(blocks []Block, indent string)
+	write = func(blocks []Block, indent string) {
+		for _, block := range blocks {
+			label := block.Type
+			switch block.Type {
+			case "to_do":
+				label += map[bool]string{false: " [ ]", true: " [x]"}[block.Checked]
+			case "code":
+				label += " (" + block.Language + ")"
+			}
+			text := PlainText(block.RichText)
+			if cells, ok := block.Data["cells"].([][]RichText); ok {
+				texts := make([]string, len(cells))
+				for i, cell := range cells {
+					texts[i] = PlainText(cell)
+				}
+				text = strings.Join(texts, " | ")
+			}
+			fmt.Fprintf(&out, "%s%s: %s\n", indent, label, text)
+			write(block.Children, indent+"  ")
+		}
+	}
+	write(blocks, "")
+	return out.String()
+}
+
+// runs describes rich text one run per element, prefixed with its
+// formatting (b, i, s, c) and followed by its link, e.g. "[b]bold" or
+// "[]site -> https://example.com"
+func runs(richText []RichText) []string {
+	var out []string
+	for _, object := range richText {
+		flags := ""
+		if a := object.Annotations; a != nil {
+			for _, flag := range []struct {
+				on   bool
+				name string
+			}{{a.Bold, "b"}, {a.Italic, "i"}, {a.Strikethrough, "s"}, {a.Code, "c"}} {
+				if flag.on {
+					flags += flag.name
+				}
+			}
+		}
+		run := "[" + flags + "]" + object.Content()
+		if href := object.URL(); href != "" {
+			run += " -> " + href
+		}
+		out = append(out, run)
+	}
+	return out
+}
+
+// longTable returns a Markdown table of n rows below its header and the
+// outline of the tables Notion takes it as, of at most 100 rows each
+func longTable(n int) (markdown, want string) {
+	markdown = "| n | square |\n|---|---|\n"
+	for i := 1; i <= n; i++ {
+		if (i-1)%99 == 0 {
+			want += "table: \n  table_row: n | square\n"
+		}
+		markdown += fmt.Sprintf("| %d | %d |\n", i, i*i)
+		want += fmt.Sprintf("  table_row: %d | %d\n", i, i*i)
+	}
+	return markdown, want
+}
+
+func TestMarkdownToBlocks(t *testing.T) {
+	longMarkdown, longOutline := longTable(250)
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "nested bullets",
+			markdown: "- fruit\n  - apple\n  - pear\n- vegetables",
+			want: "bulleted_list_item: fruit\n" +
+				"  bulleted_list_item: apple\n" +
+				"  bulleted_list_item: pear\n" +
+				"bulleted_list_item: vegetables\n",
+		},
+		{
+			name:     "nesting deeper than the API takes stays at the deepest level",
+			markdown: "- one\n  - two\n    - three\n      - four",
+			want: "bulleted_list_item: one\n" +
+				"  bulleted_list_item: two\n" +
+				"    bulleted_list_item: three\n" +
+				"    bulleted_list_item: four\n",
+		},
+		{
+			name:     "numbered with nested bullets and tabs",
+			markdown: "1. first\n\t- detail\n2) second",
+			want: "numbered_list_item: first\n" +
+				"  bulleted_list_item: detail\n" +
+				"numbered_list_item: second\n",
+		},
+		{
+			name:     "to-dos",
+			markdown: "- [ ] open\n- [x] done\n* [X] also done",
+			want:     "to_do [ ]: open\nto_do [x]: done\nto_do [x]: also done\n",
+		},
+		{
+			name:     "code fence with language",
+			markdown: "```go\nfunc main() {\n\t**not bold**\n}\n```",
+			want:     "code (go): func main() {\n\t**not bold**\n}\n",
+		},
+		{
+			name:     "code fence languages are mapped to Notion's",
+			markdown: "~~~py\nprint(1)\n~~~\n\n```sh\nls\n```\n\n```brainfuck\n+\n```",
+			want:     "code (python): print(1)\ncode (shell): ls\ncode (plain text): +\n",
+		},
+		{
+			name:     "unterminated fence runs to the end",
+			markdown: "```\nstill code\n\n# not a heading",
+			want:     "code (plain text): still code\n\n# not a heading\n",
+		},
+		{
+			name:     "quote across lines",
+			markdown: "> to be\n> or not\n\nafter",
+			want:     "quote: to be\nor not\nparagraph: after\n",
+		},
+		{
+			name:     "table",
+			markdown: "| name | qty |\n| :--- | ---: |\n| apple | 3 |\n| pear |",
+			want: "table: \n" +
+				"  table_row: name | qty\n" +
+				"  table_row: apple | 3\n" +
+				"  table_row: pear | \n",
+		},
+		{
+			name:     "table of more rows than a request takes is split",
+			markdown: longMarkdown,
+			want:     longOutline,
+		},
+		{
+			name:     "table cell with escaped pipe",
+			markdown: "| a |\n|---|\n| x \\| y |",
+			want:     "table: \n  table_row: a\n  table_row: x | y\n",
+		},
+		{
+			name:     "headings, paragraphs and dividers",
+			markdown: "# Title\n#### Deep ###\nline one\nline two\n\n---\n***",
+			want: "heading_1: Title\n" +
+				"heading_3: Deep\n" +
+				"paragraph: line one\nline two\n" +
+				"divider: \n" +
+				"divider: \n",
+		},
+		{
+			name:     "images and PDF links become file blocks",
+			markdown: "![diagram](https://example.com/d.png)\n\n[paper](https://example.com/p.pdf)\n\n[site](https://example.com)",
+			want:     "image: \npdf: \nparagraph: site\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outline(MarkdownToBlocks(tt.markdown)); got != tt.want {
+				t.Errorf("MarkdownToBlocks(%q):\n%s\nwant:\n%s", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToBlocksTableWidth(t *testing.T) {
+	blocks := MarkdownToBlocks("| a | b | c |\n|---|---|---|\n| 1 |")
+	if len(blocks) != 1 || blocks[0].Type != "table" {
+		t.Fatalf("got %s", outline(blocks))
+	}
+	if width := blocks[0].Data["table_width"]; width != 3 {
+		t.Errorf("table_width = %v, want 3", width)
+	}
+	for _, row := range blocks[0].Children {
+		if cells := row.Data["cells"].([][]RichText); len(cells) != 3 {
+			t.Errorf("row has %d cells, want 3 (padded)", len(cells))
+		}
+	}
+
+	// A split table is as wide in every part, however wide its rows there
+	markdown, _ := longTable(100)
+	blocks = MarkdownToBlocks(markdown + "| 101 | 10201 | wide |")
+	if len(blocks) != 2 {
+		t.Fatalf("got %d blocks, want 2 tables", len(blocks))
+	}
+	for i, table := range blocks {
+		if width := table.Data["table_width"]; width != 3 {
+			t.Errorf("table %d: table_width = %v, want 3", i, width)
+		}
+		if len(table.Children) > 100 {
+			t.Errorf("table %d has %d rows, more than a request takes", i, len(table.Children))
+		}
+	}
+}
+
+func TestMarkdownToRichText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"plain", "just text", []string{"[]just text"}},
+		{"bold", "a **bold** word", []string{"[]a ", "[b]bold", "[] word"}},
+		{"bold with underscores", "__strong__", []string{"[b]strong"}},
+		{"italic", "*it* and _it_", []string{"[i]it", "[] and ", "[i]it"}},
+		{"bold italic", "***both***", []string{"[bi]both"}},
+		{"italic inside bold", "**bold *and italic***", []string{"[b]bold ", "[bi]and italic"}},
+		{"strikethrough", "~~gone~~", []string{"[s]gone"}},
+		{"inline code is literal", "run `**x**` now", []string{"[]run ", "[c]**x**", "[] now"}},
+		{"link", "see [the site](https://example.com)", []string{"[]see ", "[]the site -> https://example.com"}},
+		{"bold link", "[**docs**](https://example.com/docs)", []string{"[b]docs -> https://example.com/docs"}},
+		{"mailto link", "[me](mailto:me@example.com)", []string{"[]me -> mailto:me@example.com"}},
+		{"relative link keeps only its text", "[notes](notes.md)", []string{"[]notes"}},
+		{"snake_case stays", "my_var_name", []string{"[]my_var_name"}},
+		{"spaced stars stay", "2 * 3 * 4", []string{"[]2 * 3 * 4"}},
+		{"escaped markers", `\*not italic\*`, []string{"[]*not italic*"}},
+		{"unclosed marker", "**open", []string{"[]**open"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runs(MarkdownToRichText(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MarkdownToRichText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToRichTextSplitsLongText(t *testing.T) {
+	// An emoji takes two UTF-16 code units, which is what Notion counts
+	text := strings.Repeat("a", notionMaxTextLength-1) + "😀" + "b"
+	got := MarkdownToRichText(text)
+	if len(got) != 2 {
+		t.Fatalf("got %d rich text objects, want 2", len(got))
+	}
+	if got[0].Content() != strings.Repeat("a", notionMaxTextLength-1) || got[1].Content() != "😀b" {
+		t.Errorf("split at the wrong place: %q | %q", got[0].Content(), got[1].Content())
+	}
+}
+
+func TestBlocksToMarkdown(t *testing.T) {
+	link := func(block Block) string { return "https://notion.so/" + block.ID }
+	tests := []struct {
+		name   string
+		blocks []Block
+		want   string
+	}{
+		{
+			name: "consecutive list items stay together",
+			blocks: []Block{
+				textBlock("numbered_list_item", "one"),
+				textBlock("numbered_list_item", "two"),
+				{Type: "to_do", RichText: plainRichText("task"), Checked: true},
+				textBlock("paragraph", "after"),
+			},
+			want: "1. one\n2. two\n- [x] task\n\nafter\n",
+		},
+		{
+			name: "nested list items are indented",
+			blocks: []Block{{
+				Type:     "bulleted_list_item",
+				RichText: plainRichText("outer"),
+				Children: []Block{textBlock("bulleted_list_item", "inner")},
+			}},
+			want: "- outer\n  - inner\n",
+		},
+		{
+			name:   "code keeps its text literal",
+			blocks: []Block{codeBlock("a *b*", "plain text"), codeBlock("x := 1", "go")},
+			want:   "```\na *b*\n```\n\n```go\nx := 1\n```\n",
+		},
+		{
+			name: "formatting hugs the text",
+			blocks: []Block{{Type: "paragraph", RichText: []RichText{
+				{Type: "text", Text: &TextContent{Content: "say "}},
+				{Type: "text", Text: &TextContent{Content: " hi "}, Annotations: &Annotations{Bold: true}},
+				{Type: "text", Text: &TextContent{Content: "there", Link: &Link{URL: "https://example.com"}}},
+			}}},
+			want: "say  **hi** [there](https://example.com)\n",
+		},
+		{
+			name:   "child pages link with pageLink",
+			blocks: []Block{{ID: "abc", Type: "child_page", Data: map[string]interface{}{"title": "Sub"}}},
+			want:   "[Sub](https://notion.so/abc)\n",
+		},
+		{
+			name:   "quote across lines",
+			blocks: []Block{textBlock("quote", "one\ntwo")},
+			want:   "> one\n> two\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlocksToMarkdown(tt.blocks, link); got != tt.want {
+				t.Errorf("BlocksToMarkdown:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlocksRoundTrip(t *testing.T) {
+	bold := &Annotations{Bold: true}
+	text := func(content string, annotations *Annotations) RichText {
+		return RichText{Type: "text", Text: &TextContent{Content: content}, Annotations: annotations}
+	}
+	tests := []struct {
+		name   string
+		blocks []Block
+	}{
+		{"headings and paragraphs", []Block{
+			textBlock("heading_1", "Title"),
+			textBlock("heading_2", "Part"),
+			{Type: "paragraph", RichText: []RichText{text("plain ", nil), text("bold", bold), text(" end", nil)}},
+		}},
+		{"nested lists", []Block{
+			{Type: "bulleted_list_item", RichText: plainRichText("fruit"), Children: []Block{
+				textBlock("bulleted_list_item", "apple"),
+				{Type: "numbered_list_item", RichText: plainRichText("pear"), Children: []Block{
+					textBlock("bulleted_list_item", "ripe"),
+				}},
+			}},
+			textBlock("bulleted_list_item", "vegetables"),
+		}},
+		{"to-dos", []Block{
+			{Type: "to_do", RichText: plainRichText("open")},
+			{Type: "to_do", RichText: plainRichText("done"), Checked: true},
+		}},
+		{"code with language", []Block{
+			codeBlock("package main\n\nfunc main() {}", "go"),
+			codeBlock("*literal*", "plain text"),
+		}},
+		{"quote and divider", []Block{
+			textBlock("quote", "first\nsecond"),
+			{Type: "divider"},
+		}},
+		{"table", []Block{
+			tableBlock([][]string{{"name", "qty"}, {"**apple**", "3"}, {"pear | plum", ""}}),
+		}},
+		{"inline formatting and links", []Block{
+			textBlock("paragraph", "***both*** and ~~gone~~ and `code` and [**a link**](https://example.com)"),
+		}},
+		{"image", []Block{
+			*attachmentLine("![chart](https://example.com/chart.png)"),
+		}},
+	}
+	link := func(Block) string { return "" }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markdown := BlocksToMarkdown(tt.blocks, link)
+			if got := MarkdownToBlocks(markdown); !reflect.DeepEqual(got, tt.blocks) {
+				t.Errorf("blocks came back changed through %q:\n%s\nwant:\n%s", markdown, outline(got), outline(tt.blocks))
+			}
+		})
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	// Documents in the form BlocksToMarkdown writes come back unchanged
+	documents := []string{
+		"# Groceries\n\n- fruit\n  - **apples**\n  - pears\n- [ ] milk\n- [x] bread\n",
+		"## Setup\n\n1. Install *go*\n2. Run `make`\n\n```bash\nmake install\n```\n",
+		"> Quoted with a [link](https://example.com)\n> over two lines\n\n---\n\n~~old~~ text\n",
+		"| name | qty |\n| --- | --- |\n| apple | 3 |\n| pear \\| plum | 1 |\n",
+		"### Mixed\n\nSome **bold** ***nested*** text and `code`.\n\n![chart](https://example.com/chart.png)\n",
+	}
+	link := func(Block) string { return "" }
+	for _, document := range documents {
+		if markdown := BlocksToMarkdown(MarkdownToBlocks(document), link); markdown != document {
+			t.Errorf("blocks of %q render as %q", document, markdown)
+		}
+	}
+}
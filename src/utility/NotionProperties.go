@@ -0,0 +1,293 @@
+/**
+ * NotionProperties - Typed page and property helpers
+ * Reads the fields and properties of pages (and the property schema of
+ * databases) without walking the API's nested maps, and builds the values
+ * pages are created and updated with: title, rich_text, select,
+ * multi_select, date, relation, number, checkbox and url.
+ */
+
+package utility
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PropertyValue is the value of a page property as the API takes it
+type PropertyValue map[string]interface{}
+
+// Properties are the values of a page's properties by name
+type Properties map[string]PropertyValue
+
+// TitleValue is a title property holding text
+func TitleValue(text string) PropertyValue {
+	return PropertyValue{"title": plainRichText(text)}
+}
+
+// RichTextValue is a rich_text property holding text
+func RichTextValue(text string) PropertyValue {
+	return PropertyValue{"rich_text": plainRichText(text)}
+}
+
+// SelectValue is a select property set to an option, created if the
+// database doesn't have it yet
+func SelectValue(option string) PropertyValue {
+	return PropertyValue{"select": map[string]interface{}{"name": option}}
+}
+
+// StatusValue is a status property set to an existing option
+func StatusValue(option string) PropertyValue {
+	return PropertyValue{"status": map[string]interface{}{"name": option}}
+}
+
+// MultiSelectValue is a multi_select property set to options
+func MultiSelectValue(options ...string) PropertyValue {
+	values := make([]map[string]interface{}, len(options))
+	for idx, option := range options {
+		values[idx] = map[string]interface{}{"name": option}
+	}
+	return PropertyValue{"multi_select": values}
+}
+
+// DateValue is a date property set to a moment
+func DateValue(t time.Time) PropertyValue {
+	return PropertyValue{"date": map[string]interface{}{"start": t.Format(time.RFC3339)}}
+}
+
+// DayValue is a date property set to a day, without a time
+func DayValue(t time.Time) PropertyValue {
+	return PropertyValue{"date": map[string]interface{}{"start": t.Format("2006-01-02")}}
+}
+
+// DateRangeValue is a date property set to a span of time
+func DateRangeValue(start, end time.Time) PropertyValue {
+	return PropertyValue{"date": map[string]interface{}{
+		"start": start.Format(time.RFC3339),
+		"end":   end.Format(time.RFC3339),
+	}}
+}
+
+// RelationValue is a relation property linking to pages
+func RelationValue(pageIDs ...string) PropertyValue {
+	pages := make([]map[string]interface{}, len(pageIDs))
+	for idx, id := range pageIDs {
+		pages[idx] = map[string]interface{}{"id": id}
+	}
+	return PropertyValue{"relation": pages}
+}
+
+// NumberValue is a number property
+func NumberValue(number float64) PropertyValue {
+	return PropertyValue{"number": number}
+}
+
+// CheckboxValue is a checkbox property
+func CheckboxValue(checked bool) PropertyValue {
+	return PropertyValue{"checkbox": checked}
+}
+
+// URLValue is a url property
+func URLValue(url string) PropertyValue {
+	return PropertyValue{"url": url}
+}
+
+// ID returns the ID of a page or database
+func (p PageObjectResponse) ID() string {
+	id, _ := p["id"].(string)
+	return id
+}
+
+// URL returns the address of a page or database in Notion
+func (p PageObjectResponse) URL() string {
+	url, _ := p["url"].(string)
+	return url
+}
+
+// LastEditedTime returns when a page or database was last edited; Notion
+// keeps it to the minute
+func (p PageObjectResponse) LastEditedTime() time.Time {
+	return parseNotionTime(p["last_edited_time"])
+}
+
+// CreatedTime returns when a page or database was created
+func (p PageObjectResponse) CreatedTime() time.Time {
+	return parseNotionTime(p["created_time"])
+}
+
+// Archived reports whether a page or database is in the trash
+func (p PageObjectResponse) Archived() bool {
+	return p["archived"] == true || p["in_trash"] == true
+}
+
+// Title returns the title of a page or database, or "" if it has none
+func (p PageObjectResponse) Title() string {
+	// A database's title is its own
+	if title, ok := p["title"].([]interface{}); ok {
+		return PlainText(richTextFromJSON(title))
+	}
+	// A page's title is the property of type title
+	return p.Text(p.TitleProperty())
+}
+
+// TitleProperty returns the name of the title property of a page or of a
+// database's schema, or ""
+func (p PageObjectResponse) TitleProperty() string {
+	for name, propertyType := range p.PropertyTypes() {
+		if propertyType == "title" {
+			return name
+		}
+	}
+	return ""
+}
+
+// PropertyTypes returns the type of each property by name; for a database
+// these are its columns
+func (p PageObjectResponse) PropertyTypes() map[string]string {
+	properties, _ := p["properties"].(map[string]interface{})
+	types := make(map[string]string, len(properties))
+	for name, value := range properties {
+		property, _ := value.(map[string]interface{})
+		propertyType, _ := property["type"].(string)
+		types[name] = propertyType
+	}
+	return types
+}
+
+// property returns a property of the page and its value, if the property
+// has type propertyType (or any type, if that is "")
+func (p PageObjectResponse) property(name, propertyType string) (interface{}, bool) {
+	properties, _ := p["properties"].(map[string]interface{})
+	property, _ := properties[name].(map[string]interface{})
+	actual, _ := property["type"].(string)
+	if property == nil || (propertyType != "" && actual != propertyType) {
+		return nil, false
+	}
+	return property[actual], true
+}
+
+// RichText returns the text of a title or rich_text property
+func (p PageObjectResponse) RichText(name string) []RichText {
+	if value, ok := p.property(name, "title"); ok {
+		return richTextFromJSON(value)
+	}
+	if value, ok := p.property(name, "rich_text"); ok {
+		return richTextFromJSON(value)
+	}
+	return nil
+}
+
+// Text returns the plain text of a title or rich_text property
+func (p PageObjectResponse) Text(name string) string {
+	return PlainText(p.RichText(name))
+}
+
+// Select returns the option of a select or status property, or ""
+func (p PageObjectResponse) Select(name string) string {
+	value, ok := p.property(name, "select")
+	if !ok {
+		value, _ = p.property(name, "status")
+	}
+	option, _ := value.(map[string]interface{})
+	selected, _ := option["name"].(string)
+	return selected
+}
+
+// MultiSelect returns the options of a multi_select property
+func (p PageObjectResponse) MultiSelect(name string) []string {
+	value, _ := p.property(name, "multi_select")
+	options, _ := value.([]interface{})
+	var names []string
+	for _, item := range options {
+		option, _ := item.(map[string]interface{})
+		if selected, _ := option["name"].(string); selected != "" {
+			names = append(names, selected)
+		}
+	}
+	return names
+}
+
+// Date returns the start and end (zero unless it is a range) of a date
+// property; ok is false if it is empty
+func (p PageObjectResponse) Date(name string) (start, end time.Time, ok bool) {
+	value, _ := p.property(name, "date")
+	date, _ := value.(map[string]interface{})
+	if date == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start, end = parseNotionTime(date["start"]), parseNotionTime(date["end"])
+	return start, end, !start.IsZero()
+}
+
+// Relation returns the IDs of the pages a relation property links to
+func (p PageObjectResponse) Relation(name string) []string {
+	value, _ := p.property(name, "relation")
+	pages, _ := value.([]interface{})
+	var ids []string
+	for _, item := range pages {
+		page, _ := item.(map[string]interface{})
+		if id, _ := page["id"].(string); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Number returns the value of a number property; ok is false if it is empty
+func (p PageObjectResponse) Number(name string) (float64, bool) {
+	value, _ := p.property(name, "number")
+	number, ok := value.(float64)
+	return number, ok
+}
+
+// Checkbox reports whether a checkbox property is checked
+func (p PageObjectResponse) Checkbox(name string) bool {
+	value, _ := p.property(name, "checkbox")
+	return value == true
+}
+
+// PropertyText renders any property of a page as plain text, "" if it is
+// empty or of a type without a text form
+func (p PageObjectResponse) PropertyText(name string) string {
+	types := p.PropertyTypes()
+	switch types[name] {
+	case "title", "rich_text":
+		return p.Text(name)
+	case "select", "status":
+		return p.Select(name)
+	case "multi_select":
+		return strings.Join(p.MultiSelect(name), ", ")
+	case "relation":
+		return strings.Join(p.Relation(name), ", ")
+	case "date":
+		// Dates are shown as Notion gives them, keeping days without a time
+		value, _ := p.property(name, "date")
+		date, _ := value.(map[string]interface{})
+		start, _ := date["start"].(string)
+		if end, _ := date["end"].(string); end != "" {
+			return start + " - " + end
+		}
+		return start
+	case "number":
+		if number, ok := p.Number(name); ok {
+			return strconv.FormatFloat(number, 'f', -1, 64)
+		}
+	case "checkbox":
+		return strconv.FormatBool(p.Checkbox(name))
+	case "url", "email", "phone_number", "created_time", "last_edited_time":
+		value, _ := p.property(name, "")
+		text, _ := value.(string)
+		return text
+	}
+	return ""
+}
+
+// parseNotionTime parses a date or time as Notion writes them
+func parseNotionTime(value interface{}) time.Time {
+	text, _ := value.(string)
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t
+	}
+	t, _ := time.Parse("2006-01-02", text)
+	return t
+}
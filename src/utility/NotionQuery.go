@@ -0,0 +1,210 @@
+/**
+ * NotionQuery - Database query filters and sorts
+ * Builds the filter and sort objects of Notion database queries, e.g.
+ *   And(SelectEquals("Type", "Health"), DateOnOrAfter("Date", since))
+ * with a sort on a property or on when pages were created or edited.
+ */
+
+package utility
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NotionFilter is a database query filter; combine filters with And and Or
+// (the API takes two levels of nesting)
+type NotionFilter map[string]interface{}
+
+// PropertyFilter filters on a property of the given type with a condition
+// such as "equals", "contains" or "after"; the helpers below cover the
+// common ones
+func PropertyFilter(property, propertyType, condition string, value interface{}) NotionFilter {
+	return NotionFilter{
+		"property": property,
+		propertyType: map[string]interface{}{
+			condition: value,
+		},
+	}
+}
+
+// And matches pages matching every filter
+func And(filters ...NotionFilter) NotionFilter {
+	return NotionFilter{"and": filters}
+}
+
+// Or matches pages matching any of the filters
+func Or(filters ...NotionFilter) NotionFilter {
+	return NotionFilter{"or": filters}
+}
+
+// TextContains matches a rich_text property containing value
+func TextContains(property, value string) NotionFilter {
+	return PropertyFilter(property, "rich_text", "contains", value)
+}
+
+// TextEquals matches a rich_text property equal to value
+func TextEquals(property, value string) NotionFilter {
+	return PropertyFilter(property, "rich_text", "equals", value)
+}
+
+// TitleContains matches a title property containing value
+func TitleContains(property, value string) NotionFilter {
+	return PropertyFilter(property, "title", "contains", value)
+}
+
+// TitleEquals matches a title property equal to value
+func TitleEquals(property, value string) NotionFilter {
+	return PropertyFilter(property, "title", "equals", value)
+}
+
+// SelectEquals matches a select property set to option
+func SelectEquals(property, option string) NotionFilter {
+	return PropertyFilter(property, "select", "equals", option)
+}
+
+// MultiSelectContains matches a multi_select property including option
+func MultiSelectContains(property, option string) NotionFilter {
+	return PropertyFilter(property, "multi_select", "contains", option)
+}
+
+// StatusEquals matches a status property set to option
+func StatusEquals(property, option string) NotionFilter {
+	return PropertyFilter(property, "status", "equals", option)
+}
+
+// Checkbox matches a checkbox property that is checked or not
+func Checkbox(property string, checked bool) NotionFilter {
+	return PropertyFilter(property, "checkbox", "equals", checked)
+}
+
+// NumberEquals matches a number property equal to value
+func NumberEquals(property string, value float64) NotionFilter {
+	return PropertyFilter(property, "number", "equals", value)
+}
+
+// NumberGreaterThan matches a number property above value
+func NumberGreaterThan(property string, value float64) NotionFilter {
+	return PropertyFilter(property, "number", "greater_than", value)
+}
+
+// NumberLessThan matches a number property below value
+func NumberLessThan(property string, value float64) NotionFilter {
+	return PropertyFilter(property, "number", "less_than", value)
+}
+
+// DateAfter matches a date property after t
+func DateAfter(property string, t time.Time) NotionFilter {
+	return PropertyFilter(property, "date", "after", t.Format(time.RFC3339))
+}
+
+// DateBefore matches a date property before t
+func DateBefore(property string, t time.Time) NotionFilter {
+	return PropertyFilter(property, "date", "before", t.Format(time.RFC3339))
+}
+
+// DateOnOrAfter matches a date property on or after t
+func DateOnOrAfter(property string, t time.Time) NotionFilter {
+	return PropertyFilter(property, "date", "on_or_after", t.Format(time.RFC3339))
+}
+
+// DateOnOrBefore matches a date property on or before t
+func DateOnOrBefore(property string, t time.Time) NotionFilter {
+	return PropertyFilter(property, "date", "on_or_before", t.Format(time.RFC3339))
+}
+
+// IsEmpty matches a property of the given type without a value
+func IsEmpty(property, propertyType string) NotionFilter {
+	return PropertyFilter(property, propertyType, "is_empty", true)
+}
+
+// EditedAfter matches pages last edited after t
+func EditedAfter(t time.Time) NotionFilter {
+	return NotionFilter{
+		"timestamp": "last_edited_time",
+		"last_edited_time": map[string]interface{}{
+			"after": t.Format(time.RFC3339),
+		},
+	}
+}
+
+// NotionSort orders query results; earlier sorts take precedence
+type NotionSort map[string]interface{}
+
+// SortByProperty orders results by a property
+func SortByProperty(property string, ascending bool) NotionSort {
+	return NotionSort{"property": property, "direction": sortDirection(ascending)}
+}
+
+// SortByCreated orders results by when pages were created
+func SortByCreated(ascending bool) NotionSort {
+	return NotionSort{"timestamp": "created_time", "direction": sortDirection(ascending)}
+}
+
+// SortByEdited orders results by when pages were last edited
+func SortByEdited(ascending bool) NotionSort {
+	return NotionSort{"timestamp": "last_edited_time", "direction": sortDirection(ascending)}
+}
+
+// sortDirection names a sort direction
+func sortDirection(ascending bool) string {
+	if ascending {
+		return "ascending"
+	}
+	return "descending"
+}
+
+// DatabaseQuery selects and orders the pages of a database
+type DatabaseQuery struct {
+	Filter NotionFilter // nil matches every page
+	Sorts  []NotionSort
+	Limit  int // most pages returned; 0 returns all
+}
+
+// Query returns the pages of a database matching query, following the
+// cursor through as many requests as needed
+func (n *Notion) Query(ctx context.Context, databaseID string, query *DatabaseQuery) (*QueryDatabaseResponse, error) {
+	n.logger.Debug("Querying database: %s", databaseID)
+
+	body := map[string]interface{}{
+		"page_size": notionMaxPageSize,
+	}
+	limit := 0
+	if query != nil {
+		if query.Filter != nil {
+			body["filter"] = query.Filter
+		}
+		if len(query.Sorts) > 0 {
+			body["sorts"] = query.Sorts
+		}
+		limit = query.Limit
+	}
+
+	// Results come 100 at a time; follow the cursor through all of them
+	var response QueryDatabaseResponse
+	for {
+		if limit > 0 {
+			body["page_size"] = min(notionMaxPageSize, limit-len(response.Results))
+		}
+
+		var page QueryDatabaseResponse
+		if err := n.makeRequest(ctx, "POST", fmt.Sprintf("/databases/%s/query", databaseID), body, &page); err != nil {
+			n.logger.Error("Failed to query database: %v", err)
+			return nil, err
+		}
+		response.Results = append(response.Results, page.Results...)
+
+		if !page.HasMore || page.NextCursor == "" {
+			break
+		}
+		if limit > 0 && len(response.Results) >= limit {
+			response.HasMore, response.NextCursor = true, page.NextCursor
+			break
+		}
+		body["start_cursor"] = page.NextCursor
+	}
+
+	n.logger.Info("Retrieved %d pages from database", len(response.Results))
+	return &response, nil
+}
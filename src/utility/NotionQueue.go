@@ -0,0 +1,441 @@
+/**
+ * NotionQueue - Notion writes kept on disk while the API can't be reached
+ * A client made with Queued() doesn't fail page creates and block appends
+ * when the network is down: it writes them to a queue in the state
+ * directory and sends them, in order, once Notion answers again. A created
+ * page gets a placeholder ID until then, which later queued writes may
+ * target; the placeholder is replaced with the page's real ID as the queue
+ * is replayed. The same write queued twice is kept once.
+ */
+
+package utility
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queuedIDPrefix starts the placeholder IDs of pages not created yet
+const queuedIDPrefix = "queued-"
+
+// queuedIDPattern matches placeholder IDs in endpoints and bodies
+var queuedIDPattern = regexp.MustCompile(queuedIDPrefix + `[0-9a-f]{16}`)
+
+// Limits of the queue
+const (
+	notionQueueMaxAttempts  = 5                  // times a write the API rejects is tried
+	notionQueueReplayPeriod = time.Minute        // time between replays while writes wait
+	notionQueueResolvedAge  = 7 * 24 * time.Hour // how long placeholders are remembered
+)
+
+// notionQueueJob is the scheduler job replaying the queue
+const notionQueueJob = "notion-queue"
+
+// QueuedWrite is a request waiting for Notion to be reachable
+type QueuedWrite struct {
+	ID        string          `json:"id,omitempty"` // placeholder of the page a create makes
+	Method    string          `json:"method"`
+	Endpoint  string          `json:"endpoint"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Key       string          `json:"key"` // hash of the request, to drop duplicates
+	Queued    time.Time       `json:"queued"`
+	Attempts  int             `json:"attempts,omitempty"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// Summary describes the write for people
+func (w QueuedWrite) Summary() string {
+	if w.Method == "POST" && w.Endpoint == "/pages" {
+		var body struct {
+			Parent struct {
+				DatabaseID string `json:"database_id"`
+				PageID     string `json:"page_id"`
+			} `json:"parent"`
+		}
+		_ = json.Unmarshal(w.Body, &body)
+		if body.Parent.DatabaseID != "" {
+			return "create page in database " + body.Parent.DatabaseID
+		}
+		return "create page under " + body.Parent.PageID
+	}
+	if id, ok := strings.CutPrefix(w.Endpoint, "/blocks/"); ok && strings.HasSuffix(id, "/children") {
+		var body struct {
+			Children []json.RawMessage `json:"children"`
+		}
+		_ = json.Unmarshal(w.Body, &body)
+		return fmt.Sprintf("append %d blocks to %s", len(body.Children), strings.TrimSuffix(id, "/children"))
+	}
+	return w.Method + " " + w.Endpoint
+}
+
+// resolvedID is the real ID of a page queued under a placeholder
+type resolvedID struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+// notionQueueFile is the queue as it is kept on disk
+type notionQueueFile struct {
+	Writes   []QueuedWrite         `json:"writes"`
+	Resolved map[string]resolvedID `json:"resolved,omitempty"`
+}
+
+// NotionQueuePath returns the file queued writes are kept in
+func NotionQueuePath() string {
+	return filepath.Join(StateDir(), "notion-queue.json")
+}
+
+// IsQueuedID reports whether id is the placeholder of a page whose create
+// is queued
+func IsQueuedID(id string) bool {
+	return strings.HasPrefix(id, queuedIDPrefix)
+}
+
+// NotionQueue holds Notion writes until the API can be reached
+type NotionQueue struct {
+	logger    *Logger
+	client    *Notion // replays the queue while running
+	isRunning bool
+	fileMu    sync.Mutex // held while the file is read and written
+	replayMu  sync.Mutex // held while the queue is replayed
+	mu        sync.Mutex
+}
+
+var (
+	notionQueueInstance *NotionQueue
+	notionQueueOnce     sync.Once
+)
+
+// GetNotionQueue returns the queue of Notion writes
+func GetNotionQueue() *NotionQueue {
+	notionQueueOnce.Do(func() {
+		notionQueueInstance = &NotionQueue{logger: GetLogger().With("notion")}
+	})
+	return notionQueueInstance
+}
+
+// Queued returns a client that queues page creates and block appends it
+// can't send for lack of a network, instead of failing them
+func (n *Notion) Queued() *Notion {
+	queued := *n
+	queued.queue = GetNotionQueue()
+	return &queued
+}
+
+// Writes returns the queued writes in the order they will be sent
+func (q *NotionQueue) Writes() ([]QueuedWrite, error) {
+	q.fileMu.Lock()
+	defer q.fileMu.Unlock()
+
+	file, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+	return file.Writes, nil
+}
+
+// Len returns the number of queued writes, 0 if the queue can't be read
+func (q *NotionQueue) Len() int {
+	writes, _ := q.Writes()
+	return len(writes)
+}
+
+// load reads the queue; a missing file is empty
+func (q *NotionQueue) load() (notionQueueFile, error) {
+	file := notionQueueFile{Resolved: make(map[string]resolvedID)}
+	data, err := os.ReadFile(NotionQueuePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, fmt.Errorf("failed to read Notion queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("failed to parse Notion queue: %w", err)
+	}
+	if file.Resolved == nil {
+		file.Resolved = make(map[string]resolvedID)
+	}
+	return file, nil
+}
+
+// save replaces the queue file, forgetting old placeholders
+func (q *NotionQueue) save(file notionQueueFile) error {
+	for placeholder, resolved := range file.Resolved {
+		if time.Since(resolved.Created) > notionQueueResolvedAge {
+			delete(file.Resolved, placeholder)
+		}
+	}
+	if _, err := EnsureDir(StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode Notion queue: %w", err)
+	}
+	pending := NotionQueuePath() + ".tmp"
+	if err := os.WriteFile(pending, data, 0644); err != nil {
+		return fmt.Errorf("failed to write Notion queue: %w", err)
+	}
+	return os.Rename(pending, NotionQueuePath())
+}
+
+// enqueue adds a write to the end of the queue, or returns the same write
+// if it is queued already
+func (q *NotionQueue) enqueue(method, endpoint string, body interface{}) (QueuedWrite, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return QueuedWrite{}, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	sum := sha256.Sum256([]byte(method + " " + endpoint + "\n" + string(payload)))
+	write := QueuedWrite{
+		Method:   method,
+		Endpoint: endpoint,
+		Body:     payload,
+		Key:      hex.EncodeToString(sum[:]),
+		Queued:   time.Now(),
+	}
+
+	q.fileMu.Lock()
+	defer q.fileMu.Unlock()
+
+	file, err := q.load()
+	if err != nil {
+		return QueuedWrite{}, err
+	}
+	for _, queued := range file.Writes {
+		if queued.Key == write.Key {
+			q.logger.Debug("Write already queued: %s", queued.Summary())
+			return queued, nil
+		}
+	}
+
+	if method == "POST" && endpoint == "/pages" {
+		random := make([]byte, 8)
+		if _, err := rand.Read(random); err != nil {
+			return QueuedWrite{}, fmt.Errorf("failed to make placeholder ID: %w", err)
+		}
+		write.ID = queuedIDPrefix + hex.EncodeToString(random)
+	}
+	file.Writes = append(file.Writes, write)
+	if err := q.save(file); err != nil {
+		return QueuedWrite{}, err
+	}
+	q.logger.Info("Notion unreachable, queued %s (%d waiting)", write.Summary(), len(file.Writes))
+	return write, nil
+}
+
+// resolve replaces the placeholders in text of pages created since
+func (q *NotionQueue) resolve(text string) string {
+	if !queuedIDPattern.MatchString(text) {
+		return text
+	}
+	q.fileMu.Lock()
+	file, err := q.load()
+	q.fileMu.Unlock()
+	if err != nil {
+		return text
+	}
+	return resolvePlaceholders(text, file.Resolved)
+}
+
+// resolvePlaceholders replaces the placeholders in text that have real IDs
+func resolvePlaceholders(text string, resolved map[string]resolvedID) string {
+	return queuedIDPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if page, ok := resolved[placeholder]; ok {
+			return page.ID
+		}
+		return placeholder
+	})
+}
+
+// Replay sends the queued writes in order with client, stopping at the
+// first that fails, and returns how many were sent. Writes the API keeps
+// rejecting are dropped after a few attempts, as are writes to pages whose
+// create was dropped.
+func (q *NotionQueue) Replay(ctx context.Context, client *Notion) (int, error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	sent := 0
+	for {
+		q.fileMu.Lock()
+		file, err := q.load()
+		q.fileMu.Unlock()
+		if err != nil {
+			return sent, err
+		}
+		if len(file.Writes) == 0 {
+			if sent > 0 {
+				q.logger.Info("Sent %d queued Notion writes", sent)
+			}
+			return sent, nil
+		}
+
+		write := file.Writes[0]
+		endpoint := resolvePlaceholders(write.Endpoint, file.Resolved)
+		payload := []byte(resolvePlaceholders(string(write.Body), file.Resolved))
+
+		var response PageObjectResponse
+		err = nil
+		if pending := queuedIDPattern.FindString(endpoint + string(payload)); pending != "" && !q.creates(file.Writes, pending) {
+			err = fmt.Errorf("page %s was never created", pending)
+			write.Attempts = notionQueueMaxAttempts
+		} else {
+			err = client.sendRequest(ctx, write.Method, endpoint, "application/json", payload, &response)
+		}
+		if err != nil && isNetworkError(err) {
+			return sent, err
+		}
+
+		// The file may have changed while the request was out
+		q.fileMu.Lock()
+		file, loadErr := q.load()
+		if loadErr != nil {
+			q.fileMu.Unlock()
+			return sent, loadErr
+		}
+		idx := -1
+		for i, queued := range file.Writes {
+			if queued.Key == write.Key {
+				idx = i
+				break
+			}
+		}
+		if idx >= 0 {
+			if err == nil {
+				file.Writes = append(file.Writes[:idx], file.Writes[idx+1:]...)
+				if write.ID != "" {
+					file.Resolved[write.ID] = resolvedID{ID: response.ID(), Created: time.Now()}
+				}
+			} else if write.Attempts+1 >= notionQueueMaxAttempts {
+				q.logger.Error("Dropping queued %s: %v", write.Summary(), err)
+				file.Writes = append(file.Writes[:idx], file.Writes[idx+1:]...)
+			} else {
+				file.Writes[idx].Attempts++
+				file.Writes[idx].LastError = err.Error()
+			}
+		}
+		saveErr := q.save(file)
+		q.fileMu.Unlock()
+		if saveErr != nil {
+			return sent, saveErr
+		}
+
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+}
+
+// creates reports whether one of writes creates the page with placeholder id
+func (q *NotionQueue) creates(writes []QueuedWrite, id string) bool {
+	for _, write := range writes {
+		if write.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Start replays the queue with client every minute while writes wait
+func (q *NotionQueue) Start(client *Notion) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.isRunning {
+		return
+	}
+
+	q.isRunning = true
+	q.client = client
+
+	GetScheduler().Add(Job{
+		ID:          notionQueueJob,
+		Description: "Send Notion writes queued while offline",
+		Schedule:    Every(notionQueueReplayPeriod),
+		RunAtStart:  true,
+		Run:         q.replayIfWaiting,
+	})
+}
+
+// Stop halts the replays
+func (q *NotionQueue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.isRunning {
+		return
+	}
+
+	q.isRunning = false
+	GetScheduler().Remove(notionQueueJob)
+}
+
+// replayIfWaiting replays the queue if it holds writes; writes still
+// waiting while offline are not a failure
+func (q *NotionQueue) replayIfWaiting(ctx context.Context) error {
+	if q.Len() == 0 {
+		return nil
+	}
+	if _, err := q.Replay(ctx, q.client); err != nil {
+		q.logger.Debug("Queued Notion writes still waiting: %v", err)
+	}
+	return nil
+}
+
+// write sends a page create or block append, queueing it if the client is
+// Queued() and Notion can't be reached; queued reports whether it was. A
+// queued create leaves a page with a placeholder ID in result.
+func (n *Notion) write(ctx context.Context, method, endpoint string, body interface{}, result *PageObjectResponse) (queued bool, err error) {
+	if n.queue == nil {
+		return false, n.makeRequest(ctx, method, endpoint, body, result)
+	}
+
+	// Writes go out after those already waiting, so Notion gets them in order
+	if n.queue.Len() > 0 {
+		if _, err := n.queue.Replay(ctx, n); err != nil {
+			n.logger.Debug("Queued Notion writes still waiting: %v", err)
+		}
+	}
+	endpoint = n.queue.resolve(endpoint)
+	if n.queue.Len() == 0 && !queuedIDPattern.MatchString(endpoint) {
+		err := n.makeRequest(ctx, method, endpoint, body, result)
+		if err == nil || !isNetworkError(err) {
+			return false, err
+		}
+	}
+
+	write, err := n.queue.enqueue(method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	if write.ID != "" && result != nil {
+		*result = PageObjectResponse{"object": "page", "id": write.ID}
+	}
+	return true, nil
+}
+
+// isNetworkError reports whether err means Notion couldn't be reached, as
+// opposed to the API answering with an error or the caller giving up
+func isNetworkError(err error) bool {
+	var apiErr *NotionAPIError
+	if errors.As(err, &apiErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,160 @@
+/**
+ * Output - Bounded capture of command output
+ * Shell keeps at most MaxOutputBytes of each stream in a Result: the start
+ * and the end of the output, with a marker saying how much was left out in
+ * between. Commands with a lot of output can stream all of it to a file.
+ */
+
+package utility
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultMaxOutputBytes is how much of each stream a Result keeps when
+// ExecOptions.MaxOutputBytes is unset
+const defaultMaxOutputBytes = 1 << 20
+
+// outputBuffer keeps the first and the last limit/2 bytes written to it
+type outputBuffer struct {
+	limit   int // <= 0 keeps everything
+	head    bytes.Buffer
+	tail    []byte
+	dropped int64
+}
+
+// newOutputBuffer creates a buffer keeping limit bytes
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+// WriteLine appends a line of output
+func (b *outputBuffer) WriteLine(line string) {
+	data := line + "\n"
+	if b.limit <= 0 {
+		b.head.WriteString(data)
+		return
+	}
+
+	// The start of the output fills the head, the rest goes to the tail
+	headLimit := b.limit / 2
+	if room := headLimit - b.head.Len(); room > 0 {
+		if len(data) <= room {
+			b.head.WriteString(data)
+			return
+		}
+		b.head.WriteString(data[:room])
+		data = data[room:]
+	}
+
+	// Only the end of the tail is kept; compacting once it has doubled keeps
+	// appends cheap
+	tailLimit := b.limit - headLimit
+	b.tail = append(b.tail, data...)
+	if len(b.tail) > 2*tailLimit {
+		excess := len(b.tail) - tailLimit
+		b.dropped += int64(excess)
+		b.tail = append(b.tail[:0], b.tail[excess:]...)
+	}
+}
+
+// Truncated reports whether output was left out
+func (b *outputBuffer) Truncated() bool {
+	if b.limit <= 0 {
+		return false
+	}
+	return b.dropped > 0 || len(b.tail) > b.limit-b.limit/2
+}
+
+// String returns the kept output, with a marker where output was left out
+func (b *outputBuffer) String() string {
+	if !b.Truncated() {
+		return b.head.String() + string(b.tail)
+	}
+
+	tail := b.tail
+	dropped := b.dropped
+	if excess := len(tail) - (b.limit - b.limit/2); excess > 0 {
+		tail = tail[excess:]
+		dropped += int64(excess)
+	}
+	// End the head and start the tail at a whole line
+	head := b.head.Bytes()
+	if idx := bytes.LastIndexByte(head, '\n'); idx >= 0 {
+		dropped += int64(len(head) - idx - 1)
+		head = head[:idx]
+	}
+	if idx := bytes.IndexByte(tail, '\n'); idx >= 0 && idx < len(tail)-1 {
+		dropped += int64(idx + 1)
+		tail = tail[idx+1:]
+	}
+	return fmt.Sprintf("%s\n[... %d bytes of output truncated ...]\n%s", head, dropped, tail)
+}
+
+// outputFile receives the complete output of a command, from both streams
+type outputFile struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// openOutputFile opens path to append output to, or returns nil for no path
+func openOutputFile(path string) (*outputFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	return &outputFile{file: file}, nil
+}
+
+// WriteLine appends a line of output; a nil outputFile discards it
+func (f *outputFile) WriteLine(line string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintln(f.file, Redact(line))
+}
+
+// Close closes the file
+func (f *outputFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// maxLineBytes is the longest line passed on; the rest of a longer line is dropped
+const maxLineBytes = 64 << 10
+
+// readLines calls fn with each line read from r until it ends. Unlike a
+// bufio.Scanner it keeps reading past overlong lines, which would otherwise
+// leave the command blocked on a full pipe.
+func readLines(r io.Reader, fn func(line string)) {
+	reader := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if len(line) < maxLineBytes {
+			line = append(line, chunk[:min(len(chunk), maxLineBytes-len(line))]...)
+		}
+		if err != nil {
+			if len(line) > 0 {
+				fn(string(line))
+			}
+			return
+		}
+		if !isPrefix {
+			fn(string(line))
+			line = line[:0]
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/**
+ * Paths - XDG base directory helpers
+ */
+
+package utility
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const appDirName = "daemira"
+
+// xdgDir resolves an XDG base directory, falling back to a path under $HOME
+func xdgDir(envVar string, homeFallback ...string) string {
+	if dir := os.Getenv(envVar); dir != "" {
+		return filepath.Join(dir, appDirName)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), appDirName)
+	}
+
+	parts := append([]string{homeDir}, homeFallback...)
+	return filepath.Join(append(parts, appDirName)...)
+}
+
+// ConfigDir returns the user configuration directory ($XDG_CONFIG_HOME/daemira)
+func ConfigDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// StateDir returns the persistent state directory ($XDG_STATE_HOME/daemira)
+func StateDir() string {
+	return xdgDir("XDG_STATE_HOME", ".local", "state")
+}
+
+// LogDir returns the directory holding daemira's log files ($XDG_STATE_HOME/daemira/log)
+func LogDir() string {
+	return filepath.Join(StateDir(), "log")
+}
+
+// DataDir returns the user data directory ($XDG_DATA_HOME/daemira)
+func DataDir() string {
+	return xdgDir("XDG_DATA_HOME", ".local", "share")
+}
+
+// CacheDir returns the cache directory ($XDG_CACHE_HOME/daemira)
+func CacheDir() string {
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// RuntimeDir returns the runtime directory for sockets and PID files ($XDG_RUNTIME_DIR/daemira)
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, appDirName)
+	}
+	return filepath.Join(os.TempDir(), appDirName+"-"+strconv.Itoa(os.Getuid()))
+}
+
+// EnsureDir creates a directory (and parents) if it doesn't exist and returns it
+func EnsureDir(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,230 @@
+/**
+ * Privilege - Access to root through the root helper or sudo
+ * Commands the root helper runs go to it when it is installed (see
+ * RootHelper.go); the rest go through sudo. Checks once whether sudo works
+ * without a password, keeps its timestamp fresh during long operations, and
+ * turns sudo's password complaints into ErrNeedsPassword, so features don't
+ * parse sudo's output themselves.
+ */
+
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrNeedsPassword is returned for a command sudo won't run without a password
+var ErrNeedsPassword = errors.New("sudo password required")
+
+// privilegeCheckTTL is how long the result of a sudo check is trusted
+const privilegeCheckTTL = 5 * time.Minute
+
+// sudoKeepAliveInterval is how often KeepAlive refreshes the sudo timestamp,
+// well within sudo's default timeout of 5 minutes
+const sudoKeepAliveInterval = 4 * time.Minute
+
+// sudoCheckCommands only test or refresh sudo access, so they are not audited
+var sudoCheckCommands = map[string]bool{
+	"sudo -n true": true,
+	"sudo -n -v":   true,
+}
+
+// sudoPasswordPattern matches what sudo prints when it needs a password it can't ask for
+var sudoPasswordPattern = regexp.MustCompile(`(?im)^(sudo: (a password is required|a terminal is required to read the password)|\[sudo\] password for )`)
+
+// PrivilegeManager runs commands as root through sudo
+type PrivilegeManager struct {
+	shell     CommandRunner
+	logger    *Logger
+	checked   time.Time
+	available bool
+	mu        sync.Mutex
+}
+
+var (
+	privilegeInstance *PrivilegeManager
+	privilegeOnce     sync.Once
+)
+
+// GetPrivilegeManager returns the singleton PrivilegeManager instance
+func GetPrivilegeManager() *PrivilegeManager {
+	privilegeOnce.Do(func() {
+		privilegeInstance = NewPrivilegeManager(NewShell(GetLogger()))
+	})
+	return privilegeInstance
+}
+
+// NewPrivilegeManager creates a PrivilegeManager checking sudo with runner;
+// most code shares the one GetPrivilegeManager returns
+func NewPrivilegeManager(runner CommandRunner) *PrivilegeManager {
+	return &PrivilegeManager{
+		shell:  runner,
+		logger: GetLogger().With("sudo"),
+	}
+}
+
+// IsRoot reports whether daemira runs as root, needing no sudo
+func (p *PrivilegeManager) IsRoot() bool {
+	return os.Geteuid() == 0
+}
+
+// Validate checks that commands can run as root: it returns nil as root or
+// when sudo works without a password, and ErrNeedsPassword otherwise. The
+// result is cached for a few minutes.
+func (p *PrivilegeManager) Validate(ctx context.Context) error {
+	if p.IsRoot() {
+		return nil
+	}
+
+	p.mu.Lock()
+	fresh := !p.checked.IsZero() && time.Since(p.checked) <= privilegeCheckTTL
+	available := p.available
+	p.mu.Unlock()
+
+	if !fresh {
+		// The lock isn't held here: a refused check invalidates the cache itself
+		result, err := p.shell.ExecuteArgs(ctx, "sudo", []string{"-n", "true"}, &ExecOptions{
+			Timeout: 5 * time.Second,
+		})
+		if err != nil && !errors.Is(err, ErrNeedsPassword) {
+			return fmt.Errorf("failed to check sudo access: %w", err)
+		}
+		available = err == nil && result.ExitCode == 0
+
+		p.mu.Lock()
+		p.available = available
+		p.checked = time.Now()
+		p.mu.Unlock()
+	}
+
+	if !available {
+		return ErrNeedsPassword
+	}
+	return nil
+}
+
+// Authenticate asks for the sudo password on the terminal if needed, so
+// later commands run without prompting
+func (p *PrivilegeManager) Authenticate(ctx context.Context) error {
+	if p.IsRoot() {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "sudo", "-v")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.available = true
+	p.checked = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// invalidate forgets the last check, after sudo asked for a password
+func (p *PrivilegeManager) invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checked = time.Time{}
+}
+
+// Command prefixes a command with what runs it as root: nothing as root,
+// the root helper for the commands it runs when installed, or sudo -n
+func (p *PrivilegeManager) Command(argv ...string) []string {
+	if p.IsRoot() {
+		return argv
+	}
+	if helper := p.HelperCommand(argv...); helper != nil {
+		return helper
+	}
+	return append([]string{"sudo", "-n"}, argv...)
+}
+
+// HelperCommand returns argv run through the root helper, or nil when it
+// doesn't go there: as root, when the helper doesn't run it or isn't installed
+func (p *PrivilegeManager) HelperCommand(argv ...string) []string {
+	if p.IsRoot() || !RootHelperAllows(argv) || !RootHelperInstalled() {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	return append([]string{self, "helper", "exec", "--"}, argv...)
+}
+
+// AuditRan records a command run as root by Command in the audit log.
+// Commands prefixed with sudo or the root helper are audited by the shell;
+// as root nothing marks them, so this does.
+func (p *PrivilegeManager) AuditRan(command string, exitCode int) {
+	if p.IsRoot() {
+		Audit(AuditPrivileged, command, fmt.Sprintf("exit code %d", exitCode))
+	}
+}
+
+// Route describes how commands reach root, for the log and doctor
+func (p *PrivilegeManager) Route() string {
+	switch {
+	case p.IsRoot():
+		return "running as root"
+	case RootHelperInstalled():
+		return "system updates, TRIM, DKMS and blocks go through the root helper, other root commands through sudo"
+	default:
+		return "root commands go through sudo"
+	}
+}
+
+// CanRun checks that argv can run as root the way Command runs it: through
+// the root helper if it runs argv and is installed, otherwise like Validate
+func (p *PrivilegeManager) CanRun(ctx context.Context, argv ...string) error {
+	if !p.IsRoot() && RootHelperAllows(argv) && RootHelperInstalled() {
+		return PingRootHelper(ctx)
+	}
+	return p.Validate(ctx)
+}
+
+// KeepAlive refreshes the sudo timestamp until ctx is done or the returned
+// function is called, so credentials cached at the start of a long
+// operation don't expire halfway through it
+func (p *PrivilegeManager) KeepAlive(ctx context.Context) func() {
+	if p.IsRoot() {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(sudoKeepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := p.shell.ExecuteArgs(ctx, "sudo", []string{"-n", "-v"}, &ExecOptions{
+					Timeout: 5 * time.Second,
+				}); err != nil && ctx.Err() == nil {
+					p.logger.Debug("Failed to refresh sudo timestamp: %v", err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// needsPassword reports whether a failed command was refused by sudo for
+// lack of a password
+func needsPassword(command string, result *Result) bool {
+	if result.ExitCode == 0 || !sudoPattern.MatchString(command+" ") {
+		return false
+	}
+	return sudoPasswordPattern.MatchString(result.Stderr) || sudoPasswordPattern.MatchString(result.Stdout)
+}
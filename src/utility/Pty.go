@@ -0,0 +1,120 @@
+/**
+ * Pty - Pseudo-terminals for interactive tools
+ * Tools like yay, makepkg and fwupdmgr drop colors and progress or change
+ * their prompts when not on a terminal. ExecOptions.PTY runs a command on a
+ * pseudo-terminal, streams what it writes line by line and types the answers
+ * to prompts it recognizes.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// Size of the pseudo-terminal commands run on
+const (
+	ptyColumns = 120
+	ptyRows    = 40
+)
+
+// ptyEscapePattern matches terminal control sequences, ignored when matching prompts
+var ptyEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// PromptAnswer answers a prompt: when the line the command is writing
+// matches Pattern, Answer is typed as it is ("\n" presses enter, "\x03" Ctrl+C)
+type PromptAnswer struct {
+	Pattern *regexp.Regexp
+	Answer  string
+}
+
+// startPTY starts cmd as the session leader of a new pseudo-terminal, its
+// output read into output and file; the returned function waits until every
+// process on it has closed it
+func startPTY(cmd *exec.Cmd, opts *ExecOptions, output *outputBuffer, file *outputFile) (func(), error) {
+	// pty gives the command the terminal as stdin, stdout and stderr
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	// A new session also makes the command the leader of its own process group
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if os.Getenv("TERM") == "" {
+		// Without TERM (e.g. under systemd) tools assume a dumb terminal
+		cmd.Env = append(cmd.Environ(), "TERM=xterm-256color")
+	}
+
+	// The command gets its own copy of the terminal, closed here once started,
+	// so reads end once it and its children exit
+	master, err := pty.StartWithAttrs(cmd, &pty.Winsize{Rows: ptyRows, Cols: ptyColumns}, cmd.SysProcAttr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command on a pseudo-terminal: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		readPTY(master, opts, output, file)
+		close(done)
+	}()
+
+	return func() {
+		<-done
+		master.Close()
+	}, nil
+}
+
+// readPTY passes each line written to the pseudo-terminal to the stdout
+// callback and answers the first prompt the unfinished line matches
+func readPTY(master *os.File, opts *ExecOptions, output *outputBuffer, file *outputFile) {
+	emit := func(line string) {
+		output.WriteLine(line)
+		file.WriteLine(line)
+		if opts.StdoutCallback != nil {
+			opts.StdoutCallback(line)
+		}
+	}
+
+	var line []byte
+	answered := false
+	buf := make([]byte, 4096)
+	for {
+		// Reading fails with EIO once nothing has the terminal open
+		n, err := master.Read(buf)
+		for _, b := range buf[:n] {
+			if b != '\n' {
+				line = append(line, b)
+				continue
+			}
+			emit(strings.TrimSuffix(string(line), "\r"))
+			line = line[:0]
+			answered = false
+		}
+
+		if !answered && len(line) > 0 {
+			// Only what follows the last carriage return is still on screen
+			visible := string(line)
+			if idx := strings.LastIndex(visible, "\r"); idx >= 0 {
+				visible = visible[idx+1:]
+			}
+			visible = ptyEscapePattern.ReplaceAllString(visible, "")
+			for _, prompt := range opts.Prompts {
+				if prompt.Pattern.MatchString(visible) {
+					master.WriteString(prompt.Answer)
+					answered = true
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+	if len(line) > 0 {
+		emit(strings.TrimSuffix(string(line), "\r"))
+	}
+}
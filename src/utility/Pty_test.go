@@ -0,0 +1,67 @@
+package utility
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runOnPTY runs a shell script on a pseudo-terminal and returns its output,
+// failing the test if it doesn't finish in time
+func runOnPTY(t *testing.T, script string, prompts ...PromptAnswer) string {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := NewShell(GetLogger()).ExecuteArgs(ctx, "sh", []string{"-c", script}, &ExecOptions{
+		PTY:     true,
+		Timeout: 5 * time.Second,
+		Prompts: prompts,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteArgs() = %v", err)
+	}
+	if result.TimedOut || result.ExitCode != 0 {
+		t.Fatalf("exit code %d (timed out: %v), output:\n%s", result.ExitCode, result.TimedOut, result.Stdout)
+	}
+	return result.Stdout
+}
+
+func TestPTYTerminal(t *testing.T) {
+	// The command's stdio is its controlling terminal, at the size set
+	out := runOnPTY(t, `test -t 0 && test -t 1 && test -t 2 && stty size && ps -o tty= -p $$ | grep -q pts && echo controlling`)
+	if want := "40 120\ncontrolling"; out != want {
+		t.Errorf("output %q, want %q", out, want)
+	}
+}
+
+func TestPTYResizeSignalsForeground(t *testing.T) {
+	// Resizing the terminal sends SIGWINCH to the foreground process group,
+	// which is the command's own
+	out := runOnPTY(t, `trap 'echo winch' WINCH; stty rows 50 cols 100; sleep 0.1; stty size`)
+	if want := "winch\n50 100"; out != want {
+		t.Errorf("output %q, want %q", out, want)
+	}
+}
+
+func TestPTYReadsUntilEveryProcessClosesIt(t *testing.T) {
+	// Reads end with EIO once the last process holding the terminal exits,
+	// not when the command itself does: a child ignoring the hangup its exit
+	// sends is still read. The child inherits the ignored signal, so it can't
+	// get the hangup before setting that up. The unfinished last line is kept.
+	out := runOnPTY(t, `trap '' HUP; (sleep 0.3; printf 'late, no newline') & echo early`)
+	if want := "early\nlate, no newline"; out != want {
+		t.Errorf("output %q, want %q", out, want)
+	}
+}
+
+func TestPTYAnswersPrompts(t *testing.T) {
+	out := runOnPTY(t, `printf 'Proceed with installation? [Y/n] '; read answer; echo "got $answer"`,
+		PromptAnswer{Pattern: regexp.MustCompile(`\[Y/n\] $`), Answer: "y\n"})
+	if !strings.HasSuffix(out, "got y") {
+		t.Errorf("output %q, want the prompt answered with y", out)
+	}
+}
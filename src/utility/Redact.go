@@ -0,0 +1,78 @@
+/**
+ * Redact - Masks configured secrets in output
+ * Tokens and API keys are registered when the config is loaded or a secret
+ * reference is resolved, and replaced wherever they show up in logs, error
+ * messages or status output, so logs can be shared safely.
+ */
+
+package utility
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedMask replaces secrets in output
+const RedactedMask = "********"
+
+// minSecretLength keeps short values such as "1" from masking ordinary text
+const minSecretLength = 6
+
+var (
+	secrets   []string // longest first, so a secret containing another is masked whole
+	secretsMu sync.RWMutex
+)
+
+// RegisterSecret masks value in all further log lines and redacted output
+func RegisterSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	for _, secret := range secrets {
+		if secret == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// Redact replaces registered secrets in s
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, RedactedMask)
+		}
+	}
+	return s
+}
+
+// redactWriter redacts each write before passing it on
+type redactWriter struct {
+	w io.Writer
+}
+
+// RedactWriter returns a writer that masks registered secrets; a secret split
+// across two writes is not caught, so write whole lines
+func RedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,269 @@
+/**
+ * ResourceUsage - The daemon's own CPU, memory, goroutines and descriptors
+ * Once a minute the daemon samples what it uses itself and records it with
+ * its metrics, so `daemira diagnostics` shows it next to the peaks. Past a
+ * configured limit it logs a warning and raises an alert, and can write a
+ * heap profile to the state directory, to catch leaks in loops that run
+ * for weeks.
+ */
+
+package utility
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// resourceCheckJob is the scheduler job sampling the daemon's usage
+const resourceCheckJob = "resource-check"
+
+// resourceCheckInterval is the time between samples
+const resourceCheckInterval = time.Minute
+
+// resourceAlert is the alert raised while a limit is exceeded
+const resourceAlert = "daemon-resources"
+
+// heapProfilesKept is how many heap profiles are kept in the state directory
+const heapProfilesKept = 5
+
+// ResourceUsage is a sample of what the process uses
+type ResourceUsage struct {
+	Sampled    time.Time     `json:"sampled"`
+	CPUTime    time.Duration `json:"cpuTime"`    // user and system, since the process started
+	CPUPercent float64       `json:"cpuPercent"` // of one core, since the previous sample
+	RSS        int64         `json:"rss"`        // resident memory in bytes
+	Goroutines int           `json:"goroutines"`
+	FDs        int           `json:"fds"` // open file descriptors
+}
+
+// ResourceLimits are the usage past which the daemon warns; 0 disables a limit
+type ResourceLimits struct {
+	MaxCPUPercent float64
+	MaxRSS        int64
+	MaxGoroutines int
+	MaxFDs        int
+	HeapProfile   bool // write a heap profile when a limit is first exceeded
+}
+
+// Exceeded describes the limits a sample is over
+func (l ResourceLimits) Exceeded(usage ResourceUsage) []string {
+	var exceeded []string
+	if l.MaxCPUPercent > 0 && usage.CPUPercent > l.MaxCPUPercent {
+		exceeded = append(exceeded, fmt.Sprintf("CPU %.0f%% (limit %.0f%%)", usage.CPUPercent, l.MaxCPUPercent))
+	}
+	if l.MaxRSS > 0 && usage.RSS > l.MaxRSS {
+		exceeded = append(exceeded, fmt.Sprintf("memory %s (limit %s)", FormatBytes(usage.RSS), FormatBytes(l.MaxRSS)))
+	}
+	if l.MaxGoroutines > 0 && usage.Goroutines > l.MaxGoroutines {
+		exceeded = append(exceeded, fmt.Sprintf("%d goroutines (limit %d)", usage.Goroutines, l.MaxGoroutines))
+	}
+	if l.MaxFDs > 0 && usage.FDs > l.MaxFDs {
+		exceeded = append(exceeded, fmt.Sprintf("%d open files (limit %d)", usage.FDs, l.MaxFDs))
+	}
+	return exceeded
+}
+
+// SampleResourceUsage measures what this process uses now; CPUPercent is
+// left to the caller, who knows the previous sample
+func SampleResourceUsage() ResourceUsage {
+	usage := ResourceUsage{
+		Sampled:    time.Now(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err == nil {
+		usage.CPUTime = time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano())
+	}
+	usage.RSS = residentMemory()
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		usage.FDs = len(entries)
+	}
+	return usage
+}
+
+// residentMemory reads VmRSS from /proc/self/status, in bytes
+func residentMemory() int64 {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// FormatBytes formats a byte count with a binary unit, e.g. "12.5 MiB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// HeapProfilesDir returns where heap profiles are written
+func HeapProfilesDir() string {
+	return filepath.Join(StateDir(), "profiles")
+}
+
+// HeapProfiles lists the heap profiles written, newest first
+func HeapProfiles() []string {
+	paths, _ := filepath.Glob(filepath.Join(HeapProfilesDir(), "heap-*.pprof"))
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	return paths
+}
+
+// ResourceMonitor checks the daemon's usage against its limits
+type ResourceMonitor struct {
+	logger    *Logger
+	limits    ResourceLimits
+	last      ResourceUsage
+	exceeded  bool
+	isRunning bool
+	mu        sync.Mutex
+}
+
+var (
+	resourceMonitorInstance *ResourceMonitor
+	resourceMonitorOnce     sync.Once
+)
+
+// GetResourceMonitor returns the monitor of this process
+func GetResourceMonitor() *ResourceMonitor {
+	resourceMonitorOnce.Do(func() {
+		resourceMonitorInstance = &ResourceMonitor{logger: GetLogger().With("resources")}
+	})
+	return resourceMonitorInstance
+}
+
+// SetLimits changes the usage past which the daemon warns
+func (r *ResourceMonitor) SetLimits(limits ResourceLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = limits
+}
+
+// Start samples the usage now and then every minute
+func (r *ResourceMonitor) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isRunning {
+		return
+	}
+	r.isRunning = true
+
+	GetScheduler().Add(Job{
+		ID:          resourceCheckJob,
+		Description: "Check daemira's own CPU, memory, goroutines and open files",
+		Schedule:    Every(resourceCheckInterval),
+		RunAtStart:  true,
+		Run:         r.Check,
+	})
+}
+
+// Stop halts the samples
+func (r *ResourceMonitor) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isRunning {
+		return
+	}
+	r.isRunning = false
+	GetScheduler().Remove(resourceCheckJob)
+}
+
+// Check samples the usage, records it with the metrics and warns about
+// limits exceeded
+func (r *ResourceMonitor) Check(ctx context.Context) error {
+	usage := SampleResourceUsage()
+
+	r.mu.Lock()
+	// The first sample has no CPU use; starting up is busy and says nothing
+	if elapsed := usage.Sampled.Sub(r.last.Sampled); !r.last.Sampled.IsZero() && elapsed > 0 {
+		usage.CPUPercent = float64(usage.CPUTime-r.last.CPUTime) / float64(elapsed) * 100
+	}
+	r.last = usage
+	limits := r.limits
+	exceeded := limits.Exceeded(usage)
+	first := len(exceeded) > 0 && !r.exceeded
+	r.exceeded = len(exceeded) > 0
+	r.mu.Unlock()
+
+	GetMetrics().RecordUsage(usage)
+
+	if len(exceeded) == 0 {
+		GetAlerts().Resolve(resourceAlert)
+		return nil
+	}
+
+	detail := strings.Join(exceeded, ", ")
+	if first {
+		r.logger.Warn("daemira is using more than it should: %s", detail)
+		if limits.HeapProfile {
+			if path, err := writeHeapProfile(); err != nil {
+				r.logger.Warn("Failed to write heap profile: %v", err)
+			} else {
+				r.logger.Info("Heap profile written to %s", path)
+				detail += "; heap profile: " + path
+			}
+		}
+	}
+	GetAlerts().Raise(resourceAlert, AlertWarning, "daemira is using more than its limits", detail)
+	return nil
+}
+
+// writeHeapProfile writes a heap profile to the state directory, removing
+// the oldest beyond the ones kept
+func writeHeapProfile() (string, error) {
+	dir, err := EnsureDir(HeapProfilesDir())
+	if err != nil {
+		return "", fmt.Errorf("failed to create profiles directory: %w", err)
+	}
+	path := filepath.Join(dir, "heap-"+time.Now().Format("20060102-150405")+".pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create heap profile: %w", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write heap profile: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write heap profile: %w", err)
+	}
+
+	if profiles := HeapProfiles(); len(profiles) > heapProfilesKept {
+		for _, old := range profiles[heapProfilesKept:] {
+			os.Remove(old)
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,126 @@
+/**
+ * Retry - Running commands again after transient failures
+ * A command that fails because the network was briefly down, a name didn't
+ * resolve, a server answered with a 5xx or a lock was held is likely to
+ * succeed a little later. ExecuteWithRetry runs such commands again with
+ * exponential backoff and jitter; any other failure is returned at once.
+ */
+
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"time"
+)
+
+// FailureClass names a kind of transient failure
+type FailureClass string
+
+const (
+	FailureNetwork FailureClass = "network"
+	FailureDNS     FailureClass = "dns"
+	FailureServer  FailureClass = "server"
+	FailureLock    FailureClass = "lock"
+)
+
+// transientFailures matches the output of commands that failed transiently;
+// DNS comes before network, as resolvers' messages mention both
+var transientFailures = []struct {
+	class   FailureClass
+	pattern *regexp.Regexp
+}{
+	{FailureDNS, regexp.MustCompile(`(?i)no such host|temporary failure in name resolution|could not resolve host|name or service not known`)},
+	{FailureNetwork, regexp.MustCompile(`(?i)network is unreachable|connection (refused|reset by peer|timed out)|i/o timeout|tls handshake timeout|failed to connect|unexpected eof`)},
+	{FailureServer, regexp.MustCompile(`(?i)\b(error|status|http)\b[^\n]{0,20}\b5\d\d\b|internal server error|bad gateway|service unavailable|gateway timeout|rate ?limit`)},
+	{FailureLock, regexp.MustCompile(`(?i)unable to lock database|database is locked`)},
+}
+
+// RetryPolicy says how often and how long apart a command is retried
+type RetryPolicy struct {
+	Attempts int           // runs in total, the first included
+	Delay    time.Duration // wait before the first retry, doubled after each
+	MaxDelay time.Duration // longest wait between runs
+}
+
+// DefaultRetryPolicy runs a command up to three times, waiting about 2s and 4s in between
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Delay:    2 * time.Second,
+	MaxDelay: 30 * time.Second,
+}
+
+// ClassifyFailure returns the class of a transient failure, or "" if the
+// command succeeded or failed in a way retrying won't fix
+func ClassifyFailure(result *Result, err error) FailureClass {
+	if result == nil || result.TimedOut || errors.Is(err, ErrNeedsPassword) || errors.Is(err, context.Canceled) {
+		return ""
+	}
+	if err == nil && result.ExitCode == 0 {
+		return ""
+	}
+	output := result.Stderr + "\n" + result.Stdout
+	for _, failure := range transientFailures {
+		if failure.pattern.MatchString(output) {
+			return failure.class
+		}
+	}
+	return ""
+}
+
+// backoff returns the wait before retry number attempt (from 1): the
+// policy's delay doubled for each earlier retry, capped, and randomized
+// between half and all of it so clients don't retry in lockstep
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// ExecuteWithRetry runs a program like ExecuteArgs, running it again while
+// it fails transiently, up to the policy's attempts. The result is that of
+// the last run.
+func (s *Shell) ExecuteWithRetry(ctx context.Context, name string, args []string, opts *ExecOptions, policy RetryPolicy) (*Result, error) {
+	logger := s.logger
+	if logger == nil {
+		logger = GetLogger().With("shell")
+	}
+	return retryCommand(ctx, logger, policy, func() (*Result, error) {
+		return s.ExecuteArgs(ctx, name, args, opts)
+	})
+}
+
+// retryCommand calls run until it succeeds, fails for good or has been
+// called policy.Attempts times, backing off in between
+func retryCommand(ctx context.Context, logger *Logger, policy RetryPolicy, run func() (*Result, error)) (*Result, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := run()
+		class := ClassifyFailure(result, err)
+		if class == "" {
+			return result, err
+		}
+		if attempt >= policy.Attempts {
+			logger.Warn("%s failed (%s error), giving up after %d attempts", result.Command, class, attempt)
+			return result, err
+		}
+
+		delay := policy.backoff(attempt)
+		logger.Warn("%s failed (%s error), retrying in %.1fs (attempt %d/%d)", result.Command, class, delay.Seconds(), attempt+1, policy.Attempts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, fmt.Errorf("command cancelled: %w", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,468 @@
+/**
+ * RootHelper - Root operations for the user daemon
+ * The daemon runs as the user, where rclone and the desktop find their
+ * config; the few operations that need root (system updates, TRIM and DKMS)
+ * go to an optional helper service running as root, instead of sudo, when it
+ * is installed. The helper listens on a socket, only serves the users it was
+ * started for (checked by the socket's peer credentials) and only runs the
+ * commands in rootHelperCommands. PrivilegeManager.Command routes those
+ * through `daemira helper exec -- <command>`, whose output and exit code
+ * are the command's, so callers run them like any other.
+ */
+
+package utility
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RootHelperSocket is where the root helper listens
+const RootHelperSocket = "/run/daemira/helper.sock"
+
+// RootHelperUnit is the system service running the root helper
+const RootHelperUnit = "daemira-helper.service"
+
+// rootHelperCommands are the commands the helper runs: the system update's
+// root steps, TRIM, DKMS and the failed login blocklist. A final "*" stands
+// for any number of key fingerprints, a placeholder such as "<ipv4>" for one
+// argument rootHelperPlaceholders checks; rootHelperVerbs are its own.
+var rootHelperCommands = [][]string{
+	{"pacman-mirrors", "--fasttrack"},
+	{"pacman", "-Sy", "--needed", "--noconfirm", "archlinux-keyring", "cachyos-keyring"},
+	{"pacman", "-Syy", "--noconfirm"},
+	{"pacman", "-Syu", "--noconfirm"},
+	{RootHelperRemoveOrphans},
+	{"pacman-key", "--refresh-keys", "*"},
+	{"pacman-key", "--init"},
+	{"pacman-key", "--populate"},
+	{"pacman-key", "--updatedb"},
+	{"paccache", "-rk2"},
+	{"paccache", "-ruk0"},
+	{"pacman-optimize"},
+	{"fwupdmgr", "refresh", "--force"},
+	{"fwupdmgr", "update", "-y"},
+	{"grub-mkconfig", "-o", "/boot/grub/grub.cfg"},
+	{"systemctl", "daemon-reload"},
+	{"fstrim", "-v", "/"},
+	{"dkms", "autoinstall"},
+	{"nft", "list", "set", "inet", "daemira", "blocked4"},
+	{"nft", "--json", "list", "set", "inet", "daemira", "blocked4"},
+	{"nft", "--json", "list", "set", "inet", "daemira", "blocked6"},
+	{"nft", "add", "table", "inet", "daemira"},
+	{"nft", "add", "set", "inet", "daemira", "blocked4", "{", "type", "ipv4_addr", ";", "flags", "timeout", ";", "}"},
+	{"nft", "add", "set", "inet", "daemira", "blocked6", "{", "type", "ipv6_addr", ";", "flags", "timeout", ";", "}"},
+	{"nft", "add", "chain", "inet", "daemira", "input", "{", "type", "filter", "hook", "input", "priority", "filter", "-", "10", ";", "policy", "accept", ";", "}"},
+	{"nft", "add", "rule", "inet", "daemira", "input", "ip", "saddr", "@blocked4", "drop"},
+	{"nft", "add", "rule", "inet", "daemira", "input", "ip6", "saddr", "@blocked6", "drop"},
+	{"nft", "add", "element", "inet", "daemira", "blocked4", "{", "<ipv4>", "timeout", "<timeout>", "}"},
+	{"nft", "add", "element", "inet", "daemira", "blocked6", "{", "<ipv6>", "timeout", "<timeout>", "}"},
+	{"nft", "delete", "element", "inet", "daemira", "blocked4", "{", "<ipv4>", "}"},
+	{"nft", "delete", "element", "inet", "daemira", "blocked6", "{", "<ipv6>", "}"},
+}
+
+// RootHelperRemoveOrphans is the helper's own command removing the packages
+// pacman lists as orphaned. The helper lists them itself, so no caller gets
+// to name packages to remove.
+const RootHelperRemoveOrphans = "remove-orphans"
+
+// rootHelperVerbs work out the command one of the helper's own commands
+// runs, nil for nothing to run
+var rootHelperVerbs = map[string]func(ctx context.Context, runner CommandRunner) ([]string, error){
+	RootHelperRemoveOrphans: OrphanRemoval,
+}
+
+// rootHelperPlaceholders check the arguments standing for a placeholder:
+// addresses written as Go writes them, so no prefix or mapped form gets
+// through, and a timeout in seconds
+var rootHelperPlaceholders = map[string]func(arg string) bool{
+	"<ipv4>": func(arg string) bool {
+		ip := net.ParseIP(arg)
+		return ip != nil && ip.To4() != nil && ip.To4().String() == arg
+	},
+	"<ipv6>": func(arg string) bool {
+		ip := net.ParseIP(arg)
+		return ip != nil && ip.To4() == nil && ip.String() == arg
+	},
+	"<timeout>": regexp.MustCompile(`^[1-9][0-9]{0,8}s$`).MatchString,
+}
+
+// rootHelperArgPattern matches the package names and fingerprints a "*"
+// stands for; nothing starting with "-" gets through as an option
+var rootHelperArgPattern = regexp.MustCompile(`^[A-Za-z0-9@_+][A-Za-z0-9@._+:-]*$`)
+
+// rootHelperRequestTimeout is how long a client has to send its request
+const rootHelperRequestTimeout = 10 * time.Second
+
+// RootHelperCommands returns the commands the root helper runs, as shown to users
+func RootHelperCommands() []string {
+	commands := make([]string, 0, len(rootHelperCommands))
+	for _, command := range rootHelperCommands {
+		line := strings.Join(command, " ")
+		commands = append(commands, strings.Replace(line, " *", " ...", 1))
+	}
+	return commands
+}
+
+// RootHelperAllows reports whether the root helper runs argv
+func RootHelperAllows(argv []string) bool {
+	for _, command := range rootHelperCommands {
+		if helperCommandMatches(command, argv) {
+			return true
+		}
+	}
+	return false
+}
+
+// helperCommandMatches matches argv against an allowed command
+func helperCommandMatches(command, argv []string) bool {
+	fixed := command
+	wildcard := len(command) > 0 && command[len(command)-1] == "*"
+	if wildcard {
+		fixed = command[:len(command)-1]
+	}
+	if len(argv) < len(fixed) || (!wildcard && len(argv) != len(fixed)) {
+		return false
+	}
+	for i, arg := range fixed {
+		if check, ok := rootHelperPlaceholders[arg]; ok {
+			if !check(argv[i]) {
+				return false
+			}
+		} else if argv[i] != arg {
+			return false
+		}
+	}
+	rest := argv[len(fixed):]
+	if wildcard && len(rest) == 0 {
+		return false
+	}
+	for _, arg := range rest {
+		if !rootHelperArgPattern.MatchString(arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrphanRemoval returns the command removing the packages installed as
+// dependencies that nothing needs anymore, nil when there are none
+func OrphanRemoval(ctx context.Context, runner CommandRunner) ([]string, error) {
+	result, err := runner.ExecuteArgs(ctx, "pacman", []string{"-Qdtq"}, &ExecOptions{
+		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphaned packages: %w", err)
+	}
+	// pacman exits with 1, silently, when no package matches
+	orphans := strings.Fields(result.Stdout)
+	if result.ExitCode != 0 && (result.ExitCode != 1 || len(orphans) > 0 || strings.TrimSpace(result.Stderr) != "") {
+		return nil, fmt.Errorf("failed to list orphaned packages: %s", strings.TrimSpace(result.Stderr))
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+	return append([]string{"pacman", "-Rns", "--noconfirm"}, orphans...), nil
+}
+
+// rootHelperRequest asks the helper to run a command; no command only checks
+// that the helper answers
+type rootHelperRequest struct {
+	Argv []string `json:"argv,omitempty"`
+}
+
+// rootHelperMessage is a line of the command's output, or how it ended
+type rootHelperMessage struct {
+	Stdout *string `json:"stdout,omitempty"`
+	Stderr *string `json:"stderr,omitempty"`
+	Exit   *int    `json:"exit,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// RootHelper serves the allowed commands to the allowed users
+type RootHelper struct {
+	logger *Logger
+	users  map[uint32]string // by UID
+	runMu  sync.Mutex        // commands run one at a time
+	active sync.WaitGroup    // connections being served
+}
+
+// NewRootHelper creates a helper serving the named users (root always may)
+func NewRootHelper(names []string) (*RootHelper, error) {
+	h := &RootHelper{
+		logger: GetLogger().With("root-helper"),
+		users:  map[uint32]string{0: "root"},
+	}
+	for _, name := range names {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %s: %w", name, err)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UID of %s: %s", name, u.Uid)
+		}
+		h.users[uint32(uid)] = name
+	}
+	return h, nil
+}
+
+// Serve answers requests on RootHelperSocket until ctx is done, then waits
+// for the commands running
+func (h *RootHelper) Serve(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(RootHelperSocket), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(RootHelperSocket), err)
+	}
+	// A socket left by a helper that didn't stop cleanly
+	os.Remove(RootHelperSocket)
+	listener, err := net.Listen("unix", RootHelperSocket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", RootHelperSocket, err)
+	}
+	defer os.Remove(RootHelperSocket)
+	// Anyone may connect; the peer credentials decide who is served
+	if err := os.Chmod(RootHelperSocket, 0666); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to open up %s: %w", RootHelperSocket, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	h.logger.Info("Root helper listening on %s", RootHelperSocket)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				err = fmt.Errorf("failed to accept connection: %w", err)
+			} else {
+				err = nil
+			}
+			h.active.Wait()
+			return err
+		}
+		h.active.Add(1)
+		Go("root-helper-conn", func() {
+			defer h.active.Done()
+			defer conn.Close()
+			h.handle(conn.(*net.UnixConn))
+		})
+	}
+}
+
+// handle serves one request
+func (h *RootHelper) handle(conn *net.UnixConn) {
+	encoder := json.NewEncoder(conn)
+	var sendMu sync.Mutex
+	send := func(message rootHelperMessage) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		encoder.Encode(message)
+	}
+
+	uid, err := peerUID(conn)
+	if err != nil {
+		h.logger.Warn("Refused a connection: %v", err)
+		send(rootHelperMessage{Error: "can't identify the caller"})
+		return
+	}
+	name, allowed := h.users[uid]
+	if !allowed {
+		h.logger.Warn("Refused UID %d, not a user this helper serves", uid)
+		send(rootHelperMessage{Error: fmt.Sprintf("UID %d may not use the root helper", uid)})
+		return
+	}
+
+	var request rootHelperRequest
+	conn.SetReadDeadline(time.Now().Add(rootHelperRequestTimeout))
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		send(rootHelperMessage{Error: "invalid request"})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	exit := 0
+	if len(request.Argv) == 0 {
+		send(rootHelperMessage{Exit: &exit})
+		return
+	}
+	command := CommandLine(request.Argv...)
+	if !RootHelperAllows(request.Argv) {
+		h.logger.Warn("Refused %s for %s, not a command the helper runs", command, name)
+		send(rootHelperMessage{Error: "the root helper doesn't run " + command})
+		return
+	}
+
+	// The command stops when the client goes away, as it would under sudo,
+	// not when the helper is stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+
+	h.runMu.Lock()
+	defer h.runMu.Unlock()
+	argv := request.Argv
+	if resolve, ok := rootHelperVerbs[command]; ok {
+		if argv, err = resolve(ctx, NewShell(h.logger)); err != nil {
+			send(rootHelperMessage{Error: err.Error()})
+			return
+		}
+		if argv == nil {
+			h.logger.Info("Nothing to run for %s", command)
+			send(rootHelperMessage{Exit: &exit})
+			return
+		}
+	}
+	h.logger.Info("Running %s for %s", CommandLine(argv...), name)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		send(rootHelperMessage{Error: err.Error()})
+		return
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		send(rootHelperMessage{Error: err.Error()})
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		send(rootHelperMessage{Error: fmt.Sprintf("failed to start %s: %v", command, err)})
+		return
+	}
+
+	var wg sync.WaitGroup
+	forward := func(r io.Reader, stream func(line string) rootHelperMessage) {
+		defer wg.Done()
+		// Reads to the end whatever the line lengths, so the command never
+		// blocks on a full pipe
+		readLines(r, func(line string) { send(stream(line)) })
+	}
+	wg.Add(2)
+	go forward(stdout, func(line string) rootHelperMessage { return rootHelperMessage{Stdout: &line} })
+	go forward(stderr, func(line string) rootHelperMessage { return rootHelperMessage{Stderr: &line} })
+	wg.Wait()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		exit = exitErr.ExitCode()
+	default:
+		send(rootHelperMessage{Error: err.Error()})
+		return
+	}
+	h.logger.Info("%s exited with code %d", command, exit)
+	send(rootHelperMessage{Exit: &exit})
+}
+
+// peerUID returns the UID of the process on the other end of conn
+func peerUID(conn *net.UnixConn) (uint32, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return cred.Uid, nil
+}
+
+// RootHelperInstalled reports whether the root helper's socket exists
+func RootHelperInstalled() bool {
+	info, err := os.Stat(RootHelperSocket)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// PingRootHelper checks that the root helper answers and serves this user
+func PingRootHelper(ctx context.Context) error {
+	_, err := RunRootHelper(ctx, nil, io.Discard, io.Discard)
+	return err
+}
+
+// RunRootHelper runs argv through the root helper, copying its output to
+// stdout and stderr line by line, and returns its exit code
+func RunRootHelper(ctx context.Context, argv []string, stdout, stderr io.Writer) (int, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", RootHelperSocket)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach the root helper at %s (is %s running?): %w", RootHelperSocket, RootHelperUnit, err)
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := json.NewEncoder(conn).Encode(rootHelperRequest{Argv: argv}); err != nil {
+		return 0, fmt.Errorf("failed to send the request to the root helper: %w", err)
+	}
+	decoder := json.NewDecoder(conn)
+	for {
+		var message rootHelperMessage
+		if err := decoder.Decode(&message); err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, fmt.Errorf("the root helper hung up: %w", err)
+		}
+		switch {
+		case message.Error != "":
+			return 0, errors.New(message.Error)
+		case message.Stdout != nil:
+			fmt.Fprintln(stdout, *message.Stdout)
+		case message.Stderr != nil:
+			fmt.Fprintln(stderr, *message.Stderr)
+		case message.Exit != nil:
+			return *message.Exit, nil
+		}
+	}
+}
+
+// RootHelperUnitFile renders the system service running the helper from the
+// binary at path for the users
+func RootHelperUnitFile(path string, users []string) string {
+	args := ""
+	for _, name := range users {
+		args += " --user " + name
+	}
+	return fmt.Sprintf(`[Unit]
+Description=Daemira root helper (system updates, TRIM and DKMS)
+
+[Service]
+ExecStart=%s helper serve%s
+RuntimeDirectory=daemira
+Restart=on-failure
+RestartSec=10
+# An update in progress is left to finish
+KillMode=mixed
+TimeoutStopSec=30min
+
+[Install]
+WantedBy=multi-user.target
+`, path, args)
+}
@@ -0,0 +1,39 @@
+package utility
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRootHelperAllows(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"pacman -Syu --noconfirm", true},
+		{"pacman -Syu --noconfirm --overwrite *", false},
+		{"remove-orphans", true},
+		{"remove-orphans glibc", false},
+		{"pacman -Rns --noconfirm glibc", false},
+		{"pacman-key --refresh-keys 0123ABCD", true},
+		{"pacman-key --refresh-keys --keyserver evil", false},
+		{"nft add element inet daemira blocked4 { 203.0.113.7 timeout 86400s }", true},
+		{"nft add element inet daemira blocked6 { 2001:db8::7 timeout 60s }", true},
+		{"nft delete element inet daemira blocked4 { 203.0.113.7 }", true},
+		// Addresses only in the form their own set takes
+		{"nft add element inet daemira blocked4 { 2001:db8::7 timeout 60s }", false},
+		{"nft add element inet daemira blocked6 { ::ffff:203.0.113.7 timeout 60s }", false},
+		{"nft add element inet daemira blocked4 { 0.0.0.0/0 timeout 60s }", false},
+		{"nft add element inet daemira blocked6 { 2001:DB8::7 timeout 60s }", false},
+		{"nft add element inet daemira blocked4 { 203.0.113.7 timeout 0s }", false},
+		{"nft add element inet daemira blocked4 { 203.0.113.7 timeout 1d }", false},
+		{"nft add element inet daemira blocked4 { 203.0.113.7 timeout 60s } ; flush ruleset", false},
+		{"nft add element inet filter blocked4 { 203.0.113.7 timeout 60s }", false},
+		{"nft flush ruleset", false},
+	}
+	for _, tt := range tests {
+		if got := RootHelperAllows(strings.Fields(tt.command)); got != tt.want {
+			t.Errorf("RootHelperAllows(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/**
+ * RunLog - Full output of a single run
+ * Sync runs and update steps write every line of their commands' output to
+ * a file of their own under the runs/ log directory, so the main log keeps
+ * only what matters and the details are one path away.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRunLogs is how many run logs are kept; older ones are removed
+const maxRunLogs = 200
+
+// RunsDir returns the directory holding run logs ($XDG_STATE_HOME/daemira/log/runs)
+func RunsDir() string {
+	return filepath.Join(LogDir(), "runs")
+}
+
+// RunLog is the output file of one run. A nil RunLog discards writes, so a
+// run goes ahead when its log cannot be created.
+type RunLog struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewRunLog creates the log of a run of component, named after what it runs
+// (a directory, a step)
+func NewRunLog(component, name string) (*RunLog, error) {
+	dir := RunsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run log directory: %w", err)
+	}
+	pruneRunLogs(dir)
+
+	base := fmt.Sprintf("%s-%s-%s", time.Now().Format("2006-01-02_15-04-05.000"), component, runLogSlug(name))
+	path := filepath.Join(dir, base+".log")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	for idx := 2; os.IsExist(err) && idx < 10; idx++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d.log", base, idx))
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run log: %w", err)
+	}
+	return &RunLog{path: path, file: file}, nil
+}
+
+// Path returns the file of the run log, or "" if there is none
+func (r *RunLog) Path() string {
+	if r == nil {
+		return ""
+	}
+	return r.path
+}
+
+// Println writes a line of output, stamped with the time
+func (r *RunLog) Println(line string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.file, "[%s] %s\n", time.Now().Format("15:04:05"), Redact(line))
+}
+
+// Close closes the run log
+func (r *RunLog) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// runLogSlug turns a path or step name into part of a file name
+func runLogSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, name)
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	slug = strings.Trim(slug, "-")
+	if len(slug) > 48 {
+		slug = strings.Trim(slug[len(slug)-48:], "-")
+	}
+	if slug == "" {
+		slug = "run"
+	}
+	return slug
+}
+
+// pruneRunLogs removes the oldest run logs beyond maxRunLogs; names start
+// with their time, so they sort oldest first
+func pruneRunLogs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) < maxRunLogs {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-maxRunLogs+1] {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
@@ -0,0 +1,515 @@
+/**
+ * Scheduler - Periodic jobs of every feature
+ * Features add their recurring work (syncs, updates, checks, reports) as jobs
+ * instead of running tickers of their own. Each job runs on its schedule
+ * (an interval or a cron expression, see Cron.go), delayed by up to its
+ * jitter, and never twice at once. Runs are due by the wall clock, so a run
+ * missed while the machine slept happens once shortly after it resumes
+ * (unless catch-up is off). Users can override schedules and disable jobs
+ * or leave them to systemd timers; those still run on demand.
+ */
+
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedulerPoll is the longest the scheduler sleeps before checking the
+// wall clock, which keeps running while monotonic timers pause in suspend
+const schedulerPoll = 30 * time.Second
+
+// resumeSettle is how long after a resume missed jobs run, giving the
+// network time to come back
+const resumeSettle = 30 * time.Second
+
+// ErrJobRunning is returned when a job asked to run is already running
+var ErrJobRunning = errors.New("job is already running")
+
+// Job is recurring work of a feature
+type Job struct {
+	ID          string // e.g. "system-update"
+	Description string
+	Schedule    Schedule
+	Jitter      time.Duration // runs are delayed by a random time up to this
+	RunAtStart  bool          // also run as soon as the job is added
+	Run         func(ctx context.Context) error
+}
+
+// JobInfo describes a job and its runs
+type JobInfo struct {
+	ID           string
+	Description  string
+	Schedule     string
+	Overridden   bool // schedule comes from jobs.schedules
+	Enabled      bool
+	Timer        bool // left to its systemd timer
+	Running      bool
+	NextRun      time.Time // zero while disabled
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	Runs         int
+}
+
+// scheduledJob is a job with its run state
+type scheduledJob struct {
+	Job
+	next         time.Time
+	running      bool
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	runs         int
+	waiters      []chan error // RunNow callers waiting for the run
+}
+
+// jobsState is the state store section keeping the jobs' runs
+const jobsState = "jobs"
+
+// savedJob is a job's runs as kept in the state store
+type savedJob struct {
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	Runs         int           `json:"runs"`
+}
+
+// Scheduler runs the jobs of every feature
+type Scheduler struct {
+	logger     *Logger
+	jobs       map[string]*scheduledJob
+	overrides  map[string]Schedule
+	disabled   map[string]bool
+	timers     map[string]bool     // jobs run by their systemd timer, see Timers.go
+	catchUp    bool                // run jobs missed during a suspend on resume
+	lastCheck  time.Time           // when runDue last ran, to notice a suspend
+	lastResume time.Time           // wall clock of the last resume handled
+	saved      map[string]savedJob // runs before the daemon (re)started
+	isRunning  bool
+	stopChan   chan struct{}
+	wake       chan struct{}
+	mu         sync.Mutex
+}
+
+var (
+	schedulerInstance *Scheduler
+	schedulerOnce     sync.Once
+)
+
+// GetScheduler returns the singleton Scheduler instance
+func GetScheduler() *Scheduler {
+	schedulerOnce.Do(func() {
+		schedulerInstance = &Scheduler{
+			logger:    GetLogger().With("scheduler"),
+			jobs:      make(map[string]*scheduledJob),
+			overrides: make(map[string]Schedule),
+			disabled:  make(map[string]bool),
+			timers:    make(map[string]bool),
+			catchUp:   true,
+			wake:      make(chan struct{}, 1),
+		}
+		GetStateStore().Load(jobsState, &schedulerInstance.saved)
+		if schedulerInstance.saved == nil {
+			schedulerInstance.saved = make(map[string]savedJob)
+		}
+	})
+	return schedulerInstance
+}
+
+// Add schedules a job, replacing one with the same ID; the scheduler starts
+// with its first job
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled := &scheduledJob{Job: job}
+	if previous, ok := s.jobs[job.ID]; ok {
+		// The run history and a run in progress carry over
+		scheduled.running = previous.running
+		scheduled.lastRun = previous.lastRun
+		scheduled.lastDuration = previous.lastDuration
+		scheduled.lastError = previous.lastError
+		scheduled.runs = previous.runs
+		scheduled.waiters = previous.waiters
+	} else if saved, ok := s.saved[job.ID]; ok {
+		scheduled.lastRun = saved.LastRun
+		scheduled.lastDuration = saved.LastDuration
+		scheduled.lastError = saved.LastError
+		scheduled.runs = saved.Runs
+	}
+	now := time.Now().Round(0)
+	if job.RunAtStart && !s.disabled[job.ID] && !s.timers[job.ID] {
+		scheduled.next = now
+		// After a restart the job waits out the rest of its interval
+		if !scheduled.lastRun.IsZero() {
+			if next := s.nextRun(scheduled, scheduled.lastRun); next.After(now) {
+				scheduled.next = next
+			}
+		}
+	} else {
+		scheduled.next = s.nextRun(scheduled, now)
+	}
+	s.jobs[job.ID] = scheduled
+	s.logger.Debug("Scheduled %s (%s), next run %s", job.ID, s.schedule(scheduled), formatNextRun(scheduled.next))
+
+	s.start()
+	s.poke()
+}
+
+// Remove unschedules a job; a run in progress finishes
+func (s *Scheduler) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+}
+
+// Reschedule changes a job's own schedule, counting from now. An override
+// from jobs.schedules still takes precedence.
+func (s *Scheduler) Reschedule(id string, schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	job.Schedule = schedule
+	job.next = s.nextRun(job, time.Now().Round(0))
+	s.poke()
+}
+
+// SetOverrides replaces the schedules users set for jobs by ID
+func (s *Scheduler) SetOverrides(overrides map[string]Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides = make(map[string]Schedule, len(overrides))
+	for id, schedule := range overrides {
+		s.overrides[id] = schedule
+	}
+	s.rescheduleAll()
+}
+
+// SetDisabled replaces the IDs of jobs that don't run on their schedule
+func (s *Scheduler) SetDisabled(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disabled = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		s.disabled[id] = true
+	}
+	s.rescheduleAll()
+}
+
+// SetTimerJobs replaces the IDs of jobs their systemd timer runs instead of
+// the scheduler
+func (s *Scheduler) SetTimerJobs(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timers := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		timers[id] = true
+	}
+	if maps.Equal(timers, s.timers) {
+		return
+	}
+	s.timers = timers
+	if len(ids) > 0 {
+		s.logger.Info("Leaving %s to systemd timers", strings.Join(ids, ", "))
+	}
+	s.rescheduleAll()
+}
+
+// SetCatchUp sets whether jobs missed while the machine slept run on
+// resume, or wait for their next time
+func (s *Scheduler) SetCatchUp(catchUp bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.catchUp = catchUp
+}
+
+// Resumed recomputes the next runs after the machine slept (see
+// SleepWatcher); the scheduler also notices a resume by itself
+func (s *Scheduler) Resumed(slept time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumed(time.Now().Round(0))
+	s.poke()
+}
+
+// resumed runs the jobs that were due while the machine slept shortly, or
+// moves them to their next time without catch-up; once per resume
+func (s *Scheduler) resumed(now time.Time) {
+	if !s.lastResume.IsZero() && now.Sub(s.lastResume) < resumeDedup {
+		return
+	}
+	s.lastResume = now
+
+	var missed []string
+	for _, job := range s.jobs {
+		if job.next.IsZero() || now.Before(job.next) || job.running {
+			continue
+		}
+		missed = append(missed, job.ID)
+		if !s.catchUp {
+			job.next = s.nextRun(job, now)
+			continue
+		}
+		job.next = now.Add(resumeSettle)
+		if job.Jitter > 0 {
+			job.next = job.next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	sort.Strings(missed)
+	if s.catchUp {
+		s.logger.Info("Running %d job(s) missed while asleep in %v: %s", len(missed), resumeSettle, strings.Join(missed, ", "))
+	} else {
+		s.logger.Info("Skipping %d job(s) missed while asleep until their next time (jobs.catch_up is off): %s", len(missed), strings.Join(missed, ", "))
+	}
+}
+
+// rescheduleAll recomputes every job's next run after a settings change
+func (s *Scheduler) rescheduleAll() {
+	now := time.Now().Round(0)
+	for _, job := range s.jobs {
+		job.next = s.nextRun(job, now)
+	}
+	s.poke()
+}
+
+// RunNow runs a job at once, disabled or not, and returns a channel that
+// receives its result
+func (s *Scheduler) RunNow(id string) (<-chan error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown job %q (see `daemira jobs list`)", id)
+	}
+	if job.running {
+		return nil, fmt.Errorf("%s: %w", id, ErrJobRunning)
+	}
+	done := make(chan error, 1)
+	job.waiters = append(job.waiters, done)
+	s.logger.Info("Running %s now", id)
+	s.launch(job, time.Now().Round(0))
+	return done, nil
+}
+
+// Jobs describes every job, by ID
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		_, overridden := s.overrides[job.ID]
+		infos = append(infos, JobInfo{
+			ID:           job.ID,
+			Description:  job.Description,
+			Schedule:     s.schedule(job).String(),
+			Overridden:   overridden,
+			Enabled:      !s.disabled[job.ID],
+			Timer:        s.timers[job.ID],
+			Running:      job.running,
+			NextRun:      job.next,
+			LastRun:      job.lastRun,
+			LastDuration: job.lastDuration,
+			LastError:    job.lastError,
+			Runs:         job.runs,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// NextRun returns when a job runs next, or the zero time if it isn't
+// scheduled or is disabled
+func (s *Scheduler) NextRun(id string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[id]; ok {
+		return job.next
+	}
+	return time.Time{}
+}
+
+// Stop halts the scheduler; runs in progress finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isRunning {
+		return
+	}
+	s.isRunning = false
+	close(s.stopChan)
+}
+
+// start runs the scheduler loop unless it runs already
+func (s *Scheduler) start() {
+	if s.isRunning {
+		return
+	}
+	s.isRunning = true
+	s.stopChan = make(chan struct{})
+	stop := s.stopChan
+
+	go Supervise("scheduler", func() {
+		heartbeat := GetWatchdog().Heartbeat("scheduler", heartbeatTimeout)
+		defer heartbeat.Stop()
+		for {
+			heartbeat.Beat()
+			timer := time.NewTimer(s.runDue())
+			select {
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+	})
+}
+
+// poke makes the loop look at the jobs again
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runDue starts the jobs that are due and returns how long to sleep
+func (s *Scheduler) runDue() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := time.Now()
+	if !s.lastCheck.IsZero() && ClockJump(s.lastCheck, current) >= minSleep {
+		s.resumed(current.Round(0))
+	}
+	s.lastCheck = current
+
+	now := current.Round(0)
+	sleep := schedulerPoll
+	for _, job := range s.jobs {
+		if job.next.IsZero() {
+			continue
+		}
+		if !now.Before(job.next) {
+			if job.running {
+				// Overlapping runs are skipped, not queued
+				job.next = s.nextRun(job, now)
+			} else {
+				if late := now.Sub(job.next); late > schedulerPoll+job.Jitter {
+					s.logger.Info("Running %s, missed %s ago (the machine was asleep or busy)", job.ID, late.Round(time.Minute))
+				}
+				s.launch(job, now)
+			}
+		}
+		if wait := job.next.Sub(now); wait < sleep {
+			sleep = max(wait, time.Second)
+		}
+	}
+	return sleep
+}
+
+// launch runs a job in the background and schedules its next run
+func (s *Scheduler) launch(job *scheduledJob, now time.Time) {
+	job.running = true
+	job.next = s.nextRun(job, now)
+	run := job.Run
+
+	Go("job-"+job.ID, func() {
+		start := time.Now()
+		var err error
+		defer func() {
+			s.mu.Lock()
+			job.running = false
+			job.lastRun = start.Round(0)
+			job.lastDuration = time.Since(start)
+			job.runs++
+			job.lastError = ""
+			if err != nil {
+				job.lastError = err.Error()
+			}
+			waiters := job.waiters
+			job.waiters = nil
+			s.saved[job.ID] = savedJob{
+				LastRun:      job.lastRun,
+				LastDuration: job.lastDuration,
+				LastError:    job.lastError,
+				Runs:         job.runs,
+			}
+			saved := make(map[string]savedJob, len(s.saved))
+			for id, runs := range s.saved {
+				saved[id] = runs
+			}
+			s.mu.Unlock()
+
+			GetStateStore().Save(jobsState, saved)
+
+			for _, waiter := range waiters {
+				waiter <- err
+			}
+		}()
+
+		// A crash is reported by Go and recorded as the run's error
+		err = fmt.Errorf("%s crashed", job.ID)
+		err = run(context.Background())
+		if err != nil {
+			s.logger.Warn("Job %s failed: %v", job.ID, err)
+		}
+	})
+}
+
+// schedule returns the schedule a job runs on
+func (s *Scheduler) schedule(job *scheduledJob) Schedule {
+	if override, ok := s.overrides[job.ID]; ok {
+		return override
+	}
+	return job.Schedule
+}
+
+// nextRun returns when a job runs next after now, jitter included, or the
+// zero time if it is disabled or left to its timer
+func (s *Scheduler) nextRun(job *scheduledJob, now time.Time) time.Time {
+	if s.disabled[job.ID] || s.timers[job.ID] {
+		return time.Time{}
+	}
+	next := s.schedule(job).Next(now)
+	if next.IsZero() {
+		return next
+	}
+	if job.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+	}
+	return next
+}
+
+// formatNextRun formats a next run time for logs
+func formatNextRun(next time.Time) string {
+	if next.IsZero() {
+		return "never (disabled)"
+	}
+	return next.Format("2006-01-02 15:04:05")
+}
@@ -1,38 +1,91 @@
 package utility
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// defaultSlowCommandThreshold is how long a command may take before it is
+// logged as slow, unless SetSlowCommandThreshold changes it
+const defaultSlowCommandThreshold = 10 * time.Second
+
+var (
+	slowCommandThreshold = defaultSlowCommandThreshold
+	slowCommandMu        sync.RWMutex
+)
+
+// commandNamePattern matches the program names metrics are kept under
+var commandNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// terminateGrace is how long a cancelled command has to exit after SIGTERM
+// before its process group is killed
+const terminateGrace = 10 * time.Second
+
+// CommandRunner runs commands; Shell runs them for real, FakeRunner answers
+// them from canned results so features can be exercised without the system
+type CommandRunner interface {
+	// Execute runs a command line through bash
+	Execute(ctx context.Context, command string, opts *ExecOptions) (*Result, error)
+	// ExecuteArgs runs a program with its arguments, without a shell
+	ExecuteArgs(ctx context.Context, name string, args []string, opts *ExecOptions) (*Result, error)
+	// ExecuteWithRetry runs a program like ExecuteArgs, again after transient failures
+	ExecuteWithRetry(ctx context.Context, name string, args []string, opts *ExecOptions, policy RetryPolicy) (*Result, error)
+}
+
 // Shell provides command execution capabilities
 type Shell struct {
 	logger *Logger
 }
 
+var _ CommandRunner = (*Shell)(nil)
+
 // Result contains the output of a command execution
 type Result struct {
-	ExitCode int
-	Stdout   string
-	Stderr   string
-	TimedOut bool
-	Duration time.Duration
-	Command  string
+	ExitCode  int
+	Stdout    string
+	Stderr    string
+	TimedOut  bool
+	Duration  time.Duration
+	Command   string
+	PID       int  // process (and process group) ID the command ran as
+	Truncated bool // Stdout or Stderr was cut to MaxOutputBytes
 }
 
 // ExecOptions configures command execution
 type ExecOptions struct {
-	Timeout        time.Duration
+	Timeout        time.Duration // 0 is 30 seconds, a negative value no limit
 	StdoutCallback func(line string)
 	StderrCallback func(line string)
 	Env            map[string]string
 	WorkDir        string
 	UseSudo        bool
+	// PTY runs the command on a pseudo-terminal, for tools that behave
+	// differently without one. Its output keeps colors and arrives through
+	// StdoutCallback and Stdout only, as a terminal merges stderr into it.
+	PTY bool
+	// Prompts answers prompts the command writes to its pseudo-terminal
+	Prompts []PromptAnswer
+	// StartCallback receives the PID of the command once it has started; it
+	// leads its own process group, which StopProcessGroup stops
+	StartCallback func(pid int)
+	// MaxOutputBytes is how much of each stream the Result keeps: the start
+	// and the end, marked where output was left out. 0 keeps a megabyte,
+	// a negative value everything. Callbacks still see every line.
+	MaxOutputBytes int
+	// OutputFile, if set, has the command's complete output appended to it,
+	// stderr lines included, for commands with more output than a Result keeps
+	OutputFile string
+	// ReadOnly marks a command that only reads, e.g. a root-only file through
+	// sudo, keeping it out of the audit log
+	ReadOnly bool
 }
 
 // NewShell creates a new Shell executor
@@ -40,23 +93,112 @@ func NewShell(logger *Logger) *Shell {
 	return &Shell{logger: logger}
 }
 
-// Execute runs a command with the given options
+// ShellQuote single-quotes a string for bash
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// shellSafe matches arguments bash reads as they are
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// CommandLine joins a program and its arguments into a bash command line,
+// quoting the arguments that need it
+func CommandLine(argv ...string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if shellSafe.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = ShellQuote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Pipeline joins commands with |, each quoted with CommandLine
+func Pipeline(commands ...[]string) string {
+	return joinCommands(" | ", commands)
+}
+
+// Sequence joins commands with &&, so each runs only if the previous one succeeded
+func Sequence(commands ...[]string) string {
+	return joinCommands(" && ", commands)
+}
+
+// joinCommands quotes each command and joins them with sep
+func joinCommands(sep string, commands [][]string) string {
+	lines := make([]string, len(commands))
+	for i, argv := range commands {
+		lines[i] = CommandLine(argv...)
+	}
+	return strings.Join(lines, sep)
+}
+
+// Execute runs a command line through bash with the given options
 func (s *Shell) Execute(ctx context.Context, command string, opts *ExecOptions) (*Result, error) {
+	opts = withDefaults(opts)
+
+	// Add sudo if requested
+	if opts.UseSudo {
+		command = fmt.Sprintf("sudo %s", command)
+	}
+
+	return s.run(ctx, command, opts, func(execCtx context.Context) *exec.Cmd {
+		return exec.CommandContext(execCtx, "bash", "-c", command)
+	})
+}
+
+// ExecuteArgs runs a program with its arguments directly, without bash, so
+// the arguments reach it as they are and need no quoting. A program that is
+// not installed gives exit code 127, as it would through bash.
+func (s *Shell) ExecuteArgs(ctx context.Context, name string, args []string, opts *ExecOptions) (*Result, error) {
+	opts = withDefaults(opts)
+
+	// Add sudo if requested
+	if opts.UseSudo {
+		args = append([]string{name}, args...)
+		name = "sudo"
+	}
+
+	command := CommandLine(append([]string{name}, args...)...)
+	if _, err := exec.LookPath(name); err != nil {
+		return &Result{
+			ExitCode: 127,
+			Stderr:   fmt.Sprintf("%s: command not found", name),
+			Command:  command,
+		}, nil
+	}
+
+	return s.run(ctx, command, opts, func(execCtx context.Context) *exec.Cmd {
+		return exec.CommandContext(execCtx, name, args...)
+	})
+}
+
+// withDefaults returns opts, or the default options if nil, with the default timeout if unset
+func withDefaults(opts *ExecOptions) *ExecOptions {
 	if opts == nil {
-		opts = &ExecOptions{
-			Timeout: 30 * time.Second,
-		}
+		opts = &ExecOptions{}
 	}
 
 	// Set default timeout if not specified
 	if opts.Timeout == 0 {
 		opts.Timeout = 30 * time.Second
 	}
+	if opts.MaxOutputBytes == 0 {
+		opts.MaxOutputBytes = defaultMaxOutputBytes
+	}
+	return opts
+}
 
-	// Add sudo if requested
-	if opts.UseSudo {
-		command = fmt.Sprintf("sudo %s", command)
+// run starts the command made by newCmd and collects its output; command is
+// how it is shown in the result and the audit log
+func (s *Shell) run(ctx context.Context, command string, opts *ExecOptions, newCmd func(context.Context) *exec.Cmd) (*Result, error) {
+	// Wait in line for a slot; the timeout starts once the command does
+	release, err := acquireCommandSlot(ctx, command, opts.Timeout)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
 	// Create context with timeout
 	execCtx := ctx
@@ -69,18 +211,113 @@ func (s *Shell) Execute(ctx context.Context, command string, opts *ExecOptions)
 	startTime := time.Now()
 
 	// Create command
-	cmd := exec.CommandContext(execCtx, "bash", "-c", command)
+	cmd := newCmd(execCtx)
 
 	// Set working directory
 	if opts.WorkDir != "" {
 		cmd.Dir = opts.WorkDir
 	}
 
-	// Set environment variables
+	// Set environment variables (on top of the inherited environment)
 	if len(opts.Env) > 0 {
-		cmd.Env = append(cmd.Env, s.envMapToSlice(opts.Env)...)
+		cmd.Env = append(os.Environ(), s.envMapToSlice(opts.Env)...)
 	}
 
+	// The command and everything it spawns get a process group of their own,
+	// so cancelling stops all of them: SIGTERM first, SIGKILL after a grace period
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		go StopProcessGroup(cmd.Process.Pid, terminateGrace)
+		return nil
+	}
+
+	// Start the command, on a pseudo-terminal or with its output piped
+	file, err := openOutputFile(opts.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stdout, stderr := newOutputBuffer(opts.MaxOutputBytes), newOutputBuffer(opts.MaxOutputBytes)
+	var waitOutput func()
+	if opts.PTY {
+		waitOutput, err = startPTY(cmd, opts, stdout, file)
+	} else {
+		waitOutput, err = startPiped(cmd, opts, stdout, stderr, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StartCallback != nil {
+		opts.StartCallback(cmd.Process.Pid)
+	}
+
+	// Privileged and system-changing commands go to the audit log
+	if action := auditCommandAction(command); action != "" && !sudoCheckCommands[command] && !opts.ReadOnly {
+		defer func() {
+			Audit(action, command, fmt.Sprintf("exit code %d after %.1fs", cmd.ProcessState.ExitCode(), time.Since(startTime).Seconds()))
+		}()
+	}
+
+	// Wait for output reading to complete
+	waitOutput()
+
+	// Wait for command to complete
+	err = cmd.Wait()
+	duration := time.Since(startTime)
+	defer func() {
+		exitCode := cmd.ProcessState.ExitCode()
+		if execCtx.Err() != nil {
+			exitCode = -1
+		}
+		s.observe(command, duration, exitCode)
+	}()
+
+	result := &Result{
+		ExitCode:  0,
+		Stdout:    strings.TrimSpace(stdout.String()),
+		Stderr:    strings.TrimSpace(stderr.String()),
+		TimedOut:  false,
+		Duration:  duration,
+		Command:   command,
+		PID:       cmd.Process.Pid,
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+	}
+
+	// Check if command timed out or was cancelled
+	if execCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		result.TimedOut = true
+		result.ExitCode = -1
+		return result, fmt.Errorf("command timed out after %v", opts.Timeout)
+	}
+	if ctx.Err() != nil {
+		result.ExitCode = -1
+		return result, fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+
+	// Get exit code
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+			return result, fmt.Errorf("command failed: %w", err)
+		}
+	}
+
+	// Tell callers sudo wanted a password rather than leave them to parse its output
+	if needsPassword(command, result) {
+		GetPrivilegeManager().invalidate()
+		return result, fmt.Errorf("%s: %w", command, ErrNeedsPassword)
+	}
+
+	return result, nil
+}
+
+// startPiped starts cmd with its stdout and stderr read line by line into
+// the buffers, the file and the callbacks; the returned function waits for
+// both to close
+func startPiped(cmd *exec.Cmd, opts *ExecOptions, stdout, stderr *outputBuffer, file *outputFile) (func(), error) {
 	// Create stdout and stderr pipes
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -98,70 +335,110 @@ func (s *Shell) Execute(ctx context.Context, command string, opts *ExecOptions)
 	}
 
 	// Capture stdout
-	var stdoutBuf bytes.Buffer
 	stdoutDone := make(chan struct{})
 	go func() {
-		scanner := bufio.NewScanner(stdoutPipe)
-		for scanner.Scan() {
-			line := scanner.Text()
-			stdoutBuf.WriteString(line + "\n")
+		readLines(stdoutPipe, func(line string) {
+			stdout.WriteLine(line)
+			file.WriteLine(line)
 			if opts.StdoutCallback != nil {
 				opts.StdoutCallback(line)
 			}
-		}
+		})
 		close(stdoutDone)
 	}()
 
 	// Capture stderr
-	var stderrBuf bytes.Buffer
 	stderrDone := make(chan struct{})
 	go func() {
-		scanner := bufio.NewScanner(stderrPipe)
-		for scanner.Scan() {
-			line := scanner.Text()
-			stderrBuf.WriteString(line + "\n")
+		readLines(stderrPipe, func(line string) {
+			stderr.WriteLine(line)
+			file.WriteLine("[stderr] " + line)
 			if opts.StderrCallback != nil {
 				opts.StderrCallback(line)
 			}
-		}
+		})
 		close(stderrDone)
 	}()
 
-	// Wait for output reading to complete
-	<-stdoutDone
-	<-stderrDone
+	return func() {
+		<-stdoutDone
+		<-stderrDone
+	}, nil
+}
 
-	// Wait for command to complete
-	err = cmd.Wait()
-	duration := time.Since(startTime)
+// SetSlowCommandThreshold sets how long a command may take before it is
+// logged as slow with its full invocation; 0 turns this off
+func SetSlowCommandThreshold(threshold time.Duration) {
+	slowCommandMu.Lock()
+	defer slowCommandMu.Unlock()
+	slowCommandThreshold = threshold
+}
 
-	result := &Result{
-		ExitCode: 0,
-		Stdout:   strings.TrimSpace(stdoutBuf.String()),
-		Stderr:   strings.TrimSpace(stderrBuf.String()),
-		TimedOut: false,
-		Duration: duration,
-		Command:  command,
-	}
+// observe records a finished command in the metrics and logs it if it was slow
+func (s *Shell) observe(command string, duration time.Duration, exitCode int) {
+	GetMetrics().Observe(commandName(command), duration, exitCode)
 
-	// Check if command timed out
-	if execCtx.Err() == context.DeadlineExceeded {
-		result.TimedOut = true
-		result.ExitCode = -1
-		return result, fmt.Errorf("command timed out after %v", opts.Timeout)
+	slowCommandMu.RLock()
+	threshold := slowCommandThreshold
+	slowCommandMu.RUnlock()
+	if threshold <= 0 || duration < threshold {
+		return
+	}
+	logger := s.logger
+	if logger == nil {
+		logger = GetLogger().With("shell")
 	}
+	logger.Info("Slow command (%.1fs, exit code %d): %s", duration.Seconds(), exitCode, command)
+}
 
-	// Get exit code
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = -1
-			return result, fmt.Errorf("command failed: %w", err)
+// commandName returns the program a command line runs, past sudo, env,
+// variable assignments and the root helper; anything more involved is
+// counted as "shell"
+func commandName(command string) string {
+	if loc := rootHelperPattern.FindStringIndex(command); loc != nil {
+		command = command[loc[1]:]
+	}
+	for _, field := range strings.Fields(command) {
+		if strings.ContainsAny(field, "$;|&()<>") {
+			break
+		}
+		if field == "sudo" || field == "env" || strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+			continue
 		}
+		if name := filepath.Base(strings.Trim(field, `'"`)); commandNamePattern.MatchString(name) {
+			return name
+		}
+		break
 	}
+	return "shell"
+}
 
-	return result, nil
+// StopProcessGroup stops a command started by Shell and everything it
+// spawned: SIGTERM to its process group, then SIGKILL if any of it is still
+// running after grace
+func StopProcessGroup(pid int, grace time.Duration) {
+	if pid <= 0 {
+		return
+	}
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(grace)
+	for {
+		select {
+		case <-deadline:
+			syscall.Kill(-pid, syscall.SIGKILL)
+			return
+		case <-ticker.C:
+			// Signal 0 only checks whether anything in the group is left
+			if syscall.Kill(-pid, 0) != nil {
+				return
+			}
+		}
+	}
 }
 
 // envMapToSlice converts a map of environment variables to a slice
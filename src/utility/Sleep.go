@@ -0,0 +1,217 @@
+/**
+ * SleepWatcher - Suspend and resume of the machine
+ * Listens for logind's PrepareForSleep signal with `gdbus monitor`, which
+ * needs no privileges to watch the system bus. Where that isn't available
+ * (or the signal is lost) a resume is still noticed by the wall clock
+ * running ahead of the monotonic clock, which stops while the machine
+ * sleeps. Callbacks run on resume with the time slept.
+ */
+
+package utility
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sleepCheckInterval is how often the clock is compared for a jump
+	sleepCheckInterval = 30 * time.Second
+	// minSleep is the smallest clock jump taken for a suspend
+	minSleep = time.Minute
+	// resumeDedup is how long after a resume another report of it is ignored
+	resumeDedup = 2 * time.Minute
+)
+
+// SleepWatcher reports suspend and resume
+type SleepWatcher struct {
+	logger     *Logger
+	onResume   []func(slept time.Duration)
+	sleptAt    time.Time // wall clock when PrepareForSleep(true) arrived
+	lastResume time.Time // wall clock of the last resume reported
+	monitor    *exec.Cmd
+	isRunning  bool
+	stopChan   chan struct{}
+	mu         sync.Mutex
+}
+
+var (
+	sleepWatcherInstance *SleepWatcher
+	sleepWatcherOnce     sync.Once
+)
+
+// GetSleepWatcher returns the singleton SleepWatcher instance
+func GetSleepWatcher() *SleepWatcher {
+	sleepWatcherOnce.Do(func() {
+		sleepWatcherInstance = &SleepWatcher{
+			logger: GetLogger().With("sleep"),
+		}
+	})
+	return sleepWatcherInstance
+}
+
+// OnResume registers a callback run once the machine resumed
+func (sw *SleepWatcher) OnResume(callback func(slept time.Duration)) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.onResume = append(sw.onResume, callback)
+}
+
+// Start watches for suspend and resume (called by the daemon)
+func (sw *SleepWatcher) Start() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.isRunning {
+		return
+	}
+	sw.isRunning = true
+	sw.stopChan = make(chan struct{})
+	stop := sw.stopChan
+
+	if _, err := exec.LookPath("gdbus"); err == nil {
+		go Supervise("sleep-signals", func() {
+			for {
+				if err := sw.watchSignals(); err != nil {
+					sw.logger.Debug("Watching logind for suspend failed: %v", err)
+				}
+				// gdbus exits with the bus (or when stopped); try again later
+				select {
+				case <-stop:
+					return
+				case <-time.After(sleepCheckInterval):
+				}
+			}
+		})
+	} else {
+		sw.logger.Debug("gdbus not found, noticing resume from suspend by the clock alone")
+	}
+
+	go Supervise("sleep-clock", func() {
+		heartbeat := GetWatchdog().Heartbeat("sleep-clock", heartbeatTimeout)
+		defer heartbeat.Stop()
+		ticker := time.NewTicker(sleepCheckInterval)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case now := <-ticker.C:
+				heartbeat.Beat()
+				if slept := ClockJump(last, now); slept >= minSleep {
+					sw.resumed(slept)
+				}
+				last = now
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts the watcher
+func (sw *SleepWatcher) Stop() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if !sw.isRunning {
+		return
+	}
+	sw.isRunning = false
+	close(sw.stopChan)
+	if sw.monitor != nil && sw.monitor.Process != nil {
+		sw.monitor.Process.Kill()
+	}
+}
+
+// watchSignals follows logind's PrepareForSleep signal until gdbus exits
+func (sw *SleepWatcher) watchSignals() error {
+	cmd := exec.Command("gdbus", "monitor", "--system",
+		"--dest", "org.freedesktop.login1",
+		"--object-path", "/org/freedesktop/login1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	sw.mu.Lock()
+	if !sw.isRunning {
+		sw.mu.Unlock()
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		sw.mu.Unlock()
+		return err
+	}
+	sw.monitor = cmd
+	sw.mu.Unlock()
+
+	// e.g. "/org/freedesktop/login1: org.freedesktop.login1.Manager.PrepareForSleep (true,)"
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, ".PrepareForSleep (") {
+			continue
+		}
+		if strings.Contains(line, "(true") {
+			sw.suspending()
+		} else {
+			sw.signalResume()
+		}
+	}
+	return cmd.Wait()
+}
+
+// suspending notes the machine is about to sleep
+func (sw *SleepWatcher) suspending() {
+	sw.mu.Lock()
+	sw.sleptAt = time.Now().Round(0)
+	sw.mu.Unlock()
+	sw.logger.Info("Suspending")
+}
+
+// signalResume reports the resume logind announced
+func (sw *SleepWatcher) signalResume() {
+	sw.mu.Lock()
+	sleptAt := sw.sleptAt
+	sw.sleptAt = time.Time{}
+	sw.mu.Unlock()
+
+	var slept time.Duration
+	if !sleptAt.IsZero() {
+		slept = time.Now().Round(0).Sub(sleptAt)
+	}
+	sw.resumed(slept)
+}
+
+// resumed logs a resume and runs the callbacks, once per resume however
+// many ways it was noticed
+func (sw *SleepWatcher) resumed(slept time.Duration) {
+	now := time.Now().Round(0)
+	sw.mu.Lock()
+	if !sw.lastResume.IsZero() && now.Sub(sw.lastResume) < resumeDedup {
+		sw.mu.Unlock()
+		return
+	}
+	sw.lastResume = now
+	callbacks := append([]func(time.Duration){}, sw.onResume...)
+	sw.mu.Unlock()
+
+	if slept > 0 {
+		sw.logger.Info("Resumed from suspend after %s", slept.Round(time.Second))
+	} else {
+		sw.logger.Info("Resumed from suspend")
+	}
+	for _, callback := range callbacks {
+		callback(slept)
+	}
+}
+
+// ClockJump returns how far the wall clock moved past the monotonic clock
+// between two readings of time.Now, which is the time the machine slept
+// (or the wall clock was set forward)
+func ClockJump(earlier, later time.Time) time.Duration {
+	return later.Round(0).Sub(earlier.Round(0)) - later.Sub(earlier)
+}
@@ -0,0 +1,164 @@
+/**
+ * StateStore - Runtime state kept across restarts
+ * Features save what the status commands show (last sync times, update
+ * history, acknowledged alerts, job runs) in sections of one versioned file
+ * in the state directory, and load it when they are created, so a restart
+ * or reboot doesn't forget it. Only the daemon writes the file; CLI runs
+ * read it.
+ */
+
+package utility
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateVersion is the format of the state file. Raise it when a section
+// changes incompatibly, and upgrade older files in load.
+const stateVersion = 1
+
+// stateFile is the state file's content
+type stateFile struct {
+	Version  int                        `json:"version"`
+	Saved    time.Time                  `json:"saved"`
+	Sections map[string]json.RawMessage `json:"sections"`
+}
+
+// StateStore holds the sections of the state file
+type StateStore struct {
+	logger   *Logger
+	path     string
+	sections map[string]json.RawMessage
+	loaded   bool
+	persist  bool
+	readOnly bool // the file is from a newer daemira
+	mu       sync.Mutex
+}
+
+var (
+	stateStoreInstance *StateStore
+	stateStoreOnce     sync.Once
+)
+
+// GetStateStore returns the singleton StateStore instance
+func GetStateStore() *StateStore {
+	stateStoreOnce.Do(func() {
+		stateStoreInstance = &StateStore{
+			logger:   GetLogger().With("state"),
+			path:     StateStorePath(),
+			sections: make(map[string]json.RawMessage),
+		}
+	})
+	return stateStoreInstance
+}
+
+// StateStorePath returns the file runtime state is kept in
+func StateStorePath() string {
+	return filepath.Join(StateDir(), "state.json")
+}
+
+// Persist makes this process save state; only the daemon does, so CLI runs
+// don't overwrite what it knows
+func (s *StateStore) Persist() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persist = true
+}
+
+// Persists reports whether this process saves state
+func (s *StateStore) Persists() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.persist && !s.readOnly
+}
+
+// Load decodes a section into v and reports whether it was saved before
+func (s *StateStore) Load(section string, v interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load()
+	raw, ok := s.sections[section]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		s.logger.Warn("Ignoring saved %s state: %v", section, err)
+		return false
+	}
+	return true
+}
+
+// Save replaces a section with v and writes the file
+func (s *StateStore) Save(section string, v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.persist || s.readOnly {
+		return
+	}
+	s.load()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Warn("Failed to encode %s state: %v", section, err)
+		return
+	}
+	s.sections[section] = raw
+	if err := s.write(); err != nil {
+		s.logger.Warn("Failed to save %s state: %v", section, err)
+	}
+}
+
+// load reads the file once; the caller holds mu
+func (s *StateStore) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Warn("Failed to read saved state: %v", err)
+		}
+		return
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		s.logger.Warn("Ignoring unreadable saved state %s: %v", s.path, err)
+		return
+	}
+	if file.Version > stateVersion {
+		s.logger.Warn("Saved state %s is from a newer daemira (version %d); starting without it and leaving it alone", s.path, file.Version)
+		s.readOnly = true
+		return
+	}
+	if file.Sections != nil {
+		s.sections = file.Sections
+	}
+}
+
+// write replaces the file; the caller holds mu
+func (s *StateStore) write() error {
+	if _, err := EnsureDir(filepath.Dir(s.path)); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(stateFile{
+		Version:  stateVersion,
+		Saved:    time.Now(),
+		Sections: s.sections,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	pending := s.path + ".tmp"
+	if err := os.WriteFile(pending, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(pending, s.path)
+}
@@ -0,0 +1,180 @@
+/**
+ * Supervisor - Panic recovery for background workers
+ * Sync workers, schedulers and monitors run through Supervise or Go, which
+ * recover a panic, log its stack trace, count it and restart looping
+ * workers with a backoff, so one bad tick doesn't take the daemon down.
+ * Crash summaries are kept in the state directory for `daemira diagnostics`.
+ */
+
+package utility
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	maxCrashRecords = 50               // crash summaries kept on disk
+	maxRestarts     = 5                // restarts within restartWindow before giving up
+	restartWindow   = 10 * time.Minute // crashes older than this are forgiven
+	maxRestartDelay = time.Minute
+)
+
+// CrashRecord summarizes a recovered panic
+type CrashRecord struct {
+	Time      time.Time `json:"time"`
+	Worker    string    `json:"worker"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Restarted bool      `json:"restarted"`
+	PID       int       `json:"pid"`
+}
+
+var (
+	crashCounts = make(map[string]int)
+	crashMu     sync.Mutex
+)
+
+// CrashesPath returns the file holding crash summaries
+func CrashesPath() string {
+	return filepath.Join(StateDir(), "crashes.json")
+}
+
+// Supervise runs fn in the calling goroutine, restarting it with a backoff
+// when it panics. It returns when fn returns, or gives up after maxRestarts
+// crashes within restartWindow.
+func Supervise(name string, fn func()) {
+	var crashes []time.Time
+	delay := time.Second
+	for {
+		crash := recovered(fn)
+		if crash == nil {
+			return
+		}
+
+		now := time.Now()
+		recent := crashes[:0]
+		for _, at := range crashes {
+			if now.Sub(at) < restartWindow {
+				recent = append(recent, at)
+			}
+		}
+		crashes = append(recent, now)
+
+		crash.Worker = name
+		crash.Restarted = len(crashes) <= maxRestarts
+		reportCrash(crash)
+		if !crash.Restarted {
+			return
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// Go runs fn in a new goroutine, recovering and recording a panic without
+// restarting it; for one-off work such as a single sync pass
+func Go(name string, fn func()) {
+	go func() {
+		if crash := recovered(fn); crash != nil {
+			crash.Worker = name
+			reportCrash(crash)
+		}
+	}()
+}
+
+// CrashCounts returns how many times each worker of this process crashed
+func CrashCounts() map[string]int {
+	crashMu.Lock()
+	defer crashMu.Unlock()
+
+	counts := make(map[string]int, len(crashCounts))
+	for name, count := range crashCounts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// LoadCrashes reads the recorded crash summaries, oldest first
+func LoadCrashes() ([]CrashRecord, error) {
+	data, err := os.ReadFile(CrashesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read crash records: %w", err)
+	}
+	var records []CrashRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse crash records: %w", err)
+	}
+	return records, nil
+}
+
+// recovered calls fn and returns a summary of its panic, if any
+func recovered(fn func()) (crash *CrashRecord) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash = &CrashRecord{
+				Time:  time.Now(),
+				Panic: Redact(fmt.Sprint(r)),
+				Stack: Redact(string(debug.Stack())),
+				PID:   os.Getpid(),
+			}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// reportCrash logs, counts and records a crash
+func reportCrash(crash *CrashRecord) {
+	logger := GetLogger().With("supervisor")
+	if crash.Restarted {
+		logger.Error("%s crashed and will be restarted: %s\n%s", crash.Worker, crash.Panic, crash.Stack)
+	} else {
+		logger.Error("%s crashed: %s\n%s", crash.Worker, crash.Panic, crash.Stack)
+	}
+
+	crashMu.Lock()
+	defer crashMu.Unlock()
+
+	crashCounts[crash.Worker]++
+	records, err := LoadCrashes()
+	if err != nil {
+		// A damaged file is replaced rather than blocking new records
+		records = nil
+	}
+	records = append(records, *crash)
+	if len(records) > maxCrashRecords {
+		records = records[len(records)-maxCrashRecords:]
+	}
+	if err := writeCrashes(records); err != nil {
+		logger.Warn("Failed to save crash record: %v", err)
+	}
+}
+
+// writeCrashes replaces the crash records file
+func writeCrashes(records []CrashRecord) error {
+	if _, err := EnsureDir(StateDir()); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode crash records: %w", err)
+	}
+	pending := CrashesPath() + ".tmp"
+	if err := os.WriteFile(pending, data, 0644); err != nil {
+		return fmt.Errorf("failed to write crash records: %w", err)
+	}
+	return os.Rename(pending, CrashesPath())
+}
@@ -0,0 +1,59 @@
+/**
+ * Terminal - Raw terminal access for the interactive screens
+ * (the installer and `daemira top`)
+ */
+
+package utility
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	return ioctl(f.Fd(), syscall.TCGETS, unsafe.Pointer(&termios)) == nil
+}
+
+// ioctl performs a terminal ioctl
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// MakeRaw puts the terminal in raw mode and returns the previous state
+func MakeRaw(f *os.File) (*syscall.Termios, error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, fmt.Errorf("failed to read terminal state: %w", err)
+	}
+
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG | syscall.IEXTEN
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, fmt.Errorf("failed to set raw mode: %w", err)
+	}
+	return &old, nil
+}
+
+// RestoreTerminal restores a state saved by MakeRaw
+func RestoreTerminal(f *os.File, state *syscall.Termios) {
+	_ = ioctl(f.Fd(), syscall.TCSETS, unsafe.Pointer(state))
+}
+
+// TerminalSize returns the terminal width and height, defaulting to 80x24
+func TerminalSize(f *os.File) (int, int) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
@@ -0,0 +1,157 @@
+/**
+ * Timers - systemd timers in place of the scheduler
+ * For those who prefer native scheduling, `daemira generate-timers` writes a
+ * user service and timer per job that run it through the daemon with
+ * `daemira jobs run <id>`. The daemon notices which of these timers are
+ * enabled and leaves those jobs to systemd instead of its own schedule.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timerUnitPrefix starts the names of the units generated for jobs
+const timerUnitPrefix = "daemira-"
+
+// TimerUnitName returns the timer unit running a job, e.g. daemira-gdrive-sync.timer
+func TimerUnitName(jobID string) string {
+	return timerUnitPrefix + jobID + ".timer"
+}
+
+// TimerServiceName returns the service unit the job's timer starts
+func TimerServiceName(jobID string) string {
+	return timerUnitPrefix + jobID + ".service"
+}
+
+// UserUnitDir returns the directory of the user's systemd units
+// ($XDG_CONFIG_HOME/systemd/user)
+func UserUnitDir() string {
+	return filepath.Join(filepath.Dir(ConfigDir()), "systemd", "user")
+}
+
+// TimerJobs returns the IDs of the jobs whose timer is enabled, by the user
+// or for every user in /etc/systemd/user
+func TimerJobs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, dir := range []string{UserUnitDir(), "/etc/systemd/user"} {
+		entries, err := os.ReadDir(filepath.Join(dir, "timers.target.wants"))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), timerUnitPrefix)
+			if !ok {
+				continue
+			}
+			id, ok := strings.CutSuffix(name, ".timer")
+			if !ok || id == "" || seen[id] {
+				continue
+			}
+			// A dangling link enables nothing
+			if _, err := os.Stat(filepath.Join(dir, "timers.target.wants", entry.Name())); err != nil {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TimerUnits renders the service running a job through the daemon with the
+// binary at path, and the timer starting it on schedule
+func TimerUnits(path, jobID, description string, schedule Schedule) (service, timer string, err error) {
+	timing, err := timerSchedule(schedule)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", jobID, err)
+	}
+
+	service = fmt.Sprintf(`[Unit]
+Description=Daemira: %s
+# The job runs in the daemon, which keeps its history and alerts
+Requisite=daemira.service
+After=daemira.service
+
+[Service]
+Type=oneshot
+ExecStart=%s jobs run %s
+`, description, path, jobID)
+
+	timer = fmt.Sprintf(`[Unit]
+Description=Run daemira's %s job (%s)
+
+[Timer]
+%s
+[Install]
+WantedBy=timers.target
+`, jobID, schedule, timing)
+	return service, timer, nil
+}
+
+// timerSchedule renders a schedule as [Timer] settings: intervals count from
+// the last run, cron expressions become calendar events that catch up on
+// runs missed while the machine was off
+func timerSchedule(schedule Schedule) (string, error) {
+	switch s := schedule.(type) {
+	case intervalSchedule:
+		interval := time.Duration(s)
+		jitter := (interval / 10).Round(time.Second)
+		return fmt.Sprintf("OnBootSec=5min\nOnUnitActiveSec=%s\nRandomizedDelaySec=%s\n", formatInterval(interval), formatInterval(jitter)), nil
+	case *cronSchedule:
+		calendar, err := s.onCalendar()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("OnCalendar=%s\nPersistent=true\n", calendar), nil
+	}
+	return "", fmt.Errorf("schedule %q can't be a systemd timer", schedule)
+}
+
+// onCalendar writes the cron expression as a systemd calendar event, e.g.
+// "0 4 * * mon-fri" as "Mon,Tue,Wed,Thu,Fri *-*-* 4:0:00"
+func (s *cronSchedule) onCalendar() (string, error) {
+	// Cron runs when either the day or the weekday matches, systemd only when both do
+	if !s.dayStar && !s.weekdayStar {
+		return "", fmt.Errorf("schedule %q restricts both the day of month and the day of week, which a systemd timer can't express", s.spec)
+	}
+
+	event := fmt.Sprintf("*-%s-%s %s:%s:00",
+		cronList(s.month, cronFields[3]), cronList(s.day, cronFields[2]),
+		cronList(s.hour, cronFields[1]), cronList(s.minute, cronFields[0]))
+	if weekdays := cronList(s.weekday, cronField{min: 0, max: 6}); weekdays != "*" {
+		names := strings.Split(weekdays, ",")
+		for i, day := range names {
+			n, _ := strconv.Atoi(day)
+			names[i] = time.Weekday(n).String()[:3]
+		}
+		event = strings.Join(names, ",") + " " + event
+	}
+	return event, nil
+}
+
+// cronList writes a field's bit set as "*" or a comma-separated list
+func cronList(bits uint64, field cronField) string {
+	var values []string
+	all := true
+	for value := field.min; value <= field.max; value++ {
+		if bits&(1<<value) != 0 {
+			values = append(values, strconv.Itoa(value))
+		} else {
+			all = false
+		}
+	}
+	if all {
+		return "*"
+	}
+	return strings.Join(values, ",")
+}
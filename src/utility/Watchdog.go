@@ -0,0 +1,302 @@
+/**
+ * Watchdog - Liveness checks and systemd notification
+ * Worker loops beat a heartbeat each time around, and probes take the
+ * locks everything else needs; a heartbeat that stops or a probe that
+ * doesn't return means the daemon is hung. Under systemd (Type=notify with
+ * WatchdogSec) the daemon reports READY=1 once started and pings WATCHDOG=1
+ * only while it is alive, so systemd restarts a hung daemon.
+ */
+
+package utility
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// livenessProbeTimeout is how long a probe may take before it counts as
+// deadlocked
+const livenessProbeTimeout = 5 * time.Second
+
+// heartbeatTimeout is how long a worker loop may go without beating, for
+// loops that come around at least every 30 seconds
+const heartbeatTimeout = 2 * time.Minute
+
+// LivenessCheck is the outcome of one heartbeat or probe
+type LivenessCheck struct {
+	Name   string
+	Alive  bool
+	Detail string
+}
+
+// Liveness is the outcome of all checks
+type Liveness struct {
+	Alive  bool
+	Checks []LivenessCheck
+}
+
+// Failures describes the checks that failed
+func (l Liveness) Failures() string {
+	var failures []string
+	for _, check := range l.Checks {
+		if !check.Alive {
+			failures = append(failures, check.Name+": "+check.Detail)
+		}
+	}
+	return strings.Join(failures, "; ")
+}
+
+// Heartbeat is a worker loop's sign of life
+type Heartbeat struct {
+	watchdog *Watchdog
+	name     string
+	within   time.Duration
+	last     time.Time
+}
+
+// probe checks that a lock or a worker answers
+type probe struct {
+	name    string
+	fn      func() error
+	pending time.Time // when a run that hasn't returned yet started
+}
+
+// Watchdog checks the daemon's liveness and feeds systemd's watchdog
+type Watchdog struct {
+	logger     *Logger
+	heartbeats map[string]*Heartbeat
+	probes     map[string]*probe
+	isRunning  bool
+	stopChan   chan struct{}
+	mu         sync.Mutex
+}
+
+var (
+	watchdogInstance *Watchdog
+	watchdogOnce     sync.Once
+)
+
+// GetWatchdog returns the singleton Watchdog instance
+func GetWatchdog() *Watchdog {
+	watchdogOnce.Do(func() {
+		watchdogInstance = &Watchdog{
+			logger:     GetLogger().With("watchdog"),
+			heartbeats: make(map[string]*Heartbeat),
+			probes:     make(map[string]*probe),
+		}
+	})
+	return watchdogInstance
+}
+
+// Heartbeat registers a worker loop that beats at least every within,
+// replacing one with the same name; call Stop when the loop ends
+func (w *Watchdog) Heartbeat(name string, within time.Duration) *Heartbeat {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	heartbeat := &Heartbeat{watchdog: w, name: name, within: within, last: time.Now()}
+	w.heartbeats[name] = heartbeat
+	return heartbeat
+}
+
+// Beat records that the loop came around
+func (h *Heartbeat) Beat() {
+	h.watchdog.mu.Lock()
+	defer h.watchdog.mu.Unlock()
+	h.last = time.Now()
+}
+
+// Stop unregisters the heartbeat of a loop that ended on purpose
+func (h *Heartbeat) Stop() {
+	h.watchdog.mu.Lock()
+	defer h.watchdog.mu.Unlock()
+	if h.watchdog.heartbeats[h.name] == h {
+		delete(h.watchdog.heartbeats, h.name)
+	}
+}
+
+// AddProbe registers a check that must return within livenessProbeTimeout, such as
+// taking and releasing a lock, replacing one with the same name
+func (w *Watchdog) AddProbe(name string, fn func() error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.probes[name] = &probe{name: name, fn: fn}
+}
+
+// Check runs the probes and looks at the heartbeats
+func (w *Watchdog) Check() Liveness {
+	w.mu.Lock()
+	var checks []LivenessCheck
+	for _, heartbeat := range w.heartbeats {
+		check := LivenessCheck{Name: heartbeat.name, Alive: true}
+		age := time.Since(heartbeat.last)
+		check.Detail = fmt.Sprintf("last beat %s ago", age.Round(time.Second))
+		if age > heartbeat.within {
+			check.Alive = false
+			check.Detail = fmt.Sprintf("no beat for %s (stuck?)", age.Round(time.Second))
+		}
+		checks = append(checks, check)
+	}
+	probes := make([]*probe, 0, len(w.probes))
+	for _, p := range w.probes {
+		probes = append(probes, p)
+	}
+	w.mu.Unlock()
+
+	// Probes run side by side, so one stuck probe doesn't hold up the rest
+	results := make(chan LivenessCheck, len(probes))
+	for _, p := range probes {
+		go func(p *probe) { results <- w.runProbe(p) }(p)
+	}
+	for range probes {
+		checks = append(checks, <-results)
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	liveness := Liveness{Alive: true, Checks: checks}
+	for _, check := range checks {
+		if !check.Alive {
+			liveness.Alive = false
+		}
+	}
+	return liveness
+}
+
+// runProbe runs a probe unless its last run is still stuck
+func (w *Watchdog) runProbe(p *probe) LivenessCheck {
+	w.mu.Lock()
+	if !p.pending.IsZero() {
+		stuck := time.Since(p.pending)
+		w.mu.Unlock()
+		return LivenessCheck{Name: p.name, Detail: fmt.Sprintf("not responding for %s (deadlocked?)", stuck.Round(time.Second))}
+	}
+	p.pending = time.Now()
+	w.mu.Unlock()
+
+	done := make(chan error, 1)
+	Go("probe-"+p.name, func() {
+		err := fmt.Errorf("probe panicked")
+		defer func() {
+			w.mu.Lock()
+			p.pending = time.Time{}
+			w.mu.Unlock()
+			done <- err
+		}()
+		err = p.fn()
+	})
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return LivenessCheck{Name: p.name, Detail: err.Error()}
+		}
+		return LivenessCheck{Name: p.name, Alive: true, Detail: "responding"}
+	case <-time.After(livenessProbeTimeout):
+		return LivenessCheck{Name: p.name, Detail: fmt.Sprintf("not responding within %s (deadlocked?)", livenessProbeTimeout)}
+	}
+}
+
+// Start pings systemd's watchdog while the checks pass, if the service has
+// WatchdogSec set
+func (w *Watchdog) Start() {
+	interval := WatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isRunning {
+		return
+	}
+	w.isRunning = true
+	w.stopChan = make(chan struct{})
+	stop := w.stopChan
+
+	// Ping at half the timeout, as systemd recommends
+	w.logger.Info("Pinging the systemd watchdog every %v while alive", interval/2)
+	go Supervise("watchdog", func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		healthy := true
+		for {
+			liveness := w.Check()
+			switch {
+			case liveness.Alive:
+				if !healthy {
+					w.logger.Info("Liveness checks pass again")
+					_, _ = SdNotify("STATUS=Running")
+				}
+				if _, err := SdNotify("WATCHDOG=1"); err != nil {
+					w.logger.Warn("Failed to ping the systemd watchdog: %v", err)
+				}
+			case healthy:
+				// No ping, so systemd restarts the daemon once the timeout passes
+				w.logger.Error("Liveness check failed, withholding the watchdog ping: %s", liveness.Failures())
+				_, _ = SdNotify("STATUS=Hung: " + liveness.Failures())
+			}
+			healthy = liveness.Alive
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop halts the watchdog pings
+func (w *Watchdog) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.isRunning {
+		return
+	}
+	w.isRunning = false
+	close(w.stopChan)
+}
+
+// WatchdogInterval returns the watchdog timeout systemd set for this
+// process (WatchdogSec), or 0 without one
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// SdNotify sends state (e.g. "READY=1") to systemd and reports whether it
+// was sent; outside a Type=notify service there is nobody to send it to
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// An abstract socket is named with a leading @
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to reach systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return true, nil
+}